@@ -20,11 +20,20 @@ import (
     "os/signal"
     "syscall"
     "flag"
+    "strings"
+    "time"
+    "sort"
+    "strconv"
+    "net/http"
     "path/filepath"
+    "DutyRoster/ical"
+    "DutyRoster/authz"
     "DutyRoster/config"
+    "DutyRoster/errorset"
     "DutyRoster/logging"
     "DutyRoster/syncParam"
     "DutyRoster/datastore"
+    "DutyRoster/restapi"
 )
 
 
@@ -57,21 +66,360 @@ func setuplogging() error{
 }
 
 //Set up the backend datastore for data operations.
+//Server never starts on an outdated DB schema, run 'migrate up' to update it.
 func setupDataStore() error {
     dbObj := datastore.GetDataStoreObj()
     err := dbObj.CreateDBConnection()
     if err != nil {
         return err
     }
-    return dbObj.CreateDataStoreTables()
+    return dbObj.InitDataStore()
 }
+
+//Run the schema migration command, 'migrate up|down|status'.
+func runMigrateCmd(args []string) error {
+    if len(args) != 2 || args[0] != "migrate" {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    dbObj := datastore.GetDataStoreObj()
+    err := dbObj.CreateDBConnection()
+    if err != nil {
+        return err
+    }
+    switch(args[1]) {
+        case "up":
+            return dbObj.MigrateUp()
+        case "down":
+            return dbObj.MigrateDown()
+        case "status":
+            statusList, err := dbObj.ListMigrations()
+            if err != nil {
+                return err
+            }
+            fmt.Printf("\n%-10s %-10s %-25s %s\n", "VERSION", "STATUS",
+                       "APPLIED AT", "NAME")
+            for _, status := range(statusList) {
+                state := "pending"
+                appliedTime := "-"
+                if status.IsModified() {
+                    state = "modified"
+                } else if status.IsApplied() {
+                    state = "applied"
+                }
+                if status.IsApplied() {
+                    appliedTime = status.AppliedTime().Format(
+                                                "2006-01-02 15:04:05")
+                }
+                fmt.Printf("%-10d %-10s %-25s %s\n", status.Version(), state,
+                           appliedTime, status.Name())
+            }
+            return nil
+    }
+    printHelp()
+    return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Run the role command, 'role list|create|delete'. Roles created here can be
+// granted in any org/unit, roles of an org/unit are managed over the API.
+func runRoleCmd(args []string) error {
+    if len(args) < 2 || args[0] != "role" {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err := setupDataStore()
+    if err != nil {
+        return err
+    }
+    dbObj := datastore.GetDataStoreObj()
+    switch(args[1]) {
+        case "list":
+            roleList, err := dbObj.ListRoles()
+            if err != nil {
+                return err
+            }
+            fmt.Printf("\n%-20s %-20s %-38s %s\n", "ROLETYPE", "NAME", "ORG",
+                       "PERMISSIONS")
+            for _, rl := range(roleList) {
+                scope := "-"
+                if !syncParam.IsUUIDEmpty(rl.OrgUUID()) {
+                    scope = syncParam.UUIDtoString(rl.OrgUUID())
+                }
+                perms := strings.Join(rl.Permissions(), ",")
+                if rl.IsSystem() {
+                    perms = "(system)"
+                }
+                fmt.Printf("%-20d %-20s %-38s %s\n", rl.RoleType(), rl.Name(),
+                           scope, perms)
+            }
+            return nil
+        case "create":
+            if len(args) != 4 {
+                break
+            }
+            perms := strings.Split(args[3], ",")
+            for _, perm := range(perms) {
+                if !authz.IsValidAction(perm) {
+                    fmt.Printf("Unknown permission '%s'\n", perm)
+                    return fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+                }
+            }
+            rl := datastore.NewRole(args[2], perms, syncParam.UUID{})
+            err = dbObj.CreateRole(rl)
+            if err != nil {
+                return err
+            }
+            fmt.Printf("Created role %s, roletype %d\n", rl.Name(),
+                       rl.RoleType())
+            return nil
+        case "delete":
+            if len(args) != 3 {
+                break
+            }
+            roleType, err := strconv.ParseUint(args[2], 10, 64)
+            if err != nil {
+                return fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+            }
+            return dbObj.DeleteRole(datastore.NewRoleRef(
+                                            datastore.RoleBit(roleType)))
+    }
+    printHelp()
+    return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Run the loglevel command on the running server, 'loglevel show',
+// 'loglevel set <level|-> [<package>=<level> ...]' or 'loglevel reset'.
+//The server is reached on the admin API, it needs the admin secret in config.
+func runLogLevelCmd(args []string) error {
+    if len(args) < 2 || args[0] != "loglevel" {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    var defLevel string
+    var packages map[string]string
+    var err error
+    switch(args[1]) {
+        case "show":
+            if len(args) != 2 {
+                break
+            }
+            defLevel, packages, err = restapi.RequestLogLevels(
+                                        http.MethodGet, "", nil)
+        case "set":
+            if len(args) < 3 {
+                break
+            }
+            //'-' keeps the default level of server.
+            if args[2] != "-" {
+                defLevel = args[2]
+            }
+            packages = make(map[string]string)
+            for _, arg := range(args[3:]) {
+                kv := strings.SplitN(arg, "=", 2)
+                if len(kv) != 2 {
+                    return fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+                }
+                packages[kv[0]] = kv[1]
+            }
+            defLevel, packages, err = restapi.RequestLogLevels(
+                                        http.MethodPut, defLevel, packages)
+        case "reset":
+            if len(args) != 2 {
+                break
+            }
+            defLevel, packages, err = restapi.RequestLogLevels(
+                                        http.MethodDelete, "", nil)
+        default:
+            printHelp()
+            return fmt.Errorf("%s",
+                              errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if err != nil {
+        return err
+    }
+    if len(defLevel) == 0 {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    fmt.Printf("\n%-20s %s\n", "PACKAGE", "LEVEL")
+    fmt.Printf("%-20s %s\n", "(default)", defLevel)
+    pkgs := make([]string, 0, len(packages))
+    for pkg := range(packages) {
+        pkgs = append(pkgs, pkg)
+    }
+    sort.Strings(pkgs)
+    for _, pkg := range(pkgs) {
+        fmt.Printf("%-20s %s\n", pkg, packages[pkg])
+    }
+    return nil
+}
+
+//Run the user command, 'user approve <userid>'. New accounts cannot log in
+// until approved, the first admin of a new deployment is approved offline.
+func runUserCmd(args []string) error {
+    if len(args) != 3 || args[0] != "user" || args[1] != "approve" {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err := setupDataStore()
+    if err != nil {
+        return err
+    }
+    dbObj := datastore.GetDataStoreObj()
+    user := datastore.NewUserRef(args[2])
+    err = dbObj.GetUser(user)
+    if err != nil {
+        return err
+    }
+    user.SetStatus(datastore.USER_APPROVED)
+    err = dbObj.UpdateUserAccount(user)
+    if err != nil {
+        return err
+    }
+    fmt.Printf("Approved user %s\n", user.Userid())
+    return nil
+}
+
+//Run the org command, 'org approve <org-uuid>'. The roles in a new top level
+// org grant nothing until it is approved offline, the org and all its units
+// are approved.
+func runOrgCmd(args []string) error {
+    if len(args) != 3 || args[0] != "org" || args[1] != "approve" {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgUUID := syncParam.StringtoUUID(args[2])
+    if syncParam.IsUUIDEmpty(orgUUID) {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err := setupDataStore()
+    if err != nil {
+        return err
+    }
+    dbObj := datastore.GetDataStoreObj()
+    or := datastore.NewOrgRef(orgUUID)
+    err = dbObj.GetOrg(or)
+    if err != nil {
+        return err
+    }
+    or.SetStatus(datastore.ORG_APPROVED)
+    err = dbObj.UpdateOrg(or)
+    if err != nil {
+        return err
+    }
+    fmt.Printf("Approved org %s\n", or.Name())
+    return nil
+}
+
+//Run the holiday command, 'holiday import <calendar-uuid> <file>'. The
+// iCalendar file is imported offline, the holidays imported earlier into the
+// calendar are replaced.
+func runHolidayCmd(args []string) error {
+    if len(args) != 4 || args[0] != "holiday" || args[1] != "import" {
+        printHelp()
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    calUUID := syncParam.StringtoUUID(args[2])
+    if syncParam.IsUUIDEmpty(calUUID) {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    file, err := os.Open(args[3])
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    events, err := ical.ReadEvents(file)
+    if err != nil {
+        return err
+    }
+    err = setupDataStore()
+    if err != nil {
+        return err
+    }
+    dbObj := datastore.GetDataStoreObj()
+    cal := datastore.NewHolidayCalendarRef(calUUID)
+    err = dbObj.GetHolidayCalendar(cal)
+    if err != nil {
+        return err
+    }
+    from, to := datastore.HolidayImportRange(time.Now())
+    hols, err := datastore.HolidaysFromEvents(cal, events, from, to)
+    if err != nil {
+        return err
+    }
+    err = dbObj.ImportHolidays(cal.UUID(), hols)
+    if err != nil {
+        return err
+    }
+    fmt.Printf("Imported %d holidays into calendar %s\n", len(hols),
+               cal.Name())
+    return nil
+}
+
+//Block until an exit signal, the logging signals are handled meanwhile.
+func waitExitSignal(exitsignal <-chan os.Signal, logsignal <-chan os.Signal) {
+    for {
+        select {
+            case <- exitsignal:
+                return
+            case sig := <- logsignal:
+                handleLoggingSignal(sig)
+        }
+    }
+}
+
+//Reopen the log file on SIGHUP, trace all packages on SIGUSR1 and revert the
+// log levels to config file on SIGUSR2.
+func handleLoggingSignal(sig os.Signal) {
+    log := logging.GetAppLoggerObj()
+    switch(sig) {
+        case syscall.SIGHUP:
+            err := logging.ReopenLogFile()
+            if err != nil {
+                fmt.Println("ERROR: Failed to reopen log file, " +
+                            err.Error())
+            }
+        case syscall.SIGUSR1:
+            logging.SetLogLevels("trace", nil)
+            log.Info("Log level of all packages is set to trace")
+        case syscall.SIGUSR2:
+            logging.ResetLogLevels()
+            log.Info("Log levels are reset to config file")
+    }
+}
+
 func printHelp() {
     helpstr := "\n\t DutyRoster Server Application" +
     "\n\t An application to schedule work shifts for employeess in an org." +
-    "\n\t   USAGE: ./DutyRoster {ARGS}" +
+    "\n\t   USAGE: ./DutyRoster {ARGS} [COMMAND]" +
     "\n\t      ARGS:" +
     "\n\t      -c <file>         :- Appplication json configuration file" +
-    "\n\t      -cfgfile <file>  :- Appplication json configuration file\n\n"
+    "\n\t      -cfgfile <file>  :- Appplication json configuration file" +
+    "\n\t      COMMAND:" +
+    "\n\t      migrate up       :- Apply all pending DB schema migrations" +
+    "\n\t      migrate down     :- Revert the latest DB schema migration" +
+    "\n\t      migrate status   :- Show the DB schema migrations" +
+    "\n\t      role list        :- Show all the roles" +
+    "\n\t      role create <name> <perm,...> :- Create a role for all orgs" +
+    "\n\t      role delete <roletype> :- Delete a custom role" +
+    "\n\t      user approve <userid> :- Approve a new user account to login" +
+    "\n\t      org approve <org-uuid> :- Approve a new top level org and" +
+    "\n\t                       its units" +
+    "\n\t      holiday import <calendar-uuid> <file.ics> :- Import the" +
+    "\n\t                       holidays of an iCalendar file" +
+    "\n\t      loglevel show    :- Show the log levels of running server" +
+    "\n\t      loglevel set <level|-> [<package>=<level> ...] :- Set the" +
+    "\n\t                       log levels of running server, '-' keeps" +
+    "\n\t                       the default level" +
+    "\n\t      loglevel reset   :- Revert the log levels to config file" +
+    "\n\t      SIGNALS:" +
+    "\n\t      SIGHUP           :- Reopen the log file" +
+    "\n\t      SIGUSR1          :- Set the log level of all packages to" +
+    "\n\t                       trace" +
+    "\n\t      SIGUSR2          :- Revert the log levels to config file\n\n"
     fmt.Print(helpstr)
 }
 
@@ -96,20 +444,53 @@ func main() {
     if err != nil {
         syncObj.PanicApp("Exiting the application : %s", err.Error())
     }
+    if len(flag.Args()) > 0 {
+        //Run the command and exit, server is not started.
+        if flag.Args()[0] == "role" {
+            err = runRoleCmd(flag.Args())
+        } else if flag.Args()[0] == "holiday" {
+            err = runHolidayCmd(flag.Args())
+        } else if flag.Args()[0] == "user" {
+            err = runUserCmd(flag.Args())
+        } else if flag.Args()[0] == "org" {
+            err = runOrgCmd(flag.Args())
+        } else if flag.Args()[0] == "loglevel" {
+            err = runLogLevelCmd(flag.Args())
+        } else {
+            err = runMigrateCmd(flag.Args())
+        }
+        syncObj.DestroyAllRoutines()
+        if err != nil {
+            fmt.Println("ERROR: " + err.Error())
+            return
+        }
+        fmt.Println("Done")
+        return
+    }
     err = setupDataStore()
     if err != nil {
         syncObj.PanicApp("Exiting the application : %s", err.Error())
     }
+    err = restapi.StartServer()
+    if err != nil {
+        syncObj.PanicApp("Exiting the application : %s", err.Error())
+    }
     // Exit the main thread on Ctrl C 
     fmt.Println("\n\n\n *** Press Ctrl+C to Exit *** \n\n\n")
     exitsignal := make(chan os.Signal, 1)
     signal.Notify(exitsignal, syscall.SIGINT, syscall.SIGTERM)
+    //SIGHUP reopens the log file, after it is moved away by logrotate.
+    //SIGUSR1/SIGUSR2 switch the log levels to trace and back to config.
+    logsignal := make(chan os.Signal, 1)
+    signal.Notify(logsignal, syscall.SIGHUP, syscall.SIGUSR1,
+                  syscall.SIGUSR2)
     //Add exit routine into waitgroup
     syncObj.AddRoutineInWaitGroup()
     go func() {
         // Blocking the routine for the exit signal.
-        <- exitsignal
-        //Send exit signal to all the goroutines.
+        waitExitSignal(exitsignal, logsignal)
+        //Send exit signal to all the goroutines, in-flight API requests are
+        //completed before exit.
         syncObj.DestroyAllRoutines()
         //Mark exit routine is done 
         syncObj.ExitRoutineInWaitGroup()
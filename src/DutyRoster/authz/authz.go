@@ -0,0 +1,245 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package authz
+
+//******************************************************************************
+// Role based access control of the application. Every action has a minimum
+// role the user must hold on the target org/unit. Roles are inherited down the
+// org hierarchy, a role in an org/unit applies to all its descendants. A
+// higher role in the role bits grants all the actions of lower roles. Custom
+// roles are not in the hierarchy, they grant only the actions in their
+// permissions.
+//******************************************************************************
+import (
+    "fmt"
+    "time"
+    "DutyRoster/logging"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//Operation on an org/unit that needs an authorization.
+type Action string
+
+const (
+    VIEW_ORG Action = "view org"
+    //Create a child org/unit, the target is the parent org/unit.
+    CREATE_ORG Action = "create org"
+    UPDATE_ORG Action = "update org"
+    DELETE_ORG Action = "delete org"
+    VIEW_MEMBERS Action = "view members"
+    MANAGE_MEMBERS Action = "manage members"
+    //View and manage other user accounts, the target is an org/unit the
+    // account is a member of.
+    VIEW_USER Action = "view user"
+    MANAGE_USER Action = "manage user"
+    VIEW_SHIFTS Action = "view shifts"
+    MANAGE_SHIFTS Action = "manage shifts"
+    PUBLISH_ROSTER Action = "publish roster"
+    APPROVE_LEAVE Action = "approve leave"
+    //Create/delete the leave policies of an org/unit and adjust balances.
+    MANAGE_LEAVE Action = "manage leave"
+    //Create/update/delete the custom roles of an org/unit.
+    MANAGE_ROLES Action = "manage roles"
+    //Create/delete the holiday calendars of an org/unit, add and import their
+    // holidays.
+    MANAGE_HOLIDAYS Action = "manage holidays"
+    //Set/delete the skills and certifications of other users, the target is an
+    // org/unit the user is a member of.
+    MANAGE_SKILLS Action = "manage skills"
+)
+
+//Minimum role needed on the target org/unit for each action. Actions not in
+// the table are never allowed.
+var policy = map[Action]datastore.RoleBit{
+    VIEW_ORG : datastore.ENDUSER,
+    CREATE_ORG : datastore.ROOTADMIN,
+    UPDATE_ORG : datastore.ROOTADMIN,
+    DELETE_ORG : datastore.ROOTADMIN,
+    VIEW_MEMBERS : datastore.ENDUSER,
+    MANAGE_MEMBERS : datastore.MANAGER,
+    VIEW_USER : datastore.MANAGER,
+    MANAGE_USER : datastore.ROOTADMIN,
+    VIEW_SHIFTS : datastore.ENDUSER,
+    MANAGE_SHIFTS : datastore.MANAGER,
+    PUBLISH_ROSTER : datastore.MANAGER,
+    APPROVE_LEAVE : datastore.MANAGER,
+    MANAGE_LEAVE : datastore.ROOTADMIN,
+    MANAGE_ROLES : datastore.ROOTADMIN,
+    MANAGE_HOLIDAYS : datastore.ROOTADMIN,
+    MANAGE_SKILLS : datastore.MANAGER,
+}
+
+//Minimum role needed for the action, 0 for an unknown action.
+func RequiredRole(action Action) datastore.RoleBit {
+    return policy[action]
+}
+
+//Return true if 'name' is a known action, only the known actions are allowed
+// as the permissions of a custom role.
+func IsValidAction(name string) bool {
+    _, ok := policy[Action(name)]
+    return ok
+}
+
+//Return true if any of the role bits is 'minRole' or a higher role.
+func hasMinRole(roles datastore.RoleBit, minRole datastore.RoleBit) bool {
+    if minRole == 0 {
+        return false
+    }
+    for bit := minRole; bit <= datastore.ROOTADMIN; bit <<= 1 {
+        if roles & bit != 0 {
+            return true
+        }
+    }
+    return false
+}
+
+//Return true if the role bits allow the action, either by a system role in
+// the policy or by a custom role that has the action in its permissions.
+func isActionAllowed(roles datastore.RoleBit, action Action) bool {
+    if hasMinRole(roles, policy[action]) {
+        return true
+    }
+    for bit := datastore.ROOTADMIN << 1; bit <= datastore.MAX_ROLEBIT;
+        bit <<= 1 {
+        if roles & bit == 0 {
+            continue
+        }
+        rl := datastore.NewRoleRef(bit)
+        err := datastore.GetDataStoreObj().GetRole(rl)
+        if err == nil && rl.HasPermission(string(action)) {
+            return true
+        }
+    }
+    return false
+}
+
+//Check the org/unit and all its ancestors are active. Roles held in an org
+// that is not approved yet grant nothing, a new org cannot be used until it is
+// approved.
+func CheckOrgActive(orgUUID syncParam.UUID) error {
+    or := datastore.NewOrgRef(orgUUID)
+    err := datastore.GetDataStoreObj().GetOrg(or)
+    if err != nil {
+        return err
+    }
+    now := time.Now()
+    for entry := or; entry != nil; entry = entry.Parent() {
+        if !entry.IsActive(now) {
+            return fmt.Errorf("%s",
+                              errorset.ERROR_TYPES[errorset.ORG_NOT_ACTIVE])
+        }
+    }
+    return nil
+}
+
+//Check the user is allowed to do the action on org/unit 'orgUUID'. Returns
+// ACCESS_DENIED when not allowed, ORG_NOT_ACTIVE when the org/unit or an
+// ancestor is not approved or is deleted/expired, and the datastore error when
+// the roles cannot be read, eg: org/unit is not present.
+func Authorize(user *datastore.Users, action Action,
+               orgUUID syncParam.UUID) error {
+    log := logging.GetAppLoggerObj()
+    _, ok := policy[action]
+    if !ok || user == nil {
+        log.Info("Access denied, unknown action '%s'/user", action)
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.ACCESS_DENIED])
+    }
+    err := CheckOrgActive(orgUUID)
+    if err != nil {
+        log.Info("Access denied to user %s for '%s' on org %s, err : %s",
+                 user.Userid(), action, syncParam.UUIDtoString(orgUUID), err)
+        return err
+    }
+    roles, err := datastore.GetDataStoreObj().GetEffectiveRoles(user.Userid(),
+                                                                orgUUID)
+    if err != nil {
+        return err
+    }
+    if !isActionAllowed(roles, action) {
+        log.Info("Access denied to user %s for '%s' on org %s",
+                 user.Userid(), action, syncParam.UUIDtoString(orgUUID))
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.ACCESS_DENIED])
+    }
+    return nil
+}
+
+//Return true if the user is allowed to do the action on org/unit 'orgUUID'.
+func Can(user *datastore.Users, action Action, orgUUID syncParam.UUID) bool {
+    return Authorize(user, action, orgUUID) == nil
+}
+
+//Check the user is allowed to grant/revoke the role bits in org/unit
+// 'orgUUID'. User must be allowed to manage members, and must hold the highest
+// system role in 'roles' or a higher role, so no one can grant a role above its
+// own. For custom roles the user must be allowed all the permissions of role.
+func AuthorizeGrant(user *datastore.Users, roles datastore.RoleBit,
+                    orgUUID syncParam.UUID) error {
+    err := Authorize(user, MANAGE_MEMBERS, orgUUID)
+    if err != nil {
+        return err
+    }
+    effective, err := datastore.GetDataStoreObj().GetEffectiveRoles(
+                                                    user.Userid(), orgUUID)
+    if err != nil {
+        return err
+    }
+    for bit := datastore.ROOTADMIN; bit >= datastore.ENDUSER; bit >>= 1 {
+        if roles & bit != 0 {
+            if !hasMinRole(effective, bit) {
+                return fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.ACCESS_DENIED])
+            }
+            break
+        }
+    }
+    for bit := datastore.ROOTADMIN << 1; bit <= datastore.MAX_ROLEBIT;
+        bit <<= 1 {
+        if roles & bit == 0 {
+            continue
+        }
+        rl := datastore.NewRoleRef(bit)
+        err = datastore.GetDataStoreObj().GetRole(rl)
+        if err != nil {
+            return err
+        }
+        for _, perm := range(rl.Permissions()) {
+            if !isActionAllowed(effective, Action(perm)) {
+                return fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.ACCESS_DENIED])
+            }
+        }
+    }
+    return nil
+}
+
+//Return true if the user is allowed to do the action on any approved org/unit
+// where the user 'userid' is a member. Used to authorize the operations on
+// other user accounts, 'userid' becomes a member only by accepting an invite.
+func CanOnUser(user *datastore.Users, action Action, userid string) bool {
+    members, err := datastore.GetDataStoreObj().ListUserMemberships(userid)
+    if err != nil {
+        return false
+    }
+    for i := range(members) {
+        if Can(user, action, members[i].UUID()) {
+            return true
+        }
+    }
+    return false
+}
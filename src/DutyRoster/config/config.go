@@ -27,13 +27,39 @@ type Config struct {
     Logging struct {
         // loglevel can be trace, info, warning, error
         LogLevel string `json:"loglevel"`
+        // loglevel of the packages that differ from the loglevel above,
+        // eg: {"datastore" : "trace"}. The levels can be changed at runtime
+        // by the admin API, 'loglevel' command and signals SIGUSR1/SIGUSR2.
+        Packages map[string]string `json:"packages"`
         // Set filepath to empty to output logs only to stdout.
         FilePath string `json:"filepath"`
+        // Action when the log queue is full, can be block, dropoldest, drop.
+        // 'block' waits for room in the queue, 'dropoldest' discards the
+        // oldest queued log and 'drop' discards the new log. Dropped logs are
+        // counted and reported. Defaults to block.
+        Overflow string `json:"overflow"`
+        // Format of the log lines, can be text or json. 'json' writes one
+        // JSON object per line with time, level, caller, msg and the fields
+        // of the logger. Defaults to text.
+        Format string `json:"format"`
+        // Rotation of the log file at filepath. The file is rotated when it
+        // grows beyond 'maxsize' MB or 'rotateinterval' seconds after the
+        // first log in it, also across restarts. 0 disables the limit.
+        // 'maxfiles' rotated files are kept, the oldest are deleted, 0 keeps
+        // all. Rotated files are gzipped when 'compress' is set. The file is
+        // reopened on SIGHUP, to work with external tools like logrotate.
+        MaxSize uint64 `json:"maxsize"`
+        RotateInterval uint64 `json:"rotateinterval"`
+        MaxFiles uint64 `json:"maxfiles"`
+        Compress bool `json:"compress"`
     }`json:"logging"`
     DB struct {
-        //Name of DB driver, Only SQLLITE is supported now.
+        //Name of DB driver, can be postgres/sqlite/memory.
+        //'memory' keeps all the records in memory and needs no other DB
+        // params, the records are lost on exit.
         Driver string `json:"driver"`
-        //Path of DB to use in application., eg: /tmp/test.db
+        //Name of DB to use in application, For sqlite it is the path of DB
+        //file, eg: /tmp/test.db
         Dbname string `json:"dbname"`
         //Ip address of Host where DB server is running.
         Ipaddr string `json:"ipaddr"`
@@ -46,6 +72,48 @@ type Config struct {
         //Transport protocol to connect to db, can be tcp/udp
         Transport string `json:"transport`
     }`json:"db"`
+    HTTP struct {
+        //Address to listen for the API requests, eg: :8080
+        //The HTTP server is not started when it is empty.
+        ListenAddr string `json:"listenaddr"`
+        //Timeouts in seconds to read a request and write a response, and to
+        // keep an idle connection. Set 0 for no timeout.
+        ReadTimeout uint64 `json:"readtimeout"`
+        WriteTimeout uint64 `json:"writetimeout"`
+        IdleTimeout uint64 `json:"idletimeout"`
+        //Time in seconds to wait for the in-flight requests on exit, Set 0
+        // to wait until all the requests are complete.
+        ShutdownTimeout uint64 `json:"shutdowntimeout"`
+    }`json:"http"`
+    Credentials struct {
+        //Password hash algorithm for new hashes, can be argon2id/bcrypt.
+        //Defaults to argon2id. Existing hashes of other algorithm/params are
+        // re-hashed on next login.
+        Algorithm string `json:"algorithm"`
+        //Cost of bcrypt hash, defaults to 12.
+        BcryptCost int `json:"bcryptcost"`
+        //Iterations, memory in KiB and threads of argon2id hash, defaults to
+        // 3, 65536 and 2.
+        Argon2Time uint32 `json:"argon2time"`
+        Argon2Memory uint32 `json:"argon2memory"`
+        Argon2Threads uint8 `json:"argon2threads"`
+    }`json:"credentials"`
+    Session struct {
+        //Secret key to sign the access tokens. A random key is used when it
+        // is empty, the tokens are not valid after a restart in that case.
+        Secret string `json:"secret"`
+        //Lifetime of access token in seconds, defaults to 900.
+        AccessTokenLifetime uint64 `json:"accesstokenlifetime"`
+        //Lifetime of refresh token in seconds, defaults to 604800(a week).
+        //Refresh token is replaced on every refresh.
+        RefreshTokenLifetime uint64 `json:"refreshtokenlifetime"`
+    }`json:"session"`
+    Admin struct {
+        //Secret to access the admin API endpoints, eg: runtime log levels.
+        //Sent in 'X-Admin-Secret' header, the admin endpoints are disabled
+        // when it is empty. The CLI commands use it to reach the server.
+        Secret string `json:"secret"`
+    }`json:"admin"`
 
 }
 
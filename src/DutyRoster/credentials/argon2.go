@@ -0,0 +1,98 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+    "fmt"
+    "strings"
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "golang.org/x/crypto/argon2"
+    "DutyRoster/errorset"
+)
+
+const (
+    ARGON2_SALT_LEN = 16
+    ARGON2_KEY_LEN = 32
+)
+
+//Encode the argon2id hash in PHC string format,
+// eg: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func argon2Encode(salt []byte, key []byte, time uint32, memory uint32,
+                  threads uint8) string {
+    return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", ARGON2ID_ALGORITHM,
+                       argon2.Version, memory, time, threads,
+                       base64.RawStdEncoding.EncodeToString(salt),
+                       base64.RawStdEncoding.EncodeToString(key))
+}
+
+//Decode the PHC string of argon2id hash, return false on invalid hash.
+func argon2Decode(hash string) (salt []byte, key []byte, time uint32,
+                                memory uint32, threads uint8, ok bool) {
+    fields := strings.Split(hash, "$")
+    if len(fields) != 6 || fields[1] != ARGON2ID_ALGORITHM {
+        return nil, nil, 0, 0, 0, false
+    }
+    var version int
+    _, err := fmt.Sscanf(fields[2], "v=%d", &version)
+    if err != nil || version != argon2.Version {
+        return nil, nil, 0, 0, 0, false
+    }
+    _, err = fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &memory, &time, &threads)
+    if err != nil || time == 0 || threads == 0 {
+        return nil, nil, 0, 0, 0, false
+    }
+    salt, err = base64.RawStdEncoding.DecodeString(fields[4])
+    if err != nil {
+        return nil, nil, 0, 0, 0, false
+    }
+    key, err = base64.RawStdEncoding.DecodeString(fields[5])
+    if err != nil || len(key) == 0 {
+        return nil, nil, 0, 0, 0, false
+    }
+    return salt, key, time, memory, threads, true
+}
+
+func argon2Hash(password string, params *hashParams) (string, error) {
+    salt := make([]byte, ARGON2_SALT_LEN)
+    _, err := rand.Read(salt)
+    if err != nil {
+        return "", fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    key := argon2.IDKey([]byte(password), salt, params.argon2Time,
+                        params.argon2Memory, params.argon2Threads,
+                        ARGON2_KEY_LEN)
+    return argon2Encode(salt, key, params.argon2Time, params.argon2Memory,
+                        params.argon2Threads), nil
+}
+
+func argon2Verify(hash string, password string,
+                  params *hashParams) (bool, bool) {
+    salt, key, time, memory, threads, ok := argon2Decode(hash)
+    if !ok {
+        return false, false
+    }
+    newKey := argon2.IDKey([]byte(password), salt, time, memory, threads,
+                           uint32(len(key)))
+    if subtle.ConstantTimeCompare(key, newKey) != 1 {
+        return false, false
+    }
+    rehash := params.algorithm != ARGON2ID_ALGORITHM ||
+              time != params.argon2Time || memory != params.argon2Memory ||
+              threads != params.argon2Threads ||
+              len(salt) != ARGON2_SALT_LEN || len(key) != ARGON2_KEY_LEN
+    return true, rehash
+}
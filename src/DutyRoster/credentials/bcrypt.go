@@ -0,0 +1,56 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+import (
+    "fmt"
+    "strings"
+    "golang.org/x/crypto/bcrypt"
+    "DutyRoster/errorset"
+)
+
+//bcrypt uses only the first 72 bytes of password.
+const BCRYPT_MAX_PWD_LEN = 72
+
+//bcrypt hashes are in modular crypt format, eg: $2a$12$<salt+key>
+func isBcryptHash(hash string) bool {
+    return strings.HasPrefix(hash, "$2a$") ||
+           strings.HasPrefix(hash, "$2b$") ||
+           strings.HasPrefix(hash, "$2y$")
+}
+
+func bcryptHash(password string, params *hashParams) (string, error) {
+    if len(password) > BCRYPT_MAX_PWD_LEN {
+        return "", fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    hash, err := bcrypt.GenerateFromPassword([]byte(password),
+                                             params.bcryptCost)
+    if err != nil {
+        return "", fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return string(hash), nil
+}
+
+func bcryptVerify(hash string, password string,
+                  params *hashParams) (bool, bool) {
+    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+    if err != nil {
+        return false, false
+    }
+    cost, _ := bcrypt.Cost([]byte(hash))
+    rehash := params.algorithm != BCRYPT_ALGORITHM ||
+              cost != params.bcryptCost
+    return true, rehash
+}
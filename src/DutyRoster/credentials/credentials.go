@@ -0,0 +1,110 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credentials
+
+//******************************************************************************
+// Password hashing for user accounts. Hashes are salted and carry the
+// algorithm and its parameters, so the hash can be verified even after the
+// configured parameters are changed. NEVER compare the hashes directly, always
+// use VerifyPassword.
+//******************************************************************************
+import (
+    "fmt"
+    "strings"
+    "DutyRoster/config"
+    "DutyRoster/errorset"
+)
+
+//Password hash algorithms supported by the application.
+const (
+    ARGON2ID_ALGORITHM = "argon2id"
+    BCRYPT_ALGORITHM = "bcrypt"
+)
+
+//Default hash parameters, used when not set in the configuration.
+const (
+    DEFAULT_BCRYPT_COST = 12
+    DEFAULT_ARGON2_TIME = 3
+    DEFAULT_ARGON2_MEMORY = 64 * 1024
+    DEFAULT_ARGON2_THREADS = 2
+)
+
+//Algorithm and parameters for the new password hashes.
+type hashParams struct {
+    algorithm string
+    bcryptCost int
+    argon2Time uint32
+    argon2Memory uint32
+    argon2Threads uint8
+}
+
+//Read the hash params from configuration, defaults for the params not set.
+func getHashParams() hashParams {
+    credConfig := config.GetConfigInstance().Credentials
+    params := hashParams{algorithm : credConfig.Algorithm,
+                         bcryptCost : credConfig.BcryptCost,
+                         argon2Time : credConfig.Argon2Time,
+                         argon2Memory : credConfig.Argon2Memory,
+                         argon2Threads : credConfig.Argon2Threads}
+    if len(params.algorithm) == 0 {
+        params.algorithm = ARGON2ID_ALGORITHM
+    }
+    if params.bcryptCost == 0 {
+        params.bcryptCost = DEFAULT_BCRYPT_COST
+    }
+    if params.argon2Time == 0 {
+        params.argon2Time = DEFAULT_ARGON2_TIME
+    }
+    if params.argon2Memory == 0 {
+        params.argon2Memory = DEFAULT_ARGON2_MEMORY
+    }
+    if params.argon2Threads == 0 {
+        params.argon2Threads = DEFAULT_ARGON2_THREADS
+    }
+    return params
+}
+
+//Hash the password using the configured algorithm and params.
+func HashPassword(password string) (string, error) {
+    if len(password) == 0 {
+        return "", fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    params := getHashParams()
+    switch(params.algorithm) {
+        case ARGON2ID_ALGORITHM:
+            return argon2Hash(password, &params)
+        case BCRYPT_ALGORITHM:
+            return bcryptHash(password, &params)
+    }
+    return "", fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Verify the password against the hash. 'valid' is true when the password
+// matches, 'rehash' is true when the hash is not made with the configured
+// algorithm and params, and must be replaced with a new hash of the password.
+//Hashes in unknown format never match.
+func VerifyPassword(hash string, password string) (valid bool, rehash bool) {
+    if len(hash) == 0 || len(password) == 0 {
+        return false, false
+    }
+    params := getHashParams()
+    if strings.HasPrefix(hash, "$" + ARGON2ID_ALGORITHM + "$") {
+        return argon2Verify(hash, password, &params)
+    }
+    if isBcryptHash(hash) {
+        return bcryptVerify(hash, password, &params)
+    }
+    return false, false
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package credentials
+
+import (
+    "strings"
+    "testing"
+    "DutyRoster/config"
+)
+
+//Cheap hash params to keep the tests fast.
+const (
+    testBcryptCost = 4
+    testArgon2Time = 1
+    testArgon2Memory = 1024
+)
+
+//Set the hash params in the configuration, 0 for the test default. The
+// tests restore the configured params on exit.
+func setHashConfig(algorithm string, bcryptCost int, argon2Time uint32) {
+    credConfig := &config.GetConfigInstance().Credentials
+    if bcryptCost == 0 {
+        bcryptCost = testBcryptCost
+    }
+    if argon2Time == 0 {
+        argon2Time = testArgon2Time
+    }
+    credConfig.Algorithm = algorithm
+    credConfig.BcryptCost = bcryptCost
+    credConfig.Argon2Time = argon2Time
+    credConfig.Argon2Memory = testArgon2Memory
+    credConfig.Argon2Threads = 1
+}
+
+func mustHash(t *testing.T, password string) string {
+    hash, err := HashPassword(password)
+    if err != nil {
+        t.Fatalf("Cannot hash password, %s", err)
+    }
+    return hash
+}
+
+func TestHashPassword(t *testing.T) {
+    tests := []struct {
+        name string
+        algorithm string
+        password string
+        prefix string
+        fail bool
+    }{
+        {"argon2id", ARGON2ID_ALGORITHM, "secret", "$argon2id$v=19$", false},
+        {"default", "", "secret", "$argon2id$v=19$", false},
+        {"bcrypt", BCRYPT_ALGORITHM, "secret", "$2a$04$", false},
+        {"empty password", ARGON2ID_ALGORITHM, "", "", true},
+        {"bcrypt too long", BCRYPT_ALGORITHM,
+         strings.Repeat("a", BCRYPT_MAX_PWD_LEN + 1), "", true},
+        {"unknown algorithm", "md5", "secret", "", true},
+    }
+    cfg := config.GetConfigInstance()
+    savedConfig := cfg.Credentials
+    defer func() { cfg.Credentials = savedConfig }()
+    for _, test := range(tests) {
+        setHashConfig(test.algorithm, 0, 0)
+        hash, err := HashPassword(test.password)
+        if test.fail {
+            if err == nil {
+                t.Errorf("%s: got hash %s, want error", test.name, hash)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        if !strings.HasPrefix(hash, test.prefix) {
+            t.Errorf("%s: got %s, want prefix %s", test.name, hash,
+                     test.prefix)
+        }
+        //Salted, the same password never gives the same hash.
+        if again := mustHash(t, test.password); again == hash {
+            t.Errorf("%s: same hash %s for the same password", test.name,
+                     hash)
+        }
+    }
+}
+
+func TestVerifyPassword(t *testing.T) {
+    cfg := config.GetConfigInstance()
+    savedConfig := cfg.Credentials
+    defer func() { cfg.Credentials = savedConfig }()
+    setHashConfig(ARGON2ID_ALGORITHM, 0, 0)
+    argon2Hash := mustHash(t, "secret")
+    setHashConfig(BCRYPT_ALGORITHM, 0, 0)
+    bcryptHash := mustHash(t, "secret")
+    tamperedHash := strings.Replace(argon2Hash, "$v=19$", "$v=16$", 1)
+
+    tests := []struct {
+        name string
+        hash string
+        password string
+        algorithm string
+        bcryptCost int
+        argon2Time uint32
+        valid bool
+        rehash bool
+    }{
+        {"argon2id", argon2Hash, "secret", ARGON2ID_ALGORITHM, 0, 0,
+         true, false},
+        {"argon2id wrong password", argon2Hash, "Secret", ARGON2ID_ALGORITHM,
+         0, 0, false, false},
+        {"argon2id params changed", argon2Hash, "secret", ARGON2ID_ALGORITHM,
+         0, 2, true, true},
+        {"argon2id algorithm changed", argon2Hash, "secret", BCRYPT_ALGORITHM,
+         0, 0, true, true},
+        {"bcrypt", bcryptHash, "secret", BCRYPT_ALGORITHM, 0, 0, true, false},
+        {"bcrypt wrong password", bcryptHash, "Secret", BCRYPT_ALGORITHM,
+         0, 0, false, false},
+        {"bcrypt cost changed", bcryptHash, "secret", BCRYPT_ALGORITHM,
+         5, 0, true, true},
+        {"bcrypt algorithm changed", bcryptHash, "secret",
+         ARGON2ID_ALGORITHM, 0, 0, true, true},
+        {"empty password", argon2Hash, "", ARGON2ID_ALGORITHM, 0, 0,
+         false, false},
+        {"empty hash", "", "secret", ARGON2ID_ALGORITHM, 0, 0, false, false},
+        {"plain text hash", "secret", "secret", ARGON2ID_ALGORITHM, 0, 0,
+         false, false},
+        {"unknown version", tamperedHash, "secret", ARGON2ID_ALGORITHM, 0, 0,
+         false, false},
+    }
+    for _, test := range(tests) {
+        setHashConfig(test.algorithm, test.bcryptCost, test.argon2Time)
+        valid, rehash := VerifyPassword(test.hash, test.password)
+        if valid != test.valid || rehash != test.rehash {
+            t.Errorf("%s: got %v/%v, want %v/%v", test.name, valid, rehash,
+                     test.valid, test.rehash)
+        }
+    }
+}
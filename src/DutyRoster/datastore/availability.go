@@ -0,0 +1,237 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "sort"
+    "time"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Kind of an availability record, each record has only one kind.
+type AvailabilityKindBit uint64
+
+const (
+    //User is available in a window that repeats every week.
+    AVAILABILITY_WEEKLY AvailabilityKindBit = 1 << iota
+    //User is not available in a period, eg: vacation, training.
+    AVAILABILITY_BLACKOUT AvailabilityKindBit = 1 << iota
+    //Last entry in the availability kind. User preference for a shift
+    // template.
+    AVAILABILITY_PREFERENCE AvailabilityKindBit = 1 << iota
+)
+
+//Maximum length of the note on an availability record.
+const AVAILABILITY_NOTE_STR_LEN = 500
+
+//Availability of a user. A user without any weekly windows is considered
+// available at all times except the blackout periods. When weekly windows
+// are present, the user is available only in those windows.
+//The blackout times are instants, the weekly windows are on the wall clock of
+// the org/unit the user is checked for.
+type Availability struct {
+    uuid syncParam.UUID
+    userid string
+    kind AvailabilityKindBit
+    //Weekly window, starts at the wall clock offset from start of the day on
+    // the weekdays and lasts for the duration of wall clock. One bit for each
+    // time.Weekday, 0 for all days. A window can extend into the next day.
+    weekdays uint64
+    startOffset time.Duration
+    duration time.Duration
+    //Blackout period [startTime, endTime).
+    startTime time.Time
+    endTime time.Time
+    //Preferred shift template, positive weight for the shifts user likes to
+    // work and negative weight for the shifts user likes to avoid.
+    templateUUID syncParam.UUID
+    weight int64
+    note string
+}
+
+//Weekly window of availability for user 'userid'.
+func NewWeeklyAvailability(userid string, weekdays uint64,
+                           startOffset time.Duration,
+                           duration time.Duration) *Availability {
+    avail := new(Availability)
+    avail.userid = userid
+    avail.kind = AVAILABILITY_WEEKLY
+    avail.weekdays = weekdays
+    avail.startOffset = startOffset
+    avail.duration = duration
+    return avail
+}
+
+//Period [startTime, endTime) when user 'userid' is not available.
+func NewBlackout(userid string, startTime time.Time, endTime time.Time,
+                 note string) *Availability {
+    avail := new(Availability)
+    avail.userid = userid
+    avail.kind = AVAILABILITY_BLACKOUT
+    avail.startTime = startTime
+    avail.endTime = endTime
+    avail.note = note
+    return avail
+}
+
+//Preference of user 'userid' for the shifts of a template.
+func NewShiftPreference(userid string, templateUUID syncParam.UUID,
+                        weight int64) *Availability {
+    avail := new(Availability)
+    avail.userid = userid
+    avail.kind = AVAILABILITY_PREFERENCE
+    avail.templateUUID = templateUUID
+    avail.weight = weight
+    return avail
+}
+
+//Availability that only carries the uuid, used to get/delete the record.
+func NewAvailabilityRef(uuid syncParam.UUID) *Availability {
+    avail := new(Availability)
+    avail.uuid = uuid
+    return avail
+}
+
+func (avail *Availability)UUID() syncParam.UUID {
+    return avail.uuid
+}
+
+func (avail *Availability)Userid() string {
+    return avail.userid
+}
+
+func (avail *Availability)Kind() AvailabilityKindBit {
+    return avail.kind
+}
+
+func (avail *Availability)Weekdays() uint64 {
+    return avail.weekdays
+}
+
+func (avail *Availability)StartOffset() time.Duration {
+    return avail.startOffset
+}
+
+func (avail *Availability)Duration() time.Duration {
+    return avail.duration
+}
+
+func (avail *Availability)StartTime() time.Time {
+    return avail.startTime
+}
+
+func (avail *Availability)EndTime() time.Time {
+    return avail.endTime
+}
+
+func (avail *Availability)TemplateUUID() syncParam.UUID {
+    return avail.templateUUID
+}
+
+func (avail *Availability)Weight() int64 {
+    return avail.weight
+}
+
+func (avail *Availability)Note() string {
+    return avail.note
+}
+
+//Return true if the weekly window starts on the weekday 'day'.
+func (avail *Availability)IsOnWeekday(day time.Weekday) bool {
+    if avail.weekdays == 0 {
+        return true
+    }
+    return avail.weekdays & (1 << uint64(day)) != 0
+}
+
+//Validate the availability fields before storing it, only the fields of
+// its kind are validated.
+func (avail *Availability)IsAvailabilityValid() bool {
+    if len(avail.userid) == 0 ||
+        len(avail.note) >= AVAILABILITY_NOTE_STR_LEN {
+        return false
+    }
+    switch(avail.kind) {
+        case AVAILABILITY_WEEKLY:
+            return avail.weekdays < (1 << 7) && avail.startOffset >= 0 &&
+                   avail.startOffset < 24 * time.Hour &&
+                   avail.duration > 0 && avail.duration <= 24 * time.Hour
+        case AVAILABILITY_BLACKOUT:
+            return avail.endTime.After(avail.startTime)
+        case AVAILABILITY_PREFERENCE:
+            return !syncParam.IsUUIDEmpty(avail.templateUUID)
+    }
+    return false
+}
+
+//Return true if the user with availability records 'records' is available
+// for the whole range [from, to). The range must not overlap any blackout,
+// and must be covered by the weekly windows when user has any. The weekly
+// windows are on the wall clock of 'loc', the zone of the org/unit.
+func IsUserAvailable(records []Availability, from time.Time,
+                     to time.Time, loc *time.Location) bool {
+    from = from.UTC()
+    to = to.UTC()
+    weekly := []*Availability{}
+    for i := range(records) {
+        switch(records[i].kind) {
+            case AVAILABILITY_BLACKOUT:
+                if records[i].startTime.Before(to) &&
+                    from.Before(records[i].endTime) {
+                    return false
+                }
+            case AVAILABILITY_WEEKLY:
+                weekly = append(weekly, &records[i])
+        }
+    }
+    if len(weekly) == 0 {
+        return true
+    }
+    //Windows of the day before 'from' can extend into the range.
+    type window struct {
+        start time.Time
+        end time.Time
+    }
+    windows := []window{}
+    dayBefore := timezone.DayStart(from, loc).AddDate(0, 0, -1)
+    for _, day := range(timezone.DaysIn(dayBefore, to, loc)) {
+        for _, avail := range(weekly) {
+            if !avail.IsOnWeekday(day.Weekday()) {
+                continue
+            }
+            start, end := timezone.ClockSpan(day, avail.startOffset,
+                                             avail.duration, loc)
+            windows = append(windows, window{start, end})
+        }
+    }
+    sort.Slice(windows, func(i, j int) bool {
+        return windows[i].start.Before(windows[j].start)
+    })
+    covered := from
+    for _, win := range(windows) {
+        if !win.end.After(covered) {
+            continue
+        }
+        if win.start.After(covered) {
+            return false
+        }
+        covered = win.end
+        if !covered.Before(to) {
+            return true
+        }
+    }
+    return false
+}
@@ -15,22 +15,37 @@
 package datastore
 
 import (
-
+    "time"
+    "DutyRoster/syncParam"
 )
 
 //Datastore Interface that provides the APIs exposed by datastore implementation.
 type dataStoreInterface interface {
     CreateDBConnection() error
-    // Create all the relevant tables/sessions that are needed for datastore
-    //implementation.
-    CreateDataStoreTables() error
+    // Prepare the datastore for the record operations. Fails when the DB
+    //schema is not at the latest migration, the application must not run on
+    //an outdated schema.
+    InitDataStore() error
+
+    //***** Schema migration operations *****
+    //Apply all the pending schema migrations, each in its own transaction.
+    MigrateUp() error
+    //Revert the latest applied schema migration.
+    MigrateDown() error
+    //List all the schema migrations known to application and the applied
+    // migrations that are unknown, ordered on version.
+    ListMigrations() ([]MigrationStatus, error)
 
     //***** User operations *****
     //Create the user account row in the DB.
     CreateUserAccount(*Users) error
-    //Get a user account, the userID and pwd must be present in users
-    // All other fields are populated by the function by reading from DB.
-    GetUserAccount(*Users) error
+    //Get a user account on 'userid' after verifying the password against the
+    // stored hash. All other fields are populated by the function by reading
+    // from DB. Returns INVALID_CREDENTIALS for unknown user or wrong password.
+    //The stored hash is upgraded when the hash params are changed.
+    GetUserAccount(user *Users, password string) error
+    //Get a user account using only the 'userid'.
+    GetUser(*Users) error
     //Delete User account with 'userid' row in the DB,
     DeleteUserAccount(*Users) error
     //Update User account on 'Userid'.
@@ -38,4 +53,325 @@ type dataStoreInterface interface {
     //modify. All these fields must populate in the 'users' even if
     // update is not required.Otherwise the null values get written to DB.
     UpdateUserAccount(*Users) error
+
+    //***** Org operations *****
+    //All org operations run in a single transaction, a failure never leaves
+    // the hierarchy partially modified.
+    //Create an org/unit in the DB, uuid and startTime are populated on success.
+    //The parent, when present, must already be in the DB.
+    CreateOrg(*Org) error
+    //Create an org/unit and grant ROOTADMIN role on it to user 'userid', the
+    // org is never created without its admin.
+    CreateOrgWithAdmin(org *Org, userid string) error
+    //Get an org/unit using its uuid, or using name, address and parent when
+    // uuid is empty. All other fields are populated from the DB.
+    GetOrg(*Org) error
+    //Update status and validity of an org/unit and all its descendants.
+    UpdateOrg(*Org) error
+    //Delete an org/unit and all its descendants.
+    DeleteOrg(*Org) error
+    //List the immediate children of an org/unit.
+    ListChildOrgs(*Org) ([]Org, error)
+    //Get an org/unit with all its descendants.
+    GetOrgTree(*Org) (*OrgTree, error)
+
+    //***** Membership operations *****
+    //Grant the role bits to user in an org/unit. Both user and org must be
+    // present in the DB.
+    GrantUserOrgRole(*UserOrgRole) error
+    //Revoke the role bits of user in an org/unit.
+    RevokeUserOrgRole(*UserOrgRole) error
+    //List the memberships of a user, one entry for each org/unit.
+    ListUserMemberships(userid string) ([]UserOrgRole, error)
+    //List the memberships in an org/unit, one entry for each user.
+    ListOrgMemberships(orgUUID syncParam.UUID) ([]UserOrgRole, error)
+    //Get the roles of user in an org/unit including the roles inherited from
+    // the ancestors of the org/unit.
+    GetEffectiveRoles(userid string, orgUUID syncParam.UUID) (RoleBit, error)
+
+    //***** Membership invite operations *****
+    //Joining an org/unit needs the consent of the user, an invite holds the
+    // role bits offered to the user until it is accepted or deleted.
+    //Create the invite of a user to an org/unit, an earlier invite of the user
+    // to the org/unit is replaced. Both user and org must be present in the
+    // DB and the role bits must be grantable in the org/unit.
+    CreateMembershipInvite(*UserOrgRole) error
+    //List the pending invites of a user, one entry for each org/unit.
+    ListUserMembershipInvites(userid string) ([]UserOrgRole, error)
+    //Grant the role bits of the invite to the user and delete the invite,
+    // either both are done or none. The role bits of the invite are populated
+    // on success.
+    AcceptMembershipInvite(*UserOrgRole) error
+    //Delete the invite of a user to an org/unit.
+    DeleteMembershipInvite(*UserOrgRole) error
+
+    //***** Role operations *****
+    //Create a custom role, the role bit is allocated and populated on success.
+    //The org/unit of a scoped role must be present in the DB.
+    CreateRole(*Role) error
+    //Get a role definition, the role bit must be present in the role.
+    GetRole(*Role) error
+    //List all the role definitions including the system roles.
+    ListRoles() ([]Role, error)
+    //Update name and permissions of a custom role.
+    UpdateRole(*Role) error
+    //Delete a custom role, the role is revoked from all the users.
+    DeleteRole(*Role) error
+
+    //***** Shift and roster operations *****
+    //Create a shift template in the DB, uuid is populated on success.
+    CreateShiftTemplate(*ShiftTemplate) error
+    //Get a shift template, the uuid must be present in the template.
+    GetShiftTemplate(*ShiftTemplate) error
+    //List all the shift templates of an org/unit.
+    ListShiftTemplates(orgUUID syncParam.UUID) ([]ShiftTemplate, error)
+    //Delete the shift template with 'uuid'.
+    DeleteShiftTemplate(*ShiftTemplate) error
+    //Create a shift in the DB, uuid is populated on success.
+    CreateShift(*Shift) error
+    //Get a shift, the uuid must be present in the shift.
+    GetShift(*Shift) error
+    //List all the shifts of an org/unit that overlaps the range [from, to).
+    ListShifts(orgUUID syncParam.UUID, from time.Time,
+               to time.Time) ([]Shift, error)
+    //List all the shifts a user is assigned to that overlaps the range
+    // [from, to), cancelled shifts included.
+    ListUserShifts(userid string, from time.Time,
+                   to time.Time) ([]Shift, error)
+    //Cancel the shift with 'uuid'. Cancelled shifts are kept in DB.
+    CancelShift(*Shift) error
+    //Assign a user to a shift, uuid is populated on success.
+    CreateRosterAssignment(*RosterAssignment) error
+    //Create the shifts of a roster and assign users[i] to shifts[i], either
+    // all the records are written or none. A user on approved leave in the
+    // shift or without the skills of the shift fails the roster. Shift uuids
+    // are populated on success.
+    CreateRoster(shifts []*Shift, users [][]string) error
+    //List all the users assigned to a shift.
+    ListShiftRoster(shiftUUID syncParam.UUID) ([]RosterAssignment, error)
+    //List all the assignments of a user that overlaps the range [from, to).
+    ListUserRoster(userid string, from time.Time,
+                   to time.Time) ([]RosterAssignment, error)
+    //Get a roster assignment, the uuid must be present in the assignment.
+    GetRosterAssignment(*RosterAssignment) error
+    //Delete the roster assignment with 'uuid'.
+    DeleteRosterAssignment(*RosterAssignment) error
+
+    //***** Shift pattern operations *****
+    //Create a recurring shift pattern in the DB, uuid and createTime are
+    // populated on success. The rule is stored in its canonical form.
+    CreateShiftPattern(*ShiftPattern) error
+    //Get a shift pattern, the uuid must be present in the pattern.
+    GetShiftPattern(*ShiftPattern) error
+    //List all the shift patterns of an org/unit.
+    ListShiftPatterns(orgUUID syncParam.UUID) ([]ShiftPattern, error)
+    //Delete the shift pattern with 'uuid', the shifts expanded from it are
+    // kept.
+    DeleteShiftPattern(*ShiftPattern) error
+    //Create the shifts for the occurrences of the pattern that start in the
+    // range [from, to) and are not expanded yet, the shifts are owned by user
+    // 'owner'. Returns the shifts created.
+    ExpandShiftPattern(pat *ShiftPattern, from time.Time, to time.Time,
+                       owner string) ([]Shift, error)
+    //List the expanded occurrences of the pattern with recurrence id in the
+    // range [from, to).
+    ListPatternOccurrences(patternUUID syncParam.UUID, from time.Time,
+                           to time.Time) ([]PatternOccurrence, error)
+    //Apply the edit to the occurrences of the pattern in the scope of edit,
+    // the result pattern and number of shifts changed are populated on
+    // success.
+    EditShiftPattern(*PatternEdit) error
+
+    //***** Availability operations *****
+    //Create an availability record of a user, uuid is populated on success.
+    CreateAvailability(*Availability) error
+    //Get an availability record, the uuid must be present in the record.
+    GetAvailability(*Availability) error
+    //List all the availability records of user 'userid'.
+    ListUserAvailability(userid string) ([]Availability, error)
+    //Delete the availability record with 'uuid'.
+    DeleteAvailability(*Availability) error
+    //List the active users who are members of the org/unit or its ancestors,
+    // available for the whole range [from, to) and not on approved leave.
+    ListAvailableUsers(orgUUID syncParam.UUID, from time.Time,
+                       to time.Time) ([]string, error)
+
+    //***** Skill operations *****
+    //Create or replace the skill 'name' of the user, modifyTime is populated
+    // on success. The user must be present in the DB.
+    SetUserSkill(*UserSkill) error
+    //Get a skill of a user, the userid and name must be present in the skill.
+    GetUserSkill(*UserSkill) error
+    //List all the skills of user 'userid', ordered on name.
+    ListUserSkills(userid string) ([]UserSkill, error)
+    //Delete the skill with 'name' of the user.
+    DeleteUserSkill(*UserSkill) error
+    //List the active users who are members of the org/unit or its ancestors
+    // and hold all the 'skills' for the whole range [from, to).
+    ListQualifiedUsers(orgUUID syncParam.UUID, skills []string,
+                       from time.Time, to time.Time) ([]string, error)
+    //List the skills that expire in the range [from, to) of the users who are
+    // members of the org/unit or its descendants, ordered on expiry.
+    ListExpiringSkills(orgUUID syncParam.UUID, from time.Time,
+                       to time.Time) ([]UserSkill, error)
+    //Return SKILL_REQUIREMENT_NOT_MET error when the user does not hold all
+    // the skills required by the template of the shift for the whole shift.
+    CheckSkillRequirement(userid string, shift *Shift) error
+
+    //***** Leave operations *****
+    //Create a leave policy in an org/unit, uuid is populated on success.
+    CreateLeavePolicy(*LeavePolicy) error
+    //Get a leave policy, the uuid must be present in the policy.
+    GetLeavePolicy(*LeavePolicy) error
+    //List the leave policies that apply in the org/unit, ie: the policies of
+    // the org/unit and its ancestors.
+    ListLeavePolicies(orgUUID syncParam.UUID) ([]LeavePolicy, error)
+    //Delete the leave policy with 'uuid', balances and requests of the policy
+    // are deleted with it.
+    DeleteLeavePolicy(*LeavePolicy) error
+    //Get the leave balance accrued until now, the userid and policy uuid must
+    // be present in the balance.
+    GetLeaveBalance(*LeaveBalance) error
+    //Add 'delta' to the leave balance of a tracked policy.
+    AdjustLeaveBalance(bal *LeaveBalance, delta time.Duration) error
+    //Create a leave request in requested status, uuid and createTime are
+    // populated on success.
+    CreateLeaveRequest(*LeaveRequest) error
+    //Get a leave request, the uuid must be present in the request.
+    GetLeaveRequest(*LeaveRequest) error
+    //List all the leave requests of a user that overlaps the range [from, to).
+    ListUserLeave(userid string, from time.Time,
+                  to time.Time) ([]LeaveRequest, error)
+    //List all the leave requests of an org/unit in 'status'.
+    ListOrgLeave(orgUUID syncParam.UUID,
+                 status LeaveStatusBit) ([]LeaveRequest, error)
+    //Move the leave request to 'status' decided by user 'decidedBy'.
+    //Approval charges the balance of a tracked policy and cancelling an
+    // approved leave refunds it.
+    UpdateLeaveStatus(leave *LeaveRequest, status LeaveStatusBit,
+                      decidedBy string) error
+    //List the approved leaves of a user that overlaps the range [from, to).
+    ListUserBusy(userid string, from time.Time,
+                 to time.Time) ([]LeaveRequest, error)
+    //Return LEAVE_CONFLICT error when the user is on approved leave in the
+    // range [from, to).
+    CheckLeaveConflict(userid string, from time.Time, to time.Time) error
+
+    //***** Swap operations *****
+    //Create or replace the swap rules of an org/unit.
+    SetSwapSettings(*SwapSettings) error
+    //Get the swap rules in effect for the org/unit, ie: the rules of nearest
+    // org/unit in the parent chain. The org uuid must be present.
+    GetSwapSettings(*SwapSettings) error
+    //Create a swap offer of an assignment in open status, uuid, org/unit,
+    // approver role and createTime are populated on success.
+    CreateSwapOffer(*SwapOffer) error
+    //Get a swap offer, the uuid must be present in the offer.
+    GetSwapOffer(*SwapOffer) error
+    //List all the swap offers of an org/unit in 'status'.
+    ListOrgSwapOffers(orgUUID syncParam.UUID,
+                      status SwapStatusBit) ([]SwapOffer, error)
+    //Move the swap offer to 'status' by user 'userid' and record it in the
+    // audit with 'note'. Taking an open offer and the approval re-checks the
+    // trade, and completing it moves the assignments to the new owners.
+    UpdateSwapStatus(offer *SwapOffer, status SwapStatusBit, userid string,
+                     note string) error
+    //List the audit records of the swap offer 'offerUUID'.
+    ListSwapAudit(offerUUID syncParam.UUID) ([]SwapAudit, error)
+    //List the swap audit records of an org/unit in the range [from, to).
+    ListOrgSwapAudit(orgUUID syncParam.UUID, from time.Time,
+                     to time.Time) ([]SwapAudit, error)
+
+    //***** On-call operations *****
+    //Create an on-call rotation with its members in an org/unit, uuid and
+    // createTime are populated on success.
+    CreateOnCallRotation(*OnCallRotation) error
+    //Get an on-call rotation, the uuid must be present in the rotation.
+    GetOnCallRotation(*OnCallRotation) error
+    //List all the on-call rotations of an org/unit.
+    ListOnCallRotations(orgUUID syncParam.UUID) ([]OnCallRotation, error)
+    //Delete the on-call rotation with 'uuid'.
+    DeleteOnCallRotation(*OnCallRotation) error
+    //Create an on-call override in an org/unit, uuid and createTime are
+    // populated on success.
+    CreateOnCallOverride(*OnCallOverride) error
+    //Get an on-call override, the uuid must be present in the override.
+    GetOnCallOverride(*OnCallOverride) error
+    //List the on-call overrides of an org/unit that overlaps [from, to).
+    ListOnCallOverrides(orgUUID syncParam.UUID, from time.Time,
+                        to time.Time) ([]OnCallOverride, error)
+    //Delete the on-call override with 'uuid'.
+    DeleteOnCallOverride(*OnCallOverride) error
+    //Create or replace the escalation policy of an org/unit.
+    SetEscalationPolicy(*EscalationPolicy) error
+    //Get the escalation policy of an org/unit, the org uuid must be present.
+    GetEscalationPolicy(*EscalationPolicy) error
+    //Delete the escalation policy of an org/unit.
+    DeleteEscalationPolicy(*EscalationPolicy) error
+    //Resolve the users on call for the org/unit at the instant 'at', falling
+    // back to the ancestors for the levels the org/unit does not cover.
+    WhoIsOnCall(orgUUID syncParam.UUID, at time.Time) (*OnCall, error)
+
+    //***** Holiday operations *****
+    //Create a holiday calendar in an org/unit, uuid and createTime are
+    // populated on success.
+    CreateHolidayCalendar(*HolidayCalendar) error
+    //Get a holiday calendar, the uuid must be present in the calendar.
+    GetHolidayCalendar(*HolidayCalendar) error
+    //List the holiday calendars of the org/unit, the inherited calendars are
+    // not in the list.
+    ListHolidayCalendars(orgUUID syncParam.UUID) ([]HolidayCalendar, error)
+    //Delete the holiday calendar with 'uuid' along with its holidays.
+    DeleteHolidayCalendar(*HolidayCalendar) error
+    //Add a holiday to a calendar by hand, uuid is populated on success.
+    CreateHoliday(*Holiday) error
+    //Get a holiday, the uuid must be present in the holiday.
+    GetHoliday(*Holiday) error
+    //Delete the holiday with 'uuid'.
+    DeleteHoliday(*Holiday) error
+    //List the holidays of a calendar with the dates in the range [from, to).
+    ListHolidays(calendarUUID syncParam.UUID, from time.Time,
+                 to time.Time) ([]Holiday, error)
+    //Replace the holidays imported earlier into the calendar with 'hols',
+    // the holidays added by hand are kept. uuids of 'hols' are populated on
+    // success.
+    ImportHolidays(calendarUUID syncParam.UUID, hols []Holiday) error
+    //List the holidays in effect for the org/unit with the dates in the range
+    // [from, to), ie: the holidays of the calendars of the nearest org/unit in
+    // the parent chain that has calendars.
+    ListOrgHolidays(orgUUID syncParam.UUID, from time.Time,
+                    to time.Time) ([]Holiday, error)
+    //Get the holiday in effect for the org/unit on the local day of 'at' in
+    // the time zone of the org/unit, nil when the day is not a holiday. The
+    // holiday with highest pay multiplier is returned when more than one
+    // holiday falls on the day.
+    IsHoliday(orgUUID syncParam.UUID, at time.Time) (*Holiday, error)
+
+    //***** Calendar feed operations *****
+    //Create a calendar feed in the DB, uuid and createTime are populated on
+    // success.
+    CreateCalendarFeed(*CalendarFeed) error
+    //Get a calendar feed, the uuid must be present in the feed.
+    GetCalendarFeed(*CalendarFeed) error
+    //List all the calendar feeds owned by user 'userid'.
+    ListUserCalendarFeeds(userid string) ([]CalendarFeed, error)
+    //Delete the calendar feed with 'uuid'.
+    DeleteCalendarFeed(*CalendarFeed) error
+
+    //***** Session operations *****
+    //Create a login session in the DB, uuid and createTime are populated on
+    // success. The user must already be in the DB.
+    CreateSession(*Session) error
+    //Get a session, the uuid must be present in the session.
+    GetSession(*Session) error
+    //Replace the refresh hash and expiry of an active session on refresh.
+    //Returns DB_RECORD_NOT_FOUND when the session is revoked or the current
+    // refresh hash is not 'oldHash', ie: the refresh token is already used.
+    RotateSession(sess *Session, oldHash string) error
+    //Revoke the session with 'uuid', revoked session is kept until expiry.
+    RevokeSession(*Session) error
+    //Revoke all the sessions of user 'userid'.
+    RevokeUserSessions(userid string) error
+    //Delete all the sessions expired before 'before'.
+    DeleteExpiredSessions(before time.Time) error
 }
\ No newline at end of file
@@ -15,13 +15,26 @@
 package datastore
 
 import (
+    "DutyRoster/config"
+)
 
+//DB drivers supported by the application, set in 'db.driver' of config.
+const (
+    POSTGRES_DB_DRIVER = "postgres"
+    SQLITE_DB_DRIVER = "sqlite"
+    MEMORY_DB_DRIVER = "memory"
 )
 
 // Datastore might have different implementation that implement dataStoreInterface
-// It is possible to change from one datastore to another easily by changing the
-// following function to return right datastore object.
+// The implementation is selected using the DB driver in the configuration.
+// Postgres is used when no driver is configured, CreateDBConnection reports
+// the error for an invalid driver.
 func GetDataStoreObj() dataStoreInterface {
-    // We use sqllite as DB driver
+    switch(config.GetConfigInstance().DB.Driver) {
+        case SQLITE_DB_DRIVER:
+            return getSQLiteDataStoreObj()
+        case MEMORY_DB_DRIVER:
+            return getInMemoryDataStoreObj()
+    }
     return getPSQLDataStoreObj()
 }
\ No newline at end of file
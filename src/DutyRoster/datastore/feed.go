@@ -0,0 +1,113 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "time"
+    "DutyRoster/syncParam"
+)
+
+//Roster published in a calendar feed.
+type FeedKindBit uint64
+
+const (
+    //Shifts of the feed owner.
+    FEED_USER FeedKindBit = 1 << iota
+    //Last entry in the feed kind. Do not add anything below org feed.
+    //Shifts of an org/unit along with their roster.
+    FEED_ORG FeedKindBit = 1 << iota
+)
+
+//Calendar feed of a user, served without login on an unguessable token. The
+// feed is read with the access of its owner, it stops working once the owner
+// loses the access to the org/unit.
+type CalendarFeed struct {
+    uuid syncParam.UUID
+    kind FeedKindBit
+    //userid of the user who owns the feed.
+    userid string
+    //org/unit of an org feed, empty UUID for a user feed.
+    orgUUID syncParam.UUID
+    //Hash of the token secret, the secret itself is never stored.
+    tokenHash string
+    createTime time.Time
+}
+
+//Feed of the shifts of user 'userid'. uuid and createTime are populated when
+// the feed is created in the datastore.
+func NewUserFeed(userid string, tokenHash string) *CalendarFeed {
+    feed := new(CalendarFeed)
+    feed.kind = FEED_USER
+    feed.userid = userid
+    feed.tokenHash = tokenHash
+    return feed
+}
+
+//Feed of the shifts of org/unit 'orgUUID' owned by user 'userid'.
+func NewOrgFeed(orgUUID syncParam.UUID, userid string,
+                tokenHash string) *CalendarFeed {
+    feed := new(CalendarFeed)
+    feed.kind = FEED_ORG
+    feed.userid = userid
+    feed.orgUUID = orgUUID
+    feed.tokenHash = tokenHash
+    return feed
+}
+
+//Calendar feed that only carries the uuid, used to get/delete the feed.
+func NewCalendarFeedRef(uuid syncParam.UUID) *CalendarFeed {
+    feed := new(CalendarFeed)
+    feed.uuid = uuid
+    return feed
+}
+
+func (feed *CalendarFeed)UUID() syncParam.UUID {
+    return feed.uuid
+}
+
+func (feed *CalendarFeed)Kind() FeedKindBit {
+    return feed.kind
+}
+
+func (feed *CalendarFeed)Userid() string {
+    return feed.userid
+}
+
+func (feed *CalendarFeed)OrgUUID() syncParam.UUID {
+    return feed.orgUUID
+}
+
+func (feed *CalendarFeed)TokenHash() string {
+    return feed.tokenHash
+}
+
+func (feed *CalendarFeed)CreateTime() time.Time {
+    return feed.createTime
+}
+
+//Validate the feed fields before storing it, only an org feed has the
+// org/unit.
+func (feed *CalendarFeed)IsCalendarFeedValid() bool {
+    if len(feed.userid) == 0 || len(feed.tokenHash) != FEED_HASH_LEN {
+        return false
+    }
+    switch(feed.kind) {
+        case FEED_USER:
+            return syncParam.IsUUIDEmpty(feed.orgUUID)
+        case FEED_ORG:
+            return !syncParam.IsUUIDEmpty(feed.orgUUID)
+    }
+    return false
+}
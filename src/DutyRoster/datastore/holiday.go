@@ -0,0 +1,305 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "strings"
+    "DutyRoster/ical"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+    "DutyRoster/recurrence"
+)
+
+//Maximum length of the name of a holiday calendar and a holiday.
+const HOLIDAY_NAME_STR_LEN = 500
+
+//Holidays are calendar dates, the dates are in the form YYYY-MM-DD.
+const HOLIDAY_DATE_FORMAT = "2006-01-02"
+
+//Pay and staffing of a holiday, a holiday with the defaults is paid and
+// staffed as a normal day.
+const (
+    DEFAULT_PAY_MULTIPLIER = 1.0
+    MAX_PAY_MULTIPLIER = 10.0
+    DEFAULT_STAFF_PERCENT = 100
+    MAX_STAFF_PERCENT = 500
+)
+
+//Dates of the recurring holidays imported from an iCalendar file, relative to
+// the year of import. Maximum number of holidays in an import.
+const (
+    HOLIDAY_IMPORT_PAST_YEARS = 1
+    HOLIDAY_IMPORT_FUTURE_YEARS = 5
+    MAX_IMPORT_HOLIDAYS = 5000
+)
+
+//Holiday calendar of an org/unit. The holidays in effect for an org/unit are
+// the holidays of the calendars of the nearest org/unit in the parent chain
+// that has calendars, ie: a child org/unit overrides the inherited calendars
+// by having its own.
+type HolidayCalendar struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    name string
+    //Pay multiplier and staffing of the holidays imported into the calendar.
+    payMultiplier float64
+    staffPercent uint64
+    createTime time.Time
+}
+
+//A holiday in a holiday calendar. The holiday is the whole local day of its
+// date in the time zone of the org/unit.
+type Holiday struct {
+    uuid syncParam.UUID
+    calendarUUID syncParam.UUID
+    //Date of the holiday at midnight UTC.
+    date time.Time
+    name string
+    //Multiplier of the pay for the hours worked on the holiday.
+    payMultiplier float64
+    //Staff needed on the holiday as percent of the minimum staff of the
+    // shifts, 0 when the site is closed.
+    staffPercent uint64
+    //Holiday is imported from an iCalendar file, the imported holidays of a
+    // calendar are replaced on the next import.
+    imported bool
+}
+
+//Date of 't' in its own location, at midnight UTC.
+func holidayDate(t time.Time) time.Time {
+    return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+//Range of dates for the recurring holidays of an import at 'now'.
+func HolidayImportRange(now time.Time) (time.Time, time.Time) {
+    from := time.Date(now.Year() - HOLIDAY_IMPORT_PAST_YEARS, time.January,
+                      1, 0, 0, 0, 0, time.UTC)
+    to := time.Date(now.Year() + HOLIDAY_IMPORT_FUTURE_YEARS + 1,
+                    time.January, 1, 0, 0, 0, 0, time.UTC)
+    return from, to
+}
+
+func isPayMultiplierValid(payMultiplier float64) bool {
+    return payMultiplier > 0 && payMultiplier <= MAX_PAY_MULTIPLIER
+}
+
+//Holiday calendar 'name' of org/unit 'orgUUID', zero pay multiplier is the
+// default multiplier.
+func NewHolidayCalendar(orgUUID syncParam.UUID, name string,
+                        payMultiplier float64,
+                        staffPercent uint64) *HolidayCalendar {
+    cal := new(HolidayCalendar)
+    cal.orgUUID = orgUUID
+    cal.name = name
+    cal.payMultiplier = payMultiplier
+    if cal.payMultiplier == 0 {
+        cal.payMultiplier = DEFAULT_PAY_MULTIPLIER
+    }
+    cal.staffPercent = staffPercent
+    return cal
+}
+
+//Holiday calendar that only carries the uuid, used to get/delete the calendar.
+func NewHolidayCalendarRef(uuid syncParam.UUID) *HolidayCalendar {
+    cal := new(HolidayCalendar)
+    cal.uuid = uuid
+    return cal
+}
+
+func (cal *HolidayCalendar)UUID() syncParam.UUID {
+    return cal.uuid
+}
+
+func (cal *HolidayCalendar)OrgUUID() syncParam.UUID {
+    return cal.orgUUID
+}
+
+func (cal *HolidayCalendar)Name() string {
+    return cal.name
+}
+
+func (cal *HolidayCalendar)PayMultiplier() float64 {
+    return cal.payMultiplier
+}
+
+func (cal *HolidayCalendar)StaffPercent() uint64 {
+    return cal.staffPercent
+}
+
+func (cal *HolidayCalendar)CreateTime() time.Time {
+    return cal.createTime
+}
+
+//Validate the holiday calendar fields before storing it.
+func (cal *HolidayCalendar)IsHolidayCalendarValid() bool {
+    if syncParam.IsUUIDEmpty(cal.orgUUID) || len(cal.name) == 0 ||
+        len(cal.name) >= HOLIDAY_NAME_STR_LEN ||
+        !isPayMultiplierValid(cal.payMultiplier) ||
+        cal.staffPercent > MAX_STAFF_PERCENT {
+        return false
+    }
+    return true
+}
+
+//Holiday 'name' on the date of 'date' in calendar 'calendarUUID', the time of
+// 'date' is ignored. Zero pay multiplier is the default multiplier.
+func NewHoliday(calendarUUID syncParam.UUID, date time.Time, name string,
+                payMultiplier float64, staffPercent uint64) *Holiday {
+    hol := new(Holiday)
+    hol.calendarUUID = calendarUUID
+    hol.date = holidayDate(date)
+    hol.name = name
+    hol.payMultiplier = payMultiplier
+    if hol.payMultiplier == 0 {
+        hol.payMultiplier = DEFAULT_PAY_MULTIPLIER
+    }
+    hol.staffPercent = staffPercent
+    return hol
+}
+
+//Holiday that only carries the uuid, used to get/delete the holiday.
+func NewHolidayRef(uuid syncParam.UUID) *Holiday {
+    hol := new(Holiday)
+    hol.uuid = uuid
+    return hol
+}
+
+func (hol *Holiday)UUID() syncParam.UUID {
+    return hol.uuid
+}
+
+func (hol *Holiday)CalendarUUID() syncParam.UUID {
+    return hol.calendarUUID
+}
+
+func (hol *Holiday)Date() time.Time {
+    return hol.date
+}
+
+func (hol *Holiday)Name() string {
+    return hol.name
+}
+
+func (hol *Holiday)PayMultiplier() float64 {
+    return hol.payMultiplier
+}
+
+func (hol *Holiday)StaffPercent() uint64 {
+    return hol.staffPercent
+}
+
+func (hol *Holiday)IsImported() bool {
+    return hol.imported
+}
+
+//Validate the holiday fields before storing it.
+func (hol *Holiday)IsHolidayValid() bool {
+    if syncParam.IsUUIDEmpty(hol.calendarUUID) || hol.date.IsZero() ||
+        len(hol.name) == 0 || len(hol.name) >= HOLIDAY_NAME_STR_LEN ||
+        !isPayMultiplierValid(hol.payMultiplier) ||
+        hol.staffPercent > MAX_STAFF_PERCENT {
+        return false
+    }
+    return true
+}
+
+//Sort the holidays on date and name.
+func sortHolidays(hols []Holiday) {
+    sort.Slice(hols, func(i, j int) bool {
+        if !hols[i].date.Equal(hols[j].date) {
+            return hols[i].date.Before(hols[j].date)
+        }
+        return hols[i].name < hols[j].name
+    })
+}
+
+//Holiday in effect on a day from the holidays on the day, the holiday with
+// highest pay multiplier wins. nil when there is no holiday.
+func holidayOfDay(hols []Holiday) *Holiday {
+    var best *Holiday
+    for i := range(hols) {
+        if best == nil || hols[i].payMultiplier > best.payMultiplier {
+            best = &hols[i]
+        }
+    }
+    return best
+}
+
+//Holidays of the events read from an iCalendar file with the dates in the
+// range [from, to). An event is a holiday on every date it covers, a timed
+// event only on the date of its start. A repeating event is expanded in the
+// range, cancelled events are skipped. The holidays get the pay multiplier
+// and staffing of the calendar.
+func HolidaysFromEvents(cal *HolidayCalendar, events []*ical.Event,
+                        from time.Time, to time.Time) ([]Holiday, error) {
+    from, to = holidayDate(from), holidayDate(to)
+    hols := []Holiday{}
+    seen := make(map[string]bool)
+    addFunc := func(date time.Time, name string) error {
+        key := date.Format(HOLIDAY_DATE_FORMAT) + name
+        if date.Before(from) || !date.Before(to) || seen[key] {
+            return nil
+        }
+        seen[key] = true
+        if len(hols) >= MAX_IMPORT_HOLIDAYS {
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.CALENDAR_FILE_INVALID])
+        }
+        hol := NewHoliday(cal.uuid, date, name, cal.payMultiplier,
+                          cal.staffPercent)
+        hol.imported = true
+        hols = append(hols, *hol)
+        return nil
+    }
+    for _, ev := range(events) {
+        if ev.IsCancelled() || len(ev.Summary()) == 0 {
+            continue
+        }
+        name := ev.Summary()
+        if len(name) >= HOLIDAY_NAME_STR_LEN {
+            name = strings.ToValidUTF8(name[:HOLIDAY_NAME_STR_LEN - 1], "")
+        }
+        start := holidayDate(ev.StartTime())
+        days := 1
+        if ev.IsAllDay() {
+            days = int(holidayDate(ev.EndTime()).Sub(start).Hours() / 24)
+            if days < 1 {
+                days = 1
+            }
+        }
+        starts := []time.Time{start}
+        if len(ev.Rule()) != 0 {
+            rule, err := recurrence.ParseRule(ev.Rule())
+            if err != nil {
+                return nil, err
+            }
+            starts = rule.Between(start, from.AddDate(0, 0, -days), to,
+                                  MAX_IMPORT_HOLIDAYS)
+        }
+        for _, day := range(starts) {
+            for offset := 0; offset < days; offset++ {
+                err := addFunc(day.AddDate(0, 0, offset), name)
+                if err != nil {
+                    return nil, err
+                }
+            }
+        }
+    }
+    sortHolidays(hols)
+    return hols, nil
+}
@@ -0,0 +1,702 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+//******************************************************************************
+// In-memory implementation of dataStoreInterface. All the records are lost
+// when application exits. Used for demos, unit tests and to validate roster
+// changes without a DB server. The validation and error codes must be in line
+// with the postgreSQL implementation, update both at same time.
+//******************************************************************************
+import (
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+    "DutyRoster/config"
+    "DutyRoster/errorset"
+    "DutyRoster/credentials"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Org record in memory, the parent is tracked by uuid and the parent chain is
+// built on every read.
+type memOrg struct {
+    org Org
+    parentUUID syncParam.UUID
+}
+
+//Key of a membership record, each record holds a single role bit.
+type memMembershipKey struct {
+    userid string
+    role RoleBit
+    orgUUID syncParam.UUID
+}
+
+//Key of a membership invite record, a user has one invite in an org.
+type memInviteKey struct {
+    userid string
+    orgUUID syncParam.UUID
+}
+
+type inMemoryDataStore struct {
+    dblogger logging.LoggingInterface
+    //Lock to protect all the tables below.
+    lock sync.RWMutex
+    roles map[RoleBit]*Role
+    users map[string]*Users
+    orgs map[syncParam.UUID]*memOrg
+    memberships map[memMembershipKey]time.Time
+    //Role bits offered in the pending membership invites.
+    invites map[memInviteKey]RoleBit
+    templates map[syncParam.UUID]*ShiftTemplate
+    shifts map[syncParam.UUID]*Shift
+    assignments map[syncParam.UUID]*RosterAssignment
+    sessions map[syncParam.UUID]*Session
+    availability map[syncParam.UUID]*Availability
+    leavePolicies map[syncParam.UUID]*LeavePolicy
+    leaveBalances map[memLeaveBalanceKey]*LeaveBalance
+    leaves map[syncParam.UUID]*LeaveRequest
+    swapSettings map[syncParam.UUID]*SwapSettings
+    swapOffers map[syncParam.UUID]*SwapOffer
+    swapAudit map[syncParam.UUID]*SwapAudit
+    onCallRotations map[syncParam.UUID]*OnCallRotation
+    onCallOverrides map[syncParam.UUID]*OnCallOverride
+    escalations map[syncParam.UUID]*EscalationPolicy
+    feeds map[syncParam.UUID]*CalendarFeed
+    patterns map[syncParam.UUID]*ShiftPattern
+    //Pattern occurrences keyed by the uuid of the shift.
+    patternOccurrences map[syncParam.UUID]*PatternOccurrence
+    holidayCalendars map[syncParam.UUID]*HolidayCalendar
+    holidays map[syncParam.UUID]*Holiday
+    userSkills map[memUserSkillKey]*UserSkill
+}
+
+var memOnce sync.Once
+var memObj = new(inMemoryDataStore)
+
+//No connection is needed for in-memory datastore, only the driver is
+// validated.
+func (memds *inMemoryDataStore)CreateDBConnection() error {
+    dbconfig := config.GetConfigInstance()
+    if dbconfig.DB.Driver != MEMORY_DB_DRIVER {
+        memds.dblogger.Error("Failed to start application, Invalid driver :%s",
+                             dbconfig.DB.Driver)
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_DB_DRIVER])
+    }
+    return nil
+}
+
+//Create all the in-memory tables, existing records are kept as is.
+func (memds *inMemoryDataStore)InitDataStore() error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if memds.users != nil {
+        memds.dblogger.Info("In-memory tables are already exist in the system.")
+        return nil
+    }
+    memds.roles = make(map[RoleBit]*Role)
+    memds.users = make(map[string]*Users)
+    memds.orgs = make(map[syncParam.UUID]*memOrg)
+    memds.memberships = make(map[memMembershipKey]time.Time)
+    memds.invites = make(map[memInviteKey]RoleBit)
+    memds.templates = make(map[syncParam.UUID]*ShiftTemplate)
+    memds.shifts = make(map[syncParam.UUID]*Shift)
+    memds.assignments = make(map[syncParam.UUID]*RosterAssignment)
+    memds.sessions = make(map[syncParam.UUID]*Session)
+    memds.availability = make(map[syncParam.UUID]*Availability)
+    memds.leavePolicies = make(map[syncParam.UUID]*LeavePolicy)
+    memds.leaveBalances = make(map[memLeaveBalanceKey]*LeaveBalance)
+    memds.leaves = make(map[syncParam.UUID]*LeaveRequest)
+    memds.swapSettings = make(map[syncParam.UUID]*SwapSettings)
+    memds.swapOffers = make(map[syncParam.UUID]*SwapOffer)
+    memds.swapAudit = make(map[syncParam.UUID]*SwapAudit)
+    memds.onCallRotations = make(map[syncParam.UUID]*OnCallRotation)
+    memds.onCallOverrides = make(map[syncParam.UUID]*OnCallOverride)
+    memds.escalations = make(map[syncParam.UUID]*EscalationPolicy)
+    memds.feeds = make(map[syncParam.UUID]*CalendarFeed)
+    memds.patterns = make(map[syncParam.UUID]*ShiftPattern)
+    memds.patternOccurrences = make(map[syncParam.UUID]*PatternOccurrence)
+    memds.holidayCalendars = make(map[syncParam.UUID]*HolidayCalendar)
+    memds.holidays = make(map[syncParam.UUID]*Holiday)
+    memds.userSkills = make(map[memUserSkillKey]*UserSkill)
+    systemRoles := map[RoleBit]string{ENDUSER : ENDUSER_ROLE_NAME,
+                                      MANAGER : MANAGER_ROLE_NAME,
+                                      ROOTADMIN : ROOTADMIN_ROLE_NAME}
+    for bit, name := range(systemRoles) {
+        memds.roles[bit] = &Role{roles : roles{roleType : bit}, name : name,
+                                 permissions : []string{}, system : true}
+    }
+    return nil
+}
+
+//In-memory tables have no schema versions, nothing to migrate.
+func (memds *inMemoryDataStore)MigrateUp() error {
+    return nil
+}
+
+func (memds *inMemoryDataStore)MigrateDown() error {
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListMigrations() ([]MigrationStatus, error) {
+    return []MigrationStatus{}, nil
+}
+
+func (memds *inMemoryDataStore)CreateUserAccount(user *Users) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if len(user.userid) == 0 || len(user.emailid) == 0 ||
+        len(user.hashpwd) == 0 || len(user.mobileno) == 0 ||
+        user.status == 0 {
+            memds.dblogger.Error("Cannot create user record, invalid params")
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.users[user.userid]; ok {
+        memds.dblogger.Info("%s user record already present in system",
+                            user.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    user.startTime = time.Now()
+    entry := new(Users)
+    *entry = *user
+    memds.users[user.userid] = entry
+    return nil
+}
+
+//The password hash is verified outside the lock, hashing is slow by design
+// and must not block the other datastore operations.
+func (memds *inMemoryDataStore)GetUserAccount(user *Users,
+                                              password string) error {
+    memds.lock.RLock()
+    entry, ok := memds.users[user.userid]
+    var account Users
+    if ok {
+        account = *entry
+    }
+    memds.lock.RUnlock()
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_CREDENTIALS])
+    }
+    valid, rehash := credentials.VerifyPassword(account.hashpwd, password)
+    if !valid {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_CREDENTIALS])
+    }
+    if rehash {
+        hashpwd, err := credentials.HashPassword(password)
+        if err != nil {
+            memds.dblogger.Warning("Failed to rehash pwd of user %s, err : %s",
+                                   user.userid, err)
+        } else {
+            memds.lock.Lock()
+            //Skip the rehash when the account is deleted or its password is
+            // changed meanwhile.
+            entry, ok = memds.users[user.userid]
+            if ok && entry.hashpwd == account.hashpwd {
+                entry.hashpwd = hashpwd
+                account.hashpwd = hashpwd
+            }
+            memds.lock.Unlock()
+        }
+    }
+    *user = account
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetUser(user *Users) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.users[user.userid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *user = *entry
+    return nil
+}
+
+//Delete the user and all the records that refer to the user.
+func (memds *inMemoryDataStore)DeleteUserAccount(user *Users) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    delete(memds.users, user.userid)
+    for key := range(memds.memberships) {
+        if key.userid == user.userid {
+            delete(memds.memberships, key)
+        }
+    }
+    for key := range(memds.invites) {
+        if key.userid == user.userid {
+            delete(memds.invites, key)
+        }
+    }
+    for uuid, asgn := range(memds.assignments) {
+        if asgn.userid == user.userid {
+            memds.deleteAssignmentOffers(uuid)
+            delete(memds.assignments, uuid)
+        }
+    }
+    for uuid, offer := range(memds.swapOffers) {
+        if offer.offeredBy == user.userid {
+            delete(memds.swapOffers, uuid)
+            continue
+        }
+        if offer.takenBy == user.userid {
+            offer.takenBy = ""
+        }
+        if offer.decidedBy == user.userid {
+            offer.decidedBy = ""
+        }
+    }
+    for uuid, sess := range(memds.sessions) {
+        if sess.userid == user.userid {
+            delete(memds.sessions, uuid)
+        }
+    }
+    for uuid, avail := range(memds.availability) {
+        if avail.userid == user.userid {
+            delete(memds.availability, uuid)
+        }
+    }
+    for key := range(memds.leaveBalances) {
+        if key.userid == user.userid {
+            delete(memds.leaveBalances, key)
+        }
+    }
+    for uuid, leave := range(memds.leaves) {
+        if leave.userid == user.userid {
+            delete(memds.leaves, uuid)
+        } else if leave.decidedBy == user.userid {
+            leave.decidedBy = ""
+        }
+    }
+    memds.deleteOnCallUser(user.userid)
+    for key := range(memds.userSkills) {
+        if key.userid == user.userid {
+            delete(memds.userSkills, key)
+        }
+    }
+    for uuid, feed := range(memds.feeds) {
+        if feed.userid == user.userid {
+            delete(memds.feeds, uuid)
+        }
+    }
+    for _, tmpl := range(memds.templates) {
+        if tmpl.owner == user.userid {
+            tmpl.owner = ""
+        }
+    }
+    for _, pat := range(memds.patterns) {
+        if pat.owner == user.userid {
+            pat.owner = ""
+        }
+    }
+    for _, shift := range(memds.shifts) {
+        if shift.owner == user.userid {
+            shift.owner = ""
+        }
+    }
+    return nil
+}
+
+func (memds *inMemoryDataStore)UpdateUserAccount(user *Users) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if user.status == 0 {
+        memds.dblogger.Info("Cannot update user record %s, invalid status",
+                            user.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    entry, ok := memds.users[user.userid]
+    if !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    entry.emailid = user.emailid
+    entry.hashpwd = user.hashpwd
+    entry.mobileno = user.mobileno
+    entry.status = user.status
+    entry.validity = user.validity
+    return nil
+}
+
+//Build the org with its parent chain from the in-memory records.
+//Must be called with lock held.
+func (memds *inMemoryDataStore)buildOrg(uuid syncParam.UUID) *Org {
+    entry, ok := memds.orgs[uuid]
+    if !ok {
+        return nil
+    }
+    or := new(Org)
+    *or = entry.org
+    or.parent = nil
+    if !syncParam.IsUUIDEmpty(entry.parentUUID) {
+        or.parent = memds.buildOrg(entry.parentUUID)
+    }
+    return or
+}
+
+//Location of the time zone of org 'uuid', UTC when the org is not present.
+//Must be called with lock held.
+func (memds *inMemoryDataStore)orgLocation(uuid syncParam.UUID) *time.Location {
+    entry, ok := memds.orgs[uuid]
+    if !ok {
+        return time.UTC
+    }
+    return entry.org.Location()
+}
+
+//Find the uuid of org using name, address and parent uuid.
+//Must be called with lock held.
+func (memds *inMemoryDataStore)findOrgUUID(name string, address string,
+                        parentUUID syncParam.UUID) (syncParam.UUID, bool) {
+    for uuid, entry := range(memds.orgs) {
+        if entry.org.name == name && entry.org.address == address &&
+            entry.parentUUID == parentUUID {
+            return uuid, true
+        }
+    }
+    return syncParam.UUID{}, false
+}
+
+//Resolve the uuid of org and all its ancestors like fillUUIDforOrgParents.
+//Return false when org or any of its ancestors is not present.
+//Must be called with lock held.
+func (memds *inMemoryDataStore)resolveOrgUUID(or *Org) bool {
+    var parentUUID syncParam.UUID
+    if or.parent != nil {
+        if !memds.resolveOrgUUID(or.parent) {
+            return false
+        }
+        parentUUID = or.parent.uuid
+    }
+    if !syncParam.IsUUIDEmpty(or.uuid) {
+        _, ok := memds.orgs[or.uuid]
+        return ok
+    }
+    uuid, ok := memds.findOrgUUID(or.name, or.address, parentUUID)
+    if ok {
+        or.uuid = uuid
+    }
+    return ok
+}
+
+//Find the org record by uuid or by name, address and parent.
+//Must be called with lock held.
+func (memds *inMemoryDataStore)getOrg(or *Org) (*Org, error) {
+    lookup := new(Org)
+    *lookup = *or
+    if !memds.resolveOrgUUID(lookup) {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return memds.buildOrg(lookup.uuid), nil
+}
+
+//List uuids of immediate children of org. Must be called with lock held.
+func (memds *inMemoryDataStore)childOrgUUIDs(
+                            uuid syncParam.UUID) []syncParam.UUID {
+    children := []syncParam.UUID{}
+    for childUUID, entry := range(memds.orgs) {
+        if entry.parentUUID == uuid {
+            children = append(children, childUUID)
+        }
+    }
+    //Map iteration order is random, keep the children in name order.
+    sort.Slice(children, func(i, j int) bool {
+        return memds.orgs[children[i]].org.name <
+               memds.orgs[children[j]].org.name
+    })
+    return children
+}
+
+func (memds *inMemoryDataStore)CreateOrg(or *Org) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    return memds.createOrg(or)
+}
+
+//The user is checked before creating the org, so the grant cannot fail after
+// the org is created.
+func (memds *inMemoryDataStore)CreateOrgWithAdmin(or *Org,
+                                                  userid string) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.users[userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    err := memds.createOrg(or)
+    if err != nil {
+        return err
+    }
+    err = memds.grantUserOrgRole(NewUserOrgRole(userid, ROOTADMIN, or.uuid))
+    if err != nil {
+        delete(memds.orgs, or.uuid)
+        return err
+    }
+    return nil
+}
+
+//Create an org entry, must be called with lock held.
+func (memds *inMemoryDataStore)createOrg(or *Org) error {
+    if len(or.name) >= ORG_NAME_STR_LEN ||
+       len(or.address) >= ORG_NAME_STR_LEN ||
+       len(or.name) == 0 {
+           memds.dblogger.Error(
+              "Failed to create org entry as invalid length name/address")
+           return fmt.Errorf("%s",
+                   errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if or.IsOrgStatusValid() == false {
+        memds.dblogger.Trace("Organization %s doesnt have a proper status",
+                             or.name)
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if !or.isTimeZoneValid() {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TIME_ZONE_INVALID])
+    }
+    var parentUUID syncParam.UUID
+    if or.parent != nil {
+        if !memds.resolveOrgUUID(or.parent) {
+            return fmt.Errorf("%s",
+                      errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+        parentUUID = or.parent.uuid
+    }
+    if len(or.timeZone) == 0 {
+        or.timeZone = timezone.DEFAULT_TIME_ZONE
+        if or.parent != nil {
+            or.timeZone = memds.orgs[parentUUID].org.timeZone
+        }
+    }
+    if _, ok := memds.findOrgUUID(or.name, or.address, parentUUID); ok {
+        memds.dblogger.Trace(
+            "Organization %s already present in system, cannot create",
+            or.name)
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    var err error
+    or.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    or.startTime = time.Now()
+    entry := new(memOrg)
+    entry.org = *or
+    entry.org.parent = nil
+    entry.parentUUID = parentUUID
+    memds.orgs[or.uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetOrg(or *Org) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, err := memds.getOrg(or)
+    if err != nil {
+        return err
+    }
+    *or = *entry
+    return nil
+}
+
+//Update status and validity of the org and all its descendants, and the
+// time zone of the org.
+func (memds *inMemoryDataStore)UpdateOrg(or *Org) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if or.IsOrgStatusValid() == false {
+        memds.dblogger.Info(`Cannot update the org record %s as invalid
+                status bit provided`, or.name)
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if !or.isTimeZoneValid() {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TIME_ZONE_INVALID])
+    }
+    entry, err := memds.getOrg(or)
+    if err != nil {
+        return err
+    }
+    if len(or.timeZone) != 0 {
+        memds.orgs[entry.uuid].org.timeZone = or.timeZone
+    }
+    if entry.status == or.status && entry.validity == or.validity {
+        return nil
+    }
+    var updateFunc func(syncParam.UUID)
+    updateFunc = func(uuid syncParam.UUID) {
+        for _, child := range(memds.childOrgUUIDs(uuid)) {
+            updateFunc(child)
+        }
+        memds.orgs[uuid].org.status = or.status
+        memds.orgs[uuid].org.validity = or.validity
+    }
+    updateFunc(entry.uuid)
+    return nil
+}
+
+//Delete the org, all its descendants and the records that refer to them.
+func (memds *inMemoryDataStore)DeleteOrg(or *Org) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, err := memds.getOrg(or)
+    if err != nil {
+        return err
+    }
+    var deleteFunc func(syncParam.UUID)
+    deleteFunc = func(uuid syncParam.UUID) {
+        for _, child := range(memds.childOrgUUIDs(uuid)) {
+            deleteFunc(child)
+        }
+        memds.deleteOrgRecords(uuid)
+        for bit, rl := range(memds.roles) {
+            if rl.orgUUID == uuid {
+                memds.deleteRoleRecords(bit)
+            }
+        }
+        delete(memds.orgs, uuid)
+    }
+    deleteFunc(entry.uuid)
+    return nil
+}
+
+//Delete all records that refers to the org, Must be called with lock held.
+func (memds *inMemoryDataStore)deleteOrgRecords(uuid syncParam.UUID) {
+    for key := range(memds.memberships) {
+        if key.orgUUID == uuid {
+            delete(memds.memberships, key)
+        }
+    }
+    for key := range(memds.invites) {
+        if key.orgUUID == uuid {
+            delete(memds.invites, key)
+        }
+    }
+    for asgnUUID, asgn := range(memds.assignments) {
+        if asgn.orgUUID == uuid {
+            memds.deleteAssignmentOffers(asgnUUID)
+            delete(memds.assignments, asgnUUID)
+        }
+    }
+    for offerUUID, offer := range(memds.swapOffers) {
+        if offer.orgUUID == uuid {
+            delete(memds.swapOffers, offerUUID)
+        }
+    }
+    for auditUUID, audit := range(memds.swapAudit) {
+        if audit.orgUUID == uuid {
+            delete(memds.swapAudit, auditUUID)
+        }
+    }
+    delete(memds.swapSettings, uuid)
+    memds.deleteOnCallOrg(uuid)
+    for feedUUID, feed := range(memds.feeds) {
+        if feed.orgUUID == uuid {
+            delete(memds.feeds, feedUUID)
+        }
+    }
+    for shiftUUID, shift := range(memds.shifts) {
+        if shift.orgUUID == uuid {
+            delete(memds.patternOccurrences, shiftUUID)
+            delete(memds.shifts, shiftUUID)
+        }
+    }
+    for patUUID, pat := range(memds.patterns) {
+        if pat.orgUUID == uuid {
+            delete(memds.patterns, patUUID)
+        }
+    }
+    for calUUID, cal := range(memds.holidayCalendars) {
+        if cal.orgUUID == uuid {
+            memds.deleteCalendarHolidays(calUUID, false)
+            delete(memds.holidayCalendars, calUUID)
+        }
+    }
+    for tmplUUID, tmpl := range(memds.templates) {
+        if tmpl.orgUUID == uuid {
+            memds.deleteTemplatePreferences(tmplUUID)
+            delete(memds.templates, tmplUUID)
+        }
+    }
+    for leaveUUID, leave := range(memds.leaves) {
+        if leave.orgUUID == uuid {
+            delete(memds.leaves, leaveUUID)
+        }
+    }
+    for policyUUID, policy := range(memds.leavePolicies) {
+        if policy.orgUUID == uuid {
+            memds.deletePolicyRecords(policyUUID)
+            delete(memds.leavePolicies, policyUUID)
+        }
+    }
+}
+
+func (memds *inMemoryDataStore)ListChildOrgs(or *Org) ([]Org, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, err := memds.getOrg(or)
+    if err != nil {
+        return nil, err
+    }
+    children := []Org{}
+    for _, childUUID := range(memds.childOrgUUIDs(entry.uuid)) {
+        children = append(children, *memds.buildOrg(childUUID))
+    }
+    return children, nil
+}
+
+func (memds *inMemoryDataStore)GetOrgTree(or *Org) (*OrgTree, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, err := memds.getOrg(or)
+    if err != nil {
+        return nil, err
+    }
+    var treeFunc func(*Org) *OrgTree
+    treeFunc = func(node *Org) *OrgTree {
+        tree := new(OrgTree)
+        tree.Org = node
+        for _, childUUID := range(memds.childOrgUUIDs(node.uuid)) {
+            tree.Children = append(tree.Children,
+                                   treeFunc(memds.buildOrg(childUUID)))
+        }
+        return tree
+    }
+    return treeFunc(entry), nil
+}
+
+// Only one in-memory datastore object can be present in the system, all the
+// records are shared across the application.
+func getInMemoryDataStoreObj() *inMemoryDataStore {
+    memOnce.Do(func() {
+        memObj.dblogger = logging.GetAppLoggerObj()
+        memObj.dblogger.Trace("In-memory DB Object is created successfully")
+    })
+    return memObj
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Delete the user preferences of a shift template. Must be called with lock
+// held.
+func (memds *inMemoryDataStore)deleteTemplatePreferences(
+                                            tmplUUID syncParam.UUID) {
+    for uuid, avail := range(memds.availability) {
+        if avail.kind == AVAILABILITY_PREFERENCE &&
+            avail.templateUUID == tmplUUID {
+            delete(memds.availability, uuid)
+        }
+    }
+}
+
+//List the availability records of user in the order of DB rows. Must be
+// called with lock held.
+func (memds *inMemoryDataStore)listUserAvailability(
+                                            userid string) []Availability {
+    availList := []Availability{}
+    for _, avail := range(memds.availability) {
+        if avail.userid == userid {
+            availList = append(availList, *avail)
+        }
+    }
+    sort.Slice(availList, func(i, j int) bool {
+        if availList[i].kind != availList[j].kind {
+            return availList[i].kind < availList[j].kind
+        }
+        if !availList[i].startTime.Equal(availList[j].startTime) {
+            return availList[i].startTime.Before(availList[j].startTime)
+        }
+        if availList[i].startOffset != availList[j].startOffset {
+            return availList[i].startOffset < availList[j].startOffset
+        }
+        return syncParam.UUIDtoString(availList[i].uuid) <
+               syncParam.UUIDtoString(availList[j].uuid)
+    })
+    return availList
+}
+
+func (memds *inMemoryDataStore)CreateAvailability(avail *Availability) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if avail.IsAvailabilityValid() == false {
+        memds.dblogger.Error("Cannot create availability, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.users[avail.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if avail.kind == AVAILABILITY_PREFERENCE {
+        if _, ok := memds.templates[avail.templateUUID]; !ok {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+        for _, entry := range(memds.availability) {
+            if entry.userid == avail.userid &&
+                entry.kind == AVAILABILITY_PREFERENCE &&
+                entry.templateUUID == avail.templateUUID {
+                return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+            }
+        }
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    avail.uuid = uuid
+    if avail.kind == AVAILABILITY_BLACKOUT {
+        avail.startTime = avail.startTime.UTC()
+        avail.endTime = avail.endTime.UTC()
+    } else {
+        //Only blackouts carry the time, same as the DB rows.
+        avail.startTime = time.Time{}
+        avail.endTime = time.Time{}
+    }
+    entry := new(Availability)
+    *entry = *avail
+    memds.availability[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetAvailability(avail *Availability) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.availability[avail.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *avail = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListUserAvailability(
+                                userid string) ([]Availability, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listUserAvailability(userid), nil
+}
+
+func (memds *inMemoryDataStore)DeleteAvailability(avail *Availability) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.availability[avail.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *avail = *entry
+    delete(memds.availability, avail.uuid)
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListAvailableUsers(orgUUID syncParam.UUID,
+                                from time.Time, to time.Time) ([]string, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    org := memds.buildOrg(orgUUID)
+    if org == nil {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    loc := org.Location()
+    chain := map[syncParam.UUID]bool{}
+    for ; org != nil; org = org.parent {
+        chain[org.uuid] = true
+    }
+    userids := map[string]bool{}
+    for key := range(memds.memberships) {
+        if chain[key.orgUUID] {
+            userids[key.userid] = true
+        }
+    }
+    now := time.Now()
+    availUsers := []string{}
+    for userid := range(userids) {
+        user, ok := memds.users[userid]
+        if !ok || user.IsInactive(now) {
+            continue
+        }
+        if IsUserAvailable(memds.listUserAvailability(userid), from, to,
+                           loc) &&
+            len(memds.listUserLeave(userid, LEAVE_APPROVED, from, to)) == 0 {
+            availUsers = append(availUsers, userid)
+        }
+    }
+    sort.Strings(availUsers)
+    return availUsers, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+func (memds *inMemoryDataStore)CreateCalendarFeed(feed *CalendarFeed) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if feed.IsCalendarFeedValid() == false {
+        memds.dblogger.Error("Cannot create feed, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.users[feed.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if feed.kind == FEED_ORG {
+        if _, ok := memds.orgs[feed.orgUUID]; !ok {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    feed.uuid = uuid
+    feed.createTime = time.Now()
+    entry := new(CalendarFeed)
+    *entry = *feed
+    memds.feeds[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetCalendarFeed(feed *CalendarFeed) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.feeds[feed.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *feed = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListUserCalendarFeeds(
+                                userid string) ([]CalendarFeed, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    feeds := []CalendarFeed{}
+    for _, entry := range(memds.feeds) {
+        if entry.userid == userid {
+            feeds = append(feeds, *entry)
+        }
+    }
+    sort.Slice(feeds, func(i, j int) bool {
+        return feeds[i].createTime.Before(feeds[j].createTime)
+    })
+    return feeds, nil
+}
+
+func (memds *inMemoryDataStore)DeleteCalendarFeed(feed *CalendarFeed) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.feeds[feed.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.feeds, feed.uuid)
+    return nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Delete the holidays of a calendar, only the imported holidays when
+// 'importedOnly' is set. Must be called with lock held.
+func (memds *inMemoryDataStore)deleteCalendarHolidays(calUUID syncParam.UUID,
+                                importedOnly bool) {
+    for uuid, hol := range(memds.holidays) {
+        if hol.calendarUUID == calUUID && (hol.imported || !importedOnly) {
+            delete(memds.holidays, uuid)
+        }
+    }
+}
+
+//Holidays of the calendars that pass 'calFilter' with the dates in the range
+// [from, to), sorted on date. Must be called with lock held.
+func (memds *inMemoryDataStore)listHolidays(
+                                calFilter func(*HolidayCalendar) bool,
+                                from time.Time, to time.Time) []Holiday {
+    from, to = holidayDate(from), holidayDate(to)
+    hols := []Holiday{}
+    for _, hol := range(memds.holidays) {
+        if hol.date.Before(from) || !hol.date.Before(to) {
+            continue
+        }
+        cal, ok := memds.holidayCalendars[hol.calendarUUID]
+        if ok && calFilter(cal) {
+            hols = append(hols, *hol)
+        }
+    }
+    sortHolidays(hols)
+    return hols
+}
+
+//Holidays in effect for the org/unit with the dates in the range [from, to).
+// Must be called with lock held.
+func (memds *inMemoryDataStore)listOrgHolidays(orgUUID syncParam.UUID,
+                                from time.Time,
+                                to time.Time) ([]Holiday, error) {
+    org := memds.buildOrg(orgUUID)
+    if org == nil {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    for entry := org; entry != nil; entry = entry.parent {
+        hasCalendar := false
+        for _, cal := range(memds.holidayCalendars) {
+            if cal.orgUUID == entry.uuid {
+                hasCalendar = true
+                break
+            }
+        }
+        if !hasCalendar {
+            continue
+        }
+        calOrgUUID := entry.uuid
+        return memds.listHolidays(func(cal *HolidayCalendar) bool {
+            return cal.orgUUID == calOrgUUID
+        }, from, to), nil
+    }
+    return []Holiday{}, nil
+}
+
+func (memds *inMemoryDataStore)CreateHolidayCalendar(
+                                cal *HolidayCalendar) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if cal.IsHolidayCalendarValid() == false {
+        memds.dblogger.Error("Cannot create holiday calendar, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[cal.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    for _, entry := range(memds.holidayCalendars) {
+        if entry.orgUUID == cal.orgUUID && entry.name == cal.name {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+        }
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    cal.uuid = uuid
+    cal.createTime = time.Now()
+    entry := new(HolidayCalendar)
+    *entry = *cal
+    memds.holidayCalendars[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetHolidayCalendar(cal *HolidayCalendar) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.holidayCalendars[cal.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *cal = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListHolidayCalendars(
+                        orgUUID syncParam.UUID) ([]HolidayCalendar, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    cals := []HolidayCalendar{}
+    for _, entry := range(memds.holidayCalendars) {
+        if entry.orgUUID == orgUUID {
+            cals = append(cals, *entry)
+        }
+    }
+    sort.Slice(cals, func(i, j int) bool {
+        return cals[i].name < cals[j].name
+    })
+    return cals, nil
+}
+
+func (memds *inMemoryDataStore)DeleteHolidayCalendar(
+                                cal *HolidayCalendar) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.holidayCalendars[cal.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    memds.deleteCalendarHolidays(cal.uuid, false)
+    delete(memds.holidayCalendars, cal.uuid)
+    return nil
+}
+
+func (memds *inMemoryDataStore)CreateHoliday(hol *Holiday) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    hol.imported = false
+    if hol.IsHolidayValid() == false {
+        memds.dblogger.Error("Cannot create holiday, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.holidayCalendars[hol.calendarUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    hol.uuid = uuid
+    hol.date = holidayDate(hol.date)
+    entry := new(Holiday)
+    *entry = *hol
+    memds.holidays[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetHoliday(hol *Holiday) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.holidays[hol.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *hol = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)DeleteHoliday(hol *Holiday) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.holidays[hol.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.holidays, hol.uuid)
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListHolidays(calendarUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]Holiday, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listHolidays(func(cal *HolidayCalendar) bool {
+        return cal.uuid == calendarUUID
+    }, from, to), nil
+}
+
+func (memds *inMemoryDataStore)ImportHolidays(calendarUUID syncParam.UUID,
+                                              hols []Holiday) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.holidayCalendars[calendarUUID]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    for i := range(hols) {
+        hols[i].calendarUUID = calendarUUID
+        hols[i].imported = true
+        hols[i].date = holidayDate(hols[i].date)
+        if hols[i].IsHolidayValid() == false {
+            memds.dblogger.Error("Cannot import holidays, invalid params")
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+        }
+    }
+    memds.deleteCalendarHolidays(calendarUUID, true)
+    for i := range(hols) {
+        uuid, err := syncParam.NewUUID()
+        if err != nil {
+            return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+        }
+        hols[i].uuid = uuid
+        entry := new(Holiday)
+        *entry = hols[i]
+        memds.holidays[uuid] = entry
+    }
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListOrgHolidays(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]Holiday, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listOrgHolidays(orgUUID, from, to)
+}
+
+func (memds *inMemoryDataStore)IsHoliday(orgUUID syncParam.UUID,
+                                         at time.Time) (*Holiday, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    day := holidayDate(at.In(memds.orgLocation(orgUUID)))
+    hols, err := memds.listOrgHolidays(orgUUID, day, day.AddDate(0, 0, 1))
+    if err != nil {
+        return nil, err
+    }
+    return holidayOfDay(hols), nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+func (memds *inMemoryDataStore)CreateMembershipInvite(
+                                invite *UserOrgRole) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    err := memds.checkMembership(invite)
+    if err != nil {
+        return err
+    }
+    memds.invites[memInviteKey{invite.userid, invite.UUID()}] =
+                                                            invite.roleType
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListUserMembershipInvites(
+                                userid string) ([]UserOrgRole, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    keys := []memInviteKey{}
+    for key := range(memds.invites) {
+        if key.userid == userid {
+            keys = append(keys, key)
+        }
+    }
+    //Same order as the DB rows.
+    sort.Slice(keys, func(i, j int) bool {
+        return syncParam.UUIDtoString(keys[i].orgUUID) <
+               syncParam.UUIDtoString(keys[j].orgUUID)
+    })
+    invites := make([]UserOrgRole, 0, len(keys))
+    for _, key := range(keys) {
+        invites = append(invites, *NewUserOrgRole(key.userid,
+                                        memds.invites[key], key.orgUUID))
+    }
+    return invites, nil
+}
+
+func (memds *inMemoryDataStore)AcceptMembershipInvite(
+                                invite *UserOrgRole) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    key := memInviteKey{invite.userid, invite.UUID()}
+    roles, ok := memds.invites[key]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    invite.roleType = roles
+    err := memds.grantUserOrgRole(invite)
+    if err != nil {
+        return err
+    }
+    delete(memds.invites, key)
+    return nil
+}
+
+func (memds *inMemoryDataStore)DeleteMembershipInvite(
+                                invite *UserOrgRole) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    key := memInviteKey{invite.userid, invite.UUID()}
+    if _, ok := memds.invites[key]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.invites, key)
+    return nil
+}
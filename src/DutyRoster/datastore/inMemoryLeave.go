@@ -0,0 +1,366 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Key of a leave balance record, one balance for each user and policy.
+type memLeaveBalanceKey struct {
+    userid string
+    policyUUID syncParam.UUID
+}
+
+//Delete the balances and requests of a leave policy. Must be called with
+// lock held.
+func (memds *inMemoryDataStore)deletePolicyRecords(policyUUID syncParam.UUID) {
+    for key := range(memds.leaveBalances) {
+        if key.policyUUID == policyUUID {
+            delete(memds.leaveBalances, key)
+        }
+    }
+    for uuid, leave := range(memds.leaves) {
+        if leave.policyUUID == policyUUID {
+            delete(memds.leaves, uuid)
+        }
+    }
+}
+
+//Get the leave balance of user for the policy accrued until 'now', the
+// balance is created when not present. Must be called with lock held.
+func (memds *inMemoryDataStore)getLeaveBalance(userid string,
+                                policy *LeavePolicy,
+                                now time.Time) (*LeaveBalance, error) {
+    key := memLeaveBalanceKey{userid, policy.uuid}
+    bal, ok := memds.leaveBalances[key]
+    if !ok {
+        if _, ok := memds.users[userid]; !ok {
+            return nil, fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+        //Balances are kept in seconds same as the DB rows.
+        bal = &LeaveBalance{userid : userid, policyUUID : policy.uuid,
+                            lastAccrual : now.UTC().Truncate(time.Second)}
+        memds.leaveBalances[key] = bal
+        return bal, nil
+    }
+    bal.accrue(policy, now)
+    return bal, nil
+}
+
+//List the leave requests of user in 'status' that overlaps the range
+// [from, to), all the requests when status is 0. Must be called with lock
+// held.
+func (memds *inMemoryDataStore)listUserLeave(userid string,
+                                status LeaveStatusBit, from time.Time,
+                                to time.Time) []LeaveRequest {
+    leaves := []LeaveRequest{}
+    for _, leave := range(memds.leaves) {
+        if leave.userid != userid || (status != 0 && leave.status != status) {
+            continue
+        }
+        if leave.endTime.After(from) && leave.startTime.Before(to) {
+            leaves = append(leaves, *leave)
+        }
+    }
+    sortLeaves(leaves)
+    return leaves
+}
+
+//Sort the leave requests on start time, same as the DB rows.
+func sortLeaves(leaves []LeaveRequest) {
+    sort.Slice(leaves, func(i, j int) bool {
+        if !leaves[i].startTime.Equal(leaves[j].startTime) {
+            return leaves[i].startTime.Before(leaves[j].startTime)
+        }
+        return syncParam.UUIDtoString(leaves[i].uuid) <
+               syncParam.UUIDtoString(leaves[j].uuid)
+    })
+}
+
+func (memds *inMemoryDataStore)CreateLeavePolicy(policy *LeavePolicy) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if policy.IsLeavePolicyValid() == false {
+        memds.dblogger.Error("Cannot create leave policy, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[policy.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    for _, entry := range(memds.leavePolicies) {
+        if entry.orgUUID == policy.orgUUID && entry.name == policy.name {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+        }
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    policy.uuid = uuid
+    //Durations are kept in seconds same as the DB rows.
+    policy.accrual = policy.accrual.Truncate(time.Second)
+    policy.maxBalance = policy.maxBalance.Truncate(time.Second)
+    entry := new(LeavePolicy)
+    *entry = *policy
+    memds.leavePolicies[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetLeavePolicy(policy *LeavePolicy) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.leavePolicies[policy.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *policy = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListLeavePolicies(
+                        orgUUID syncParam.UUID) ([]LeavePolicy, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    org := memds.buildOrg(orgUUID)
+    if org == nil {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    policies := []LeavePolicy{}
+    for ; org != nil; org = org.parent {
+        orgPolicies := []LeavePolicy{}
+        for _, policy := range(memds.leavePolicies) {
+            if policy.orgUUID == org.uuid {
+                orgPolicies = append(orgPolicies, *policy)
+            }
+        }
+        sort.Slice(orgPolicies, func(i, j int) bool {
+            return orgPolicies[i].name < orgPolicies[j].name
+        })
+        policies = append(policies, orgPolicies...)
+    }
+    return policies, nil
+}
+
+func (memds *inMemoryDataStore)DeleteLeavePolicy(policy *LeavePolicy) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.leavePolicies[policy.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *policy = *entry
+    memds.deletePolicyRecords(policy.uuid)
+    delete(memds.leavePolicies, policy.uuid)
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetLeaveBalance(bal *LeaveBalance) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    policy, ok := memds.leavePolicies[bal.policyUUID]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    entry, err := memds.getLeaveBalance(bal.userid, policy, time.Now())
+    if err != nil {
+        return err
+    }
+    *bal = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)AdjustLeaveBalance(bal *LeaveBalance,
+                                delta time.Duration) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    policy, ok := memds.leavePolicies[bal.policyUUID]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if !policy.tracked {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    entry, err := memds.getLeaveBalance(bal.userid, policy, time.Now())
+    if err != nil {
+        return err
+    }
+    delta = delta.Truncate(time.Second)
+    if entry.balance + delta < 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_BALANCE_INSUFFICIENT])
+    }
+    entry.balance += delta
+    *bal = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)CreateLeaveRequest(leave *LeaveRequest) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    leave.status = LEAVE_REQUESTED
+    if leave.IsLeaveRequestValid() == false {
+        memds.dblogger.Error("Cannot create leave request, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    org := memds.buildOrg(leave.orgUUID)
+    policy, ok := memds.leavePolicies[leave.policyUUID]
+    if org == nil || !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if _, ok := memds.users[leave.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    member := false
+    for key := range(memds.memberships) {
+        if key.userid == leave.userid && isOrgInChain(org, key.orgUUID) {
+            member = true
+            break
+        }
+    }
+    if !member || !isOrgInChain(org, policy.orgUUID) {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    leave.uuid = uuid
+    leave.startTime = leave.startTime.UTC()
+    leave.endTime = leave.endTime.UTC()
+    leave.charge = leave.charge.Truncate(time.Second)
+    leave.createTime = time.Now()
+    leave.decidedBy = ""
+    leave.decideTime = time.Time{}
+    entry := new(LeaveRequest)
+    *entry = *leave
+    memds.leaves[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetLeaveRequest(leave *LeaveRequest) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.leaves[leave.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *leave = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListUserLeave(userid string, from time.Time,
+                                to time.Time) ([]LeaveRequest, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listUserLeave(userid, 0, from, to), nil
+}
+
+func (memds *inMemoryDataStore)ListOrgLeave(orgUUID syncParam.UUID,
+                        status LeaveStatusBit) ([]LeaveRequest, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    leaves := []LeaveRequest{}
+    for _, leave := range(memds.leaves) {
+        if leave.orgUUID == orgUUID && leave.status == status {
+            leaves = append(leaves, *leave)
+        }
+    }
+    sortLeaves(leaves)
+    return leaves, nil
+}
+
+func (memds *inMemoryDataStore)UpdateLeaveStatus(leave *LeaveRequest,
+                        status LeaveStatusBit, decidedBy string) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.leaves[leave.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if !IsLeaveTransitionValid(entry.status, status) {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_INVALID_TRANSITION])
+    }
+    if status == LEAVE_APPROVED &&
+        len(memds.listUserLeave(entry.userid, LEAVE_APPROVED, entry.startTime,
+                                entry.endTime)) != 0 {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.LEAVE_CONFLICT])
+    }
+    now := time.Now()
+    policy := memds.leavePolicies[entry.policyUUID]
+    if policy.tracked && (status == LEAVE_APPROVED ||
+                          entry.status == LEAVE_APPROVED) {
+        bal, err := memds.getLeaveBalance(entry.userid, policy, now)
+        if err != nil {
+            return err
+        }
+        if status == LEAVE_APPROVED {
+            if bal.balance < entry.charge {
+                return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_BALANCE_INSUFFICIENT])
+            }
+            bal.balance -= entry.charge
+        } else {
+            bal.balance += entry.charge
+        }
+    }
+    entry.status = status
+    if _, ok := memds.users[decidedBy]; ok {
+        entry.decidedBy = decidedBy
+    } else {
+        entry.decidedBy = ""
+    }
+    entry.decideTime = now
+    *leave = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListUserBusy(userid string, from time.Time,
+                                to time.Time) ([]LeaveRequest, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listUserLeave(userid, LEAVE_APPROVED, from, to), nil
+}
+
+func (memds *inMemoryDataStore)CheckLeaveConflict(userid string,
+                                from time.Time, to time.Time) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    if len(memds.listUserLeave(userid, LEAVE_APPROVED, from, to)) != 0 {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.LEAVE_CONFLICT])
+    }
+    return nil
+}
@@ -0,0 +1,321 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Copy the rotation, members are not shared between the copies.
+func copyOnCallRotation(dst *OnCallRotation, src *OnCallRotation) {
+    *dst = *src
+    dst.members = append([]string{}, src.members...)
+}
+
+//Return DB_RECORD_RELATION_ERROR when user is not a member of the org/unit or
+// its ancestors. Must be called with lock held.
+func (memds *inMemoryDataStore)isOnCallUserValid(userid string,
+                                orgUUID syncParam.UUID) error {
+    roles, err := memds.effectiveRoles(userid, orgUUID)
+    if err != nil {
+        return err
+    }
+    if roles == 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    return nil
+}
+
+//List the rotations of org/unit in the same order as DB rows. Must be called
+// with lock held.
+func (memds *inMemoryDataStore)listOnCallRotations(
+                                orgUUID syncParam.UUID) []OnCallRotation {
+    rotations := []OnCallRotation{}
+    for _, rot := range(memds.onCallRotations) {
+        if rot.orgUUID == orgUUID {
+            entry := OnCallRotation{}
+            copyOnCallRotation(&entry, rot)
+            rotations = append(rotations, entry)
+        }
+    }
+    sort.Slice(rotations, func(i, j int) bool {
+        if rotations[i].level != rotations[j].level {
+            return rotations[i].level < rotations[j].level
+        }
+        if rotations[i].layer != rotations[j].layer {
+            return rotations[i].layer > rotations[j].layer
+        }
+        return rotations[i].name < rotations[j].name
+    })
+    return rotations
+}
+
+//List the overrides of org/unit that overlaps [from, to). Must be called
+// with lock held.
+func (memds *inMemoryDataStore)listOnCallOverrides(orgUUID syncParam.UUID,
+                                from time.Time,
+                                to time.Time) []OnCallOverride {
+    overrides := []OnCallOverride{}
+    for _, ovr := range(memds.onCallOverrides) {
+        if ovr.orgUUID == orgUUID && ovr.endTime.After(from) &&
+            ovr.startTime.Before(to) {
+            overrides = append(overrides, *ovr)
+        }
+    }
+    sort.Slice(overrides, func(i, j int) bool {
+        if !overrides[i].startTime.Equal(overrides[j].startTime) {
+            return overrides[i].startTime.Before(overrides[j].startTime)
+        }
+        return overrides[i].createTime.Before(overrides[j].createTime)
+    })
+    return overrides
+}
+
+//Remove the user from all the rotations, overrides and escalation policies.
+// Must be called with lock held.
+func (memds *inMemoryDataStore)deleteOnCallUser(userid string) {
+    for _, rot := range(memds.onCallRotations) {
+        members := []string{}
+        for _, member := range(rot.members) {
+            if member != userid {
+                members = append(members, member)
+            }
+        }
+        rot.members = members
+    }
+    for uuid, ovr := range(memds.onCallOverrides) {
+        if ovr.userid == userid {
+            delete(memds.onCallOverrides, uuid)
+        }
+    }
+    for _, policy := range(memds.escalations) {
+        if policy.manager == userid {
+            policy.manager = ""
+        }
+    }
+}
+
+//Delete the rotations, overrides and escalation policy of org/unit. Must be
+// called with lock held.
+func (memds *inMemoryDataStore)deleteOnCallOrg(orgUUID syncParam.UUID) {
+    for uuid, rot := range(memds.onCallRotations) {
+        if rot.orgUUID == orgUUID {
+            delete(memds.onCallRotations, uuid)
+        }
+    }
+    for uuid, ovr := range(memds.onCallOverrides) {
+        if ovr.orgUUID == orgUUID {
+            delete(memds.onCallOverrides, uuid)
+        }
+    }
+    delete(memds.escalations, orgUUID)
+}
+
+func (memds *inMemoryDataStore)CreateOnCallRotation(rot *OnCallRotation) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if rot.IsOnCallRotationValid() == false {
+        memds.dblogger.Error("Cannot create rotation, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[rot.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    for _, entry := range(memds.onCallRotations) {
+        if entry.orgUUID == rot.orgUUID && entry.name == rot.name {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+        }
+    }
+    for _, userid := range(rot.members) {
+        err := memds.isOnCallUserValid(userid, rot.orgUUID)
+        if err != nil {
+            return err
+        }
+    }
+    var err error
+    rot.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    //Handoff is kept in seconds same as the DB rows.
+    rot.handoffTime = rot.handoffTime.UTC().Truncate(time.Second)
+    rot.createTime = time.Now()
+    entry := new(OnCallRotation)
+    copyOnCallRotation(entry, rot)
+    memds.onCallRotations[rot.uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetOnCallRotation(rot *OnCallRotation) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.onCallRotations[rot.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    copyOnCallRotation(rot, entry)
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListOnCallRotations(
+                        orgUUID syncParam.UUID) ([]OnCallRotation, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listOnCallRotations(orgUUID), nil
+}
+
+func (memds *inMemoryDataStore)DeleteOnCallRotation(rot *OnCallRotation) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.onCallRotations[rot.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.onCallRotations, rot.uuid)
+    return nil
+}
+
+func (memds *inMemoryDataStore)CreateOnCallOverride(ovr *OnCallOverride) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if ovr.IsOnCallOverrideValid() == false {
+        memds.dblogger.Error("Cannot create override, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err := memds.isOnCallUserValid(ovr.userid, ovr.orgUUID)
+    if err != nil {
+        return err
+    }
+    ovr.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    ovr.createTime = time.Now()
+    entry := new(OnCallOverride)
+    *entry = *ovr
+    memds.onCallOverrides[ovr.uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetOnCallOverride(ovr *OnCallOverride) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.onCallOverrides[ovr.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *ovr = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListOnCallOverrides(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]OnCallOverride, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listOnCallOverrides(orgUUID, from, to), nil
+}
+
+func (memds *inMemoryDataStore)DeleteOnCallOverride(ovr *OnCallOverride) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.onCallOverrides[ovr.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.onCallOverrides, ovr.uuid)
+    return nil
+}
+
+func (memds *inMemoryDataStore)SetEscalationPolicy(
+                                policy *EscalationPolicy) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if policy.IsEscalationPolicyValid() == false {
+        memds.dblogger.Error("Cannot set escalation policy, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[policy.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if len(policy.manager) != 0 {
+        err := memds.isOnCallUserValid(policy.manager, policy.orgUUID)
+        if err != nil {
+            return err
+        }
+    }
+    entry := new(EscalationPolicy)
+    *entry = *policy
+    memds.escalations[policy.orgUUID] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetEscalationPolicy(
+                                policy *EscalationPolicy) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.escalations[policy.orgUUID]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *policy = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)DeleteEscalationPolicy(
+                                policy *EscalationPolicy) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.escalations[policy.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.escalations, policy.orgUUID)
+    return nil
+}
+
+func (memds *inMemoryDataStore)WhoIsOnCall(orgUUID syncParam.UUID,
+                                at time.Time) (*OnCall, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    org := memds.buildOrg(orgUUID)
+    if org == nil {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    oc := &OnCall{orgUUID : orgUUID, at : at.UTC()}
+    for entry := org; entry != nil && !oc.isComplete(); entry = entry.parent {
+        oc.resolveInOrg(entry, memds.listOnCallRotations(entry.uuid),
+                        memds.listOnCallOverrides(entry.uuid, oc.at,
+                                                  oc.at.Add(time.Second)),
+                        memds.escalations[entry.uuid])
+    }
+    return oc, nil
+}
@@ -0,0 +1,316 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/recurrence"
+    "DutyRoster/syncParam"
+)
+
+func (memds *inMemoryDataStore)CreateShiftPattern(pat *ShiftPattern) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    rule, err := recurrence.ParseRule(pat.rule)
+    if err != nil {
+        memds.dblogger.Error("Cannot create shift pattern %s, invalid rule %s",
+                             pat.name, pat.rule)
+        return err
+    }
+    if pat.IsShiftPatternValid() == false {
+        memds.dblogger.Error("Cannot create shift pattern %s, invalid params",
+                             pat.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[pat.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if !syncParam.IsUUIDEmpty(pat.templateUUID) {
+        if _, ok := memds.templates[pat.templateUUID]; !ok {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    pat.rule = rule.String()
+    pat.normalize()
+    return memds.storePattern(pat)
+}
+
+//Store a new pattern, uuid and createTime are populated.
+func (memds *inMemoryDataStore)storePattern(pat *ShiftPattern) error {
+    var err error
+    pat.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    pat.createTime = time.Now()
+    memds.patterns[pat.uuid] = pat.clone()
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetShiftPattern(pat *ShiftPattern) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.patterns[pat.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *pat = *entry.clone()
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListShiftPatterns(
+                        orgUUID syncParam.UUID) ([]ShiftPattern, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    pats := []ShiftPattern{}
+    for _, entry := range(memds.patterns) {
+        if entry.orgUUID == orgUUID {
+            pats = append(pats, *entry.clone())
+        }
+    }
+    sort.Slice(pats, func(i, j int) bool {
+        if pats[i].name != pats[j].name {
+            return pats[i].name < pats[j].name
+        }
+        return pats[i].createTime.Before(pats[j].createTime)
+    })
+    return pats, nil
+}
+
+//Delete the pattern, the shifts expanded from it are kept.
+func (memds *inMemoryDataStore)DeleteShiftPattern(pat *ShiftPattern) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.patterns[pat.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.patterns, pat.uuid)
+    for shiftUUID, occ := range(memds.patternOccurrences) {
+        if occ.patternUUID == pat.uuid {
+            delete(memds.patternOccurrences, shiftUUID)
+        }
+    }
+    return nil
+}
+
+//List the occurrences of the pattern with recurrence id in [from, to), there
+// is no upper bound when 'to' is zero.
+func (memds *inMemoryDataStore)listPatternOccurrences(
+                        patternUUID syncParam.UUID, from time.Time,
+                        to time.Time) []*PatternOccurrence {
+    occs := []*PatternOccurrence{}
+    for _, occ := range(memds.patternOccurrences) {
+        if occ.patternUUID != patternUUID {
+            continue
+        }
+        if occ.recurrenceID.Before(from) ||
+            (!to.IsZero() && !occ.recurrenceID.Before(to)) {
+            continue
+        }
+        occs = append(occs, occ)
+    }
+    sort.Slice(occs, func(i, j int) bool {
+        return occs[i].recurrenceID.Before(occs[j].recurrenceID)
+    })
+    return occs
+}
+
+func (memds *inMemoryDataStore)ListPatternOccurrences(
+                        patternUUID syncParam.UUID, from time.Time,
+                        to time.Time) ([]PatternOccurrence, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    occs := []PatternOccurrence{}
+    for _, occ := range(memds.listPatternOccurrences(patternUUID, from, to)) {
+        occs = append(occs, *occ)
+    }
+    return occs, nil
+}
+
+func (memds *inMemoryDataStore)ExpandShiftPattern(pat *ShiftPattern,
+                        from time.Time, to time.Time,
+                        owner string) ([]Shift, error) {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.patterns[pat.uuid]
+    if !ok {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *pat = *entry.clone()
+    if len(owner) == 0 || !to.After(from) {
+        return nil, fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    slots, err := pat.occurrencesIn(from, to, memds.orgLocation(pat.orgUUID))
+    if err != nil {
+        return nil, err
+    }
+    expanded := make(map[int64]bool)
+    for _, occ := range(memds.listPatternOccurrences(pat.uuid, from, to)) {
+        expanded[occ.recurrenceID.Unix()] = true
+    }
+    shifts := []Shift{}
+    for _, slot := range(slots) {
+        if expanded[slot.recurrenceID.Unix()] {
+            continue
+        }
+        shift := NewShift(pat.orgUUID, pat.templateUUID, slot.recurrenceID,
+                          slot.endTime, pat.minStaff, owner)
+        shift.uuid, err = syncParam.NewUUID()
+        if err != nil {
+            return nil, fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+        }
+        shift.createTime = time.Now()
+        shift.modifyTime = shift.createTime
+        memds.shifts[shift.uuid] = shift
+        memds.patternOccurrences[shift.uuid] = &PatternOccurrence{
+                        shiftUUID : shift.uuid, patternUUID : pat.uuid,
+                        recurrenceID : slot.recurrenceID}
+        shifts = append(shifts, *shift)
+    }
+    return shifts, nil
+}
+
+//Apply the edit to the shift of the occurrence in zone 'loc', returns true
+// when the shift is changed.
+func (memds *inMemoryDataStore)editOccurrenceShift(occ *PatternOccurrence,
+                        edit *PatternEdit, now time.Time,
+                        loc *time.Location) bool {
+    shift, ok := memds.shifts[occ.shiftUUID]
+    if !ok || !edit.applyToShift(shift, now, loc) {
+        return false
+    }
+    shift.bumpRevision(now)
+    edit.changed++
+    return true
+}
+
+func (memds *inMemoryDataStore)EditShiftPattern(edit *PatternEdit) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if edit.IsPatternEditValid() == false {
+        memds.dblogger.Error("Cannot edit shift pattern, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    pat, ok := memds.patterns[edit.patternUUID]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    now := time.Now()
+    loc := memds.orgLocation(pat.orgUUID)
+    edit.recurrenceID = edit.recurrenceID.UTC().Truncate(time.Second)
+    edit.resultUUID = pat.uuid
+    edit.changed = 0
+    var selected *PatternOccurrence
+    for _, occ := range(memds.listPatternOccurrences(pat.uuid,
+                                                     time.Time{}, time.Time{})) {
+        if occ.recurrenceID.Equal(edit.recurrenceID) {
+            selected = occ
+        }
+    }
+    _, inPattern := pat.occurrenceAt(edit.recurrenceID, loc)
+    if edit.scope != PATTERN_EDIT_ALL && selected == nil && !inPattern {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    switch(edit.scope) {
+    case PATTERN_EDIT_THIS:
+        //Occurrence must be expanded to edit it on its own, an occurrence
+        // that is not expanded yet can only be cancelled.
+        if selected == nil && !edit.cancel {
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+        }
+        if selected != nil {
+            if !memds.editOccurrenceShift(selected, edit, now, loc) {
+                return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+            }
+            selected.detached = true
+        }
+        if edit.cancel && inPattern {
+            pat.exdates = append(pat.exdates, edit.recurrenceID)
+            pat.normalize()
+        }
+    case PATTERN_EDIT_FOLLOWING:
+        following := memds.listPatternOccurrences(pat.uuid, edit.recurrenceID,
+                                                  time.Time{})
+        if edit.cancel {
+            pat.endAt(edit.recurrenceID)
+            for _, occ := range(following) {
+                if !occ.detached {
+                    memds.editOccurrenceShift(occ, edit, now, loc)
+                }
+            }
+            return nil
+        }
+        edited := pat.clone()
+        split := edited.splitAt(edit.recurrenceID, edit, loc)
+        if split.areStepsValid() == false {
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+        }
+        err := memds.storePattern(split)
+        if err != nil {
+            return err
+        }
+        *pat = *edited
+        edit.resultUUID = split.uuid
+        for _, occ := range(following) {
+            occ.patternUUID = split.uuid
+            occ.recurrenceID = edit.moveTime(occ.recurrenceID, loc)
+            if !occ.detached {
+                memds.editOccurrenceShift(occ, edit, now, loc)
+            }
+        }
+    case PATTERN_EDIT_ALL:
+        occs := memds.listPatternOccurrences(pat.uuid, time.Time{},
+                                             time.Time{})
+        if edit.cancel {
+            //The pattern ends now, the shifts started are kept.
+            pat.endAt(now.UTC().Truncate(time.Second))
+        } else {
+            edited := pat.clone()
+            edited.applyEdit(edit, loc)
+            if edited.areStepsValid() == false {
+                return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+            }
+            *pat = *edited
+        }
+        for _, occ := range(occs) {
+            if !edit.cancel {
+                occ.recurrenceID = edit.moveTime(occ.recurrenceID, loc)
+            }
+            if !occ.detached {
+                memds.editOccurrenceShift(occ, edit, now, loc)
+            }
+        }
+    }
+    return nil
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Copy of role, the permissions list is not shared with the caller.
+func copyRole(dst *Role, src *Role) {
+    *dst = *src
+    dst.permissions = append([]string{}, src.permissions...)
+}
+
+//Check no other role with same name can be granted in the scope of role.
+// Must be called with lock held.
+func (memds *inMemoryDataStore)isRoleNameUnique(rl *Role) bool {
+    for bit, entry := range(memds.roles) {
+        if bit == rl.roleType || entry.name != rl.name {
+            continue
+        }
+        if syncParam.IsUUIDEmpty(entry.orgUUID) ||
+            entry.orgUUID == rl.orgUUID {
+            return false
+        }
+    }
+    return true
+}
+
+//Check the role bit can be granted in org/unit 'orgUUID'. Must be called with
+// lock held.
+func (memds *inMemoryDataStore)isRoleGrantableInOrg(bit RoleBit,
+                                         orgUUID syncParam.UUID) error {
+    entry, ok := memds.roles[bit]
+    if !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if syncParam.IsUUIDEmpty(entry.orgUUID) {
+        return nil
+    }
+    for org := memds.buildOrg(orgUUID); org != nil; org = org.parent {
+        if org.uuid == entry.orgUUID {
+            return nil
+        }
+    }
+    return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+}
+
+//Delete the role and revoke it from all users. Must be called with lock held.
+func (memds *inMemoryDataStore)deleteRoleRecords(bit RoleBit) {
+    for key := range(memds.memberships) {
+        if key.role == bit {
+            delete(memds.memberships, key)
+        }
+    }
+    delete(memds.roles, bit)
+}
+
+func (memds *inMemoryDataStore)CreateRole(rl *Role) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if rl.isRoleDefValid() == false {
+        memds.dblogger.Error("Cannot create role, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if !syncParam.IsUUIDEmpty(rl.orgUUID) {
+        if _, ok := memds.orgs[rl.orgUUID]; !ok {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    rl.roleType = 0
+    if !memds.isRoleNameUnique(rl) {
+        memds.dblogger.Info("Role %s is already present in system", rl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    for bit := ROOTADMIN << 1; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if _, ok := memds.roles[bit]; !ok {
+            rl.roleType = bit
+            break
+        }
+    }
+    if rl.roleType == 0 {
+        memds.dblogger.Error("Cannot create role %s, all role bits are in use",
+                             rl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.ROLE_LIMIT_REACHED])
+    }
+    rl.system = false
+    entry := new(Role)
+    copyRole(entry, rl)
+    memds.roles[rl.roleType] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetRole(rl *Role) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.roles[rl.roleType]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    copyRole(rl, entry)
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListRoles() ([]Role, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    roleList := make([]Role, 0, len(memds.roles))
+    for _, entry := range(memds.roles) {
+        var rl Role
+        copyRole(&rl, entry)
+        roleList = append(roleList, rl)
+    }
+    sort.Slice(roleList, func(i, j int) bool {
+        return roleList[i].roleType < roleList[j].roleType
+    })
+    return roleList, nil
+}
+
+func (memds *inMemoryDataStore)UpdateRole(rl *Role) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if rl.isRoleDefValid() == false {
+        memds.dblogger.Error("Cannot update role %d, invalid params",
+                             rl.roleType)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    entry, ok := memds.roles[rl.roleType]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if entry.system {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    //Scope of role cannot be changed.
+    rl.orgUUID = entry.orgUUID
+    rl.system = entry.system
+    if !memds.isRoleNameUnique(rl) {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    copyRole(entry, rl)
+    return nil
+}
+
+func (memds *inMemoryDataStore)DeleteRole(rl *Role) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.roles[rl.roleType]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    copyRole(rl, entry)
+    if entry.system {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    memds.deleteRoleRecords(rl.roleType)
+    return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+func (memds *inMemoryDataStore)CreateSession(sess *Session) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if sess.IsSessionValid() == false {
+        memds.dblogger.Error("Cannot create session, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.users[sess.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    sess.uuid = uuid
+    sess.createTime = time.Now()
+    entry := new(Session)
+    *entry = *sess
+    memds.sessions[uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetSession(sess *Session) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.sessions[sess.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *sess = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)RotateSession(sess *Session,
+                                             oldHash string) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if len(sess.refreshHash) == 0 || sess.expiryTime.IsZero() {
+        memds.dblogger.Error("Cannot rotate session, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    entry, ok := memds.sessions[sess.uuid]
+    if !ok || entry.status != SESSION_ACTIVE ||
+        entry.refreshHash != oldHash {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    entry.refreshHash = sess.refreshHash
+    entry.expiryTime = sess.expiryTime
+    return nil
+}
+
+func (memds *inMemoryDataStore)RevokeSession(sess *Session) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.sessions[sess.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    entry.status = SESSION_REVOKED
+    *sess = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)RevokeUserSessions(userid string) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    for _, entry := range(memds.sessions) {
+        if entry.userid == userid {
+            entry.status = SESSION_REVOKED
+        }
+    }
+    return nil
+}
+
+func (memds *inMemoryDataStore)DeleteExpiredSessions(before time.Time) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    for uuid, entry := range(memds.sessions) {
+        if entry.expiryTime.Before(before) {
+            delete(memds.sessions, uuid)
+        }
+    }
+    return nil
+}
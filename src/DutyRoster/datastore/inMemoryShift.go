@@ -0,0 +1,548 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Grant the role bits to user in org, role bits already granted are left as
+// is.
+func (memds *inMemoryDataStore)GrantUserOrgRole(member *UserOrgRole) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    return memds.grantUserOrgRole(member)
+}
+
+//Check the user and org of membership are present and the role bits can be
+// granted in the org. Must be called with lock held.
+func (memds *inMemoryDataStore)checkMembership(member *UserOrgRole) error {
+    if len(member.userid) == 0 || syncParam.IsUUIDEmpty(member.UUID()) ||
+        member.IsRoleBitsetValid() == false {
+        memds.dblogger.Error("Cannot grant/invite role, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.users[member.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if _, ok := memds.orgs[member.UUID()]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    for bit := ROOTADMIN << 1; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        err := memds.isRoleGrantableInOrg(bit, member.UUID())
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+//Grant the role bits of membership, must be called with lock held.
+func (memds *inMemoryDataStore)grantUserOrgRole(member *UserOrgRole) error {
+    err := memds.checkMembership(member)
+    if err != nil {
+        return err
+    }
+    grantTime := time.Now().UTC()
+    for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        key := memMembershipKey{member.userid, bit, member.UUID()}
+        if _, ok := memds.memberships[key]; !ok {
+            memds.memberships[key] = grantTime
+        }
+    }
+    return nil
+}
+
+//Revoke the role bits of user in org, nothing is revoked when any of the role
+// bit is not granted.
+func (memds *inMemoryDataStore)RevokeUserOrgRole(member *UserOrgRole) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if len(member.userid) == 0 || member.IsRoleBitsetValid() == false {
+        memds.dblogger.Error("Cannot revoke role, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        key := memMembershipKey{member.userid, bit, member.UUID()}
+        if _, ok := memds.memberships[key]; !ok {
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+        }
+    }
+    for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        delete(memds.memberships,
+               memMembershipKey{member.userid, bit, member.UUID()})
+    }
+    return nil
+}
+
+//List memberships that match the filter, role bits of same user and org are
+// merged into single entry. Must be called with lock held.
+func (memds *inMemoryDataStore)listMemberships(
+                    match func(memMembershipKey) bool) []UserOrgRole {
+    keys := []memMembershipKey{}
+    for key := range(memds.memberships) {
+        if match(key) {
+            keys = append(keys, key)
+        }
+    }
+    //Same order as the DB rows, user, org and then role.
+    sort.Slice(keys, func(i, j int) bool {
+        if keys[i].userid != keys[j].userid {
+            return keys[i].userid < keys[j].userid
+        }
+        orgi := syncParam.UUIDtoString(keys[i].orgUUID)
+        orgj := syncParam.UUIDtoString(keys[j].orgUUID)
+        if orgi != orgj {
+            return orgi < orgj
+        }
+        return keys[i].role < keys[j].role
+    })
+    rows := make([]dbUserOrgRole, 0, len(keys))
+    for _, key := range(keys) {
+        var row dbUserOrgRole
+        row.Userid = key.userid
+        row.RoleType = uint64(key.role)
+        row.OrgUuid = syncParam.UUIDtoString(key.orgUUID)
+        rows = append(rows, row)
+    }
+    return dbToMembershipRowsXlate(rows)
+}
+
+func (memds *inMemoryDataStore)ListUserMemberships(
+                                userid string) ([]UserOrgRole, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listMemberships(func(key memMembershipKey) bool {
+        return key.userid == userid
+    }), nil
+}
+
+func (memds *inMemoryDataStore)ListOrgMemberships(
+                                orgUUID syncParam.UUID) ([]UserOrgRole, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listMemberships(func(key memMembershipKey) bool {
+        return key.orgUUID == orgUUID
+    }), nil
+}
+
+//Roles of user in org, including the roles granted on the ancestors.
+func (memds *inMemoryDataStore)GetEffectiveRoles(userid string,
+                                orgUUID syncParam.UUID) (RoleBit, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.effectiveRoles(userid, orgUUID)
+}
+
+//Roles of the user in the org/unit and its parents. Must be called with lock
+// held.
+func (memds *inMemoryDataStore)effectiveRoles(userid string,
+                                orgUUID syncParam.UUID) (RoleBit, error) {
+    entry := memds.buildOrg(orgUUID)
+    if entry == nil {
+        return 0, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    var effective RoleBit
+    for ; entry != nil; entry = entry.parent {
+        for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+            key := memMembershipKey{userid, bit, entry.uuid}
+            if _, ok := memds.memberships[key]; ok {
+                effective |= bit
+            }
+        }
+    }
+    return effective, nil
+}
+
+func (memds *inMemoryDataStore)CreateShiftTemplate(
+                                            tmpl *ShiftTemplate) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if len(tmpl.name) >= SHIFT_NAME_STR_LEN ||
+        tmpl.IsShiftTemplateValid() == false {
+        memds.dblogger.Error("Cannot create shift template %s, invalid params",
+                             tmpl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[tmpl.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    var err error
+    tmpl.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    entry := new(ShiftTemplate)
+    *entry = *tmpl
+    memds.templates[tmpl.uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetShiftTemplate(tmpl *ShiftTemplate) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.templates[tmpl.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *tmpl = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListShiftTemplates(
+                        orgUUID syncParam.UUID) ([]ShiftTemplate, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    tmpls := []ShiftTemplate{}
+    for _, entry := range(memds.templates) {
+        if entry.orgUUID == orgUUID {
+            tmpls = append(tmpls, *entry)
+        }
+    }
+    sort.Slice(tmpls, func(i, j int) bool {
+        if tmpls[i].startOffset != tmpls[j].startOffset {
+            return tmpls[i].startOffset < tmpls[j].startOffset
+        }
+        return tmpls[i].name < tmpls[j].name
+    })
+    return tmpls, nil
+}
+
+//Delete the template, the shifts generated from it are kept.
+func (memds *inMemoryDataStore)DeleteShiftTemplate(
+                                            tmpl *ShiftTemplate) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if _, ok := memds.templates[tmpl.uuid]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    delete(memds.templates, tmpl.uuid)
+    memds.deleteTemplatePreferences(tmpl.uuid)
+    for _, shift := range(memds.shifts) {
+        if shift.templateUUID == tmpl.uuid {
+            shift.templateUUID = syncParam.UUID{}
+        }
+    }
+    for _, pat := range(memds.patterns) {
+        if pat.templateUUID == tmpl.uuid {
+            pat.templateUUID = syncParam.UUID{}
+        }
+    }
+    return nil
+}
+
+//Create a shift entry, must be called with lock held.
+func (memds *inMemoryDataStore)createShift(shift *Shift) error {
+    if shift.IsShiftValid() == false {
+        memds.dblogger.Error("Cannot create shift, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[shift.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if !syncParam.IsUUIDEmpty(shift.templateUUID) {
+        if _, ok := memds.templates[shift.templateUUID]; !ok {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    var err error
+    shift.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    shift.createTime = time.Now()
+    shift.sequence = 0
+    shift.modifyTime = shift.createTime
+    entry := new(Shift)
+    *entry = *shift
+    memds.shifts[shift.uuid] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)CreateShift(shift *Shift) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    return memds.createShift(shift)
+}
+
+func (memds *inMemoryDataStore)GetShift(shift *Shift) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.shifts[shift.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *shift = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListShifts(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]Shift, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    shifts := []Shift{}
+    for _, entry := range(memds.shifts) {
+        if entry.orgUUID == orgUUID && entry.startTime.Before(to) &&
+            entry.endTime.After(from) {
+            shifts = append(shifts, *entry)
+        }
+    }
+    sort.Slice(shifts, func(i, j int) bool {
+        return shifts[i].startTime.Before(shifts[j].startTime)
+    })
+    return shifts, nil
+}
+
+func (memds *inMemoryDataStore)ListUserShifts(userid string,
+                        from time.Time, to time.Time) ([]Shift, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    shifts := []Shift{}
+    for _, asgn := range(memds.assignments) {
+        entry := memds.shifts[asgn.shiftUUID]
+        if asgn.userid == userid && entry.startTime.Before(to) &&
+            entry.endTime.After(from) {
+            shifts = append(shifts, *entry)
+        }
+    }
+    sort.Slice(shifts, func(i, j int) bool {
+        return shifts[i].startTime.Before(shifts[j].startTime)
+    })
+    return shifts, nil
+}
+
+func (memds *inMemoryDataStore)CancelShift(shift *Shift) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.shifts[shift.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if !entry.IsCancelled() {
+        entry.status |= SHIFT_CANCELLED
+        entry.bumpRevision(time.Now())
+    }
+    *shift = *entry
+    return nil
+}
+
+//Create a roster assignment entry, must be called with lock held.
+func (memds *inMemoryDataStore)createRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    if asgn.IsRosterAssignmentValid() == false {
+        memds.dblogger.Error("Cannot create roster entry, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    shift, ok := memds.shifts[asgn.shiftUUID]
+    if !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if shift.orgUUID != asgn.orgUUID || shift.IsCancelled() {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    if _, ok := memds.users[asgn.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    for _, entry := range(memds.assignments) {
+        if entry.shiftUUID == asgn.shiftUUID && entry.userid == asgn.userid {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+        }
+    }
+    var err error
+    asgn.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    asgn.assignTime = time.Now()
+    entry := new(RosterAssignment)
+    *entry = *asgn
+    memds.assignments[asgn.uuid] = entry
+    shift.bumpRevision(asgn.assignTime)
+    return nil
+}
+
+func (memds *inMemoryDataStore)CreateRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    return memds.createRosterAssignment(asgn)
+}
+
+//All the checks and writes are done under one lock, the entries created so
+// far are deleted on a failure and no reader ever sees a partial roster.
+func (memds *inMemoryDataStore)CreateRoster(shifts []*Shift,
+                                            users [][]string) error {
+    if len(shifts) != len(users) {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    created := make([]Shift, len(shifts))
+    var err error
+    for i, shift := range(shifts) {
+        created[i] = *shift
+        err = memds.createShift(&created[i])
+        if err != nil {
+            created = created[:i]
+            break
+        }
+        for _, userid := range(users[i]) {
+            if len(memds.listUserLeave(userid, LEAVE_APPROVED,
+                            shift.startTime, shift.endTime)) != 0 {
+                err = fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.LEAVE_CONFLICT])
+                break
+            }
+            err = memds.checkSkillRequirement(userid, &created[i])
+            if err != nil {
+                break
+            }
+            asgn := NewRosterAssignment(created[i].uuid, shift.orgUUID,
+                                        userid)
+            err = memds.createRosterAssignment(asgn)
+            if err != nil {
+                break
+            }
+        }
+        if err != nil {
+            created = created[:i + 1]
+            break
+        }
+    }
+    if err != nil {
+        for _, shift := range(created) {
+            memds.deleteShiftEntry(shift.uuid)
+        }
+        return err
+    }
+    for i := range(shifts) {
+        *shifts[i] = *memds.shifts[created[i].uuid]
+    }
+    return nil
+}
+
+//Delete a shift and all of its assignments, must be called with lock held.
+func (memds *inMemoryDataStore)deleteShiftEntry(uuid syncParam.UUID) {
+    for key, asgn := range(memds.assignments) {
+        if asgn.shiftUUID == uuid {
+            delete(memds.assignments, key)
+        }
+    }
+    delete(memds.shifts, uuid)
+}
+
+func (memds *inMemoryDataStore)ListShiftRoster(
+                    shiftUUID syncParam.UUID) ([]RosterAssignment, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    asgns := []RosterAssignment{}
+    for _, entry := range(memds.assignments) {
+        if entry.shiftUUID == shiftUUID {
+            asgns = append(asgns, *entry)
+        }
+    }
+    sort.Slice(asgns, func(i, j int) bool {
+        return asgns[i].userid < asgns[j].userid
+    })
+    return asgns, nil
+}
+
+func (memds *inMemoryDataStore)ListUserRoster(userid string,
+                    from time.Time, to time.Time) ([]RosterAssignment, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    asgns := []RosterAssignment{}
+    for _, entry := range(memds.assignments) {
+        shift := memds.shifts[entry.shiftUUID]
+        if entry.userid == userid && shift.startTime.Before(to) &&
+            shift.endTime.After(from) {
+            asgns = append(asgns, *entry)
+        }
+    }
+    sort.Slice(asgns, func(i, j int) bool {
+        return memds.shifts[asgns[i].shiftUUID].startTime.Before(
+                    memds.shifts[asgns[j].shiftUUID].startTime)
+    })
+    return asgns, nil
+}
+
+func (memds *inMemoryDataStore)GetRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.assignments[asgn.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *asgn = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)DeleteRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    entry, ok := memds.assignments[asgn.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    memds.deleteAssignmentOffers(asgn.uuid)
+    delete(memds.assignments, asgn.uuid)
+    if shift, ok := memds.shifts[entry.shiftUUID]; ok {
+        shift.bumpRevision(time.Now())
+    }
+    return nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Key of a skill record, a user holds a skill only once.
+type memUserSkillKey struct {
+    userid string
+    name string
+}
+
+//List the skills of a user ordered on name. Must be called with lock held.
+func (memds *inMemoryDataStore)listUserSkills(userid string) []UserSkill {
+    skills := []UserSkill{}
+    for key, skill := range(memds.userSkills) {
+        if key.userid == userid {
+            skills = append(skills, *skill)
+        }
+    }
+    sortUserSkills(skills)
+    return skills
+}
+
+//Skills required by the template of the shift, nil for an adhoc shift or
+// when the template is deleted. Must be called with lock held.
+func (memds *inMemoryDataStore)shiftSkills(shift *Shift) []string {
+    if syncParam.IsUUIDEmpty(shift.templateUUID) {
+        return nil
+    }
+    tmpl, ok := memds.templates[shift.templateUUID]
+    if !ok {
+        return nil
+    }
+    return tmpl.skills
+}
+
+//Check the user holds the skills required for the shift. Must be called with
+// lock held.
+func (memds *inMemoryDataStore)checkSkillRequirement(userid string,
+                                                     shift *Shift) error {
+    if !HoldsSkills(memds.listUserSkills(userid), memds.shiftSkills(shift),
+                    shift.startTime, shift.endTime) {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SKILL_REQUIREMENT_NOT_MET])
+    }
+    return nil
+}
+
+func (memds *inMemoryDataStore)SetUserSkill(skill *UserSkill) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if skill.IsUserSkillValid() == false {
+        memds.dblogger.Error("Cannot set skill %s of user %s, invalid params",
+                             skill.name, skill.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.users[skill.userid]; !ok {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    skill.modifyTime = time.Now()
+    entry := new(UserSkill)
+    *entry = *skill
+    memds.userSkills[memUserSkillKey{userid : skill.userid,
+                                     name : skill.name}] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetUserSkill(skill *UserSkill) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.userSkills[memUserSkillKey{userid : skill.userid,
+                                                  name : skill.name}]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *skill = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListUserSkills(
+                                userid string) ([]UserSkill, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listUserSkills(userid), nil
+}
+
+func (memds *inMemoryDataStore)DeleteUserSkill(skill *UserSkill) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    key := memUserSkillKey{userid : skill.userid, name : skill.name}
+    entry, ok := memds.userSkills[key]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *skill = *entry
+    delete(memds.userSkills, key)
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListQualifiedUsers(orgUUID syncParam.UUID,
+                                skills []string, from time.Time,
+                                to time.Time) ([]string, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    org := memds.buildOrg(orgUUID)
+    if org == nil {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    chain := map[syncParam.UUID]bool{}
+    for ; org != nil; org = org.parent {
+        chain[org.uuid] = true
+    }
+    userids := map[string]bool{}
+    for key := range(memds.memberships) {
+        if chain[key.orgUUID] {
+            userids[key.userid] = true
+        }
+    }
+    skills = NormalizeSkillNames(skills)
+    now := time.Now()
+    qualified := []string{}
+    for userid := range(userids) {
+        user, ok := memds.users[userid]
+        if !ok || user.IsInactive(now) {
+            continue
+        }
+        if HoldsSkills(memds.listUserSkills(userid), skills, from, to) {
+            qualified = append(qualified, userid)
+        }
+    }
+    sort.Strings(qualified)
+    return qualified, nil
+}
+
+func (memds *inMemoryDataStore)ListExpiringSkills(orgUUID syncParam.UUID,
+                                from time.Time,
+                                to time.Time) ([]UserSkill, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    if _, ok := memds.orgs[orgUUID]; !ok {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    subtree := map[syncParam.UUID]bool{}
+    pending := []syncParam.UUID{orgUUID}
+    for len(pending) != 0 {
+        uuid := pending[len(pending) - 1]
+        pending = pending[:len(pending) - 1]
+        subtree[uuid] = true
+        pending = append(pending, memds.childOrgUUIDs(uuid)...)
+    }
+    userids := map[string]bool{}
+    for key := range(memds.memberships) {
+        if subtree[key.orgUUID] {
+            userids[key.userid] = true
+        }
+    }
+    skills := []UserSkill{}
+    for key, skill := range(memds.userSkills) {
+        if !userids[key.userid] || skill.expiryTime.IsZero() ||
+            skill.expiryTime.Before(from) || !skill.expiryTime.Before(to) {
+            continue
+        }
+        skills = append(skills, *skill)
+    }
+    sortSkillsOnExpiry(skills)
+    return skills, nil
+}
+
+func (memds *inMemoryDataStore)CheckSkillRequirement(userid string,
+                                                     shift *Shift) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.checkSkillRequirement(userid, shift)
+}
@@ -0,0 +1,391 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Get the swap rules in effect for org/unit, zero rules when no org/unit in
+// the parent chain has the rules. Must be called with lock held.
+func (memds *inMemoryDataStore)getSwapSettings(
+                                orgUUID syncParam.UUID) (*SwapSettings, error) {
+    org := memds.buildOrg(orgUUID)
+    if org == nil {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    for entry := org; entry != nil; entry = entry.parent {
+        if settings, ok := memds.swapSettings[entry.uuid]; ok {
+            return &SwapSettings{orgUUID : orgUUID,
+                                 minRest : settings.minRest,
+                                 approverRole : settings.approverRole}, nil
+        }
+    }
+    return NewSwapSettingsRef(orgUUID), nil
+}
+
+//Delete the swap offers of an assignment. Audit records are kept. Must be
+// called with lock held.
+func (memds *inMemoryDataStore)deleteAssignmentOffers(
+                                asgnUUID syncParam.UUID) {
+    for uuid, offer := range(memds.swapOffers) {
+        if offer.assignmentUUID == asgnUUID ||
+            offer.targetAssignmentUUID == asgnUUID {
+            delete(memds.swapOffers, uuid)
+        }
+    }
+}
+
+//Get the assignment and its shift, the shift must not be cancelled or
+// started at 'now'. Must be called with lock held.
+func (memds *inMemoryDataStore)getTradableAssignment(asgnUUID syncParam.UUID,
+                                now time.Time) (*RosterAssignment, *Shift,
+                                error) {
+    asgn, ok := memds.assignments[asgnUUID]
+    if !ok {
+        return nil, nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    shift := memds.shifts[asgn.shiftUUID]
+    if shift.IsCancelled() || !shift.startTime.After(now) {
+        return nil, nil, fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_INVALID_TRANSITION])
+    }
+    return asgn, shift, nil
+}
+
+//Check user can take the shift after giving away the assignment 'givenUUID',
+// if any. The user must hold the skills required for the shift. Must be
+// called with lock held.
+func (memds *inMemoryDataStore)isShiftTakeable(userid string, shift *Shift,
+                                givenUUID syncParam.UUID,
+                                minRest time.Duration) error {
+    if len(memds.listUserLeave(userid, LEAVE_APPROVED, shift.startTime,
+                               shift.endTime)) != 0 {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.LEAVE_CONFLICT])
+    }
+    err := memds.checkSkillRequirement(userid, shift)
+    if err != nil {
+        return err
+    }
+    from := shift.startTime.Add(-minRest)
+    to := shift.endTime.Add(minRest)
+    shifts := []Shift{}
+    for _, asgn := range(memds.assignments) {
+        if asgn.userid != userid || asgn.uuid == givenUUID {
+            continue
+        }
+        entry := memds.shifts[asgn.shiftUUID]
+        if entry.startTime.Before(to) && entry.endTime.After(from) {
+            shifts = append(shifts, *entry)
+        }
+    }
+    if !isTradeValid(shifts, shift, minRest) {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_RULE_VIOLATION])
+    }
+    return nil
+}
+
+//Validate the trade of offer to user 'takenBy' against the current roster.
+//Returns the assignments that change hands, target is nil when the offer is
+// not a direct swap. Must be called with lock held.
+func (memds *inMemoryDataStore)checkTrade(offer *SwapOffer,
+                                takenBy string) (*RosterAssignment,
+                                *RosterAssignment, error) {
+    now := time.Now()
+    asgn, shift, err := memds.getTradableAssignment(offer.assignmentUUID, now)
+    if err != nil {
+        return nil, nil, err
+    }
+    notEligible := fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_NOT_ELIGIBLE])
+    if asgn.userid != offer.offeredBy || takenBy == offer.offeredBy {
+        return nil, nil, notEligible
+    }
+    roles, err := memds.effectiveRoles(takenBy, offer.orgUUID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if roles == 0 {
+        return nil, nil, notEligible
+    }
+    settings, err := memds.getSwapSettings(offer.orgUUID)
+    if err != nil {
+        return nil, nil, err
+    }
+    var target *RosterAssignment
+    var givenUUID syncParam.UUID
+    switch(offer.kind) {
+        case SWAP_DIRECT:
+            var targetShift *Shift
+            target, targetShift, err = memds.getTradableAssignment(
+                                            offer.targetAssignmentUUID, now)
+            if err != nil {
+                return nil, nil, err
+            }
+            if target.userid != takenBy {
+                return nil, nil, notEligible
+            }
+            givenUUID = target.uuid
+            err = memds.isShiftTakeable(offer.offeredBy, targetShift,
+                                        asgn.uuid, settings.minRest)
+            if err != nil {
+                return nil, nil, err
+            }
+        case SWAP_PICKUP:
+            if !IsUserAvailable(memds.listUserAvailability(takenBy),
+                                shift.startTime, shift.endTime,
+                                memds.orgLocation(shift.orgUUID)) {
+                return nil, nil, notEligible
+            }
+    }
+    err = memds.isShiftTakeable(takenBy, shift, givenUUID, settings.minRest)
+    if err != nil {
+        return nil, nil, err
+    }
+    return asgn, target, nil
+}
+
+//Record the current status of the offer in audit. Must be called with lock
+// held.
+func (memds *inMemoryDataStore)createSwapAudit(offer *SwapOffer,
+                                actor string, note string) error {
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    memds.swapAudit[uuid] = &SwapAudit{uuid : uuid, offerUUID : offer.uuid,
+                                       orgUUID : offer.orgUUID,
+                                       status : offer.status, actor : actor,
+                                       auditTime : time.Now(), note : note}
+    return nil
+}
+
+//List the audit records that matches 'filter' sorted on time, same as the
+// DB rows. Must be called with lock held.
+func (memds *inMemoryDataStore)listSwapAudit(
+                                filter func(*SwapAudit) bool) []SwapAudit {
+    audits := []SwapAudit{}
+    for _, audit := range(memds.swapAudit) {
+        if filter(audit) {
+            audits = append(audits, *audit)
+        }
+    }
+    sort.Slice(audits, func(i, j int) bool {
+        return audits[i].auditTime.Before(audits[j].auditTime)
+    })
+    return audits
+}
+
+func (memds *inMemoryDataStore)SetSwapSettings(settings *SwapSettings) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if settings.IsSwapSettingsValid() == false {
+        memds.dblogger.Error("Cannot set swap settings, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if _, ok := memds.orgs[settings.orgUUID]; !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if settings.approverRole != 0 {
+        err := memds.isRoleGrantableInOrg(settings.approverRole,
+                                          settings.orgUUID)
+        if err != nil {
+            return err
+        }
+    }
+    //Rest time is kept in seconds same as the DB rows.
+    settings.minRest = settings.minRest.Truncate(time.Second)
+    entry := new(SwapSettings)
+    *entry = *settings
+    memds.swapSettings[settings.orgUUID] = entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)GetSwapSettings(settings *SwapSettings) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, err := memds.getSwapSettings(settings.orgUUID)
+    if err != nil {
+        return err
+    }
+    *settings = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)CreateSwapOffer(offer *SwapOffer) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    offer.status = SWAP_OPEN
+    if offer.IsSwapOfferValid() == false {
+        memds.dblogger.Error("Cannot create swap offer, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    now := time.Now()
+    asgn, shift, err := memds.getTradableAssignment(offer.assignmentUUID, now)
+    if err != nil {
+        return err
+    }
+    if asgn.userid != offer.offeredBy {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    if offer.kind == SWAP_DIRECT {
+        target, targetShift, err := memds.getTradableAssignment(
+                                            offer.targetAssignmentUUID, now)
+        if err != nil {
+            return err
+        }
+        if target.orgUUID != asgn.orgUUID ||
+            target.userid == offer.offeredBy ||
+            targetShift.uuid == shift.uuid {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+        }
+    }
+    for _, entry := range(memds.swapOffers) {
+        if entry.assignmentUUID == asgn.uuid && entry.IsPending() {
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+        }
+    }
+    settings, err := memds.getSwapSettings(asgn.orgUUID)
+    if err != nil {
+        return err
+    }
+    offer.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    offer.orgUUID = asgn.orgUUID
+    offer.approverRole = settings.approverRole
+    offer.createTime = now
+    offer.takenBy = ""
+    offer.decidedBy = ""
+    offer.decideTime = time.Time{}
+    entry := new(SwapOffer)
+    *entry = *offer
+    memds.swapOffers[offer.uuid] = entry
+    return memds.createSwapAudit(entry, offer.offeredBy, "")
+}
+
+func (memds *inMemoryDataStore)GetSwapOffer(offer *SwapOffer) error {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    entry, ok := memds.swapOffers[offer.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    *offer = *entry
+    return nil
+}
+
+func (memds *inMemoryDataStore)ListOrgSwapOffers(orgUUID syncParam.UUID,
+                        status SwapStatusBit) ([]SwapOffer, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    offers := []SwapOffer{}
+    for _, offer := range(memds.swapOffers) {
+        if offer.orgUUID == orgUUID && offer.status == status {
+            offers = append(offers, *offer)
+        }
+    }
+    sort.Slice(offers, func(i, j int) bool {
+        return offers[i].createTime.Before(offers[j].createTime)
+    })
+    return offers, nil
+}
+
+func (memds *inMemoryDataStore)UpdateSwapStatus(offer *SwapOffer,
+                        status SwapStatusBit, userid string,
+                        note string) error {
+    memds.lock.Lock()
+    defer memds.lock.Unlock()
+    if len(note) >= SWAP_NOTE_STR_LEN {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    entry, ok := memds.swapOffers[offer.uuid]
+    if !ok {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if !IsSwapTransitionValid(entry.status, status, entry.approverRole) {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_INVALID_TRANSITION])
+    }
+    takenBy := entry.takenBy
+    if entry.status == SWAP_OPEN && status != SWAP_CANCELLED {
+        takenBy = userid
+    }
+    if status == SWAP_ACCEPTED || status == SWAP_COMPLETED {
+        asgn, target, err := memds.checkTrade(entry, takenBy)
+        if err != nil {
+            return err
+        }
+        if status == SWAP_COMPLETED {
+            now := time.Now()
+            asgn.userid = takenBy
+            asgn.assignTime = now
+            memds.shifts[asgn.shiftUUID].bumpRevision(now)
+            if target != nil {
+                target.userid = entry.offeredBy
+                target.assignTime = now
+                memds.shifts[target.shiftUUID].bumpRevision(now)
+            }
+        }
+    }
+    if status != SWAP_ACCEPTED {
+        entry.decideTime = time.Now()
+        if status != SWAP_COMPLETED || entry.status == SWAP_ACCEPTED {
+            entry.decidedBy = userid
+        }
+    }
+    entry.takenBy = takenBy
+    entry.status = status
+    *offer = *entry
+    return memds.createSwapAudit(entry, userid, note)
+}
+
+func (memds *inMemoryDataStore)ListSwapAudit(
+                        offerUUID syncParam.UUID) ([]SwapAudit, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listSwapAudit(func(audit *SwapAudit) bool {
+        return audit.offerUUID == offerUUID
+    }), nil
+}
+
+func (memds *inMemoryDataStore)ListOrgSwapAudit(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]SwapAudit, error) {
+    memds.lock.RLock()
+    defer memds.lock.RUnlock()
+    return memds.listSwapAudit(func(audit *SwapAudit) bool {
+        return audit.orgUUID == orgUUID && !audit.auditTime.Before(from) &&
+               audit.auditTime.Before(to)
+    }), nil
+}
@@ -0,0 +1,364 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "sync"
+    "strings"
+    "testing"
+    "DutyRoster/config"
+    "DutyRoster/credentials"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Use the in-memory datastore with cheap password hash params.
+func setupMemoryDataStore(t *testing.T, algorithm string) {
+    cfg := config.GetConfigInstance()
+    cfg.DB.Driver = MEMORY_DB_DRIVER
+    cfg.Credentials.Algorithm = algorithm
+    cfg.Credentials.BcryptCost = 4
+    cfg.Credentials.Argon2Time = 1
+    cfg.Credentials.Argon2Memory = 1024
+    cfg.Credentials.Argon2Threads = 1
+    dbObj := GetDataStoreObj()
+    err := dbObj.CreateDBConnection()
+    if err != nil {
+        t.Fatalf("Cannot connect to in-memory datastore, %s", err)
+    }
+    dbObj.InitDataStore()
+}
+
+//Create the user with the password hashed by 'algorithm'.
+func newTestAccount(t *testing.T, userid string, password string,
+                    algorithm string) {
+    setupMemoryDataStore(t, algorithm)
+    hash, err := credentials.HashPassword(password)
+    if err != nil {
+        t.Fatalf("Cannot hash password, %s", err)
+    }
+    user := NewUser(userid, userid + "@test", hash, "1", time.Time{},
+                    USER_APPROVED, 0)
+    err = GetDataStoreObj().CreateUserAccount(user)
+    if err != nil {
+        t.Fatalf("Cannot create user %s, %s", userid, err)
+    }
+}
+
+func storedHash(t *testing.T, userid string) string {
+    user := NewUserRef(userid)
+    err := GetDataStoreObj().GetUser(user)
+    if err != nil {
+        t.Fatalf("Cannot get user %s, %s", userid, err)
+    }
+    return user.hashpwd
+}
+
+func TestGetUserAccount(t *testing.T) {
+    invalid := errorset.ERROR_TYPES[errorset.INVALID_CREDENTIALS]
+    tests := []struct {
+        name string
+        userid string
+        password string
+        //Algorithm of the stored hash and the configured one at login.
+        hashAlgorithm string
+        loginAlgorithm string
+        err string
+        rehashPrefix string
+    }{
+        {"valid", "cred-valid", "secret", credentials.ARGON2ID_ALGORITHM,
+         credentials.ARGON2ID_ALGORITHM, "", ""},
+        {"wrong password", "cred-wrong", "Secret",
+         credentials.ARGON2ID_ALGORITHM, credentials.ARGON2ID_ALGORITHM,
+         invalid, ""},
+        {"unknown user", "", "secret", credentials.ARGON2ID_ALGORITHM,
+         credentials.ARGON2ID_ALGORITHM, invalid, ""},
+        {"rehash to argon2id", "cred-rehash-argon2", "secret",
+         credentials.BCRYPT_ALGORITHM, credentials.ARGON2ID_ALGORITHM, "",
+         "$argon2id$"},
+        {"rehash to bcrypt", "cred-rehash-bcrypt", "secret",
+         credentials.ARGON2ID_ALGORITHM, credentials.BCRYPT_ALGORITHM, "",
+         "$2a$"},
+    }
+    cfg := config.GetConfigInstance()
+    savedConfig := cfg.Credentials
+    defer func() { cfg.Credentials = savedConfig }()
+    for _, test := range(tests) {
+        userid := test.userid
+        if len(userid) == 0 {
+            setupMemoryDataStore(t, test.loginAlgorithm)
+            userid = "cred-unknown"
+        } else {
+            newTestAccount(t, userid, "secret", test.hashAlgorithm)
+        }
+        var oldHash string
+        if len(test.userid) != 0 {
+            oldHash = storedHash(t, userid)
+        }
+        setupMemoryDataStore(t, test.loginAlgorithm)
+        user := NewUserRef(userid)
+        err := GetDataStoreObj().GetUserAccount(user, test.password)
+        if len(test.err) != 0 {
+            if err == nil || err.Error() != test.err {
+                t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+            }
+            if len(test.userid) != 0 && storedHash(t, userid) != oldHash {
+                t.Errorf("%s: hash changed on failed login", test.name)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        if user.Emailid() != userid + "@test" {
+            t.Errorf("%s: got account %s, want %s", test.name,
+                     user.Emailid(), userid + "@test")
+        }
+        newHash := storedHash(t, userid)
+        if len(test.rehashPrefix) == 0 {
+            if newHash != oldHash {
+                t.Errorf("%s: hash changed without rehash", test.name)
+            }
+            continue
+        }
+        if !strings.HasPrefix(newHash, test.rehashPrefix) ||
+            user.hashpwd != newHash {
+            t.Errorf("%s: got hash %s, want prefix %s", test.name, newHash,
+                     test.rehashPrefix)
+        }
+        //The new hash verifies the same password.
+        err = GetDataStoreObj().GetUserAccount(NewUserRef(userid), "secret")
+        if err != nil {
+            t.Errorf("%s: login after rehash, %s", test.name, err)
+        }
+    }
+}
+
+//Create an approved org, the parent is looked up by name.
+func newTestOrg(t *testing.T, name string, parent *Org) *Org {
+    or := NewOrg(name, "addr", parent, ORG_APPROVED, 0)
+    err := GetDataStoreObj().CreateOrg(or)
+    if err != nil {
+        t.Fatalf("Cannot create org %s, %s", name, err)
+    }
+    return or
+}
+
+//Errors of the user, org and membership records must be the predefined DB
+// errors, the REST layer maps them to the status codes.
+func TestRecordErrors(t *testing.T) {
+    cfg := config.GetConfigInstance()
+    savedConfig := cfg.Credentials
+    defer func() { cfg.Credentials = savedConfig }()
+    setupMemoryDataStore(t, credentials.BCRYPT_ALGORITHM)
+    dbObj := GetDataStoreObj()
+    user := NewUser("rec-user", "rec-user@test", "hash", "1", time.Time{},
+                    USER_APPROVED, 0)
+    err := dbObj.CreateUserAccount(user)
+    if err != nil {
+        t.Fatalf("Cannot create user, %s", err)
+    }
+    root := newTestOrg(t, "rec-org", nil)
+    unit := newTestOrg(t, "rec-unit", NewOrg("rec-org", "addr", nil, 0, 0))
+    err = dbObj.GrantUserOrgRole(NewUserOrgRole("rec-user", ENDUSER,
+                                                root.UUID()))
+    if err != nil {
+        t.Fatalf("Cannot grant role, %s", err)
+    }
+    unknownUUID := syncParam.UUID{1}
+    approved := func(or *Org) *Org {
+        or.SetStatus(ORG_APPROVED)
+        return or
+    }
+    tests := []struct {
+        name string
+        op func() error
+        wantErr int
+    }{
+        //Users
+        {"duplicate user", func() error {
+            return dbObj.CreateUserAccount(NewUser("rec-user", "e", "h", "1",
+                                           time.Time{}, USER_APPROVED, 0))
+         }, errorset.DB_RECORD_NOT_UNIQUE},
+        {"get unknown user", func() error {
+            return dbObj.GetUser(NewUserRef("rec-nouser"))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"update unknown user", func() error {
+            return dbObj.UpdateUserAccount(NewUser("rec-nouser", "e", "h", "1",
+                                           time.Time{}, USER_APPROVED, 0))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        //Orgs
+        {"duplicate org", func() error {
+            return dbObj.CreateOrg(NewOrg("rec-org", "addr", nil,
+                                          ORG_APPROVED, 0))
+         }, errorset.DB_RECORD_NOT_UNIQUE},
+        {"duplicate unit", func() error {
+            return dbObj.CreateOrg(NewOrg("rec-unit", "addr",
+                            NewOrgRef(root.UUID()), ORG_APPROVED, 0))
+         }, errorset.DB_RECORD_NOT_UNIQUE},
+        {"unit of unknown org", func() error {
+            return dbObj.CreateOrg(NewOrg("rec-unit", "addr",
+                            NewOrgRef(unknownUUID), ORG_APPROVED, 0))
+         }, errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"org of unknown admin", func() error {
+            return dbObj.CreateOrgWithAdmin(NewOrg("rec-org2", "addr", nil,
+                                            ORG_APPROVED, 0), "rec-nouser")
+         }, errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"get unknown org", func() error {
+            return dbObj.GetOrg(NewOrgRef(unknownUUID))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"get unknown org by name", func() error {
+            return dbObj.GetOrg(NewOrg("rec-unit", "addr", nil, 0, 0))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"update unknown org", func() error {
+            return dbObj.UpdateOrg(approved(NewOrgRef(unknownUUID)))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"delete unknown org", func() error {
+            return dbObj.DeleteOrg(NewOrgRef(unknownUUID))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        //Memberships
+        {"grant to unknown user", func() error {
+            return dbObj.GrantUserOrgRole(NewUserOrgRole("rec-nouser",
+                                          ENDUSER, root.UUID()))
+         }, errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"grant in unknown org", func() error {
+            return dbObj.GrantUserOrgRole(NewUserOrgRole("rec-user",
+                                          ENDUSER, unknownUUID))
+         }, errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"revoke role not granted", func() error {
+            return dbObj.RevokeUserOrgRole(NewUserOrgRole("rec-user",
+                                           ENDUSER | MANAGER, root.UUID()))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"revoke in other unit", func() error {
+            return dbObj.RevokeUserOrgRole(NewUserOrgRole("rec-user",
+                                           ENDUSER, unit.UUID()))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"roles in unknown org", func() error {
+            _, err := dbObj.GetEffectiveRoles("rec-user", unknownUUID)
+            return err
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"invite unknown user", func() error {
+            return dbObj.CreateMembershipInvite(NewUserOrgRole("rec-nouser",
+                                                ENDUSER, root.UUID()))
+         }, errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"invite in unknown org", func() error {
+            return dbObj.CreateMembershipInvite(NewUserOrgRole("rec-user",
+                                                ENDUSER, unknownUUID))
+         }, errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"accept missing invite", func() error {
+            return dbObj.AcceptMembershipInvite(NewUserOrgRole("rec-user", 0,
+                                                unit.UUID()))
+         }, errorset.DB_RECORD_NOT_FOUND},
+        {"delete missing invite", func() error {
+            return dbObj.DeleteMembershipInvite(NewUserOrgRole("rec-user", 0,
+                                                unit.UUID()))
+         }, errorset.DB_RECORD_NOT_FOUND},
+    }
+    for _, test := range(tests) {
+        err := test.op()
+        if err == nil || err.Error() != errorset.ERROR_TYPES[test.wantErr] {
+            t.Errorf("%s: got error %v, want %s", test.name, err,
+                     errorset.ERROR_TYPES[test.wantErr])
+        }
+    }
+    //Failed operations must leave the records as is.
+    roles, err := dbObj.GetEffectiveRoles("rec-user", unit.UUID())
+    if err != nil || roles != ENDUSER {
+        t.Errorf("got roles %v, %v, want %v", roles, err, ENDUSER)
+    }
+    //Records of deleted user are not found.
+    err = dbObj.DeleteUserAccount(user)
+    if err != nil {
+        t.Fatalf("Cannot delete user, %s", err)
+    }
+    err = dbObj.GetUser(NewUserRef("rec-user"))
+    if err == nil ||
+        err.Error() != errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND] {
+        t.Errorf("get deleted user: got error %v, want not found", err)
+    }
+    members, err := dbObj.ListOrgMemberships(root.UUID())
+    if err != nil || len(members) != 0 {
+        t.Errorf("got memberships %v, %v of deleted user", members, err)
+    }
+}
+
+//Run with -race, the datastore is shared by all the request handlers.
+func TestConcurrentAccess(t *testing.T) {
+    const workers = 8
+    const rounds = 20
+    cfg := config.GetConfigInstance()
+    savedConfig := cfg.Credentials
+    defer func() { cfg.Credentials = savedConfig }()
+    setupMemoryDataStore(t, credentials.BCRYPT_ALGORITHM)
+    dbObj := GetDataStoreObj()
+    root := newTestOrg(t, "conc-org", nil)
+    var wg sync.WaitGroup
+    errs := make(chan error, workers * rounds)
+    //Only one of the concurrent creates of an org succeeds.
+    created := make(chan bool, workers)
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func(w int) {
+            defer wg.Done()
+            err := dbObj.CreateOrg(NewOrg("conc-unit", "addr",
+                                    NewOrgRef(root.UUID()), ORG_APPROVED, 0))
+            if err == nil {
+                created <- true
+            } else if err.Error() !=
+                errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE] {
+                errs <- err
+            }
+            for i := 0; i < rounds; i++ {
+                userid := fmt.Sprintf("conc-%d-%d", w, i)
+                err := dbObj.CreateUserAccount(NewUser(userid, "e", "h", "1",
+                                               time.Time{}, USER_APPROVED, 0))
+                if err == nil {
+                    err = dbObj.GrantUserOrgRole(NewUserOrgRole(userid,
+                                                 ENDUSER, root.UUID()))
+                }
+                if err == nil {
+                    _, err = dbObj.GetEffectiveRoles(userid, root.UUID())
+                }
+                if err == nil {
+                    _, err = dbObj.ListOrgMemberships(root.UUID())
+                }
+                if err == nil && i % 2 == 1 {
+                    err = dbObj.DeleteUserAccount(NewUserRef(userid))
+                }
+                if err != nil {
+                    errs <- fmt.Errorf("%s: %s", userid, err)
+                }
+            }
+        }(w)
+    }
+    wg.Wait()
+    close(errs)
+    close(created)
+    for err := range(errs) {
+        t.Error(err)
+    }
+    if len(created) != 1 {
+        t.Errorf("got %d units created, want 1", len(created))
+    }
+    members, err := dbObj.ListOrgMemberships(root.UUID())
+    if err != nil || len(members) != workers * rounds / 2 {
+        t.Errorf("got %d members, %v, want %d", len(members), err,
+                 workers * rounds / 2)
+    }
+}
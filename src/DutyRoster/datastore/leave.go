@@ -0,0 +1,326 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "time"
+    "DutyRoster/syncParam"
+)
+
+//Status of a leave request, in the same order as the user and org status.
+type LeaveStatusBit uint64
+
+const (
+    LEAVE_REQUESTED LeaveStatusBit = 1 << iota
+    LEAVE_APPROVED LeaveStatusBit = 1 << iota
+    LEAVE_REJECTED LeaveStatusBit = 1 << iota
+    //Last entry in the leave status. Do not add anything below cancel status.
+    LEAVE_CANCELLED LeaveStatusBit = 1 << iota
+)
+
+//Kind of leave, an org/unit can have any number of policies of each kind.
+type LeaveKindBit uint64
+
+const (
+    LEAVE_ANNUAL LeaveKindBit = 1 << iota
+    LEAVE_SICK LeaveKindBit = 1 << iota
+    //Unpaid leave has no balance.
+    LEAVE_UNPAID LeaveKindBit = 1 << iota
+    //Last entry in the leave kind. Leave types defined by the org/unit.
+    LEAVE_CUSTOM LeaveKindBit = 1 << iota
+)
+
+//Maximum length of leave policy name and leave request note.
+const LEAVE_NAME_STR_LEN = 500
+
+//Leave type of an org/unit with its accrual rule. The policy applies to the
+// members of the org/unit and its descendants.
+type LeavePolicy struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    name string
+    kind LeaveKindBit
+    //Balance added for every full month since the last accrual.
+    accrual time.Duration
+    //Accrual stops when the balance reaches the maximum, 0 for no limit.
+    maxBalance time.Duration
+    //Requests are charged against the balance only when tracked.
+    tracked bool
+}
+
+//Leave balance of a user for a leave policy.
+type LeaveBalance struct {
+    userid string
+    policyUUID syncParam.UUID
+    balance time.Duration
+    //Accrual is done until this time, always on a month boundary from the
+    // creation of balance.
+    lastAccrual time.Time
+}
+
+//Leave request of a user. The request is made in an org/unit, the approvers
+// of the org/unit decide on it.
+type LeaveRequest struct {
+    uuid syncParam.UUID
+    userid string
+    orgUUID syncParam.UUID
+    policyUUID syncParam.UUID
+    //User is on leave in the period [startTime, endTime).
+    startTime time.Time
+    endTime time.Time
+    //Amount charged to the balance when approved.
+    charge time.Duration
+    status LeaveStatusBit
+    note string
+    //timestamp when the request is created.
+    createTime time.Time
+    //userid of the user who approved/rejected/cancelled the request.
+    decidedBy string
+    decideTime time.Time
+}
+
+//Create a leave policy for org/unit 'orgUUID'. Unpaid leave is never tracked.
+//uuid is populated when the policy is created in the datastore.
+func NewLeavePolicy(orgUUID syncParam.UUID, name string, kind LeaveKindBit,
+                    accrual time.Duration, maxBalance time.Duration,
+                    tracked bool) *LeavePolicy {
+    policy := new(LeavePolicy)
+    policy.orgUUID = orgUUID
+    policy.name = name
+    policy.kind = kind
+    policy.accrual = accrual
+    policy.maxBalance = maxBalance
+    policy.tracked = tracked && kind != LEAVE_UNPAID
+    return policy
+}
+
+//Leave policy that only carries the uuid, used to get/delete the policy.
+func NewLeavePolicyRef(uuid syncParam.UUID) *LeavePolicy {
+    policy := new(LeavePolicy)
+    policy.uuid = uuid
+    return policy
+}
+
+func (policy *LeavePolicy)UUID() syncParam.UUID {
+    return policy.uuid
+}
+
+func (policy *LeavePolicy)OrgUUID() syncParam.UUID {
+    return policy.orgUUID
+}
+
+func (policy *LeavePolicy)Name() string {
+    return policy.name
+}
+
+func (policy *LeavePolicy)Kind() LeaveKindBit {
+    return policy.kind
+}
+
+func (policy *LeavePolicy)Accrual() time.Duration {
+    return policy.accrual
+}
+
+func (policy *LeavePolicy)MaxBalance() time.Duration {
+    return policy.maxBalance
+}
+
+func (policy *LeavePolicy)IsTracked() bool {
+    return policy.tracked
+}
+
+//Validate the policy fields before storing it.
+func (policy *LeavePolicy)IsLeavePolicyValid() bool {
+    if syncParam.IsUUIDEmpty(policy.orgUUID) || len(policy.name) == 0 ||
+        len(policy.name) >= LEAVE_NAME_STR_LEN || policy.accrual < 0 ||
+        policy.maxBalance < 0 {
+        return false
+    }
+    switch(policy.kind) {
+        case LEAVE_ANNUAL, LEAVE_SICK, LEAVE_UNPAID, LEAVE_CUSTOM:
+            return !(policy.kind == LEAVE_UNPAID && policy.tracked)
+    }
+    return false
+}
+
+//Leave balance of user 'userid' for policy 'policyUUID', used to get the
+// balance.
+func NewLeaveBalanceRef(userid string,
+                        policyUUID syncParam.UUID) *LeaveBalance {
+    bal := new(LeaveBalance)
+    bal.userid = userid
+    bal.policyUUID = policyUUID
+    return bal
+}
+
+func (bal *LeaveBalance)Userid() string {
+    return bal.userid
+}
+
+func (bal *LeaveBalance)PolicyUUID() syncParam.UUID {
+    return bal.policyUUID
+}
+
+func (bal *LeaveBalance)Balance() time.Duration {
+    return bal.balance
+}
+
+func (bal *LeaveBalance)LastAccrual() time.Time {
+    return bal.lastAccrual
+}
+
+//Add the accrual of policy for every full month between the last accrual
+// and 'now'. Accrual never takes the balance above the maximum of policy, a
+// balance already above the maximum, eg: by an adjustment, is left as is.
+func (bal *LeaveBalance)accrue(policy *LeavePolicy, now time.Time) {
+    var months int
+    for !bal.lastAccrual.AddDate(0, months + 1, 0).After(now) {
+        months++
+    }
+    if months == 0 {
+        return
+    }
+    bal.lastAccrual = bal.lastAccrual.AddDate(0, months, 0)
+    if !policy.tracked || policy.accrual == 0 {
+        return
+    }
+    newBalance := bal.balance + time.Duration(months) * policy.accrual
+    if policy.maxBalance > 0 && newBalance > policy.maxBalance {
+        newBalance = policy.maxBalance
+        if bal.balance > newBalance {
+            newBalance = bal.balance
+        }
+    }
+    bal.balance = newBalance
+}
+
+//Create a leave request of user 'userid' in org/unit 'orgUUID' for the
+// period [startTime, endTime). The charge defaults to the length of period.
+//uuid and createTime are populated when the request is created in the
+// datastore.
+func NewLeaveRequest(userid string, orgUUID syncParam.UUID,
+                     policyUUID syncParam.UUID, startTime time.Time,
+                     endTime time.Time, charge time.Duration,
+                     note string) *LeaveRequest {
+    leave := new(LeaveRequest)
+    leave.userid = userid
+    leave.orgUUID = orgUUID
+    leave.policyUUID = policyUUID
+    leave.startTime = startTime
+    leave.endTime = endTime
+    leave.charge = charge
+    if charge == 0 {
+        leave.charge = endTime.Sub(startTime)
+    }
+    leave.note = note
+    leave.status = LEAVE_REQUESTED
+    return leave
+}
+
+//Leave request that only carries the uuid, used to get/update the request.
+func NewLeaveRequestRef(uuid syncParam.UUID) *LeaveRequest {
+    leave := new(LeaveRequest)
+    leave.uuid = uuid
+    return leave
+}
+
+func (leave *LeaveRequest)UUID() syncParam.UUID {
+    return leave.uuid
+}
+
+func (leave *LeaveRequest)Userid() string {
+    return leave.userid
+}
+
+func (leave *LeaveRequest)OrgUUID() syncParam.UUID {
+    return leave.orgUUID
+}
+
+func (leave *LeaveRequest)PolicyUUID() syncParam.UUID {
+    return leave.policyUUID
+}
+
+func (leave *LeaveRequest)StartTime() time.Time {
+    return leave.startTime
+}
+
+func (leave *LeaveRequest)EndTime() time.Time {
+    return leave.endTime
+}
+
+func (leave *LeaveRequest)Charge() time.Duration {
+    return leave.charge
+}
+
+func (leave *LeaveRequest)Status() LeaveStatusBit {
+    return leave.status
+}
+
+func (leave *LeaveRequest)Note() string {
+    return leave.note
+}
+
+func (leave *LeaveRequest)CreateTime() time.Time {
+    return leave.createTime
+}
+
+func (leave *LeaveRequest)DecidedBy() string {
+    return leave.decidedBy
+}
+
+func (leave *LeaveRequest)DecideTime() time.Time {
+    return leave.decideTime
+}
+
+//Return true if the leave is approved and overlaps the range [from, to).
+func (leave *LeaveRequest)IsBusy(from time.Time, to time.Time) bool {
+    return leave.status == LEAVE_APPROVED && leave.startTime.Before(to) &&
+           from.Before(leave.endTime)
+}
+
+// Validate the leave status bits are valid.
+// Return true for a valid status and false otherwise.
+func (leave *LeaveRequest)IsLeaveStatusValid() bool {
+    var maxLeaveBit LeaveStatusBit = (LEAVE_CANCELLED << 1) - 1 //All 0xFs.
+    var minLeaveBit LeaveStatusBit = LEAVE_REQUESTED
+    if leave.status < minLeaveBit || leave.status > maxLeaveBit {
+        return false
+    }
+    return true
+}
+
+//Validate the leave request fields before storing it.
+func (leave *LeaveRequest)IsLeaveRequestValid() bool {
+    if len(leave.userid) == 0 || syncParam.IsUUIDEmpty(leave.orgUUID) ||
+        syncParam.IsUUIDEmpty(leave.policyUUID) ||
+        !leave.endTime.After(leave.startTime) || leave.charge < 0 ||
+        len(leave.note) >= LEAVE_NAME_STR_LEN {
+        return false
+    }
+    return leave.IsLeaveStatusValid()
+}
+
+//Return true if the request can move from status 'from' to 'to'. A request
+// is approved/rejected only once, and cancelled before or after approval.
+func IsLeaveTransitionValid(from LeaveStatusBit, to LeaveStatusBit) bool {
+    switch(from) {
+        case LEAVE_REQUESTED:
+            return to == LEAVE_APPROVED || to == LEAVE_REJECTED ||
+                   to == LEAVE_CANCELLED
+        case LEAVE_APPROVED:
+            return to == LEAVE_CANCELLED
+    }
+    return false
+}
@@ -0,0 +1,349 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+//******************************************************************************
+// Versioned schema migrations of the DB. Every change to the DB schema must be
+// added as a new migration step at the end of the list, an applied step must
+// never be modified as its checksum is recorded in the DB.
+//******************************************************************************
+import (
+    "fmt"
+    "time"
+    "strings"
+    "crypto/sha256"
+)
+
+//A schema migration step. The 'up' statements apply the step and 'down'
+// statements revert it. Steps are applied in the increasing order of version,
+// each in its own transaction.
+type migration struct {
+    version uint64
+    name string
+    up []string
+    down []string
+}
+
+//Checksum of a migration step, computed on the 'up' statements.
+func (mig *migration)checksum() string {
+    sum := sha256.Sum256([]byte(strings.Join(mig.up, ";\n")))
+    return fmt.Sprintf("%x", sum)
+}
+
+//Status of a schema migration step in the DB.
+type MigrationStatus struct {
+    version uint64
+    name string
+    applied bool
+    appliedTime time.Time
+    //Applied step is changed after applying or not known to application.
+    modified bool
+}
+
+func (status *MigrationStatus)Version() uint64 {
+    return status.version
+}
+
+func (status *MigrationStatus)Name() string {
+    return status.name
+}
+
+func (status *MigrationStatus)IsApplied() bool {
+    return status.applied
+}
+
+func (status *MigrationStatus)AppliedTime() time.Time {
+    return status.appliedTime
+}
+
+func (status *MigrationStatus)IsModified() bool {
+    return status.modified
+}
+
+//Drop all the tables of initial schema, in the reverse order of creation.
+var initialSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ROSTER_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SHIFT_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SHIFT_TEMPLATE_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", MEMBERSHIP_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", USER_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ORG_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ROLE_TABLE_NAME_STR),
+}
+
+//Drop the session table, index is dropped with the table.
+var sessionSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SESSION_TABLE_NAME),
+}
+
+//Drop the role definitions, the custom role bits are removed from roles
+// table as the memberships of those roles cannot be kept without definition.
+var roleDefSchemaDown = []string{
+    fmt.Sprintf(`DELETE FROM %s WHERE %s > %d`, ROLE_TABLE_NAME_STR,
+                ROLE_TYPE_NAME_STR, ROOTADMIN),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ROLEDEF_TABLE_NAME),
+}
+
+//Drop the availability table, index is dropped with the table.
+var availabilitySchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", AVAILABILITY_TABLE_NAME),
+}
+
+//Drop the leave tables, requests and balances before the policies they refer.
+var leaveSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", LEAVE_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", LEAVE_BALANCE_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", LEAVE_POLICY_TABLE_NAME),
+}
+
+//Drop the swap tables, audit and offers before the settings.
+var swapSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SWAP_AUDIT_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SWAP_OFFER_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SWAP_SETTINGS_TABLE_NAME),
+}
+
+//Drop the on-call tables, members before the rotations they refer.
+var onCallSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ESCALATION_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ONCALL_OVERRIDE_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ONCALL_MEMBER_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ONCALL_ROTATION_TABLE_NAME),
+}
+
+//Drop the calendar feeds and shift revisions, the shifts are kept.
+var feedSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", FEED_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", SHIFT_REVISION_TABLE_NAME),
+}
+
+//Drop the shift pattern tables, the shifts expanded from the patterns are
+// kept.
+var patternSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", PATTERN_OCCURRENCE_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", PATTERN_EXDATE_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", PATTERN_STEP_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", PATTERN_TABLE_NAME),
+}
+
+//Drop the holiday tables.
+var holidaySchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", HOLIDAY_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", HOLIDAY_CALENDAR_TABLE_NAME),
+}
+
+//Drop the skill tables.
+var skillSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", TEMPLATE_SKILL_TABLE_NAME),
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", USER_SKILL_TABLE_NAME),
+}
+
+//Drop the membership invites, the memberships are kept.
+var inviteSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", INVITE_TABLE_NAME),
+}
+
+//Columns of the instants in the tables, stored as 'timestamp' before the time
+// zones step. The dob of users is a calendar date and is not in the list.
+var instantColumns = [][2]string{
+    {ORG_TABLE_NAME, ORG_FIELD_START_TIME},
+    {USER_TABLE_NAME, USER_FIELD_STARTTIME},
+    {MEMBERSHIP_TABLE_NAME, MEMBERSHIP_FIELD_GRANT_TIME},
+    {SHIFT_TABLE_NAME, SHIFT_FIELD_START_TIME},
+    {SHIFT_TABLE_NAME, SHIFT_FIELD_END_TIME},
+    {SHIFT_TABLE_NAME, SHIFT_FIELD_CREATE_TIME},
+    {ROSTER_TABLE_NAME, ROSTER_FIELD_ASSIGN_TIME},
+    {SESSION_TABLE_NAME, SESSION_FIELD_CREATE_TIME},
+    {SESSION_TABLE_NAME, SESSION_FIELD_EXPIRY_TIME},
+    {AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_START_TIME},
+    {AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_END_TIME},
+    {LEAVE_BALANCE_TABLE_NAME, LEAVE_BALANCE_FIELD_LAST_ACCRUAL},
+    {LEAVE_TABLE_NAME, LEAVE_FIELD_START_TIME},
+    {LEAVE_TABLE_NAME, LEAVE_FIELD_END_TIME},
+    {LEAVE_TABLE_NAME, LEAVE_FIELD_CREATE_TIME},
+    {LEAVE_TABLE_NAME, LEAVE_FIELD_DECIDE_TIME},
+    {SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_CREATE_TIME},
+    {SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_DECIDE_TIME},
+    {SWAP_AUDIT_TABLE_NAME, SWAP_AUDIT_FIELD_AUDIT_TIME},
+    {ONCALL_ROTATION_TABLE_NAME, ONCALL_ROTATION_FIELD_HANDOFF_TIME},
+    {ONCALL_ROTATION_TABLE_NAME, ONCALL_ROTATION_FIELD_CREATE_TIME},
+    {ONCALL_OVERRIDE_TABLE_NAME, ONCALL_OVERRIDE_FIELD_START_TIME},
+    {ONCALL_OVERRIDE_TABLE_NAME, ONCALL_OVERRIDE_FIELD_END_TIME},
+    {ONCALL_OVERRIDE_TABLE_NAME, ONCALL_OVERRIDE_FIELD_CREATE_TIME},
+    {SHIFT_REVISION_TABLE_NAME, SHIFT_REVISION_FIELD_MODIFY_TIME},
+    {FEED_TABLE_NAME, FEED_FIELD_CREATE_TIME},
+    {PATTERN_TABLE_NAME, PATTERN_FIELD_DTSTART},
+    {PATTERN_TABLE_NAME, PATTERN_FIELD_VALID_FROM},
+    {PATTERN_TABLE_NAME, PATTERN_FIELD_VALID_UNTIL},
+    {PATTERN_TABLE_NAME, PATTERN_FIELD_CREATE_TIME},
+    {PATTERN_EXDATE_TABLE_NAME, PATTERN_EXDATE_FIELD_EXDATE},
+    {PATTERN_OCCURRENCE_TABLE_NAME, PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID},
+}
+
+//Change the type of all the instant columns to 'colType'. The rows written
+// before the change are taken as UTC, the zone of the application servers.
+func instantColumnsToType(colType string) []string {
+    stmts := []string{}
+    for _, col := range(instantColumns) {
+        stmts = append(stmts, fmt.Sprintf(
+                    `ALTER TABLE %s ALTER COLUMN %s TYPE %s
+                     USING %s AT TIME ZONE 'UTC'`,
+                    col[0], col[1], colType, col[1]))
+    }
+    return stmts
+}
+
+//Revert the instant columns to 'timestamp' and drop the time zones of orgs.
+var timeZoneSchemaDown = append(instantColumnsToType("timestamp"),
+                fmt.Sprintf("DROP TABLE IF EXISTS %s", ORG_TIME_ZONE_TABLE_NAME))
+
+//Schema migrations of postgreSQL DB. The first step uses 'IF NOT EXISTS', so
+// a DB created before the migrations is adopted as is.
+var postgresMigrations = []migration{
+    {
+        version : 1,
+        name : "initial schema",
+        up : []string{
+            roleschema,
+            roleSeed,
+            orgschema,
+            userchema,
+            membershipSchema,
+            shiftTemplateSchema,
+            shiftSchema,
+            rosterSchema,
+        },
+        down : initialSchemaDown,
+    },
+    {
+        version : 2,
+        name : "login sessions",
+        up : []string{
+            sessionSchema,
+            sessionUserIndex,
+        },
+        down : sessionSchemaDown,
+    },
+    {
+        version : 3,
+        name : "custom roles",
+        up : []string{
+            roledefSchema,
+            roledefSeed,
+        },
+        down : roleDefSchemaDown,
+    },
+    {
+        version : 4,
+        name : "user availability",
+        up : []string{
+            availabilitySchema,
+            availabilityUserIndex,
+        },
+        down : availabilitySchemaDown,
+    },
+    {
+        version : 5,
+        name : "leave requests",
+        up : []string{
+            leavePolicySchema,
+            leaveBalanceSchema,
+            leaveSchema,
+            leaveUserIndex,
+        },
+        down : leaveSchemaDown,
+    },
+    {
+        version : 6,
+        name : "shift swaps",
+        up : []string{
+            swapSettingsSchema,
+            swapOfferSchema,
+            swapOfferOrgIndex,
+            swapAuditSchema,
+            swapAuditOfferIndex,
+        },
+        down : swapSchemaDown,
+    },
+    {
+        version : 7,
+        name : "on-call rotations",
+        up : []string{
+            onCallRotationSchema,
+            onCallMemberSchema,
+            onCallOverrideSchema,
+            onCallOverrideOrgIndex,
+            escalationSchema,
+        },
+        down : onCallSchemaDown,
+    },
+    {
+        version : 8,
+        name : "calendar feeds",
+        up : []string{
+            shiftRevisionSchema,
+            feedSchema,
+            feedUserIndex,
+        },
+        down : feedSchemaDown,
+    },
+    {
+        version : 9,
+        name : "shift patterns",
+        up : []string{
+            patternSchema,
+            patternStepSchema,
+            patternExdateSchema,
+            patternOccurrenceSchema,
+            patternOccurrenceIndex,
+        },
+        down : patternSchemaDown,
+    },
+    {
+        version : 10,
+        name : "time zones",
+        up : append([]string{orgTimeZoneSchema},
+                    instantColumnsToType("timestamptz")...),
+        down : timeZoneSchemaDown,
+    },
+    {
+        version : 11,
+        name : "holiday calendars",
+        up : []string{
+            holidayCalendarSchema,
+            holidaySchema,
+            holidayCalendarDayIndex,
+        },
+        down : holidaySchemaDown,
+    },
+    {
+        version : 12,
+        name : "skills",
+        up : []string{
+            userSkillSchema,
+            userSkillExpiryIndex,
+            templateSkillSchema,
+        },
+        down : skillSchemaDown,
+    },
+    {
+        version : 13,
+        name : "membership invites",
+        up : []string{
+            inviteSchema,
+        },
+        down : inviteSchemaDown,
+    },
+}
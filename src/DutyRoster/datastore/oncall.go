@@ -0,0 +1,464 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "sort"
+    "time"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Level of escalation a rotation or override is on call for. The manager
+// level is named by the escalation policy of org/unit.
+type OnCallLevelBit uint64
+
+const (
+    ONCALL_PRIMARY OnCallLevelBit = 1 << iota
+    //Last entry in the on-call level. Do not add anything below backup.
+    ONCALL_BACKUP OnCallLevelBit = 1 << iota
+)
+
+//Maximum length of rotation name.
+const ONCALL_NAME_STR_LEN = 100
+
+//Maximum number of members in a rotation.
+const ONCALL_MAX_MEMBERS = 100
+
+//On-call rotation of an org/unit. The members take turns of 'turnLength'
+// starting at the handoff time, in the order of the list. Layers of the same
+// level are stacked, the highest layer that is active at an instant wins. A
+// layer is active only in its restriction window, eg: working hours of the
+// region for a follow-the-sun rotation.
+//The turns and the restriction window are on the wall clock of the org/unit,
+// so a handoff keeps its local time over the DST changes.
+type OnCallRotation struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    name string
+    level OnCallLevelBit
+    layer uint64
+    //First handoff of the rotation, the first member is on call from then.
+    handoffTime time.Time
+    turnLength time.Duration
+    members []string
+    //Restriction window, starts at the wall clock offset from start of the
+    // day on the weekdays and lasts for the duration of wall clock. One bit
+    // for each time.Weekday, 0 for all days. Duration 0 when the rotation is
+    // not restricted.
+    weekdays uint64
+    startOffset time.Duration
+    duration time.Duration
+    createTime time.Time
+}
+
+//Override of the on-call user for a level in the period [startTime, endTime),
+// eg: to cover a vacation. Overrides win over all the rotation layers.
+type OnCallOverride struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    level OnCallLevelBit
+    userid string
+    startTime time.Time
+    endTime time.Time
+    createTime time.Time
+}
+
+//Escalation policy of an org/unit. An alert goes to the primary, then to the
+// backup and then to the manager, waiting 'stepTimeout' for acknowledgement
+// at each step.
+type EscalationPolicy struct {
+    orgUUID syncParam.UUID
+    manager string
+    stepTimeout time.Duration
+}
+
+//Users on call for an org/unit at an instant, in the escalation order. A level
+// that is not covered in the org/unit falls back to the nearest ancestor that
+// covers it, the org/unit of each level is reported with the user.
+type OnCall struct {
+    orgUUID syncParam.UUID
+    at time.Time
+    primary string
+    primaryOrgUUID syncParam.UUID
+    backup string
+    backupOrgUUID syncParam.UUID
+    manager string
+    managerOrgUUID syncParam.UUID
+    //Step timeout of the nearest escalation policy.
+    stepTimeout time.Duration
+    policyFound bool
+}
+
+//Rotation 'name' of org/unit on 'level' in 'layer', the members take turns
+// from the handoff time. Restriction window can be set with SetRestriction.
+func NewOnCallRotation(orgUUID syncParam.UUID, name string,
+                       level OnCallLevelBit, layer uint64,
+                       handoffTime time.Time, turnLength time.Duration,
+                       members []string) *OnCallRotation {
+    rot := new(OnCallRotation)
+    rot.orgUUID = orgUUID
+    rot.name = name
+    rot.level = level
+    rot.layer = layer
+    rot.handoffTime = handoffTime
+    rot.turnLength = turnLength
+    rot.members = append([]string{}, members...)
+    return rot
+}
+
+//Rotation that only carries the uuid, used to get/delete the rotation.
+func NewOnCallRotationRef(uuid syncParam.UUID) *OnCallRotation {
+    rot := new(OnCallRotation)
+    rot.uuid = uuid
+    return rot
+}
+
+//Restrict the rotation to the weekly window, the rotation is active from the
+// offset on the weekdays for the duration.
+func (rot *OnCallRotation)SetRestriction(weekdays uint64,
+                                         startOffset time.Duration,
+                                         duration time.Duration) {
+    rot.weekdays = weekdays
+    rot.startOffset = startOffset
+    rot.duration = duration
+}
+
+func (rot *OnCallRotation)UUID() syncParam.UUID {
+    return rot.uuid
+}
+
+func (rot *OnCallRotation)OrgUUID() syncParam.UUID {
+    return rot.orgUUID
+}
+
+func (rot *OnCallRotation)Name() string {
+    return rot.name
+}
+
+func (rot *OnCallRotation)Level() OnCallLevelBit {
+    return rot.level
+}
+
+func (rot *OnCallRotation)Layer() uint64 {
+    return rot.layer
+}
+
+func (rot *OnCallRotation)HandoffTime() time.Time {
+    return rot.handoffTime
+}
+
+func (rot *OnCallRotation)TurnLength() time.Duration {
+    return rot.turnLength
+}
+
+func (rot *OnCallRotation)Members() []string {
+    return append([]string{}, rot.members...)
+}
+
+func (rot *OnCallRotation)Weekdays() uint64 {
+    return rot.weekdays
+}
+
+func (rot *OnCallRotation)StartOffset() time.Duration {
+    return rot.startOffset
+}
+
+func (rot *OnCallRotation)Duration() time.Duration {
+    return rot.duration
+}
+
+func (rot *OnCallRotation)CreateTime() time.Time {
+    return rot.createTime
+}
+
+//Return true if the level is a single known level.
+func isOnCallLevelValid(level OnCallLevelBit) bool {
+    return level == ONCALL_PRIMARY || level == ONCALL_BACKUP
+}
+
+//Validate the rotation fields before storing it. The turns are in whole
+// seconds same as the DB rows, and a member can be in the rotation only
+// once.
+func (rot *OnCallRotation)IsOnCallRotationValid() bool {
+    if syncParam.IsUUIDEmpty(rot.orgUUID) || len(rot.name) == 0 ||
+        len(rot.name) >= ONCALL_NAME_STR_LEN ||
+        !isOnCallLevelValid(rot.level) || rot.handoffTime.IsZero() ||
+        rot.turnLength < time.Minute || rot.turnLength % time.Second != 0 {
+        return false
+    }
+    if len(rot.members) == 0 || len(rot.members) > ONCALL_MAX_MEMBERS {
+        return false
+    }
+    seen := make(map[string]bool)
+    for _, userid := range(rot.members) {
+        if len(userid) == 0 || seen[userid] {
+            return false
+        }
+        seen[userid] = true
+    }
+    return rot.weekdays < (1 << 7) && rot.startOffset >= 0 &&
+           rot.startOffset < 24 * time.Hour && rot.duration >= 0 &&
+           rot.duration <= 24 * time.Hour
+}
+
+//Return true if the rotation is active at the instant 'at', ie: after the
+// first handoff and in the restriction window on the wall clock of 'loc'.
+func (rot *OnCallRotation)isActiveAt(at time.Time, loc *time.Location) bool {
+    if at.Before(rot.handoffTime) || len(rot.members) == 0 {
+        return false
+    }
+    if rot.duration == 0 {
+        return true
+    }
+    //Window of the day before can extend into the day of 'at'.
+    day := timezone.DayStart(at, loc)
+    for _, start := range([]time.Time{day, day.AddDate(0, 0, -1)}) {
+        if rot.weekdays != 0 &&
+            rot.weekdays & (1 << uint64(start.Weekday())) == 0 {
+            continue
+        }
+        start, end := timezone.ClockSpan(start, rot.startOffset, rot.duration,
+                                         loc)
+        if !at.Before(start) && at.Before(end) {
+            return true
+        }
+    }
+    return false
+}
+
+//Member of the rotation on turn at the instant 'at', empty when the rotation
+// is not active. The turns are counted on the wall clock of 'loc'.
+func (rot *OnCallRotation)memberAt(at time.Time, loc *time.Location) string {
+    if !rot.isActiveAt(at, loc) {
+        return ""
+    }
+    //The wall clock goes back in the hour repeated by a DST change.
+    elapsed := timezone.ClockDuration(rot.handoffTime, at, loc)
+    if elapsed < 0 {
+        elapsed = 0
+    }
+    turn := uint64(elapsed / rot.turnLength)
+    return rot.members[turn % uint64(len(rot.members))]
+}
+
+//Override of 'level' for user 'userid' in the period [startTime, endTime).
+func NewOnCallOverride(orgUUID syncParam.UUID, level OnCallLevelBit,
+                       userid string, startTime time.Time,
+                       endTime time.Time) *OnCallOverride {
+    ovr := new(OnCallOverride)
+    ovr.orgUUID = orgUUID
+    ovr.level = level
+    ovr.userid = userid
+    ovr.startTime = startTime
+    ovr.endTime = endTime
+    return ovr
+}
+
+//Override that only carries the uuid, used to delete the override.
+func NewOnCallOverrideRef(uuid syncParam.UUID) *OnCallOverride {
+    ovr := new(OnCallOverride)
+    ovr.uuid = uuid
+    return ovr
+}
+
+func (ovr *OnCallOverride)UUID() syncParam.UUID {
+    return ovr.uuid
+}
+
+func (ovr *OnCallOverride)OrgUUID() syncParam.UUID {
+    return ovr.orgUUID
+}
+
+func (ovr *OnCallOverride)Level() OnCallLevelBit {
+    return ovr.level
+}
+
+func (ovr *OnCallOverride)Userid() string {
+    return ovr.userid
+}
+
+func (ovr *OnCallOverride)StartTime() time.Time {
+    return ovr.startTime
+}
+
+func (ovr *OnCallOverride)EndTime() time.Time {
+    return ovr.endTime
+}
+
+func (ovr *OnCallOverride)CreateTime() time.Time {
+    return ovr.createTime
+}
+
+//Validate the override fields before storing it.
+func (ovr *OnCallOverride)IsOnCallOverrideValid() bool {
+    return !syncParam.IsUUIDEmpty(ovr.orgUUID) && len(ovr.userid) != 0 &&
+           isOnCallLevelValid(ovr.level) && ovr.endTime.After(ovr.startTime)
+}
+
+//Escalation policy of org/unit 'orgUUID', manager can be empty to escalate
+// to the manager of parent org/unit.
+func NewEscalationPolicy(orgUUID syncParam.UUID, manager string,
+                         stepTimeout time.Duration) *EscalationPolicy {
+    policy := new(EscalationPolicy)
+    policy.orgUUID = orgUUID
+    policy.manager = manager
+    policy.stepTimeout = stepTimeout
+    return policy
+}
+
+//Escalation policy that only carries the org/unit, used to get the policy.
+func NewEscalationPolicyRef(orgUUID syncParam.UUID) *EscalationPolicy {
+    policy := new(EscalationPolicy)
+    policy.orgUUID = orgUUID
+    return policy
+}
+
+func (policy *EscalationPolicy)OrgUUID() syncParam.UUID {
+    return policy.orgUUID
+}
+
+func (policy *EscalationPolicy)Manager() string {
+    return policy.manager
+}
+
+func (policy *EscalationPolicy)StepTimeout() time.Duration {
+    return policy.stepTimeout
+}
+
+//Validate the escalation policy fields before storing it, the timeout is in
+// whole seconds same as the DB rows.
+func (policy *EscalationPolicy)IsEscalationPolicyValid() bool {
+    return !syncParam.IsUUIDEmpty(policy.orgUUID) &&
+           policy.stepTimeout >= 0 && policy.stepTimeout % time.Second == 0
+}
+
+func (oc *OnCall)OrgUUID() syncParam.UUID {
+    return oc.orgUUID
+}
+
+func (oc *OnCall)At() time.Time {
+    return oc.at
+}
+
+func (oc *OnCall)Primary() string {
+    return oc.primary
+}
+
+func (oc *OnCall)PrimaryOrgUUID() syncParam.UUID {
+    return oc.primaryOrgUUID
+}
+
+func (oc *OnCall)Backup() string {
+    return oc.backup
+}
+
+func (oc *OnCall)BackupOrgUUID() syncParam.UUID {
+    return oc.backupOrgUUID
+}
+
+func (oc *OnCall)Manager() string {
+    return oc.manager
+}
+
+func (oc *OnCall)ManagerOrgUUID() syncParam.UUID {
+    return oc.managerOrgUUID
+}
+
+func (oc *OnCall)StepTimeout() time.Duration {
+    return oc.stepTimeout
+}
+
+//Return true when all the levels of escalation are resolved, no need to look
+// in the ancestors.
+func (oc *OnCall)isComplete() bool {
+    return len(oc.primary) != 0 && len(oc.backup) != 0 &&
+           len(oc.manager) != 0 && oc.policyFound
+}
+
+//User on call for 'level' at the instant 'at' from the rotations and
+// overrides of an org/unit in zone 'loc'. The latest override wins over the
+// rotations, and the highest active layer wins among the rotations.
+func resolveOnCallLevel(rotations []OnCallRotation,
+                        overrides []OnCallOverride, level OnCallLevelBit,
+                        at time.Time, loc *time.Location) string {
+    var override *OnCallOverride
+    for i := range(overrides) {
+        ovr := &overrides[i]
+        if ovr.level != level || at.Before(ovr.startTime) ||
+            !at.Before(ovr.endTime) {
+            continue
+        }
+        if override == nil || ovr.createTime.After(override.createTime) {
+            override = ovr
+        }
+    }
+    if override != nil {
+        return override.userid
+    }
+    layers := []*OnCallRotation{}
+    for i := range(rotations) {
+        if rotations[i].level == level {
+            layers = append(layers, &rotations[i])
+        }
+    }
+    sort.SliceStable(layers, func(i, j int) bool {
+        if layers[i].layer != layers[j].layer {
+            return layers[i].layer > layers[j].layer
+        }
+        return layers[i].createTime.After(layers[j].createTime)
+    })
+    for _, rot := range(layers) {
+        if userid := rot.memberAt(at, loc); len(userid) != 0 {
+            return userid
+        }
+    }
+    return ""
+}
+
+//Fill the levels not resolved yet from the rotations, overrides and policy
+// of org/unit 'org'. Called for the org/unit and then its ancestors, so the
+// nearest org/unit that covers a level wins. The rotations are in the zone of
+// the org/unit they belong to.
+func (oc *OnCall)resolveInOrg(org *Org, rotations []OnCallRotation,
+                              overrides []OnCallOverride,
+                              policy *EscalationPolicy) {
+    orgUUID := org.uuid
+    if len(oc.primary) == 0 {
+        oc.primary = resolveOnCallLevel(rotations, overrides, ONCALL_PRIMARY,
+                                        oc.at, org.Location())
+        if len(oc.primary) != 0 {
+            oc.primaryOrgUUID = orgUUID
+        }
+    }
+    if len(oc.backup) == 0 {
+        oc.backup = resolveOnCallLevel(rotations, overrides, ONCALL_BACKUP,
+                                       oc.at, org.Location())
+        if len(oc.backup) != 0 {
+            oc.backupOrgUUID = orgUUID
+        }
+    }
+    if policy == nil {
+        return
+    }
+    if len(oc.manager) == 0 && len(policy.manager) != 0 {
+        oc.manager = policy.manager
+        oc.managerOrgUUID = orgUUID
+    }
+    if !oc.policyFound {
+        oc.stepTimeout = policy.stepTimeout
+        oc.policyFound = true
+    }
+}
@@ -17,18 +17,19 @@ package datastore
 import (
     "time"
     "DutyRoster/syncParam"
+    "DutyRoster/timezone"
 )
 
-type orgStatusBit uint64
+type OrgStatusBit uint64
 
 const (
-    ORG_REQUESTED orgStatusBit = 1 << iota
-    ORG_APPROVED orgStatusBit = 1 << iota
+    ORG_REQUESTED OrgStatusBit = 1 << iota
+    ORG_APPROVED OrgStatusBit = 1 << iota
     //Last entry in the org status. Do not add anything below the delete status.
-    ORG_DELETED orgStatusBit = 1 << iota
+    ORG_DELETED OrgStatusBit = 1 << iota
 )
 
-type org struct {
+type Org struct {
     // A unique ID assigned to an organization or division in organization.
     uuid syncParam.UUID
     //name of organization or division in organization.
@@ -38,25 +39,140 @@ type org struct {
     // can have various levels in a hierarchy. The organization will have depth
     // 0, and divisions in the org might get numbers assigned from 1,2,3 and so
     // on.
-    parent *org
+    parent *Org
     //A new org will have a status requested/approved.
     // Creating a new org will having a state requested/approved or both.
-    status orgStatusBit
+    status OrgStatusBit
     //timstamp when a org is created.
     startTime time.Time
     //validity of organization in days in the application.
     //Store 0 for unlimited validity.
     validity uint64
+    //IANA time zone of the org, eg: Europe/Berlin. The days and wall clock
+    // times of the roster are in this zone. A unit created without a zone
+    // gets the zone of its parent.
+    timeZone string
 }
 
 // Validate the rolebitset is valid.
 // Return true for a valid rolebitset and false otherwise.
-func (or *org)IsOrgStatusValid() bool{
+func (or *Org)IsOrgStatusValid() bool{
     //Assuming there are no role bit present after rootadmin.
-    var maxOrgBit orgStatusBit = (ORG_DELETED << 1) - 1 //All 0xFs.
-    var minOrgBit orgStatusBit = ORG_REQUESTED
+    var maxOrgBit OrgStatusBit = (ORG_DELETED << 1) - 1 //All 0xFs.
+    var minOrgBit OrgStatusBit = ORG_REQUESTED
     if or.status < minOrgBit || or.status > maxOrgBit {
         return false
     }
     return true
-}
\ No newline at end of file
+}
+
+//Hierarchy of an org/unit with all its descendants.
+type OrgTree struct {
+    Org *Org
+    Children []*OrgTree
+}
+
+//Create an org/unit 'name' under 'parent'. parent is nil for a top level
+// organization. uuid and startTime are populated when the org is created in
+// the datastore.
+func NewOrg(name string, address string, parent *Org, status OrgStatusBit,
+            validity uint64) *Org {
+    or := new(Org)
+    or.name = name
+    or.address = address
+    or.parent = parent
+    or.status = status
+    or.validity = validity
+    return or
+}
+
+//Org that only carries the uuid, used to get/update/delete the org.
+func NewOrgRef(uuid syncParam.UUID) *Org {
+    or := new(Org)
+    or.uuid = uuid
+    return or
+}
+
+func (or *Org)UUID() syncParam.UUID {
+    return or.uuid
+}
+
+func (or *Org)Name() string {
+    return or.name
+}
+
+func (or *Org)Address() string {
+    return or.address
+}
+
+//Return parent of the org, nil for a top level organization.
+func (or *Org)Parent() *Org {
+    return or.parent
+}
+
+func (or *Org)Status() OrgStatusBit {
+    return or.status
+}
+
+func (or *Org)StartTime() time.Time {
+    return or.startTime
+}
+
+func (or *Org)Validity() uint64 {
+    return or.validity
+}
+
+func (or *Org)TimeZone() string {
+    return or.timeZone
+}
+
+//Return true when the org/unit is approved, and not deleted or past its
+// validity at 'now'. Validity is in days from the creation of org, 0 for
+// unlimited validity.
+func (or *Org)IsActive(now time.Time) bool {
+    if or.status & ORG_APPROVED == 0 || or.status & ORG_DELETED != 0 {
+        return false
+    }
+    if or.validity == 0 {
+        return true
+    }
+    return !now.After(or.startTime.AddDate(0, 0, int(or.validity)))
+}
+
+//Location of the time zone of org, to compute the local days of the org.
+func (or *Org)Location() *time.Location {
+    return timezone.Location(or.timeZone)
+}
+
+//Only status, validity and time zone are allowed to modify on an existing
+// org.
+func (or *Org)SetStatus(status OrgStatusBit) {
+    or.status = status
+}
+
+func (or *Org)SetValidity(validity uint64) {
+    or.validity = validity
+}
+
+//Set the IANA time zone 'name' of org, unlike status and validity the zone
+// of an org is not applied to its descendants on update.
+func (or *Org)SetTimeZone(name string) {
+    or.timeZone = name
+}
+
+//Validate the time zone of org, empty zone is valid on create as the zone is
+// taken from the parent.
+func (or *Org)isTimeZoneValid() bool {
+    return len(or.timeZone) == 0 || timezone.IsTimeZoneValid(or.timeZone)
+}
+
+//Check 'orgUUID' is the org 'org' or one of its ancestors. 'org' must carry
+// the parent chain.
+func isOrgInChain(org *Org, orgUUID syncParam.UUID) bool {
+    for entry := org; entry != nil; entry = entry.parent {
+        if entry.uuid == orgUUID {
+            return true
+        }
+    }
+    return false
+}
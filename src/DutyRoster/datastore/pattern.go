@@ -0,0 +1,542 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "DutyRoster/errorset"
+    "DutyRoster/recurrence"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Scope of an edit to the shifts of a pattern.
+type PatternEditScopeBit uint64
+
+const (
+    //Only the selected occurrence, it is detached from the pattern.
+    PATTERN_EDIT_THIS PatternEditScopeBit = 1 << iota
+    //The selected occurrence and the ones after it, the pattern is split at
+    // the occurrence.
+    PATTERN_EDIT_FOLLOWING PatternEditScopeBit = 1 << iota
+    //Last entry in the edit scope. Do not add anything below all.
+    PATTERN_EDIT_ALL PatternEditScopeBit = 1 << iota
+)
+
+//Maximum number of steps in a cycle of the pattern.
+const PATTERN_MAX_STEPS = 100
+
+//Maximum number of exception dates of a pattern.
+const PATTERN_MAX_EXDATES = 1000
+
+//Maximum number of occurrences a pattern is expanded into at once.
+const PATTERN_MAX_OCCURRENCES = 2000
+
+//Maximum length of the recurrence rule string.
+const PATTERN_RULE_STR_LEN = 500
+
+//Shift in a cycle of a pattern, starts at the offset from the start of the
+// cycle and lasts for the duration. Both are on the wall clock of the org, so
+// a 19:00 to 07:00 night shift is 11 or 13 hours long on the nights of DST
+// change.
+type PatternStep struct {
+    offset time.Duration
+    duration time.Duration
+}
+
+//Recurring shift pattern of an org/unit. Each occurrence of the recurrence
+// rule starts a cycle at the time of day of dtstart, and the steps of the
+// cycle are the shifts. eg:
+//  - weekdays 9 to 5: 'FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR', dtstart at 09:00 and
+//    one step {0, 8h}.
+//  - 4-on-4-off days: 'FREQ=DAILY;INTERVAL=8', dtstart at 07:00 and steps
+//    {0, 12h}, {24h, 12h}, {48h, 12h}, {72h, 12h}.
+//  - DuPont: 'FREQ=DAILY;INTERVAL=28' with 14 steps of 12h for the 4 nights,
+//    3 days, 3 nights and 4 days of the 28 day cycle.
+//An occurrence is identified by its recurrence id, the start time computed by
+// the pattern. Occurrences on the exception dates and outside [validFrom,
+// validUntil) are not part of the pattern.
+//The rule is expanded on the wall clock of the time zone of the org, the
+// times are stored in UTC.
+type ShiftPattern struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    //Template of the generated shifts, empty UUID for none.
+    templateUUID syncParam.UUID
+    name string
+    rule string
+    dtstart time.Time
+    steps []PatternStep
+    minStaff uint64
+    exdates []time.Time
+    //Zero time when not set, set on the patterns split from a pattern.
+    validFrom time.Time
+    validUntil time.Time
+    //userid of user who created the pattern.
+    owner string
+    createTime time.Time
+}
+
+//An occurrence of a pattern that is expanded into a shift.
+type PatternOccurrence struct {
+    shiftUUID syncParam.UUID
+    patternUUID syncParam.UUID
+    recurrenceID time.Time
+    //Detached occurrences are edited on their own, edits to the following or
+    // all occurrences of the pattern do not change them.
+    detached bool
+}
+
+//Edit to the occurrences of a pattern, the occurrences are moved by 'move' on
+// the wall clock, and the duration and minimum staff are replaced when not 0. A cancel edit
+// cancels the occurrences instead. Only the shifts that have not started are
+// changed.
+type PatternEdit struct {
+    patternUUID syncParam.UUID
+    //Occurrence selected for the edit, not used for scope all.
+    recurrenceID time.Time
+    scope PatternEditScopeBit
+    move time.Duration
+    duration time.Duration
+    minStaff uint64
+    cancel bool
+    //Pattern that has the edited occurrences, the new pattern when the edit
+    // splits the pattern.
+    resultUUID syncParam.UUID
+    //Number of shifts changed by the edit.
+    changed uint64
+}
+
+//Occurrence of a pattern in the expansion.
+type patternSlot struct {
+    recurrenceID time.Time
+    endTime time.Time
+}
+
+//Step of a cycle that starts 'offset' after the start of the cycle.
+func NewPatternStep(offset time.Duration,
+                    duration time.Duration) PatternStep {
+    return PatternStep{offset : offset, duration : duration}
+}
+
+func (step PatternStep)Offset() time.Duration {
+    return step.offset
+}
+
+func (step PatternStep)Duration() time.Duration {
+    return step.duration
+}
+
+//Pattern 'name' of org/unit with the recurrence rule and the steps of the
+// cycle. templateUUID can be empty.
+func NewShiftPattern(orgUUID syncParam.UUID, templateUUID syncParam.UUID,
+                     name string, rule string, dtstart time.Time,
+                     steps []PatternStep, minStaff uint64,
+                     owner string) *ShiftPattern {
+    pat := new(ShiftPattern)
+    pat.orgUUID = orgUUID
+    pat.templateUUID = templateUUID
+    pat.name = name
+    pat.rule = rule
+    pat.dtstart = dtstart
+    pat.steps = append([]PatternStep{}, steps...)
+    pat.minStaff = minStaff
+    pat.owner = owner
+    return pat
+}
+
+//Pattern that only carries the uuid, used to get/delete the pattern.
+func NewShiftPatternRef(uuid syncParam.UUID) *ShiftPattern {
+    pat := new(ShiftPattern)
+    pat.uuid = uuid
+    return pat
+}
+
+//Set the exception dates of the pattern, the occurrences with the recurrence
+// ids are skipped.
+func (pat *ShiftPattern)SetExdates(exdates []time.Time) {
+    pat.exdates = []time.Time{}
+    for _, exdate := range(exdates) {
+        pat.exdates = append(pat.exdates, exdate.UTC().Truncate(time.Second))
+    }
+}
+
+func (pat *ShiftPattern)UUID() syncParam.UUID {
+    return pat.uuid
+}
+
+func (pat *ShiftPattern)OrgUUID() syncParam.UUID {
+    return pat.orgUUID
+}
+
+func (pat *ShiftPattern)TemplateUUID() syncParam.UUID {
+    return pat.templateUUID
+}
+
+func (pat *ShiftPattern)Name() string {
+    return pat.name
+}
+
+func (pat *ShiftPattern)Rule() string {
+    return pat.rule
+}
+
+func (pat *ShiftPattern)Dtstart() time.Time {
+    return pat.dtstart
+}
+
+func (pat *ShiftPattern)Steps() []PatternStep {
+    return append([]PatternStep{}, pat.steps...)
+}
+
+func (pat *ShiftPattern)MinStaff() uint64 {
+    return pat.minStaff
+}
+
+func (pat *ShiftPattern)Exdates() []time.Time {
+    return append([]time.Time{}, pat.exdates...)
+}
+
+func (pat *ShiftPattern)ValidFrom() time.Time {
+    return pat.validFrom
+}
+
+func (pat *ShiftPattern)ValidUntil() time.Time {
+    return pat.validUntil
+}
+
+func (pat *ShiftPattern)Owner() string {
+    return pat.owner
+}
+
+func (pat *ShiftPattern)CreateTime() time.Time {
+    return pat.createTime
+}
+
+//Validate the pattern fields before storing it. The times are in whole
+// seconds same as the DB rows.
+func (pat *ShiftPattern)IsShiftPatternValid() bool {
+    if syncParam.IsUUIDEmpty(pat.orgUUID) || len(pat.name) == 0 ||
+        len(pat.name) >= SHIFT_NAME_STR_LEN || len(pat.owner) == 0 ||
+        len(pat.rule) >= PATTERN_RULE_STR_LEN || pat.dtstart.IsZero() ||
+        len(pat.steps) == 0 || len(pat.steps) > PATTERN_MAX_STEPS ||
+        len(pat.exdates) > PATTERN_MAX_EXDATES {
+        return false
+    }
+    if _, err := recurrence.ParseRule(pat.rule); err != nil {
+        return false
+    }
+    //A pattern split at its first occurrence is left without occurrences.
+    return pat.areStepsValid() && (pat.validFrom.IsZero() ||
+           pat.validUntil.IsZero() || !pat.validUntil.Before(pat.validFrom))
+}
+
+//Validate the steps of the cycle, checked again after an edit.
+func (pat *ShiftPattern)areStepsValid() bool {
+    for _, step := range(pat.steps) {
+        if step.duration <= 0 || step.duration % time.Second != 0 ||
+            step.offset % time.Second != 0 {
+            return false
+        }
+    }
+    return len(pat.steps) != 0
+}
+
+//Copy the pattern with its own steps and exception dates.
+func (pat *ShiftPattern)clone() *ShiftPattern {
+    entry := new(ShiftPattern)
+    *entry = *pat
+    entry.steps = append([]PatternStep{}, pat.steps...)
+    entry.exdates = append([]time.Time{}, pat.exdates...)
+    return entry
+}
+
+//Move the times of the pattern to UTC in whole seconds before storing it.
+func (pat *ShiftPattern)normalize() {
+    pat.dtstart = pat.dtstart.UTC().Truncate(time.Second)
+    if !pat.validFrom.IsZero() {
+        pat.validFrom = pat.validFrom.UTC().Truncate(time.Second)
+    }
+    if !pat.validUntil.IsZero() {
+        pat.validUntil = pat.validUntil.UTC().Truncate(time.Second)
+    }
+    exdates := pat.exdates
+    pat.SetExdates(nil)
+    seen := make(map[int64]bool)
+    for _, exdate := range(exdates) {
+        exdate = exdate.UTC().Truncate(time.Second)
+        if !seen[exdate.Unix()] {
+            seen[exdate.Unix()] = true
+            pat.exdates = append(pat.exdates, exdate)
+        }
+    }
+    sort.Slice(pat.exdates, func(i, j int) bool {
+        return pat.exdates[i].Before(pat.exdates[j])
+    })
+}
+
+//Return true if the occurrence 'recurrenceID' is on an exception date.
+func (pat *ShiftPattern)isExdate(recurrenceID time.Time) bool {
+    for _, exdate := range(pat.exdates) {
+        if exdate.Equal(recurrenceID) {
+            return true
+        }
+    }
+    return false
+}
+
+//Occurrences of the pattern in zone 'loc' that start in the range [from, to),
+// in the order of start time. Returns PATTERN_RANGE_TOO_LARGE when there are
+// more than PATTERN_MAX_OCCURRENCES.
+func (pat *ShiftPattern)occurrencesIn(from time.Time, to time.Time,
+                                      loc *time.Location) ([]patternSlot,
+                                                           error) {
+    rule, err := recurrence.ParseRule(pat.rule)
+    if err != nil {
+        return nil, err
+    }
+    if !pat.validFrom.IsZero() && from.Before(pat.validFrom) {
+        from = pat.validFrom
+    }
+    if !pat.validUntil.IsZero() && to.After(pat.validUntil) {
+        to = pat.validUntil
+    }
+    if !from.Before(to) {
+        return []patternSlot{}, nil
+    }
+    //The cycles that start before the range can have steps in the range. The
+    // offsets are on the wall clock, a day covers the DST changes of any
+    // zone.
+    var minOffset, maxOffset time.Duration
+    for i, step := range(pat.steps) {
+        if i == 0 || step.offset < minOffset {
+            minOffset = step.offset
+        }
+        if i == 0 || step.offset > maxOffset {
+            maxOffset = step.offset
+        }
+    }
+    cycles := rule.Between(pat.dtstart.In(loc),
+                           from.Add(-maxOffset - 24 * time.Hour),
+                           to.Add(-minOffset + 24 * time.Hour),
+                           PATTERN_MAX_OCCURRENCES + 1)
+    slots := []patternSlot{}
+    for _, cycle := range(cycles) {
+        for _, step := range(pat.steps) {
+            start := timezone.AddClock(cycle, step.offset, loc).UTC()
+            if start.Before(from) || !start.Before(to) ||
+                pat.isExdate(start) {
+                continue
+            }
+            end := timezone.AddClock(cycle, step.offset + step.duration, loc)
+            slots = append(slots, patternSlot{start, end.UTC()})
+        }
+    }
+    if len(cycles) > PATTERN_MAX_OCCURRENCES ||
+        len(slots) > PATTERN_MAX_OCCURRENCES {
+        return nil, fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.PATTERN_RANGE_TOO_LARGE])
+    }
+    sort.SliceStable(slots, func(i, j int) bool {
+        return slots[i].recurrenceID.Before(slots[j].recurrenceID)
+    })
+    return slots, nil
+}
+
+//Return the occurrence 'recurrenceID' of the pattern in zone 'loc', false
+// when the pattern does not have it.
+func (pat *ShiftPattern)occurrenceAt(recurrenceID time.Time,
+                                     loc *time.Location) (patternSlot, bool) {
+    slots, err := pat.occurrencesIn(recurrenceID,
+                                    recurrenceID.Add(time.Second), loc)
+    if err != nil || len(slots) == 0 {
+        return patternSlot{}, false
+    }
+    return slots[0], true
+}
+
+//Apply the edit to the definition of the pattern in zone 'loc', the steps and
+// the times that identify the occurrences are moved with the edit.
+func (pat *ShiftPattern)applyEdit(edit *PatternEdit, loc *time.Location) {
+    for i := range(pat.steps) {
+        pat.steps[i].offset += edit.move
+        if edit.duration != 0 {
+            pat.steps[i].duration = edit.duration
+        }
+    }
+    if edit.minStaff != 0 {
+        pat.minStaff = edit.minStaff
+    }
+    for i := range(pat.exdates) {
+        pat.exdates[i] = edit.moveTime(pat.exdates[i], loc)
+    }
+    if !pat.validFrom.IsZero() {
+        pat.validFrom = edit.moveTime(pat.validFrom, loc)
+    }
+    if !pat.validUntil.IsZero() {
+        pat.validUntil = edit.moveTime(pat.validUntil, loc)
+    }
+}
+
+//End the pattern before 'end', the exception dates after it are dropped.
+func (pat *ShiftPattern)endAt(end time.Time) {
+    if !pat.validFrom.IsZero() && end.Before(pat.validFrom) {
+        end = pat.validFrom
+    }
+    if pat.validUntil.IsZero() || end.Before(pat.validUntil) {
+        pat.validUntil = end
+    }
+    kept := []time.Time{}
+    for _, exdate := range(pat.exdates) {
+        if exdate.Before(pat.validUntil) {
+            kept = append(kept, exdate)
+        }
+    }
+    pat.exdates = kept
+}
+
+//Split the pattern at the occurrence 'recurrenceID' for the edit, the
+// pattern ends before the occurrence and the returned pattern has the
+// occurrence and the ones after it with the edit applied. The new pattern is
+// not stored.
+func (pat *ShiftPattern)splitAt(recurrenceID time.Time, edit *PatternEdit,
+                                loc *time.Location) *ShiftPattern {
+    following := pat.clone()
+    following.uuid = syncParam.UUID{}
+    following.exdates = []time.Time{}
+    for _, exdate := range(pat.exdates) {
+        if !exdate.Before(recurrenceID) {
+            following.exdates = append(following.exdates, exdate)
+        }
+    }
+    following.validFrom = recurrenceID
+    pat.endAt(recurrenceID)
+    following.applyEdit(edit, loc)
+    return following
+}
+
+//Move the instant 't' of an occurrence by the edit on the wall clock of
+// 'loc'. The times are kept in UTC.
+func (edit *PatternEdit)moveTime(t time.Time, loc *time.Location) time.Time {
+    return timezone.AddClock(t, edit.move, loc).UTC()
+}
+
+//Apply the edit to the shift of an occurrence in zone 'loc', returns false
+// when the shift is not changed, ie: the shift is cancelled or already
+// started.
+func (edit *PatternEdit)applyToShift(sh *Shift, now time.Time,
+                                     loc *time.Location) bool {
+    if sh.IsCancelled() || !sh.startTime.After(now) {
+        return false
+    }
+    if edit.cancel {
+        sh.status |= SHIFT_CANCELLED
+        return true
+    }
+    sh.startTime = edit.moveTime(sh.startTime, loc)
+    sh.endTime = edit.moveTime(sh.endTime, loc)
+    if edit.duration != 0 {
+        sh.endTime = timezone.AddClock(sh.startTime, edit.duration, loc).UTC()
+    }
+    if edit.minStaff != 0 {
+        sh.minStaff = edit.minStaff
+    }
+    return true
+}
+
+func (occ *PatternOccurrence)ShiftUUID() syncParam.UUID {
+    return occ.shiftUUID
+}
+
+func (occ *PatternOccurrence)PatternUUID() syncParam.UUID {
+    return occ.patternUUID
+}
+
+func (occ *PatternOccurrence)RecurrenceID() time.Time {
+    return occ.recurrenceID
+}
+
+func (occ *PatternOccurrence)IsDetached() bool {
+    return occ.detached
+}
+
+//Edit of the occurrences in 'scope' of the pattern, starting at the
+// occurrence 'recurrenceID'. duration and minStaff are not changed when 0.
+func NewPatternEdit(patternUUID syncParam.UUID, recurrenceID time.Time,
+                    scope PatternEditScopeBit, move time.Duration,
+                    duration time.Duration, minStaff uint64) *PatternEdit {
+    edit := new(PatternEdit)
+    edit.patternUUID = patternUUID
+    edit.recurrenceID = recurrenceID
+    edit.scope = scope
+    edit.move = move
+    edit.duration = duration
+    edit.minStaff = minStaff
+    return edit
+}
+
+//Edit that cancels the occurrences in 'scope' of the pattern.
+func NewPatternCancel(patternUUID syncParam.UUID, recurrenceID time.Time,
+                      scope PatternEditScopeBit) *PatternEdit {
+    edit := new(PatternEdit)
+    edit.patternUUID = patternUUID
+    edit.recurrenceID = recurrenceID
+    edit.scope = scope
+    edit.cancel = true
+    return edit
+}
+
+func (edit *PatternEdit)PatternUUID() syncParam.UUID {
+    return edit.patternUUID
+}
+
+func (edit *PatternEdit)RecurrenceID() time.Time {
+    return edit.recurrenceID
+}
+
+func (edit *PatternEdit)Scope() PatternEditScopeBit {
+    return edit.scope
+}
+
+func (edit *PatternEdit)IsCancel() bool {
+    return edit.cancel
+}
+
+func (edit *PatternEdit)ResultUUID() syncParam.UUID {
+    return edit.resultUUID
+}
+
+func (edit *PatternEdit)Changed() uint64 {
+    return edit.changed
+}
+
+//Validate the edit fields before applying it.
+func (edit *PatternEdit)IsPatternEditValid() bool {
+    if syncParam.IsUUIDEmpty(edit.patternUUID) ||
+        (edit.scope != PATTERN_EDIT_THIS &&
+         edit.scope != PATTERN_EDIT_FOLLOWING &&
+         edit.scope != PATTERN_EDIT_ALL) ||
+        (edit.scope != PATTERN_EDIT_ALL && edit.recurrenceID.IsZero()) ||
+        edit.duration < 0 || edit.move % time.Second != 0 ||
+        edit.duration % time.Second != 0 {
+        return false
+    }
+    if edit.cancel {
+        return edit.move == 0 && edit.duration == 0 && edit.minStaff == 0
+    }
+    return edit.move != 0 || edit.duration != 0 || edit.minStaff != 0
+}
@@ -17,12 +17,15 @@ package datastore
 import (
     "sync"
     "fmt"
+    "time"
     "database/sql"
     _ "github.com/lib/pq"
     "github.com/jmoiron/sqlx"
     "DutyRoster/logging"
     "DutyRoster/config"
     "DutyRoster/errorset"
+    "DutyRoster/credentials"
+    "DutyRoster/syncParam"
 )
 
 type postgreSqlDataStore struct {
@@ -52,7 +55,7 @@ func (sqlds *postgreSqlDataStore)CreateDBConnection() error{
         return fmt.Errorf("%s",
             errorset.ERROR_TYPES[errorset.NULL_DB_CONFIG_PARAMS])
     }
-    if dbDriver != "postgres" {
+    if dbDriver != POSTGRES_DB_DRIVER {
         //Only postgres driver can be handled here.
         sqlds.dblogger.Error("Failed to start application, Invalid driver :%s",
                              dbDriver)
@@ -80,17 +83,22 @@ func (sqlds *postgreSqlDataStore)CreateDBConnection() error{
     return nil
 }
 
-//Create all the postgresql tables for DutyRoster application.
-func (sqlds *postgreSqlDataStore)CreateDataStoreTables() error {
-    //Create Role table.
+//The postgreSQL tables are created by the schema migrations, only the schema
+// version is validated here.
+func (sqlds *postgreSqlDataStore)InitDataStore() error {
+    return sqlds.checkSchemaVersion(postgresMigrations)
+}
 
-    roletable := new(sqlroles)
-    roletable.createRoleTable(sqlds, sqlds.DBConn)
-    orgtable := new(sqlorg)
-    orgtable.createOrgTable(sqlds, sqlds.DBConn)
-    usertable := new(sqlUsers)
-    usertable.createUserTable(sqlds, sqlds.DBConn)
-    return nil
+func (sqlds *postgreSqlDataStore)MigrateUp() error {
+    return sqlds.migrateUp(postgresMigrations)
+}
+
+func (sqlds *postgreSqlDataStore)MigrateDown() error {
+    return sqlds.migrateDown(postgresMigrations)
+}
+
+func (sqlds *postgreSqlDataStore)ListMigrations() ([]MigrationStatus, error) {
+    return sqlds.getMigrationStatus(postgresMigrations)
 }
 
 func (sqlds *postgreSqlDataStore)CreateUserAccount(user *Users) error {
@@ -103,36 +111,1383 @@ func (sqlds *postgreSqlDataStore)CreateUserAccount(user *Users) error {
         return err
     }
     Tx.Commit()
+    *user = usertable.Users
     return nil
 }
 
-func (sqlds *postgreSqlDataStore)GetUserAccount(user *Users) error {
+func (sqlds *postgreSqlDataStore)GetUserAccount(user *Users,
+                                                password string) error {
+    log := logging.GetAppLoggerObj()
     usertable := new(sqlUsers)
     usertable.Users = *user
-    err := usertable.getUserwithIDPwd(sqlds, sqlds.DBConn)
-    return err
+    Tx := sqlds.DBConn.MustBegin()
+    err := usertable.getUserwithID(sqlds, Tx)
+    if err == sql.ErrNoRows {
+        Tx.Rollback()
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_CREDENTIALS])
+    }
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    valid, rehash := credentials.VerifyPassword(usertable.hashpwd, password)
+    if !valid {
+        Tx.Rollback()
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_CREDENTIALS])
+    }
+    if rehash {
+        //Login must not fail on a rehash failure, old hash is still valid.
+        hashpwd, err := credentials.HashPassword(password)
+        if err == nil {
+            usertable.hashpwd = hashpwd
+            err = usertable.updateUserPwd(sqlds, Tx)
+        }
+        if err != nil {
+            log.Warning("Failed to rehash pwd of user %s, err : %s",
+                        usertable.userid, err)
+            Tx.Rollback()
+            *user = usertable.Users
+            return nil
+        }
+    }
+    Tx.Commit()
+    *user = usertable.Users
+    return nil
 }
 
-func (sqlds *postgreSqlDataStore)DeleteUserAccount(user *Users) error {
+func (sqlds *postgreSqlDataStore)GetUser(user *Users) error {
     usertable := new(sqlUsers)
     usertable.Users = *user
-    usertable.deleteUserEntry(sqlds, sqlds.DBConn)
+    err := usertable.getUserwithID(sqlds, sqlds.DBConn)
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        return err
+    }
+    *user = usertable.Users
     return nil
 }
 
+func (sqlds *postgreSqlDataStore)DeleteUserAccount(user *Users) error {
+    usertable := new(sqlUsers)
+    usertable.Users = *user
+    return usertable.deleteUserEntry(sqlds, sqlds.DBConn)
+}
+
 func (sqlds *postgreSqlDataStore)UpdateUserAccount(user *Users) error {
     usertable := new(sqlUsers)
     usertable.Users = *user
     Tx := sqlds.DBConn.MustBegin()
-    err := usertable.createUserEntry(sqlds, Tx)
+    err := usertable.updateUserEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateOrg(org *Org) error {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    err := orgtable.createOrgEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *org = orgtable.Org
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateOrgWithAdmin(org *Org,
+                                                    userid string) error {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    err := orgtable.createOrgEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    membertable := new(sqlUserOrgRole)
+    membertable.UserOrgRole = *NewUserOrgRole(userid, ROOTADMIN,
+                                              orgtable.uuid)
+    err = membertable.grantMembershipEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *org = orgtable.Org
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetOrg(org *Org) error {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    //Read only transaction, rollback as nothing to commit.
+    defer Tx.Rollback()
+    err := orgtable.getOrgEntry(sqlds, Tx)
+    if err != nil {
+        return err
+    }
+    *org = orgtable.Org
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)UpdateOrg(org *Org) error {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    err := orgtable.updateOrgEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)DeleteOrg(org *Org) error {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    err := orgtable.deleteOrgEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)ListChildOrgs(org *Org) ([]Org, error) {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    err := orgtable.getOrgEntry(sqlds, Tx)
+    if err != nil {
+        return nil, err
+    }
+    return orgtable.getChildOrgEntries(sqlds, Tx)
+}
+
+func (sqlds *postgreSqlDataStore)GetOrgTree(org *Org) (*OrgTree, error) {
+    orgtable := new(sqlorg)
+    orgtable.Org = *org
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    err := orgtable.getOrgEntry(sqlds, Tx)
+    if err != nil {
+        return nil, err
+    }
+    return orgtable.getOrgTree(sqlds, Tx)
+}
+
+func (sqlds *postgreSqlDataStore)GrantUserOrgRole(member *UserOrgRole) error {
+    membertable := new(sqlUserOrgRole)
+    membertable.UserOrgRole = *member
+    Tx := sqlds.DBConn.MustBegin()
+    err := membertable.grantMembershipEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)RevokeUserOrgRole(member *UserOrgRole) error {
+    membertable := new(sqlUserOrgRole)
+    membertable.UserOrgRole = *member
+    Tx := sqlds.DBConn.MustBegin()
+    err := membertable.revokeMembershipEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)ListUserMemberships(
+                                userid string) ([]UserOrgRole, error) {
+    membertable := new(sqlUserOrgRole)
+    return membertable.getMembershipsByUser(sqlds, sqlds.DBConn, userid)
+}
+
+func (sqlds *postgreSqlDataStore)ListOrgMemberships(
+                                orgUUID syncParam.UUID) ([]UserOrgRole, error) {
+    membertable := new(sqlUserOrgRole)
+    return membertable.getMembershipsByOrg(sqlds, sqlds.DBConn, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)GetEffectiveRoles(userid string,
+                                orgUUID syncParam.UUID) (RoleBit, error) {
+    membertable := new(sqlUserOrgRole)
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    return membertable.getEffectiveRoles(sqlds, Tx, userid, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)CreateMembershipInvite(
+                                invite *UserOrgRole) error {
+    invitetable := new(sqlMembershipInvite)
+    invitetable.UserOrgRole = *invite
+    Tx := sqlds.DBConn.MustBegin()
+    err := invitetable.createInviteEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)ListUserMembershipInvites(
+                                userid string) ([]UserOrgRole, error) {
+    invitetable := new(sqlMembershipInvite)
+    return invitetable.getInvitesByUser(sqlds, sqlds.DBConn, userid)
+}
+
+func (sqlds *postgreSqlDataStore)AcceptMembershipInvite(
+                                invite *UserOrgRole) error {
+    invitetable := new(sqlMembershipInvite)
+    invitetable.UserOrgRole = *invite
+    Tx := sqlds.DBConn.MustBegin()
+    err := invitetable.acceptInviteEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)DeleteMembershipInvite(
+                                invite *UserOrgRole) error {
+    invitetable := new(sqlMembershipInvite)
+    invitetable.UserOrgRole = *invite
+    return invitetable.deleteInviteEntry(sqlds, sqlds.DBConn)
+}
+
+func (sqlds *postgreSqlDataStore)CreateRole(rl *Role) error {
+    roletable := new(sqlRole)
+    roletable.Role = *rl
+    Tx := sqlds.DBConn.MustBegin()
+    err := roletable.createRoleDefEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *rl = roletable.Role
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetRole(rl *Role) error {
+    roletable := new(sqlRole)
+    roletable.Role = *rl
+    err := roletable.getRoleDefEntry(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *rl = roletable.Role
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListRoles() ([]Role, error) {
+    roletable := new(sqlRole)
+    return roletable.getAllRoleDefEntries(sqlds, sqlds.DBConn)
+}
+
+func (sqlds *postgreSqlDataStore)UpdateRole(rl *Role) error {
+    roletable := new(sqlRole)
+    roletable.Role = *rl
+    Tx := sqlds.DBConn.MustBegin()
+    err := roletable.updateRoleDefEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *rl = roletable.Role
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)DeleteRole(rl *Role) error {
+    roletable := new(sqlRole)
+    roletable.Role = *rl
+    Tx := sqlds.DBConn.MustBegin()
+    err := roletable.deleteRoleDefEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)CreateShiftTemplate(
+                                            tmpl *ShiftTemplate) error {
+    tmpltable := new(sqlShiftTemplate)
+    tmpltable.ShiftTemplate = *tmpl
+    Tx := sqlds.DBConn.MustBegin()
+    err := tmpltable.createShiftTemplateEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *tmpl = tmpltable.ShiftTemplate
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetShiftTemplate(tmpl *ShiftTemplate) error {
+    tmpltable := new(sqlShiftTemplate)
+    tmpltable.ShiftTemplate = *tmpl
+    err := tmpltable.getShiftTemplateByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *tmpl = tmpltable.ShiftTemplate
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListShiftTemplates(
+                        orgUUID syncParam.UUID) ([]ShiftTemplate, error) {
+    tmpltable := new(sqlShiftTemplate)
+    return tmpltable.getShiftTemplatesByOrg(sqlds, sqlds.DBConn, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteShiftTemplate(
+                                            tmpl *ShiftTemplate) error {
+    tmpltable := new(sqlShiftTemplate)
+    tmpltable.ShiftTemplate = *tmpl
+    Tx := sqlds.DBConn.MustBegin()
+    err := tmpltable.deleteShiftTemplateEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateShift(shift *Shift) error {
+    shifttable := new(sqlShift)
+    shifttable.Shift = *shift
+    Tx := sqlds.DBConn.MustBegin()
+    err := shifttable.createShiftEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *shift = shifttable.Shift
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetShift(shift *Shift) error {
+    shifttable := new(sqlShift)
+    shifttable.Shift = *shift
+    err := shifttable.getShiftByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *shift = shifttable.Shift
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListShifts(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]Shift, error) {
+    shifttable := new(sqlShift)
+    return shifttable.getShiftsByOrgRange(sqlds, sqlds.DBConn, orgUUID,
+                                          from, to)
+}
+
+func (sqlds *postgreSqlDataStore)ListUserShifts(userid string,
+                        from time.Time, to time.Time) ([]Shift, error) {
+    shifttable := new(sqlShift)
+    return shifttable.getShiftsByUserRange(sqlds, sqlds.DBConn, userid,
+                                           from, to)
+}
+
+func (sqlds *postgreSqlDataStore)CancelShift(shift *Shift) error {
+    shifttable := new(sqlShift)
+    shifttable.Shift = *shift
+    Tx := sqlds.DBConn.MustBegin()
+    err := shifttable.cancelShiftEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *shift = shifttable.Shift
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    rostertable := new(sqlRosterAssignment)
+    rostertable.RosterAssignment = *asgn
+    Tx := sqlds.DBConn.MustBegin()
+    err := rostertable.createRosterEntry(sqlds, Tx)
     if err != nil {
         Tx.Rollback()
         return err
     }
     Tx.Commit()
+    *asgn = rostertable.RosterAssignment
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateRoster(shifts []*Shift,
+                                              users [][]string) error {
+    if len(shifts) != len(users) {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    created := make([]Shift, len(shifts))
+    leavetable := new(sqlLeaveRequest)
+    Tx := sqlds.DBConn.MustBegin()
+    for i, shift := range(shifts) {
+        shifttable := new(sqlShift)
+        shifttable.Shift = *shift
+        err := shifttable.createShiftEntry(sqlds, Tx)
+        if err != nil {
+            Tx.Rollback()
+            return err
+        }
+        for _, userid := range(users[i]) {
+            err = leavetable.checkLeaveConflict(sqlds, Tx, userid,
+                                                shift.startTime, shift.endTime)
+            if err == nil {
+                err = checkSkillRequirement(sqlds, Tx, userid,
+                                            &shifttable.Shift)
+            }
+            if err == nil {
+                rostertable := new(sqlRosterAssignment)
+                rostertable.RosterAssignment = *NewRosterAssignment(
+                                shifttable.uuid, shift.orgUUID, userid)
+                err = rostertable.createRosterEntry(sqlds, Tx)
+            }
+            if err != nil {
+                Tx.Rollback()
+                return err
+            }
+        }
+        err = shifttable.getShiftByUUID(sqlds, Tx)
+        if err != nil {
+            Tx.Rollback()
+            return err
+        }
+        created[i] = shifttable.Shift
+    }
+    err := Tx.Commit()
+    if err != nil {
+        return err
+    }
+    for i := range(shifts) {
+        *shifts[i] = created[i]
+    }
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListShiftRoster(
+                    shiftUUID syncParam.UUID) ([]RosterAssignment, error) {
+    rostertable := new(sqlRosterAssignment)
+    return rostertable.getRosterByShift(sqlds, sqlds.DBConn, shiftUUID)
+}
+
+func (sqlds *postgreSqlDataStore)ListUserRoster(userid string,
+                    from time.Time, to time.Time) ([]RosterAssignment, error) {
+    rostertable := new(sqlRosterAssignment)
+    return rostertable.getRosterByUserRange(sqlds, sqlds.DBConn, userid,
+                                            from, to)
+}
+
+func (sqlds *postgreSqlDataStore)GetRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    rostertable := new(sqlRosterAssignment)
+    rostertable.RosterAssignment = *asgn
+    err := rostertable.getRosterByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *asgn = rostertable.RosterAssignment
     return nil
 }
 
+func (sqlds *postgreSqlDataStore)DeleteRosterAssignment(
+                                        asgn *RosterAssignment) error {
+    rostertable := new(sqlRosterAssignment)
+    rostertable.RosterAssignment = *asgn
+    Tx := sqlds.DBConn.MustBegin()
+    err := rostertable.deleteRosterEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateShiftPattern(pat *ShiftPattern) error {
+    pattable := new(sqlShiftPattern)
+    pattable.ShiftPattern = *pat.clone()
+    Tx := sqlds.DBConn.MustBegin()
+    err := pattable.createShiftPatternEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *pat = pattable.ShiftPattern
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetShiftPattern(pat *ShiftPattern) error {
+    pattable := new(sqlShiftPattern)
+    pattable.ShiftPattern = *pat
+    err := pattable.getShiftPatternByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *pat = pattable.ShiftPattern
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListShiftPatterns(
+                        orgUUID syncParam.UUID) ([]ShiftPattern, error) {
+    pattable := new(sqlShiftPattern)
+    return pattable.getShiftPatternsByOrg(sqlds, sqlds.DBConn, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteShiftPattern(pat *ShiftPattern) error {
+    pattable := new(sqlShiftPattern)
+    pattable.ShiftPattern = *pat
+    Tx := sqlds.DBConn.MustBegin()
+    err := pattable.deleteShiftPatternEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ExpandShiftPattern(pat *ShiftPattern,
+                        from time.Time, to time.Time,
+                        owner string) ([]Shift, error) {
+    pattable := new(sqlShiftPattern)
+    pattable.ShiftPattern = *pat
+    Tx := sqlds.DBConn.MustBegin()
+    shifts, err := pattable.expandShiftPatternEntry(sqlds, Tx, from, to,
+                                                    owner)
+    if err != nil {
+        Tx.Rollback()
+        return nil, err
+    }
+    Tx.Commit()
+    *pat = pattable.ShiftPattern
+    return shifts, nil
+}
+
+func (sqlds *postgreSqlDataStore)ListPatternOccurrences(
+                        patternUUID syncParam.UUID, from time.Time,
+                        to time.Time) ([]PatternOccurrence, error) {
+    entries, err := getPatternOccurrences(sqlds, sqlds.DBConn, patternUUID,
+                                          from, to)
+    if err != nil {
+        return nil, err
+    }
+    occs := make([]PatternOccurrence, 0, len(entries))
+    for _, occ := range(entries) {
+        occs = append(occs, *occ)
+    }
+    return occs, nil
+}
+
+func (sqlds *postgreSqlDataStore)EditShiftPattern(edit *PatternEdit) error {
+    pattable := new(sqlShiftPattern)
+    result := *edit
+    Tx := sqlds.DBConn.MustBegin()
+    err := pattable.editShiftPatternEntry(sqlds, Tx, &result)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *edit = result
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateAvailability(
+                                            avail *Availability) error {
+    availtable := new(sqlAvailability)
+    availtable.Availability = *avail
+    Tx := sqlds.DBConn.MustBegin()
+    err := availtable.createAvailabilityEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *avail = availtable.Availability
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetAvailability(avail *Availability) error {
+    availtable := new(sqlAvailability)
+    availtable.Availability = *avail
+    err := availtable.getAvailabilityByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *avail = availtable.Availability
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListUserAvailability(
+                                userid string) ([]Availability, error) {
+    availtable := new(sqlAvailability)
+    return availtable.getAvailabilityByUser(sqlds, sqlds.DBConn, userid)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteAvailability(
+                                            avail *Availability) error {
+    availtable := new(sqlAvailability)
+    availtable.Availability = *avail
+    Tx := sqlds.DBConn.MustBegin()
+    err := availtable.deleteAvailabilityEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)ListAvailableUsers(orgUUID syncParam.UUID,
+                                from time.Time, to time.Time) ([]string, error) {
+    availtable := new(sqlAvailability)
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    return availtable.getAvailableUsers(sqlds, Tx, orgUUID, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)SetUserSkill(skill *UserSkill) error {
+    skilltable := new(sqlUserSkill)
+    skilltable.UserSkill = *skill
+    Tx := sqlds.DBConn.MustBegin()
+    err := skilltable.setUserSkillEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *skill = skilltable.UserSkill
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetUserSkill(skill *UserSkill) error {
+    skilltable := new(sqlUserSkill)
+    skilltable.UserSkill = *skill
+    err := skilltable.getUserSkillEntry(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *skill = skilltable.UserSkill
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListUserSkills(
+                                userid string) ([]UserSkill, error) {
+    return getUserSkills(sqlds, sqlds.DBConn, userid)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteUserSkill(skill *UserSkill) error {
+    skilltable := new(sqlUserSkill)
+    skilltable.UserSkill = *skill
+    Tx := sqlds.DBConn.MustBegin()
+    err := skilltable.deleteUserSkillEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *skill = skilltable.UserSkill
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListQualifiedUsers(orgUUID syncParam.UUID,
+                                skills []string, from time.Time,
+                                to time.Time) ([]string, error) {
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    return getQualifiedUsers(sqlds, Tx, orgUUID, skills, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)ListExpiringSkills(orgUUID syncParam.UUID,
+                                from time.Time,
+                                to time.Time) ([]UserSkill, error) {
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    return getExpiringSkills(sqlds, Tx, orgUUID, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)CheckSkillRequirement(userid string,
+                                                       shift *Shift) error {
+    return checkSkillRequirement(sqlds, sqlds.DBConn, userid, shift)
+}
+
+func (sqlds *postgreSqlDataStore)CreateLeavePolicy(
+                                            policy *LeavePolicy) error {
+    policytable := new(sqlLeavePolicy)
+    policytable.LeavePolicy = *policy
+    Tx := sqlds.DBConn.MustBegin()
+    err := policytable.createLeavePolicyEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *policy = policytable.LeavePolicy
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetLeavePolicy(policy *LeavePolicy) error {
+    policytable := new(sqlLeavePolicy)
+    policytable.LeavePolicy = *policy
+    err := policytable.getLeavePolicyByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *policy = policytable.LeavePolicy
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListLeavePolicies(
+                        orgUUID syncParam.UUID) ([]LeavePolicy, error) {
+    policytable := new(sqlLeavePolicy)
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    return policytable.getLeavePoliciesByOrg(sqlds, Tx, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteLeavePolicy(
+                                            policy *LeavePolicy) error {
+    policytable := new(sqlLeavePolicy)
+    policytable.LeavePolicy = *policy
+    Tx := sqlds.DBConn.MustBegin()
+    err := policytable.deleteLeavePolicyEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)GetLeaveBalance(bal *LeaveBalance) error {
+    baltable := new(sqlLeaveBalance)
+    baltable.LeaveBalance = *bal
+    Tx := sqlds.DBConn.MustBegin()
+    policytable := new(sqlLeavePolicy)
+    policytable.uuid = bal.policyUUID
+    err := policytable.getLeavePolicyByUUID(sqlds, Tx)
+    if err == nil {
+        err = baltable.getLeaveBalanceEntry(sqlds, Tx,
+                                            &policytable.LeavePolicy,
+                                            time.Now())
+    }
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *bal = baltable.LeaveBalance
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)AdjustLeaveBalance(bal *LeaveBalance,
+                                            delta time.Duration) error {
+    baltable := new(sqlLeaveBalance)
+    baltable.LeaveBalance = *bal
+    Tx := sqlds.DBConn.MustBegin()
+    err := baltable.adjustLeaveBalanceEntry(sqlds, Tx, delta)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *bal = baltable.LeaveBalance
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateLeaveRequest(
+                                            leave *LeaveRequest) error {
+    leavetable := new(sqlLeaveRequest)
+    leavetable.LeaveRequest = *leave
+    Tx := sqlds.DBConn.MustBegin()
+    err := leavetable.createLeaveEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *leave = leavetable.LeaveRequest
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetLeaveRequest(leave *LeaveRequest) error {
+    leavetable := new(sqlLeaveRequest)
+    leavetable.LeaveRequest = *leave
+    err := leavetable.getLeaveByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *leave = leavetable.LeaveRequest
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListUserLeave(userid string, from time.Time,
+                                to time.Time) ([]LeaveRequest, error) {
+    leavetable := new(sqlLeaveRequest)
+    return leavetable.getLeavesByUserRange(sqlds, sqlds.DBConn, userid, 0,
+                                           from, to)
+}
+
+func (sqlds *postgreSqlDataStore)ListOrgLeave(orgUUID syncParam.UUID,
+                        status LeaveStatusBit) ([]LeaveRequest, error) {
+    leavetable := new(sqlLeaveRequest)
+    return leavetable.getLeavesByOrgStatus(sqlds, sqlds.DBConn, orgUUID,
+                                           status)
+}
+
+func (sqlds *postgreSqlDataStore)UpdateLeaveStatus(leave *LeaveRequest,
+                        status LeaveStatusBit, decidedBy string) error {
+    leavetable := new(sqlLeaveRequest)
+    leavetable.LeaveRequest = *leave
+    Tx := sqlds.DBConn.MustBegin()
+    err := leavetable.updateLeaveStatusEntry(sqlds, Tx, status, decidedBy)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *leave = leavetable.LeaveRequest
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListUserBusy(userid string, from time.Time,
+                                to time.Time) ([]LeaveRequest, error) {
+    leavetable := new(sqlLeaveRequest)
+    return leavetable.getLeavesByUserRange(sqlds, sqlds.DBConn, userid,
+                                           LEAVE_APPROVED, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)CheckLeaveConflict(userid string,
+                                from time.Time, to time.Time) error {
+    leavetable := new(sqlLeaveRequest)
+    return leavetable.checkLeaveConflict(sqlds, sqlds.DBConn, userid, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)SetSwapSettings(
+                                settings *SwapSettings) error {
+    settingstable := new(sqlSwapSettings)
+    settingstable.SwapSettings = *settings
+    Tx := sqlds.DBConn.MustBegin()
+    err := settingstable.setSwapSettingsEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *settings = settingstable.SwapSettings
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetSwapSettings(
+                                settings *SwapSettings) error {
+    settingstable := new(sqlSwapSettings)
+    settingstable.SwapSettings = *settings
+    err := settingstable.getSwapSettingsEntry(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *settings = settingstable.SwapSettings
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)CreateSwapOffer(offer *SwapOffer) error {
+    offertable := new(sqlSwapOffer)
+    offertable.SwapOffer = *offer
+    Tx := sqlds.DBConn.MustBegin()
+    err := offertable.createSwapOfferEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *offer = offertable.SwapOffer
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetSwapOffer(offer *SwapOffer) error {
+    offertable := new(sqlSwapOffer)
+    offertable.SwapOffer = *offer
+    err := offertable.getSwapOfferByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *offer = offertable.SwapOffer
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListOrgSwapOffers(orgUUID syncParam.UUID,
+                        status SwapStatusBit) ([]SwapOffer, error) {
+    offertable := new(sqlSwapOffer)
+    return offertable.getSwapOffersByOrgStatus(sqlds, sqlds.DBConn, orgUUID,
+                                               status)
+}
+
+func (sqlds *postgreSqlDataStore)UpdateSwapStatus(offer *SwapOffer,
+                        status SwapStatusBit, userid string,
+                        note string) error {
+    offertable := new(sqlSwapOffer)
+    offertable.SwapOffer = *offer
+    Tx := sqlds.DBConn.MustBegin()
+    err := offertable.updateSwapStatusEntry(sqlds, Tx, status, userid, note)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *offer = offertable.SwapOffer
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListSwapAudit(
+                        offerUUID syncParam.UUID) ([]SwapAudit, error) {
+    audittable := new(sqlSwapAudit)
+    return audittable.getSwapAuditByOffer(sqlds, sqlds.DBConn, offerUUID)
+}
+
+func (sqlds *postgreSqlDataStore)ListOrgSwapAudit(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]SwapAudit, error) {
+    audittable := new(sqlSwapAudit)
+    return audittable.getSwapAuditByOrgRange(sqlds, sqlds.DBConn, orgUUID,
+                                             from, to)
+}
+
+func (sqlds *postgreSqlDataStore)CreateOnCallRotation(
+                                rot *OnCallRotation) error {
+    rottable := new(sqlOnCallRotation)
+    rottable.OnCallRotation = *rot
+    Tx := sqlds.DBConn.MustBegin()
+    err := rottable.createOnCallRotationEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *rot = rottable.OnCallRotation
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetOnCallRotation(
+                                rot *OnCallRotation) error {
+    rottable := new(sqlOnCallRotation)
+    rottable.OnCallRotation = *rot
+    err := rottable.getOnCallRotationByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *rot = rottable.OnCallRotation
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListOnCallRotations(
+                        orgUUID syncParam.UUID) ([]OnCallRotation, error) {
+    rottable := new(sqlOnCallRotation)
+    return rottable.getOnCallRotationsByOrg(sqlds, sqlds.DBConn, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteOnCallRotation(
+                                rot *OnCallRotation) error {
+    rottable := new(sqlOnCallRotation)
+    rottable.OnCallRotation = *rot
+    Tx := sqlds.DBConn.MustBegin()
+    err := rottable.deleteOnCallRotationEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)CreateOnCallOverride(
+                                ovr *OnCallOverride) error {
+    ovrtable := new(sqlOnCallOverride)
+    ovrtable.OnCallOverride = *ovr
+    Tx := sqlds.DBConn.MustBegin()
+    err := ovrtable.createOnCallOverrideEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    err = Tx.Commit()
+    if err != nil {
+        return err
+    }
+    *ovr = ovrtable.OnCallOverride
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetOnCallOverride(
+                                ovr *OnCallOverride) error {
+    ovrtable := new(sqlOnCallOverride)
+    ovrtable.OnCallOverride = *ovr
+    err := ovrtable.getOnCallOverrideByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *ovr = ovrtable.OnCallOverride
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListOnCallOverrides(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]OnCallOverride, error) {
+    ovrtable := new(sqlOnCallOverride)
+    return ovrtable.getOnCallOverridesByOrgRange(sqlds, sqlds.DBConn, orgUUID,
+                                                 from, to)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteOnCallOverride(
+                                ovr *OnCallOverride) error {
+    ovrtable := new(sqlOnCallOverride)
+    ovrtable.OnCallOverride = *ovr
+    Tx := sqlds.DBConn.MustBegin()
+    err := ovrtable.deleteOnCallOverrideEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)SetEscalationPolicy(
+                                policy *EscalationPolicy) error {
+    policytable := new(sqlEscalationPolicy)
+    policytable.EscalationPolicy = *policy
+    Tx := sqlds.DBConn.MustBegin()
+    err := policytable.setEscalationPolicyEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)GetEscalationPolicy(
+                                policy *EscalationPolicy) error {
+    policytable := new(sqlEscalationPolicy)
+    policytable.EscalationPolicy = *policy
+    err := policytable.getEscalationPolicyEntry(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *policy = policytable.EscalationPolicy
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)DeleteEscalationPolicy(
+                                policy *EscalationPolicy) error {
+    policytable := new(sqlEscalationPolicy)
+    policytable.EscalationPolicy = *policy
+    return policytable.deleteEscalationPolicyEntry(sqlds, sqlds.DBConn)
+}
+
+func (sqlds *postgreSqlDataStore)WhoIsOnCall(orgUUID syncParam.UUID,
+                                at time.Time) (*OnCall, error) {
+    Tx := sqlds.DBConn.MustBegin()
+    defer Tx.Rollback()
+    return whoIsOnCall(sqlds, Tx, orgUUID, at)
+}
+
+func (sqlds *postgreSqlDataStore)CreateHolidayCalendar(
+                                cal *HolidayCalendar) error {
+    caltable := new(sqlHolidayCalendar)
+    caltable.HolidayCalendar = *cal
+    Tx := sqlds.DBConn.MustBegin()
+    err := caltable.createHolidayCalendarEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *cal = caltable.HolidayCalendar
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetHolidayCalendar(
+                                cal *HolidayCalendar) error {
+    caltable := new(sqlHolidayCalendar)
+    caltable.HolidayCalendar = *cal
+    err := caltable.getHolidayCalendarByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *cal = caltable.HolidayCalendar
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListHolidayCalendars(
+                        orgUUID syncParam.UUID) ([]HolidayCalendar, error) {
+    caltable := new(sqlHolidayCalendar)
+    return caltable.getHolidayCalendarsByOrg(sqlds, sqlds.DBConn, orgUUID)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteHolidayCalendar(
+                                cal *HolidayCalendar) error {
+    caltable := new(sqlHolidayCalendar)
+    caltable.HolidayCalendar = *cal
+    return caltable.deleteHolidayCalendarEntry(sqlds, sqlds.DBConn)
+}
+
+func (sqlds *postgreSqlDataStore)CreateHoliday(hol *Holiday) error {
+    holtable := new(sqlHoliday)
+    holtable.Holiday = *hol
+    holtable.imported = false
+    Tx := sqlds.DBConn.MustBegin()
+    err := holtable.createHolidayEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *hol = holtable.Holiday
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetHoliday(hol *Holiday) error {
+    holtable := new(sqlHoliday)
+    holtable.Holiday = *hol
+    err := holtable.getHolidayByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *hol = holtable.Holiday
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)DeleteHoliday(hol *Holiday) error {
+    holtable := new(sqlHoliday)
+    holtable.Holiday = *hol
+    return holtable.deleteHolidayEntry(sqlds, sqlds.DBConn)
+}
+
+func (sqlds *postgreSqlDataStore)ListHolidays(calendarUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]Holiday, error) {
+    return getCalendarHolidays(sqlds, sqlds.DBConn, calendarUUID, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)ImportHolidays(calendarUUID syncParam.UUID,
+                                                hols []Holiday) error {
+    Tx := sqlds.DBConn.MustBegin()
+    err := importHolidayEntries(sqlds, Tx, calendarUUID, hols)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    return Tx.Commit()
+}
+
+func (sqlds *postgreSqlDataStore)ListOrgHolidays(orgUUID syncParam.UUID,
+                        from time.Time, to time.Time) ([]Holiday, error) {
+    return getOrgHolidays(sqlds, sqlds.DBConn, orgUUID, from, to)
+}
+
+func (sqlds *postgreSqlDataStore)IsHoliday(orgUUID syncParam.UUID,
+                                           at time.Time) (*Holiday, error) {
+    return isHoliday(sqlds, sqlds.DBConn, orgUUID, at)
+}
+
+func (sqlds *postgreSqlDataStore)CreateCalendarFeed(feed *CalendarFeed) error {
+    feedtable := new(sqlCalendarFeed)
+    feedtable.CalendarFeed = *feed
+    Tx := sqlds.DBConn.MustBegin()
+    err := feedtable.createFeedEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *feed = feedtable.CalendarFeed
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetCalendarFeed(feed *CalendarFeed) error {
+    feedtable := new(sqlCalendarFeed)
+    feedtable.CalendarFeed = *feed
+    err := feedtable.getFeedByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *feed = feedtable.CalendarFeed
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)ListUserCalendarFeeds(
+                                userid string) ([]CalendarFeed, error) {
+    feedtable := new(sqlCalendarFeed)
+    return feedtable.getFeedsByUser(sqlds, sqlds.DBConn, userid)
+}
+
+func (sqlds *postgreSqlDataStore)DeleteCalendarFeed(feed *CalendarFeed) error {
+    feedtable := new(sqlCalendarFeed)
+    feedtable.CalendarFeed = *feed
+    return feedtable.deleteFeedEntry(sqlds, sqlds.DBConn)
+}
+
+func (sqlds *postgreSqlDataStore)CreateSession(sess *Session) error {
+    sessiontable := new(sqlSession)
+    sessiontable.Session = *sess
+    Tx := sqlds.DBConn.MustBegin()
+    err := sessiontable.createSessionEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *sess = sessiontable.Session
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)GetSession(sess *Session) error {
+    sessiontable := new(sqlSession)
+    sessiontable.Session = *sess
+    err := sessiontable.getSessionByUUID(sqlds, sqlds.DBConn)
+    if err != nil {
+        return err
+    }
+    *sess = sessiontable.Session
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)RotateSession(sess *Session,
+                                               oldHash string) error {
+    sessiontable := new(sqlSession)
+    sessiontable.Session = *sess
+    Tx := sqlds.DBConn.MustBegin()
+    err := sessiontable.rotateSessionEntry(sqlds, Tx, oldHash)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)RevokeSession(sess *Session) error {
+    sessiontable := new(sqlSession)
+    sessiontable.Session = *sess
+    Tx := sqlds.DBConn.MustBegin()
+    err := sessiontable.revokeSessionEntry(sqlds, Tx)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    *sess = sessiontable.Session
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)RevokeUserSessions(userid string) error {
+    sessiontable := new(sqlSession)
+    Tx := sqlds.DBConn.MustBegin()
+    err := sessiontable.revokeUserSessions(sqlds, Tx, userid)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+func (sqlds *postgreSqlDataStore)DeleteExpiredSessions(before time.Time) error {
+    sessiontable := new(sqlSession)
+    Tx := sqlds.DBConn.MustBegin()
+    err := sessiontable.deleteExpiredSessions(sqlds, Tx, before)
+    if err != nil {
+        Tx.Rollback()
+        return err
+    }
+    Tx.Commit()
+    return nil
+}
+
+//Bind the instants of the statement in UTC. The time columns are timestamptz
+// in postgreSQL, but SQLite compares the times as text, hence the instants
+// must be in a single zone to compare them in the order of time.
+func utcArgs(args []interface{}) []interface{} {
+    for i, arg := range(args) {
+        switch tm := arg.(type) {
+            case time.Time:
+                args[i] = tm.UTC()
+            case sql.NullTime:
+                tm.Time = tm.Time.UTC()
+                args[i] = tm
+        }
+    }
+    return args
+}
+
 // Exec operation on a postgreSQL DB can be either transactional or non-
 // transactional. Helper function to find right exec function based on dbhandle
 //type. Application not allowed to invoke db backend 'Exec' function. Instead
@@ -146,9 +1501,13 @@ func (sqlds *postgreSqlDataStore)getDBExecFunction(
     var execPtr sqlExecFn
     dbhandle, handleOk = handle.(*sqlx.DB)
     if handleOk {
-        execPtr = dbhandle.Exec
+        execPtr = func(query string, args ...interface{}) (sql.Result, error) {
+            return dbhandle.Exec(query, utcArgs(args)...)
+        }
     } else if dbtxhandle, handleOk = handle.(*sqlx.Tx); handleOk {
-        execPtr = dbtxhandle.Exec
+        execPtr = func(query string, args ...interface{}) (sql.Result, error) {
+            return dbtxhandle.Exec(query, utcArgs(args)...)
+        }
     } else {
         sqlds.dblogger.Error(
             "Failed to execute delete operation , Invalid DB handle")
@@ -172,9 +1531,15 @@ func (sqlds *postgreSqlDataStore)getDBGetFunction(
     var getPtr sqlGetFn
     dbhandle, handleOk = handle.(*sqlx.DB)
     if handleOk {
-        getPtr = dbhandle.Get
+        getPtr = func(dest interface{}, query string,
+                      args ...interface{}) error {
+            return dbhandle.Get(dest, query, utcArgs(args)...)
+        }
     } else if dbtxhandle, handleOk = handle.(*sqlx.Tx); handleOk {
-        getPtr = dbtxhandle.Get
+        getPtr = func(dest interface{}, query string,
+                      args ...interface{}) error {
+            return dbtxhandle.Get(dest, query, utcArgs(args)...)
+        }
     } else {
         sqlds.dblogger.Error(
             "Failed to execute delete operation , Invalid DB handle")
@@ -198,9 +1563,15 @@ func (sqlds *postgreSqlDataStore)getDBSelectFunction(
     var selectPtr sqlSelectFn
     dbhandle, handleOk = handle.(*sqlx.DB)
     if handleOk {
-        selectPtr = dbhandle.Get
+        selectPtr = func(dest interface{}, query string,
+                         args ...interface{}) error {
+            return dbhandle.Select(dest, query, utcArgs(args)...)
+        }
     } else if dbtxhandle, handleOk = handle.(*sqlx.Tx); handleOk {
-        selectPtr = dbtxhandle.Get
+        selectPtr = func(dest interface{}, query string,
+                         args ...interface{}) error {
+            return dbtxhandle.Select(dest, query, utcArgs(args)...)
+        }
     } else {
         sqlds.dblogger.Error(
             "Failed to execute delete operation , Invalid DB handle")
@@ -15,35 +15,125 @@
 package datastore
 
 import (
+    "DutyRoster/syncParam"
 )
 
 // Each bit is reserved for a role type, its is only possible to have hierarchy
 // of maximum 64 levels as the roletype is 64 bit integer.
-// Adding role to this bitmap should be in hierarchical order as no role should
-// be placed after ROOTADMIN.
-type rolebit uint64
+// The system roles below are in hierarchical order, a higher bit has all the
+// rights of lower bits. Custom roles are created at runtime on the free bits
+// above ROOTADMIN, they are not part of the hierarchy and have only the
+// permissions listed in the role.
+type RoleBit uint64
 
 const (
-    ENDUSER rolebit = 1 << iota
-    MANAGER rolebit = 1 << iota
+    ENDUSER RoleBit = 1 << iota
+    MANAGER RoleBit = 1 << iota
     // The application admin, who has access to all the datasets.
     ROOTADMIN
 )
 
+//Last bit that can be used for a role. The top bit is not used, as the DB
+// stores roletype as signed 64 bit integer.
+const MAX_ROLEBIT RoleBit = 1 << 62
+
+//Names of the system roles, seeded in the datastore.
+const (
+    ENDUSER_ROLE_NAME = "enduser"
+    MANAGER_ROLE_NAME = "manager"
+    ROOTADMIN_ROLE_NAME = "rootadmin"
+)
+
 //User role in the application. User can have any role in the above list.
 //It is possible to one user may have more than one role.
 type roles struct {
-    roleType rolebit
+    roleType RoleBit
 }
 
 // Validate the rolebitset is valid.
-// Return true for a valid rolebitset and false otherwise.
+// Return true for a valid rolebitset and false otherwise. The roles are not
+// validated against the roles in datastore.
 func (rl *roles)IsRoleBitsetValid() bool{
-    //Assuming there are no role bit present after rootadmin.
-    var maxRole rolebit = (ROOTADMIN << 1) - 1 //All 0xFs.
-    var minRole rolebit = ENDUSER
+    var maxRole RoleBit = (MAX_ROLEBIT << 1) - 1 //All 0xFs.
+    var minRole RoleBit = ENDUSER
     if rl.roleType < minRole || rl.roleType > maxRole {
         return false
     }
     return true
-}
\ No newline at end of file
+}
+
+//Return true if the role bit is a system role.
+func IsSystemRoleBit(bit RoleBit) bool {
+    return bit >= ENDUSER && bit <= ROOTADMIN
+}
+
+//Definition of a role with its name and permissions. System roles are seeded
+// by the application and cannot be modified.
+type Role struct {
+    roles
+    name string
+    //Actions allowed by a custom role, the system roles have no permissions
+    // list as their actions are defined by the application.
+    permissions []string
+    //Custom role can be granted only in the org/unit and its descendants.
+    //Empty uuid for a role that can be granted in any org/unit.
+    orgUUID syncParam.UUID
+    system bool
+}
+
+//Create a custom role, the role bit is populated when the role is created in
+// the datastore.
+func NewRole(name string, permissions []string,
+             orgUUID syncParam.UUID) *Role {
+    rl := new(Role)
+    rl.name = name
+    rl.permissions = permissions
+    rl.orgUUID = orgUUID
+    return rl
+}
+
+//Role that only carries the role bit, used to get/delete the role.
+func NewRoleRef(roleType RoleBit) *Role {
+    rl := new(Role)
+    rl.roleType = roleType
+    return rl
+}
+
+func (rl *Role)RoleType() RoleBit {
+    return rl.roleType
+}
+
+func (rl *Role)Name() string {
+    return rl.name
+}
+
+func (rl *Role)Permissions() []string {
+    return rl.permissions
+}
+
+func (rl *Role)OrgUUID() syncParam.UUID {
+    return rl.orgUUID
+}
+
+func (rl *Role)IsSystem() bool {
+    return rl.system
+}
+
+//Only name and permissions are allowed to modify on a custom role.
+func (rl *Role)SetName(name string) {
+    rl.name = name
+}
+
+func (rl *Role)SetPermissions(permissions []string) {
+    rl.permissions = permissions
+}
+
+//Return true if the permission is in the permissions list of role.
+func (rl *Role)HasPermission(permission string) bool {
+    for _, perm := range(rl.permissions) {
+        if perm == permission {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,111 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package datastore
+
+import (
+    "time"
+    "DutyRoster/syncParam"
+)
+
+type SessionStatusBit uint64
+
+const (
+    SESSION_ACTIVE SessionStatusBit = 1 << iota
+    //Last entry in the session status. Do not add anything below revoke status.
+    SESSION_REVOKED SessionStatusBit = 1 << iota
+)
+
+//Login session of a user. Access tokens are issued on the session, a revoked
+// session is kept until its expiry to reject the tokens issued on it.
+type Session struct {
+    uuid syncParam.UUID
+    userid string
+    //Hash of the refresh token secret, the secret itself is never stored.
+    refreshHash string
+    //timestamp when the user is logged in.
+    createTime time.Time
+    //Refresh token is not accepted after expiry, the session is removed once
+    // expired.
+    expiryTime time.Time
+    status SessionStatusBit
+}
+
+//Create a session for user 'userid'. uuid and createTime are populated when
+// the session is created in the datastore.
+func NewSession(userid string, refreshHash string,
+                expiryTime time.Time) *Session {
+    sess := new(Session)
+    sess.userid = userid
+    sess.refreshHash = refreshHash
+    sess.expiryTime = expiryTime
+    sess.status = SESSION_ACTIVE
+    return sess
+}
+
+//Session that only carries the uuid, used to get/revoke the session.
+func NewSessionRef(uuid syncParam.UUID) *Session {
+    sess := new(Session)
+    sess.uuid = uuid
+    return sess
+}
+
+func (sess *Session)UUID() syncParam.UUID {
+    return sess.uuid
+}
+
+func (sess *Session)Userid() string {
+    return sess.userid
+}
+
+func (sess *Session)RefreshHash() string {
+    return sess.refreshHash
+}
+
+func (sess *Session)CreateTime() time.Time {
+    return sess.createTime
+}
+
+func (sess *Session)ExpiryTime() time.Time {
+    return sess.expiryTime
+}
+
+func (sess *Session)Status() SessionStatusBit {
+    return sess.status
+}
+
+//Only refresh hash and expiry are allowed to modify, on refresh token
+// rotation.
+func (sess *Session)SetRefreshHash(refreshHash string) {
+    sess.refreshHash = refreshHash
+}
+
+func (sess *Session)SetExpiryTime(expiryTime time.Time) {
+    sess.expiryTime = expiryTime
+}
+
+//Return true if session is not revoked and not expired at 'now'.
+func (sess *Session)IsActive(now time.Time) bool {
+    return sess.status & SESSION_REVOKED == 0 && now.Before(sess.expiryTime)
+}
+
+//Validate the session fields before storing it.
+func (sess *Session)IsSessionValid() bool {
+    if len(sess.userid) == 0 || len(sess.refreshHash) == 0 ||
+        sess.expiryTime.IsZero() || sess.status == 0 {
+        return false
+    }
+    return true
+}
@@ -0,0 +1,317 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "time"
+    "DutyRoster/syncParam"
+)
+
+type ShiftStatusBit uint64
+
+const (
+    SHIFT_SCHEDULED ShiftStatusBit = 1 << iota
+    SHIFT_PUBLISHED ShiftStatusBit = 1 << iota
+    //Last entry in the shift status. Do not add anything below cancel status.
+    SHIFT_CANCELLED ShiftStatusBit = 1 << iota
+)
+
+//Template for a shift that repeats in an org/unit, eg: 'Night shift' starts at
+// 22:00 and lasts for 8 hours. Shifts are generated from the templates.
+type ShiftTemplate struct {
+    uuid syncParam.UUID
+    //org/unit that owns the template.
+    orgUUID syncParam.UUID
+    name string
+    //Start of the shift as an offset from the start of the day.
+    startOffset time.Duration
+    duration time.Duration
+    //Days of week the template applies, one bit for each time.Weekday.
+    //Store 0 to apply the template on all days.
+    weekdays uint64
+    //Minimum number of users to be on duty for the shift.
+    minStaff uint64
+    //userid of user who created the template.
+    owner string
+    //Skills a user must hold for the whole shift to work it, sorted on name.
+    skills []string
+}
+
+//A single shift in an org/unit with its start and end time.
+type Shift struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    //Template that generated the shift, Empty UUID for adhoc shifts.
+    templateUUID syncParam.UUID
+    startTime time.Time
+    endTime time.Time
+    //Minimum number of users to be on duty for the shift.
+    minStaff uint64
+    status ShiftStatusBit
+    //userid of user who created the shift.
+    owner string
+    //timestamp when the shift is created.
+    createTime time.Time
+    //Revision of the shift, bumped on every change to the shift or its
+    // roster. Calendar feeds use it as the event sequence.
+    sequence uint64
+    //timestamp of the last revision, same as createTime for a new shift.
+    modifyTime time.Time
+}
+
+//Assignment of a user to a shift in the roster.
+type RosterAssignment struct {
+    uuid syncParam.UUID
+    shiftUUID syncParam.UUID
+    orgUUID syncParam.UUID
+    //userid of the user on duty.
+    userid string
+    //timestamp when the user is assigned to the shift.
+    assignTime time.Time
+}
+
+//Create a shift template for org/unit 'orgUUID'. uuid is populated when the
+// template is created in the datastore.
+func NewShiftTemplate(orgUUID syncParam.UUID, name string,
+                      startOffset time.Duration, duration time.Duration,
+                      weekdays uint64, minStaff uint64,
+                      owner string) *ShiftTemplate {
+    tmpl := new(ShiftTemplate)
+    tmpl.orgUUID = orgUUID
+    tmpl.name = name
+    tmpl.startOffset = startOffset
+    tmpl.duration = duration
+    tmpl.weekdays = weekdays
+    tmpl.minStaff = minStaff
+    tmpl.owner = owner
+    return tmpl
+}
+
+//Shift template that only carries the uuid, used to get/delete the template.
+func NewShiftTemplateRef(uuid syncParam.UUID) *ShiftTemplate {
+    tmpl := new(ShiftTemplate)
+    tmpl.uuid = uuid
+    return tmpl
+}
+
+func (tmpl *ShiftTemplate)UUID() syncParam.UUID {
+    return tmpl.uuid
+}
+
+func (tmpl *ShiftTemplate)OrgUUID() syncParam.UUID {
+    return tmpl.orgUUID
+}
+
+func (tmpl *ShiftTemplate)Name() string {
+    return tmpl.name
+}
+
+func (tmpl *ShiftTemplate)StartOffset() time.Duration {
+    return tmpl.startOffset
+}
+
+func (tmpl *ShiftTemplate)Duration() time.Duration {
+    return tmpl.duration
+}
+
+func (tmpl *ShiftTemplate)Weekdays() uint64 {
+    return tmpl.weekdays
+}
+
+func (tmpl *ShiftTemplate)MinStaff() uint64 {
+    return tmpl.minStaff
+}
+
+func (tmpl *ShiftTemplate)Owner() string {
+    return tmpl.owner
+}
+
+func (tmpl *ShiftTemplate)Skills() []string {
+    return append([]string{}, tmpl.skills...)
+}
+
+//Set the skills required to work the shifts of the template, duplicates are
+// removed.
+func (tmpl *ShiftTemplate)SetSkills(skills []string) {
+    tmpl.skills = NormalizeSkillNames(skills)
+}
+
+//Return true if the template applies on the weekday 'day'.
+func (tmpl *ShiftTemplate)IsOnWeekday(day time.Weekday) bool {
+    if tmpl.weekdays == 0 {
+        return true
+    }
+    return tmpl.weekdays & (1 << uint64(day)) != 0
+}
+
+//Validate the template fields before storing it.
+func (tmpl *ShiftTemplate)IsShiftTemplateValid() bool {
+    if syncParam.IsUUIDEmpty(tmpl.orgUUID) || len(tmpl.name) == 0 ||
+        len(tmpl.owner) == 0 || tmpl.duration <= 0 ||
+        tmpl.startOffset < 0 || tmpl.startOffset >= 24 * time.Hour ||
+        tmpl.weekdays >= (1 << 7) || len(tmpl.skills) > MAX_TEMPLATE_SKILLS {
+        return false
+    }
+    for _, name := range(tmpl.skills) {
+        if !isSkillNameValid(name) {
+            return false
+        }
+    }
+    return true
+}
+
+//Create a shift in org/unit 'orgUUID' between start and end time.
+//templateUUID can be empty for a shift that doesnt follow any template.
+func NewShift(orgUUID syncParam.UUID, templateUUID syncParam.UUID,
+              startTime time.Time, endTime time.Time,
+              minStaff uint64, owner string) *Shift {
+    sh := new(Shift)
+    sh.orgUUID = orgUUID
+    sh.templateUUID = templateUUID
+    sh.startTime = startTime
+    sh.endTime = endTime
+    sh.minStaff = minStaff
+    sh.owner = owner
+    sh.status = SHIFT_SCHEDULED
+    return sh
+}
+
+//Shift that only carries the uuid, used to get/cancel the shift.
+func NewShiftRef(uuid syncParam.UUID) *Shift {
+    sh := new(Shift)
+    sh.uuid = uuid
+    return sh
+}
+
+func (sh *Shift)UUID() syncParam.UUID {
+    return sh.uuid
+}
+
+func (sh *Shift)OrgUUID() syncParam.UUID {
+    return sh.orgUUID
+}
+
+func (sh *Shift)TemplateUUID() syncParam.UUID {
+    return sh.templateUUID
+}
+
+func (sh *Shift)StartTime() time.Time {
+    return sh.startTime
+}
+
+func (sh *Shift)EndTime() time.Time {
+    return sh.endTime
+}
+
+func (sh *Shift)MinStaff() uint64 {
+    return sh.minStaff
+}
+
+func (sh *Shift)Status() ShiftStatusBit {
+    return sh.status
+}
+
+func (sh *Shift)Owner() string {
+    return sh.owner
+}
+
+func (sh *Shift)CreateTime() time.Time {
+    return sh.createTime
+}
+
+func (sh *Shift)Sequence() uint64 {
+    return sh.sequence
+}
+
+func (sh *Shift)ModifyTime() time.Time {
+    return sh.modifyTime
+}
+
+//Move the shift to its next revision at time 'now'.
+func (sh *Shift)bumpRevision(now time.Time) {
+    sh.sequence++
+    sh.modifyTime = now
+}
+
+//Return true if the shift is cancelled.
+func (sh *Shift)IsCancelled() bool {
+    return sh.status & SHIFT_CANCELLED != 0
+}
+
+// Validate the shift status bits are valid.
+// Return true for a valid status and false otherwise.
+func (sh *Shift)IsShiftStatusValid() bool {
+    var maxShiftBit ShiftStatusBit = (SHIFT_CANCELLED << 1) - 1 //All 0xFs.
+    var minShiftBit ShiftStatusBit = SHIFT_SCHEDULED
+    if sh.status < minShiftBit || sh.status > maxShiftBit {
+        return false
+    }
+    return true
+}
+
+//Validate the shift fields before storing it.
+func (sh *Shift)IsShiftValid() bool {
+    if syncParam.IsUUIDEmpty(sh.orgUUID) || len(sh.owner) == 0 ||
+        !sh.endTime.After(sh.startTime) {
+        return false
+    }
+    return sh.IsShiftStatusValid()
+}
+
+//Assign user 'userid' to the shift 'shiftUUID' in org/unit 'orgUUID'.
+func NewRosterAssignment(shiftUUID syncParam.UUID, orgUUID syncParam.UUID,
+                         userid string) *RosterAssignment {
+    asgn := new(RosterAssignment)
+    asgn.shiftUUID = shiftUUID
+    asgn.orgUUID = orgUUID
+    asgn.userid = userid
+    return asgn
+}
+
+//Roster assignment that only carries the uuid, used to delete the assignment.
+func NewRosterAssignmentRef(uuid syncParam.UUID) *RosterAssignment {
+    asgn := new(RosterAssignment)
+    asgn.uuid = uuid
+    return asgn
+}
+
+func (asgn *RosterAssignment)UUID() syncParam.UUID {
+    return asgn.uuid
+}
+
+func (asgn *RosterAssignment)ShiftUUID() syncParam.UUID {
+    return asgn.shiftUUID
+}
+
+func (asgn *RosterAssignment)OrgUUID() syncParam.UUID {
+    return asgn.orgUUID
+}
+
+func (asgn *RosterAssignment)Userid() string {
+    return asgn.userid
+}
+
+func (asgn *RosterAssignment)AssignTime() time.Time {
+    return asgn.assignTime
+}
+
+//Validate the assignment fields before storing it.
+func (asgn *RosterAssignment)IsRosterAssignmentValid() bool {
+    if syncParam.IsUUIDEmpty(asgn.shiftUUID) ||
+        syncParam.IsUUIDEmpty(asgn.orgUUID) || len(asgn.userid) == 0 {
+        return false
+    }
+    return true
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "sort"
+    "strings"
+    "time"
+)
+
+//Kind of a skill record of a user.
+type SkillKindBit uint64
+
+const (
+    //Skill the user is trained in, eg: 'triage'.
+    SKILL_GENERAL SkillKindBit = 1 << iota
+    //Last entry in the skill kind. Certification issued to the user, eg:
+    // 'ACLS', usually valid only until its expiry.
+    SKILL_CERTIFICATION SkillKindBit = 1 << iota
+)
+
+//Maximum length of a skill name.
+const SKILL_NAME_STR_LEN = 100
+
+//Maximum number of skills a shift template can require.
+const MAX_TEMPLATE_SKILLS = 20
+
+//Skill or certification held by a user. A user holds a skill only once, the
+// record is replaced on renewal.
+//The skill names are matched as is, eg: 'ICU' and 'icu' are different skills.
+type UserSkill struct {
+    userid string
+    name string
+    kind SkillKindBit
+    //Skill is valid in [validFrom, expiryTime), zero validFrom for a skill
+    // valid from any time and zero expiryTime for a skill that never expires.
+    validFrom time.Time
+    expiryTime time.Time
+    //timestamp of the last change to the record.
+    modifyTime time.Time
+}
+
+//Skill 'name' of user 'userid' valid in the range [validFrom, expiryTime).
+func NewUserSkill(userid string, name string, kind SkillKindBit,
+                  validFrom time.Time, expiryTime time.Time) *UserSkill {
+    skill := new(UserSkill)
+    skill.userid = userid
+    skill.name = strings.TrimSpace(name)
+    skill.kind = kind
+    skill.validFrom = validFrom
+    skill.expiryTime = expiryTime
+    return skill
+}
+
+//Skill that only carries the userid and name, used to get/delete the record.
+func NewUserSkillRef(userid string, name string) *UserSkill {
+    skill := new(UserSkill)
+    skill.userid = userid
+    skill.name = strings.TrimSpace(name)
+    return skill
+}
+
+func (skill *UserSkill)Userid() string {
+    return skill.userid
+}
+
+func (skill *UserSkill)Name() string {
+    return skill.name
+}
+
+func (skill *UserSkill)Kind() SkillKindBit {
+    return skill.kind
+}
+
+func (skill *UserSkill)ValidFrom() time.Time {
+    return skill.validFrom
+}
+
+func (skill *UserSkill)ExpiryTime() time.Time {
+    return skill.expiryTime
+}
+
+func (skill *UserSkill)ModifyTime() time.Time {
+    return skill.modifyTime
+}
+
+//Return true when the skill is valid for the whole range [from, to).
+func (skill *UserSkill)IsValidDuring(from time.Time, to time.Time) bool {
+    if !skill.validFrom.IsZero() && from.Before(skill.validFrom) {
+        return false
+    }
+    return skill.expiryTime.IsZero() || !to.After(skill.expiryTime)
+}
+
+//Skill names are listed with comma in the queries and are a path segment of
+// the API, a name cannot have a comma or slash.
+func isSkillNameValid(name string) bool {
+    return len(name) != 0 && len(name) < SKILL_NAME_STR_LEN &&
+           name == strings.TrimSpace(name) && !strings.ContainsAny(name, ",/")
+}
+
+//Validate the skill fields before storing it.
+func (skill *UserSkill)IsUserSkillValid() bool {
+    if len(skill.userid) == 0 || len(skill.userid) >= USER_STR_LEN ||
+        !isSkillNameValid(skill.name) {
+        return false
+    }
+    if skill.kind == 0 || skill.kind > SKILL_CERTIFICATION ||
+        skill.kind & (skill.kind - 1) != 0 {
+        return false
+    }
+    if !skill.validFrom.IsZero() && !skill.expiryTime.IsZero() &&
+        !skill.expiryTime.After(skill.validFrom) {
+        return false
+    }
+    return true
+}
+
+//Sort the skills on user and name.
+func sortUserSkills(skills []UserSkill) {
+    sort.Slice(skills, func(i, j int) bool {
+        if skills[i].userid != skills[j].userid {
+            return skills[i].userid < skills[j].userid
+        }
+        return skills[i].name < skills[j].name
+    })
+}
+
+//Sort the skills on the expiry, soonest first.
+func sortSkillsOnExpiry(skills []UserSkill) {
+    sort.Slice(skills, func(i, j int) bool {
+        if !skills[i].expiryTime.Equal(skills[j].expiryTime) {
+            return skills[i].expiryTime.Before(skills[j].expiryTime)
+        }
+        if skills[i].userid != skills[j].userid {
+            return skills[i].userid < skills[j].userid
+        }
+        return skills[i].name < skills[j].name
+    })
+}
+
+//Sorted list of the skill names without duplicates, the names are trimmed.
+func NormalizeSkillNames(names []string) []string {
+    seen := make(map[string]bool)
+    result := []string{}
+    for _, name := range(names) {
+        name = strings.TrimSpace(name)
+        if len(name) == 0 || seen[name] {
+            continue
+        }
+        seen[name] = true
+        result = append(result, name)
+    }
+    sort.Strings(result)
+    return result
+}
+
+//Return true when the skills 'held' by a user cover all the 'required'
+// skills for the whole range [from, to).
+func HoldsSkills(held []UserSkill, required []string, from time.Time,
+                 to time.Time) bool {
+    for _, name := range(required) {
+        found := false
+        for i := range(held) {
+            if held[i].name == name && held[i].IsValidDuring(from, to) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,386 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of availability table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'Availability' structure.
+type dbAvailability struct {
+    Uuid string `db:"uuid"`
+    Userid string `db:"userid"`
+    Kind uint64 `db:"kind"`
+    Weekdays uint64 `db:"weekdays"`
+    StartOffset int64 `db:"startoffset"` //Offset in seconds.
+    Duration int64 `db:"duration"` //Duration in seconds.
+    StartTime sql.NullTime `db:"starttime"`
+    EndTime sql.NullTime `db:"endtime"`
+    TemplateUuid sql.NullString `db:"templateuuid"`
+    Weight int64 `db:"weight"`
+    Note string `db:"note"`
+}
+
+// SQL representation for availability.
+type sqlAvailability struct {
+    Availability
+}
+
+//String representation of availability table and its elements.
+const (
+    AVAILABILITY_TABLE_NAME = "availability"
+    AVAILABILITY_FIELD_UUID = "uuid"
+    AVAILABILITY_FIELD_USERID = "userid"
+    AVAILABILITY_FIELD_KIND = "kind"
+    AVAILABILITY_FIELD_WEEKDAYS = "weekdays"
+    AVAILABILITY_FIELD_START_OFFSET = "startoffset"
+    AVAILABILITY_FIELD_DURATION = "duration"
+    AVAILABILITY_FIELD_START_TIME = "starttime"
+    AVAILABILITY_FIELD_END_TIME = "endtime"
+    AVAILABILITY_FIELD_TEMPLATEUUID = "templateuuid"
+    AVAILABILITY_FIELD_WEIGHT = "weight"
+    AVAILABILITY_FIELD_NOTE = "note"
+)
+
+// SQL statements to be used to operate on availability table.
+var (
+    //Create a table availability, records are removed with the user. The
+    // preferences are removed with the shift template.
+    availabilitySchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL,
+                     %s bigint NOT NULL,
+                     %s bigint NOT NULL,
+                     %s timestamp NULL,
+                     %s timestamp NULL,
+                     %s UUID NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL,
+                     %s varchar(%d) NOT NULL);`,
+                     AVAILABILITY_TABLE_NAME,
+                     AVAILABILITY_FIELD_UUID,
+                     AVAILABILITY_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     AVAILABILITY_FIELD_KIND, AVAILABILITY_FIELD_KIND,
+                     AVAILABILITY_FIELD_WEEKDAYS,
+                     AVAILABILITY_FIELD_START_OFFSET,
+                     AVAILABILITY_FIELD_DURATION,
+                     AVAILABILITY_FIELD_START_TIME,
+                     AVAILABILITY_FIELD_END_TIME,
+                     AVAILABILITY_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     AVAILABILITY_FIELD_WEIGHT,
+                     AVAILABILITY_FIELD_NOTE, AVAILABILITY_NOTE_STR_LEN)
+    //Index to find the availability of a user.
+    availabilityUserIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s)`,
+                            AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_USERID,
+                            AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_USERID)
+    //Create an availability entry.
+    availabilityCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+                            $11)`,
+                            AVAILABILITY_TABLE_NAME,
+                            AVAILABILITY_FIELD_UUID, AVAILABILITY_FIELD_USERID,
+                            AVAILABILITY_FIELD_KIND,
+                            AVAILABILITY_FIELD_WEEKDAYS,
+                            AVAILABILITY_FIELD_START_OFFSET,
+                            AVAILABILITY_FIELD_DURATION,
+                            AVAILABILITY_FIELD_START_TIME,
+                            AVAILABILITY_FIELD_END_TIME,
+                            AVAILABILITY_FIELD_TEMPLATEUUID,
+                            AVAILABILITY_FIELD_WEIGHT, AVAILABILITY_FIELD_NOTE)
+    //Get the availability with specific uuid
+    availabilityGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_UUID)
+    //Get all the availability records of a user.
+    availabilityGetonUser = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s, %s, %s, %s`,
+                            AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_USERID,
+                            AVAILABILITY_FIELD_KIND,
+                            AVAILABILITY_FIELD_START_TIME,
+                            AVAILABILITY_FIELD_START_OFFSET,
+                            AVAILABILITY_FIELD_UUID)
+    //Get the preference of a user for a shift template.
+    availabilityGetonUserTemplate = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s=($2)`,
+                            AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_USERID,
+                            AVAILABILITY_FIELD_TEMPLATEUUID)
+    //Delete the availability with specific uuid
+    availabilityDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            AVAILABILITY_TABLE_NAME, AVAILABILITY_FIELD_UUID)
+)
+
+//Translate availability to DB row in table.
+func (avail *sqlAvailability)availabilityToDBRowXlate() *dbAvailability {
+    dbrow := new(dbAvailability)
+    dbrow.Uuid = syncParam.UUIDtoString(avail.uuid)
+    dbrow.Userid = avail.userid
+    dbrow.Kind = uint64(avail.kind)
+    dbrow.Weekdays = avail.weekdays
+    dbrow.StartOffset = int64(avail.startOffset / time.Second)
+    dbrow.Duration = int64(avail.duration / time.Second)
+    if avail.kind == AVAILABILITY_BLACKOUT {
+        dbrow.StartTime.Scan(avail.startTime.UTC())
+        dbrow.EndTime.Scan(avail.endTime.UTC())
+    }
+    if !syncParam.IsUUIDEmpty(avail.templateUUID) {
+        dbrow.TemplateUuid.Scan(syncParam.UUIDtoString(avail.templateUUID))
+    }
+    dbrow.Weight = avail.weight
+    dbrow.Note = avail.note
+    return dbrow
+}
+
+//Translate DB availability row to availability structure.
+func (avail *sqlAvailability)dbToAvailabilityRowXlate(dbrow *dbAvailability) {
+    avail.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    avail.userid = dbrow.Userid
+    avail.kind = AvailabilityKindBit(dbrow.Kind)
+    avail.weekdays = dbrow.Weekdays
+    avail.startOffset = time.Duration(dbrow.StartOffset) * time.Second
+    avail.duration = time.Duration(dbrow.Duration) * time.Second
+    avail.startTime = time.Time{}
+    if dbrow.StartTime.Valid {
+        avail.startTime = dbrow.StartTime.Time.UTC()
+    }
+    avail.endTime = time.Time{}
+    if dbrow.EndTime.Valid {
+        avail.endTime = dbrow.EndTime.Time.UTC()
+    }
+    avail.templateUUID = syncParam.UUID{}
+    if dbrow.TemplateUuid.Valid {
+        avail.templateUUID = syncParam.StringtoUUID(dbrow.TemplateUuid.String)
+    }
+    avail.weight = dbrow.Weight
+    avail.note = dbrow.Note
+}
+
+//Create an availability entry, uuid is self populated. The user must be
+// present, and the shift template must be present for a preference. A user
+// can have only one preference for a shift template.
+func (avail *sqlAvailability)createAvailabilityEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create availability, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if avail.IsAvailabilityValid() == false {
+        log.Error("Cannot create availability, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    user := new(sqlUsers)
+    user.userid = avail.userid
+    err = user.getUserwithID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot create availability, user %s not present",
+                 avail.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if avail.kind == AVAILABILITY_PREFERENCE {
+        tmpl := new(sqlShiftTemplate)
+        tmpl.uuid = avail.templateUUID
+        err = tmpl.getShiftTemplateByUUID(sqlds, handle)
+        if err != nil {
+            log.Info("Cannot create preference, template %s not present",
+                     syncParam.UUIDtoString(avail.templateUUID))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+        var row dbAvailability
+        err = getPtr(&row, availabilityGetonUserTemplate, avail.userid,
+                     syncParam.UUIDtoString(avail.templateUUID))
+        if err == nil {
+            log.Info("User %s already has a preference for template %s",
+                     avail.userid, syncParam.UUIDtoString(avail.templateUUID))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+        }
+        if err != sql.ErrNoRows {
+            return err
+        }
+    }
+    avail.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create availability")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    dbrow := avail.availabilityToDBRowXlate()
+    _, err = execPtr(availabilityCreate, dbrow.Uuid, dbrow.Userid, dbrow.Kind,
+                     dbrow.Weekdays, dbrow.StartOffset, dbrow.Duration,
+                     dbrow.StartTime, dbrow.EndTime, dbrow.TemplateUuid,
+                     dbrow.Weight, dbrow.Note)
+    if err != nil {
+        log.Error("Failed to create availability for %s err : %s",
+                  avail.userid, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the availability with specific UUID.
+func (avail *sqlAvailability)getAvailabilityByUUID(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get availability, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    var row dbAvailability
+    err = getPtr(&row, availabilityGetonUUID,
+                 syncParam.UUIDtoString(avail.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read availability %s, err : %s",
+                  syncParam.UUIDtoString(avail.uuid), err)
+        return err
+    }
+    avail.dbToAvailabilityRowXlate(&row)
+    return nil
+}
+
+//Function to get all availability records of user 'userid'.
+func (avail *sqlAvailability)getAvailabilityByUser(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string) (
+                                     []Availability, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list availability, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbAvailability{}
+    err = selectPtr(&rows, availabilityGetonUser, userid)
+    if err != nil {
+        log.Trace("Failed to read availability of user %s, err : %s", userid,
+                  err)
+        return nil, err
+    }
+    availList := make([]Availability, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlAvailability)
+        entry.dbToAvailabilityRowXlate(&row)
+        availList = append(availList, entry.Availability)
+    }
+    return availList, nil
+}
+
+//Function to delete the availability with specific UUID.
+func (avail *sqlAvailability)deleteAvailabilityEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete availability, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    err = avail.getAvailabilityByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(availabilityDelete, syncParam.UUIDtoString(avail.uuid))
+    if err != nil {
+        log.Info("Failed to delete availability %s, err : %s",
+                 syncParam.UUIDtoString(avail.uuid), err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the active users who are members of org/unit 'orgUUID' or
+// its ancestors, available for the whole range [from, to) and not on an
+// approved leave.
+func (avail *sqlAvailability)getAvailableUsers(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID, from time.Time,
+                                     to time.Time) ([]string, error) {
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err := orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    member := new(sqlUserOrgRole)
+    userids := map[string]bool{}
+    for entry := &orgrow.Org; entry != nil; entry = entry.parent {
+        members, err := member.getMembershipsByOrg(sqlds, handle, entry.uuid)
+        if err != nil {
+            return nil, err
+        }
+        for i := range(members) {
+            userids[members[i].userid] = true
+        }
+    }
+    now := time.Now()
+    availUsers := []string{}
+    for userid := range(userids) {
+        user := new(sqlUsers)
+        user.userid = userid
+        err = user.getUserwithID(sqlds, handle)
+        if err != nil {
+            return nil, err
+        }
+        if user.IsInactive(now) {
+            continue
+        }
+        records, err := avail.getAvailabilityByUser(sqlds, handle, userid)
+        if err != nil {
+            return nil, err
+        }
+        if !IsUserAvailable(records, from, to, orgrow.Location()) {
+            continue
+        }
+        leave := new(sqlLeaveRequest)
+        busy, err := leave.getLeavesByUserRange(sqlds, handle, userid,
+                                                LEAVE_APPROVED, from, to)
+        if err != nil {
+            return nil, err
+        }
+        if len(busy) == 0 {
+            availUsers = append(availUsers, userid)
+        }
+    }
+    sort.Strings(availUsers)
+    return availUsers, nil
+}
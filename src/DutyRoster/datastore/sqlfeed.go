@@ -0,0 +1,251 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of calendar feed table. Used only for SQLX operations.
+// It has a direct 1:1 mapping to 'CalendarFeed' structure.
+type dbCalendarFeed struct {
+    Uuid string `db:"uuid"`
+    Kind uint64 `db:"kind"`
+    Userid string `db:"userid"`
+    OrgUuid sql.NullString `db:"orguuid"`
+    TokenHash string `db:"tokenhash"`
+    CreateTime time.Time `db:"createtime"`
+}
+
+// SQL representation for calendar feed.
+type sqlCalendarFeed struct {
+    CalendarFeed
+}
+
+//String representation of calendar feed table and its elements.
+const (
+    FEED_HASH_LEN = 64
+    FEED_TABLE_NAME = "calendarfeeds"
+    FEED_FIELD_UUID = "uuid"
+    FEED_FIELD_KIND = "kind"
+    FEED_FIELD_USERID = "userid"
+    FEED_FIELD_ORGUUID = "orguuid"
+    FEED_FIELD_TOKEN_HASH = "tokenhash"
+    FEED_FIELD_CREATE_TIME = "createtime"
+)
+
+// SQL statements to be used to operate on calendar feed table.
+var (
+    //Create a table calendarfeeds, feeds are removed with the owner and the
+    // org/unit.
+    feedSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s UUID NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s char(%d) NOT NULL,
+                     %s timestamp NOT NULL);`,
+                     FEED_TABLE_NAME,
+                     FEED_FIELD_UUID,
+                     FEED_FIELD_KIND, FEED_FIELD_KIND,
+                     FEED_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     FEED_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     FEED_FIELD_TOKEN_HASH, FEED_HASH_LEN,
+                     FEED_FIELD_CREATE_TIME)
+    //Index to find the feeds of a user.
+    feedUserIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s)`,
+                            FEED_TABLE_NAME, FEED_FIELD_USERID,
+                            FEED_TABLE_NAME, FEED_FIELD_USERID)
+    //Create a calendar feed entry.
+    feedCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6)`,
+                            FEED_TABLE_NAME,
+                            FEED_FIELD_UUID, FEED_FIELD_KIND,
+                            FEED_FIELD_USERID, FEED_FIELD_ORGUUID,
+                            FEED_FIELD_TOKEN_HASH, FEED_FIELD_CREATE_TIME)
+    //Get the calendar feed with specific uuid
+    feedGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            FEED_TABLE_NAME, FEED_FIELD_UUID)
+    //Get all the calendar feeds of a user.
+    feedGetonUser = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            FEED_TABLE_NAME, FEED_FIELD_USERID,
+                            FEED_FIELD_CREATE_TIME)
+    //Delete the calendar feed with specific uuid
+    feedDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            FEED_TABLE_NAME, FEED_FIELD_UUID)
+)
+
+//Translate calendar feed to DB row in table.
+func (feed *sqlCalendarFeed)feedToDBRowXlate() *dbCalendarFeed {
+    dbrow := new(dbCalendarFeed)
+    dbrow.Uuid = syncParam.UUIDtoString(feed.uuid)
+    dbrow.Kind = uint64(feed.kind)
+    dbrow.Userid = feed.userid
+    dbrow.OrgUuid.Scan(nil)
+    if !syncParam.IsUUIDEmpty(feed.orgUUID) {
+        dbrow.OrgUuid.Scan(syncParam.UUIDtoString(feed.orgUUID))
+    }
+    dbrow.TokenHash = feed.tokenHash
+    dbrow.CreateTime = feed.createTime.UTC()
+    return dbrow
+}
+
+//Translate DB calendar feed row to calendar feed structure.
+func (feed *sqlCalendarFeed)dbToFeedRowXlate(dbrow *dbCalendarFeed) {
+    feed.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    feed.kind = FeedKindBit(dbrow.Kind)
+    feed.userid = dbrow.Userid
+    feed.orgUUID = syncParam.UUID{}
+    if dbrow.OrgUuid.Valid {
+        feed.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid.String)
+    }
+    feed.tokenHash = dbrow.TokenHash
+    feed.createTime = dbrow.CreateTime
+}
+
+//Create a calendar feed entry. uuid and createTime are self populated.
+//The owner and the org/unit of an org feed must be present in the system.
+func (feed *sqlCalendarFeed)createFeedEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create feed, invalid DB handle err : %s", err)
+        return err
+    }
+    if feed.IsCalendarFeedValid() == false {
+        log.Error("Cannot create feed, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    user := new(sqlUsers)
+    user.userid = feed.userid
+    err = user.getUserwithID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot create feed, user %s not present", feed.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if feed.kind == FEED_ORG {
+        orgrow := new(sqlorg)
+        orgrow.uuid = feed.orgUUID
+        res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        if res == false {
+            log.Info("Cannot create feed, org %s not present",
+                     syncParam.UUIDtoString(feed.orgUUID))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    feed.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create feed")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    feed.createTime = time.Now()
+    dbrow := feed.feedToDBRowXlate()
+    _, err = execPtr(feedCreate, dbrow.Uuid, dbrow.Kind, dbrow.Userid,
+                     dbrow.OrgUuid, dbrow.TokenHash, dbrow.CreateTime)
+    if err != nil {
+        log.Error("Failed to create feed for %s err : %s", feed.userid, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the calendar feed with specific UUID.
+func (feed *sqlCalendarFeed)getFeedByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get feed, invalid DB handle err : %s", err)
+        return err
+    }
+    var row dbCalendarFeed
+    err = getPtr(&row, feedGetonUUID, syncParam.UUIDtoString(feed.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read feed %s, err : %s",
+                  syncParam.UUIDtoString(feed.uuid), err)
+        return err
+    }
+    feed.dbToFeedRowXlate(&row)
+    return nil
+}
+
+//Function to get all the calendar feeds of user 'userid'.
+func (feed *sqlCalendarFeed)getFeedsByUser(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     userid string) ([]CalendarFeed, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list feeds, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbCalendarFeed{}
+    err = selectPtr(&rows, feedGetonUser, userid)
+    if err != nil {
+        log.Trace("Failed to read feeds of user %s, err : %s", userid, err)
+        return nil, err
+    }
+    feeds := make([]CalendarFeed, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlCalendarFeed)
+        entry.dbToFeedRowXlate(&row)
+        feeds = append(feeds, entry.CalendarFeed)
+    }
+    return feeds, nil
+}
+
+//Function to delete the calendar feed with specific UUID.
+func (feed *sqlCalendarFeed)deleteFeedEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete feed, invalid DB handle err : %s", err)
+        return err
+    }
+    uuidStr := syncParam.UUIDtoString(feed.uuid)
+    res, err := execPtr(feedDelete, uuidStr)
+    if err != nil {
+        log.Info("Failed to delete feed %s, err : %s", uuidStr, err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
@@ -0,0 +1,600 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of holiday calendar table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'HolidayCalendar' structure.
+type dbHolidayCalendar struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    Name string `db:"name"`
+    PayMultiplier float64 `db:"paymultiplier"`
+    StaffPercent uint64 `db:"staffpercent"`
+    CreateTime time.Time `db:"createtime"`
+}
+
+//The db representation of holiday table. The date is bound as text in
+// HOLIDAY_DATE_FORMAT, so it is same in every time zone.
+type dbHoliday struct {
+    Uuid string `db:"uuid"`
+    CalendarUuid string `db:"calendaruuid"`
+    Day time.Time `db:"day"`
+    Name string `db:"name"`
+    PayMultiplier float64 `db:"paymultiplier"`
+    StaffPercent uint64 `db:"staffpercent"`
+    Imported bool `db:"imported"`
+}
+
+// SQL representation for holiday calendar and holiday.
+type sqlHolidayCalendar struct {
+    HolidayCalendar
+}
+
+type sqlHoliday struct {
+    Holiday
+}
+
+//String representation of holiday tables and their elements.
+const (
+    HOLIDAY_CALENDAR_TABLE_NAME = "holidaycalendars"
+    HOLIDAY_CALENDAR_FIELD_UUID = "uuid"
+    HOLIDAY_CALENDAR_FIELD_ORGUUID = "orguuid"
+    HOLIDAY_CALENDAR_FIELD_NAME = "name"
+    HOLIDAY_CALENDAR_FIELD_PAY_MULTIPLIER = "paymultiplier"
+    HOLIDAY_CALENDAR_FIELD_STAFF_PERCENT = "staffpercent"
+    HOLIDAY_CALENDAR_FIELD_CREATE_TIME = "createtime"
+
+    HOLIDAY_TABLE_NAME = "holidays"
+    HOLIDAY_FIELD_UUID = "uuid"
+    HOLIDAY_FIELD_CALENDARUUID = "calendaruuid"
+    HOLIDAY_FIELD_DAY = "day"
+    HOLIDAY_FIELD_NAME = "name"
+    HOLIDAY_FIELD_PAY_MULTIPLIER = "paymultiplier"
+    HOLIDAY_FIELD_STAFF_PERCENT = "staffpercent"
+    HOLIDAY_FIELD_IMPORTED = "imported"
+)
+
+// SQL statements to be used to operate on holiday tables.
+var (
+    //Create a table holidaycalendars, calendars are removed with the org/unit.
+    holidayCalendarSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     %s double precision NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s timestamptz NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     HOLIDAY_CALENDAR_TABLE_NAME,
+                     HOLIDAY_CALENDAR_FIELD_UUID,
+                     HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     HOLIDAY_CALENDAR_FIELD_NAME, HOLIDAY_NAME_STR_LEN,
+                     HOLIDAY_CALENDAR_FIELD_PAY_MULTIPLIER,
+                     HOLIDAY_CALENDAR_FIELD_PAY_MULTIPLIER,
+                     HOLIDAY_CALENDAR_FIELD_STAFF_PERCENT,
+                     HOLIDAY_CALENDAR_FIELD_STAFF_PERCENT,
+                     HOLIDAY_CALENDAR_FIELD_CREATE_TIME,
+                     HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                     HOLIDAY_CALENDAR_FIELD_NAME)
+    //Create a table holidays, holidays are removed with the calendar.
+    holidaySchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s date NOT NULL,
+                     %s varchar(%d) NOT NULL,
+                     %s double precision NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s boolean NOT NULL);`,
+                     HOLIDAY_TABLE_NAME,
+                     HOLIDAY_FIELD_UUID,
+                     HOLIDAY_FIELD_CALENDARUUID,
+                     HOLIDAY_CALENDAR_TABLE_NAME, HOLIDAY_CALENDAR_FIELD_UUID,
+                     HOLIDAY_FIELD_DAY,
+                     HOLIDAY_FIELD_NAME, HOLIDAY_NAME_STR_LEN,
+                     HOLIDAY_FIELD_PAY_MULTIPLIER, HOLIDAY_FIELD_PAY_MULTIPLIER,
+                     HOLIDAY_FIELD_STAFF_PERCENT, HOLIDAY_FIELD_STAFF_PERCENT,
+                     HOLIDAY_FIELD_IMPORTED)
+    //Index to find the holidays of a calendar in a range of dates.
+    holidayCalendarDayIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s, %s)`,
+                            HOLIDAY_TABLE_NAME, HOLIDAY_FIELD_CALENDARUUID,
+                            HOLIDAY_TABLE_NAME, HOLIDAY_FIELD_CALENDARUUID,
+                            HOLIDAY_FIELD_DAY)
+    //Create a holiday calendar entry.
+    holidayCalendarCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6)`,
+                            HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_CALENDAR_FIELD_UUID,
+                            HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                            HOLIDAY_CALENDAR_FIELD_NAME,
+                            HOLIDAY_CALENDAR_FIELD_PAY_MULTIPLIER,
+                            HOLIDAY_CALENDAR_FIELD_STAFF_PERCENT,
+                            HOLIDAY_CALENDAR_FIELD_CREATE_TIME)
+    //Get the holiday calendar with specific uuid
+    holidayCalendarGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_CALENDAR_FIELD_UUID)
+    //Get the holiday calendar of an org/unit with specific name
+    holidayCalendarGetonOrgName = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s=($2)`,
+                            HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                            HOLIDAY_CALENDAR_FIELD_NAME)
+    //Get all the holiday calendars of an org/unit.
+    holidayCalendarGetonOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                            HOLIDAY_CALENDAR_FIELD_NAME)
+    //Count the holiday calendars of an org/unit.
+    holidayCalendarCountonOrg = fmt.Sprintf(`SELECT COUNT(*) FROM %s
+                            WHERE %s=($1)`,
+                            HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_CALENDAR_FIELD_ORGUUID)
+    //Delete the holiday calendar with specific uuid
+    holidayCalendarDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_CALENDAR_FIELD_UUID)
+    //Create a holiday entry.
+    holidayCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                            HOLIDAY_TABLE_NAME,
+                            HOLIDAY_FIELD_UUID, HOLIDAY_FIELD_CALENDARUUID,
+                            HOLIDAY_FIELD_DAY, HOLIDAY_FIELD_NAME,
+                            HOLIDAY_FIELD_PAY_MULTIPLIER,
+                            HOLIDAY_FIELD_STAFF_PERCENT,
+                            HOLIDAY_FIELD_IMPORTED)
+    //Get the holiday with specific uuid
+    holidayGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            HOLIDAY_TABLE_NAME, HOLIDAY_FIELD_UUID)
+    //Get the holidays of a calendar in a range of dates.
+    holidayGetonCalendar = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s >= ($2) AND %s < ($3) ORDER BY %s, %s`,
+                            HOLIDAY_TABLE_NAME, HOLIDAY_FIELD_CALENDARUUID,
+                            HOLIDAY_FIELD_DAY, HOLIDAY_FIELD_DAY,
+                            HOLIDAY_FIELD_DAY, HOLIDAY_FIELD_NAME)
+    //Get the holidays of all the calendars of an org/unit in a range of
+    // dates.
+    holidayGetonOrg = fmt.Sprintf(`SELECT h.* FROM %s h JOIN %s c
+                            ON h.%s = c.%s WHERE c.%s=($1)
+                            AND h.%s >= ($2) AND h.%s < ($3)
+                            ORDER BY h.%s, h.%s`,
+                            HOLIDAY_TABLE_NAME, HOLIDAY_CALENDAR_TABLE_NAME,
+                            HOLIDAY_FIELD_CALENDARUUID,
+                            HOLIDAY_CALENDAR_FIELD_UUID,
+                            HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                            HOLIDAY_FIELD_DAY, HOLIDAY_FIELD_DAY,
+                            HOLIDAY_FIELD_DAY, HOLIDAY_FIELD_NAME)
+    //Delete the holiday with specific uuid
+    holidayDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            HOLIDAY_TABLE_NAME, HOLIDAY_FIELD_UUID)
+    //Delete the imported holidays of a calendar.
+    holidayDeleteImported = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)
+                            AND %s=($2)`,
+                            HOLIDAY_TABLE_NAME, HOLIDAY_FIELD_CALENDARUUID,
+                            HOLIDAY_FIELD_IMPORTED)
+)
+
+//Translate holiday calendar to DB row in table.
+func (cal *sqlHolidayCalendar)calendarToDBRowXlate() *dbHolidayCalendar {
+    dbrow := new(dbHolidayCalendar)
+    dbrow.Uuid = syncParam.UUIDtoString(cal.uuid)
+    dbrow.OrgUuid = syncParam.UUIDtoString(cal.orgUUID)
+    dbrow.Name = cal.name
+    dbrow.PayMultiplier = cal.payMultiplier
+    dbrow.StaffPercent = cal.staffPercent
+    dbrow.CreateTime = cal.createTime
+    return dbrow
+}
+
+//Translate DB holiday calendar row to holiday calendar structure.
+func (cal *sqlHolidayCalendar)dbToCalendarRowXlate(dbrow *dbHolidayCalendar) {
+    cal.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    cal.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    cal.name = dbrow.Name
+    cal.payMultiplier = dbrow.PayMultiplier
+    cal.staffPercent = dbrow.StaffPercent
+    cal.createTime = dbrow.CreateTime
+}
+
+//Translate DB holiday row to holiday structure.
+func (hol *sqlHoliday)dbToHolidayRowXlate(dbrow *dbHoliday) {
+    hol.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    hol.calendarUUID = syncParam.StringtoUUID(dbrow.CalendarUuid)
+    hol.date = holidayDate(dbrow.Day)
+    hol.name = dbrow.Name
+    hol.payMultiplier = dbrow.PayMultiplier
+    hol.staffPercent = dbrow.StaffPercent
+    hol.imported = dbrow.Imported
+}
+
+//Translate the DB holiday rows to holidays.
+func dbToHolidays(rows []dbHoliday) []Holiday {
+    hols := make([]Holiday, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlHoliday)
+        entry.dbToHolidayRowXlate(&row)
+        hols = append(hols, entry.Holiday)
+    }
+    return hols
+}
+
+//Create a holiday calendar entry. uuid and createTime are self populated.
+//The org/unit must be present in the system and the name must be unique in
+// the org/unit.
+func (cal *sqlHolidayCalendar)createHolidayCalendarEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create holiday calendar, invalid DB " +
+                  "handle err : %s", err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if cal.IsHolidayCalendarValid() == false {
+        log.Error("Cannot create holiday calendar, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = cal.orgUUID
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Cannot create holiday calendar %s, org %s not present",
+                 cal.name, syncParam.UUIDtoString(cal.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    var row dbHolidayCalendar
+    err = getPtr(&row, holidayCalendarGetonOrgName,
+                 syncParam.UUIDtoString(cal.orgUUID), cal.name)
+    if err == nil {
+        log.Info("Holiday calendar %s already present in org %s", cal.name,
+                 syncParam.UUIDtoString(cal.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    if err != sql.ErrNoRows {
+        return err
+    }
+    cal.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create holiday calendar")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    cal.createTime = time.Now()
+    dbrow := cal.calendarToDBRowXlate()
+    _, err = execPtr(holidayCalendarCreate, dbrow.Uuid, dbrow.OrgUuid,
+                     dbrow.Name, dbrow.PayMultiplier, dbrow.StaffPercent,
+                     dbrow.CreateTime)
+    if err != nil {
+        log.Error("Failed to create holiday calendar %s err : %s", cal.name,
+                  err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the holiday calendar with specific UUID.
+func (cal *sqlHolidayCalendar)getHolidayCalendarByUUID(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get holiday calendar, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    var row dbHolidayCalendar
+    err = getPtr(&row, holidayCalendarGetonUUID,
+                 syncParam.UUIDtoString(cal.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read holiday calendar %s, err : %s",
+                  syncParam.UUIDtoString(cal.uuid), err)
+        return err
+    }
+    cal.dbToCalendarRowXlate(&row)
+    return nil
+}
+
+//Function to get all the holiday calendars of org/unit 'orgUUID'.
+func (cal *sqlHolidayCalendar)getHolidayCalendarsByOrg(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID) (
+                                     []HolidayCalendar, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list holiday calendars, invalid DB " +
+                  "handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbHolidayCalendar{}
+    err = selectPtr(&rows, holidayCalendarGetonOrg,
+                    syncParam.UUIDtoString(orgUUID))
+    if err != nil {
+        log.Trace("Failed to read holiday calendars of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    cals := make([]HolidayCalendar, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlHolidayCalendar)
+        entry.dbToCalendarRowXlate(&row)
+        cals = append(cals, entry.HolidayCalendar)
+    }
+    return cals, nil
+}
+
+//Function to delete the holiday calendar with specific UUID, the holidays of
+// the calendar are removed by the DB.
+func (cal *sqlHolidayCalendar)deleteHolidayCalendarEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete holiday calendar, invalid DB " +
+                  "handle err : %s", err)
+        return err
+    }
+    uuidStr := syncParam.UUIDtoString(cal.uuid)
+    res, err := execPtr(holidayCalendarDelete, uuidStr)
+    if err != nil {
+        log.Info("Failed to delete holiday calendar %s, err : %s", uuidStr,
+                 err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Create a holiday entry, uuid is self populated. The calendar must be present
+// in the system.
+func (hol *sqlHoliday)createHolidayEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create holiday, invalid DB handle err : %s", err)
+        return err
+    }
+    if hol.IsHolidayValid() == false {
+        log.Error("Cannot create holiday, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    cal := new(sqlHolidayCalendar)
+    cal.uuid = hol.calendarUUID
+    err = cal.getHolidayCalendarByUUID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot create holiday %s, calendar %s not present",
+                 hol.name, syncParam.UUIDtoString(hol.calendarUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    hol.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create holiday")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    hol.date = holidayDate(hol.date)
+    _, err = execPtr(holidayCreate, syncParam.UUIDtoString(hol.uuid),
+                     syncParam.UUIDtoString(hol.calendarUUID),
+                     hol.date.Format(HOLIDAY_DATE_FORMAT), hol.name,
+                     hol.payMultiplier, hol.staffPercent, hol.imported)
+    if err != nil {
+        log.Error("Failed to create holiday %s err : %s", hol.name, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the holiday with specific UUID.
+func (hol *sqlHoliday)getHolidayByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get holiday, invalid DB handle err : %s", err)
+        return err
+    }
+    var row dbHoliday
+    err = getPtr(&row, holidayGetonUUID, syncParam.UUIDtoString(hol.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read holiday %s, err : %s",
+                  syncParam.UUIDtoString(hol.uuid), err)
+        return err
+    }
+    hol.dbToHolidayRowXlate(&row)
+    return nil
+}
+
+//Function to delete the holiday with specific UUID.
+func (hol *sqlHoliday)deleteHolidayEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete holiday, invalid DB handle err : %s", err)
+        return err
+    }
+    uuidStr := syncParam.UUIDtoString(hol.uuid)
+    res, err := execPtr(holidayDelete, uuidStr)
+    if err != nil {
+        log.Info("Failed to delete holiday %s, err : %s", uuidStr, err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Function to get the holidays of calendar 'calendarUUID' with the dates in
+// the range [from, to).
+func getCalendarHolidays(sqlds *postgreSqlDataStore, handle interface{},
+                         calendarUUID syncParam.UUID, from time.Time,
+                         to time.Time) ([]Holiday, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list holidays, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbHoliday{}
+    err = selectPtr(&rows, holidayGetonCalendar,
+                    syncParam.UUIDtoString(calendarUUID),
+                    holidayDate(from).Format(HOLIDAY_DATE_FORMAT),
+                    holidayDate(to).Format(HOLIDAY_DATE_FORMAT))
+    if err != nil {
+        log.Trace("Failed to read holidays of calendar %s, err : %s",
+                  syncParam.UUIDtoString(calendarUUID), err)
+        return nil, err
+    }
+    return dbToHolidays(rows), nil
+}
+
+//Function to replace the imported holidays of calendar 'calendarUUID' with
+// 'hols', uuids of the holidays are populated.
+func importHolidayEntries(sqlds *postgreSqlDataStore, handle interface{},
+                          calendarUUID syncParam.UUID, hols []Holiday) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to import holidays, invalid DB handle err : %s", err)
+        return err
+    }
+    cal := new(sqlHolidayCalendar)
+    cal.uuid = calendarUUID
+    err = cal.getHolidayCalendarByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(holidayDeleteImported,
+                     syncParam.UUIDtoString(calendarUUID), true)
+    if err != nil {
+        log.Info("Failed to delete imported holidays of calendar %s, err : %s",
+                 syncParam.UUIDtoString(calendarUUID), err)
+        return err
+    }
+    for i := range(hols) {
+        hol := new(sqlHoliday)
+        hol.Holiday = hols[i]
+        hol.calendarUUID = calendarUUID
+        hol.imported = true
+        err = hol.createHolidayEntry(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        hols[i] = hol.Holiday
+    }
+    return nil
+}
+
+//Function to get the holidays in effect for org/unit 'orgUUID' with the dates
+// in the range [from, to), ie: the holidays of the calendars of the nearest
+// org/unit in the parent chain that has calendars.
+func getOrgHolidays(sqlds *postgreSqlDataStore, handle interface{},
+                    orgUUID syncParam.UUID, from time.Time,
+                    to time.Time) ([]Holiday, error) {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to list org holidays, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    selectPtr, _ := sqlds.getDBSelectFunction(handle)
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err = orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    for entry := &orgrow.Org; entry != nil; entry = entry.parent {
+        uuidStr := syncParam.UUIDtoString(entry.uuid)
+        var cnt int64
+        err = getPtr(&cnt, holidayCalendarCountonOrg, uuidStr)
+        if err != nil {
+            log.Trace("Failed to count holiday calendars of org %s, err : %s",
+                      uuidStr, err)
+            return nil, err
+        }
+        if cnt == 0 {
+            continue
+        }
+        rows := []dbHoliday{}
+        err = selectPtr(&rows, holidayGetonOrg, uuidStr,
+                        holidayDate(from).Format(HOLIDAY_DATE_FORMAT),
+                        holidayDate(to).Format(HOLIDAY_DATE_FORMAT))
+        if err != nil {
+            log.Trace("Failed to read holidays of org %s, err : %s", uuidStr,
+                      err)
+            return nil, err
+        }
+        return dbToHolidays(rows), nil
+    }
+    return []Holiday{}, nil
+}
+
+//Function to get the holiday in effect for org/unit 'orgUUID' on the local
+// day of 'at', nil when the day is not a holiday.
+func isHoliday(sqlds *postgreSqlDataStore, handle interface{},
+               orgUUID syncParam.UUID, at time.Time) (*Holiday, error) {
+    loc, err := getOrgLocation(sqlds, handle, orgUUID)
+    if err != nil {
+        return nil, err
+    }
+    day := holidayDate(at.In(loc))
+    hols, err := getOrgHolidays(sqlds, handle, orgUUID, day,
+                                day.AddDate(0, 0, 1))
+    if err != nil {
+        return nil, err
+    }
+    return holidayOfDay(hols), nil
+}
@@ -0,0 +1,217 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of membership invite table. Unlike the memberships, an
+// invite holds all the role bits offered to the user in a single row.
+type dbMembershipInvite struct {
+    Userid string `db:"userid"`
+    OrgUuid string `db:"orguuid"`
+    RoleType uint64 `db:"roletype"`
+    InviteTime time.Time `db:"invitetime"`
+}
+
+// SQL representation for membership invite.
+type sqlMembershipInvite struct {
+    UserOrgRole
+}
+
+//String representation of membership invite table and its elements.
+const (
+    INVITE_TABLE_NAME = "membershipinvites"
+    INVITE_FIELD_USERID = "userid"
+    INVITE_FIELD_ORGUUID = "orguuid"
+    INVITE_FIELD_ROLETYPE = "roletype"
+    INVITE_FIELD_INVITE_TIME = "invitetime"
+)
+
+// SQL statements to be used to operate on membership invite table.
+var (
+    //Create a table membershipinvites, invites are removed with the user and
+    // the org/unit.
+    inviteSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s timestamptz NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     INVITE_TABLE_NAME,
+                     INVITE_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     INVITE_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     INVITE_FIELD_ROLETYPE, INVITE_FIELD_ROLETYPE,
+                     INVITE_FIELD_INVITE_TIME,
+                     INVITE_FIELD_USERID, INVITE_FIELD_ORGUUID)
+    //Create a membership invite entry
+    inviteCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4)`,
+                            INVITE_TABLE_NAME,
+                            INVITE_FIELD_USERID, INVITE_FIELD_ORGUUID,
+                            INVITE_FIELD_ROLETYPE, INVITE_FIELD_INVITE_TIME)
+    //Get the invite of a user to an org
+    inviteGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1) AND %s=($2)`,
+                            INVITE_TABLE_NAME,
+                            INVITE_FIELD_USERID, INVITE_FIELD_ORGUUID)
+    //Get all the invites of a user
+    inviteGetonUser = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            INVITE_TABLE_NAME, INVITE_FIELD_USERID,
+                            INVITE_FIELD_ORGUUID)
+    //Delete the invite of a user to an org
+    inviteDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1) AND %s=($2)`,
+                            INVITE_TABLE_NAME,
+                            INVITE_FIELD_USERID, INVITE_FIELD_ORGUUID)
+)
+
+//Create the invite of the user to the org, an earlier invite of the user to
+// the org is replaced.
+func (invite *sqlMembershipInvite)createInviteEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to invite %s, invalid DB handle err : %s",
+                  invite.userid, err)
+        return err
+    }
+    if len(invite.userid) == 0 || syncParam.IsUUIDEmpty(invite.UUID()) ||
+        invite.IsRoleBitsetValid() == false {
+        log.Error("Cannot create invite, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    member := &sqlUserOrgRole{invite.UserOrgRole}
+    err = member.isMembershipParentsPresent(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    err = member.isMembershipRolesGrantable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    orgStr := syncParam.UUIDtoString(invite.UUID())
+    _, err = execPtr(inviteDelete, invite.userid, orgStr)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(inviteCreate, invite.userid, orgStr,
+                     uint64(invite.roleType), time.Now().UTC())
+    if err != nil {
+        log.Error("Failed to invite %s to org %s err : %s", invite.userid,
+                  orgStr, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the invite of the user to the org, the role bits of the
+// invite are populated.
+func (invite *sqlMembershipInvite)getInviteEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get invite, invalid DB handle err : %s", err)
+        return err
+    }
+    var row dbMembershipInvite
+    err = getPtr(&row, inviteGet, invite.userid,
+                 syncParam.UUIDtoString(invite.UUID()))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read invite of %s, err : %s", invite.userid, err)
+        return err
+    }
+    invite.roleType = RoleBit(row.RoleType)
+    return nil
+}
+
+//Function to get all the invites of user 'userid'.
+func (invite *sqlMembershipInvite)getInvitesByUser(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     userid string) ([]UserOrgRole, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list invites, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbMembershipInvite{}
+    err = selectPtr(&rows, inviteGetonUser, userid)
+    if err != nil {
+        log.Trace("Failed to read invites of user %s, err : %s", userid, err)
+        return nil, err
+    }
+    invites := make([]UserOrgRole, 0, len(rows))
+    for _, row := range(rows) {
+        invites = append(invites, *NewUserOrgRole(row.Userid,
+                                        RoleBit(row.RoleType),
+                                        syncParam.StringtoUUID(row.OrgUuid)))
+    }
+    return invites, nil
+}
+
+//Function to delete the invite of the user to the org.
+func (invite *sqlMembershipInvite)deleteInviteEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete invite, invalid DB handle err : %s", err)
+        return err
+    }
+    orgStr := syncParam.UUIDtoString(invite.UUID())
+    res, err := execPtr(inviteDelete, invite.userid, orgStr)
+    if err != nil {
+        log.Info("Failed to delete invite of %s to org %s, err : %s",
+                 invite.userid, orgStr, err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Grant the role bits of the invite to the user and delete the invite.
+func (invite *sqlMembershipInvite)acceptInviteEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    err := invite.getInviteEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    member := &sqlUserOrgRole{invite.UserOrgRole}
+    err = member.grantMembershipEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    return invite.deleteInviteEntry(sqlds, handle)
+}
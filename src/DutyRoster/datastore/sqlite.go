@@ -0,0 +1,99 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "sync"
+    "fmt"
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/jmoiron/sqlx"
+    "DutyRoster/logging"
+    "DutyRoster/config"
+    "DutyRoster/errorset"
+)
+
+//SQLite datastore, a roster can be run from a single DB file with no DB
+// server. The SQL statements of postgreSQL are valid in SQLite as well, hence
+// the datastore reuses the postgreSQL implementation for all the record
+// operations. Only the connection and schema migrations are different.
+//SQLite numbers the '$N' params in the order they appear in a statement, so
+// the SQL statements must use the params in increasing order.
+type sqliteDataStore struct {
+    postgreSqlDataStore
+}
+
+//Name of the go sql driver for SQLite.
+const SQLITE_SQL_DRIVER_NAME = "sqlite3"
+
+var sqliteOnce sync.Once
+var sqliteObj = new(sqliteDataStore)
+
+//Open the SQLite DB file in 'dbname' of configuration, file is created if not
+// present. Foreign keys are enforced on every connection, they are off by
+// default in SQLite.
+func (sqliteds *sqliteDataStore)CreateDBConnection() error {
+    var err error
+    dbconfig := config.GetConfigInstance()
+    dbDriver := dbconfig.DB.Driver
+    dbFile := dbconfig.DB.Dbname
+
+    if (len(dbDriver) == 0 || len(dbFile) == 0) {
+        sqliteds.dblogger.Error("Failed to start application, NULL DB driver/name")
+        return fmt.Errorf("%s",
+            errorset.ERROR_TYPES[errorset.NULL_DB_CONFIG_PARAMS])
+    }
+    if dbDriver != SQLITE_DB_DRIVER {
+        sqliteds.dblogger.Error("Failed to start application, Invalid driver :%s",
+                             dbDriver)
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_DB_DRIVER])
+    }
+    dbparam := fmt.Sprintf("file:%s?_foreign_keys=1&_busy_timeout=5000",
+                           dbFile)
+    var dbHandle *sqlx.DB
+    dbHandle, err = sqlx.Open(SQLITE_SQL_DRIVER_NAME, dbparam)
+    if err != nil {
+        sqliteds.dblogger.Error("Failed to open SQLite DB %s", err.Error())
+        return err
+    }
+    sqliteds.DBConn = dbHandle
+    return nil
+}
+
+//The SQLite tables are created by the schema migrations, only the schema
+// version is validated here.
+func (sqliteds *sqliteDataStore)InitDataStore() error {
+    return sqliteds.checkSchemaVersion(sqliteMigrations)
+}
+
+func (sqliteds *sqliteDataStore)MigrateUp() error {
+    return sqliteds.migrateUp(sqliteMigrations)
+}
+
+func (sqliteds *sqliteDataStore)MigrateDown() error {
+    return sqliteds.migrateDown(sqliteMigrations)
+}
+
+func (sqliteds *sqliteDataStore)ListMigrations() ([]MigrationStatus, error) {
+    return sqliteds.getMigrationStatus(sqliteMigrations)
+}
+
+// Only one SQLite datastore object can be present in the system.
+func getSQLiteDataStoreObj() *sqliteDataStore {
+    sqliteOnce.Do(func() {
+        sqliteObj.dblogger = logging.GetAppLoggerObj()
+        sqliteObj.dblogger.Trace("SQLite DB Object is created successfully")
+    })
+    return sqliteObj
+}
@@ -0,0 +1,760 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+//******************************************************************************
+// SQLite table definitions. SQLite has no UUID type, uuids are stored as TEXT
+// in the canonical 36 character form and validated using CHECK constraints.
+// The column names must be same as the postgreSQL tables, as the SQL
+// statements of postgreSQL are reused for SQLite.
+//******************************************************************************
+import (
+    "fmt"
+    "DutyRoster/timezone"
+)
+
+//Length of uuid in string form, eg: 0f8fad5b-d9cb-469f-a165-70867728950e
+const UUID_STR_LEN = 36
+
+var (
+    sqliteRoleSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s INTEGER NOT NULL PRIMARY KEY CHECK(%s > 0));`,
+                    ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                    ROLE_TYPE_NAME_STR)
+
+    sqliteOrgSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s TEXT CHECK(length(%s) < %d),
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL
+                     ON UPDATE SET NULL,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s timestamp NOT NULL,
+                     %s INTEGER NULL);`,
+                     ORG_TABLE_NAME,
+                     ORG_FIELD_UUID, ORG_FIELD_UUID, UUID_STR_LEN,
+                     ORG_FIELD_NAME, ORG_FIELD_NAME, ORG_NAME_STR_LEN,
+                     ORG_FIELD_ADDRESS, ORG_FIELD_ADDRESS, ORG_NAME_STR_LEN,
+                     ORG_FIELD_PARENT,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ORG_FIELD_STATUS, ORG_FIELD_STATUS,
+                     ORG_FIELD_START_TIME,
+                     ORG_FIELD_VALIDITY)
+
+    sqliteUserSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) < %d),
+                     %s TEXT NOT NULL,
+                     %s TEXT NOT NULL,
+                     %s TEXT NOT NULL,
+                     %s date NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s INTEGER,
+                     %s INTEGER NOT NULL CHECK(%s > 0));`,
+                     USER_TABLE_NAME,
+                     USER_FIELD_USERID, USER_FIELD_USERID, USER_STR_LEN,
+                     USER_FIELD_EMAILID,
+                     USER_FIELD_HASHPWD,
+                     USER_FIELD_MOBILENO,
+                     USER_FIELD_DOB,
+                     USER_FIELD_STARTTIME,
+                     USER_FIELD_VALIDITY,
+                     USER_FIELD_STATUS, USER_FIELD_STATUS)
+
+    sqliteMembershipSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s, %s));`,
+                     MEMBERSHIP_TABLE_NAME,
+                     MEMBERSHIP_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     MEMBERSHIP_FIELD_ROLETYPE,
+                     ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                     MEMBERSHIP_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     MEMBERSHIP_FIELD_GRANT_TIME,
+                     MEMBERSHIP_FIELD_USERID, MEMBERSHIP_FIELD_ROLETYPE,
+                     MEMBERSHIP_FIELD_ORGUUID)
+
+    sqliteShiftTemplateSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL,
+                     %s INTEGER NOT NULL,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL);`,
+                     SHIFT_TEMPLATE_TABLE_NAME,
+                     SHIFT_TEMPLATE_FIELD_UUID, SHIFT_TEMPLATE_FIELD_UUID,
+                     UUID_STR_LEN,
+                     SHIFT_TEMPLATE_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SHIFT_TEMPLATE_FIELD_NAME, SHIFT_TEMPLATE_FIELD_NAME,
+                     SHIFT_NAME_STR_LEN,
+                     SHIFT_TEMPLATE_FIELD_START_OFFSET,
+                     SHIFT_TEMPLATE_FIELD_START_OFFSET,
+                     SHIFT_TEMPLATE_FIELD_DURATION,
+                     SHIFT_TEMPLATE_FIELD_DURATION,
+                     SHIFT_TEMPLATE_FIELD_WEEKDAYS,
+                     SHIFT_TEMPLATE_FIELD_MINSTAFF,
+                     SHIFT_TEMPLATE_FIELD_OWNER,
+                     USER_TABLE_NAME, USER_FIELD_USERID)
+
+    //Start and end time are stored as text in SQLite, the CHECK on them
+    //holds only because all the shift times are stored in UTC.
+    sqliteShiftSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL CHECK(%s > %s),
+                     %s INTEGER NOT NULL,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NOT NULL);`,
+                     SHIFT_TABLE_NAME,
+                     SHIFT_FIELD_UUID, SHIFT_FIELD_UUID, UUID_STR_LEN,
+                     SHIFT_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SHIFT_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     SHIFT_FIELD_START_TIME,
+                     SHIFT_FIELD_END_TIME, SHIFT_FIELD_END_TIME,
+                     SHIFT_FIELD_START_TIME,
+                     SHIFT_FIELD_MINSTAFF,
+                     SHIFT_FIELD_STATUS, SHIFT_FIELD_STATUS,
+                     SHIFT_FIELD_OWNER,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SHIFT_FIELD_CREATE_TIME)
+
+    sqliteRosterSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     ROSTER_TABLE_NAME,
+                     ROSTER_FIELD_UUID, ROSTER_FIELD_UUID, UUID_STR_LEN,
+                     ROSTER_FIELD_SHIFTUUID, SHIFT_TABLE_NAME, SHIFT_FIELD_UUID,
+                     ROSTER_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ROSTER_FIELD_USERID, USER_TABLE_NAME, USER_FIELD_USERID,
+                     ROSTER_FIELD_ASSIGN_TIME,
+                     ROSTER_FIELD_SHIFTUUID, ROSTER_FIELD_USERID)
+    sqliteSessionSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) = %d),
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s INTEGER NOT NULL CHECK(%s > 0));`,
+                     SESSION_TABLE_NAME,
+                     SESSION_FIELD_UUID, SESSION_FIELD_UUID, UUID_STR_LEN,
+                     SESSION_FIELD_USERID, USER_TABLE_NAME, USER_FIELD_USERID,
+                     SESSION_FIELD_REFRESH_HASH, SESSION_FIELD_REFRESH_HASH,
+                     SESSION_HASH_LEN,
+                     SESSION_FIELD_CREATE_TIME,
+                     SESSION_FIELD_EXPIRY_TIME,
+                     SESSION_FIELD_STATUS, SESSION_FIELD_STATUS)
+    sqliteRoleDefSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s INTEGER NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s TEXT NOT NULL,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s boolean NOT NULL);`,
+                     ROLEDEF_TABLE_NAME,
+                     ROLEDEF_FIELD_ROLETYPE,
+                     ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                     ROLEDEF_FIELD_NAME, ROLEDEF_FIELD_NAME, ROLE_NAME_STR_LEN,
+                     ROLEDEF_FIELD_PERMISSIONS,
+                     ROLEDEF_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ROLEDEF_FIELD_SYSTEM)
+    sqliteAvailabilitySchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL,
+                     %s INTEGER NOT NULL,
+                     %s INTEGER NOT NULL,
+                     %s timestamp NULL,
+                     %s timestamp NULL,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d));`,
+                     AVAILABILITY_TABLE_NAME,
+                     AVAILABILITY_FIELD_UUID, AVAILABILITY_FIELD_UUID,
+                     UUID_STR_LEN,
+                     AVAILABILITY_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     AVAILABILITY_FIELD_KIND, AVAILABILITY_FIELD_KIND,
+                     AVAILABILITY_FIELD_WEEKDAYS,
+                     AVAILABILITY_FIELD_START_OFFSET,
+                     AVAILABILITY_FIELD_DURATION,
+                     AVAILABILITY_FIELD_START_TIME,
+                     AVAILABILITY_FIELD_END_TIME,
+                     AVAILABILITY_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     AVAILABILITY_FIELD_WEIGHT,
+                     AVAILABILITY_FIELD_NOTE, AVAILABILITY_FIELD_NOTE,
+                     AVAILABILITY_NOTE_STR_LEN)
+    sqliteLeavePolicySchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s boolean NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     LEAVE_POLICY_TABLE_NAME,
+                     LEAVE_POLICY_FIELD_UUID, LEAVE_POLICY_FIELD_UUID,
+                     UUID_STR_LEN,
+                     LEAVE_POLICY_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     LEAVE_POLICY_FIELD_NAME, LEAVE_POLICY_FIELD_NAME,
+                     LEAVE_NAME_STR_LEN,
+                     LEAVE_POLICY_FIELD_KIND, LEAVE_POLICY_FIELD_KIND,
+                     LEAVE_POLICY_FIELD_ACCRUAL, LEAVE_POLICY_FIELD_ACCRUAL,
+                     LEAVE_POLICY_FIELD_MAX_BALANCE,
+                     LEAVE_POLICY_FIELD_MAX_BALANCE,
+                     LEAVE_POLICY_FIELD_TRACKED,
+                     LEAVE_POLICY_FIELD_ORGUUID, LEAVE_POLICY_FIELD_NAME)
+    sqliteLeaveBalanceSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     LEAVE_BALANCE_TABLE_NAME,
+                     LEAVE_BALANCE_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     LEAVE_BALANCE_FIELD_POLICYUUID,
+                     LEAVE_POLICY_TABLE_NAME, LEAVE_POLICY_FIELD_UUID,
+                     LEAVE_BALANCE_FIELD_BALANCE,
+                     LEAVE_BALANCE_FIELD_LAST_ACCRUAL,
+                     LEAVE_BALANCE_FIELD_USERID, LEAVE_BALANCE_FIELD_POLICYUUID)
+    sqliteLeaveSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s timestamp NOT NULL,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NULL);`,
+                     LEAVE_TABLE_NAME,
+                     LEAVE_FIELD_UUID, LEAVE_FIELD_UUID, UUID_STR_LEN,
+                     LEAVE_FIELD_USERID, USER_TABLE_NAME, USER_FIELD_USERID,
+                     LEAVE_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     LEAVE_FIELD_POLICYUUID,
+                     LEAVE_POLICY_TABLE_NAME, LEAVE_POLICY_FIELD_UUID,
+                     LEAVE_FIELD_START_TIME,
+                     LEAVE_FIELD_END_TIME,
+                     LEAVE_FIELD_CHARGE, LEAVE_FIELD_CHARGE,
+                     LEAVE_FIELD_STATUS, LEAVE_FIELD_STATUS,
+                     LEAVE_FIELD_NOTE, LEAVE_FIELD_NOTE, LEAVE_NAME_STR_LEN,
+                     LEAVE_FIELD_CREATE_TIME,
+                     LEAVE_FIELD_DECIDED_BY, USER_TABLE_NAME, USER_FIELD_USERID,
+                     LEAVE_FIELD_DECIDE_TIME)
+    sqliteSwapSettingsSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0));`,
+                     SWAP_SETTINGS_TABLE_NAME,
+                     SWAP_SETTINGS_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SWAP_SETTINGS_FIELD_MIN_REST, SWAP_SETTINGS_FIELD_MIN_REST,
+                     SWAP_SETTINGS_FIELD_APPROVER_ROLE,
+                     SWAP_SETTINGS_FIELD_APPROVER_ROLE)
+    sqliteSwapOfferSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NULL);`,
+                     SWAP_OFFER_TABLE_NAME,
+                     SWAP_OFFER_FIELD_UUID, SWAP_OFFER_FIELD_UUID, UUID_STR_LEN,
+                     SWAP_OFFER_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SWAP_OFFER_FIELD_ASSIGNMENTUUID,
+                     ROSTER_TABLE_NAME, ROSTER_FIELD_UUID,
+                     SWAP_OFFER_FIELD_OFFERED_BY,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SWAP_OFFER_FIELD_KIND, SWAP_OFFER_FIELD_KIND,
+                     SWAP_OFFER_FIELD_TARGET_ASSIGNMENT,
+                     ROSTER_TABLE_NAME, ROSTER_FIELD_UUID,
+                     SWAP_OFFER_FIELD_TAKEN_BY,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SWAP_OFFER_FIELD_STATUS, SWAP_OFFER_FIELD_STATUS,
+                     SWAP_OFFER_FIELD_APPROVER_ROLE,
+                     SWAP_OFFER_FIELD_APPROVER_ROLE,
+                     SWAP_OFFER_FIELD_CREATE_TIME,
+                     SWAP_OFFER_FIELD_DECIDED_BY,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SWAP_OFFER_FIELD_DECIDE_TIME)
+    sqliteSwapAuditSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s TEXT NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d));`,
+                     SWAP_AUDIT_TABLE_NAME,
+                     SWAP_AUDIT_FIELD_UUID, SWAP_AUDIT_FIELD_UUID, UUID_STR_LEN,
+                     SWAP_AUDIT_FIELD_OFFERUUID, SWAP_AUDIT_FIELD_OFFERUUID,
+                     UUID_STR_LEN,
+                     SWAP_AUDIT_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SWAP_AUDIT_FIELD_STATUS, SWAP_AUDIT_FIELD_STATUS,
+                     SWAP_AUDIT_FIELD_ACTOR,
+                     SWAP_AUDIT_FIELD_AUDIT_TIME,
+                     SWAP_AUDIT_FIELD_NOTE, SWAP_AUDIT_FIELD_NOTE,
+                     SWAP_NOTE_STR_LEN)
+    sqliteOnCallRotationSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     ONCALL_ROTATION_TABLE_NAME,
+                     ONCALL_ROTATION_FIELD_UUID, ONCALL_ROTATION_FIELD_UUID,
+                     UUID_STR_LEN,
+                     ONCALL_ROTATION_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ONCALL_ROTATION_FIELD_NAME, ONCALL_ROTATION_FIELD_NAME,
+                     ONCALL_NAME_STR_LEN,
+                     ONCALL_ROTATION_FIELD_LEVEL, ONCALL_ROTATION_FIELD_LEVEL,
+                     ONCALL_ROTATION_FIELD_LAYER, ONCALL_ROTATION_FIELD_LAYER,
+                     ONCALL_ROTATION_FIELD_HANDOFF_TIME,
+                     ONCALL_ROTATION_FIELD_TURN_LENGTH,
+                     ONCALL_ROTATION_FIELD_TURN_LENGTH,
+                     ONCALL_ROTATION_FIELD_WEEKDAYS,
+                     ONCALL_ROTATION_FIELD_WEEKDAYS,
+                     ONCALL_ROTATION_FIELD_START_OFFSET,
+                     ONCALL_ROTATION_FIELD_START_OFFSET,
+                     ONCALL_ROTATION_FIELD_DURATION,
+                     ONCALL_ROTATION_FIELD_DURATION,
+                     ONCALL_ROTATION_FIELD_CREATE_TIME,
+                     ONCALL_ROTATION_FIELD_ORGUUID, ONCALL_ROTATION_FIELD_NAME)
+    sqliteOnCallMemberSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     PRIMARY KEY (%s, %s),
+                     UNIQUE (%s, %s));`,
+                     ONCALL_MEMBER_TABLE_NAME,
+                     ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                     ONCALL_ROTATION_TABLE_NAME, ONCALL_ROTATION_FIELD_UUID,
+                     ONCALL_MEMBER_FIELD_POSITION, ONCALL_MEMBER_FIELD_POSITION,
+                     ONCALL_MEMBER_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                     ONCALL_MEMBER_FIELD_POSITION,
+                     ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                     ONCALL_MEMBER_FIELD_USERID)
+    sqliteOnCallOverrideSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     CHECK(%s > %s));`,
+                     ONCALL_OVERRIDE_TABLE_NAME,
+                     ONCALL_OVERRIDE_FIELD_UUID, ONCALL_OVERRIDE_FIELD_UUID,
+                     UUID_STR_LEN,
+                     ONCALL_OVERRIDE_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ONCALL_OVERRIDE_FIELD_LEVEL, ONCALL_OVERRIDE_FIELD_LEVEL,
+                     ONCALL_OVERRIDE_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ONCALL_OVERRIDE_FIELD_START_TIME,
+                     ONCALL_OVERRIDE_FIELD_END_TIME,
+                     ONCALL_OVERRIDE_FIELD_CREATE_TIME,
+                     ONCALL_OVERRIDE_FIELD_END_TIME,
+                     ONCALL_OVERRIDE_FIELD_START_TIME)
+    sqliteEscalationSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s INTEGER NOT NULL CHECK(%s >= 0));`,
+                     ESCALATION_TABLE_NAME,
+                     ESCALATION_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ESCALATION_FIELD_MANAGER,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ESCALATION_FIELD_STEP_TIMEOUT,
+                     ESCALATION_FIELD_STEP_TIMEOUT)
+
+    sqliteShiftRevisionSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s timestamp NOT NULL);`,
+                     SHIFT_REVISION_TABLE_NAME,
+                     SHIFT_REVISION_FIELD_SHIFTUUID,
+                     SHIFT_TABLE_NAME, SHIFT_FIELD_UUID,
+                     SHIFT_REVISION_FIELD_SEQUENCE,
+                     SHIFT_REVISION_FIELD_SEQUENCE,
+                     SHIFT_REVISION_FIELD_MODIFY_TIME)
+    sqliteFeedSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) = %d),
+                     %s timestamp NOT NULL);`,
+                     FEED_TABLE_NAME,
+                     FEED_FIELD_UUID, FEED_FIELD_UUID, UUID_STR_LEN,
+                     FEED_FIELD_KIND, FEED_FIELD_KIND,
+                     FEED_FIELD_USERID, USER_TABLE_NAME, USER_FIELD_USERID,
+                     FEED_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     FEED_FIELD_TOKEN_HASH, FEED_FIELD_TOKEN_HASH,
+                     FEED_HASH_LEN,
+                     FEED_FIELD_CREATE_TIME)
+
+    sqlitePatternSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s TEXT NOT NULL,
+                     %s TEXT NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s INTEGER NOT NULL,
+                     %s timestamp NULL,
+                     %s timestamp NULL,
+                     %s TEXT NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NOT NULL);`,
+                     PATTERN_TABLE_NAME,
+                     PATTERN_FIELD_UUID, PATTERN_FIELD_UUID, UUID_STR_LEN,
+                     PATTERN_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     PATTERN_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     PATTERN_FIELD_NAME,
+                     PATTERN_FIELD_RULE,
+                     PATTERN_FIELD_DTSTART,
+                     PATTERN_FIELD_MINSTAFF,
+                     PATTERN_FIELD_VALID_FROM,
+                     PATTERN_FIELD_VALID_UNTIL,
+                     PATTERN_FIELD_OWNER,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     PATTERN_FIELD_CREATE_TIME)
+    sqlitePatternStepSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s INTEGER NOT NULL,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     PRIMARY KEY (%s, %s));`,
+                     PATTERN_STEP_TABLE_NAME,
+                     PATTERN_STEP_FIELD_PATTERNUUID,
+                     PATTERN_TABLE_NAME, PATTERN_FIELD_UUID,
+                     PATTERN_STEP_FIELD_POSITION, PATTERN_STEP_FIELD_POSITION,
+                     PATTERN_STEP_FIELD_START_OFFSET,
+                     PATTERN_STEP_FIELD_DURATION, PATTERN_STEP_FIELD_DURATION,
+                     PATTERN_STEP_FIELD_PATTERNUUID,
+                     PATTERN_STEP_FIELD_POSITION)
+    sqlitePatternExdateSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     PATTERN_EXDATE_TABLE_NAME,
+                     PATTERN_EXDATE_FIELD_PATTERNUUID,
+                     PATTERN_TABLE_NAME, PATTERN_FIELD_UUID,
+                     PATTERN_EXDATE_FIELD_EXDATE,
+                     PATTERN_EXDATE_FIELD_PATTERNUUID,
+                     PATTERN_EXDATE_FIELD_EXDATE)
+    sqlitePatternOccurrenceSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     %s boolean NOT NULL);`,
+                     PATTERN_OCCURRENCE_TABLE_NAME,
+                     PATTERN_OCCURRENCE_FIELD_SHIFTUUID,
+                     SHIFT_TABLE_NAME, SHIFT_FIELD_UUID,
+                     PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                     PATTERN_TABLE_NAME, PATTERN_FIELD_UUID,
+                     PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                     PATTERN_OCCURRENCE_FIELD_DETACHED)
+    sqliteOrgTimeZoneSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d));`,
+                     ORG_TIME_ZONE_TABLE_NAME,
+                     ORG_TIME_ZONE_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ORG_TIME_ZONE_FIELD_TIME_ZONE,
+                     ORG_TIME_ZONE_FIELD_TIME_ZONE, timezone.TIME_ZONE_STR_LEN)
+)
+
+var (
+    sqliteHolidayCalendarSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s REAL NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     HOLIDAY_CALENDAR_TABLE_NAME,
+                     HOLIDAY_CALENDAR_FIELD_UUID, HOLIDAY_CALENDAR_FIELD_UUID,
+                     UUID_STR_LEN,
+                     HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     HOLIDAY_CALENDAR_FIELD_NAME, HOLIDAY_CALENDAR_FIELD_NAME,
+                     HOLIDAY_NAME_STR_LEN,
+                     HOLIDAY_CALENDAR_FIELD_PAY_MULTIPLIER,
+                     HOLIDAY_CALENDAR_FIELD_PAY_MULTIPLIER,
+                     HOLIDAY_CALENDAR_FIELD_STAFF_PERCENT,
+                     HOLIDAY_CALENDAR_FIELD_STAFF_PERCENT,
+                     HOLIDAY_CALENDAR_FIELD_CREATE_TIME,
+                     HOLIDAY_CALENDAR_FIELD_ORGUUID,
+                     HOLIDAY_CALENDAR_FIELD_NAME)
+    sqliteHolidaySchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL PRIMARY KEY CHECK(length(%s) = %d),
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s date NOT NULL,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s REAL NOT NULL CHECK(%s > 0),
+                     %s INTEGER NOT NULL CHECK(%s >= 0),
+                     %s boolean NOT NULL);`,
+                     HOLIDAY_TABLE_NAME,
+                     HOLIDAY_FIELD_UUID, HOLIDAY_FIELD_UUID, UUID_STR_LEN,
+                     HOLIDAY_FIELD_CALENDARUUID,
+                     HOLIDAY_CALENDAR_TABLE_NAME, HOLIDAY_CALENDAR_FIELD_UUID,
+                     HOLIDAY_FIELD_DAY,
+                     HOLIDAY_FIELD_NAME, HOLIDAY_FIELD_NAME,
+                     HOLIDAY_NAME_STR_LEN,
+                     HOLIDAY_FIELD_PAY_MULTIPLIER, HOLIDAY_FIELD_PAY_MULTIPLIER,
+                     HOLIDAY_FIELD_STAFF_PERCENT, HOLIDAY_FIELD_STAFF_PERCENT,
+                     HOLIDAY_FIELD_IMPORTED)
+    sqliteUserSkillSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s timestamp NULL,
+                     %s timestamp NULL,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     USER_SKILL_TABLE_NAME,
+                     USER_SKILL_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     USER_SKILL_FIELD_NAME, USER_SKILL_FIELD_NAME,
+                     SKILL_NAME_STR_LEN,
+                     USER_SKILL_FIELD_KIND, USER_SKILL_FIELD_KIND,
+                     USER_SKILL_FIELD_VALID_FROM,
+                     USER_SKILL_FIELD_EXPIRY_TIME,
+                     USER_SKILL_FIELD_MODIFY_TIME,
+                     USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME)
+    sqliteTemplateSkillSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL CHECK(length(%s) < %d),
+                     PRIMARY KEY (%s, %s));`,
+                     TEMPLATE_SKILL_TABLE_NAME,
+                     TEMPLATE_SKILL_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     TEMPLATE_SKILL_FIELD_SKILL, TEMPLATE_SKILL_FIELD_SKILL,
+                     SKILL_NAME_STR_LEN,
+                     TEMPLATE_SKILL_FIELD_TEMPLATEUUID,
+                     TEMPLATE_SKILL_FIELD_SKILL)
+    sqliteInviteSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s TEXT NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s INTEGER NOT NULL CHECK(%s > 0),
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     INVITE_TABLE_NAME,
+                     INVITE_FIELD_USERID,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     INVITE_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     INVITE_FIELD_ROLETYPE, INVITE_FIELD_ROLETYPE,
+                     INVITE_FIELD_INVITE_TIME,
+                     INVITE_FIELD_USERID, INVITE_FIELD_ORGUUID)
+)
+
+//SQLite has no time type with zone, the instants are kept as text in the
+// zone they are bound. Rewrite the instants that are not in UTC, so that the
+// text of the instants compare in the order of time. The time is kept to
+// milliseconds.
+func sqliteInstantColumnsToUTC() []string {
+    stmts := []string{}
+    for _, col := range(instantColumns) {
+        stmts = append(stmts, fmt.Sprintf(
+                    `UPDATE %s SET %s = strftime('%%Y-%%m-%%d %%H:%%M:%%f+00:00',
+                     %s) WHERE %s NOT LIKE '%%+00:00'`,
+                    col[0], col[1], col[1], col[1]))
+    }
+    return stmts
+}
+
+//Drop the time zones of orgs, the instants are left in UTC.
+var sqliteTimeZoneSchemaDown = []string{
+    fmt.Sprintf("DROP TABLE IF EXISTS %s", ORG_TIME_ZONE_TABLE_NAME),
+}
+
+//Schema migrations of SQLite DB, the versions must be same as the postgreSQL
+// migrations.
+var sqliteMigrations = []migration{
+    {
+        version : 1,
+        name : "initial schema",
+        up : []string{
+            sqliteRoleSchema,
+            roleSeed,
+            sqliteOrgSchema,
+            sqliteUserSchema,
+            sqliteMembershipSchema,
+            sqliteShiftTemplateSchema,
+            sqliteShiftSchema,
+            sqliteRosterSchema,
+        },
+        down : initialSchemaDown,
+    },
+    {
+        version : 2,
+        name : "login sessions",
+        up : []string{
+            sqliteSessionSchema,
+            sessionUserIndex,
+        },
+        down : sessionSchemaDown,
+    },
+    {
+        version : 3,
+        name : "custom roles",
+        up : []string{
+            sqliteRoleDefSchema,
+            roledefSeed,
+        },
+        down : roleDefSchemaDown,
+    },
+    {
+        version : 4,
+        name : "user availability",
+        up : []string{
+            sqliteAvailabilitySchema,
+            availabilityUserIndex,
+        },
+        down : availabilitySchemaDown,
+    },
+    {
+        version : 5,
+        name : "leave requests",
+        up : []string{
+            sqliteLeavePolicySchema,
+            sqliteLeaveBalanceSchema,
+            sqliteLeaveSchema,
+            leaveUserIndex,
+        },
+        down : leaveSchemaDown,
+    },
+    {
+        version : 6,
+        name : "shift swaps",
+        up : []string{
+            sqliteSwapSettingsSchema,
+            sqliteSwapOfferSchema,
+            swapOfferOrgIndex,
+            sqliteSwapAuditSchema,
+            swapAuditOfferIndex,
+        },
+        down : swapSchemaDown,
+    },
+    {
+        version : 7,
+        name : "on-call rotations",
+        up : []string{
+            sqliteOnCallRotationSchema,
+            sqliteOnCallMemberSchema,
+            sqliteOnCallOverrideSchema,
+            onCallOverrideOrgIndex,
+            sqliteEscalationSchema,
+        },
+        down : onCallSchemaDown,
+    },
+    {
+        version : 8,
+        name : "calendar feeds",
+        up : []string{
+            sqliteShiftRevisionSchema,
+            sqliteFeedSchema,
+            feedUserIndex,
+        },
+        down : feedSchemaDown,
+    },
+    {
+        version : 9,
+        name : "shift patterns",
+        up : []string{
+            sqlitePatternSchema,
+            sqlitePatternStepSchema,
+            sqlitePatternExdateSchema,
+            sqlitePatternOccurrenceSchema,
+            patternOccurrenceIndex,
+        },
+        down : patternSchemaDown,
+    },
+    {
+        version : 10,
+        name : "time zones",
+        up : append([]string{sqliteOrgTimeZoneSchema},
+                    sqliteInstantColumnsToUTC()...),
+        down : sqliteTimeZoneSchemaDown,
+    },
+    {
+        version : 11,
+        name : "holiday calendars",
+        up : []string{
+            sqliteHolidayCalendarSchema,
+            sqliteHolidaySchema,
+            holidayCalendarDayIndex,
+        },
+        down : holidaySchemaDown,
+    },
+    {
+        version : 12,
+        name : "skills",
+        up : []string{
+            sqliteUserSkillSchema,
+            userSkillExpiryIndex,
+            sqliteTemplateSkillSchema,
+        },
+        down : skillSchemaDown,
+    },
+    {
+        version : 13,
+        name : "membership invites",
+        up : []string{
+            sqliteInviteSchema,
+        },
+        down : inviteSchemaDown,
+    },
+}
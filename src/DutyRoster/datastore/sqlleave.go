@@ -0,0 +1,852 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of leave policy table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'LeavePolicy' structure.
+type dbLeavePolicy struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    Name string `db:"name"`
+    Kind uint64 `db:"kind"`
+    Accrual int64 `db:"accrual"` //Accrual in seconds.
+    MaxBalance int64 `db:"maxbalance"` //Maximum balance in seconds.
+    Tracked bool `db:"tracked"`
+}
+
+//The db representation of leave balance table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'LeaveBalance' structure.
+type dbLeaveBalance struct {
+    Userid string `db:"userid"`
+    PolicyUuid string `db:"policyuuid"`
+    Balance int64 `db:"balance"` //Balance in seconds.
+    LastAccrual time.Time `db:"lastaccrual"`
+}
+
+//The db representation of leave request table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'LeaveRequest' structure.
+type dbLeaveRequest struct {
+    Uuid string `db:"uuid"`
+    Userid string `db:"userid"`
+    OrgUuid string `db:"orguuid"`
+    PolicyUuid string `db:"policyuuid"`
+    StartTime time.Time `db:"starttime"`
+    EndTime time.Time `db:"endtime"`
+    Charge int64 `db:"charge"` //Charge in seconds.
+    Status uint64 `db:"status"`
+    Note string `db:"note"`
+    CreateTime time.Time `db:"createtime"`
+    DecidedBy sql.NullString `db:"decidedby"`
+    DecideTime sql.NullTime `db:"decidetime"`
+}
+
+// SQL representation for leave policy.
+type sqlLeavePolicy struct {
+    LeavePolicy
+}
+
+// SQL representation for leave balance.
+type sqlLeaveBalance struct {
+    LeaveBalance
+}
+
+// SQL representation for leave request.
+type sqlLeaveRequest struct {
+    LeaveRequest
+}
+
+//String representation of leave tables and its elements.
+const (
+    LEAVE_POLICY_TABLE_NAME = "leavepolicies"
+    LEAVE_POLICY_FIELD_UUID = "uuid"
+    LEAVE_POLICY_FIELD_ORGUUID = "orguuid"
+    LEAVE_POLICY_FIELD_NAME = "name"
+    LEAVE_POLICY_FIELD_KIND = "kind"
+    LEAVE_POLICY_FIELD_ACCRUAL = "accrual"
+    LEAVE_POLICY_FIELD_MAX_BALANCE = "maxbalance"
+    LEAVE_POLICY_FIELD_TRACKED = "tracked"
+
+    LEAVE_BALANCE_TABLE_NAME = "leavebalances"
+    LEAVE_BALANCE_FIELD_USERID = "userid"
+    LEAVE_BALANCE_FIELD_POLICYUUID = "policyuuid"
+    LEAVE_BALANCE_FIELD_BALANCE = "balance"
+    LEAVE_BALANCE_FIELD_LAST_ACCRUAL = "lastaccrual"
+
+    LEAVE_TABLE_NAME = "leaverequests"
+    LEAVE_FIELD_UUID = "uuid"
+    LEAVE_FIELD_USERID = "userid"
+    LEAVE_FIELD_ORGUUID = "orguuid"
+    LEAVE_FIELD_POLICYUUID = "policyuuid"
+    LEAVE_FIELD_START_TIME = "starttime"
+    LEAVE_FIELD_END_TIME = "endtime"
+    LEAVE_FIELD_CHARGE = "charge"
+    LEAVE_FIELD_STATUS = "status"
+    LEAVE_FIELD_NOTE = "note"
+    LEAVE_FIELD_CREATE_TIME = "createtime"
+    LEAVE_FIELD_DECIDED_BY = "decidedby"
+    LEAVE_FIELD_DECIDE_TIME = "decidetime"
+)
+
+// SQL statements to be used to operate on leave tables.
+var (
+    //Create a table leavepolicies, name of policy is unique in an org/unit.
+    leavePolicySchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s boolean NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     LEAVE_POLICY_TABLE_NAME,
+                     LEAVE_POLICY_FIELD_UUID,
+                     LEAVE_POLICY_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     LEAVE_POLICY_FIELD_NAME, LEAVE_NAME_STR_LEN,
+                     LEAVE_POLICY_FIELD_KIND, LEAVE_POLICY_FIELD_KIND,
+                     LEAVE_POLICY_FIELD_ACCRUAL, LEAVE_POLICY_FIELD_ACCRUAL,
+                     LEAVE_POLICY_FIELD_MAX_BALANCE,
+                     LEAVE_POLICY_FIELD_MAX_BALANCE,
+                     LEAVE_POLICY_FIELD_TRACKED,
+                     LEAVE_POLICY_FIELD_ORGUUID, LEAVE_POLICY_FIELD_NAME)
+    //Create a table leavebalances, one row for each user and policy.
+    leaveBalanceSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     LEAVE_BALANCE_TABLE_NAME,
+                     LEAVE_BALANCE_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     LEAVE_BALANCE_FIELD_POLICYUUID,
+                     LEAVE_POLICY_TABLE_NAME, LEAVE_POLICY_FIELD_UUID,
+                     LEAVE_BALANCE_FIELD_BALANCE,
+                     LEAVE_BALANCE_FIELD_LAST_ACCRUAL,
+                     LEAVE_BALANCE_FIELD_USERID, LEAVE_BALANCE_FIELD_POLICYUUID)
+    //Create a table leaverequests.
+    leaveSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s varchar(%d) NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NULL);`,
+                     LEAVE_TABLE_NAME,
+                     LEAVE_FIELD_UUID,
+                     LEAVE_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     LEAVE_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     LEAVE_FIELD_POLICYUUID,
+                     LEAVE_POLICY_TABLE_NAME, LEAVE_POLICY_FIELD_UUID,
+                     LEAVE_FIELD_START_TIME,
+                     LEAVE_FIELD_END_TIME,
+                     LEAVE_FIELD_CHARGE, LEAVE_FIELD_CHARGE,
+                     LEAVE_FIELD_STATUS, LEAVE_FIELD_STATUS,
+                     LEAVE_FIELD_NOTE, LEAVE_NAME_STR_LEN,
+                     LEAVE_FIELD_CREATE_TIME,
+                     LEAVE_FIELD_DECIDED_BY, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     LEAVE_FIELD_DECIDE_TIME)
+    //Index to find the leave requests of a user.
+    leaveUserIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s)`,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_USERID,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_USERID)
+    //Create a leave policy entry.
+    leavePolicyCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                            LEAVE_POLICY_TABLE_NAME,
+                            LEAVE_POLICY_FIELD_UUID, LEAVE_POLICY_FIELD_ORGUUID,
+                            LEAVE_POLICY_FIELD_NAME, LEAVE_POLICY_FIELD_KIND,
+                            LEAVE_POLICY_FIELD_ACCRUAL,
+                            LEAVE_POLICY_FIELD_MAX_BALANCE,
+                            LEAVE_POLICY_FIELD_TRACKED)
+    //Get the leave policy with specific uuid
+    leavePolicyGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            LEAVE_POLICY_TABLE_NAME, LEAVE_POLICY_FIELD_UUID)
+    //Get the leave policy with specific name in org/unit.
+    leavePolicyGetonOrgName = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s=($2)`,
+                            LEAVE_POLICY_TABLE_NAME,
+                            LEAVE_POLICY_FIELD_ORGUUID, LEAVE_POLICY_FIELD_NAME)
+    //Get all the leave policies of a org/unit.
+    leavePolicyGetonOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            LEAVE_POLICY_TABLE_NAME,
+                            LEAVE_POLICY_FIELD_ORGUUID, LEAVE_POLICY_FIELD_NAME)
+    //Delete the leave policy with specific uuid
+    leavePolicyDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            LEAVE_POLICY_TABLE_NAME, LEAVE_POLICY_FIELD_UUID)
+    //Create a leave balance entry.
+    leaveBalanceCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4)`,
+                            LEAVE_BALANCE_TABLE_NAME,
+                            LEAVE_BALANCE_FIELD_USERID,
+                            LEAVE_BALANCE_FIELD_POLICYUUID,
+                            LEAVE_BALANCE_FIELD_BALANCE,
+                            LEAVE_BALANCE_FIELD_LAST_ACCRUAL)
+    //Get the leave balance of a user for a policy.
+    leaveBalanceGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1) AND %s=($2)`,
+                            LEAVE_BALANCE_TABLE_NAME,
+                            LEAVE_BALANCE_FIELD_USERID,
+                            LEAVE_BALANCE_FIELD_POLICYUUID)
+    //Update the leave balance of a user for a policy.
+    leaveBalanceUpdate = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2)
+                            WHERE %s=($3) AND %s=($4)`,
+                            LEAVE_BALANCE_TABLE_NAME,
+                            LEAVE_BALANCE_FIELD_BALANCE,
+                            LEAVE_BALANCE_FIELD_LAST_ACCRUAL,
+                            LEAVE_BALANCE_FIELD_USERID,
+                            LEAVE_BALANCE_FIELD_POLICYUUID)
+    //Create a leave request entry.
+    leaveCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+                            LEAVE_TABLE_NAME,
+                            LEAVE_FIELD_UUID, LEAVE_FIELD_USERID,
+                            LEAVE_FIELD_ORGUUID, LEAVE_FIELD_POLICYUUID,
+                            LEAVE_FIELD_START_TIME, LEAVE_FIELD_END_TIME,
+                            LEAVE_FIELD_CHARGE, LEAVE_FIELD_STATUS,
+                            LEAVE_FIELD_NOTE, LEAVE_FIELD_CREATE_TIME)
+    //Get the leave request with specific uuid
+    leaveGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_UUID)
+    //Get all the leave requests of a user that overlaps the range.
+    leaveGetonUserRange = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s > ($2) AND %s < ($3) ORDER BY %s`,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_USERID,
+                            LEAVE_FIELD_END_TIME, LEAVE_FIELD_START_TIME,
+                            LEAVE_FIELD_START_TIME)
+    //Get the leave requests of a user in a status that overlaps the range.
+    leaveGetonUserStatusRange = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s=($2) AND %s > ($3) AND %s < ($4)
+                            ORDER BY %s`,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_USERID,
+                            LEAVE_FIELD_STATUS,
+                            LEAVE_FIELD_END_TIME, LEAVE_FIELD_START_TIME,
+                            LEAVE_FIELD_START_TIME)
+    //Get all the leave requests in a status of org/unit.
+    leaveGetonOrgStatus = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s=($2) ORDER BY %s`,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_ORGUUID,
+                            LEAVE_FIELD_STATUS, LEAVE_FIELD_START_TIME)
+    //Move the leave request to new status, only when in the expected status.
+    leaveUpdateStatus = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2), %s=($3)
+                            WHERE %s=($4) AND %s=($5)`,
+                            LEAVE_TABLE_NAME, LEAVE_FIELD_STATUS,
+                            LEAVE_FIELD_DECIDED_BY, LEAVE_FIELD_DECIDE_TIME,
+                            LEAVE_FIELD_UUID, LEAVE_FIELD_STATUS)
+)
+
+//Translate leave policy to DB row in table.
+func (policy *sqlLeavePolicy)leavePolicyToDBRowXlate() *dbLeavePolicy {
+    dbrow := new(dbLeavePolicy)
+    dbrow.Uuid = syncParam.UUIDtoString(policy.uuid)
+    dbrow.OrgUuid = syncParam.UUIDtoString(policy.orgUUID)
+    dbrow.Name = policy.name
+    dbrow.Kind = uint64(policy.kind)
+    dbrow.Accrual = int64(policy.accrual / time.Second)
+    dbrow.MaxBalance = int64(policy.maxBalance / time.Second)
+    dbrow.Tracked = policy.tracked
+    return dbrow
+}
+
+//Translate DB leave policy row to leave policy structure.
+func (policy *sqlLeavePolicy)dbToLeavePolicyRowXlate(dbrow *dbLeavePolicy) {
+    policy.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    policy.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    policy.name = dbrow.Name
+    policy.kind = LeaveKindBit(dbrow.Kind)
+    policy.accrual = time.Duration(dbrow.Accrual) * time.Second
+    policy.maxBalance = time.Duration(dbrow.MaxBalance) * time.Second
+    policy.tracked = dbrow.Tracked
+}
+
+//Translate DB leave balance row to leave balance structure.
+func (bal *sqlLeaveBalance)dbToLeaveBalanceRowXlate(dbrow *dbLeaveBalance) {
+    bal.userid = dbrow.Userid
+    bal.policyUUID = syncParam.StringtoUUID(dbrow.PolicyUuid)
+    bal.balance = time.Duration(dbrow.Balance) * time.Second
+    bal.lastAccrual = dbrow.LastAccrual.UTC()
+}
+
+//Translate leave request to DB row in table.
+func (leave *sqlLeaveRequest)leaveToDBRowXlate() *dbLeaveRequest {
+    dbrow := new(dbLeaveRequest)
+    dbrow.Uuid = syncParam.UUIDtoString(leave.uuid)
+    dbrow.Userid = leave.userid
+    dbrow.OrgUuid = syncParam.UUIDtoString(leave.orgUUID)
+    dbrow.PolicyUuid = syncParam.UUIDtoString(leave.policyUUID)
+    dbrow.StartTime = leave.startTime.UTC()
+    dbrow.EndTime = leave.endTime.UTC()
+    dbrow.Charge = int64(leave.charge / time.Second)
+    dbrow.Status = uint64(leave.status)
+    dbrow.Note = leave.note
+    dbrow.CreateTime = leave.createTime.UTC()
+    if len(leave.decidedBy) != 0 {
+        dbrow.DecidedBy.Scan(leave.decidedBy)
+    }
+    if !leave.decideTime.IsZero() {
+        dbrow.DecideTime.Scan(leave.decideTime.UTC())
+    }
+    return dbrow
+}
+
+//Translate DB leave request row to leave request structure.
+func (leave *sqlLeaveRequest)dbToLeaveRowXlate(dbrow *dbLeaveRequest) {
+    leave.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    leave.userid = dbrow.Userid
+    leave.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    leave.policyUUID = syncParam.StringtoUUID(dbrow.PolicyUuid)
+    leave.startTime = dbrow.StartTime.UTC()
+    leave.endTime = dbrow.EndTime.UTC()
+    leave.charge = time.Duration(dbrow.Charge) * time.Second
+    leave.status = LeaveStatusBit(dbrow.Status)
+    leave.note = dbrow.Note
+    leave.createTime = dbrow.CreateTime
+    leave.decidedBy = ""
+    if dbrow.DecidedBy.Valid {
+        leave.decidedBy = dbrow.DecidedBy.String
+    }
+    leave.decideTime = time.Time{}
+    if dbrow.DecideTime.Valid {
+        leave.decideTime = dbrow.DecideTime.Time
+    }
+}
+
+//Translate a list of DB leave request rows to leave requests.
+func dbToLeaveRowsXlate(rows []dbLeaveRequest) []LeaveRequest {
+    leaves := make([]LeaveRequest, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlLeaveRequest)
+        entry.dbToLeaveRowXlate(&row)
+        leaves = append(leaves, entry.LeaveRequest)
+    }
+    return leaves
+}
+
+//Create a leave policy entry, uuid is self populated. The org/unit must be
+// present and the name must be unique in the org/unit.
+func (policy *sqlLeavePolicy)createLeavePolicyEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create leave policy, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if policy.IsLeavePolicyValid() == false {
+        log.Error("Cannot create leave policy, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = policy.orgUUID
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Cannot create leave policy %s, org %s not present",
+                 policy.name, syncParam.UUIDtoString(policy.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    var row dbLeavePolicy
+    err = getPtr(&row, leavePolicyGetonOrgName,
+                 syncParam.UUIDtoString(policy.orgUUID), policy.name)
+    if err == nil {
+        log.Info("Leave policy %s already present in org %s", policy.name,
+                 syncParam.UUIDtoString(policy.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    if err != sql.ErrNoRows {
+        return err
+    }
+    policy.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create leave policy")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    dbrow := policy.leavePolicyToDBRowXlate()
+    _, err = execPtr(leavePolicyCreate, dbrow.Uuid, dbrow.OrgUuid, dbrow.Name,
+                     dbrow.Kind, dbrow.Accrual, dbrow.MaxBalance,
+                     dbrow.Tracked)
+    if err != nil {
+        log.Error("Failed to create leave policy %s err : %s", policy.name,
+                  err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the leave policy with specific UUID.
+func (policy *sqlLeavePolicy)getLeavePolicyByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get leave policy, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    var row dbLeavePolicy
+    err = getPtr(&row, leavePolicyGetonUUID,
+                 syncParam.UUIDtoString(policy.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read leave policy %s, err : %s",
+                  syncParam.UUIDtoString(policy.uuid), err)
+        return err
+    }
+    policy.dbToLeavePolicyRowXlate(&row)
+    return nil
+}
+
+//Function to get the leave policies that apply in org/unit 'orgUUID', ie: the
+// policies of org/unit and its ancestors.
+func (policy *sqlLeavePolicy)getLeavePoliciesByOrg(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID) (
+                                     []LeavePolicy, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list leave policies, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err = orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    policies := []LeavePolicy{}
+    for entry := &orgrow.Org; entry != nil; entry = entry.parent {
+        rows := []dbLeavePolicy{}
+        err = selectPtr(&rows, leavePolicyGetonOrg,
+                        syncParam.UUIDtoString(entry.uuid))
+        if err != nil {
+            log.Trace("Failed to read leave policies of org %s, err : %s",
+                      syncParam.UUIDtoString(entry.uuid), err)
+            return nil, err
+        }
+        for _, row := range(rows) {
+            policyrow := new(sqlLeavePolicy)
+            policyrow.dbToLeavePolicyRowXlate(&row)
+            policies = append(policies, policyrow.LeavePolicy)
+        }
+    }
+    return policies, nil
+}
+
+//Function to delete the leave policy, the balances and requests of the
+// policy are deleted with it.
+func (policy *sqlLeavePolicy)deleteLeavePolicyEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete leave policy, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    err = policy.getLeavePolicyByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(leavePolicyDelete, syncParam.UUIDtoString(policy.uuid))
+    if err != nil {
+        log.Info("Failed to delete leave policy %s, err : %s",
+                 syncParam.UUIDtoString(policy.uuid), err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the leave balance of user for the policy, accrued until
+// 'now'. The balance is created when not present, and the accrual is written
+// back to the DB.
+func (bal *sqlLeaveBalance)getLeaveBalanceEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}, policy *LeavePolicy,
+                                     now time.Time) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to get leave balance, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    userStr := bal.userid
+    policyStr := syncParam.UUIDtoString(policy.uuid)
+    var row dbLeaveBalance
+    err = getPtr(&row, leaveBalanceGet, userStr, policyStr)
+    if err == sql.ErrNoRows {
+        user := new(sqlUsers)
+        user.userid = bal.userid
+        err = user.getUserwithID(sqlds, handle)
+        if err != nil {
+            log.Info("Cannot create leave balance, user %s not present",
+                     bal.userid)
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+        bal.policyUUID = policy.uuid
+        bal.balance = 0
+        bal.lastAccrual = now.UTC()
+        _, err = execPtr(leaveBalanceCreate, userStr, policyStr, int64(0),
+                         bal.lastAccrual)
+        if err != nil {
+            log.Error("Failed to create leave balance of %s, err : %s",
+                      bal.userid, err)
+        }
+        return err
+    }
+    if err != nil {
+        log.Trace("Failed to read leave balance of %s, err : %s", bal.userid,
+                  err)
+        return err
+    }
+    bal.dbToLeaveBalanceRowXlate(&row)
+    lastAccrual := bal.lastAccrual
+    bal.accrue(policy, now)
+    if bal.lastAccrual.Equal(lastAccrual) {
+        return nil
+    }
+    return bal.updateLeaveBalanceEntry(sqlds, handle)
+}
+
+//Function to write the balance and last accrual of leave balance.
+func (bal *sqlLeaveBalance)updateLeaveBalanceEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update leave balance, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    _, err = execPtr(leaveBalanceUpdate, int64(bal.balance / time.Second),
+                     bal.lastAccrual.UTC(), bal.userid,
+                     syncParam.UUIDtoString(bal.policyUUID))
+    if err != nil {
+        log.Error("Failed to update leave balance of %s, err : %s",
+                  bal.userid, err)
+        return err
+    }
+    return nil
+}
+
+//Create a leave request entry in requested status, uuid and createTime are
+// self populated. The policy must apply in the org/unit of request and the
+// user must be a member of the org/unit.
+func (leave *sqlLeaveRequest)createLeaveEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create leave request, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    leave.status = LEAVE_REQUESTED
+    if leave.IsLeaveRequestValid() == false {
+        log.Error("Cannot create leave request, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = leave.orgUUID
+    err = orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    policy := new(sqlLeavePolicy)
+    policy.uuid = leave.policyUUID
+    err = policy.getLeavePolicyByUUID(sqlds, handle)
+    if err != nil {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    member := new(sqlUserOrgRole)
+    roles, err := member.getEffectiveRoles(sqlds, handle, leave.userid,
+                                           leave.orgUUID)
+    if err != nil {
+        return err
+    }
+    if roles == 0 || !isOrgInChain(&orgrow.Org, policy.orgUUID) {
+        log.Info("Cannot create leave request, %s not member/policy of org %s",
+                 leave.userid, syncParam.UUIDtoString(leave.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    leave.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create leave request")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    leave.createTime = time.Now()
+    leave.decidedBy = ""
+    leave.decideTime = time.Time{}
+    dbrow := leave.leaveToDBRowXlate()
+    _, err = execPtr(leaveCreate, dbrow.Uuid, dbrow.Userid, dbrow.OrgUuid,
+                     dbrow.PolicyUuid, dbrow.StartTime, dbrow.EndTime,
+                     dbrow.Charge, dbrow.Status, dbrow.Note, dbrow.CreateTime)
+    if err != nil {
+        log.Error("Failed to create leave request for %s err : %s",
+                  leave.userid, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the leave request with specific UUID.
+func (leave *sqlLeaveRequest)getLeaveByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get leave request, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    var row dbLeaveRequest
+    err = getPtr(&row, leaveGetonUUID, syncParam.UUIDtoString(leave.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read leave request %s, err : %s",
+                  syncParam.UUIDtoString(leave.uuid), err)
+        return err
+    }
+    leave.dbToLeaveRowXlate(&row)
+    return nil
+}
+
+//Function to get the leave requests of user 'userid' that overlaps the range
+// [from, to). All the requests are returned when status is 0, otherwise only
+// the requests in the status.
+func (leave *sqlLeaveRequest)getLeavesByUserRange(sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string,
+                                     status LeaveStatusBit, from time.Time,
+                                     to time.Time) ([]LeaveRequest, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list leave requests, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbLeaveRequest{}
+    if status == 0 {
+        err = selectPtr(&rows, leaveGetonUserRange, userid, from.UTC(),
+                        to.UTC())
+    } else {
+        err = selectPtr(&rows, leaveGetonUserStatusRange, userid,
+                        uint64(status), from.UTC(), to.UTC())
+    }
+    if err != nil {
+        log.Trace("Failed to read leave requests of %s, err : %s", userid,
+                  err)
+        return nil, err
+    }
+    return dbToLeaveRowsXlate(rows), nil
+}
+
+//Function to get the leave requests of org/unit 'orgUUID' in the status.
+func (leave *sqlLeaveRequest)getLeavesByOrgStatus(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID,
+                                     status LeaveStatusBit) (
+                                     []LeaveRequest, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list leave requests, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbLeaveRequest{}
+    err = selectPtr(&rows, leaveGetonOrgStatus,
+                    syncParam.UUIDtoString(orgUUID), uint64(status))
+    if err != nil {
+        log.Trace("Failed to read leave requests of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    return dbToLeaveRowsXlate(rows), nil
+}
+
+//Return LEAVE_CONFLICT error when user 'userid' has an approved leave that
+// overlaps the range [from, to).
+func (leave *sqlLeaveRequest)checkLeaveConflict(sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string,
+                                     from time.Time, to time.Time) error {
+    busy, err := leave.getLeavesByUserRange(sqlds, handle, userid,
+                                            LEAVE_APPROVED, from, to)
+    if err != nil {
+        return err
+    }
+    if len(busy) != 0 {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.LEAVE_CONFLICT])
+    }
+    return nil
+}
+
+//Move the leave request to 'status' decided by user 'decidedBy'. Approval
+// charges the balance of a tracked policy, and cancelling an approved leave
+// refunds the charge. An approved leave must not overlap another approved
+// leave of the user.
+func (leave *sqlLeaveRequest)updateLeaveStatusEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}, status LeaveStatusBit,
+                                     decidedBy string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update leave request, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    err = leave.getLeaveByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    oldStatus := leave.status
+    if !IsLeaveTransitionValid(oldStatus, status) {
+        log.Info("Leave request %s cannot move from status %d to %d",
+                 syncParam.UUIDtoString(leave.uuid), oldStatus, status)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_INVALID_TRANSITION])
+    }
+    now := time.Now()
+    if status == LEAVE_APPROVED {
+        err = leave.checkLeaveConflict(sqlds, handle, leave.userid,
+                                       leave.startTime, leave.endTime)
+        if err != nil {
+            return err
+        }
+    }
+    policy := new(sqlLeavePolicy)
+    policy.uuid = leave.policyUUID
+    err = policy.getLeavePolicyByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if policy.tracked && (status == LEAVE_APPROVED ||
+                          oldStatus == LEAVE_APPROVED) {
+        bal := new(sqlLeaveBalance)
+        bal.userid = leave.userid
+        err = bal.getLeaveBalanceEntry(sqlds, handle, &policy.LeavePolicy, now)
+        if err != nil {
+            return err
+        }
+        if status == LEAVE_APPROVED {
+            if bal.balance < leave.charge {
+                log.Info("Cannot approve leave %s, balance of %s is %s",
+                         syncParam.UUIDtoString(leave.uuid), leave.userid,
+                         bal.balance)
+                return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_BALANCE_INSUFFICIENT])
+            }
+            bal.balance -= leave.charge
+        } else {
+            bal.balance += leave.charge
+        }
+        err = bal.updateLeaveBalanceEntry(sqlds, handle)
+        if err != nil {
+            return err
+        }
+    }
+    leave.status = status
+    leave.decidedBy = decidedBy
+    leave.decideTime = now
+    dbrow := leave.leaveToDBRowXlate()
+    res, err := execPtr(leaveUpdateStatus, dbrow.Status, dbrow.DecidedBy,
+                        dbrow.DecideTime, dbrow.Uuid, uint64(oldStatus))
+    if err != nil {
+        log.Error("Failed to update leave request %s, err : %s", dbrow.Uuid,
+                  err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        //Request is updated by someone else in the meantime.
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_INVALID_TRANSITION])
+    }
+    return nil
+}
+
+//Add 'delta' to the leave balance of user for a tracked policy. The balance
+// is accrued before the adjustment and cannot go below zero.
+func (bal *sqlLeaveBalance)adjustLeaveBalanceEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     delta time.Duration) error {
+    policy := new(sqlLeavePolicy)
+    policy.uuid = bal.policyUUID
+    err := policy.getLeavePolicyByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if !policy.tracked {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err = bal.getLeaveBalanceEntry(sqlds, handle, &policy.LeavePolicy,
+                                   time.Now())
+    if err != nil {
+        return err
+    }
+    if bal.balance + delta < 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.LEAVE_BALANCE_INSUFFICIENT])
+    }
+    bal.balance += delta
+    return bal.updateLeaveBalanceEntry(sqlds, handle)
+}
@@ -0,0 +1,358 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of user-role-org membership table. Each row holds a
+// single role bit, a user with more than one role in an org/unit has a row
+// for every role.
+type dbUserOrgRole struct {
+    Userid string `db:"userid"`
+    RoleType uint64 `db:"roletype"`
+    OrgUuid string `db:"orguuid"`
+    GrantTime time.Time `db:"granttime"`
+}
+
+// SQL representation for user-role-org membership.
+type sqlUserOrgRole struct {
+    UserOrgRole
+}
+
+//String representation of membership table and its elements.
+const (
+    MEMBERSHIP_TABLE_NAME = "userorgroles"
+    MEMBERSHIP_FIELD_USERID = "userid"
+    MEMBERSHIP_FIELD_ROLETYPE = "roletype"
+    MEMBERSHIP_FIELD_ORGUUID = "orguuid"
+    MEMBERSHIP_FIELD_GRANT_TIME = "granttime"
+)
+
+// SQL statements to be used to operate on membership table.
+var (
+    //Create a table userorgroles
+    membershipSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s bigint NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s, %s));`,
+                     MEMBERSHIP_TABLE_NAME,
+                     MEMBERSHIP_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     MEMBERSHIP_FIELD_ROLETYPE,
+                     ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                     MEMBERSHIP_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     MEMBERSHIP_FIELD_GRANT_TIME,
+                     MEMBERSHIP_FIELD_USERID, MEMBERSHIP_FIELD_ROLETYPE,
+                     MEMBERSHIP_FIELD_ORGUUID)
+    //Create a membership entry
+    membershipCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4)`,
+                            MEMBERSHIP_TABLE_NAME,
+                            MEMBERSHIP_FIELD_USERID, MEMBERSHIP_FIELD_ROLETYPE,
+                            MEMBERSHIP_FIELD_ORGUUID,
+                            MEMBERSHIP_FIELD_GRANT_TIME)
+    //Get the membership row of user with a role in org
+    membershipGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1) AND %s=($2)
+                            AND %s=($3)`,
+                            MEMBERSHIP_TABLE_NAME,
+                            MEMBERSHIP_FIELD_USERID, MEMBERSHIP_FIELD_ROLETYPE,
+                            MEMBERSHIP_FIELD_ORGUUID)
+    //Get all membership rows of a user
+    membershipGetonUser = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s, %s`,
+                            MEMBERSHIP_TABLE_NAME, MEMBERSHIP_FIELD_USERID,
+                            MEMBERSHIP_FIELD_ORGUUID, MEMBERSHIP_FIELD_ROLETYPE)
+    //Get all membership rows of an org
+    membershipGetonOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s, %s`,
+                            MEMBERSHIP_TABLE_NAME, MEMBERSHIP_FIELD_ORGUUID,
+                            MEMBERSHIP_FIELD_USERID, MEMBERSHIP_FIELD_ROLETYPE)
+    //Get all membership rows of a user in an org
+    membershipGetonUserOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s=($2)`,
+                            MEMBERSHIP_TABLE_NAME, MEMBERSHIP_FIELD_USERID,
+                            MEMBERSHIP_FIELD_ORGUUID)
+    //Delete a membership row
+    membershipDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1) AND %s=($2)
+                            AND %s=($3)`,
+                            MEMBERSHIP_TABLE_NAME,
+                            MEMBERSHIP_FIELD_USERID, MEMBERSHIP_FIELD_ROLETYPE,
+                            MEMBERSHIP_FIELD_ORGUUID)
+)
+
+//Translate the membership rows to UserOrgRole, rows of same user and org are
+// merged into a single entry. Rows must be ordered on user and org.
+func dbToMembershipRowsXlate(rows []dbUserOrgRole) []UserOrgRole {
+    members := make([]UserOrgRole, 0, len(rows))
+    for _, row := range(rows) {
+        orgUUID := syncParam.StringtoUUID(row.OrgUuid)
+        last := len(members) - 1
+        if last >= 0 && members[last].userid == row.Userid &&
+            members[last].UUID() == orgUUID {
+            members[last].roleType |= RoleBit(row.RoleType)
+            continue
+        }
+        members = append(members,
+                    *NewUserOrgRole(row.Userid, RoleBit(row.RoleType), orgUUID))
+    }
+    return members
+}
+
+//Check the user and org of membership are present in the DB.
+func (member *sqlUserOrgRole)isMembershipParentsPresent(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    user := new(sqlUsers)
+    user.userid = member.userid
+    err := user.getUserwithID(sqlds, handle)
+    if err != nil {
+        log.Info("User %s not present, err : %s", member.userid, err)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = member.UUID()
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Org %s not present", syncParam.UUIDtoString(member.UUID()))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Check the custom role bits of membership are defined and can be granted in
+// the org of membership.
+func (member *sqlUserOrgRole)isMembershipRolesGrantable(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    var org *Org
+    for bit := ROOTADMIN << 1; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        if org == nil {
+            orgrow := new(sqlorg)
+            orgrow.uuid = member.UUID()
+            err := orgrow.getOrgEntryByUUID(sqlds, handle)
+            if err != nil {
+                return err
+            }
+            org = &orgrow.Org
+        }
+        rl := new(sqlRole)
+        rl.roleType = bit
+        err := rl.isRoleGrantableInOrg(sqlds, handle, org)
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+//Grant the role bits of membership to the user in the org. A row is created
+// for each role bit, role bits that are already granted are left as is.
+func (member *sqlUserOrgRole)grantMembershipEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to grant role to %s, invalid DB handle err : %s",
+                  member.userid, err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if len(member.userid) == 0 || syncParam.IsUUIDEmpty(member.UUID()) ||
+        member.IsRoleBitsetValid() == false {
+        log.Error("Cannot grant role, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err = member.isMembershipParentsPresent(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    err = member.isMembershipRolesGrantable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    orgStr := syncParam.UUIDtoString(member.UUID())
+    grantTime := time.Now().UTC()
+    for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        var row dbUserOrgRole
+        err = getPtr(&row, membershipGet, member.userid, uint64(bit), orgStr)
+        if err == nil {
+            log.Trace("Role %d already granted to %s in org %s", bit,
+                      member.userid, orgStr)
+            continue
+        }
+        if err != sql.ErrNoRows {
+            return err
+        }
+        _, err = execPtr(membershipCreate, member.userid, uint64(bit), orgStr,
+                         grantTime)
+        if err != nil {
+            log.Error("Failed to grant role %d to %s in org %s err : %s",
+                      bit, member.userid, orgStr, err)
+            return err
+        }
+    }
+    return nil
+}
+
+//Revoke the role bits of membership from the user in the org. All the role
+// bits must be granted before, otherwise nothing is revoked.
+func (member *sqlUserOrgRole)revokeMembershipEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to revoke role of %s, invalid DB handle err : %s",
+                  member.userid, err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if len(member.userid) == 0 || member.IsRoleBitsetValid() == false {
+        log.Error("Cannot revoke role, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgStr := syncParam.UUIDtoString(member.UUID())
+    for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        var row dbUserOrgRole
+        err = getPtr(&row, membershipGet, member.userid, uint64(bit), orgStr)
+        if err == sql.ErrNoRows {
+            log.Info("Role %d is not granted to %s in org %s", bit,
+                     member.userid, orgStr)
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+        }
+        if err != nil {
+            return err
+        }
+    }
+    for bit := ENDUSER; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if member.roleType & bit == 0 {
+            continue
+        }
+        _, err = execPtr(membershipDelete, member.userid, uint64(bit), orgStr)
+        if err != nil {
+            log.Error("Failed to revoke role %d of %s in org %s err : %s",
+                      bit, member.userid, orgStr, err)
+            return err
+        }
+    }
+    return nil
+}
+
+//Function to get all memberships of user 'userid'.
+func (member *sqlUserOrgRole)getMembershipsByUser(sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string) (
+                                     []UserOrgRole, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list memberships, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbUserOrgRole{}
+    err = selectPtr(&rows, membershipGetonUser, userid)
+    if err != nil {
+        log.Trace("Failed to read memberships of %s, err : %s", userid, err)
+        return nil, err
+    }
+    return dbToMembershipRowsXlate(rows), nil
+}
+
+//Function to get all memberships in org 'orgUUID'.
+func (member *sqlUserOrgRole)getMembershipsByOrg(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID) (
+                                     []UserOrgRole, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list memberships, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbUserOrgRole{}
+    err = selectPtr(&rows, membershipGetonOrg, syncParam.UUIDtoString(orgUUID))
+    if err != nil {
+        log.Trace("Failed to read memberships of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    return dbToMembershipRowsXlate(rows), nil
+}
+
+//Function to get the effective roles of user 'userid' in org 'orgUUID'.
+//Roles granted on any of the ancestors of the org are inherited by the org.
+func (member *sqlUserOrgRole)getEffectiveRoles(sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string,
+                                     orgUUID syncParam.UUID) (RoleBit, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to get effective roles, invalid DB handle err : %s",
+                  err)
+        return 0, err
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err = orgrow.getOrgEntry(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot get effective roles of %s, org %s not found",
+                 userid, syncParam.UUIDtoString(orgUUID))
+        return 0, err
+    }
+    var effective RoleBit
+    for entry := &orgrow.Org; entry != nil; entry = entry.parent {
+        rows := []dbUserOrgRole{}
+        err = selectPtr(&rows, membershipGetonUserOrg, userid,
+                        syncParam.UUIDtoString(entry.uuid))
+        if err != nil {
+            log.Trace("Failed to read roles of %s in org %s, err : %s",
+                      userid, syncParam.UUIDtoString(entry.uuid), err)
+            return 0, err
+        }
+        for _, row := range(rows) {
+            effective |= RoleBit(row.RoleType)
+        }
+    }
+    return effective, nil
+}
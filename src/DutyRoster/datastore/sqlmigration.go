@@ -0,0 +1,240 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "DutyRoster/errorset"
+)
+
+//The db representation of schema migration table. Used only for SQLX
+// operations.
+type dbMigration struct {
+    Version uint64 `db:"version"`
+    Name string `db:"name"`
+    Checksum string `db:"checksum"`
+    AppliedTime time.Time `db:"appliedtime"`
+}
+
+//String representation of schema migration table and its elements.
+const (
+    MIGRATION_NAME_STR_LEN = 500
+    MIGRATION_CHECKSUM_STR_LEN = 64
+    MIGRATION_TABLE_NAME = "schema_migrations"
+    MIGRATION_FIELD_VERSION = "version"
+    MIGRATION_FIELD_NAME = "name"
+    MIGRATION_FIELD_CHECKSUM = "checksum"
+    MIGRATION_FIELD_APPLIED_TIME = "appliedtime"
+)
+
+// SQL statements to be used to operate on schema migration table. The
+// statements are valid for both postgreSQL and SQLite.
+var (
+    //Create a table schema_migrations.
+    migrationSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s bigint NOT NULL PRIMARY KEY,
+                     %s varchar(%d) NOT NULL,
+                     %s char(%d) NOT NULL,
+                     %s timestamp NOT NULL);`,
+                     MIGRATION_TABLE_NAME,
+                     MIGRATION_FIELD_VERSION,
+                     MIGRATION_FIELD_NAME, MIGRATION_NAME_STR_LEN,
+                     MIGRATION_FIELD_CHECKSUM, MIGRATION_CHECKSUM_STR_LEN,
+                     MIGRATION_FIELD_APPLIED_TIME)
+    //Record an applied migration.
+    migrationCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4)`,
+                            MIGRATION_TABLE_NAME,
+                            MIGRATION_FIELD_VERSION, MIGRATION_FIELD_NAME,
+                            MIGRATION_FIELD_CHECKSUM,
+                            MIGRATION_FIELD_APPLIED_TIME)
+    //Get all the applied migrations.
+    migrationGetAll = fmt.Sprintf("SELECT * FROM %s ORDER BY %s",
+                            MIGRATION_TABLE_NAME, MIGRATION_FIELD_VERSION)
+    //Delete the record of a reverted migration.
+    migrationDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            MIGRATION_TABLE_NAME, MIGRATION_FIELD_VERSION)
+)
+
+//Get the status of all the migration steps in 'migrations' and the steps that
+// are applied in DB but not known to application, ordered on version.
+func (sqlds *postgreSqlDataStore)getMigrationStatus(
+                        migrations []migration) ([]MigrationStatus, error) {
+    _, err := sqlds.DBConn.Exec(migrationSchema)
+    if err != nil {
+        sqlds.dblogger.Error("Failed to create schema migration table %s", err)
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_TABLE_CREATE_FAILED])
+    }
+    var rows []dbMigration
+    err = sqlds.DBConn.Select(&rows, migrationGetAll)
+    if err != nil {
+        sqlds.dblogger.Error("Failed to read schema migrations %s", err)
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_TRANSACTION_FAILED])
+    }
+    applied := make(map[uint64]*dbMigration)
+    for i := range(rows) {
+        applied[rows[i].Version] = &rows[i]
+    }
+    statusList := make([]MigrationStatus, 0, len(migrations) + len(rows))
+    for i := range(migrations) {
+        mig := &migrations[i]
+        status := MigrationStatus{version : mig.version, name : mig.name}
+        row, ok := applied[mig.version]
+        if ok {
+            status.applied = true
+            status.appliedTime = row.AppliedTime
+            status.modified = (row.Checksum != mig.checksum())
+            delete(applied, mig.version)
+        }
+        statusList = append(statusList, status)
+    }
+    //Remaining steps are applied by a newer version of application.
+    for _, row := range(rows) {
+        if _, ok := applied[row.Version]; !ok {
+            continue
+        }
+        statusList = append(statusList, MigrationStatus{
+                            version : row.Version, name : row.Name,
+                            applied : true, appliedTime : row.AppliedTime,
+                            modified : true})
+    }
+    return statusList, nil
+}
+
+//Returns error when any of the applied migration is modified.
+func (sqlds *postgreSqlDataStore)validateMigrationStatus(
+                        statusList []MigrationStatus) error {
+    for _, status := range(statusList) {
+        if status.modified {
+            sqlds.dblogger.Error(
+                "Schema migration %d '%s' is modified/unknown to application",
+                status.version, status.name)
+            return fmt.Errorf("%s",
+                errorset.ERROR_TYPES[errorset.DB_SCHEMA_CHECKSUM_MISMATCH])
+        }
+    }
+    return nil
+}
+
+//Run the statements of a migration step and update the migration table in a
+// single transaction.
+func (sqlds *postgreSqlDataStore)runMigrationStep(mig *migration,
+                                                 isUp bool) error {
+    stmts := mig.down
+    if isUp {
+        stmts = mig.up
+    }
+    Tx := sqlds.DBConn.MustBegin()
+    for _, stmt := range(stmts) {
+        _, err := Tx.Exec(stmt)
+        if err != nil {
+            Tx.Rollback()
+            sqlds.dblogger.Error("Failed to run schema migration %d '%s' %s",
+                                 mig.version, mig.name, err)
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_TRANSACTION_FAILED])
+        }
+    }
+    var err error
+    if isUp {
+        _, err = Tx.Exec(migrationCreate, mig.version, mig.name,
+                         mig.checksum(), time.Now().UTC())
+    } else {
+        _, err = Tx.Exec(migrationDelete, mig.version)
+    }
+    if err != nil {
+        Tx.Rollback()
+        sqlds.dblogger.Error("Failed to record schema migration %d %s",
+                             mig.version, err)
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_TRANSACTION_FAILED])
+    }
+    return Tx.Commit()
+}
+
+//Apply all the pending migration steps in the order of version.
+func (sqlds *postgreSqlDataStore)migrateUp(migrations []migration) error {
+    statusList, err := sqlds.getMigrationStatus(migrations)
+    if err != nil {
+        return err
+    }
+    err = sqlds.validateMigrationStatus(statusList)
+    if err != nil {
+        return err
+    }
+    for i := range(migrations) {
+        if statusList[i].applied {
+            continue
+        }
+        err = sqlds.runMigrationStep(&migrations[i], true)
+        if err != nil {
+            return err
+        }
+        sqlds.dblogger.Info("Applied schema migration %d '%s'",
+                            migrations[i].version, migrations[i].name)
+    }
+    return nil
+}
+
+//Revert the latest applied migration step.
+func (sqlds *postgreSqlDataStore)migrateDown(migrations []migration) error {
+    statusList, err := sqlds.getMigrationStatus(migrations)
+    if err != nil {
+        return err
+    }
+    err = sqlds.validateMigrationStatus(statusList)
+    if err != nil {
+        return err
+    }
+    for i := len(migrations) - 1; i >= 0; i-- {
+        if statusList[i].applied == false {
+            continue
+        }
+        err = sqlds.runMigrationStep(&migrations[i], false)
+        if err != nil {
+            return err
+        }
+        sqlds.dblogger.Info("Reverted schema migration %d '%s'",
+                            migrations[i].version, migrations[i].name)
+        return nil
+    }
+    sqlds.dblogger.Info("No schema migration to revert")
+    return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+}
+
+//Check the DB schema is at the latest migration step.
+func (sqlds *postgreSqlDataStore)checkSchemaVersion(
+                        migrations []migration) error {
+    statusList, err := sqlds.getMigrationStatus(migrations)
+    if err != nil {
+        return err
+    }
+    err = sqlds.validateMigrationStatus(statusList)
+    if err != nil {
+        return err
+    }
+    for _, status := range(statusList) {
+        if status.applied == false {
+            sqlds.dblogger.Error("Schema migration %d '%s' is not applied",
+                                 status.version, status.name)
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_SCHEMA_OUTDATED])
+        }
+    }
+    return nil
+}
@@ -0,0 +1,839 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of on-call rotation table. Used only for SQLX
+// operations. The members are kept in the on-call member table.
+type dbOnCallRotation struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    Name string `db:"name"`
+    Level uint64 `db:"level"`
+    Layer uint64 `db:"layer"`
+    HandoffTime time.Time `db:"handofftime"`
+    TurnLength int64 `db:"turnlength"` //Turn length in seconds.
+    Weekdays uint64 `db:"weekdays"`
+    StartOffset int64 `db:"startoffset"` //Offset in seconds.
+    Duration int64 `db:"duration"` //Duration in seconds.
+    CreateTime time.Time `db:"createtime"`
+}
+
+//The db representation of on-call member table, one row for each member of
+// a rotation in the order of turns.
+type dbOnCallMember struct {
+    RotationUuid string `db:"rotationuuid"`
+    Position uint64 `db:"position"`
+    Userid string `db:"userid"`
+}
+
+//The db representation of on-call override table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'OnCallOverride' structure.
+type dbOnCallOverride struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    Level uint64 `db:"level"`
+    Userid string `db:"userid"`
+    StartTime time.Time `db:"starttime"`
+    EndTime time.Time `db:"endtime"`
+    CreateTime time.Time `db:"createtime"`
+}
+
+//The db representation of escalation policy table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'EscalationPolicy' structure.
+type dbEscalationPolicy struct {
+    OrgUuid string `db:"orguuid"`
+    Manager sql.NullString `db:"manager"`
+    StepTimeout int64 `db:"steptimeout"` //Timeout in seconds.
+}
+
+// SQL representation for on-call rotation.
+type sqlOnCallRotation struct {
+    OnCallRotation
+}
+
+// SQL representation for on-call override.
+type sqlOnCallOverride struct {
+    OnCallOverride
+}
+
+// SQL representation for escalation policy.
+type sqlEscalationPolicy struct {
+    EscalationPolicy
+}
+
+//String representation of on-call tables and its elements.
+const (
+    ONCALL_ROTATION_TABLE_NAME = "oncallrotations"
+    ONCALL_ROTATION_FIELD_UUID = "uuid"
+    ONCALL_ROTATION_FIELD_ORGUUID = "orguuid"
+    ONCALL_ROTATION_FIELD_NAME = "name"
+    ONCALL_ROTATION_FIELD_LEVEL = "level"
+    ONCALL_ROTATION_FIELD_LAYER = "layer"
+    ONCALL_ROTATION_FIELD_HANDOFF_TIME = "handofftime"
+    ONCALL_ROTATION_FIELD_TURN_LENGTH = "turnlength"
+    ONCALL_ROTATION_FIELD_WEEKDAYS = "weekdays"
+    ONCALL_ROTATION_FIELD_START_OFFSET = "startoffset"
+    ONCALL_ROTATION_FIELD_DURATION = "duration"
+    ONCALL_ROTATION_FIELD_CREATE_TIME = "createtime"
+
+    ONCALL_MEMBER_TABLE_NAME = "oncallmembers"
+    ONCALL_MEMBER_FIELD_ROTATIONUUID = "rotationuuid"
+    ONCALL_MEMBER_FIELD_POSITION = "position"
+    ONCALL_MEMBER_FIELD_USERID = "userid"
+
+    ONCALL_OVERRIDE_TABLE_NAME = "oncalloverrides"
+    ONCALL_OVERRIDE_FIELD_UUID = "uuid"
+    ONCALL_OVERRIDE_FIELD_ORGUUID = "orguuid"
+    ONCALL_OVERRIDE_FIELD_LEVEL = "level"
+    ONCALL_OVERRIDE_FIELD_USERID = "userid"
+    ONCALL_OVERRIDE_FIELD_START_TIME = "starttime"
+    ONCALL_OVERRIDE_FIELD_END_TIME = "endtime"
+    ONCALL_OVERRIDE_FIELD_CREATE_TIME = "createtime"
+
+    ESCALATION_TABLE_NAME = "escalationpolicies"
+    ESCALATION_FIELD_ORGUUID = "orguuid"
+    ESCALATION_FIELD_MANAGER = "manager"
+    ESCALATION_FIELD_STEP_TIMEOUT = "steptimeout"
+)
+
+// SQL statements to be used to operate on on-call tables.
+var (
+    //Create a table oncallrotations, name of rotation is unique in an
+    // org/unit.
+    onCallRotationSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     ONCALL_ROTATION_TABLE_NAME,
+                     ONCALL_ROTATION_FIELD_UUID,
+                     ONCALL_ROTATION_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ONCALL_ROTATION_FIELD_NAME, ONCALL_NAME_STR_LEN,
+                     ONCALL_ROTATION_FIELD_LEVEL, ONCALL_ROTATION_FIELD_LEVEL,
+                     ONCALL_ROTATION_FIELD_LAYER, ONCALL_ROTATION_FIELD_LAYER,
+                     ONCALL_ROTATION_FIELD_HANDOFF_TIME,
+                     ONCALL_ROTATION_FIELD_TURN_LENGTH,
+                     ONCALL_ROTATION_FIELD_TURN_LENGTH,
+                     ONCALL_ROTATION_FIELD_WEEKDAYS,
+                     ONCALL_ROTATION_FIELD_WEEKDAYS,
+                     ONCALL_ROTATION_FIELD_START_OFFSET,
+                     ONCALL_ROTATION_FIELD_START_OFFSET,
+                     ONCALL_ROTATION_FIELD_DURATION,
+                     ONCALL_ROTATION_FIELD_DURATION,
+                     ONCALL_ROTATION_FIELD_CREATE_TIME,
+                     ONCALL_ROTATION_FIELD_ORGUUID, ONCALL_ROTATION_FIELD_NAME)
+    //Create a table oncallmembers, members are removed from the rotations
+    // with the user account.
+    onCallMemberSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     PRIMARY KEY (%s, %s),
+                     UNIQUE (%s, %s));`,
+                     ONCALL_MEMBER_TABLE_NAME,
+                     ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                     ONCALL_ROTATION_TABLE_NAME, ONCALL_ROTATION_FIELD_UUID,
+                     ONCALL_MEMBER_FIELD_POSITION, ONCALL_MEMBER_FIELD_POSITION,
+                     ONCALL_MEMBER_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                     ONCALL_MEMBER_FIELD_POSITION,
+                     ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                     ONCALL_MEMBER_FIELD_USERID)
+    //Create a table oncalloverrides.
+    onCallOverrideSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     CHECK(%s > %s));`,
+                     ONCALL_OVERRIDE_TABLE_NAME,
+                     ONCALL_OVERRIDE_FIELD_UUID,
+                     ONCALL_OVERRIDE_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ONCALL_OVERRIDE_FIELD_LEVEL, ONCALL_OVERRIDE_FIELD_LEVEL,
+                     ONCALL_OVERRIDE_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ONCALL_OVERRIDE_FIELD_START_TIME,
+                     ONCALL_OVERRIDE_FIELD_END_TIME,
+                     ONCALL_OVERRIDE_FIELD_CREATE_TIME,
+                     ONCALL_OVERRIDE_FIELD_END_TIME,
+                     ONCALL_OVERRIDE_FIELD_START_TIME)
+    //Index to find the overrides of an org/unit in a time range.
+    onCallOverrideOrgIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s, %s)`,
+                            ONCALL_OVERRIDE_TABLE_NAME,
+                            ONCALL_OVERRIDE_FIELD_ORGUUID,
+                            ONCALL_OVERRIDE_TABLE_NAME,
+                            ONCALL_OVERRIDE_FIELD_ORGUUID,
+                            ONCALL_OVERRIDE_FIELD_START_TIME)
+    //Create a table escalationpolicies, one row for an org/unit.
+    escalationSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s bigint NOT NULL CHECK(%s >= 0));`,
+                     ESCALATION_TABLE_NAME,
+                     ESCALATION_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ESCALATION_FIELD_MANAGER, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ESCALATION_FIELD_STEP_TIMEOUT,
+                     ESCALATION_FIELD_STEP_TIMEOUT)
+    //Create an on-call rotation entry.
+    onCallRotationCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+                            $11)`,
+                            ONCALL_ROTATION_TABLE_NAME,
+                            ONCALL_ROTATION_FIELD_UUID,
+                            ONCALL_ROTATION_FIELD_ORGUUID,
+                            ONCALL_ROTATION_FIELD_NAME,
+                            ONCALL_ROTATION_FIELD_LEVEL,
+                            ONCALL_ROTATION_FIELD_LAYER,
+                            ONCALL_ROTATION_FIELD_HANDOFF_TIME,
+                            ONCALL_ROTATION_FIELD_TURN_LENGTH,
+                            ONCALL_ROTATION_FIELD_WEEKDAYS,
+                            ONCALL_ROTATION_FIELD_START_OFFSET,
+                            ONCALL_ROTATION_FIELD_DURATION,
+                            ONCALL_ROTATION_FIELD_CREATE_TIME)
+    //Get the on-call rotation with specific uuid
+    onCallRotationGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            ONCALL_ROTATION_TABLE_NAME,
+                            ONCALL_ROTATION_FIELD_UUID)
+    //Get the on-call rotation with name in an org/unit.
+    onCallRotationGetonOrgName = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s=($2)`,
+                            ONCALL_ROTATION_TABLE_NAME,
+                            ONCALL_ROTATION_FIELD_ORGUUID,
+                            ONCALL_ROTATION_FIELD_NAME)
+    //Get all the on-call rotations of an org/unit.
+    onCallRotationGetonOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s, %s DESC, %s`,
+                            ONCALL_ROTATION_TABLE_NAME,
+                            ONCALL_ROTATION_FIELD_ORGUUID,
+                            ONCALL_ROTATION_FIELD_LEVEL,
+                            ONCALL_ROTATION_FIELD_LAYER,
+                            ONCALL_ROTATION_FIELD_NAME)
+    //Delete the on-call rotation with specific uuid
+    onCallRotationDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)`,
+                            ONCALL_ROTATION_TABLE_NAME,
+                            ONCALL_ROTATION_FIELD_UUID)
+    //Add a member to the on-call rotation.
+    onCallMemberCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s)
+                            VALUES ($1, $2, $3)`,
+                            ONCALL_MEMBER_TABLE_NAME,
+                            ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                            ONCALL_MEMBER_FIELD_POSITION,
+                            ONCALL_MEMBER_FIELD_USERID)
+    //Get the members of a rotation in the order of turns.
+    onCallMemberGetonRotation = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            ONCALL_MEMBER_TABLE_NAME,
+                            ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                            ONCALL_MEMBER_FIELD_POSITION)
+    //Get the members of all the rotations of an org/unit.
+    onCallMemberGetonOrg = fmt.Sprintf(`SELECT m.* FROM %s m
+                            INNER JOIN %s r ON m.%s = r.%s
+                            WHERE r.%s=($1) ORDER BY m.%s, m.%s`,
+                            ONCALL_MEMBER_TABLE_NAME,
+                            ONCALL_ROTATION_TABLE_NAME,
+                            ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                            ONCALL_ROTATION_FIELD_UUID,
+                            ONCALL_ROTATION_FIELD_ORGUUID,
+                            ONCALL_MEMBER_FIELD_ROTATIONUUID,
+                            ONCALL_MEMBER_FIELD_POSITION)
+    //Create an on-call override entry.
+    onCallOverrideCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                            ONCALL_OVERRIDE_TABLE_NAME,
+                            ONCALL_OVERRIDE_FIELD_UUID,
+                            ONCALL_OVERRIDE_FIELD_ORGUUID,
+                            ONCALL_OVERRIDE_FIELD_LEVEL,
+                            ONCALL_OVERRIDE_FIELD_USERID,
+                            ONCALL_OVERRIDE_FIELD_START_TIME,
+                            ONCALL_OVERRIDE_FIELD_END_TIME,
+                            ONCALL_OVERRIDE_FIELD_CREATE_TIME)
+    //Get the on-call override with specific uuid
+    onCallOverrideGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            ONCALL_OVERRIDE_TABLE_NAME,
+                            ONCALL_OVERRIDE_FIELD_UUID)
+    //Get the on-call overrides of an org/unit that overlaps the range.
+    onCallOverrideGetonOrgRange = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s > ($2) AND %s < ($3)
+                            ORDER BY %s, %s`,
+                            ONCALL_OVERRIDE_TABLE_NAME,
+                            ONCALL_OVERRIDE_FIELD_ORGUUID,
+                            ONCALL_OVERRIDE_FIELD_END_TIME,
+                            ONCALL_OVERRIDE_FIELD_START_TIME,
+                            ONCALL_OVERRIDE_FIELD_START_TIME,
+                            ONCALL_OVERRIDE_FIELD_CREATE_TIME)
+    //Delete the on-call override with specific uuid
+    onCallOverrideDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)`,
+                            ONCALL_OVERRIDE_TABLE_NAME,
+                            ONCALL_OVERRIDE_FIELD_UUID)
+    //Create or replace the escalation policy of an org/unit.
+    escalationUpsert = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s)
+                            VALUES ($1, $2, $3) ON CONFLICT (%s)
+                            DO UPDATE SET %s=excluded.%s, %s=excluded.%s`,
+                            ESCALATION_TABLE_NAME,
+                            ESCALATION_FIELD_ORGUUID,
+                            ESCALATION_FIELD_MANAGER,
+                            ESCALATION_FIELD_STEP_TIMEOUT,
+                            ESCALATION_FIELD_ORGUUID,
+                            ESCALATION_FIELD_MANAGER,
+                            ESCALATION_FIELD_MANAGER,
+                            ESCALATION_FIELD_STEP_TIMEOUT,
+                            ESCALATION_FIELD_STEP_TIMEOUT)
+    //Get the escalation policy of an org/unit.
+    escalationGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            ESCALATION_TABLE_NAME, ESCALATION_FIELD_ORGUUID)
+    //Delete the escalation policy of an org/unit.
+    escalationDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)`,
+                            ESCALATION_TABLE_NAME, ESCALATION_FIELD_ORGUUID)
+)
+
+//Translate DB on-call rotation row to rotation structure, members are not
+// part of the row.
+func (rot *sqlOnCallRotation)dbToOnCallRotationRowXlate(
+                                     dbrow *dbOnCallRotation) {
+    rot.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    rot.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    rot.name = dbrow.Name
+    rot.level = OnCallLevelBit(dbrow.Level)
+    rot.layer = dbrow.Layer
+    rot.handoffTime = dbrow.HandoffTime
+    rot.turnLength = time.Duration(dbrow.TurnLength) * time.Second
+    rot.weekdays = dbrow.Weekdays
+    rot.startOffset = time.Duration(dbrow.StartOffset) * time.Second
+    rot.duration = time.Duration(dbrow.Duration) * time.Second
+    rot.createTime = dbrow.CreateTime
+    rot.members = []string{}
+}
+
+//Translate DB on-call override row to override structure.
+func (ovr *sqlOnCallOverride)dbToOnCallOverrideRowXlate(
+                                     dbrow *dbOnCallOverride) {
+    ovr.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    ovr.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    ovr.level = OnCallLevelBit(dbrow.Level)
+    ovr.userid = dbrow.Userid
+    ovr.startTime = dbrow.StartTime
+    ovr.endTime = dbrow.EndTime
+    ovr.createTime = dbrow.CreateTime
+}
+
+//Return DB_RECORD_RELATION_ERROR when user 'userid' is not a member of the
+// org/unit or its ancestors, ie: cannot be on call for the org/unit.
+func isOnCallUserValid(sqlds *postgreSqlDataStore, handle interface{},
+                       userid string, orgUUID syncParam.UUID) error {
+    member := new(sqlUserOrgRole)
+    roles, err := member.getEffectiveRoles(sqlds, handle, userid, orgUUID)
+    if err != nil {
+        return err
+    }
+    if roles == 0 {
+        logging.GetAppLoggerObj().Info(
+                    "User %s is not a member of org %s, cannot be on call",
+                    userid, syncParam.UUIDtoString(orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    return nil
+}
+
+//Create an on-call rotation with its members, uuid and createTime are self
+// populated. The name must be unique in the org/unit, and the members must be
+// members of the org/unit.
+func (rot *sqlOnCallRotation)createOnCallRotationEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create rotation, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if rot.IsOnCallRotationValid() == false {
+        log.Error("Cannot create rotation, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = rot.orgUUID
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Cannot create rotation %s, org %s not present", rot.name,
+                 syncParam.UUIDtoString(rot.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    var row dbOnCallRotation
+    err = getPtr(&row, onCallRotationGetonOrgName,
+                 syncParam.UUIDtoString(rot.orgUUID), rot.name)
+    if err == nil {
+        log.Info("Rotation %s already present in org %s", rot.name,
+                 syncParam.UUIDtoString(rot.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    if err != sql.ErrNoRows {
+        return err
+    }
+    for _, userid := range(rot.members) {
+        err = isOnCallUserValid(sqlds, handle, userid, rot.orgUUID)
+        if err != nil {
+            return err
+        }
+    }
+    rot.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create rotation")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    rot.handoffTime = rot.handoffTime.UTC().Truncate(time.Second)
+    rot.createTime = time.Now()
+    uuidStr := syncParam.UUIDtoString(rot.uuid)
+    _, err = execPtr(onCallRotationCreate, uuidStr,
+                     syncParam.UUIDtoString(rot.orgUUID), rot.name,
+                     uint64(rot.level), rot.layer, rot.handoffTime,
+                     int64(rot.turnLength / time.Second), rot.weekdays,
+                     int64(rot.startOffset / time.Second),
+                     int64(rot.duration / time.Second), rot.createTime.UTC())
+    if err != nil {
+        log.Error("Failed to create rotation %s err : %s", rot.name, err)
+        return err
+    }
+    for i, userid := range(rot.members) {
+        _, err = execPtr(onCallMemberCreate, uuidStr, uint64(i), userid)
+        if err != nil {
+            log.Error("Failed to add %s to rotation %s err : %s", userid,
+                      rot.name, err)
+            return err
+        }
+    }
+    return nil
+}
+
+//Function to get the on-call rotation with specific UUID and its members.
+func (rot *sqlOnCallRotation)getOnCallRotationByUUID(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get rotation, invalid DB handle err : %s", err)
+        return err
+    }
+    selectPtr, _ := sqlds.getDBSelectFunction(handle)
+    var row dbOnCallRotation
+    err = getPtr(&row, onCallRotationGetonUUID,
+                 syncParam.UUIDtoString(rot.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read rotation %s, err : %s",
+                  syncParam.UUIDtoString(rot.uuid), err)
+        return err
+    }
+    rot.dbToOnCallRotationRowXlate(&row)
+    members := []dbOnCallMember{}
+    err = selectPtr(&members, onCallMemberGetonRotation, row.Uuid)
+    if err != nil {
+        log.Trace("Failed to read members of rotation %s, err : %s",
+                  row.Uuid, err)
+        return err
+    }
+    for _, member := range(members) {
+        rot.members = append(rot.members, member.Userid)
+    }
+    return nil
+}
+
+//Function to get all the on-call rotations of org/unit 'orgUUID' with their
+// members.
+func (rot *sqlOnCallRotation)getOnCallRotationsByOrg(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID) (
+                                     []OnCallRotation, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list rotations, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbOnCallRotation{}
+    err = selectPtr(&rows, onCallRotationGetonOrg,
+                    syncParam.UUIDtoString(orgUUID))
+    if err != nil {
+        log.Trace("Failed to read rotations of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    members := []dbOnCallMember{}
+    err = selectPtr(&members, onCallMemberGetonOrg,
+                    syncParam.UUIDtoString(orgUUID))
+    if err != nil {
+        log.Trace("Failed to read rotation members of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    memberMap := make(map[string][]string)
+    for _, member := range(members) {
+        memberMap[member.RotationUuid] = append(
+                        memberMap[member.RotationUuid], member.Userid)
+    }
+    rotations := make([]OnCallRotation, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlOnCallRotation)
+        entry.dbToOnCallRotationRowXlate(&row)
+        entry.members = append(entry.members, memberMap[row.Uuid]...)
+        rotations = append(rotations, entry.OnCallRotation)
+    }
+    return rotations, nil
+}
+
+//Function to delete the on-call rotation, members are deleted with it.
+func (rot *sqlOnCallRotation)deleteOnCallRotationEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete rotation, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    err = rot.getOnCallRotationByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(onCallRotationDelete, syncParam.UUIDtoString(rot.uuid))
+    if err != nil {
+        log.Info("Failed to delete rotation %s, err : %s",
+                 syncParam.UUIDtoString(rot.uuid), err)
+        return err
+    }
+    return nil
+}
+
+//Create an on-call override, uuid and createTime are self populated. The user
+// must be a member of the org/unit.
+func (ovr *sqlOnCallOverride)createOnCallOverrideEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create override, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    if ovr.IsOnCallOverrideValid() == false {
+        log.Error("Cannot create override, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err = isOnCallUserValid(sqlds, handle, ovr.userid, ovr.orgUUID)
+    if err != nil {
+        return err
+    }
+    ovr.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create override")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    ovr.createTime = time.Now()
+    _, err = execPtr(onCallOverrideCreate, syncParam.UUIDtoString(ovr.uuid),
+                     syncParam.UUIDtoString(ovr.orgUUID), uint64(ovr.level),
+                     ovr.userid, ovr.startTime.UTC(), ovr.endTime.UTC(),
+                     ovr.createTime.UTC())
+    if err != nil {
+        log.Error("Failed to create override for %s err : %s", ovr.userid,
+                  err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the on-call override with specific UUID.
+func (ovr *sqlOnCallOverride)getOnCallOverrideByUUID(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get override, invalid DB handle err : %s", err)
+        return err
+    }
+    var row dbOnCallOverride
+    err = getPtr(&row, onCallOverrideGetonUUID,
+                 syncParam.UUIDtoString(ovr.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read override %s, err : %s",
+                  syncParam.UUIDtoString(ovr.uuid), err)
+        return err
+    }
+    ovr.dbToOnCallOverrideRowXlate(&row)
+    return nil
+}
+
+//Function to get the on-call overrides of org/unit 'orgUUID' that overlaps
+// the range [from, to).
+func (ovr *sqlOnCallOverride)getOnCallOverridesByOrgRange(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID, from time.Time,
+                                     to time.Time) ([]OnCallOverride, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list overrides, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbOnCallOverride{}
+    err = selectPtr(&rows, onCallOverrideGetonOrgRange,
+                    syncParam.UUIDtoString(orgUUID), from.UTC(), to.UTC())
+    if err != nil {
+        log.Trace("Failed to read overrides of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    overrides := make([]OnCallOverride, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlOnCallOverride)
+        entry.dbToOnCallOverrideRowXlate(&row)
+        overrides = append(overrides, entry.OnCallOverride)
+    }
+    return overrides, nil
+}
+
+//Function to delete the on-call override.
+func (ovr *sqlOnCallOverride)deleteOnCallOverrideEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete override, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    err = ovr.getOnCallOverrideByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(onCallOverrideDelete, syncParam.UUIDtoString(ovr.uuid))
+    if err != nil {
+        log.Info("Failed to delete override %s, err : %s",
+                 syncParam.UUIDtoString(ovr.uuid), err)
+        return err
+    }
+    return nil
+}
+
+//Function to create or replace the escalation policy of org/unit. The
+// manager must be a member of the org/unit.
+func (policy *sqlEscalationPolicy)setEscalationPolicyEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to set escalation, invalid DB handle err : %s", err)
+        return err
+    }
+    if policy.IsEscalationPolicyValid() == false {
+        log.Error("Cannot set escalation policy, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    var manager sql.NullString
+    if len(policy.manager) != 0 {
+        err = isOnCallUserValid(sqlds, handle, policy.manager, policy.orgUUID)
+        if err != nil {
+            return err
+        }
+        manager.Scan(policy.manager)
+    } else {
+        orgrow := new(sqlorg)
+        orgrow.uuid = policy.orgUUID
+        err = orgrow.getOrgEntryByUUID(sqlds, handle)
+        if err != nil {
+            return err
+        }
+    }
+    _, err = execPtr(escalationUpsert, syncParam.UUIDtoString(policy.orgUUID),
+                     manager, int64(policy.stepTimeout / time.Second))
+    if err != nil {
+        log.Error("Failed to set escalation policy of org %s, err : %s",
+                  syncParam.UUIDtoString(policy.orgUUID), err)
+        return err
+    }
+    return nil
+}
+
+//Read the escalation policy of org/unit, returns false when the org/unit has
+// no policy of its own.
+func (policy *sqlEscalationPolicy)readEscalationPolicy(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) (bool, error) {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get escalation, invalid DB handle err : %s", err)
+        return false, err
+    }
+    var row dbEscalationPolicy
+    err = getPtr(&row, escalationGet, syncParam.UUIDtoString(policy.orgUUID))
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        log.Trace("Failed to read escalation policy of org %s, err : %s",
+                  syncParam.UUIDtoString(policy.orgUUID), err)
+        return false, err
+    }
+    policy.manager = ""
+    if row.Manager.Valid {
+        policy.manager = row.Manager.String
+    }
+    policy.stepTimeout = time.Duration(row.StepTimeout) * time.Second
+    return true, nil
+}
+
+//Function to get the escalation policy of org/unit, DB_RECORD_NOT_FOUND when
+// the org/unit has no policy of its own.
+func (policy *sqlEscalationPolicy)getEscalationPolicyEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    found, err := policy.readEscalationPolicy(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if !found {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Function to delete the escalation policy of org/unit, the org/unit falls
+// back to the policy of parent.
+func (policy *sqlEscalationPolicy)deleteEscalationPolicyEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete escalation, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    res, err := execPtr(escalationDelete,
+                        syncParam.UUIDtoString(policy.orgUUID))
+    if err != nil {
+        log.Info("Failed to delete escalation policy of org %s, err : %s",
+                 syncParam.UUIDtoString(policy.orgUUID), err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Resolve the users on call for org/unit 'orgUUID' at the instant 'at'. Each
+// level is resolved in the org/unit first, and in the parent chain when the
+// org/unit does not cover the level at that instant.
+func whoIsOnCall(sqlds *postgreSqlDataStore, handle interface{},
+                 orgUUID syncParam.UUID, at time.Time) (*OnCall, error) {
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err := orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    oc := &OnCall{orgUUID : orgUUID, at : at.UTC()}
+    rot := new(sqlOnCallRotation)
+    ovr := new(sqlOnCallOverride)
+    for entry := &orgrow.Org; entry != nil && !oc.isComplete();
+        entry = entry.parent {
+        rotations, err := rot.getOnCallRotationsByOrg(sqlds, handle,
+                                                      entry.uuid)
+        if err != nil {
+            return nil, err
+        }
+        //Overrides that overlap the instant, the exact match is done on
+        // resolving the level.
+        overrides, err := ovr.getOnCallOverridesByOrgRange(sqlds, handle,
+                                    entry.uuid, oc.at, oc.at.Add(time.Second))
+        if err != nil {
+            return nil, err
+        }
+        policy := new(sqlEscalationPolicy)
+        policy.orgUUID = entry.uuid
+        found, err := policy.readEscalationPolicy(sqlds, handle)
+        if err != nil {
+            return nil, err
+        }
+        if found {
+            oc.resolveInOrg(entry, rotations, overrides,
+                            &policy.EscalationPolicy)
+        } else {
+            oc.resolveInOrg(entry, rotations, overrides, nil)
+        }
+    }
+    return oc, nil
+}
@@ -22,6 +22,7 @@ import (
     "DutyRoster/errorset"
     "DutyRoster/logging"
     "DutyRoster/syncParam"
+    "DutyRoster/timezone"
 )
 
 //The db representation of org table. Used only for SQLX operations.
@@ -42,7 +43,7 @@ type dbOrg struct {
 
 // SQL representation for Org.
 type sqlorg struct {
-    org
+    Org
 }
 
 //String representation of Org table and its elements.
@@ -57,13 +58,15 @@ const (
     ORG_FIELD_STATUS = "status"
     ORG_FIELD_START_TIME = "starttime"
     ORG_FIELD_VALIDITY = "validity"
+    //Time zones are kept out of org table, the orgs without a zone are in
+    // UTC.
+    ORG_TIME_ZONE_TABLE_NAME = "orgtimezones"
+    ORG_TIME_ZONE_FIELD_ORGUUID = "orguuid"
+    ORG_TIME_ZONE_FIELD_TIME_ZONE = "timezone"
 )
 
 // SQL statements to be used to operate on org table.
 var (
-    //Check if table is exist in the DB
-    orgtableExist = fmt.Sprintf("SELECT 1 FROM %s LIMIT 1;",
-                            ORG_TABLE_NAME)
     //Create a table org
     orgschema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
                     (%s UUID NOT NULL PRIMARY KEY,
@@ -91,6 +94,28 @@ var (
                             ORG_FIELD_UUID, ORG_FIELD_NAME, ORG_FIELD_ADDRESS,
                             ORG_FIELD_PARENT,ORG_FIELD_STATUS,
                             ORG_FIELD_START_TIME, ORG_FIELD_VALIDITY)
+    //Create a table orgtimezones, zone of an org is removed with the org.
+    orgTimeZoneSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL);`,
+                     ORG_TIME_ZONE_TABLE_NAME,
+                     ORG_TIME_ZONE_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ORG_TIME_ZONE_FIELD_TIME_ZONE, timezone.TIME_ZONE_STR_LEN)
+    //Create or replace the time zone of an org/unit.
+    orgSetTimeZone = fmt.Sprintf(`INSERT INTO %s (%s, %s) VALUES ($1, $2)
+                            ON CONFLICT (%s) DO UPDATE SET %s=excluded.%s`,
+                            ORG_TIME_ZONE_TABLE_NAME,
+                            ORG_TIME_ZONE_FIELD_ORGUUID,
+                            ORG_TIME_ZONE_FIELD_TIME_ZONE,
+                            ORG_TIME_ZONE_FIELD_ORGUUID,
+                            ORG_TIME_ZONE_FIELD_TIME_ZONE,
+                            ORG_TIME_ZONE_FIELD_TIME_ZONE)
+    //Get the time zone of org/unit with specific uuid.
+    orgGetTimeZone = fmt.Sprintf(`SELECT %s FROM %s WHERE %s=($1)`,
+                              ORG_TIME_ZONE_FIELD_TIME_ZONE,
+                              ORG_TIME_ZONE_TABLE_NAME,
+                              ORG_TIME_ZONE_FIELD_ORGUUID)
     //Get number of org/unit with name. This should be either 1, 0 as name is
     //unique
     orgGetNameCnt = fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s=($1)`,
@@ -99,9 +124,11 @@ var (
     orgGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
                               ORG_TABLE_NAME, ORG_FIELD_UUID)
     //Get the org/unit using name, addr and parent UUID
+    //NULL address/parent only matches with a NULL input, so a top level org
+    //doesnt match with a unit of same name.
     orgGetonNameAddrParent = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1) AND
-                                (%s=($2) OR %s IS NULL) AND
-                                (%s=($3) OR %s IS NULL)`,
+                                (%s=($2) OR (%s IS NULL AND ($2) IS NULL)) AND
+                                (%s=($3) OR (%s IS NULL AND ($3) IS NULL))`,
                                 ORG_TABLE_NAME,
                                 ORG_FIELD_NAME,
                                 ORG_FIELD_ADDRESS, ORG_FIELD_ADDRESS,
@@ -120,29 +147,6 @@ var (
                             ORG_TABLE_NAME, ORG_FIELD_STATUS,
                             ORG_FIELD_VALIDITY, ORG_FIELD_UUID))
 
-func (org *sqlorg)createOrgTable(sqlds *postgreSqlDataStore,
-                                     handle interface{}) error{
-    log := logging.GetAppLoggerObj()
-    execPtr, err := sqlds.getDBExecFunction(handle)
-    if err != nil {
-        log.Error("Failed to create org table, invalid DB handle err : %s",
-                    err)
-        return err
-    }
-    _, err = execPtr(orgtableExist)
-    if err == nil {
-        log.Info("Org table is already exist in the system. ")
-        return nil
-    }
-    _, err = execPtr(orgschema)
-    if err != nil {
-        log.Error("Failed to create org table %s", err)
-        return fmt.Errorf("%s",
-                        errorset.ERROR_TYPES[errorset.DB_TABLE_CREATE_FAILED])
-    }
-    return nil
-}
-
 //Create a new org/unit entry in org table using the sqlorg structure
 // uuid, startTime will be self populated.
 func (org *sqlorg)createOrgEntry(sqlds *postgreSqlDataStore,
@@ -161,16 +165,22 @@ func (org *sqlorg)createOrgEntry(sqlds *postgreSqlDataStore,
        len(org.name) == 0 {
            log.Error(
               "Failed to create org entry as invalid length name/address")
-           fmt.Errorf("%s",
+           return fmt.Errorf("%s",
                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
     }
     if org.IsOrgStatusValid() == false {
-        log.Trace("Organization %s doesnt have a proper status")
+        log.Trace("Organization %s doesnt have a proper status", org.name)
         return fmt.Errorf("%s",
                           errorset.ERROR_TYPES[errorset.INVALID_PARAM])
     }
+    if !org.isTimeZoneValid() {
+        log.Trace("Organization %s doesnt have a known time zone %s",
+                  org.name, org.timeZone)
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TIME_ZONE_INVALID])
+    }
     //Populate UUID for all the ancestors for the record
-    err = org.fillUUIDforOrgParents(sqlds, handle, &org.org)
+    err = org.fillUUIDforOrgParents(sqlds, handle, &org.Org)
     if err != nil{
         log.Info("Cannot create a org entry as failed to find ancestors")
         return err
@@ -180,7 +190,8 @@ func (org *sqlorg)createOrgEntry(sqlds *postgreSqlDataStore,
     if res == true {
         log.Trace("Organization %s already present in system, cannot create",
             org.name)
-        return nil
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
     }
     if err != nil {
         //Cannot create the org entry as error while finding the entry
@@ -193,6 +204,15 @@ func (org *sqlorg)createOrgEntry(sqlds *postgreSqlDataStore,
         return fmt.Errorf("%s",
                           errorset.ERROR_TYPES[errorset.TRY_AGAIN])
     }
+    if len(org.timeZone) == 0 {
+        org.timeZone = timezone.DEFAULT_TIME_ZONE
+        if org.parent != nil {
+            org.timeZone, err = getOrgTimeZone(sqlds, handle, org.parent.uuid)
+            if err != nil {
+                return err
+            }
+        }
+    }
     org.startTime = time.Now()
     dbrow := org.orgToDBRowXlate()
     parent_uuid, valok := dbrow.Parent.Value()
@@ -206,14 +226,18 @@ func (org *sqlorg)createOrgEntry(sqlds *postgreSqlDataStore,
         log.Trace("Failed to create a org record for %s : %s", dbrow.Name, err)
          return err
     }
-    return nil
+    _, err = execPtr(orgSetTimeZone, dbrow.Uuid, org.timeZone)
+    if err != nil {
+        log.Trace("Failed to set time zone of org %s : %s", dbrow.Name, err)
+    }
+    return err
 }
 
 // Function to find and fill the UUID for specific Org entry. An org entry
 // may have only provided with name , address and parent.Find and fill the UUID
 // for specific org entry and all its parents.
 func (org *sqlorg)fillUUIDforOrgParents(sqlds *postgreSqlDataStore,
-                                     handle interface{}, orgentry *org) error{
+                                     handle interface{}, orgentry *Org) error{
     log := logging.GetAppLoggerObj()
     selectPtr, err := sqlds.getDBSelectFunction(handle)
     if err != nil {
@@ -223,7 +247,10 @@ func (org *sqlorg)fillUUIDforOrgParents(sqlds *postgreSqlDataStore,
     }
     if orgentry.parent != nil {
         //Need to start the processing from the root parent.
-        org.fillUUIDforOrgParents(sqlds, handle, orgentry.parent)
+        err = org.fillUUIDforOrgParents(sqlds, handle, orgentry.parent)
+        if err != nil {
+            return err
+        }
     }
     if !syncParam.IsUUIDEmpty(orgentry.uuid) {
         //UUID is present and no need to calculate.
@@ -232,7 +259,7 @@ func (org *sqlorg)fillUUIDforOrgParents(sqlds *postgreSqlDataStore,
     //Find UUID using name, address and parent UUID.
     var orgwrapper *sqlorg
     orgwrapper = new(sqlorg)
-    orgwrapper.org = *orgentry
+    orgwrapper.Org = *orgentry
     dbrow := orgwrapper.orgToDBRowXlate()
     rows := []dbOrg{}
     err = selectPtr(&rows, orgGetonNameAddrParent, dbrow.Name, dbrow.Address,
@@ -269,7 +296,7 @@ func (org *sqlorg)isOrgEntryPresentInTable(sqlds *postgreSqlDataStore,
     }
     if org.parent != nil {
         parentorg := new(sqlorg)
-        parentorg.org = *org.parent
+        parentorg.Org = *org.parent
         res, _ := parentorg.isOrgEntryPresentInTable(sqlds, handle)
         if res == false {
             //Cannot find the parent of the org record, return error
@@ -282,12 +309,15 @@ func (org *sqlorg)isOrgEntryPresentInTable(sqlds *postgreSqlDataStore,
         log.Trace("Empty UUID for the org record : %s-%s",
                         org.name, org.address)
         err = org.getOrgEntryByNameAddrParent(sqlds, handle)
-        if err != nil && err == sql.ErrNoRows {
+        if err == nil {
+            //Record is present and the uuid is populated from DB.
+            return true, nil
+        }
+        if err == sql.ErrNoRows {
             //No rows present in the DB, no need to return any error code
             return false, nil
         }
-        return false, fmt.Errorf("%s",
-                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+        return false, err
     }
     var dbrow dbOrg
     err = getPtr(&dbrow, orgGetonUUID, syncParam.UUIDtoString(org.uuid))
@@ -351,30 +381,34 @@ func (org *sqlorg)dbToOrgRowXlate(sqlds *postgreSqlDataStore,
 
     org_address, addrOk := dbrow.Address.Value()
     //Check the type of value to avoid runtime panic on invalid datatype.
-    if addrOk != nil {
+    if addrOk == nil {
         if org.address, ret = org_address.(string); !ret {
             org.address = ""
         }
     }
     org.uuid = syncParam.StringtoUUID(dbrow.Uuid)
-    org.status = orgStatusBit(dbrow.Status)
-    org_validity, valOk := dbrow.Validity.Value()
-    if valOk != nil {
-        if org.validity, ret = org_validity.(uint64); !ret {
-            org.validity = 0
-        }
+    org.status = OrgStatusBit(dbrow.Status)
+    org.validity = 0
+    if dbrow.Validity.Valid {
+        org.validity = uint64(dbrow.Validity.Int64)
     }
     org.startTime = dbrow.StartTime
+    org.timeZone, _ = getOrgTimeZone(sqlds, handle, org.uuid)
     org_parent, _ := dbrow.Parent.Value()
     var org_parentStr string
     if org_parentStr, ret = org_parent.(string); !ret {
         // Nil value, so set it to empty string.
         org_parentStr = ""
     }
+    org.parent = nil
+    if len(org_parentStr) == 0 {
+        //Top level organization, no parent to process.
+        return
+    }
     //Recursively process the parent until we reach global parent.
     var parentOrg = new(sqlorg)
     parentOrg.uuid = syncParam.StringtoUUID(org_parentStr)
-    org.parent = &parentOrg.org
+    org.parent = &parentOrg.Org
     parentOrg.getOrgEntryByUUID(sqlds, handle)
 }
 
@@ -432,29 +466,139 @@ func (org *sqlorg)getOrgEntryByUUID(sqlds *postgreSqlDataStore,
     }
     var row dbOrg
     err = getPtr(&row, orgGetonUUID, syncParam.UUIDtoString(org.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
     if err != nil {
-        log.Trace("Failed to read org record for uuid %s", org.uuid)
+        log.Trace("Failed to read org record for uuid %s",
+                  syncParam.UUIDtoString(org.uuid))
         return err
     }
     org.dbToOrgRowXlate(sqlds, handle, &row)
     return nil
 }
 
+//Function to get org entry using uuid, or using name, address and parent when
+// uuid is not present.
+func (org *sqlorg)getOrgEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    var err error
+    if syncParam.IsUUIDEmpty(org.uuid) {
+        //Populate the uuid of parents before looking up on parent.
+        err = org.fillUUIDforOrgParents(sqlds, handle, &org.Org)
+        if err != nil {
+            return err
+        }
+        err = org.getOrgEntryByNameAddrParent(sqlds, handle)
+    } else {
+        err = org.getOrgEntryByUUID(sqlds, handle)
+    }
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return err
+}
+
+//Function to get the immediate children of org entry.
+func (org *sqlorg)getChildOrgEntries(sqlds *postgreSqlDataStore,
+                                     handle interface{}) ([]Org, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to get db handle to list children of %s err : %s",
+                    org.name, err)
+        return nil, err
+    }
+    rows := []dbOrg{}
+    err = selectPtr(&rows, orgGetonParent, syncParam.UUIDtoString(org.uuid))
+    if err != nil {
+        log.Trace("Failed to get children records for org %s, err : %s",
+                  org.name, err)
+        return nil, err
+    }
+    children := make([]Org, 0, len(rows))
+    for _, row := range(rows) {
+        child := new(sqlorg)
+        child.dbToOrgRowXlate(sqlds, handle, &row)
+        children = append(children, child.Org)
+    }
+    return children, nil
+}
+
+//Function to get the org entry and all its descendants as a tree.
+func (org *sqlorg)getOrgTree(sqlds *postgreSqlDataStore,
+                                     handle interface{}) (*OrgTree, error) {
+    children, err := org.getChildOrgEntries(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    tree := new(OrgTree)
+    tree.Org = new(Org)
+    *tree.Org = org.Org
+    for _, child := range(children) {
+        childrow := new(sqlorg)
+        childrow.Org = child
+        subtree, err := childrow.getOrgTree(sqlds, handle)
+        if err != nil {
+            return nil, err
+        }
+        tree.Children = append(tree.Children, subtree)
+    }
+    return tree, nil
+}
+
 //Function to check if org is differnt than the record in DB(dbrowOrg).
-//Validity and status are allowed to change, hence need to validate only them.
+//Validity, status and time zone are allowed to change, hence need to validate
+// only them. An empty time zone is left as is.
 //Return true if values are not equal false otherwise
 func (org *sqlorg)isOrgNeedUpdate(dbrowOrg *sqlorg) bool{
     if org.validity != dbrowOrg.validity ||
-        org.status != dbrowOrg.status {
+        org.status != dbrowOrg.status ||
+        (len(org.timeZone) != 0 && org.timeZone != dbrowOrg.timeZone) {
             return true
     }
     return false
 }
 
+//Time zone of the org/unit 'orgUUID', the default zone when the org doesnt
+// have a zone.
+func getOrgTimeZone(sqlds *postgreSqlDataStore, handle interface{},
+                    orgUUID syncParam.UUID) (string, error) {
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        return timezone.DEFAULT_TIME_ZONE, err
+    }
+    var name string
+    err = getPtr(&name, orgGetTimeZone, syncParam.UUIDtoString(orgUUID))
+    if err == sql.ErrNoRows {
+        return timezone.DEFAULT_TIME_ZONE, nil
+    }
+    if err != nil {
+        return timezone.DEFAULT_TIME_ZONE, err
+    }
+    return name, nil
+}
+
+//Location of the time zone of org/unit 'orgUUID', to compute the local days
+// of the org.
+func getOrgLocation(sqlds *postgreSqlDataStore, handle interface{},
+                    orgUUID syncParam.UUID) (*time.Location, error) {
+    name, err := getOrgTimeZone(sqlds, handle, orgUUID)
+    if err != nil {
+        return nil, err
+    }
+    return timezone.Location(name), nil
+}
+
 //Function to update a org entry and its children.
 //Update is very expensive operation as finding child involves DB lookup.
-//Only status and validity fields are allowed to update in org entry.
+//Only status, validity and time zone fields are allowed to update in org
+// entry. The time zone is updated only on the org entry, not on children.
 //To modify any other fields, delete and readd orgentry.
+//The handle must be a transaction, otherwise a failure in the middle leaves
+// the hierarchy partially updated.
 func (org *sqlorg)updateOrgEntry(sqlds *postgreSqlDataStore,
                                      handle interface{}) error {
     var err error
@@ -480,20 +624,17 @@ func (org *sqlorg)updateOrgEntry(sqlds *postgreSqlDataStore,
         return fmt.Errorf("%s",
                         errorset.ERROR_TYPES[errorset.INVALID_PARAM])
     }
+    if !org.isTimeZoneValid() {
+        log.Info("Cannot update the org record %s as unknown time zone %s",
+                 org.name, org.timeZone)
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.TIME_ZONE_INVALID])
+    }
 
-    if syncParam.IsUUIDEmpty(orgrow.uuid) {
-        if err = orgrow.getOrgEntryByNameAddrParent(sqlds, handle); err != nil {
-            log.Info(`Failed to update record %s, error in finding record: %s`,
-                    org.name, err)
-            return err
-        }
-    } else {
-        //Get the record with UUID
-        if err = orgrow.getOrgEntryByUUID(sqlds, handle); err != nil {
-            log.Info(`Failed to update record %s, error in finding record using
-                uuid : %s`, org.name, err)
-            return err
-        }
+    if err = orgrow.getOrgEntry(sqlds, handle); err != nil {
+        log.Info(`Failed to update record %s, error in finding record: %s`,
+                org.name, err)
+        return err
     }
     //orgrow will have the DB record, and org will have user input data
     if !org.isOrgNeedUpdate(orgrow) {
@@ -507,9 +648,9 @@ func (org *sqlorg)updateOrgEntry(sqlds *postgreSqlDataStore,
     newvalidity.Scan(org.validity)
 
     //Workaround declaration, to call closures recursively.
-    var updateFunc func(*sqlorg, orgStatusBit, sql.NullInt64)(error)
+    var updateFunc func(*sqlorg, OrgStatusBit, sql.NullInt64)(error)
     //Update the children records as well before updating by itself.
-    updateFunc = func(orgrow *sqlorg, newstatus orgStatusBit,
+    updateFunc = func(orgrow *sqlorg, newstatus OrgStatusBit,
         newvalidity sql.NullInt64) error {
         rows := []dbOrg{}
         err = selectPtr(&rows, orgGetonParent,
@@ -524,7 +665,7 @@ func (org *sqlorg)updateOrgEntry(sqlds *postgreSqlDataStore,
             childrow.dbToOrgRowXlate(sqlds, handle, &row)
             err = updateFunc(childrow, newstatus, newvalidity)
             if err != nil {
-                // XXX :: Chance of partial update ??
+                //Caller rollback the transaction on error.
                 log.Info("Failed to update children org records of %s, error %s",
                     row.Name, err)
                 return err
@@ -539,11 +680,23 @@ func (org *sqlorg)updateOrgEntry(sqlds *postgreSqlDataStore,
         }
         return nil
     }
-    return updateFunc(orgrow, newstatus, newvalidity)
+    err = updateFunc(orgrow, newstatus, newvalidity)
+    if err != nil || len(org.timeZone) == 0 {
+        return err
+    }
+    _, err = execPtr(orgSetTimeZone, syncParam.UUIDtoString(orgrow.uuid),
+                     org.timeZone)
+    if err != nil {
+        log.Info("Failed to update time zone of org %s err : %s",
+                 orgrow.name, err)
+    }
+    return err
 }
 
 //Function to delete a org hiearchy in DB.
 // The orgname/unit name should be provided to delete a org entry from table.
+//The handle must be a transaction, otherwise a failure in the middle leaves
+// the hierarchy partially deleted.
 func (org *sqlorg)deleteOrgEntry(sqlds *postgreSqlDataStore,
                                      handle interface{}) error {
     var err error
@@ -560,12 +713,7 @@ func (org *sqlorg)deleteOrgEntry(sqlds *postgreSqlDataStore,
     // No need to validate error, as its very unlikely to fail this when
     // previous call to gethandle is a success.
     execPtr, _ = sqlds.getDBExecFunction(handle)
-    if syncParam.IsUUIDEmpty(org.uuid) {
-        //Find the entry using name address and parent.
-        err = org.getOrgEntryByNameAddrParent(sqlds, handle)
-    } else {
-        err = org.getOrgEntryByUUID(sqlds, handle)
-    }
+    err = org.getOrgEntry(sqlds, handle)
     if err != nil {
         log.Info("Failed to delete a org entry, as cannot get org entry %s",
                     err)
@@ -591,13 +739,23 @@ func (org *sqlorg)deleteOrgEntry(sqlds *postgreSqlDataStore,
         child.dbToOrgRowXlate(sqlds, handle, &row)
         err = child.deleteOrgEntry(sqlds, handle)
         if err != nil {
-            // XXX:: Chance of partial delete.
+            //Caller rollback the transaction on error.
             log.Info("Failed to delete child org record %s, err: %s", row.Name,
                         err)
             return err
         }
     }
+    //Roles of the org are not referred by the org table, delete explicitly.
+    rl := new(sqlRole)
+    err = rl.deleteOrgRoleDefEntries(sqlds, handle, org.uuid)
+    if err != nil {
+        return err
+    }
     log.Trace("Deleting org entry %s", org.name)
     _, err = execPtr(orgDelete, syncParam.UUIDtoString(org.uuid))
+    if err != nil {
+        log.Info("Failed to delete org entry %s, err : %s", org.name, err)
+        return err
+    }
     return nil
 }
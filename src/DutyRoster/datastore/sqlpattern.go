@@ -0,0 +1,917 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/recurrence"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of shift pattern table. Used only for SQLX operations.
+// The steps and exception dates are kept in their own tables.
+type dbShiftPattern struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    TemplateUuid sql.NullString `db:"templateuuid"`
+    Name string `db:"name"`
+    Rule string `db:"rule"`
+    Dtstart time.Time `db:"dtstart"`
+    MinStaff uint64 `db:"minstaff"`
+    ValidFrom sql.NullTime `db:"validfrom"`
+    ValidUntil sql.NullTime `db:"validuntil"`
+    Owner sql.NullString `db:"owner"`
+    CreateTime time.Time `db:"createtime"`
+}
+
+//The db representation of pattern step table, one row for each step of the
+// cycle of a pattern.
+type dbPatternStep struct {
+    PatternUuid string `db:"patternuuid"`
+    Position uint64 `db:"position"`
+    StartOffset int64 `db:"startoffset"` //Offset in seconds.
+    Duration int64 `db:"duration"` //Duration in seconds.
+}
+
+//The db representation of pattern exception date table.
+type dbPatternExdate struct {
+    PatternUuid string `db:"patternuuid"`
+    Exdate time.Time `db:"exdate"`
+}
+
+//The db representation of pattern occurrence table. It has a direct 1:1
+// mapping to 'PatternOccurrence' structure.
+type dbPatternOccurrence struct {
+    ShiftUuid string `db:"shiftuuid"`
+    PatternUuid string `db:"patternuuid"`
+    RecurrenceId time.Time `db:"recurrenceid"`
+    Detached bool `db:"detached"`
+}
+
+// SQL representation for shift pattern.
+type sqlShiftPattern struct {
+    ShiftPattern
+}
+
+//String representation of shift pattern tables and its elements.
+const (
+    PATTERN_TABLE_NAME = "shiftpatterns"
+    PATTERN_FIELD_UUID = "uuid"
+    PATTERN_FIELD_ORGUUID = "orguuid"
+    PATTERN_FIELD_TEMPLATEUUID = "templateuuid"
+    PATTERN_FIELD_NAME = "name"
+    PATTERN_FIELD_RULE = "rule"
+    PATTERN_FIELD_DTSTART = "dtstart"
+    PATTERN_FIELD_MINSTAFF = "minstaff"
+    PATTERN_FIELD_VALID_FROM = "validfrom"
+    PATTERN_FIELD_VALID_UNTIL = "validuntil"
+    PATTERN_FIELD_OWNER = "owner"
+    PATTERN_FIELD_CREATE_TIME = "createtime"
+
+    PATTERN_STEP_TABLE_NAME = "shiftpatternsteps"
+    PATTERN_STEP_FIELD_PATTERNUUID = "patternuuid"
+    PATTERN_STEP_FIELD_POSITION = "position"
+    PATTERN_STEP_FIELD_START_OFFSET = "startoffset"
+    PATTERN_STEP_FIELD_DURATION = "duration"
+
+    PATTERN_EXDATE_TABLE_NAME = "shiftpatternexdates"
+    PATTERN_EXDATE_FIELD_PATTERNUUID = "patternuuid"
+    PATTERN_EXDATE_FIELD_EXDATE = "exdate"
+
+    PATTERN_OCCURRENCE_TABLE_NAME = "patternoccurrences"
+    PATTERN_OCCURRENCE_FIELD_SHIFTUUID = "shiftuuid"
+    PATTERN_OCCURRENCE_FIELD_PATTERNUUID = "patternuuid"
+    PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID = "recurrenceid"
+    PATTERN_OCCURRENCE_FIELD_DETACHED = "detached"
+)
+
+// SQL statements to be used to operate on shift pattern tables.
+var (
+    //Create a table shiftpatterns
+    patternSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s UUID NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s varchar(%d) NOT NULL,
+                     %s varchar(%d) NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s bigint NOT NULL,
+                     %s timestamp NULL,
+                     %s timestamp NULL,
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NOT NULL);`,
+                     PATTERN_TABLE_NAME,
+                     PATTERN_FIELD_UUID,
+                     PATTERN_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     PATTERN_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     PATTERN_FIELD_NAME, SHIFT_NAME_STR_LEN,
+                     PATTERN_FIELD_RULE, PATTERN_RULE_STR_LEN,
+                     PATTERN_FIELD_DTSTART,
+                     PATTERN_FIELD_MINSTAFF,
+                     PATTERN_FIELD_VALID_FROM,
+                     PATTERN_FIELD_VALID_UNTIL,
+                     PATTERN_FIELD_OWNER, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     PATTERN_FIELD_CREATE_TIME)
+    //Create a table shiftpatternsteps
+    patternStepSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     PRIMARY KEY (%s, %s));`,
+                     PATTERN_STEP_TABLE_NAME,
+                     PATTERN_STEP_FIELD_PATTERNUUID,
+                     PATTERN_TABLE_NAME, PATTERN_FIELD_UUID,
+                     PATTERN_STEP_FIELD_POSITION, PATTERN_STEP_FIELD_POSITION,
+                     PATTERN_STEP_FIELD_START_OFFSET,
+                     PATTERN_STEP_FIELD_DURATION, PATTERN_STEP_FIELD_DURATION,
+                     PATTERN_STEP_FIELD_PATTERNUUID,
+                     PATTERN_STEP_FIELD_POSITION)
+    //Create a table shiftpatternexdates
+    patternExdateSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     PATTERN_EXDATE_TABLE_NAME,
+                     PATTERN_EXDATE_FIELD_PATTERNUUID,
+                     PATTERN_TABLE_NAME, PATTERN_FIELD_UUID,
+                     PATTERN_EXDATE_FIELD_EXDATE,
+                     PATTERN_EXDATE_FIELD_PATTERNUUID,
+                     PATTERN_EXDATE_FIELD_EXDATE)
+    //Create a table patternoccurrences, a shift is an occurrence of one
+    // pattern at most. Recurrence ids are not unique, they are moved one by
+    // one when a pattern is edited.
+    patternOccurrenceSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     %s boolean NOT NULL);`,
+                     PATTERN_OCCURRENCE_TABLE_NAME,
+                     PATTERN_OCCURRENCE_FIELD_SHIFTUUID,
+                     SHIFT_TABLE_NAME, SHIFT_FIELD_UUID,
+                     PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                     PATTERN_TABLE_NAME, PATTERN_FIELD_UUID,
+                     PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                     PATTERN_OCCURRENCE_FIELD_DETACHED)
+    //Index to find the occurrences of a pattern in a time range.
+    patternOccurrenceIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s, %s)`,
+                            PATTERN_OCCURRENCE_TABLE_NAME,
+                            PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                            PATTERN_OCCURRENCE_TABLE_NAME,
+                            PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID)
+    //Create a shift pattern entry.
+    patternCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+                            $11)`,
+                            PATTERN_TABLE_NAME,
+                            PATTERN_FIELD_UUID, PATTERN_FIELD_ORGUUID,
+                            PATTERN_FIELD_TEMPLATEUUID, PATTERN_FIELD_NAME,
+                            PATTERN_FIELD_RULE, PATTERN_FIELD_DTSTART,
+                            PATTERN_FIELD_MINSTAFF, PATTERN_FIELD_VALID_FROM,
+                            PATTERN_FIELD_VALID_UNTIL, PATTERN_FIELD_OWNER,
+                            PATTERN_FIELD_CREATE_TIME)
+    //Get the shift pattern with specific uuid
+    patternGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            PATTERN_TABLE_NAME, PATTERN_FIELD_UUID)
+    //Get all the shift patterns of an org/unit.
+    patternGetonOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s, %s`,
+                            PATTERN_TABLE_NAME, PATTERN_FIELD_ORGUUID,
+                            PATTERN_FIELD_NAME, PATTERN_FIELD_CREATE_TIME)
+    //Update the fields of shift pattern that are changed by the edits.
+    patternUpdate = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2), %s=($3)
+                            WHERE %s=($4)`,
+                            PATTERN_TABLE_NAME, PATTERN_FIELD_MINSTAFF,
+                            PATTERN_FIELD_VALID_FROM, PATTERN_FIELD_VALID_UNTIL,
+                            PATTERN_FIELD_UUID)
+    //Delete the shift pattern with specific uuid
+    patternDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)`,
+                            PATTERN_TABLE_NAME, PATTERN_FIELD_UUID)
+    //Add a step to the cycle of a pattern.
+    patternStepCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4)`,
+                            PATTERN_STEP_TABLE_NAME,
+                            PATTERN_STEP_FIELD_PATTERNUUID,
+                            PATTERN_STEP_FIELD_POSITION,
+                            PATTERN_STEP_FIELD_START_OFFSET,
+                            PATTERN_STEP_FIELD_DURATION)
+    //Get the steps of a pattern in order.
+    patternStepGetonPattern = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            PATTERN_STEP_TABLE_NAME,
+                            PATTERN_STEP_FIELD_PATTERNUUID,
+                            PATTERN_STEP_FIELD_POSITION)
+    //Get the steps of all the patterns of an org/unit.
+    patternStepGetonOrg = fmt.Sprintf(`SELECT s.* FROM %s s
+                            INNER JOIN %s p ON s.%s = p.%s
+                            WHERE p.%s=($1) ORDER BY s.%s, s.%s`,
+                            PATTERN_STEP_TABLE_NAME, PATTERN_TABLE_NAME,
+                            PATTERN_STEP_FIELD_PATTERNUUID, PATTERN_FIELD_UUID,
+                            PATTERN_FIELD_ORGUUID,
+                            PATTERN_STEP_FIELD_PATTERNUUID,
+                            PATTERN_STEP_FIELD_POSITION)
+    //Delete the steps of a pattern.
+    patternStepDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)`,
+                            PATTERN_STEP_TABLE_NAME,
+                            PATTERN_STEP_FIELD_PATTERNUUID)
+    //Add an exception date to a pattern.
+    patternExdateCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s)
+                            VALUES ($1, $2)`,
+                            PATTERN_EXDATE_TABLE_NAME,
+                            PATTERN_EXDATE_FIELD_PATTERNUUID,
+                            PATTERN_EXDATE_FIELD_EXDATE)
+    //Get the exception dates of a pattern in order.
+    patternExdateGetonPattern = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            PATTERN_EXDATE_TABLE_NAME,
+                            PATTERN_EXDATE_FIELD_PATTERNUUID,
+                            PATTERN_EXDATE_FIELD_EXDATE)
+    //Get the exception dates of all the patterns of an org/unit.
+    patternExdateGetonOrg = fmt.Sprintf(`SELECT e.* FROM %s e
+                            INNER JOIN %s p ON e.%s = p.%s
+                            WHERE p.%s=($1) ORDER BY e.%s, e.%s`,
+                            PATTERN_EXDATE_TABLE_NAME, PATTERN_TABLE_NAME,
+                            PATTERN_EXDATE_FIELD_PATTERNUUID,
+                            PATTERN_FIELD_UUID, PATTERN_FIELD_ORGUUID,
+                            PATTERN_EXDATE_FIELD_PATTERNUUID,
+                            PATTERN_EXDATE_FIELD_EXDATE)
+    //Delete the exception dates of a pattern.
+    patternExdateDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1)`,
+                            PATTERN_EXDATE_TABLE_NAME,
+                            PATTERN_EXDATE_FIELD_PATTERNUUID)
+    //Create a pattern occurrence entry.
+    patternOccurrenceCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4)`,
+                            PATTERN_OCCURRENCE_TABLE_NAME,
+                            PATTERN_OCCURRENCE_FIELD_SHIFTUUID,
+                            PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                            PATTERN_OCCURRENCE_FIELD_DETACHED)
+    //Get the occurrences of a pattern with recurrence id in a time range.
+    patternOccurrenceGetonRange = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s >= ($2) AND %s < ($3)
+                            ORDER BY %s`,
+                            PATTERN_OCCURRENCE_TABLE_NAME,
+                            PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID)
+    //Get the occurrences of a pattern from a recurrence id.
+    patternOccurrenceGetonFrom = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s >= ($2) ORDER BY %s`,
+                            PATTERN_OCCURRENCE_TABLE_NAME,
+                            PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID)
+    //Update the pattern, recurrence id and detached flag of an occurrence.
+    patternOccurrenceUpdate = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2),
+                            %s=($3) WHERE %s=($4)`,
+                            PATTERN_OCCURRENCE_TABLE_NAME,
+                            PATTERN_OCCURRENCE_FIELD_PATTERNUUID,
+                            PATTERN_OCCURRENCE_FIELD_RECURRENCE_ID,
+                            PATTERN_OCCURRENCE_FIELD_DETACHED,
+                            PATTERN_OCCURRENCE_FIELD_SHIFTUUID)
+)
+
+//Translate DB shift pattern row to pattern structure, the steps and
+// exception dates are not part of the row.
+func (pat *sqlShiftPattern)dbToShiftPatternRowXlate(dbrow *dbShiftPattern) {
+    pat.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    pat.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    pat.templateUUID = syncParam.UUID{}
+    if dbrow.TemplateUuid.Valid {
+        pat.templateUUID = syncParam.StringtoUUID(dbrow.TemplateUuid.String)
+    }
+    pat.name = dbrow.Name
+    pat.rule = dbrow.Rule
+    pat.dtstart = dbrow.Dtstart.UTC()
+    pat.minStaff = dbrow.MinStaff
+    pat.validFrom = time.Time{}
+    if dbrow.ValidFrom.Valid {
+        pat.validFrom = dbrow.ValidFrom.Time.UTC()
+    }
+    pat.validUntil = time.Time{}
+    if dbrow.ValidUntil.Valid {
+        pat.validUntil = dbrow.ValidUntil.Time.UTC()
+    }
+    pat.owner = ""
+    if dbrow.Owner.Valid {
+        pat.owner = dbrow.Owner.String
+    }
+    pat.createTime = dbrow.CreateTime
+    pat.steps = []PatternStep{}
+    pat.exdates = []time.Time{}
+}
+
+//Translate DB pattern occurrence row to occurrence structure.
+func dbToPatternOccurrenceRowXlate(
+                        dbrow *dbPatternOccurrence) *PatternOccurrence {
+    occ := new(PatternOccurrence)
+    occ.shiftUUID = syncParam.StringtoUUID(dbrow.ShiftUuid)
+    occ.patternUUID = syncParam.StringtoUUID(dbrow.PatternUuid)
+    occ.recurrenceID = dbrow.RecurrenceId.UTC()
+    occ.detached = dbrow.Detached
+    return occ
+}
+
+//Nullable timestamp for the optional times of pattern.
+func patternNullTime(t time.Time) sql.NullTime {
+    if t.IsZero() {
+        return sql.NullTime{}
+    }
+    return sql.NullTime{Time : t.UTC(), Valid : true}
+}
+
+//Write the steps and exception dates of the pattern, the existing ones are
+// replaced.
+func (pat *sqlShiftPattern)writePatternChildren(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to write pattern, invalid DB handle err : %s", err)
+        return err
+    }
+    uuidStr := syncParam.UUIDtoString(pat.uuid)
+    _, err = execPtr(patternStepDelete, uuidStr)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(patternExdateDelete, uuidStr)
+    if err != nil {
+        return err
+    }
+    for i, step := range(pat.steps) {
+        _, err = execPtr(patternStepCreate, uuidStr, uint64(i),
+                         int64(step.offset / time.Second),
+                         int64(step.duration / time.Second))
+        if err != nil {
+            log.Error("Failed to add step to pattern %s err : %s", uuidStr,
+                      err)
+            return err
+        }
+    }
+    for _, exdate := range(pat.exdates) {
+        _, err = execPtr(patternExdateCreate, uuidStr, exdate.UTC())
+        if err != nil {
+            log.Error("Failed to add exdate to pattern %s err : %s", uuidStr,
+                      err)
+            return err
+        }
+    }
+    return nil
+}
+
+//Insert the pattern with its steps and exception dates, uuid and createTime
+// are self populated.
+func (pat *sqlShiftPattern)insertShiftPatternEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create pattern, invalid DB handle err : %s", err)
+        return err
+    }
+    pat.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create pattern")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    pat.createTime = time.Now()
+    var templateUUID, owner sql.NullString
+    if !syncParam.IsUUIDEmpty(pat.templateUUID) {
+        templateUUID.Scan(syncParam.UUIDtoString(pat.templateUUID))
+    }
+    if len(pat.owner) != 0 {
+        owner.Scan(pat.owner)
+    }
+    _, err = execPtr(patternCreate, syncParam.UUIDtoString(pat.uuid),
+                     syncParam.UUIDtoString(pat.orgUUID), templateUUID,
+                     pat.name, pat.rule, pat.dtstart.UTC(), pat.minStaff,
+                     patternNullTime(pat.validFrom),
+                     patternNullTime(pat.validUntil), owner,
+                     pat.createTime.UTC())
+    if err != nil {
+        log.Error("Failed to create pattern %s err : %s", pat.name, err)
+        return err
+    }
+    return pat.writePatternChildren(sqlds, handle)
+}
+
+//Create a shift pattern entry in table. uuid and createTime are self
+// populated, the rule is stored in its canonical form.
+func (pat *sqlShiftPattern)createShiftPatternEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    rule, err := recurrence.ParseRule(pat.rule)
+    if err != nil {
+        log.Error("Cannot create shift pattern %s, invalid rule %s", pat.name,
+                  pat.rule)
+        return err
+    }
+    if pat.IsShiftPatternValid() == false {
+        log.Error("Cannot create shift pattern %s, invalid params", pat.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = pat.orgUUID
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Cannot create shift pattern %s, org not present", pat.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if !syncParam.IsUUIDEmpty(pat.templateUUID) {
+        tmpl := new(sqlShiftTemplate)
+        tmpl.uuid = pat.templateUUID
+        err = tmpl.getShiftTemplateByUUID(sqlds, handle)
+        if err != nil {
+            log.Info("Cannot create shift pattern, template %s not present",
+                     syncParam.UUIDtoString(pat.templateUUID))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    pat.rule = rule.String()
+    pat.normalize()
+    return pat.insertShiftPatternEntry(sqlds, handle)
+}
+
+//Function to get shift pattern with specific UUID, with its steps and
+// exception dates.
+func (pat *sqlShiftPattern)getShiftPatternByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get pattern, invalid DB handle err : %s", err)
+        return err
+    }
+    selectPtr, _ := sqlds.getDBSelectFunction(handle)
+    if syncParam.IsUUIDEmpty(pat.uuid) {
+        log.Trace("Empty pattern UUID, cannot find in table")
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    var row dbShiftPattern
+    err = getPtr(&row, patternGetonUUID, syncParam.UUIDtoString(pat.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read pattern %s, err : %s",
+                  syncParam.UUIDtoString(pat.uuid), err)
+        return err
+    }
+    pat.dbToShiftPatternRowXlate(&row)
+    steps := []dbPatternStep{}
+    err = selectPtr(&steps, patternStepGetonPattern, row.Uuid)
+    if err != nil {
+        log.Trace("Failed to read steps of pattern %s, err : %s", row.Uuid,
+                  err)
+        return err
+    }
+    for _, step := range(steps) {
+        pat.steps = append(pat.steps, NewPatternStep(
+                        time.Duration(step.StartOffset) * time.Second,
+                        time.Duration(step.Duration) * time.Second))
+    }
+    exdates := []dbPatternExdate{}
+    err = selectPtr(&exdates, patternExdateGetonPattern, row.Uuid)
+    if err != nil {
+        log.Trace("Failed to read exdates of pattern %s, err : %s", row.Uuid,
+                  err)
+        return err
+    }
+    for _, exdate := range(exdates) {
+        pat.exdates = append(pat.exdates, exdate.Exdate.UTC())
+    }
+    return nil
+}
+
+//Function to get all the shift patterns of org/unit 'orgUUID' with their
+// steps and exception dates.
+func (pat *sqlShiftPattern)getShiftPatternsByOrg(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID) (
+                                     []ShiftPattern, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list patterns, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    orgStr := syncParam.UUIDtoString(orgUUID)
+    rows := []dbShiftPattern{}
+    err = selectPtr(&rows, patternGetonOrg, orgStr)
+    if err != nil {
+        log.Trace("Failed to read patterns of org %s, err : %s", orgStr, err)
+        return nil, err
+    }
+    steps := []dbPatternStep{}
+    err = selectPtr(&steps, patternStepGetonOrg, orgStr)
+    if err != nil {
+        log.Trace("Failed to read pattern steps of org %s, err : %s", orgStr,
+                  err)
+        return nil, err
+    }
+    exdates := []dbPatternExdate{}
+    err = selectPtr(&exdates, patternExdateGetonOrg, orgStr)
+    if err != nil {
+        log.Trace("Failed to read pattern exdates of org %s, err : %s", orgStr,
+                  err)
+        return nil, err
+    }
+    stepMap := make(map[string][]PatternStep)
+    for _, step := range(steps) {
+        stepMap[step.PatternUuid] = append(stepMap[step.PatternUuid],
+                    NewPatternStep(
+                        time.Duration(step.StartOffset) * time.Second,
+                        time.Duration(step.Duration) * time.Second))
+    }
+    exdateMap := make(map[string][]time.Time)
+    for _, exdate := range(exdates) {
+        exdateMap[exdate.PatternUuid] = append(exdateMap[exdate.PatternUuid],
+                                               exdate.Exdate.UTC())
+    }
+    pats := make([]ShiftPattern, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlShiftPattern)
+        entry.dbToShiftPatternRowXlate(&row)
+        entry.steps = append(entry.steps, stepMap[row.Uuid]...)
+        entry.exdates = append(entry.exdates, exdateMap[row.Uuid]...)
+        pats = append(pats, entry.ShiftPattern)
+    }
+    return pats, nil
+}
+
+//Function to delete the shift pattern, the steps, exception dates and
+// occurrence records are deleted with it. The shifts are kept.
+func (pat *sqlShiftPattern)deleteShiftPatternEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete pattern, invalid DB handle err : %s", err)
+        return err
+    }
+    err = pat.getShiftPatternByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(patternDelete, syncParam.UUIDtoString(pat.uuid))
+    if err != nil {
+        log.Info("Failed to delete pattern %s, err : %s",
+                 syncParam.UUIDtoString(pat.uuid), err)
+        return err
+    }
+    return nil
+}
+
+//Write the pattern fields changed by the edits with the steps and exception
+// dates.
+func (pat *sqlShiftPattern)updateShiftPatternEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update pattern, invalid DB handle err : %s", err)
+        return err
+    }
+    _, err = execPtr(patternUpdate, pat.minStaff,
+                     patternNullTime(pat.validFrom),
+                     patternNullTime(pat.validUntil),
+                     syncParam.UUIDtoString(pat.uuid))
+    if err != nil {
+        log.Info("Failed to update pattern %s, err : %s",
+                 syncParam.UUIDtoString(pat.uuid), err)
+        return err
+    }
+    return pat.writePatternChildren(sqlds, handle)
+}
+
+//Function to get the occurrences of the pattern with recurrence id in the
+// range [from, to), there is no upper bound when 'to' is zero.
+func getPatternOccurrences(sqlds *postgreSqlDataStore, handle interface{},
+                           patternUUID syncParam.UUID, from time.Time,
+                           to time.Time) ([]*PatternOccurrence, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list occurrences, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbPatternOccurrence{}
+    if to.IsZero() {
+        err = selectPtr(&rows, patternOccurrenceGetonFrom,
+                        syncParam.UUIDtoString(patternUUID), from.UTC())
+    } else {
+        err = selectPtr(&rows, patternOccurrenceGetonRange,
+                        syncParam.UUIDtoString(patternUUID), from.UTC(),
+                        to.UTC())
+    }
+    if err != nil {
+        log.Trace("Failed to read occurrences of pattern %s, err : %s",
+                  syncParam.UUIDtoString(patternUUID), err)
+        return nil, err
+    }
+    occs := make([]*PatternOccurrence, 0, len(rows))
+    for _, row := range(rows) {
+        occs = append(occs, dbToPatternOccurrenceRowXlate(&row))
+    }
+    return occs, nil
+}
+
+//Write the pattern, recurrence id and detached flag of the occurrence.
+func updatePatternOccurrence(sqlds *postgreSqlDataStore, handle interface{},
+                             occ *PatternOccurrence) error {
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(patternOccurrenceUpdate,
+                     syncParam.UUIDtoString(occ.patternUUID),
+                     occ.recurrenceID.UTC(), occ.detached,
+                     syncParam.UUIDtoString(occ.shiftUUID))
+    if err != nil {
+        logging.GetAppLoggerObj().Info(
+                    "Failed to update occurrence of shift %s, err : %s",
+                    syncParam.UUIDtoString(occ.shiftUUID), err)
+    }
+    return err
+}
+
+//Create the shifts for the occurrences of the pattern in the range [from, to)
+// that are not expanded yet.
+func (pat *sqlShiftPattern)expandShiftPatternEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}, from time.Time,
+                                     to time.Time,
+                                     owner string) ([]Shift, error) {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to expand pattern, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    err = pat.getShiftPatternByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    if len(owner) == 0 || !to.After(from) {
+        log.Error("Cannot expand pattern %s, invalid params", pat.name)
+        return nil, fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    loc, err := getOrgLocation(sqlds, handle, pat.orgUUID)
+    if err != nil {
+        return nil, err
+    }
+    slots, err := pat.occurrencesIn(from, to, loc)
+    if err != nil {
+        return nil, err
+    }
+    occs, err := getPatternOccurrences(sqlds, handle, pat.uuid, from, to)
+    if err != nil {
+        return nil, err
+    }
+    expanded := make(map[int64]bool)
+    for _, occ := range(occs) {
+        expanded[occ.recurrenceID.Unix()] = true
+    }
+    shifts := []Shift{}
+    for _, slot := range(slots) {
+        if expanded[slot.recurrenceID.Unix()] {
+            continue
+        }
+        shift := new(sqlShift)
+        shift.Shift = *NewShift(pat.orgUUID, pat.templateUUID,
+                                slot.recurrenceID, slot.endTime, pat.minStaff,
+                                owner)
+        err = shift.createShiftEntry(sqlds, handle)
+        if err != nil {
+            return nil, err
+        }
+        _, err = execPtr(patternOccurrenceCreate,
+                         syncParam.UUIDtoString(shift.uuid),
+                         syncParam.UUIDtoString(pat.uuid),
+                         slot.recurrenceID.UTC(), false)
+        if err != nil {
+            log.Error("Failed to record occurrence of pattern %s err : %s",
+                      pat.name, err)
+            return nil, err
+        }
+        shifts = append(shifts, shift.Shift)
+    }
+    return shifts, nil
+}
+
+//Apply the edit to the shift of the occurrence in zone 'loc', returns true
+// when the shift is changed.
+func editOccurrenceShift(sqlds *postgreSqlDataStore, handle interface{},
+                         occ *PatternOccurrence, edit *PatternEdit,
+                         now time.Time, loc *time.Location) (bool, error) {
+    shift := new(sqlShift)
+    shift.uuid = occ.shiftUUID
+    err := shift.getShiftByUUID(sqlds, handle)
+    if err != nil {
+        return false, err
+    }
+    if !edit.applyToShift(&shift.Shift, now, loc) {
+        return false, nil
+    }
+    err = shift.updateShiftEntry(sqlds, handle, now)
+    if err != nil {
+        return false, err
+    }
+    edit.changed++
+    return true, nil
+}
+
+//Apply the edit to the occurrences of the pattern in the scope of the edit.
+func (pat *sqlShiftPattern)editShiftPatternEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     edit *PatternEdit) error {
+    log := logging.GetAppLoggerObj()
+    if edit.IsPatternEditValid() == false {
+        log.Error("Cannot edit shift pattern, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    pat.uuid = edit.patternUUID
+    err := pat.getShiftPatternByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    now := time.Now()
+    edit.recurrenceID = edit.recurrenceID.UTC().Truncate(time.Second)
+    edit.resultUUID = pat.uuid
+    edit.changed = 0
+    occs, err := getPatternOccurrences(sqlds, handle, pat.uuid, time.Time{},
+                                       time.Time{})
+    if err != nil {
+        return err
+    }
+    var selected *PatternOccurrence
+    following := []*PatternOccurrence{}
+    for _, occ := range(occs) {
+        if occ.recurrenceID.Equal(edit.recurrenceID) {
+            selected = occ
+        }
+        if !occ.recurrenceID.Before(edit.recurrenceID) {
+            following = append(following, occ)
+        }
+    }
+    loc, err := getOrgLocation(sqlds, handle, pat.orgUUID)
+    if err != nil {
+        return err
+    }
+    _, inPattern := pat.occurrenceAt(edit.recurrenceID, loc)
+    if edit.scope != PATTERN_EDIT_ALL && selected == nil && !inPattern {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    switch(edit.scope) {
+    case PATTERN_EDIT_THIS:
+        //Occurrence must be expanded to edit it on its own, an occurrence
+        // that is not expanded yet can only be cancelled.
+        if selected == nil && !edit.cancel {
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+        }
+        if selected != nil {
+            changed, err := editOccurrenceShift(sqlds, handle, selected, edit,
+                                                now, loc)
+            if err != nil {
+                return err
+            }
+            if !changed {
+                return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+            }
+            selected.detached = true
+            err = updatePatternOccurrence(sqlds, handle, selected)
+            if err != nil {
+                return err
+            }
+        }
+        if edit.cancel && inPattern {
+            pat.exdates = append(pat.exdates, edit.recurrenceID)
+            pat.normalize()
+            return pat.updateShiftPatternEntry(sqlds, handle)
+        }
+        return nil
+    case PATTERN_EDIT_FOLLOWING:
+        if edit.cancel {
+            pat.endAt(edit.recurrenceID)
+            err = pat.updateShiftPatternEntry(sqlds, handle)
+            if err != nil {
+                return err
+            }
+            for _, occ := range(following) {
+                if occ.detached {
+                    continue
+                }
+                _, err = editOccurrenceShift(sqlds, handle, occ, edit, now,
+                                             loc)
+                if err != nil {
+                    return err
+                }
+            }
+            return nil
+        }
+        split := new(sqlShiftPattern)
+        split.ShiftPattern = *pat.splitAt(edit.recurrenceID, edit, loc)
+        if split.areStepsValid() == false {
+            return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+        }
+        err = pat.updateShiftPatternEntry(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        err = split.insertShiftPatternEntry(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        edit.resultUUID = split.uuid
+        for _, occ := range(following) {
+            occ.patternUUID = split.uuid
+            occ.recurrenceID = edit.moveTime(occ.recurrenceID, loc)
+            err = updatePatternOccurrence(sqlds, handle, occ)
+            if err != nil {
+                return err
+            }
+            if occ.detached {
+                continue
+            }
+            _, err = editOccurrenceShift(sqlds, handle, occ, edit, now,
+                                         loc)
+            if err != nil {
+                return err
+            }
+        }
+    case PATTERN_EDIT_ALL:
+        if edit.cancel {
+            //The pattern ends now, the shifts started are kept.
+            pat.endAt(now.UTC().Truncate(time.Second))
+        } else {
+            pat.applyEdit(edit, loc)
+            if pat.areStepsValid() == false {
+                return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+            }
+        }
+        err = pat.updateShiftPatternEntry(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        for _, occ := range(occs) {
+            if !edit.cancel {
+                occ.recurrenceID = edit.moveTime(occ.recurrenceID, loc)
+                err = updatePatternOccurrence(sqlds, handle, occ)
+                if err != nil {
+                    return err
+                }
+            }
+            if occ.detached {
+                continue
+            }
+            _, err = editOccurrenceShift(sqlds, handle, occ, edit, now,
+                                         loc)
+            if err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
@@ -16,9 +16,12 @@ package datastore
 
 import (
     "fmt"
+    "strings"
+    "database/sql"
     _ "github.com/lib/pq"
     "DutyRoster/errorset"
     "DutyRoster/logging"
+    "DutyRoster/syncParam"
 )
 
 type sqlroles struct {
@@ -33,13 +36,16 @@ const (
 
 // All the sql statements to run on role table.
 var (
-    //Check if table is exist in the DB
-    roletableExist = fmt.Sprintf("SELECT 1 FROM %s LIMIT 1;", ROLE_TABLE_NAME_STR)
     //Create a table roles
     roleschema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
                             (%s bigint NOT NULL PRIMARY KEY CHECK(%s > 0));`,
                     ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
                     ROLE_TYPE_NAME_STR)
+    //Insert all the builtin roles, the roles already in table are skipped.
+    roleSeed = fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%d), (%d), (%d)
+                            ON CONFLICT DO NOTHING`,
+                            ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                            ENDUSER, MANAGER, ROOTADMIN)
     //Create a role entry in table roles
     roleCreate = fmt.Sprintf("INSERT INTO %s (%s) VALUES ($1)", ROLE_TABLE_NAME_STR,
                             ROLE_TYPE_NAME_STR)
@@ -53,29 +59,6 @@ var (
                         ROLE_TYPE_NAME_STR)
 )
 
-func (rl *sqlroles)createRoleTable(sqlds *postgreSqlDataStore,
-                                     handle interface{}) error{
-    log := logging.GetAppLoggerObj()
-    execPtr, err := sqlds.getDBExecFunction(handle)
-    if err != nil {
-        log.Error("Failed to create role table, invalid DB handle err : %s",
-                    err)
-        return err
-    }
-    _, err = execPtr(roletableExist)
-    if err == nil {
-        log.Info("Role table is already exist in the system. ")
-        return nil
-    }
-    _, err = execPtr(roleschema)
-    if err != nil {
-        log.Error("Failed to create role table: %s", err)
-        return fmt.Errorf("%s",
-                        errorset.ERROR_TYPES[errorset.DB_TABLE_CREATE_FAILED])
-    }
-    return nil
-}
-
 //Function to create a role entry in table if not exist.
 func (rl *sqlroles)createRoleEntry(sqlds *postgreSqlDataStore,
                                      handle interface{}) error {
@@ -165,3 +148,412 @@ func (rl *sqlroles)delRoleEntry(sqlds *postgreSqlDataStore,
     }
     return nil
 }
+
+//The db representation of role definition table. Used only for SQLX
+// operations. Permissions are stored as a comma separated list.
+type dbRoleDef struct {
+    RoleType uint64 `db:"roletype"`
+    Name string `db:"name"`
+    Permissions string `db:"permissions"`
+    OrgUuid sql.NullString `db:"orguuid"`
+    System bool `db:"system"`
+}
+
+// SQL representation for role definition.
+type sqlRole struct {
+    Role
+}
+
+//String representation of role definition table and its elements.
+const (
+    ROLE_NAME_STR_LEN = 200
+    ROLEDEF_TABLE_NAME = "roledefinitions"
+    ROLEDEF_FIELD_ROLETYPE = "roletype"
+    ROLEDEF_FIELD_NAME = "name"
+    ROLEDEF_FIELD_PERMISSIONS = "permissions"
+    ROLEDEF_FIELD_ORGUUID = "orguuid"
+    ROLEDEF_FIELD_SYSTEM = "system"
+    ROLE_PERMISSION_SEPARATOR = ","
+)
+
+// SQL statements to be used to operate on role definition table.
+var (
+    //Create a table roledefinitions, a row for every role in roles table.
+    // Roles of an org/unit are removed with the org/unit.
+    roledefSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s bigint NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     %s text NOT NULL,
+                     %s UUID NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s boolean NOT NULL);`,
+                     ROLEDEF_TABLE_NAME,
+                     ROLEDEF_FIELD_ROLETYPE,
+                     ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                     ROLEDEF_FIELD_NAME, ROLE_NAME_STR_LEN,
+                     ROLEDEF_FIELD_PERMISSIONS,
+                     ROLEDEF_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ROLEDEF_FIELD_SYSTEM)
+    //Define all the builtin roles as system roles.
+    roledefSeed = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s) VALUES
+                            (%d, '%s', '', NULL, TRUE),
+                            (%d, '%s', '', NULL, TRUE),
+                            (%d, '%s', '', NULL, TRUE)
+                            ON CONFLICT DO NOTHING`,
+                            ROLEDEF_TABLE_NAME,
+                            ROLEDEF_FIELD_ROLETYPE, ROLEDEF_FIELD_NAME,
+                            ROLEDEF_FIELD_PERMISSIONS, ROLEDEF_FIELD_ORGUUID,
+                            ROLEDEF_FIELD_SYSTEM,
+                            ENDUSER, ENDUSER_ROLE_NAME,
+                            MANAGER, MANAGER_ROLE_NAME,
+                            ROOTADMIN, ROOTADMIN_ROLE_NAME)
+    //Create a role definition entry
+    roledefCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5)`,
+                            ROLEDEF_TABLE_NAME,
+                            ROLEDEF_FIELD_ROLETYPE, ROLEDEF_FIELD_NAME,
+                            ROLEDEF_FIELD_PERMISSIONS, ROLEDEF_FIELD_ORGUUID,
+                            ROLEDEF_FIELD_SYSTEM)
+    //Get the role definition of a role bit
+    roledefGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            ROLEDEF_TABLE_NAME, ROLEDEF_FIELD_ROLETYPE)
+    //Get all the role definitions
+    roledefGetAll = fmt.Sprintf(`SELECT * FROM %s ORDER BY %s`,
+                            ROLEDEF_TABLE_NAME, ROLEDEF_FIELD_ROLETYPE)
+    //Get the role definition on name, that can be granted in any org/unit
+    roledefGetonName = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s IS NULL`,
+                            ROLEDEF_TABLE_NAME, ROLEDEF_FIELD_NAME,
+                            ROLEDEF_FIELD_ORGUUID)
+    //Get the role definition on name in an org/unit
+    roledefGetonNameOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s=($2)`,
+                            ROLEDEF_TABLE_NAME, ROLEDEF_FIELD_NAME,
+                            ROLEDEF_FIELD_ORGUUID)
+    //Update name and permissions of a role
+    roledefUpdate = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2)
+                            WHERE %s=($3)`,
+                            ROLEDEF_TABLE_NAME, ROLEDEF_FIELD_NAME,
+                            ROLEDEF_FIELD_PERMISSIONS, ROLEDEF_FIELD_ROLETYPE)
+    //Get all the role bits in use
+    roleGetAll = fmt.Sprintf("SELECT %s FROM %s ORDER BY %s",
+                            ROLE_TYPE_NAME_STR, ROLE_TABLE_NAME_STR,
+                            ROLE_TYPE_NAME_STR)
+    //Delete the roles of an org/unit, the definitions and memberships are
+    // removed with the role.
+    roleDeleteOnOrg = fmt.Sprintf(`DELETE FROM %s WHERE %s IN
+                            (SELECT %s FROM %s WHERE %s=($1))`,
+                            ROLE_TABLE_NAME_STR, ROLE_TYPE_NAME_STR,
+                            ROLEDEF_FIELD_ROLETYPE, ROLEDEF_TABLE_NAME,
+                            ROLEDEF_FIELD_ORGUUID)
+)
+
+//Validate the name and permissions of a custom role.
+func (rl *Role)isRoleDefValid() bool {
+    if len(rl.name) == 0 || len(rl.name) >= ROLE_NAME_STR_LEN {
+        return false
+    }
+    for _, perm := range(rl.permissions) {
+        if len(perm) == 0 ||
+            strings.Contains(perm, ROLE_PERMISSION_SEPARATOR) {
+            return false
+        }
+    }
+    return true
+}
+
+//Translate role definition to DB row in table.
+func (rl *sqlRole)roleToDBRowXlate() *dbRoleDef {
+    dbrow := new(dbRoleDef)
+    dbrow.RoleType = uint64(rl.roleType)
+    dbrow.Name = rl.name
+    dbrow.Permissions = strings.Join(rl.permissions, ROLE_PERMISSION_SEPARATOR)
+    if !syncParam.IsUUIDEmpty(rl.orgUUID) {
+        dbrow.OrgUuid.Scan(syncParam.UUIDtoString(rl.orgUUID))
+    }
+    dbrow.System = rl.system
+    return dbrow
+}
+
+//Translate DB role definition row to role structure.
+func (rl *sqlRole)dbToRoleRowXlate(dbrow *dbRoleDef) {
+    rl.roleType = RoleBit(dbrow.RoleType)
+    rl.name = dbrow.Name
+    rl.permissions = []string{}
+    if len(dbrow.Permissions) != 0 {
+        rl.permissions = strings.Split(dbrow.Permissions,
+                                       ROLE_PERMISSION_SEPARATOR)
+    }
+    rl.orgUUID = syncParam.UUID{}
+    if dbrow.OrgUuid.Valid {
+        rl.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid.String)
+    }
+    rl.system = dbrow.System
+}
+
+//Check no other role with same name can be granted in the scope of role.
+//Role names in an org/unit must not collide with the roles of all org/units.
+func (rl *sqlRole)isRoleNameUnique(sqlds *postgreSqlDataStore,
+                                   handle interface{}) (bool, error) {
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        return false, err
+    }
+    var row dbRoleDef
+    err = getPtr(&row, roledefGetonName, rl.name)
+    if err == nil && RoleBit(row.RoleType) != rl.roleType {
+        return false, nil
+    }
+    if err != nil && err != sql.ErrNoRows {
+        return false, err
+    }
+    if syncParam.IsUUIDEmpty(rl.orgUUID) {
+        return true, nil
+    }
+    err = getPtr(&row, roledefGetonNameOrg, rl.name,
+                 syncParam.UUIDtoString(rl.orgUUID))
+    if err == nil && RoleBit(row.RoleType) != rl.roleType {
+        return false, nil
+    }
+    if err != nil && err != sql.ErrNoRows {
+        return false, err
+    }
+    return true, nil
+}
+
+//Create a custom role on the lowest free role bit above the system roles.
+//The role bit is populated on success.
+func (rl *sqlRole)createRoleDefEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create role %s, invalid DB handle err : %s",
+                  rl.name, err)
+        return err
+    }
+    selectPtr, _ := sqlds.getDBSelectFunction(handle)
+    if rl.isRoleDefValid() == false {
+        log.Error("Cannot create role, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if !syncParam.IsUUIDEmpty(rl.orgUUID) {
+        orgrow := new(sqlorg)
+        orgrow.uuid = rl.orgUUID
+        res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        if res == false {
+            log.Info("Cannot create role %s, org %s not present", rl.name,
+                     syncParam.UUIDtoString(rl.orgUUID))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    rl.roleType = 0
+    unique, err := rl.isRoleNameUnique(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if !unique {
+        log.Info("Role %s is already present in system", rl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    usedBits := []uint64{}
+    err = selectPtr(&usedBits, roleGetAll)
+    if err != nil {
+        log.Trace("Failed to read the role bits, err : %s", err)
+        return err
+    }
+    var used RoleBit
+    for _, bit := range(usedBits) {
+        used |= RoleBit(bit)
+    }
+    for bit := ROOTADMIN << 1; bit <= MAX_ROLEBIT; bit <<= 1 {
+        if used & bit == 0 {
+            rl.roleType = bit
+            break
+        }
+    }
+    if rl.roleType == 0 {
+        log.Error("Cannot create role %s, all role bits are in use", rl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.ROLE_LIMIT_REACHED])
+    }
+    rl.system = false
+    rolerow := new(sqlroles)
+    rolerow.roleType = rl.roleType
+    err = rolerow.createRoleEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    dbrow := rl.roleToDBRowXlate()
+    _, err = execPtr(roledefCreate, dbrow.RoleType, dbrow.Name,
+                     dbrow.Permissions, dbrow.OrgUuid, dbrow.System)
+    if err != nil {
+        log.Error("Failed to create role %s err : %s", rl.name, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the role definition of the role bit.
+func (rl *sqlRole)getRoleDefEntry(sqlds *postgreSqlDataStore,
+                                  handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get role %d, invalid DB handle err : %s",
+                  rl.roleType, err)
+        return err
+    }
+    var row dbRoleDef
+    err = getPtr(&row, roledefGet, uint64(rl.roleType))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read role %d, err : %s", rl.roleType, err)
+        return err
+    }
+    rl.dbToRoleRowXlate(&row)
+    return nil
+}
+
+//Function to get all the role definitions.
+func (rl *sqlRole)getAllRoleDefEntries(sqlds *postgreSqlDataStore,
+                                       handle interface{}) ([]Role, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list roles, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbRoleDef{}
+    err = selectPtr(&rows, roledefGetAll)
+    if err != nil {
+        log.Trace("Failed to read roles, err : %s", err)
+        return nil, err
+    }
+    roleList := make([]Role, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlRole)
+        entry.dbToRoleRowXlate(&row)
+        roleList = append(roleList, entry.Role)
+    }
+    return roleList, nil
+}
+
+//Function to update name and permissions of a custom role. System roles
+// cannot be modified.
+func (rl *sqlRole)updateRoleDefEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update role %d, invalid DB handle err : %s",
+                  rl.roleType, err)
+        return err
+    }
+    if rl.isRoleDefValid() == false {
+        log.Error("Cannot update role %d, invalid params", rl.roleType)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    entry := new(sqlRole)
+    entry.roleType = rl.roleType
+    err = entry.getRoleDefEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if entry.system {
+        log.Info("Cannot update system role %s", entry.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    //Scope of role cannot be changed.
+    rl.orgUUID = entry.orgUUID
+    rl.system = entry.system
+    unique, err := rl.isRoleNameUnique(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if !unique {
+        log.Info("Role %s is already present in system", rl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    dbrow := rl.roleToDBRowXlate()
+    _, err = execPtr(roledefUpdate, dbrow.Name, dbrow.Permissions,
+                     dbrow.RoleType)
+    if err != nil {
+        log.Info("Failed to update role %d, err : %s", rl.roleType, err)
+        return err
+    }
+    return nil
+}
+
+//Function to delete a custom role, the role is revoked from all the users.
+// System roles cannot be deleted.
+func (rl *sqlRole)deleteRoleDefEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    err := rl.getRoleDefEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if rl.system {
+        logging.GetAppLoggerObj().Info("Cannot delete system role %s", rl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    rolerow := new(sqlroles)
+    rolerow.roleType = rl.roleType
+    return rolerow.delRoleEntry(sqlds, handle)
+}
+
+//Function to delete all the roles of org/unit 'orgUUID'.
+func (rl *sqlRole)deleteOrgRoleDefEntries(sqlds *postgreSqlDataStore,
+                                          handle interface{},
+                                          orgUUID syncParam.UUID) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete roles, invalid DB handle err : %s", err)
+        return err
+    }
+    _, err = execPtr(roleDeleteOnOrg, syncParam.UUIDtoString(orgUUID))
+    if err != nil {
+        log.Info("Failed to delete roles of org %s, err : %s",
+                 syncParam.UUIDtoString(orgUUID), err)
+        return err
+    }
+    return nil
+}
+
+//Check the role bit can be granted in org/unit 'org'. The role must be
+// defined and 'org' must be in the scope of role. 'org' must carry the parent
+// chain.
+func (rl *sqlRole)isRoleGrantableInOrg(sqlds *postgreSqlDataStore,
+                                       handle interface{}, org *Org) error {
+    err := rl.getRoleDefEntry(sqlds, handle)
+    if err != nil {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if syncParam.IsUUIDEmpty(rl.orgUUID) {
+        return nil
+    }
+    for entry := org; entry != nil; entry = entry.parent {
+        if entry.uuid == rl.orgUUID {
+            return nil
+        }
+    }
+    logging.GetAppLoggerObj().Info("Role %s cannot be granted out of org %s",
+                    rl.name, syncParam.UUIDtoString(rl.orgUUID))
+    return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+}
@@ -0,0 +1,343 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of roster assignment table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'RosterAssignment' structure.
+type dbRosterAssignment struct {
+    Uuid string `db:"uuid"`
+    ShiftUuid string `db:"shiftuuid"`
+    OrgUuid string `db:"orguuid"`
+    Userid string `db:"userid"`
+    AssignTime time.Time `db:"assigntime"`
+}
+
+// SQL representation for roster assignment.
+type sqlRosterAssignment struct {
+    RosterAssignment
+}
+
+//String representation of roster assignment table and its elements.
+const (
+    ROSTER_TABLE_NAME = "rosterassignments"
+    ROSTER_FIELD_UUID = "uuid"
+    ROSTER_FIELD_SHIFTUUID = "shiftuuid"
+    ROSTER_FIELD_ORGUUID = "orguuid"
+    ROSTER_FIELD_USERID = "userid"
+    ROSTER_FIELD_ASSIGN_TIME = "assigntime"
+)
+
+// SQL statements to be used to operate on roster assignment table.
+var (
+    //Create a table rosterassignments. A user can be assigned only once to a
+    // shift.
+    rosterSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s timestamp NOT NULL,
+                     UNIQUE (%s, %s));`,
+                     ROSTER_TABLE_NAME,
+                     ROSTER_FIELD_UUID,
+                     ROSTER_FIELD_SHIFTUUID, SHIFT_TABLE_NAME, SHIFT_FIELD_UUID,
+                     ROSTER_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     ROSTER_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     ROSTER_FIELD_ASSIGN_TIME,
+                     ROSTER_FIELD_SHIFTUUID, ROSTER_FIELD_USERID)
+    //Create a roster assignment entry.
+    rosterCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5)`,
+                            ROSTER_TABLE_NAME,
+                            ROSTER_FIELD_UUID, ROSTER_FIELD_SHIFTUUID,
+                            ROSTER_FIELD_ORGUUID, ROSTER_FIELD_USERID,
+                            ROSTER_FIELD_ASSIGN_TIME)
+    //Get the roster assignment with specific uuid
+    rosterGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            ROSTER_TABLE_NAME, ROSTER_FIELD_UUID)
+    //Get the roster assignment of a user in a shift.
+    rosterGetonShiftUser = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1) AND
+                            %s=($2)`,
+                            ROSTER_TABLE_NAME, ROSTER_FIELD_SHIFTUUID,
+                            ROSTER_FIELD_USERID)
+    //Get all roster assignments of a shift.
+    rosterGetonShift = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            ROSTER_TABLE_NAME, ROSTER_FIELD_SHIFTUUID,
+                            ROSTER_FIELD_USERID)
+    //Get all roster assignments of a user for shifts that overlaps the range.
+    rosterGetonUserRange = fmt.Sprintf(`SELECT r.* FROM %s r
+                            INNER JOIN %s s ON r.%s = s.%s
+                            WHERE r.%s=($1) AND s.%s > ($2) AND s.%s < ($3)
+                            ORDER BY s.%s`,
+                            ROSTER_TABLE_NAME, SHIFT_TABLE_NAME,
+                            ROSTER_FIELD_SHIFTUUID, SHIFT_FIELD_UUID,
+                            ROSTER_FIELD_USERID, SHIFT_FIELD_END_TIME,
+                            SHIFT_FIELD_START_TIME, SHIFT_FIELD_START_TIME)
+    //Delete the roster assignment with specific uuid
+    rosterDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            ROSTER_TABLE_NAME, ROSTER_FIELD_UUID)
+    //Move the roster assignment with specific uuid to another user.
+    rosterUpdateUser = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2)
+                            WHERE %s=($3)`,
+                            ROSTER_TABLE_NAME, ROSTER_FIELD_USERID,
+                            ROSTER_FIELD_ASSIGN_TIME, ROSTER_FIELD_UUID)
+)
+
+//Translate roster assignment to DB row in table.
+func (asgn *sqlRosterAssignment)rosterToDBRowXlate() *dbRosterAssignment {
+    dbrow := new(dbRosterAssignment)
+    dbrow.Uuid = syncParam.UUIDtoString(asgn.uuid)
+    dbrow.ShiftUuid = syncParam.UUIDtoString(asgn.shiftUUID)
+    dbrow.OrgUuid = syncParam.UUIDtoString(asgn.orgUUID)
+    dbrow.Userid = asgn.userid
+    dbrow.AssignTime = asgn.assignTime.UTC()
+    return dbrow
+}
+
+//Translate DB roster row to roster assignment structure.
+func (asgn *sqlRosterAssignment)dbToRosterRowXlate(dbrow *dbRosterAssignment) {
+    asgn.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    asgn.shiftUUID = syncParam.StringtoUUID(dbrow.ShiftUuid)
+    asgn.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    asgn.userid = dbrow.Userid
+    asgn.assignTime = dbrow.AssignTime
+}
+
+//Translate a list of DB roster rows to roster assignments.
+func dbToRosterRowsXlate(rows []dbRosterAssignment) []RosterAssignment {
+    asgns := make([]RosterAssignment, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlRosterAssignment)
+        entry.dbToRosterRowXlate(&row)
+        asgns = append(asgns, entry.RosterAssignment)
+    }
+    return asgns
+}
+
+//Create a roster assignment entry. uuid and assignTime are self populated.
+//The shift must be present and not cancelled, and the user must be present
+// in the system.
+func (asgn *sqlRosterAssignment)createRosterEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create roster entry, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    if asgn.IsRosterAssignmentValid() == false {
+        log.Error("Cannot create roster entry, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    shift := new(sqlShift)
+    shift.uuid = asgn.shiftUUID
+    err = shift.getShiftByUUID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot create roster entry, shift %s not present",
+                 syncParam.UUIDtoString(asgn.shiftUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if shift.orgUUID != asgn.orgUUID || shift.IsCancelled() {
+        log.Info("Cannot assign %s to shift %s, org mismatch/cancelled shift",
+                 asgn.userid, syncParam.UUIDtoString(asgn.shiftUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    user := new(sqlUsers)
+    user.userid = asgn.userid
+    err = user.getUserwithID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot create roster entry, user %s not present",
+                 asgn.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    var row dbRosterAssignment
+    err = getPtr(&row, rosterGetonShiftUser,
+                 syncParam.UUIDtoString(asgn.shiftUUID), asgn.userid)
+    if err == nil {
+        log.Info("User %s is already assigned to shift %s", asgn.userid,
+                 syncParam.UUIDtoString(asgn.shiftUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    if err != sql.ErrNoRows {
+        return err
+    }
+    asgn.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create roster entry")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    asgn.assignTime = time.Now()
+    dbrow := asgn.rosterToDBRowXlate()
+    _, err = execPtr(rosterCreate, dbrow.Uuid, dbrow.ShiftUuid, dbrow.OrgUuid,
+                    dbrow.Userid, dbrow.AssignTime)
+    if err != nil {
+        log.Error("Failed to create roster entry for %s err : %s",
+                  asgn.userid, err)
+        return err
+    }
+    return shift.bumpShiftRevisionEntry(sqlds, handle, asgn.assignTime)
+}
+
+//Function to get the roster assignment with specific UUID.
+func (asgn *sqlRosterAssignment)getRosterByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get roster entry, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    var row dbRosterAssignment
+    err = getPtr(&row, rosterGetonUUID, syncParam.UUIDtoString(asgn.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read roster entry %s, err : %s",
+                  syncParam.UUIDtoString(asgn.uuid), err)
+        return err
+    }
+    asgn.dbToRosterRowXlate(&row)
+    return nil
+}
+
+//Function to get all roster assignments of shift 'shiftUUID'.
+func (asgn *sqlRosterAssignment)getRosterByShift(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     shiftUUID syncParam.UUID) (
+                                     []RosterAssignment, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list roster, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbRosterAssignment{}
+    err = selectPtr(&rows, rosterGetonShift,
+                    syncParam.UUIDtoString(shiftUUID))
+    if err != nil {
+        log.Trace("Failed to read roster of shift %s, err : %s",
+                  syncParam.UUIDtoString(shiftUUID), err)
+        return nil, err
+    }
+    return dbToRosterRowsXlate(rows), nil
+}
+
+//Function to get all roster assignments of user 'userid' for the shifts that
+// overlaps with time range [from, to).
+func (asgn *sqlRosterAssignment)getRosterByUserRange(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string,
+                                     from time.Time, to time.Time) (
+                                     []RosterAssignment, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list roster, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbRosterAssignment{}
+    err = selectPtr(&rows, rosterGetonUserRange, userid, from.UTC(),
+                    to.UTC())
+    if err != nil {
+        log.Trace("Failed to read roster of user %s, err : %s", userid, err)
+        return nil, err
+    }
+    return dbToRosterRowsXlate(rows), nil
+}
+
+//Function to delete the roster assignment with specific UUID.
+func (asgn *sqlRosterAssignment)deleteRosterEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete roster entry, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    getPtr, _ := sqlds.getDBGetFunction(handle)
+    var row dbRosterAssignment
+    err = getPtr(&row, rosterGetonUUID, syncParam.UUIDtoString(asgn.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Info("Failed to read roster entry %s, err : %s",
+                 syncParam.UUIDtoString(asgn.uuid), err)
+        return err
+    }
+    asgn.dbToRosterRowXlate(&row)
+    _, err = execPtr(rosterDelete, syncParam.UUIDtoString(asgn.uuid))
+    if err != nil {
+        log.Info("Failed to delete roster entry %s, err : %s",
+                 syncParam.UUIDtoString(asgn.uuid), err)
+        return err
+    }
+    shift := new(sqlShift)
+    shift.uuid = asgn.shiftUUID
+    return shift.bumpShiftRevisionEntry(sqlds, handle, time.Now())
+}
+
+//Function to move the roster assignment to user 'userid', assignTime is
+// updated to the time of move.
+func (asgn *sqlRosterAssignment)transferRosterEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to move roster entry, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    assignTime := time.Now()
+    _, err = execPtr(rosterUpdateUser, userid, assignTime.UTC(),
+                     syncParam.UUIDtoString(asgn.uuid))
+    if err != nil {
+        log.Error("Failed to move roster entry %s to %s, err : %s",
+                  syncParam.UUIDtoString(asgn.uuid), userid, err)
+        return err
+    }
+    asgn.userid = userid
+    asgn.assignTime = assignTime
+    shift := new(sqlShift)
+    shift.uuid = asgn.shiftUUID
+    return shift.bumpShiftRevisionEntry(sqlds, handle, assignTime)
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of session table. Used only for SQLX operations.
+// It has a direct 1:1 mapping to 'Session' structure.
+type dbSession struct {
+    Uuid string `db:"uuid"`
+    Userid string `db:"userid"`
+    RefreshHash string `db:"refreshhash"`
+    CreateTime time.Time `db:"createtime"`
+    ExpiryTime time.Time `db:"expirytime"`
+    Status uint64 `db:"status"`
+}
+
+// SQL representation for session.
+type sqlSession struct {
+    Session
+}
+
+//String representation of session table and its elements.
+const (
+    SESSION_HASH_LEN = 64
+    SESSION_TABLE_NAME = "sessions"
+    SESSION_FIELD_UUID = "uuid"
+    SESSION_FIELD_USERID = "userid"
+    SESSION_FIELD_REFRESH_HASH = "refreshhash"
+    SESSION_FIELD_CREATE_TIME = "createtime"
+    SESSION_FIELD_EXPIRY_TIME = "expirytime"
+    SESSION_FIELD_STATUS = "status"
+)
+
+// SQL statements to be used to operate on session table.
+var (
+    //Create a table sessions, sessions of a user are removed with the user.
+    sessionSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s char(%d) NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0));`,
+                     SESSION_TABLE_NAME,
+                     SESSION_FIELD_UUID,
+                     SESSION_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SESSION_FIELD_REFRESH_HASH, SESSION_HASH_LEN,
+                     SESSION_FIELD_CREATE_TIME,
+                     SESSION_FIELD_EXPIRY_TIME,
+                     SESSION_FIELD_STATUS, SESSION_FIELD_STATUS)
+    //Index to find the sessions of a user.
+    sessionUserIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s)`,
+                            SESSION_TABLE_NAME, SESSION_FIELD_USERID,
+                            SESSION_TABLE_NAME, SESSION_FIELD_USERID)
+    //Create a session entry.
+    sessionCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6)`,
+                            SESSION_TABLE_NAME,
+                            SESSION_FIELD_UUID, SESSION_FIELD_USERID,
+                            SESSION_FIELD_REFRESH_HASH,
+                            SESSION_FIELD_CREATE_TIME,
+                            SESSION_FIELD_EXPIRY_TIME, SESSION_FIELD_STATUS)
+    //Get the session with specific uuid
+    sessionGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            SESSION_TABLE_NAME, SESSION_FIELD_UUID)
+    //Replace the refresh hash of an active session, only when the current
+    // hash is matching.
+    sessionRotate = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2)
+                            WHERE %s=($3) AND %s=($4) AND %s=($5)`,
+                            SESSION_TABLE_NAME,
+                            SESSION_FIELD_REFRESH_HASH,
+                            SESSION_FIELD_EXPIRY_TIME,
+                            SESSION_FIELD_UUID, SESSION_FIELD_REFRESH_HASH,
+                            SESSION_FIELD_STATUS)
+    //Revoke the session with specific uuid
+    sessionRevoke = fmt.Sprintf("UPDATE %s SET %s=($1) WHERE %s=($2)",
+                            SESSION_TABLE_NAME, SESSION_FIELD_STATUS,
+                            SESSION_FIELD_UUID)
+    //Revoke all the sessions of a user
+    sessionRevokeonUser = fmt.Sprintf("UPDATE %s SET %s=($1) WHERE %s=($2)",
+                            SESSION_TABLE_NAME, SESSION_FIELD_STATUS,
+                            SESSION_FIELD_USERID)
+    //Delete the sessions expired before a time
+    sessionDeleteExpired = fmt.Sprintf("DELETE FROM %s WHERE %s < ($1)",
+                            SESSION_TABLE_NAME, SESSION_FIELD_EXPIRY_TIME)
+)
+
+//Translate session to DB row in table.
+func (sess *sqlSession)sessionToDBRowXlate() *dbSession {
+    dbrow := new(dbSession)
+    dbrow.Uuid = syncParam.UUIDtoString(sess.uuid)
+    dbrow.Userid = sess.userid
+    dbrow.RefreshHash = sess.refreshHash
+    dbrow.CreateTime = sess.createTime.UTC()
+    dbrow.ExpiryTime = sess.expiryTime.UTC()
+    dbrow.Status = uint64(sess.status)
+    return dbrow
+}
+
+//Translate DB session row to session structure.
+func (sess *sqlSession)dbToSessionRowXlate(dbrow *dbSession) {
+    sess.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    sess.userid = dbrow.Userid
+    sess.refreshHash = dbrow.RefreshHash
+    sess.createTime = dbrow.CreateTime
+    sess.expiryTime = dbrow.ExpiryTime
+    sess.status = SessionStatusBit(dbrow.Status)
+}
+
+//Create a session entry. uuid and createTime are self populated.
+//The user must be present in the system.
+func (sess *sqlSession)createSessionEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create session, invalid DB handle err : %s", err)
+        return err
+    }
+    if sess.IsSessionValid() == false {
+        log.Error("Cannot create session, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    user := new(sqlUsers)
+    user.userid = sess.userid
+    err = user.getUserwithID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot create session, user %s not present", sess.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    sess.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create session")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    sess.createTime = time.Now()
+    dbrow := sess.sessionToDBRowXlate()
+    _, err = execPtr(sessionCreate, dbrow.Uuid, dbrow.Userid,
+                     dbrow.RefreshHash, dbrow.CreateTime, dbrow.ExpiryTime,
+                     dbrow.Status)
+    if err != nil {
+        log.Error("Failed to create session for %s err : %s", sess.userid,
+                  err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the session with specific UUID.
+func (sess *sqlSession)getSessionByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get session, invalid DB handle err : %s", err)
+        return err
+    }
+    var row dbSession
+    err = getPtr(&row, sessionGetonUUID, syncParam.UUIDtoString(sess.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read session %s, err : %s",
+                  syncParam.UUIDtoString(sess.uuid), err)
+        return err
+    }
+    sess.dbToSessionRowXlate(&row)
+    return nil
+}
+
+//Function to replace the refresh hash and expiry of an active session. The
+// session is not updated when the current hash is not 'oldHash'.
+func (sess *sqlSession)rotateSessionEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     oldHash string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to rotate session, invalid DB handle err : %s", err)
+        return err
+    }
+    if len(sess.refreshHash) == 0 || sess.expiryTime.IsZero() {
+        log.Error("Cannot rotate session, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    dbrow := sess.sessionToDBRowXlate()
+    res, err := execPtr(sessionRotate, dbrow.RefreshHash, dbrow.ExpiryTime,
+                        dbrow.Uuid, oldHash, uint64(SESSION_ACTIVE))
+    if err != nil {
+        log.Info("Failed to rotate session %s, err : %s", dbrow.Uuid, err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        log.Info("Cannot rotate session %s, not present/active", dbrow.Uuid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Function to revoke the session with specific UUID.
+func (sess *sqlSession)revokeSessionEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to revoke session, invalid DB handle err : %s", err)
+        return err
+    }
+    uuidStr := syncParam.UUIDtoString(sess.uuid)
+    res, err := execPtr(sessionRevoke, uint64(SESSION_REVOKED), uuidStr)
+    if err != nil {
+        log.Info("Failed to revoke session %s, err : %s", uuidStr, err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    sess.status = SESSION_REVOKED
+    return nil
+}
+
+//Function to revoke all the sessions of user 'userid'.
+func (sess *sqlSession)revokeUserSessions(sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to revoke sessions, invalid DB handle err : %s", err)
+        return err
+    }
+    _, err = execPtr(sessionRevokeonUser, uint64(SESSION_REVOKED), userid)
+    if err != nil {
+        log.Info("Failed to revoke sessions of %s, err : %s", userid, err)
+        return err
+    }
+    return nil
+}
+
+//Function to delete the sessions expired before 'before'.
+func (sess *sqlSession)deleteExpiredSessions(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     before time.Time) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete sessions, invalid DB handle err : %s", err)
+        return err
+    }
+    _, err = execPtr(sessionDeleteExpired, before.UTC())
+    if err != nil {
+        log.Info("Failed to delete expired sessions, err : %s", err)
+        return err
+    }
+    return nil
+}
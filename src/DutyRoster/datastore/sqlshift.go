@@ -0,0 +1,692 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of shift template table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'ShiftTemplate' structure.
+type dbShiftTemplate struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    Name string `db:"name"`
+    StartOffset int64 `db:"startoffset"` //Offset in seconds.
+    Duration int64 `db:"duration"` //Duration in seconds.
+    Weekdays uint64 `db:"weekdays"`
+    MinStaff uint64 `db:"minstaff"`
+    Owner sql.NullString `db:"owner"`
+}
+
+//The db representation of shift table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'Shift' structure.
+type dbShift struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    TemplateUuid sql.NullString `db:"templateuuid"`
+    StartTime time.Time `db:"starttime"`
+    EndTime time.Time `db:"endtime"`
+    MinStaff uint64 `db:"minstaff"`
+    Status uint64 `db:"status"`
+    Owner sql.NullString `db:"owner"`
+    CreateTime time.Time `db:"createtime"`
+    //Revision of the shift from table shiftrevisions, NULL until the first
+    // change to the shift.
+    Sequence sql.NullInt64 `db:"sequence"`
+    ModifyTime sql.NullTime `db:"modifytime"`
+}
+
+// SQL representation for shift template.
+type sqlShiftTemplate struct {
+    ShiftTemplate
+}
+
+// SQL representation for shift.
+type sqlShift struct {
+    Shift
+}
+
+//String representation of shift template and shift tables and its elements.
+//Update the string reperesentation when make any change to the structs.
+const (
+    SHIFT_NAME_STR_LEN = 500
+    SHIFT_TEMPLATE_TABLE_NAME = "shifttemplates"
+    SHIFT_TEMPLATE_FIELD_UUID = "uuid"
+    SHIFT_TEMPLATE_FIELD_ORGUUID = "orguuid"
+    SHIFT_TEMPLATE_FIELD_NAME = "name"
+    SHIFT_TEMPLATE_FIELD_START_OFFSET = "startoffset"
+    SHIFT_TEMPLATE_FIELD_DURATION = "duration"
+    SHIFT_TEMPLATE_FIELD_WEEKDAYS = "weekdays"
+    SHIFT_TEMPLATE_FIELD_MINSTAFF = "minstaff"
+    SHIFT_TEMPLATE_FIELD_OWNER = "owner"
+
+    SHIFT_TABLE_NAME = "shifts"
+    SHIFT_FIELD_UUID = "uuid"
+    SHIFT_FIELD_ORGUUID = "orguuid"
+    SHIFT_FIELD_TEMPLATEUUID = "templateuuid"
+    SHIFT_FIELD_START_TIME = "starttime"
+    SHIFT_FIELD_END_TIME = "endtime"
+    SHIFT_FIELD_MINSTAFF = "minstaff"
+    SHIFT_FIELD_STATUS = "status"
+    SHIFT_FIELD_OWNER = "owner"
+    SHIFT_FIELD_CREATE_TIME = "createtime"
+
+    SHIFT_REVISION_TABLE_NAME = "shiftrevisions"
+    SHIFT_REVISION_FIELD_SHIFTUUID = "shiftuuid"
+    SHIFT_REVISION_FIELD_SEQUENCE = "sequence"
+    SHIFT_REVISION_FIELD_MODIFY_TIME = "modifytime"
+)
+
+// SQL statements to be used to operate on shift template and shift tables.
+var (
+    //Create a table shifttemplates
+    shiftTemplateSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL,
+                     %s bigint NOT NULL,
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL);`,
+                     SHIFT_TEMPLATE_TABLE_NAME,
+                     SHIFT_TEMPLATE_FIELD_UUID,
+                     SHIFT_TEMPLATE_FIELD_ORGUUID,
+                     ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SHIFT_TEMPLATE_FIELD_NAME, SHIFT_NAME_STR_LEN,
+                     SHIFT_TEMPLATE_FIELD_START_OFFSET,
+                     SHIFT_TEMPLATE_FIELD_START_OFFSET,
+                     SHIFT_TEMPLATE_FIELD_DURATION,
+                     SHIFT_TEMPLATE_FIELD_DURATION,
+                     SHIFT_TEMPLATE_FIELD_WEEKDAYS,
+                     SHIFT_TEMPLATE_FIELD_MINSTAFF,
+                     SHIFT_TEMPLATE_FIELD_OWNER, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID)
+    //Create a shift template entry in table shifttemplates
+    shiftTemplateCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+                            SHIFT_TEMPLATE_TABLE_NAME,
+                            SHIFT_TEMPLATE_FIELD_UUID,
+                            SHIFT_TEMPLATE_FIELD_ORGUUID,
+                            SHIFT_TEMPLATE_FIELD_NAME,
+                            SHIFT_TEMPLATE_FIELD_START_OFFSET,
+                            SHIFT_TEMPLATE_FIELD_DURATION,
+                            SHIFT_TEMPLATE_FIELD_WEEKDAYS,
+                            SHIFT_TEMPLATE_FIELD_MINSTAFF,
+                            SHIFT_TEMPLATE_FIELD_OWNER)
+    //Get the shift template with specific uuid
+    shiftTemplateGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            SHIFT_TEMPLATE_TABLE_NAME,
+                            SHIFT_TEMPLATE_FIELD_UUID)
+    //Get all the shift templates of a org/unit.
+    shiftTemplateGetonOrg = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s, %s`,
+                            SHIFT_TEMPLATE_TABLE_NAME,
+                            SHIFT_TEMPLATE_FIELD_ORGUUID,
+                            SHIFT_TEMPLATE_FIELD_START_OFFSET,
+                            SHIFT_TEMPLATE_FIELD_NAME)
+    //Delete shift template with specific uuid
+    shiftTemplateDelete = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
+                            SHIFT_TEMPLATE_TABLE_NAME,
+                            SHIFT_TEMPLATE_FIELD_UUID)
+
+    //Create a table shifts
+    shiftSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s UUID NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NOT NULL,
+                     %s timestamp NOT NULL CHECK(%s > %s),
+                     %s bigint NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NOT NULL);`,
+                     SHIFT_TABLE_NAME,
+                     SHIFT_FIELD_UUID,
+                     SHIFT_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SHIFT_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     SHIFT_FIELD_START_TIME,
+                     SHIFT_FIELD_END_TIME, SHIFT_FIELD_END_TIME,
+                     SHIFT_FIELD_START_TIME,
+                     SHIFT_FIELD_MINSTAFF,
+                     SHIFT_FIELD_STATUS, SHIFT_FIELD_STATUS,
+                     SHIFT_FIELD_OWNER, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SHIFT_FIELD_CREATE_TIME)
+    //Create a shift entry in table shifts
+    shiftCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+                            SHIFT_TABLE_NAME,
+                            SHIFT_FIELD_UUID, SHIFT_FIELD_ORGUUID,
+                            SHIFT_FIELD_TEMPLATEUUID, SHIFT_FIELD_START_TIME,
+                            SHIFT_FIELD_END_TIME, SHIFT_FIELD_MINSTAFF,
+                            SHIFT_FIELD_STATUS, SHIFT_FIELD_OWNER,
+                            SHIFT_FIELD_CREATE_TIME)
+    //Select the shifts along with their revision.
+    shiftSelect = fmt.Sprintf(`SELECT s.*, r.%s, r.%s FROM %s s
+                            LEFT JOIN %s r ON r.%s = s.%s`,
+                            SHIFT_REVISION_FIELD_SEQUENCE,
+                            SHIFT_REVISION_FIELD_MODIFY_TIME,
+                            SHIFT_TABLE_NAME, SHIFT_REVISION_TABLE_NAME,
+                            SHIFT_REVISION_FIELD_SHIFTUUID, SHIFT_FIELD_UUID)
+    //Get the shift with specific uuid
+    shiftGetonUUID = fmt.Sprintf(`%s WHERE s.%s=($1)`,
+                            shiftSelect, SHIFT_FIELD_UUID)
+    //Get the shifts of a org/unit that overlaps with a time range.
+    shiftGetonOrgRange = fmt.Sprintf(`%s WHERE s.%s=($1) AND
+                            s.%s > ($2) AND s.%s < ($3) ORDER BY s.%s`,
+                            shiftSelect, SHIFT_FIELD_ORGUUID,
+                            SHIFT_FIELD_END_TIME, SHIFT_FIELD_START_TIME,
+                            SHIFT_FIELD_START_TIME)
+    //Get the shifts of a user in the roster that overlaps with a time range.
+    shiftGetonUserRange = fmt.Sprintf(`%s INNER JOIN %s a ON a.%s = s.%s
+                            WHERE a.%s=($1) AND s.%s > ($2) AND s.%s < ($3)
+                            ORDER BY s.%s`,
+                            shiftSelect, ROSTER_TABLE_NAME,
+                            ROSTER_FIELD_SHIFTUUID, SHIFT_FIELD_UUID,
+                            ROSTER_FIELD_USERID, SHIFT_FIELD_END_TIME,
+                            SHIFT_FIELD_START_TIME, SHIFT_FIELD_START_TIME)
+    //Update the status of a shift with specific uuid
+    shiftUpdateStatus = fmt.Sprintf(`UPDATE %s SET %s=($1) WHERE %s=($2)`,
+                            SHIFT_TABLE_NAME, SHIFT_FIELD_STATUS,
+                            SHIFT_FIELD_UUID)
+    //Update the times, minimum staff and status of a shift with specific uuid
+    shiftUpdate = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2), %s=($3),
+                            %s=($4) WHERE %s=($5)`,
+                            SHIFT_TABLE_NAME, SHIFT_FIELD_START_TIME,
+                            SHIFT_FIELD_END_TIME, SHIFT_FIELD_MINSTAFF,
+                            SHIFT_FIELD_STATUS, SHIFT_FIELD_UUID)
+
+    //Create a table shiftrevisions, a shift has no row until its first
+    // change.
+    shiftRevisionSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s timestamp NOT NULL);`,
+                     SHIFT_REVISION_TABLE_NAME,
+                     SHIFT_REVISION_FIELD_SHIFTUUID,
+                     SHIFT_TABLE_NAME, SHIFT_FIELD_UUID,
+                     SHIFT_REVISION_FIELD_SEQUENCE,
+                     SHIFT_REVISION_FIELD_SEQUENCE,
+                     SHIFT_REVISION_FIELD_MODIFY_TIME)
+    //Move the shift with specific uuid to its next revision.
+    shiftRevisionBump = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s)
+                            VALUES ($1, 1, $2) ON CONFLICT (%s)
+                            DO UPDATE SET %s = %s.%s + 1, %s = EXCLUDED.%s`,
+                            SHIFT_REVISION_TABLE_NAME,
+                            SHIFT_REVISION_FIELD_SHIFTUUID,
+                            SHIFT_REVISION_FIELD_SEQUENCE,
+                            SHIFT_REVISION_FIELD_MODIFY_TIME,
+                            SHIFT_REVISION_FIELD_SHIFTUUID,
+                            SHIFT_REVISION_FIELD_SEQUENCE,
+                            SHIFT_REVISION_TABLE_NAME,
+                            SHIFT_REVISION_FIELD_SEQUENCE,
+                            SHIFT_REVISION_FIELD_MODIFY_TIME,
+                            SHIFT_REVISION_FIELD_MODIFY_TIME)
+)
+
+//Translate shift template to DB row in table.
+func (tmpl *sqlShiftTemplate)shiftTemplateToDBRowXlate() *dbShiftTemplate {
+    dbrow := new(dbShiftTemplate)
+    dbrow.Uuid = syncParam.UUIDtoString(tmpl.uuid)
+    dbrow.OrgUuid = syncParam.UUIDtoString(tmpl.orgUUID)
+    dbrow.Name = tmpl.name
+    dbrow.StartOffset = int64(tmpl.startOffset / time.Second)
+    dbrow.Duration = int64(tmpl.duration / time.Second)
+    dbrow.Weekdays = tmpl.weekdays
+    dbrow.MinStaff = tmpl.minStaff
+    dbrow.Owner.Scan(tmpl.owner)
+    return dbrow
+}
+
+//Translate DB shift template row to shift template structure.
+func (tmpl *sqlShiftTemplate)dbToShiftTemplateRowXlate(
+                                     dbrow *dbShiftTemplate) {
+    tmpl.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    tmpl.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    tmpl.name = dbrow.Name
+    tmpl.startOffset = time.Duration(dbrow.StartOffset) * time.Second
+    tmpl.duration = time.Duration(dbrow.Duration) * time.Second
+    tmpl.weekdays = dbrow.Weekdays
+    tmpl.minStaff = dbrow.MinStaff
+    tmpl.owner = ""
+    if dbrow.Owner.Valid {
+        tmpl.owner = dbrow.Owner.String
+    }
+}
+
+//Create a shift template entry in table. uuid is self populated.
+func (tmpl *sqlShiftTemplate)createShiftTemplateEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error(`Failed to create shift template %s, invalid DB handle
+                  err : %s`, tmpl.name, err)
+        return err
+    }
+    if len(tmpl.name) >= SHIFT_NAME_STR_LEN ||
+        tmpl.IsShiftTemplateValid() == false {
+        log.Error("Cannot create shift template %s, invalid params",
+                  tmpl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = tmpl.orgUUID
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Cannot create shift template %s, org not present",
+                 tmpl.name)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    tmpl.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create shift template %s",
+                  tmpl.name)
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    dbrow := tmpl.shiftTemplateToDBRowXlate()
+    _, err = execPtr(shiftTemplateCreate, dbrow.Uuid, dbrow.OrgUuid,
+                    dbrow.Name, dbrow.StartOffset, dbrow.Duration,
+                    dbrow.Weekdays, dbrow.MinStaff, dbrow.Owner)
+    if err != nil {
+        log.Error("Failed to create shift template %s err : %s", tmpl.name,
+                  err)
+        return err
+    }
+    return setTemplateSkills(sqlds, handle, tmpl.uuid, tmpl.skills)
+}
+
+//Function to get shift template with specific UUID.
+func (tmpl *sqlShiftTemplate)getShiftTemplateByUUID(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get shift template, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    if syncParam.IsUUIDEmpty(tmpl.uuid) {
+        log.Trace("Empty shift template UUID, cannot find in table")
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    var row dbShiftTemplate
+    err = getPtr(&row, shiftTemplateGetonUUID,
+                 syncParam.UUIDtoString(tmpl.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read shift template %s, err : %s",
+                  syncParam.UUIDtoString(tmpl.uuid), err)
+        return err
+    }
+    tmpl.dbToShiftTemplateRowXlate(&row)
+    tmpl.skills, err = getTemplateSkills(sqlds, handle, tmpl.uuid)
+    return err
+}
+
+//Function to get all the shift templates of org/unit 'orgUUID'
+func (tmpl *sqlShiftTemplate)getShiftTemplatesByOrg(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID) (
+                                     []ShiftTemplate, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list shift templates, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbShiftTemplate{}
+    err = selectPtr(&rows, shiftTemplateGetonOrg,
+                    syncParam.UUIDtoString(orgUUID))
+    if err != nil {
+        log.Trace("Failed to read shift templates of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    tmpls := make([]ShiftTemplate, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlShiftTemplate)
+        entry.dbToShiftTemplateRowXlate(&row)
+        entry.skills, err = getTemplateSkills(sqlds, handle, entry.uuid)
+        if err != nil {
+            return nil, err
+        }
+        tmpls = append(tmpls, entry.ShiftTemplate)
+    }
+    return tmpls, nil
+}
+
+//Function to delete shift template with specific UUID.
+//The shifts generated from the template are not deleted.
+func (tmpl *sqlShiftTemplate)deleteShiftTemplateEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error(`Failed to delete shift template, invalid DB handle
+                  err : %s`, err)
+        return err
+    }
+    err = tmpl.getShiftTemplateByUUID(sqlds, handle)
+    if err != nil {
+        log.Info("Failed to delete shift template, cannot find record %s",
+                 err)
+        return err
+    }
+    _, err = execPtr(shiftTemplateDelete, syncParam.UUIDtoString(tmpl.uuid))
+    if err != nil {
+        log.Info("Failed to delete shift template %s, err : %s", tmpl.name,
+                 err)
+        return err
+    }
+    return nil
+}
+
+//Translate shift to DB row in table.
+func (sh *sqlShift)shiftToDBRowXlate() *dbShift {
+    dbrow := new(dbShift)
+    dbrow.Uuid = syncParam.UUIDtoString(sh.uuid)
+    dbrow.OrgUuid = syncParam.UUIDtoString(sh.orgUUID)
+    dbrow.TemplateUuid.Scan(nil)
+    if !syncParam.IsUUIDEmpty(sh.templateUUID) {
+        dbrow.TemplateUuid.Scan(syncParam.UUIDtoString(sh.templateUUID))
+    }
+    dbrow.StartTime = sh.startTime.UTC()
+    dbrow.EndTime = sh.endTime.UTC()
+    dbrow.MinStaff = sh.minStaff
+    dbrow.Status = uint64(sh.status)
+    dbrow.Owner.Scan(sh.owner)
+    dbrow.CreateTime = sh.createTime.UTC()
+    return dbrow
+}
+
+//Translate DB shift row to shift structure.
+func (sh *sqlShift)dbToShiftRowXlate(dbrow *dbShift) {
+    sh.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    sh.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    sh.templateUUID = syncParam.UUID{}
+    if dbrow.TemplateUuid.Valid {
+        sh.templateUUID = syncParam.StringtoUUID(dbrow.TemplateUuid.String)
+    }
+    sh.startTime = dbrow.StartTime
+    sh.endTime = dbrow.EndTime
+    sh.minStaff = dbrow.MinStaff
+    sh.status = ShiftStatusBit(dbrow.Status)
+    sh.owner = ""
+    if dbrow.Owner.Valid {
+        sh.owner = dbrow.Owner.String
+    }
+    sh.createTime = dbrow.CreateTime
+    sh.sequence = 0
+    sh.modifyTime = dbrow.CreateTime
+    if dbrow.Sequence.Valid && dbrow.ModifyTime.Valid {
+        sh.sequence = uint64(dbrow.Sequence.Int64)
+        sh.modifyTime = dbrow.ModifyTime.Time
+    }
+}
+
+//Create a shift entry in table. uuid and createTime are self populated.
+func (sh *sqlShift)createShiftEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create shift, invalid DB handle err : %s", err)
+        return err
+    }
+    if sh.IsShiftValid() == false {
+        log.Error("Cannot create shift, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = sh.orgUUID
+    res, err := orgrow.isOrgEntryPresentInTable(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if res == false {
+        log.Info("Cannot create shift, org %s not present",
+                 syncParam.UUIDtoString(sh.orgUUID))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    if !syncParam.IsUUIDEmpty(sh.templateUUID) {
+        tmpl := new(sqlShiftTemplate)
+        tmpl.uuid = sh.templateUUID
+        err = tmpl.getShiftTemplateByUUID(sqlds, handle)
+        if err != nil {
+            log.Info("Cannot create shift, template %s not present",
+                     syncParam.UUIDtoString(sh.templateUUID))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+        }
+    }
+    sh.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create shift")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    sh.createTime = time.Now()
+    sh.sequence = 0
+    sh.modifyTime = sh.createTime
+    dbrow := sh.shiftToDBRowXlate()
+    _, err = execPtr(shiftCreate, dbrow.Uuid, dbrow.OrgUuid,
+                    dbrow.TemplateUuid, dbrow.StartTime, dbrow.EndTime,
+                    dbrow.MinStaff, dbrow.Status, dbrow.Owner,
+                    dbrow.CreateTime)
+    if err != nil {
+        log.Error("Failed to create shift record err : %s", err)
+        return err
+    }
+    return nil
+}
+
+//Function to get shift with specific UUID.
+func (sh *sqlShift)getShiftByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get shift, invalid DB handle err : %s", err)
+        return err
+    }
+    if syncParam.IsUUIDEmpty(sh.uuid) {
+        log.Trace("Empty shift UUID, cannot find in shift table")
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    var row dbShift
+    err = getPtr(&row, shiftGetonUUID, syncParam.UUIDtoString(sh.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read shift %s, err : %s",
+                  syncParam.UUIDtoString(sh.uuid), err)
+        return err
+    }
+    sh.dbToShiftRowXlate(&row)
+    return nil
+}
+
+//Function to get all shifts of org/unit 'orgUUID' that overlaps the time
+// range [from, to). Cancelled shifts are returned as well.
+func (sh *sqlShift)getShiftsByOrgRange(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID,
+                                     from time.Time,
+                                     to time.Time) ([]Shift, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list shifts, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbShift{}
+    err = selectPtr(&rows, shiftGetonOrgRange,
+                    syncParam.UUIDtoString(orgUUID), from.UTC(), to.UTC())
+    if err != nil {
+        log.Trace("Failed to read shifts of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    shifts := make([]Shift, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlShift)
+        entry.dbToShiftRowXlate(&row)
+        shifts = append(shifts, entry.Shift)
+    }
+    return shifts, nil
+}
+
+//Function to cancel a shift with specific UUID. The shift record is kept in
+// the table with the cancelled status, so that the roster history is intact.
+func (sh *sqlShift)cancelShiftEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to cancel shift, invalid DB handle err : %s", err)
+        return err
+    }
+    err = sh.getShiftByUUID(sqlds, handle)
+    if err != nil {
+        log.Info("Failed to cancel shift, cannot find record %s", err)
+        return err
+    }
+    if sh.IsCancelled() {
+        log.Trace("Shift %s is already cancelled",
+                  syncParam.UUIDtoString(sh.uuid))
+        return nil
+    }
+    sh.status |= SHIFT_CANCELLED
+    _, err = execPtr(shiftUpdateStatus, uint64(sh.status),
+                    syncParam.UUIDtoString(sh.uuid))
+    if err != nil {
+        log.Info("Failed to cancel shift %s, err : %s",
+                 syncParam.UUIDtoString(sh.uuid), err)
+        return err
+    }
+    return sh.bumpShiftRevisionEntry(sqlds, handle, time.Now())
+}
+
+//Function to get the shifts that user 'userid' is assigned to in the roster,
+// that overlaps the time range [from, to). Cancelled shifts are returned as
+// well.
+func (sh *sqlShift)getShiftsByUserRange(sqlds *postgreSqlDataStore,
+                                     handle interface{}, userid string,
+                                     from time.Time,
+                                     to time.Time) ([]Shift, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list shifts, invalid DB handle err : %s", err)
+        return nil, err
+    }
+    rows := []dbShift{}
+    err = selectPtr(&rows, shiftGetonUserRange, userid, from.UTC(), to.UTC())
+    if err != nil {
+        log.Trace("Failed to read shifts of user %s, err : %s", userid, err)
+        return nil, err
+    }
+    shifts := make([]Shift, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlShift)
+        entry.dbToShiftRowXlate(&row)
+        shifts = append(shifts, entry.Shift)
+    }
+    return shifts, nil
+}
+
+//Function to move the shift with specific UUID to its next revision, called
+// on every change to the shift or its roster.
+func (sh *sqlShift)bumpShiftRevisionEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     now time.Time) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update shift revision, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    _, err = execPtr(shiftRevisionBump, syncParam.UUIDtoString(sh.uuid),
+                     now.UTC())
+    if err != nil {
+        log.Info("Failed to update revision of shift %s, err : %s",
+                 syncParam.UUIDtoString(sh.uuid), err)
+        return err
+    }
+    sh.bumpRevision(now)
+    return nil
+}
+
+//Function to write the times, minimum staff and status of the shift with
+// specific UUID, the shift is moved to its next revision.
+func (sh *sqlShift)updateShiftEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     now time.Time) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update shift, invalid DB handle err : %s", err)
+        return err
+    }
+    if sh.IsShiftValid() == false {
+        log.Error("Cannot update shift %s, invalid params",
+                  syncParam.UUIDtoString(sh.uuid))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    _, err = execPtr(shiftUpdate, sh.startTime.UTC(), sh.endTime.UTC(),
+                     sh.minStaff, uint64(sh.status),
+                     syncParam.UUIDtoString(sh.uuid))
+    if err != nil {
+        log.Info("Failed to update shift %s, err : %s",
+                 syncParam.UUIDtoString(sh.uuid), err)
+        return err
+    }
+    return sh.bumpShiftRevisionEntry(sqlds, handle, now)
+}
@@ -0,0 +1,466 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "sort"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of user skill table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'UserSkill' structure.
+type dbUserSkill struct {
+    Userid string `db:"userid"`
+    Name string `db:"name"`
+    Kind uint64 `db:"kind"`
+    ValidFrom sql.NullTime `db:"validfrom"`
+    ExpiryTime sql.NullTime `db:"expirytime"`
+    ModifyTime time.Time `db:"modifytime"`
+}
+
+// SQL representation for user skill.
+type sqlUserSkill struct {
+    UserSkill
+}
+
+//String representation of skill tables and their elements.
+const (
+    USER_SKILL_TABLE_NAME = "userskills"
+    USER_SKILL_FIELD_USERID = "userid"
+    USER_SKILL_FIELD_NAME = "name"
+    USER_SKILL_FIELD_KIND = "kind"
+    USER_SKILL_FIELD_VALID_FROM = "validfrom"
+    USER_SKILL_FIELD_EXPIRY_TIME = "expirytime"
+    USER_SKILL_FIELD_MODIFY_TIME = "modifytime"
+
+    TEMPLATE_SKILL_TABLE_NAME = "templateskills"
+    TEMPLATE_SKILL_FIELD_TEMPLATEUUID = "templateuuid"
+    TEMPLATE_SKILL_FIELD_SKILL = "skill"
+)
+
+// SQL statements to be used to operate on skill tables.
+var (
+    //Create a table userskills, skills are removed with the user.
+    userSkillSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s timestamptz NULL,
+                     %s timestamptz NULL,
+                     %s timestamptz NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     USER_SKILL_TABLE_NAME,
+                     USER_SKILL_FIELD_USERID, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     USER_SKILL_FIELD_NAME, SKILL_NAME_STR_LEN,
+                     USER_SKILL_FIELD_KIND, USER_SKILL_FIELD_KIND,
+                     USER_SKILL_FIELD_VALID_FROM,
+                     USER_SKILL_FIELD_EXPIRY_TIME,
+                     USER_SKILL_FIELD_MODIFY_TIME,
+                     USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME)
+    //Index to find the skills that expire in a range.
+    userSkillExpiryIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s)`,
+                            USER_SKILL_TABLE_NAME,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_TABLE_NAME,
+                            USER_SKILL_FIELD_EXPIRY_TIME)
+    //Create a table templateskills, the skills required by a shift template.
+    templateSkillSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL,
+                     PRIMARY KEY (%s, %s));`,
+                     TEMPLATE_SKILL_TABLE_NAME,
+                     TEMPLATE_SKILL_FIELD_TEMPLATEUUID,
+                     SHIFT_TEMPLATE_TABLE_NAME, SHIFT_TEMPLATE_FIELD_UUID,
+                     TEMPLATE_SKILL_FIELD_SKILL, SKILL_NAME_STR_LEN,
+                     TEMPLATE_SKILL_FIELD_TEMPLATEUUID,
+                     TEMPLATE_SKILL_FIELD_SKILL)
+    //Create or replace the skill of a user.
+    userSkillUpsert = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6)
+                            ON CONFLICT (%s, %s) DO UPDATE SET
+                            %s=excluded.%s, %s=excluded.%s, %s=excluded.%s,
+                            %s=excluded.%s`,
+                            USER_SKILL_TABLE_NAME,
+                            USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME,
+                            USER_SKILL_FIELD_KIND,
+                            USER_SKILL_FIELD_VALID_FROM,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_FIELD_MODIFY_TIME,
+                            USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME,
+                            USER_SKILL_FIELD_KIND, USER_SKILL_FIELD_KIND,
+                            USER_SKILL_FIELD_VALID_FROM,
+                            USER_SKILL_FIELD_VALID_FROM,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_FIELD_MODIFY_TIME,
+                            USER_SKILL_FIELD_MODIFY_TIME)
+    //Get the skill of a user with specific name.
+    userSkillGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1) AND %s=($2)`,
+                            USER_SKILL_TABLE_NAME,
+                            USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME)
+    //Get all the skills of a user.
+    userSkillGetonUser = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            USER_SKILL_TABLE_NAME, USER_SKILL_FIELD_USERID,
+                            USER_SKILL_FIELD_NAME)
+    //Get the skills that expire in the range [$1, $2).
+    userSkillGetonExpiry = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s >= ($1) AND %s < ($2)
+                            ORDER BY %s, %s, %s`,
+                            USER_SKILL_TABLE_NAME,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_FIELD_EXPIRY_TIME,
+                            USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME)
+    //Delete the skill of a user with specific name.
+    userSkillDelete = fmt.Sprintf(`DELETE FROM %s WHERE %s=($1) AND %s=($2)`,
+                            USER_SKILL_TABLE_NAME,
+                            USER_SKILL_FIELD_USERID, USER_SKILL_FIELD_NAME)
+    //Add a required skill to a shift template.
+    templateSkillCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s)
+                            VALUES ($1, $2)`,
+                            TEMPLATE_SKILL_TABLE_NAME,
+                            TEMPLATE_SKILL_FIELD_TEMPLATEUUID,
+                            TEMPLATE_SKILL_FIELD_SKILL)
+    //Get the skills required by a shift template.
+    templateSkillGetonTemplate = fmt.Sprintf(`SELECT %s FROM %s
+                            WHERE %s=($1) ORDER BY %s`,
+                            TEMPLATE_SKILL_FIELD_SKILL,
+                            TEMPLATE_SKILL_TABLE_NAME,
+                            TEMPLATE_SKILL_FIELD_TEMPLATEUUID,
+                            TEMPLATE_SKILL_FIELD_SKILL)
+)
+
+//Translate user skill to DB row in table.
+func (skill *sqlUserSkill)userSkillToDBRowXlate() *dbUserSkill {
+    dbrow := new(dbUserSkill)
+    dbrow.Userid = skill.userid
+    dbrow.Name = skill.name
+    dbrow.Kind = uint64(skill.kind)
+    if !skill.validFrom.IsZero() {
+        dbrow.ValidFrom.Scan(skill.validFrom.UTC())
+    }
+    if !skill.expiryTime.IsZero() {
+        dbrow.ExpiryTime.Scan(skill.expiryTime.UTC())
+    }
+    dbrow.ModifyTime = skill.modifyTime.UTC()
+    return dbrow
+}
+
+//Translate DB user skill row to user skill structure.
+func (skill *sqlUserSkill)dbToUserSkillRowXlate(dbrow *dbUserSkill) {
+    skill.userid = dbrow.Userid
+    skill.name = dbrow.Name
+    skill.kind = SkillKindBit(dbrow.Kind)
+    skill.validFrom = time.Time{}
+    if dbrow.ValidFrom.Valid {
+        skill.validFrom = dbrow.ValidFrom.Time.UTC()
+    }
+    skill.expiryTime = time.Time{}
+    if dbrow.ExpiryTime.Valid {
+        skill.expiryTime = dbrow.ExpiryTime.Time.UTC()
+    }
+    skill.modifyTime = dbrow.ModifyTime.UTC()
+}
+
+func dbToUserSkillRowsXlate(rows []dbUserSkill) []UserSkill {
+    skills := make([]UserSkill, 0, len(rows))
+    for i := range(rows) {
+        entry := new(sqlUserSkill)
+        entry.dbToUserSkillRowXlate(&rows[i])
+        skills = append(skills, entry.UserSkill)
+    }
+    return skills
+}
+
+//Function to create or replace the skill of a user, the user must be present
+// in the system. modifyTime is self populated.
+func (skill *sqlUserSkill)setUserSkillEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to set user skill, invalid DB handle err : %s", err)
+        return err
+    }
+    if skill.IsUserSkillValid() == false {
+        log.Error("Cannot set skill %s of user %s, invalid params",
+                  skill.name, skill.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    user := new(sqlUsers)
+    user.userid = skill.userid
+    err = user.getUserwithID(sqlds, handle)
+    if err != nil {
+        log.Info("Cannot set skill %s, user %s not present", skill.name,
+                 skill.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND])
+    }
+    skill.modifyTime = time.Now()
+    dbrow := skill.userSkillToDBRowXlate()
+    _, err = execPtr(userSkillUpsert, dbrow.Userid, dbrow.Name, dbrow.Kind,
+                     dbrow.ValidFrom, dbrow.ExpiryTime, dbrow.ModifyTime)
+    if err != nil {
+        log.Error("Failed to set skill %s of user %s, err : %s", skill.name,
+                  skill.userid, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the skill of a user with specific name.
+func (skill *sqlUserSkill)getUserSkillEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get user skill, invalid DB handle err : %s", err)
+        return err
+    }
+    var row dbUserSkill
+    err = getPtr(&row, userSkillGet, skill.userid, skill.name)
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read skill %s of user %s, err : %s", skill.name,
+                  skill.userid, err)
+        return err
+    }
+    skill.dbToUserSkillRowXlate(&row)
+    return nil
+}
+
+//Function to get all the skills of user 'userid'.
+func getUserSkills(sqlds *postgreSqlDataStore, handle interface{},
+                   userid string) ([]UserSkill, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list user skills, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbUserSkill{}
+    err = selectPtr(&rows, userSkillGetonUser, userid)
+    if err != nil {
+        log.Trace("Failed to read skills of user %s, err : %s", userid, err)
+        return nil, err
+    }
+    return dbToUserSkillRowsXlate(rows), nil
+}
+
+//Function to delete the skill of a user with specific name.
+func (skill *sqlUserSkill)deleteUserSkillEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to delete user skill, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    err = skill.getUserSkillEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    _, err = execPtr(userSkillDelete, skill.userid, skill.name)
+    if err != nil {
+        log.Info("Failed to delete skill %s of user %s, err : %s", skill.name,
+                 skill.userid, err)
+        return err
+    }
+    return nil
+}
+
+//Function to get the active users who are members of org/unit 'orgUUID' or
+// its ancestors and hold all the skills for the whole range [from, to).
+func getQualifiedUsers(sqlds *postgreSqlDataStore, handle interface{},
+                       orgUUID syncParam.UUID, skills []string,
+                       from time.Time, to time.Time) ([]string, error) {
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err := orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    member := new(sqlUserOrgRole)
+    userids := map[string]bool{}
+    for entry := &orgrow.Org; entry != nil; entry = entry.parent {
+        members, err := member.getMembershipsByOrg(sqlds, handle, entry.uuid)
+        if err != nil {
+            return nil, err
+        }
+        for i := range(members) {
+            userids[members[i].userid] = true
+        }
+    }
+    skills = NormalizeSkillNames(skills)
+    now := time.Now()
+    qualified := []string{}
+    for userid := range(userids) {
+        user := new(sqlUsers)
+        user.userid = userid
+        err = user.getUserwithID(sqlds, handle)
+        if err != nil {
+            return nil, err
+        }
+        if user.IsInactive(now) {
+            continue
+        }
+        held, err := getUserSkills(sqlds, handle, userid)
+        if err != nil {
+            return nil, err
+        }
+        if HoldsSkills(held, skills, from, to) {
+            qualified = append(qualified, userid)
+        }
+    }
+    sort.Strings(qualified)
+    return qualified, nil
+}
+
+//Function to get the skills that expire in the range [from, to) of the users
+// who are members of org/unit 'orgUUID' or its descendants.
+func getExpiringSkills(sqlds *postgreSqlDataStore, handle interface{},
+                       orgUUID syncParam.UUID, from time.Time,
+                       to time.Time) ([]UserSkill, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list expiring skills, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = orgUUID
+    err = orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    tree, err := orgrow.getOrgTree(sqlds, handle)
+    if err != nil {
+        return nil, err
+    }
+    member := new(sqlUserOrgRole)
+    userids := map[string]bool{}
+    pending := []*OrgTree{tree}
+    for len(pending) != 0 {
+        node := pending[len(pending) - 1]
+        pending = append(pending[:len(pending) - 1], node.Children...)
+        members, err := member.getMembershipsByOrg(sqlds, handle,
+                                                   node.Org.uuid)
+        if err != nil {
+            return nil, err
+        }
+        for i := range(members) {
+            userids[members[i].userid] = true
+        }
+    }
+    rows := []dbUserSkill{}
+    err = selectPtr(&rows, userSkillGetonExpiry, from.UTC(), to.UTC())
+    if err != nil {
+        log.Trace("Failed to read expiring skills, err : %s", err)
+        return nil, err
+    }
+    skills := []UserSkill{}
+    for _, skill := range(dbToUserSkillRowsXlate(rows)) {
+        if userids[skill.userid] {
+            skills = append(skills, skill)
+        }
+    }
+    sortSkillsOnExpiry(skills)
+    return skills, nil
+}
+
+//Function to store the skills required by the shift template 'tmplUUID'.
+func setTemplateSkills(sqlds *postgreSqlDataStore, handle interface{},
+                       tmplUUID syncParam.UUID, skills []string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to set template skills, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    for _, name := range(skills) {
+        _, err = execPtr(templateSkillCreate,
+                         syncParam.UUIDtoString(tmplUUID), name)
+        if err != nil {
+            log.Error("Failed to add skill %s to template %s, err : %s",
+                      name, syncParam.UUIDtoString(tmplUUID), err)
+            return err
+        }
+    }
+    return nil
+}
+
+//Function to get the skills required by the shift template 'tmplUUID'.
+func getTemplateSkills(sqlds *postgreSqlDataStore, handle interface{},
+                       tmplUUID syncParam.UUID) ([]string, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to get template skills, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    skills := []string{}
+    err = selectPtr(&skills, templateSkillGetonTemplate,
+                    syncParam.UUIDtoString(tmplUUID))
+    if err != nil {
+        log.Trace("Failed to read skills of template %s, err : %s",
+                  syncParam.UUIDtoString(tmplUUID), err)
+        return nil, err
+    }
+    return skills, nil
+}
+
+//Check the user holds the skills required by the template of the shift for
+// the whole shift, an adhoc shift needs no skills.
+func checkSkillRequirement(sqlds *postgreSqlDataStore, handle interface{},
+                           userid string, shift *Shift) error {
+    if syncParam.IsUUIDEmpty(shift.templateUUID) {
+        return nil
+    }
+    required, err := getTemplateSkills(sqlds, handle, shift.templateUUID)
+    if err != nil || len(required) == 0 {
+        return err
+    }
+    held, err := getUserSkills(sqlds, handle, userid)
+    if err != nil {
+        return err
+    }
+    if !HoldsSkills(held, required, shift.startTime, shift.endTime) {
+        logging.GetAppLoggerObj().Info(
+                    "User %s does not hold the skills for shift %s",
+                    userid, syncParam.UUIDtoString(shift.uuid))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SKILL_REQUIREMENT_NOT_MET])
+    }
+    return nil
+}
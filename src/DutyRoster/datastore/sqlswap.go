@@ -0,0 +1,867 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "fmt"
+    "time"
+    "database/sql"
+    _ "github.com/lib/pq"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//The db representation of swap settings table. Used only for SQLX
+// operations. It has a direct 1:1 mapping to 'SwapSettings' structure.
+type dbSwapSettings struct {
+    OrgUuid string `db:"orguuid"`
+    MinRest int64 `db:"minrest"` //Minimum rest in seconds.
+    ApproverRole uint64 `db:"approverrole"`
+}
+
+//The db representation of swap offer table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'SwapOffer' structure.
+type dbSwapOffer struct {
+    Uuid string `db:"uuid"`
+    OrgUuid string `db:"orguuid"`
+    AssignmentUuid string `db:"assignmentuuid"`
+    OfferedBy string `db:"offeredby"`
+    Kind uint64 `db:"kind"`
+    TargetAssignment sql.NullString `db:"targetassignment"`
+    TakenBy sql.NullString `db:"takenby"`
+    Status uint64 `db:"status"`
+    ApproverRole uint64 `db:"approverrole"`
+    CreateTime time.Time `db:"createtime"`
+    DecidedBy sql.NullString `db:"decidedby"`
+    DecideTime sql.NullTime `db:"decidetime"`
+}
+
+//The db representation of swap audit table. Used only for SQLX operations.
+//The following structure has a direct 1:1 mapping to 'SwapAudit' structure.
+type dbSwapAudit struct {
+    Uuid string `db:"uuid"`
+    OfferUuid string `db:"offeruuid"`
+    OrgUuid string `db:"orguuid"`
+    Status uint64 `db:"status"`
+    Actor string `db:"actor"`
+    AuditTime time.Time `db:"audittime"`
+    Note string `db:"note"`
+}
+
+// SQL representation for swap settings.
+type sqlSwapSettings struct {
+    SwapSettings
+}
+
+// SQL representation for swap offer.
+type sqlSwapOffer struct {
+    SwapOffer
+}
+
+// SQL representation for swap audit record.
+type sqlSwapAudit struct {
+    SwapAudit
+}
+
+//String representation of swap tables and its elements.
+const (
+    SWAP_SETTINGS_TABLE_NAME = "swapsettings"
+    SWAP_SETTINGS_FIELD_ORGUUID = "orguuid"
+    SWAP_SETTINGS_FIELD_MIN_REST = "minrest"
+    SWAP_SETTINGS_FIELD_APPROVER_ROLE = "approverrole"
+
+    SWAP_OFFER_TABLE_NAME = "swapoffers"
+    SWAP_OFFER_FIELD_UUID = "uuid"
+    SWAP_OFFER_FIELD_ORGUUID = "orguuid"
+    SWAP_OFFER_FIELD_ASSIGNMENTUUID = "assignmentuuid"
+    SWAP_OFFER_FIELD_OFFERED_BY = "offeredby"
+    SWAP_OFFER_FIELD_KIND = "kind"
+    SWAP_OFFER_FIELD_TARGET_ASSIGNMENT = "targetassignment"
+    SWAP_OFFER_FIELD_TAKEN_BY = "takenby"
+    SWAP_OFFER_FIELD_STATUS = "status"
+    SWAP_OFFER_FIELD_APPROVER_ROLE = "approverrole"
+    SWAP_OFFER_FIELD_CREATE_TIME = "createtime"
+    SWAP_OFFER_FIELD_DECIDED_BY = "decidedby"
+    SWAP_OFFER_FIELD_DECIDE_TIME = "decidetime"
+
+    SWAP_AUDIT_TABLE_NAME = "swapaudit"
+    SWAP_AUDIT_FIELD_UUID = "uuid"
+    SWAP_AUDIT_FIELD_OFFERUUID = "offeruuid"
+    SWAP_AUDIT_FIELD_ORGUUID = "orguuid"
+    SWAP_AUDIT_FIELD_STATUS = "status"
+    SWAP_AUDIT_FIELD_ACTOR = "actor"
+    SWAP_AUDIT_FIELD_AUDIT_TIME = "audittime"
+    SWAP_AUDIT_FIELD_NOTE = "note"
+)
+
+// SQL statements to be used to operate on swap tables.
+var (
+    //Create a table swapsettings, one row for an org/unit.
+    swapSettingsSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s bigint NOT NULL CHECK(%s >= 0));`,
+                     SWAP_SETTINGS_TABLE_NAME,
+                     SWAP_SETTINGS_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SWAP_SETTINGS_FIELD_MIN_REST, SWAP_SETTINGS_FIELD_MIN_REST,
+                     SWAP_SETTINGS_FIELD_APPROVER_ROLE,
+                     SWAP_SETTINGS_FIELD_APPROVER_ROLE)
+    //Create a table swapoffers. Offers are deleted with the assignments.
+    swapOfferSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NOT NULL REFERENCES %s(%s)
+                     ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s UUID NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s bigint NOT NULL CHECK(%s >= 0),
+                     %s timestamp NOT NULL,
+                     %s varchar(%d) NULL REFERENCES %s(%s) ON DELETE SET NULL,
+                     %s timestamp NULL);`,
+                     SWAP_OFFER_TABLE_NAME,
+                     SWAP_OFFER_FIELD_UUID,
+                     SWAP_OFFER_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SWAP_OFFER_FIELD_ASSIGNMENTUUID,
+                     ROSTER_TABLE_NAME, ROSTER_FIELD_UUID,
+                     SWAP_OFFER_FIELD_OFFERED_BY, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SWAP_OFFER_FIELD_KIND, SWAP_OFFER_FIELD_KIND,
+                     SWAP_OFFER_FIELD_TARGET_ASSIGNMENT,
+                     ROSTER_TABLE_NAME, ROSTER_FIELD_UUID,
+                     SWAP_OFFER_FIELD_TAKEN_BY, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SWAP_OFFER_FIELD_STATUS, SWAP_OFFER_FIELD_STATUS,
+                     SWAP_OFFER_FIELD_APPROVER_ROLE,
+                     SWAP_OFFER_FIELD_APPROVER_ROLE,
+                     SWAP_OFFER_FIELD_CREATE_TIME,
+                     SWAP_OFFER_FIELD_DECIDED_BY, USER_STR_LEN,
+                     USER_TABLE_NAME, USER_FIELD_USERID,
+                     SWAP_OFFER_FIELD_DECIDE_TIME)
+    //Index to find the offers of an org/unit on marketplace.
+    swapOfferOrgIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s, %s)`,
+                            SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_ORGUUID,
+                            SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_ORGUUID,
+                            SWAP_OFFER_FIELD_STATUS)
+    //Create a table swapaudit. Audit records are kept after the offer and
+    // users are deleted, so the offer and actor are not referenced.
+    swapAuditSchema = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s
+                    (%s UUID NOT NULL PRIMARY KEY,
+                     %s UUID NOT NULL,
+                     %s UUID NOT NULL REFERENCES %s(%s) ON DELETE CASCADE,
+                     %s bigint NOT NULL CHECK(%s > 0),
+                     %s varchar(%d) NOT NULL,
+                     %s timestamp NOT NULL,
+                     %s varchar(%d) NOT NULL);`,
+                     SWAP_AUDIT_TABLE_NAME,
+                     SWAP_AUDIT_FIELD_UUID,
+                     SWAP_AUDIT_FIELD_OFFERUUID,
+                     SWAP_AUDIT_FIELD_ORGUUID, ORG_TABLE_NAME, ORG_FIELD_UUID,
+                     SWAP_AUDIT_FIELD_STATUS, SWAP_AUDIT_FIELD_STATUS,
+                     SWAP_AUDIT_FIELD_ACTOR, USER_STR_LEN,
+                     SWAP_AUDIT_FIELD_AUDIT_TIME,
+                     SWAP_AUDIT_FIELD_NOTE, SWAP_NOTE_STR_LEN)
+    //Index to find the audit records of an offer.
+    swapAuditOfferIndex = fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s_%s_idx
+                            ON %s (%s)`,
+                            SWAP_AUDIT_TABLE_NAME, SWAP_AUDIT_FIELD_OFFERUUID,
+                            SWAP_AUDIT_TABLE_NAME, SWAP_AUDIT_FIELD_OFFERUUID)
+    //Create or replace the swap settings of an org/unit.
+    swapSettingsUpsert = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s)
+                            VALUES ($1, $2, $3) ON CONFLICT (%s)
+                            DO UPDATE SET %s=excluded.%s, %s=excluded.%s`,
+                            SWAP_SETTINGS_TABLE_NAME,
+                            SWAP_SETTINGS_FIELD_ORGUUID,
+                            SWAP_SETTINGS_FIELD_MIN_REST,
+                            SWAP_SETTINGS_FIELD_APPROVER_ROLE,
+                            SWAP_SETTINGS_FIELD_ORGUUID,
+                            SWAP_SETTINGS_FIELD_MIN_REST,
+                            SWAP_SETTINGS_FIELD_MIN_REST,
+                            SWAP_SETTINGS_FIELD_APPROVER_ROLE,
+                            SWAP_SETTINGS_FIELD_APPROVER_ROLE)
+    //Get the swap settings of an org/unit.
+    swapSettingsGet = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            SWAP_SETTINGS_TABLE_NAME,
+                            SWAP_SETTINGS_FIELD_ORGUUID)
+    //Create a swap offer entry.
+    swapOfferCreate = fmt.Sprintf(`INSERT INTO %s
+                            (%s, %s, %s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+                            SWAP_OFFER_TABLE_NAME,
+                            SWAP_OFFER_FIELD_UUID, SWAP_OFFER_FIELD_ORGUUID,
+                            SWAP_OFFER_FIELD_ASSIGNMENTUUID,
+                            SWAP_OFFER_FIELD_OFFERED_BY, SWAP_OFFER_FIELD_KIND,
+                            SWAP_OFFER_FIELD_TARGET_ASSIGNMENT,
+                            SWAP_OFFER_FIELD_STATUS,
+                            SWAP_OFFER_FIELD_APPROVER_ROLE,
+                            SWAP_OFFER_FIELD_CREATE_TIME)
+    //Get the swap offer with specific uuid
+    swapOfferGetonUUID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
+                            SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_UUID)
+    //Get the pending offers of an assignment.
+    swapOfferGetonAssignmentPending = fmt.Sprintf(`SELECT * FROM %s
+                            WHERE %s=($1) AND %s IN ($2, $3)`,
+                            SWAP_OFFER_TABLE_NAME,
+                            SWAP_OFFER_FIELD_ASSIGNMENTUUID,
+                            SWAP_OFFER_FIELD_STATUS)
+    //Get all the offers of org/unit in a status.
+    swapOfferGetonOrgStatus = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s=($2) ORDER BY %s`,
+                            SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_ORGUUID,
+                            SWAP_OFFER_FIELD_STATUS,
+                            SWAP_OFFER_FIELD_CREATE_TIME)
+    //Move the offer to new status, only when in the expected status.
+    swapOfferUpdateStatus = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2),
+                            %s=($3), %s=($4) WHERE %s=($5) AND %s=($6)`,
+                            SWAP_OFFER_TABLE_NAME, SWAP_OFFER_FIELD_STATUS,
+                            SWAP_OFFER_FIELD_TAKEN_BY,
+                            SWAP_OFFER_FIELD_DECIDED_BY,
+                            SWAP_OFFER_FIELD_DECIDE_TIME,
+                            SWAP_OFFER_FIELD_UUID, SWAP_OFFER_FIELD_STATUS)
+    //Create a swap audit entry.
+    swapAuditCreate = fmt.Sprintf(`INSERT INTO %s (%s, %s, %s, %s, %s, %s, %s)
+                            VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+                            SWAP_AUDIT_TABLE_NAME,
+                            SWAP_AUDIT_FIELD_UUID, SWAP_AUDIT_FIELD_OFFERUUID,
+                            SWAP_AUDIT_FIELD_ORGUUID, SWAP_AUDIT_FIELD_STATUS,
+                            SWAP_AUDIT_FIELD_ACTOR, SWAP_AUDIT_FIELD_AUDIT_TIME,
+                            SWAP_AUDIT_FIELD_NOTE)
+    //Get the audit records of an offer.
+    swapAuditGetonOffer = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            ORDER BY %s`,
+                            SWAP_AUDIT_TABLE_NAME, SWAP_AUDIT_FIELD_OFFERUUID,
+                            SWAP_AUDIT_FIELD_AUDIT_TIME)
+    //Get the audit records of an org/unit in a time range.
+    swapAuditGetonOrgRange = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
+                            AND %s >= ($2) AND %s < ($3) ORDER BY %s`,
+                            SWAP_AUDIT_TABLE_NAME, SWAP_AUDIT_FIELD_ORGUUID,
+                            SWAP_AUDIT_FIELD_AUDIT_TIME,
+                            SWAP_AUDIT_FIELD_AUDIT_TIME,
+                            SWAP_AUDIT_FIELD_AUDIT_TIME)
+)
+
+//Translate swap offer to DB row in table.
+func (offer *sqlSwapOffer)swapOfferToDBRowXlate() *dbSwapOffer {
+    dbrow := new(dbSwapOffer)
+    dbrow.Uuid = syncParam.UUIDtoString(offer.uuid)
+    dbrow.OrgUuid = syncParam.UUIDtoString(offer.orgUUID)
+    dbrow.AssignmentUuid = syncParam.UUIDtoString(offer.assignmentUUID)
+    dbrow.OfferedBy = offer.offeredBy
+    dbrow.Kind = uint64(offer.kind)
+    if !syncParam.IsUUIDEmpty(offer.targetAssignmentUUID) {
+        dbrow.TargetAssignment.Scan(
+                    syncParam.UUIDtoString(offer.targetAssignmentUUID))
+    }
+    if len(offer.takenBy) != 0 {
+        dbrow.TakenBy.Scan(offer.takenBy)
+    }
+    dbrow.Status = uint64(offer.status)
+    dbrow.ApproverRole = uint64(offer.approverRole)
+    dbrow.CreateTime = offer.createTime.UTC()
+    if len(offer.decidedBy) != 0 {
+        dbrow.DecidedBy.Scan(offer.decidedBy)
+    }
+    if !offer.decideTime.IsZero() {
+        dbrow.DecideTime.Scan(offer.decideTime.UTC())
+    }
+    return dbrow
+}
+
+//Translate DB swap offer row to swap offer structure.
+func (offer *sqlSwapOffer)dbToSwapOfferRowXlate(dbrow *dbSwapOffer) {
+    offer.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    offer.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    offer.assignmentUUID = syncParam.StringtoUUID(dbrow.AssignmentUuid)
+    offer.offeredBy = dbrow.OfferedBy
+    offer.kind = SwapKindBit(dbrow.Kind)
+    offer.targetAssignmentUUID = syncParam.UUID{}
+    if dbrow.TargetAssignment.Valid {
+        offer.targetAssignmentUUID =
+                        syncParam.StringtoUUID(dbrow.TargetAssignment.String)
+    }
+    offer.takenBy = ""
+    if dbrow.TakenBy.Valid {
+        offer.takenBy = dbrow.TakenBy.String
+    }
+    offer.status = SwapStatusBit(dbrow.Status)
+    offer.approverRole = RoleBit(dbrow.ApproverRole)
+    offer.createTime = dbrow.CreateTime
+    offer.decidedBy = ""
+    if dbrow.DecidedBy.Valid {
+        offer.decidedBy = dbrow.DecidedBy.String
+    }
+    offer.decideTime = time.Time{}
+    if dbrow.DecideTime.Valid {
+        offer.decideTime = dbrow.DecideTime.Time
+    }
+}
+
+//Translate DB swap audit row to swap audit structure.
+func (audit *sqlSwapAudit)dbToSwapAuditRowXlate(dbrow *dbSwapAudit) {
+    audit.uuid = syncParam.StringtoUUID(dbrow.Uuid)
+    audit.offerUUID = syncParam.StringtoUUID(dbrow.OfferUuid)
+    audit.orgUUID = syncParam.StringtoUUID(dbrow.OrgUuid)
+    audit.status = SwapStatusBit(dbrow.Status)
+    audit.actor = dbrow.Actor
+    audit.auditTime = dbrow.AuditTime
+    audit.note = dbrow.Note
+}
+
+//Function to create or replace the swap settings of org/unit. The approver
+// role must be a role that can be granted in the org/unit.
+func (settings *sqlSwapSettings)setSwapSettingsEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to set swap settings, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    if settings.IsSwapSettingsValid() == false {
+        log.Error("Cannot set swap settings, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = settings.orgUUID
+    err = orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    if settings.approverRole != 0 {
+        rl := new(sqlRole)
+        rl.roleType = settings.approverRole
+        err = rl.isRoleGrantableInOrg(sqlds, handle, &orgrow.Org)
+        if err != nil {
+            return err
+        }
+    }
+    _, err = execPtr(swapSettingsUpsert,
+                     syncParam.UUIDtoString(settings.orgUUID),
+                     int64(settings.minRest / time.Second),
+                     uint64(settings.approverRole))
+    if err != nil {
+        log.Error("Failed to set swap settings of org %s, err : %s",
+                  syncParam.UUIDtoString(settings.orgUUID), err)
+        return err
+    }
+    settings.minRest = settings.minRest.Truncate(time.Second)
+    return nil
+}
+
+//Function to get the swap settings in effect for the org/unit, ie: the
+// settings of the nearest org/unit in the parent chain. Trades need no
+// approval and no rest time when no org/unit in the chain has settings.
+func (settings *sqlSwapSettings)getSwapSettingsEntry(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get swap settings, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    orgrow := new(sqlorg)
+    orgrow.uuid = settings.orgUUID
+    err = orgrow.getOrgEntryByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    settings.minRest = 0
+    settings.approverRole = 0
+    for entry := &orgrow.Org; entry != nil; entry = entry.parent {
+        var row dbSwapSettings
+        err = getPtr(&row, swapSettingsGet, syncParam.UUIDtoString(entry.uuid))
+        if err == sql.ErrNoRows {
+            continue
+        }
+        if err != nil {
+            log.Trace("Failed to read swap settings of org %s, err : %s",
+                      syncParam.UUIDtoString(entry.uuid), err)
+            return err
+        }
+        settings.minRest = time.Duration(row.MinRest) * time.Second
+        settings.approverRole = RoleBit(row.ApproverRole)
+        return nil
+    }
+    return nil
+}
+
+//Function to write an audit record of the offer moved to its current status
+// by user 'actor'.
+func (offer *sqlSwapOffer)createSwapAuditEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}, actor string,
+                                     note string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create swap audit, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    uuid, err := syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create swap audit")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    _, err = execPtr(swapAuditCreate, syncParam.UUIDtoString(uuid),
+                     syncParam.UUIDtoString(offer.uuid),
+                     syncParam.UUIDtoString(offer.orgUUID),
+                     uint64(offer.status), actor, time.Now().UTC(), note)
+    if err != nil {
+        log.Error("Failed to create swap audit of offer %s, err : %s",
+                  syncParam.UUIDtoString(offer.uuid), err)
+        return err
+    }
+    return nil
+}
+
+//Get the assignment with its shift, the shift must not be cancelled or
+// started at 'now'.
+func getTradableAssignment(sqlds *postgreSqlDataStore, handle interface{},
+                           asgnUUID syncParam.UUID, now time.Time) (
+                           *sqlRosterAssignment, *sqlShift, error) {
+    asgn := new(sqlRosterAssignment)
+    asgn.uuid = asgnUUID
+    err := asgn.getRosterByUUID(sqlds, handle)
+    if err != nil {
+        return nil, nil, err
+    }
+    shift := new(sqlShift)
+    shift.uuid = asgn.shiftUUID
+    err = shift.getShiftByUUID(sqlds, handle)
+    if err != nil {
+        return nil, nil, err
+    }
+    if shift.IsCancelled() || !shift.startTime.After(now) {
+        logging.GetAppLoggerObj().Info(
+                    "Cannot trade assignment %s, shift cancelled/started",
+                    syncParam.UUIDtoString(asgnUUID))
+        return nil, nil, fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_INVALID_TRANSITION])
+    }
+    return asgn, shift, nil
+}
+
+//Check user 'userid' can take the shift after giving away the assignment
+// 'givenUUID', if any. The user must not be on leave, must hold the skills
+// required for the shift and the rest time and double booking rules must
+// hold.
+func isShiftTakeable(sqlds *postgreSqlDataStore, handle interface{},
+                     userid string, shift *Shift, givenUUID syncParam.UUID,
+                     minRest time.Duration) error {
+    leave := new(sqlLeaveRequest)
+    err := leave.checkLeaveConflict(sqlds, handle, userid, shift.startTime,
+                                    shift.endTime)
+    if err != nil {
+        return err
+    }
+    err = checkSkillRequirement(sqlds, handle, userid, shift)
+    if err != nil {
+        return err
+    }
+    asgn := new(sqlRosterAssignment)
+    asgns, err := asgn.getRosterByUserRange(sqlds, handle, userid,
+                                            shift.startTime.Add(-minRest),
+                                            shift.endTime.Add(minRest))
+    if err != nil {
+        return err
+    }
+    shifts := make([]Shift, 0, len(asgns))
+    for i := range(asgns) {
+        if asgns[i].uuid == givenUUID {
+            continue
+        }
+        entry := new(sqlShift)
+        entry.uuid = asgns[i].shiftUUID
+        err = entry.getShiftByUUID(sqlds, handle)
+        if err != nil {
+            return err
+        }
+        shifts = append(shifts, entry.Shift)
+    }
+    if !isTradeValid(shifts, shift, minRest) {
+        logging.GetAppLoggerObj().Info(
+                    "User %s cannot take shift %s, rest/double booking",
+                    userid, syncParam.UUIDtoString(shift.uuid))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_RULE_VIOLATION])
+    }
+    return nil
+}
+
+//Validate the trade of offer to user 'takenBy' against the current roster.
+//Returns the assignments that change hands, target is nil when the offer is
+// not a direct swap.
+func (offer *sqlSwapOffer)checkTrade(sqlds *postgreSqlDataStore,
+                                     handle interface{}, takenBy string) (
+                                     *sqlRosterAssignment,
+                                     *sqlRosterAssignment, error) {
+    now := time.Now()
+    asgn, shift, err := getTradableAssignment(sqlds, handle,
+                                              offer.assignmentUUID, now)
+    if err != nil {
+        return nil, nil, err
+    }
+    notEligible := fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_NOT_ELIGIBLE])
+    if asgn.userid != offer.offeredBy || takenBy == offer.offeredBy {
+        return nil, nil, notEligible
+    }
+    member := new(sqlUserOrgRole)
+    roles, err := member.getEffectiveRoles(sqlds, handle, takenBy,
+                                           offer.orgUUID)
+    if err != nil {
+        return nil, nil, err
+    }
+    if roles == 0 {
+        return nil, nil, notEligible
+    }
+    settings := new(sqlSwapSettings)
+    settings.orgUUID = offer.orgUUID
+    err = settings.getSwapSettingsEntry(sqlds, handle)
+    if err != nil {
+        return nil, nil, err
+    }
+    var target *sqlRosterAssignment
+    var givenUUID syncParam.UUID
+    switch(offer.kind) {
+        case SWAP_DIRECT:
+            var targetShift *sqlShift
+            target, targetShift, err = getTradableAssignment(sqlds, handle,
+                                            offer.targetAssignmentUUID, now)
+            if err != nil {
+                return nil, nil, err
+            }
+            if target.userid != takenBy {
+                return nil, nil, notEligible
+            }
+            givenUUID = target.uuid
+            err = isShiftTakeable(sqlds, handle, offer.offeredBy,
+                                  &targetShift.Shift, asgn.uuid,
+                                  settings.minRest)
+            if err != nil {
+                return nil, nil, err
+            }
+        case SWAP_PICKUP:
+            avail := new(sqlAvailability)
+            records, err := avail.getAvailabilityByUser(sqlds, handle,
+                                                        takenBy)
+            if err != nil {
+                return nil, nil, err
+            }
+            loc, err := getOrgLocation(sqlds, handle, shift.orgUUID)
+            if err != nil {
+                return nil, nil, err
+            }
+            if !IsUserAvailable(records, shift.startTime, shift.endTime,
+                                loc) {
+                return nil, nil, notEligible
+            }
+    }
+    err = isShiftTakeable(sqlds, handle, takenBy, &shift.Shift, givenUUID,
+                          settings.minRest)
+    if err != nil {
+        return nil, nil, err
+    }
+    return asgn, target, nil
+}
+
+//Create a swap offer in open status, uuid, org/unit, approver role and
+// createTime are self populated. The assignment must be of the user and can
+// have only one pending offer. A direct swap must target an assignment of
+// another user in the same org/unit.
+func (offer *sqlSwapOffer)createSwapOfferEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to create swap offer, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    selectPtr, _ := sqlds.getDBSelectFunction(handle)
+    offer.status = SWAP_OPEN
+    if offer.IsSwapOfferValid() == false {
+        log.Error("Cannot create swap offer, invalid params")
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    now := time.Now()
+    asgn, shift, err := getTradableAssignment(sqlds, handle,
+                                              offer.assignmentUUID, now)
+    if err != nil {
+        return err
+    }
+    if asgn.userid != offer.offeredBy {
+        log.Info("Cannot offer assignment %s, not assigned to %s",
+                 syncParam.UUIDtoString(asgn.uuid), offer.offeredBy)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+    }
+    if offer.kind == SWAP_DIRECT {
+        target, targetShift, err := getTradableAssignment(sqlds, handle,
+                                            offer.targetAssignmentUUID, now)
+        if err != nil {
+            return err
+        }
+        if target.orgUUID != asgn.orgUUID ||
+            target.userid == offer.offeredBy ||
+            targetShift.uuid == shift.uuid {
+            log.Info("Cannot swap assignment %s with %s, not in same org",
+                     syncParam.UUIDtoString(asgn.uuid),
+                     syncParam.UUIDtoString(target.uuid))
+            return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR])
+        }
+    }
+    rows := []dbSwapOffer{}
+    err = selectPtr(&rows, swapOfferGetonAssignmentPending,
+                    syncParam.UUIDtoString(asgn.uuid), uint64(SWAP_OPEN),
+                    uint64(SWAP_ACCEPTED))
+    if err != nil {
+        return err
+    }
+    if len(rows) != 0 {
+        log.Info("Assignment %s is already on the swap marketplace",
+                 syncParam.UUIDtoString(asgn.uuid))
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
+    }
+    settings := new(sqlSwapSettings)
+    settings.orgUUID = asgn.orgUUID
+    err = settings.getSwapSettingsEntry(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    offer.uuid, err = syncParam.NewUUID()
+    if err != nil {
+        log.Trace("Failed to create UUID, cannot create swap offer")
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    offer.orgUUID = asgn.orgUUID
+    offer.approverRole = settings.approverRole
+    offer.createTime = now
+    offer.takenBy = ""
+    offer.decidedBy = ""
+    offer.decideTime = time.Time{}
+    dbrow := offer.swapOfferToDBRowXlate()
+    _, err = execPtr(swapOfferCreate, dbrow.Uuid, dbrow.OrgUuid,
+                     dbrow.AssignmentUuid, dbrow.OfferedBy, dbrow.Kind,
+                     dbrow.TargetAssignment, dbrow.Status, dbrow.ApproverRole,
+                     dbrow.CreateTime)
+    if err != nil {
+        log.Error("Failed to create swap offer of %s err : %s",
+                  offer.offeredBy, err)
+        return err
+    }
+    return offer.createSwapAuditEntry(sqlds, handle, offer.offeredBy, "")
+}
+
+//Function to get the swap offer with specific UUID.
+func (offer *sqlSwapOffer)getSwapOfferByUUID(sqlds *postgreSqlDataStore,
+                                     handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    getPtr, err := sqlds.getDBGetFunction(handle)
+    if err != nil {
+        log.Error("Failed to get swap offer, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    var row dbSwapOffer
+    err = getPtr(&row, swapOfferGetonUUID, syncParam.UUIDtoString(offer.uuid))
+    if err == sql.ErrNoRows {
+        return fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    if err != nil {
+        log.Trace("Failed to read swap offer %s, err : %s",
+                  syncParam.UUIDtoString(offer.uuid), err)
+        return err
+    }
+    offer.dbToSwapOfferRowXlate(&row)
+    return nil
+}
+
+//Function to get the swap offers of org/unit 'orgUUID' in the status.
+func (offer *sqlSwapOffer)getSwapOffersByOrgStatus(
+                                     sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID,
+                                     status SwapStatusBit) (
+                                     []SwapOffer, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list swap offers, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbSwapOffer{}
+    err = selectPtr(&rows, swapOfferGetonOrgStatus,
+                    syncParam.UUIDtoString(orgUUID), uint64(status))
+    if err != nil {
+        log.Trace("Failed to read swap offers of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    offers := make([]SwapOffer, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlSwapOffer)
+        entry.dbToSwapOfferRowXlate(&row)
+        offers = append(offers, entry.SwapOffer)
+    }
+    return offers, nil
+}
+
+//Move the swap offer to 'status' by user 'userid', and write the audit
+// record. Taking an open offer re-checks the trade and moves it to accepted,
+// or completes it when no approval is needed. Approval re-checks the trade
+// again as the roster may have changed since the offer is taken.
+func (offer *sqlSwapOffer)updateSwapStatusEntry(sqlds *postgreSqlDataStore,
+                                     handle interface{}, status SwapStatusBit,
+                                     userid string, note string) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update swap offer, invalid DB handle err : %s",
+                  err)
+        return err
+    }
+    if len(note) >= SWAP_NOTE_STR_LEN {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err = offer.getSwapOfferByUUID(sqlds, handle)
+    if err != nil {
+        return err
+    }
+    oldStatus := offer.status
+    if !IsSwapTransitionValid(oldStatus, status, offer.approverRole) {
+        log.Info("Swap offer %s cannot move from status %d to %d",
+                 syncParam.UUIDtoString(offer.uuid), oldStatus, status)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_INVALID_TRANSITION])
+    }
+    if oldStatus == SWAP_OPEN && status != SWAP_CANCELLED {
+        offer.takenBy = userid
+    }
+    if status == SWAP_ACCEPTED || status == SWAP_COMPLETED {
+        asgn, target, err := offer.checkTrade(sqlds, handle, offer.takenBy)
+        if err != nil {
+            return err
+        }
+        if status == SWAP_COMPLETED {
+            err = asgn.transferRosterEntry(sqlds, handle, offer.takenBy)
+            if err == nil && target != nil {
+                err = target.transferRosterEntry(sqlds, handle,
+                                                 offer.offeredBy)
+            }
+            if err != nil {
+                return err
+            }
+        }
+    }
+    offer.status = status
+    if status != SWAP_ACCEPTED {
+        offer.decideTime = time.Now()
+        if status != SWAP_COMPLETED || oldStatus == SWAP_ACCEPTED {
+            offer.decidedBy = userid
+        }
+    }
+    dbrow := offer.swapOfferToDBRowXlate()
+    res, err := execPtr(swapOfferUpdateStatus, dbrow.Status, dbrow.TakenBy,
+                        dbrow.DecidedBy, dbrow.DecideTime, dbrow.Uuid,
+                        uint64(oldStatus))
+    if err != nil {
+        log.Error("Failed to update swap offer %s, err : %s", dbrow.Uuid,
+                  err)
+        return err
+    }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        //Offer is updated by someone else in the meantime.
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.SWAP_INVALID_TRANSITION])
+    }
+    return offer.createSwapAuditEntry(sqlds, handle, userid, note)
+}
+
+//Function to get the audit records of offer 'offerUUID'.
+func (audit *sqlSwapAudit)getSwapAuditByOffer(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     offerUUID syncParam.UUID) (
+                                     []SwapAudit, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list swap audit, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbSwapAudit{}
+    err = selectPtr(&rows, swapAuditGetonOffer,
+                    syncParam.UUIDtoString(offerUUID))
+    if err != nil {
+        log.Trace("Failed to read swap audit of offer %s, err : %s",
+                  syncParam.UUIDtoString(offerUUID), err)
+        return nil, err
+    }
+    return dbToSwapAuditRowsXlate(rows), nil
+}
+
+//Function to get the audit records of org/unit 'orgUUID' in the time range
+// [from, to).
+func (audit *sqlSwapAudit)getSwapAuditByOrgRange(sqlds *postgreSqlDataStore,
+                                     handle interface{},
+                                     orgUUID syncParam.UUID, from time.Time,
+                                     to time.Time) ([]SwapAudit, error) {
+    log := logging.GetAppLoggerObj()
+    selectPtr, err := sqlds.getDBSelectFunction(handle)
+    if err != nil {
+        log.Error("Failed to list swap audit, invalid DB handle err : %s",
+                  err)
+        return nil, err
+    }
+    rows := []dbSwapAudit{}
+    err = selectPtr(&rows, swapAuditGetonOrgRange,
+                    syncParam.UUIDtoString(orgUUID), from.UTC(), to.UTC())
+    if err != nil {
+        log.Trace("Failed to read swap audit of org %s, err : %s",
+                  syncParam.UUIDtoString(orgUUID), err)
+        return nil, err
+    }
+    return dbToSwapAuditRowsXlate(rows), nil
+}
+
+//Translate a list of DB swap audit rows to swap audit records.
+func dbToSwapAuditRowsXlate(rows []dbSwapAudit) []SwapAudit {
+    audits := make([]SwapAudit, 0, len(rows))
+    for _, row := range(rows) {
+        entry := new(sqlSwapAudit)
+        entry.dbToSwapAuditRowXlate(&row)
+        audits = append(audits, entry.SwapAudit)
+    }
+    return audits
+}
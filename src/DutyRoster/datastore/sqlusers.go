@@ -87,48 +87,26 @@ var (
     //Get the user rows with specific userID
     userGetonUserID = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)`,
                             USER_TABLE_NAME, USER_FIELD_USERID)
-    //Get the user rows with specific userid and pwd
-    userGetonUserIDPwd = fmt.Sprintf(`SELECT * FROM %s WHERE %s=($1)
-                                    AND %s=($2)`,
-                             USER_TABLE_NAME, USER_FIELD_USERID,
-                             USER_FIELD_HASHPWD)
-    //Get the user rows with specific emailid and pwd
-    userGetonEmailIDPwd = fmt.Sprintf(`SELECT * FROM %s
-                             WHERE %s=($1) AND %s=($2)`,
-                             USER_TABLE_NAME, USER_FIELD_EMAILID,
-                             USER_FIELD_HASHPWD)
+    //Update the password hash of user with specific userid
+    userUpdatePwd = fmt.Sprintf("UPDATE %s SET %s=($1) WHERE %s=($2)",
+                            USER_TABLE_NAME, USER_FIELD_HASHPWD,
+                            USER_FIELD_USERID)
     //Delete user record from users table with specific userid
     userDeleteOnID = fmt.Sprintf("DELETE FROM %s WHERE %s=($1)",
                                 USER_TABLE_NAME,
                                 USER_FIELD_USERID)
+    //Update user record with specific userid
     userUpdateOnID = fmt.Sprintf(`UPDATE %s SET %s=($1), %s=($2),
-                        %s=($3), %s=($4), %s=($5)`,
+                        %s=($3), %s=($4), %s=($5) WHERE %s=($6)`,
                         USER_TABLE_NAME,
                         USER_FIELD_EMAILID,
                         USER_FIELD_HASHPWD,
                         USER_FIELD_MOBILENO,
                         USER_FIELD_STATUS,
-                        USER_FIELD_VALIDITY)
+                        USER_FIELD_VALIDITY,
+                        USER_FIELD_USERID)
 )
 
-func (user *sqlUsers)createUserTable(sqlds *postgreSqlDataStore,
-                                     handle interface{}) error{
-    log := logging.GetAppLoggerObj()
-    execPtr, err := sqlds.getDBExecFunction(handle)
-    if err != nil {
-        log.Error("Failed to create user table, invalid DB handle err : %s",
-                   err)
-        return err
-    }
-    _, err = execPtr(userchema)
-    if err != nil {
-        log.Error("Failed to create User table %s", err)
-        return fmt.Errorf("%s",
-                        errorset.ERROR_TYPES[errorset.DB_TABLE_CREATE_FAILED])
-    }
-    return nil
-}
-
 //Function to translate sqlUser elements to DB format to operate on DB
 func (user *sqlUsers)usertoDBRowXlate() *sqlDBUsers {
     dbuser := new(sqlDBUsers)
@@ -151,38 +129,13 @@ func (user *sqlUsers)DBtoUserRowXlate(dbrow *sqlDBUsers) {
     user.dob = dbrow.Dob
     user.mobileno = dbrow.Mobileno
     user.startTime = dbrow.StartTime
-    user.status = userStatusBit(dbrow.Status)
-    validity, res :=dbrow.Validity.Value()
-    if res != nil {
-        user.validity, _ = validity.(uint64)
+    user.status = UserStatusBit(dbrow.Status)
+    user.validity = 0
+    if dbrow.Validity.Valid {
+        user.validity = uint64(dbrow.Validity.Int64)
     }
 }
 
-func (user *sqlUsers)getUserwithIDPwd(sqlds *postgreSqlDataStore,
-                                     handle interface{}) error {
-    log := logging.GetAppLoggerObj()
-    getPtr, err := sqlds.getDBGetFunction(handle)
-    if err != nil {
-        log.Error("Failed to get user entry %s, invalid DB handle err : %s",
-                   user.userid, err)
-        return err
-    }
-    if len(user.userid) == 0  || len(user.hashpwd) == 0{
-        log.Info("Empty userID/Pwd cannot find in user table")
-        return fmt.Errorf("%s",
-                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
-    }
-    var row sqlDBUsers
-    err = getPtr(&row, userGetonUserIDPwd, user.userid, user.hashpwd)
-    if err != nil {
-        log.Trace("Failed to read user record for userid %s, err : %s",
-                        user.userid, err)
-        return err
-    }
-    user.DBtoUserRowXlate(&row)
-    return nil
-}
-
 func (user *sqlUsers)getUserwithID(sqlds *postgreSqlDataStore,
                                      handle interface{}) error {
     log := logging.GetAppLoggerObj()
@@ -234,7 +187,8 @@ func (user *sqlUsers)createUserEntry(sqlds *postgreSqlDataStore,
     }
     if err == nil {
         log.Info("%s user record already present in system", user.userid)
-        return nil
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE])
     }
     // now we are at 'err == sql.ErrNoRows'
     user.startTime = time.Now()
@@ -290,12 +244,37 @@ func (user *sqlUsers)updateUserEntry(sqlds *postgreSqlDataStore,
     }
     // Not validating if fields need an update really.
     dbrow := user.usertoDBRowXlate()
-    _, err = execPtr(userUpdateOnID, dbrow.Emailid, dbrow.Hashpwd,
-                    dbrow.Mobileno, dbrow.Status, dbrow.Validity)
+    res, err := execPtr(userUpdateOnID, dbrow.Emailid, dbrow.Hashpwd,
+                    dbrow.Mobileno, dbrow.Status, dbrow.Validity,
+                    dbrow.Userid)
     if err != nil {
         log.Info("Failed to update the user entry %s error : %s",
                 dbrow.Userid, err)
         return err
     }
+    if cnt, _ := res.RowsAffected(); cnt == 0 {
+        log.Info("Cannot update user record %s, not present", user.userid)
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND])
+    }
+    return nil
+}
+
+//Function to update only the password hash of the user.
+func (user *sqlUsers)updateUserPwd(sqlds *postgreSqlDataStore,
+                                   handle interface{}) error {
+    log := logging.GetAppLoggerObj()
+    execPtr, err := sqlds.getDBExecFunction(handle)
+    if err != nil {
+        log.Error("Failed to update user pwd %s, invalid DB handle err : %s",
+                    user.userid, err)
+        return err
+    }
+    _, err = execPtr(userUpdatePwd, user.hashpwd, user.userid)
+    if err != nil {
+        log.Info("Failed to update the user pwd %s error : %s",
+                user.userid, err)
+        return err
+    }
     return nil
 }
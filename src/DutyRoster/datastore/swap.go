@@ -0,0 +1,312 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+    "time"
+    "DutyRoster/syncParam"
+)
+
+//Kind of trade offered on an assignment.
+type SwapKindBit uint64
+
+const (
+    //Exchange the assignment with an assignment of another user, only the
+    // owner of the target assignment can accept it.
+    SWAP_DIRECT SwapKindBit = 1 << iota
+    //Give the assignment away, any member of the org/unit can take it.
+    SWAP_GIVEAWAY SwapKindBit = 1 << iota
+    //Last entry in the swap kind. Give the assignment away to a member who
+    // is available for the shift and not on leave.
+    SWAP_PICKUP SwapKindBit = 1 << iota
+)
+
+//Status of a swap offer. An offer taken by a user is completed directly, or
+// accepted and completed after the approval when the org/unit needs it.
+type SwapStatusBit uint64
+
+const (
+    SWAP_OPEN SwapStatusBit = 1 << iota
+    SWAP_ACCEPTED SwapStatusBit = 1 << iota
+    SWAP_COMPLETED SwapStatusBit = 1 << iota
+    SWAP_REJECTED SwapStatusBit = 1 << iota
+    //Last entry in the swap status. Do not add anything below cancel status.
+    SWAP_CANCELLED SwapStatusBit = 1 << iota
+)
+
+//Maximum length of note in swap audit record.
+const SWAP_NOTE_STR_LEN = 500
+
+//Swap rules of an org/unit, the rules apply to the org/unit and descendants
+// that have no rules of their own.
+type SwapSettings struct {
+    orgUUID syncParam.UUID
+    //Minimum rest between the shifts of a user after the trade.
+    minRest time.Duration
+    //Role that approves the trades, 0 when trades need no approval.
+    approverRole RoleBit
+}
+
+//Offer of an assignment on the swap marketplace.
+type SwapOffer struct {
+    uuid syncParam.UUID
+    orgUUID syncParam.UUID
+    //Assignment offered, and the userid of its owner.
+    assignmentUUID syncParam.UUID
+    offeredBy string
+    kind SwapKindBit
+    //Assignment asked in exchange, only for a direct swap.
+    targetAssignmentUUID syncParam.UUID
+    //userid of the user who accepted the offer.
+    takenBy string
+    status SwapStatusBit
+    //Approver role of the org/unit when the offer is created.
+    approverRole RoleBit
+    //timestamp when the offer is created.
+    createTime time.Time
+    //userid of the user who approved/rejected/cancelled the offer.
+    decidedBy string
+    decideTime time.Time
+}
+
+//Audit record of a swap offer, one record for every status of the offer.
+//Records are kept after the offer and users are deleted.
+type SwapAudit struct {
+    uuid syncParam.UUID
+    offerUUID syncParam.UUID
+    orgUUID syncParam.UUID
+    //Status the offer moved to.
+    status SwapStatusBit
+    //userid of the user who moved the offer.
+    actor string
+    auditTime time.Time
+    note string
+}
+
+//Swap rules of org/unit 'orgUUID'.
+func NewSwapSettings(orgUUID syncParam.UUID, minRest time.Duration,
+                     approverRole RoleBit) *SwapSettings {
+    settings := new(SwapSettings)
+    settings.orgUUID = orgUUID
+    settings.minRest = minRest
+    settings.approverRole = approverRole
+    return settings
+}
+
+//Swap rules that only carries the org/unit, used to get the rules.
+func NewSwapSettingsRef(orgUUID syncParam.UUID) *SwapSettings {
+    settings := new(SwapSettings)
+    settings.orgUUID = orgUUID
+    return settings
+}
+
+func (settings *SwapSettings)OrgUUID() syncParam.UUID {
+    return settings.orgUUID
+}
+
+func (settings *SwapSettings)MinRest() time.Duration {
+    return settings.minRest
+}
+
+func (settings *SwapSettings)ApproverRole() RoleBit {
+    return settings.approverRole
+}
+
+//Validate the swap rules before storing it, approver role must be a single
+// role bit.
+func (settings *SwapSettings)IsSwapSettingsValid() bool {
+    if syncParam.IsUUIDEmpty(settings.orgUUID) || settings.minRest < 0 {
+        return false
+    }
+    role := settings.approverRole
+    return role == 0 || (role <= MAX_ROLEBIT && role & (role - 1) == 0)
+}
+
+//Offer the assignment 'assignmentUUID' of user 'offeredBy'. The target
+// assignment is used only for a direct swap. uuid, org/unit and createTime
+// are populated when the offer is created in the datastore.
+func NewSwapOffer(assignmentUUID syncParam.UUID, offeredBy string,
+                  kind SwapKindBit,
+                  targetAssignmentUUID syncParam.UUID) *SwapOffer {
+    offer := new(SwapOffer)
+    offer.assignmentUUID = assignmentUUID
+    offer.offeredBy = offeredBy
+    offer.kind = kind
+    if kind == SWAP_DIRECT {
+        offer.targetAssignmentUUID = targetAssignmentUUID
+    }
+    offer.status = SWAP_OPEN
+    return offer
+}
+
+//Swap offer that only carries the uuid, used to get/update the offer.
+func NewSwapOfferRef(uuid syncParam.UUID) *SwapOffer {
+    offer := new(SwapOffer)
+    offer.uuid = uuid
+    return offer
+}
+
+func (offer *SwapOffer)UUID() syncParam.UUID {
+    return offer.uuid
+}
+
+func (offer *SwapOffer)OrgUUID() syncParam.UUID {
+    return offer.orgUUID
+}
+
+func (offer *SwapOffer)AssignmentUUID() syncParam.UUID {
+    return offer.assignmentUUID
+}
+
+func (offer *SwapOffer)OfferedBy() string {
+    return offer.offeredBy
+}
+
+func (offer *SwapOffer)Kind() SwapKindBit {
+    return offer.kind
+}
+
+func (offer *SwapOffer)TargetAssignmentUUID() syncParam.UUID {
+    return offer.targetAssignmentUUID
+}
+
+func (offer *SwapOffer)TakenBy() string {
+    return offer.takenBy
+}
+
+func (offer *SwapOffer)Status() SwapStatusBit {
+    return offer.status
+}
+
+func (offer *SwapOffer)ApproverRole() RoleBit {
+    return offer.approverRole
+}
+
+func (offer *SwapOffer)CreateTime() time.Time {
+    return offer.createTime
+}
+
+func (offer *SwapOffer)DecidedBy() string {
+    return offer.decidedBy
+}
+
+func (offer *SwapOffer)DecideTime() time.Time {
+    return offer.decideTime
+}
+
+//Return true if the offer is still on the marketplace, ie: open or waiting
+// for the approval.
+func (offer *SwapOffer)IsPending() bool {
+    return offer.status == SWAP_OPEN || offer.status == SWAP_ACCEPTED
+}
+
+//Status of the offer when a user takes it, accepted when the offer needs
+// the approval and completed otherwise.
+func (offer *SwapOffer)TakeStatus() SwapStatusBit {
+    if offer.approverRole != 0 {
+        return SWAP_ACCEPTED
+    }
+    return SWAP_COMPLETED
+}
+
+//Validate the swap offer fields before storing it.
+func (offer *SwapOffer)IsSwapOfferValid() bool {
+    if syncParam.IsUUIDEmpty(offer.assignmentUUID) ||
+        len(offer.offeredBy) == 0 {
+        return false
+    }
+    switch(offer.kind) {
+        case SWAP_DIRECT:
+            if syncParam.IsUUIDEmpty(offer.targetAssignmentUUID) ||
+                offer.targetAssignmentUUID == offer.assignmentUUID {
+                return false
+            }
+        case SWAP_GIVEAWAY, SWAP_PICKUP:
+        default:
+            return false
+    }
+    var maxSwapBit SwapStatusBit = (SWAP_CANCELLED << 1) - 1 //All 0xFs.
+    return offer.status >= SWAP_OPEN && offer.status <= maxSwapBit
+}
+
+//Return true if the offer can move from status 'from' to 'to'. An accepted
+// offer is completed at once when the org/unit has no approver role,
+// otherwise it waits for the approval.
+func IsSwapTransitionValid(from SwapStatusBit, to SwapStatusBit,
+                           approverRole RoleBit) bool {
+    switch(from) {
+        case SWAP_OPEN:
+            if to == SWAP_ACCEPTED {
+                return approverRole != 0
+            }
+            if to == SWAP_COMPLETED {
+                return approverRole == 0
+            }
+            return to == SWAP_CANCELLED
+        case SWAP_ACCEPTED:
+            return to == SWAP_COMPLETED || to == SWAP_REJECTED ||
+                   to == SWAP_CANCELLED
+    }
+    return false
+}
+
+func (audit *SwapAudit)UUID() syncParam.UUID {
+    return audit.uuid
+}
+
+func (audit *SwapAudit)OfferUUID() syncParam.UUID {
+    return audit.offerUUID
+}
+
+func (audit *SwapAudit)OrgUUID() syncParam.UUID {
+    return audit.orgUUID
+}
+
+func (audit *SwapAudit)Status() SwapStatusBit {
+    return audit.status
+}
+
+func (audit *SwapAudit)Actor() string {
+    return audit.actor
+}
+
+func (audit *SwapAudit)AuditTime() time.Time {
+    return audit.auditTime
+}
+
+func (audit *SwapAudit)Note() string {
+    return audit.note
+}
+
+//Return true when a user holding the 'shifts' can take the shift 'newShift'
+// without working two shifts at a time or resting less than 'minRest'
+// between the shifts. Cancelled shifts are not worked and skipped.
+func isTradeValid(shifts []Shift, newShift *Shift,
+                  minRest time.Duration) bool {
+    for i := range(shifts) {
+        if shifts[i].uuid == newShift.uuid {
+            //Already on the shift.
+            return false
+        }
+        if shifts[i].IsCancelled() {
+            continue
+        }
+        if newShift.startTime.Before(shifts[i].endTime.Add(minRest)) &&
+            shifts[i].startTime.Before(newShift.endTime.Add(minRest)) {
+            return false
+        }
+    }
+    return true
+}
@@ -16,14 +16,15 @@ package datastore
 
 import (
     "time"
+    "DutyRoster/syncParam"
 )
 
-type userStatusBit uint64
+type UserStatusBit uint64
 const (
-    USER_REQUESTED userStatusBit = 1 << iota
-    USER_APPROVED userStatusBit = 1 << iota
+    USER_REQUESTED UserStatusBit = 1 << iota
+    USER_APPROVED UserStatusBit = 1 << iota
     //Last entry in the org status. Do not add anything below the delete status.
-    USER_DELETED userStatusBit = 1 << iota
+    USER_DELETED UserStatusBit = 1 << iota
 )
 
 type Users struct {
@@ -38,15 +39,130 @@ type Users struct {
     //validity of userrecord, Needed for bookkeeping.
     validity uint64
     //Status of user record.
-    status userStatusBit
+    status UserStatusBit
 }
 
 //Structure to track link between user, roles and Org.
 // Each user entry will have specific role in every org/unit
-type userOrgRole struct {
+type UserOrgRole struct {
     //Anonymous User account
     *Users
     *roles
-    *org
+    *Org
+}
+
+//Create a user account 'userid'. startTime is populated when the user is
+// created in the datastore.
+func NewUser(userid string, emailid string, hashpwd string, mobileno string,
+             dob time.Time, status UserStatusBit, validity uint64) *Users {
+    user := new(Users)
+    user.userid = userid
+    user.emailid = emailid
+    user.hashpwd = hashpwd
+    user.mobileno = mobileno
+    //dob is a calendar date, kept as the midnight of the date in UTC.
+    user.dob = time.Date(dob.Year(), dob.Month(), dob.Day(), 0, 0, 0, 0,
+                         time.UTC)
+    user.status = status
+    user.validity = validity
+    return user
+}
+
+//User that only carries the userid, used to get/delete the user.
+func NewUserRef(userid string) *Users {
+    user := new(Users)
+    user.userid = userid
+    return user
+}
+
+func (user *Users)Userid() string {
+    return user.userid
+}
+
+func (user *Users)Emailid() string {
+    return user.emailid
+}
+
+func (user *Users)Mobileno() string {
+    return user.mobileno
+}
+
+func (user *Users)Dob() time.Time {
+    return user.dob
+}
+
+func (user *Users)StartTime() time.Time {
+    return user.startTime
+}
+
+func (user *Users)Validity() uint64 {
+    return user.validity
+}
+
+func (user *Users)Status() UserStatusBit {
+    return user.status
+}
+
+//Return true when the account is deleted or its validity is over at 'now'.
+//Validity is in days from the creation of account, 0 for unlimited validity.
+func (user *Users)IsInactive(now time.Time) bool {
+    if user.status & USER_DELETED != 0 {
+        return true
+    }
+    if user.validity == 0 {
+        return false
+    }
+    return now.After(user.startTime.AddDate(0, 0, int(user.validity)))
+}
+
+//Return true if the account is approved, users in requested state cannot
+// log in.
+func (user *Users)IsApproved() bool {
+    return user.status & USER_APPROVED != 0
+}
+
+//Only emailid, hashpwd, mobileno, status and validity are allowed to modify on
+// an existing user.
+func (user *Users)SetEmailid(emailid string) {
+    user.emailid = emailid
+}
+
+//hashpwd must be made by credentials.HashPassword, never a plain password.
+func (user *Users)SetHashpwd(hashpwd string) {
+    user.hashpwd = hashpwd
+}
+
+func (user *Users)SetMobileno(mobileno string) {
+    user.mobileno = mobileno
+}
+
+func (user *Users)SetStatus(status UserStatusBit) {
+    user.status = status
+}
+
+func (user *Users)SetValidity(validity uint64) {
+    user.validity = validity
+}
+
+//Membership of user 'userid' holding 'role' bits in org/unit 'orgUUID'.
+func NewUserOrgRole(userid string, role RoleBit,
+                    orgUUID syncParam.UUID) *UserOrgRole {
+    member := new(UserOrgRole)
+    member.Users = new(Users)
+    member.userid = userid
+    member.roles = new(roles)
+    member.roleType = role
+    member.Org = NewOrgRef(orgUUID)
+    return member
+}
+
+//Role bits held by the user in the org/unit.
+func (member *UserOrgRole)RoleType() RoleBit {
+    return member.roleType
+}
+
+//Return true if the membership has all the role bits in 'role'.
+func (member *UserOrgRole)HasRole(role RoleBit) bool {
+    return member.roleType & role == role
 }
 
@@ -37,6 +37,29 @@ const (
     DB_PARENT_RECORD_NOT_FOUND
     DB_RECORD_NOT_UNIQUE
     DB_RECORD_RELATION_ERROR
+    SCHEDULE_INFEASIBLE
+    DB_SCHEMA_OUTDATED
+    DB_SCHEMA_CHECKSUM_MISMATCH
+    INVALID_CREDENTIALS
+    INVALID_TOKEN
+    USER_ACCOUNT_INACTIVE
+    ACCESS_DENIED
+    ROLE_LIMIT_REACHED
+    LEAVE_INVALID_TRANSITION
+    LEAVE_BALANCE_INSUFFICIENT
+    LEAVE_CONFLICT
+    SWAP_INVALID_TRANSITION
+    SWAP_NOT_ELIGIBLE
+    SWAP_RULE_VIOLATION
+    RECURRENCE_RULE_INVALID
+    PATTERN_RANGE_TOO_LARGE
+    TIME_ZONE_INVALID
+    CALENDAR_FILE_INVALID
+    SKILL_REQUIREMENT_NOT_MET
+    SCHEDULE_SEARCH_LIMIT
+    USER_ACCOUNT_NOT_APPROVED
+    ORG_NOT_ACTIVE
+    ROSTER_RANGE_TOO_LARGE
 )
 
 var ERROR_TYPES = []string{
@@ -61,4 +84,50 @@ var ERROR_TYPES = []string{
     //DB_RECORD_NOT_UNIQUE
     "More than one record found in DB",
     //DB_RECORD_RELATION_ERROR
-    "Error in DB record relation/no valid relation found"}
\ No newline at end of file
+    "Error in DB record relation/no valid relation found",
+    //SCHEDULE_INFEASIBLE
+    "Cannot generate roster, hard constraints cannot be satisfied",
+    //DB_SCHEMA_OUTDATED
+    "DB schema is not at the latest version, run 'migrate up'",
+    //DB_SCHEMA_CHECKSUM_MISMATCH
+    "Applied DB schema migration is modified/unknown to application",
+    //INVALID_CREDENTIALS
+    "Invalid userid/password",
+    //INVALID_TOKEN
+    "Invalid/expired/revoked token",
+    //USER_ACCOUNT_INACTIVE
+    "User account is deleted/expired",
+    //ACCESS_DENIED
+    "User is not authorized for the operation",
+    //ROLE_LIMIT_REACHED
+    "No free role bit left to create the role",
+    //LEAVE_INVALID_TRANSITION
+    "Leave request cannot be moved to the requested status",
+    //LEAVE_BALANCE_INSUFFICIENT
+    "Leave balance is not sufficient for the request",
+    //LEAVE_CONFLICT
+    "User is on approved leave in the requested time",
+    //SWAP_INVALID_TRANSITION
+    "Swap offer cannot be moved to the requested status",
+    //SWAP_NOT_ELIGIBLE
+    "User is not eligible to take the swap offer",
+    //SWAP_RULE_VIOLATION
+    "Trade breaks the rest time or double booking rules",
+    //RECURRENCE_RULE_INVALID
+    "Invalid/unsupported recurrence rule",
+    //PATTERN_RANGE_TOO_LARGE
+    "Too many shift occurrences in the range, expand a smaller range",
+    //TIME_ZONE_INVALID
+    "Unknown time zone, expected an IANA zone name eg: Europe/Berlin",
+    //CALENDAR_FILE_INVALID
+    "Invalid/unsupported iCalendar file",
+    //SKILL_REQUIREMENT_NOT_MET
+    "User does not hold the skills required for the shift",
+    //SCHEDULE_SEARCH_LIMIT
+    "Roster search is stopped at the step limit, try a smaller range",
+    //USER_ACCOUNT_NOT_APPROVED
+    "User account is not approved yet",
+    //ORG_NOT_ACTIVE
+    "Org/unit is not approved yet or is deleted/expired",
+    //ROSTER_RANGE_TOO_LARGE
+    "Roster range is too large, generate a smaller range"}
\ No newline at end of file
@@ -0,0 +1,323 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ical
+
+//******************************************************************************
+// iCalendar (RFC 5545) writer for the roster feeds and reader for the imported
+// calendars. Events are written in the time zone of the calendar with a
+// VTIMEZONE block that carries all the offset changes of the zone in the span
+// of the events, so the clients do not need their own zone database. A
+// cancelled event is kept in the calendar with the cancelled status, the
+// clients remove it on the next refresh.
+//******************************************************************************
+import (
+    "io"
+    "fmt"
+    "time"
+    "strings"
+)
+
+//Product identifier of the calendars.
+const PRODID = "-//DutyRoster//Roster Feed//EN"
+
+//Maximum length of a content line in octets, longer lines are folded.
+const MAX_LINE_LEN = 75
+
+//Local date-time and UTC date-time formats of RFC 5545.
+const (
+    LOCAL_TIME_FORMAT = "20060102T150405"
+    UTC_TIME_FORMAT = "20060102T150405Z"
+    DATE_FORMAT = "20060102"
+)
+
+//Interval to look for the offset changes of a zone, no zone changes its offset
+// twice within a day.
+const ZONE_SCAN_STEP = 24 * time.Hour
+
+//A single event of the calendar.
+type Event struct {
+    //Unique id of the event, must be stable across the revisions.
+    uid string
+    summary string
+    description string
+    startTime time.Time
+    endTime time.Time
+    //Revision of the event, clients replace an event only with a higher
+    // sequence.
+    sequence uint64
+    //timestamp of the revision.
+    modifyTime time.Time
+    cancelled bool
+    //Event on whole days, the times are at the midnight UTC of the dates.
+    allDay bool
+    //Recurrence rule of a read event in RRULE form, empty when the event
+    // does not repeat.
+    rule string
+}
+
+//Calendar of events in time zone 'loc'.
+type Calendar struct {
+    name string
+    loc *time.Location
+    events []*Event
+}
+
+//Offset change of a time zone.
+type zoneTransition struct {
+    at time.Time
+    offsetFrom int
+    offsetTo int
+    name string
+    isDST bool
+}
+
+//Create an event 'uid' in the period [startTime, endTime).
+func NewEvent(uid string, summary string, startTime time.Time,
+              endTime time.Time) *Event {
+    ev := new(Event)
+    ev.uid = uid
+    ev.summary = summary
+    ev.startTime = startTime
+    ev.endTime = endTime
+    return ev
+}
+
+func (ev *Event)SetDescription(description string) {
+    ev.description = description
+}
+
+//Set the revision of the event and the time it is made.
+func (ev *Event)SetRevision(sequence uint64, modifyTime time.Time) {
+    ev.sequence = sequence
+    ev.modifyTime = modifyTime
+}
+
+func (ev *Event)SetCancelled(cancelled bool) {
+    ev.cancelled = cancelled
+}
+
+func (ev *Event)UID() string {
+    return ev.uid
+}
+
+func (ev *Event)Summary() string {
+    return ev.summary
+}
+
+func (ev *Event)Description() string {
+    return ev.description
+}
+
+func (ev *Event)StartTime() time.Time {
+    return ev.startTime
+}
+
+func (ev *Event)EndTime() time.Time {
+    return ev.endTime
+}
+
+func (ev *Event)IsCancelled() bool {
+    return ev.cancelled
+}
+
+func (ev *Event)IsAllDay() bool {
+    return ev.allDay
+}
+
+func (ev *Event)Rule() string {
+    return ev.rule
+}
+
+//Create an empty calendar 'name' in the time zone 'loc', UTC when nil.
+func NewCalendar(name string, loc *time.Location) *Calendar {
+    cal := new(Calendar)
+    cal.name = name
+    cal.loc = loc
+    if cal.loc == nil {
+        cal.loc = time.UTC
+    }
+    return cal
+}
+
+func (cal *Calendar)AddEvent(ev *Event) {
+    cal.events = append(cal.events, ev)
+}
+
+//Escape the special characters of a TEXT value.
+func escapeText(value string) string {
+    replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`,
+                                    "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+    return replacer.Replace(value)
+}
+
+//Fold the content line at MAX_LINE_LEN octets, a line is never split within a
+// UTF-8 character.
+func foldLine(line string) string {
+    var sb strings.Builder
+    limit := MAX_LINE_LEN
+    for len(line) > limit {
+        cut := limit
+        for cut > 0 && line[cut] & 0xC0 == 0x80 {
+            cut--
+        }
+        sb.WriteString(line[:cut])
+        sb.WriteString("\r\n ")
+        line = line[cut:]
+        //The leading space of continuation line is part of the limit.
+        limit = MAX_LINE_LEN - 1
+    }
+    sb.WriteString(line)
+    sb.WriteString("\r\n")
+    return sb.String()
+}
+
+//Format the UTC offset in seconds as [+-]hhmm[ss].
+func formatOffset(offset int) string {
+    sign := "+"
+    if offset < 0 {
+        sign = "-"
+        offset = -offset
+    }
+    if offset % 60 != 0 {
+        return fmt.Sprintf("%s%02d%02d%02d", sign, offset / 3600,
+                           offset % 3600 / 60, offset % 60)
+    }
+    return fmt.Sprintf("%s%02d%02d", sign, offset / 3600, offset % 3600 / 60)
+}
+
+//Offset changes of zone 'loc' in the period (from, to].
+func zoneTransitions(loc *time.Location, from time.Time,
+                     to time.Time) []zoneTransition {
+    transitions := []zoneTransition{}
+    _, offset := from.In(loc).Zone()
+    for at := from.Truncate(time.Second); at.Before(to); {
+        next := at.Add(ZONE_SCAN_STEP)
+        _, nextOffset := next.In(loc).Zone()
+        if nextOffset == offset {
+            at = next
+            continue
+        }
+        //Find the first second of the new offset.
+        low, high := at, next
+        for high.Sub(low) > time.Second {
+            mid := low.Add(high.Sub(low) / 2).Truncate(time.Second)
+            if _, midOffset := mid.In(loc).Zone(); midOffset == offset {
+                low = mid
+            } else {
+                high = mid
+            }
+        }
+        name, _ := high.In(loc).Zone()
+        transitions = append(transitions, zoneTransition{at : high,
+                                offsetFrom : offset, offsetTo : nextOffset,
+                                name : name, isDST : high.In(loc).IsDST()})
+        offset = nextOffset
+        at = high
+    }
+    return transitions
+}
+
+//Write an observance of VTIMEZONE, 'at' is the onset in UTC.
+func writeObservance(sb *strings.Builder, tr *zoneTransition) {
+    kind := "STANDARD"
+    if tr.isDST {
+        kind = "DAYLIGHT"
+    }
+    //Onset is in the local time before the change.
+    onset := tr.at.UTC().Add(time.Duration(tr.offsetFrom) * time.Second)
+    sb.WriteString(foldLine("BEGIN:" + kind))
+    sb.WriteString(foldLine("DTSTART:" + onset.Format(LOCAL_TIME_FORMAT)))
+    sb.WriteString(foldLine("TZOFFSETFROM:" + formatOffset(tr.offsetFrom)))
+    sb.WriteString(foldLine("TZOFFSETTO:" + formatOffset(tr.offsetTo)))
+    if len(tr.name) != 0 {
+        sb.WriteString(foldLine("TZNAME:" + escapeText(tr.name)))
+    }
+    sb.WriteString(foldLine("END:" + kind))
+}
+
+//Write the VTIMEZONE of the calendar zone for the period [from, to). The first
+// observance holds the offset at 'from', followed by all the offset changes
+// in the period.
+func (cal *Calendar)writeTimezone(sb *strings.Builder, from time.Time,
+                                  to time.Time) {
+    name, offset := from.In(cal.loc).Zone()
+    first := zoneTransition{at : from, offsetFrom : offset, offsetTo : offset,
+                            name : name, isDST : from.In(cal.loc).IsDST()}
+    sb.WriteString(foldLine("BEGIN:VTIMEZONE"))
+    sb.WriteString(foldLine("TZID:" + cal.loc.String()))
+    writeObservance(sb, &first)
+    transitions := zoneTransitions(cal.loc, from, to)
+    for i := range(transitions) {
+        writeObservance(sb, &transitions[i])
+    }
+    sb.WriteString(foldLine("END:VTIMEZONE"))
+}
+
+//Write an event with the times in the calendar zone.
+func (cal *Calendar)writeEvent(sb *strings.Builder, ev *Event) {
+    tzid := ";TZID=" + cal.loc.String() + ":"
+    status := "CONFIRMED"
+    if ev.cancelled {
+        status = "CANCELLED"
+    }
+    sb.WriteString(foldLine("BEGIN:VEVENT"))
+    sb.WriteString(foldLine("UID:" + ev.uid))
+    sb.WriteString(foldLine("DTSTAMP:" +
+                            ev.modifyTime.UTC().Format(UTC_TIME_FORMAT)))
+    sb.WriteString(foldLine("DTSTART" + tzid +
+                        ev.startTime.In(cal.loc).Format(LOCAL_TIME_FORMAT)))
+    sb.WriteString(foldLine("DTEND" + tzid +
+                        ev.endTime.In(cal.loc).Format(LOCAL_TIME_FORMAT)))
+    sb.WriteString(foldLine("SEQUENCE:" + fmt.Sprintf("%d", ev.sequence)))
+    sb.WriteString(foldLine("LAST-MODIFIED:" +
+                            ev.modifyTime.UTC().Format(UTC_TIME_FORMAT)))
+    sb.WriteString(foldLine("SUMMARY:" + escapeText(ev.summary)))
+    if len(ev.description) != 0 {
+        sb.WriteString(foldLine("DESCRIPTION:" +
+                                escapeText(ev.description)))
+    }
+    sb.WriteString(foldLine("STATUS:" + status))
+    sb.WriteString(foldLine("END:VEVENT"))
+}
+
+//Write the calendar to 'w' as an iCalendar stream.
+func (cal *Calendar)Write(w io.Writer) error {
+    var sb strings.Builder
+    sb.WriteString(foldLine("BEGIN:VCALENDAR"))
+    sb.WriteString(foldLine("VERSION:2.0"))
+    sb.WriteString(foldLine("PRODID:" + PRODID))
+    sb.WriteString(foldLine("CALSCALE:GREGORIAN"))
+    sb.WriteString(foldLine("METHOD:PUBLISH"))
+    sb.WriteString(foldLine("X-WR-CALNAME:" + escapeText(cal.name)))
+    sb.WriteString(foldLine("X-WR-TIMEZONE:" + cal.loc.String()))
+    if len(cal.events) != 0 {
+        from, to := cal.events[0].startTime, cal.events[0].endTime
+        for _, ev := range(cal.events) {
+            if ev.startTime.Before(from) {
+                from = ev.startTime
+            }
+            if ev.endTime.After(to) {
+                to = ev.endTime
+            }
+        }
+        cal.writeTimezone(&sb, from, to)
+    }
+    for _, ev := range(cal.events) {
+        cal.writeEvent(&sb, ev)
+    }
+    sb.WriteString(foldLine("END:VCALENDAR"))
+    _, err := io.WriteString(w, sb.String())
+    return err
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ical
+
+import (
+    "io"
+    "fmt"
+    "time"
+    "bufio"
+    "strings"
+    "DutyRoster/errorset"
+)
+
+//Maximum length of an unfolded content line and number of events read from a
+// stream, a stream beyond the limits is rejected.
+const (
+    MAX_READ_LINE_LEN = 64 * 1024
+    MAX_READ_EVENTS = 10000
+)
+
+//A content line, eg: 'DTSTART;VALUE=DATE:20261225'.
+type contentLine struct {
+    name string
+    params map[string]string
+    value string
+}
+
+func invalidCalendar() error {
+    return fmt.Errorf("%s",
+                      errorset.ERROR_TYPES[errorset.CALENDAR_FILE_INVALID])
+}
+
+//Reverse of escapeText.
+func unescapeText(value string) string {
+    replacer := strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",",
+                                    `\n`, "\n", `\N`, "\n")
+    return replacer.Replace(value)
+}
+
+//Split a content line into name, params and value. The quoted param values
+// can have the ':' and ';'.
+func parseContentLine(line string) (*contentLine, error) {
+    cl := &contentLine{params : make(map[string]string)}
+    quoted := false
+    fields := []string{}
+    start := 0
+    for i := 0; i < len(line); i++ {
+        switch {
+        case line[i] == '"':
+            quoted = !quoted
+        case !quoted && line[i] == ';':
+            fields = append(fields, line[start:i])
+            start = i + 1
+        case !quoted && line[i] == ':':
+            fields = append(fields, line[start:i])
+            cl.value = line[i + 1:]
+            start = -1
+        }
+        if start < 0 {
+            break
+        }
+    }
+    if start >= 0 || len(fields[0]) == 0 {
+        return nil, invalidCalendar()
+    }
+    cl.name = strings.ToUpper(fields[0])
+    for _, param := range(fields[1:]) {
+        kv := strings.SplitN(param, "=", 2)
+        if len(kv) != 2 {
+            return nil, invalidCalendar()
+        }
+        cl.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+    }
+    return cl, nil
+}
+
+//Parse the DATE or DATE-TIME value of the line. A date is at the midnight UTC
+// and a floating time is taken in UTC, a time with an unknown TZID is an
+// error.
+func parseTimeValue(cl *contentLine) (time.Time, bool, error) {
+    if cl.params["VALUE"] == "DATE" || len(cl.value) == len(DATE_FORMAT) {
+        t, err := time.Parse(DATE_FORMAT, cl.value)
+        if err != nil {
+            return t, false, invalidCalendar()
+        }
+        return t, true, nil
+    }
+    if strings.HasSuffix(cl.value, "Z") {
+        t, err := time.Parse(UTC_TIME_FORMAT, cl.value)
+        if err != nil {
+            return t, false, invalidCalendar()
+        }
+        return t, false, nil
+    }
+    loc := time.UTC
+    if tzid, ok := cl.params["TZID"]; ok {
+        var err error
+        loc, err = time.LoadLocation(tzid)
+        if err != nil || tzid == "Local" {
+            return time.Time{}, false, invalidCalendar()
+        }
+    }
+    t, err := time.ParseInLocation(LOCAL_TIME_FORMAT, cl.value, loc)
+    if err != nil {
+        return t, false, invalidCalendar()
+    }
+    return t, false, nil
+}
+
+//Read the unfolded content lines of the stream.
+func readContentLines(r io.Reader) ([]string, error) {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 0, 4096), MAX_READ_LINE_LEN)
+    lines := []string{}
+    for scanner.Scan() {
+        line := strings.TrimRight(scanner.Text(), "\r")
+        if len(line) == 0 {
+            continue
+        }
+        //A line that starts with a space or tab continues the previous line.
+        if line[0] == ' ' || line[0] == '\t' {
+            if len(lines) == 0 {
+                return nil, invalidCalendar()
+            }
+            last := len(lines) - 1
+            lines[last] += line[1:]
+            if len(lines[last]) > MAX_READ_LINE_LEN {
+                return nil, invalidCalendar()
+            }
+            continue
+        }
+        lines = append(lines, line)
+    }
+    if scanner.Err() != nil {
+        return nil, invalidCalendar()
+    }
+    return lines, nil
+}
+
+//Read the events of an iCalendar stream. Only UID, SUMMARY, DESCRIPTION,
+// DTSTART, DTEND, RRULE and STATUS of the events are read, the other
+// properties and components are skipped. An event without DTEND ends a day
+// after an all day DTSTART, or at DTSTART.
+func ReadEvents(r io.Reader) ([]*Event, error) {
+    lines, err := readContentLines(r)
+    if err != nil {
+        return nil, err
+    }
+    if len(lines) == 0 || strings.ToUpper(lines[0]) != "BEGIN:VCALENDAR" {
+        return nil, invalidCalendar()
+    }
+    events := []*Event{}
+    var ev *Event
+    //Nesting of the components in the event, eg: VALARM.
+    depth := 0
+    for _, line := range(lines) {
+        cl, err := parseContentLine(line)
+        if err != nil {
+            return nil, err
+        }
+        value := strings.ToUpper(cl.value)
+        switch {
+        case cl.name == "BEGIN" && value == "VEVENT" && ev == nil:
+            ev = new(Event)
+            continue
+        case ev == nil:
+            continue
+        case cl.name == "BEGIN":
+            depth++
+            continue
+        case cl.name == "END" && depth > 0:
+            depth--
+            continue
+        case depth > 0:
+            continue
+        }
+        switch(cl.name) {
+        case "END":
+            if ev.startTime.IsZero() || value != "VEVENT" {
+                return nil, invalidCalendar()
+            }
+            if ev.endTime.IsZero() {
+                ev.endTime = ev.startTime
+                if ev.allDay {
+                    ev.endTime = ev.startTime.AddDate(0, 0, 1)
+                }
+            }
+            if ev.endTime.Before(ev.startTime) {
+                return nil, invalidCalendar()
+            }
+            events = append(events, ev)
+            if len(events) > MAX_READ_EVENTS {
+                return nil, invalidCalendar()
+            }
+            ev = nil
+        case "UID":
+            ev.uid = cl.value
+        case "SUMMARY":
+            ev.summary = unescapeText(cl.value)
+        case "DESCRIPTION":
+            ev.description = unescapeText(cl.value)
+        case "DTSTART":
+            ev.startTime, ev.allDay, err = parseTimeValue(cl)
+        case "DTEND":
+            ev.endTime, _, err = parseTimeValue(cl)
+        case "RRULE":
+            ev.rule = cl.value
+        case "STATUS":
+            ev.cancelled = value == "CANCELLED"
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+    if ev != nil {
+        return nil, invalidCalendar()
+    }
+    return events, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+    "fmt"
+    "DutyRoster/syncParam"
+)
+
+//Key/value attached to the logs, eg: request id or org uuid. The value keeps
+// its type in the JSON logs.
+type Field struct {
+    Key string
+    Value interface{}
+}
+
+func NewField(key string, value interface{}) Field {
+    return Field{Key : key, Value : value}
+}
+
+//Fields of a child logger, 'fields' replace the parent fields of same key.
+// A new slice is returned, parent fields are never modified as they are
+// shared with the parent logger.
+func mergeFields(parent []Field, fields []Field) []Field {
+    merged := make([]Field, 0, len(parent) + len(fields))
+    merged = append(merged, parent...)
+    for _, field := range(fields) {
+        replaced := false
+        for i := range(merged) {
+            if merged[i].Key == field.Key {
+                merged[i].Value = field.Value
+                replaced = true
+                break
+            }
+        }
+        if !replaced {
+            merged = append(merged, field)
+        }
+    }
+    return merged
+}
+
+//Value of field to write in log. Errors, UUIDs and Stringers are written as
+// strings, other values as they are.
+func (field *Field)logValue() interface{} {
+    switch value := field.Value.(type) {
+        case error:
+            return value.Error()
+        case syncParam.UUID:
+            return syncParam.UUIDtoString(value)
+        case fmt.Stringer:
+            return value.String()
+    }
+    return field.Value
+}
@@ -0,0 +1,128 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+    "fmt"
+    "strings"
+    "DutyRoster/errorset"
+)
+
+//Log levels of the packages, the packages without a level log at the default
+// level. A set is never modified, it is replaced as a whole on change so the
+// loggers can read it without lock.
+type logLevelSet struct {
+    defaultLevel int
+    packages map[string]int
+    //Lowest of all the levels, the logs below it are dropped without looking
+    // up the package of caller.
+    minLevel int
+}
+
+func newLogLevelSet(defaultLevel int, packages map[string]int) *logLevelSet {
+    set := &logLevelSet{defaultLevel : defaultLevel,
+                        packages : make(map[string]int),
+                        minLevel : defaultLevel}
+    for pkg, level := range(packages) {
+        set.packages[pkg] = level
+        if level < set.minLevel {
+            set.minLevel = level
+        }
+    }
+    return set
+}
+
+//Check if logs of 'level' from package 'pkg' are written, empty 'pkg' uses
+// the default level.
+func (set *logLevelSet)isEnabled(level int, pkg string) bool {
+    if level < set.minLevel {
+        return false
+    }
+    pkgLevel, ok := set.packages[pkg]
+    if !ok {
+        pkgLevel = set.defaultLevel
+    }
+    return level >= pkgLevel
+}
+
+//Package name of the function 'funcName', eg: datastore for
+// DutyRoster/datastore.(*Shift).UUID
+func callerPackage(funcName string) string {
+    name := funcName[strings.LastIndex(funcName, "/") + 1:]
+    dot := strings.Index(name, ".")
+    if dot < 0 {
+        return name
+    }
+    return name[:dot]
+}
+
+//Integer of the log level name, same names as in config file.
+func parseLogLevel(levelstr string) (int, error) {
+    for level, name := range(logLevelNames) {
+        if name == levelstr {
+            return level, nil
+        }
+    }
+    return Info, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+func (logger *Logging)getLevels() *logLevelSet {
+    return logger.levels.Load().(*logLevelSet)
+}
+
+// Current log levels, the default level and levels of the packages that are
+// set.
+func GetLogLevels() (string, map[string]string) {
+    set := getLoggerInstance().getLevels()
+    packages := make(map[string]string)
+    for pkg, level := range(set.packages) {
+        packages[pkg] = logLevelNames[level]
+    }
+    return logLevelNames[set.defaultLevel], packages
+}
+
+// Replace the log levels at runtime, 'defLevel' is the level of packages not
+// in 'packages', the current default is kept when it is empty. The logs
+// already queued in the logger proxy are written irrespective of the change.
+func SetLogLevels(defLevel string, packages map[string]string) error {
+    logger := getLoggerInstance()
+    defaultLevel := logger.getLevels().defaultLevel
+    var err error
+    if len(defLevel) != 0 {
+        defaultLevel, err = parseLogLevel(defLevel)
+        if err != nil {
+            return err
+        }
+    }
+    pkgLevels := make(map[string]int)
+    for pkg, levelstr := range(packages) {
+        if len(pkg) == 0 {
+            return fmt.Errorf("%s",
+                              errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+        }
+        pkgLevels[pkg], err = parseLogLevel(levelstr)
+        if err != nil {
+            return err
+        }
+    }
+    logger.levels.Store(newLogLevelSet(defaultLevel, pkgLevels))
+    return nil
+}
+
+// Revert the log levels to the levels in config file.
+func ResetLogLevels() {
+    logger := getLoggerInstance()
+    logger.levels.Store(logger.configLevels)
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package logging
+
+import (
+    "fmt"
+    "testing"
+    "DutyRoster/errorset"
+)
+
+func TestLogLevelSet(t *testing.T) {
+    set := newLogLevelSet(Warning, map[string]int{"datastore" : Trace,
+                                                  "restapi" : Error})
+    tests := []struct {
+        name string
+        level int
+        pkg string
+        want bool
+    }{
+        {"default level", Warning, "scheduler", true},
+        {"below default level", Info, "scheduler", false},
+        {"empty package", Info, "", false},
+        {"package below default", Trace, "datastore", true},
+        {"package above default", Warning, "restapi", false},
+        {"package level", Error, "restapi", true},
+    }
+    for _, test := range(tests) {
+        got := set.isEnabled(test.level, test.pkg)
+        if got != test.want {
+            t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+        }
+    }
+    if set.minLevel != Trace {
+        t.Errorf("got min level %d, want %d", set.minLevel, Trace)
+    }
+}
+
+func TestCallerPackage(t *testing.T) {
+    tests := []struct {
+        caller string
+        want string
+    }{
+        {"DutyRoster/datastore.(*Shift).UUID", "datastore"},
+        {"DutyRoster/restapi.StartServer.func1", "restapi"},
+        {"main.main", "main"},
+        {"a/b.c/d.F", "d"},
+        {"", ""},
+    }
+    for _, test := range(tests) {
+        got := callerPackage(test.caller)
+        if got != test.want {
+            t.Errorf("%s: got %q, want %q", test.caller, got, test.want)
+        }
+    }
+}
+
+//Levels changed at runtime apply to the loggers sharing the levels, the logs
+// already queued are written.
+func TestSetLogLevels(t *testing.T) {
+    defer ResetLogLevels()
+    logProxy, buf := newTestProxy(LOG_OVERFLOW_BLOCK, 10)
+    logProxy.logObj.levels = getLoggerInstance().levels
+    invalid := errorset.ERROR_TYPES[errorset.INVALID_PARAM]
+    tests := []struct {
+        name string
+        defLevel string
+        packages map[string]string
+        err string
+        //Levels after the change.
+        wantDefault string
+        wantPackages map[string]string
+        //Logs of this package written at the levels.
+        want []string
+    }{
+        {"package below default", "error", map[string]string{
+            "logging" : "trace"}, "", "error",
+         map[string]string{"logging" : "trace"},
+         []string{"trace", "info", "warning", "error"}},
+        {"package above default", "trace", map[string]string{
+            "logging" : "warning", "datastore" : "info"}, "", "trace",
+         map[string]string{"logging" : "warning", "datastore" : "info"},
+         []string{"warning", "error"}},
+        {"keep default", "", nil, "", "trace", map[string]string{},
+         []string{"trace", "info", "warning", "error"}},
+        {"invalid default", "verbose", nil, invalid, "trace",
+         map[string]string{}, []string{"trace", "info", "warning", "error"}},
+        {"invalid package level", "error", map[string]string{
+            "logging" : "all"}, invalid, "trace", map[string]string{},
+         []string{"trace", "info", "warning", "error"}},
+        {"empty package", "error", map[string]string{"" : "trace"}, invalid,
+         "trace", map[string]string{},
+         []string{"trace", "info", "warning", "error"}},
+    }
+    for _, test := range(tests) {
+        err := SetLogLevels(test.defLevel, test.packages)
+        if (err == nil && len(test.err) != 0) ||
+            (err != nil && err.Error() != test.err) {
+            t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+        }
+        defLevel, packages := GetLogLevels()
+        if defLevel != test.wantDefault ||
+            fmt.Sprint(packages) != fmt.Sprint(test.wantPackages) {
+            t.Errorf("%s: got levels %s %v, want %s %v", test.name, defLevel,
+                     packages, test.wantDefault, test.wantPackages)
+        }
+        buf.Reset()
+        logProxy.Trace("trace")
+        logProxy.Info("info")
+        logProxy.Warning("warning")
+        logProxy.Error("error")
+        //Queued logs are written even when the level is raised meanwhile.
+        queued := logProxy.logObj.getLevels()
+        SetLogLevels("error", map[string]string{"logging" : "error"})
+        logProxy.drainLogChannel()
+        logProxy.logObj.levels.Store(queued)
+        got := logMessages(buf)
+        if fmt.Sprint(got) != fmt.Sprint(test.want) {
+            t.Errorf("%s: got logs %q, want %q", test.name, got, test.want)
+        }
+    }
+    //Reset reverts to the levels in config file.
+    ResetLogLevels()
+    if getLoggerInstance().getLevels() != getLoggerInstance().configLevels {
+        t.Errorf("got levels %v after reset, want config levels",
+                 getLoggerInstance().getLevels())
+    }
+}
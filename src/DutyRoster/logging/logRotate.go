@@ -0,0 +1,287 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+    "os"
+    "io"
+    "fmt"
+    "sort"
+    "sync"
+    "time"
+    "strings"
+    "compress/gzip"
+    "path/filepath"
+)
+
+//Suffix added to the name of a rotated log file, a '.gz' follows it when the
+// file is compressed.
+const LOG_ROTATE_TIME_FORMAT = "20060102-150405"
+
+//Log file that is rotated on size and age. The writes are serialized, the
+// loggers of all levels share the file.
+type rotatingFile struct {
+    mu sync.Mutex
+    path string
+    //Limits in bytes and time to rotate the file, 0 is no limit.
+    maxSize int64
+    rotateInterval time.Duration
+    //Number of rotated files to keep, 0 keeps all.
+    maxFiles int
+    compress bool
+    fp *os.File
+    //Bytes in current file and the time its first log is written. The time
+    // is kept across restarts and Reopen, so they dont postpone the rotation.
+    size int64
+    openTime time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, rotateInterval time.Duration,
+                     maxFiles int, compress bool) (*rotatingFile, error) {
+    rf := &rotatingFile{path : path, maxSize : maxSize,
+                        rotateInterval : rotateInterval, maxFiles : maxFiles,
+                        compress : compress}
+    err := rf.open()
+    if err != nil {
+        return nil, err
+    }
+    rf.openTime = rf.fileStartTime()
+    return rf, nil
+}
+
+//Open the file at path in append mode, must be called with lock held.
+func (rf *rotatingFile)open() error {
+    fp, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+    if err != nil {
+        return err
+    }
+    info, err := fp.Stat()
+    if err != nil {
+        fp.Close()
+        return err
+    }
+    rf.fp = fp
+    rf.size = info.Size()
+    return nil
+}
+
+//Time the logs in the current file are started, must be called with lock
+// held. A rotation starts the current file, hence the time stamp of newest
+// rotated file is used. The modification time is used when the file is never
+// rotated.
+func (rf *rotatingFile)fileStartTime() time.Time {
+    if rf.size == 0 {
+        return time.Now()
+    }
+    info, err := rf.fp.Stat()
+    if err != nil {
+        return time.Now()
+    }
+    rotated, err := rf.listRotatedFiles()
+    if err != nil {
+        return info.ModTime()
+    }
+    var start time.Time
+    prefix := filepath.Base(rf.path) + "."
+    for _, file := range(rotated) {
+        stamp := strings.TrimPrefix(file.Name(), prefix)
+        rotateTime, err := time.ParseInLocation(LOG_ROTATE_TIME_FORMAT,
+                            stamp[:len(LOG_ROTATE_TIME_FORMAT)], time.Local)
+        if err == nil && rotateTime.After(start) {
+            start = rotateTime
+        }
+    }
+    if start.IsZero() || start.After(info.ModTime()) {
+        return info.ModTime()
+    }
+    return start
+}
+
+func (rf *rotatingFile)needsRotation(writeLen int) bool {
+    if rf.size == 0 {
+        return false
+    }
+    if rf.maxSize > 0 && rf.size + int64(writeLen) > rf.maxSize {
+        return true
+    }
+    return rf.rotateInterval > 0 &&
+           time.Since(rf.openTime) >= rf.rotateInterval
+}
+
+func (rf *rotatingFile)Write(p []byte) (int, error) {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+    if rf.needsRotation(len(p)) {
+        err := rf.rotate()
+        if err != nil {
+            //Keep writing to the current file rather than losing the logs.
+            fmt.Println("ERROR: Failed to rotate log file, " + err.Error())
+        }
+    }
+    if rf.fp == nil {
+        return 0, os.ErrClosed
+    }
+    if rf.size == 0 {
+        rf.openTime = time.Now()
+    }
+    n, err := rf.fp.Write(p)
+    rf.size += int64(n)
+    return n, err
+}
+
+//Name for the file rotated now, that is not taken by another rotated file.
+func (rf *rotatingFile)rotatedName() string {
+    name := rf.path + "." + time.Now().Format(LOG_ROTATE_TIME_FORMAT)
+    rotated := name
+    for i := 1; ; i++ {
+        _, err := os.Stat(rotated)
+        _, gzErr := os.Stat(rotated + ".gz")
+        if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+            return rotated
+        }
+        rotated = fmt.Sprintf("%s.%d", name, i)
+    }
+}
+
+//Move the current file aside and start a new one, must be called with lock
+// held. The writes come from the logger goroutine, hence the compression
+// and cleanup of old files are done inline, the logs queue in the
+// logger proxy meanwhile.
+func (rf *rotatingFile)rotate() error {
+    rotated := rf.rotatedName()
+    err := os.Rename(rf.path, rotated)
+    //The file is already moved away by an external tool, start a new one.
+    movedAway := os.IsNotExist(err)
+    if err != nil && !movedAway {
+        return err
+    }
+    rf.fp.Close()
+    rf.fp = nil
+    err = rf.open()
+    if err != nil || movedAway {
+        return err
+    }
+    if rf.compress {
+        err = compressFile(rotated)
+        if err != nil {
+            fmt.Println("ERROR: Failed to compress log file, " + err.Error())
+        }
+    }
+    return rf.removeOldFiles()
+}
+
+//gzip the file to 'path'.gz and remove it.
+func compressFile(path string) error {
+    src, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer src.Close()
+    dst, err := os.OpenFile(path + ".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+                            0666)
+    if err != nil {
+        return err
+    }
+    gz := gzip.NewWriter(dst)
+    _, err = io.Copy(gz, src)
+    if err == nil {
+        err = gz.Close()
+    }
+    if closeErr := dst.Close(); err == nil {
+        err = closeErr
+    }
+    if err != nil {
+        os.Remove(path + ".gz")
+        return err
+    }
+    return os.Remove(path)
+}
+
+//Check if the file 'name' in log directory is a rotated file of the log.
+func (rf *rotatingFile)isRotatedFile(name string) bool {
+    prefix := filepath.Base(rf.path) + "."
+    if !strings.HasPrefix(name, prefix) {
+        return false
+    }
+    stamp := strings.TrimPrefix(name, prefix)
+    if len(stamp) < len(LOG_ROTATE_TIME_FORMAT) {
+        return false
+    }
+    _, err := time.Parse(LOG_ROTATE_TIME_FORMAT,
+                         stamp[:len(LOG_ROTATE_TIME_FORMAT)])
+    return err == nil
+}
+
+//List the rotated files of the log in log directory.
+func (rf *rotatingFile)listRotatedFiles() ([]os.FileInfo, error) {
+    dirFp, err := os.Open(filepath.Dir(rf.path))
+    if err != nil {
+        return nil, err
+    }
+    infos, err := dirFp.Readdir(-1)
+    dirFp.Close()
+    if err != nil {
+        return nil, err
+    }
+    rotated := []os.FileInfo{}
+    for _, info := range(infos) {
+        if !info.IsDir() && rf.isRotatedFile(info.Name()) {
+            rotated = append(rotated, info)
+        }
+    }
+    return rotated, nil
+}
+
+//Delete the oldest rotated files beyond maxFiles.
+func (rf *rotatingFile)removeOldFiles() error {
+    if rf.maxFiles <= 0 {
+        return nil
+    }
+    dir := filepath.Dir(rf.path)
+    rotated, err := rf.listRotatedFiles()
+    if err != nil {
+        return err
+    }
+    if len(rotated) <= rf.maxFiles {
+        return nil
+    }
+    //Newest first, the files after maxFiles are deleted.
+    sort.Slice(rotated, func(i, j int) bool {
+        if !rotated[i].ModTime().Equal(rotated[j].ModTime()) {
+            return rotated[i].ModTime().After(rotated[j].ModTime())
+        }
+        return rotated[i].Name() > rotated[j].Name()
+    })
+    for _, info := range(rotated[rf.maxFiles:]) {
+        err = os.Remove(filepath.Join(dir, info.Name()))
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+//Close and open the file at path again, the file is moved away by an external
+// tool like logrotate. The age of the file is kept, a new empty file starts
+// its age on the first write.
+func (rf *rotatingFile)Reopen() error {
+    rf.mu.Lock()
+    defer rf.mu.Unlock()
+    if rf.fp != nil {
+        rf.fp.Close()
+        rf.fp = nil
+    }
+    return rf.open()
+}
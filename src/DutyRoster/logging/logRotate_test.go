@@ -0,0 +1,275 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package logging
+
+import (
+    "io"
+    "os"
+    "fmt"
+    "sort"
+    "time"
+    "strings"
+    "testing"
+    "compress/gzip"
+    "path/filepath"
+)
+
+//Log line 'n' of 40 bytes.
+func testLogLine(n int) []byte {
+    return []byte(fmt.Sprintf("line %02d%s\n", n, strings.Repeat(".", 32)))
+}
+
+//Names and content of the rotated files of the log at 'path', the content is
+// sorted so the lines are in order they are written. The compressed files are
+// decompressed.
+func readRotatedFiles(t *testing.T, path string) ([]string, []string) {
+    names, err := filepath.Glob(path + ".*")
+    if err != nil {
+        t.Fatalf("Cannot list rotated files, %s", err)
+    }
+    sort.Strings(names)
+    contents := []string{}
+    for _, name := range(names) {
+        fp, err := os.Open(name)
+        if err != nil {
+            t.Fatalf("Cannot open %s, %s", name, err)
+        }
+        var reader io.Reader = fp
+        if strings.HasSuffix(name, ".gz") {
+            reader, err = gzip.NewReader(fp)
+            if err != nil {
+                t.Fatalf("Cannot decompress %s, %s", name, err)
+            }
+        }
+        content, err := io.ReadAll(reader)
+        fp.Close()
+        if err != nil {
+            t.Fatalf("Cannot read %s, %s", name, err)
+        }
+        contents = append(contents, string(content))
+    }
+    sort.Strings(contents)
+    return names, contents
+}
+
+func fileSize(t *testing.T, path string) int64 {
+    info, err := os.Stat(path)
+    if err != nil {
+        t.Fatalf("Cannot stat %s, %s", path, err)
+    }
+    return info.Size()
+}
+
+//12 lines of 40 bytes in files of 100 bytes, 5 files are rotated with lines
+// 1-2, 3-4, 5-6, 7-8 and 9-10.
+func TestRotateOnSize(t *testing.T) {
+    tests := []struct {
+        name string
+        maxFiles int
+        compress bool
+        //First line of the rotated files that are kept.
+        kept []int
+    }{
+        {"keep all", 0, false, []int{1, 3, 5, 7, 9}},
+        {"max files", 2, false, []int{7, 9}},
+        {"compress", 0, true, []int{1, 3, 5, 7, 9}},
+        {"compress with max files", 2, true, []int{7, 9}},
+    }
+    for _, test := range(tests) {
+        dir := t.TempDir()
+        path := filepath.Join(dir, "app.log")
+        //Files of other logs are never removed.
+        other := filepath.Join(dir, "app.log.old")
+        err := os.WriteFile(other, []byte("other"), 0644)
+        if err != nil {
+            t.Fatalf("Cannot create file, %s", err)
+        }
+        rf, err := newRotatingFile(path, 100, 0, test.maxFiles, test.compress)
+        if err != nil {
+            t.Fatalf("%s: cannot open log file, %s", test.name, err)
+        }
+        for i := 1; i <= 12; i++ {
+            _, err = rf.Write(testLogLine(i))
+            if err != nil {
+                t.Fatalf("%s: write failed, %s", test.name, err)
+            }
+        }
+        if size := fileSize(t, path); size != 80 {
+            t.Errorf("%s: got log size %d, want 80", test.name, size)
+        }
+        if _, err = os.Stat(other); err != nil {
+            t.Errorf("%s: other file is removed, %s", test.name, err)
+        }
+        os.Remove(other)
+        names, contents := readRotatedFiles(t, path)
+        if len(names) != len(test.kept) {
+            t.Errorf("%s: got rotated files %v, want %d", test.name, names,
+                     len(test.kept))
+            continue
+        }
+        for i, first := range(test.kept) {
+            want := string(testLogLine(first)) + string(testLogLine(first + 1))
+            if contents[i] != want {
+                t.Errorf("%s: got rotated log %q, want %q", test.name,
+                         contents[i], want)
+            }
+            if strings.HasSuffix(names[i], ".gz") != test.compress {
+                t.Errorf("%s: got rotated file %s, want compress %v",
+                         test.name, names[i], test.compress)
+            }
+        }
+    }
+}
+
+func TestRotateInterval(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "app.log")
+    interval := 100 * time.Millisecond
+    rf, err := newRotatingFile(path, 0, interval, 0, false)
+    if err != nil {
+        t.Fatalf("Cannot open log file, %s", err)
+    }
+    //The age of an empty file starts at the first write.
+    time.Sleep(interval)
+    rf.Write(testLogLine(1))
+    rf.Write(testLogLine(2))
+    names, _ := readRotatedFiles(t, path)
+    if len(names) != 0 {
+        t.Errorf("got rotated files %v before the interval", names)
+    }
+    time.Sleep(interval)
+    rf.Write(testLogLine(3))
+    names, contents := readRotatedFiles(t, path)
+    want := string(testLogLine(1)) + string(testLogLine(2))
+    if len(names) != 1 || contents[0] != want {
+        t.Errorf("got rotated files %v %q, want one with %q", names, contents,
+                 want)
+    }
+    if size := fileSize(t, path); size != 40 {
+        t.Errorf("got log size %d, want 40", size)
+    }
+}
+
+//The age of the log file is kept across the restarts, the file is rotated on
+// the first write when it is older than the interval.
+func TestRotateAgeAcrossRestart(t *testing.T) {
+    now := time.Now()
+    //Time stamp of rotated files has no sub seconds.
+    rotatedAt := now.Add(-2 * time.Hour).Truncate(time.Second)
+    youngRotatedAt := now.Add(-10 * time.Minute).Truncate(time.Second)
+    tests := []struct {
+        name string
+        content string
+        //Modification time of the file and the time stamp of the newest
+        // rotated file, zero when there is none.
+        modTime time.Time
+        rotatedAt time.Time
+        rotate bool
+        //Age of the file is from 'wantStart' when not rotated.
+        wantStart time.Time
+    }{
+        {"rotated before", "old\n", now, rotatedAt, true, now},
+        {"never rotated", "old\n", now.Add(-3 * time.Hour), time.Time{}, true,
+         now},
+        {"young file", "old\n", now.Add(-10 * time.Minute), time.Time{},
+         false, now.Add(-10 * time.Minute)},
+        {"young rotated file", "old\n", now, youngRotatedAt, false,
+         youngRotatedAt},
+        {"empty file", "", now.Add(-3 * time.Hour), time.Time{}, false, now},
+    }
+    for _, test := range(tests) {
+        dir := t.TempDir()
+        path := filepath.Join(dir, "app.log")
+        err := os.WriteFile(path, []byte(test.content), 0644)
+        if err == nil {
+            err = os.Chtimes(path, test.modTime, test.modTime)
+        }
+        wantRotated := 0
+        if err == nil && !test.rotatedAt.IsZero() {
+            wantRotated++
+            err = os.WriteFile(path + "." +
+                        test.rotatedAt.Format(LOG_ROTATE_TIME_FORMAT),
+                        []byte("rotated\n"), 0644)
+        }
+        if err != nil {
+            t.Fatalf("%s: cannot create log files, %s", test.name, err)
+        }
+        if test.rotate {
+            wantRotated++
+        }
+        rf, err := newRotatingFile(path, 0, time.Hour, 0, false)
+        if err != nil {
+            t.Fatalf("%s: cannot open log file, %s", test.name, err)
+        }
+        rf.Write([]byte("new\n"))
+        names, _ := readRotatedFiles(t, path)
+        if len(names) != wantRotated {
+            t.Errorf("%s: got rotated files %v, want %d", test.name, names,
+                     wantRotated)
+        }
+        diff := rf.openTime.Sub(test.wantStart)
+        if diff < -time.Second || diff > time.Second {
+            t.Errorf("%s: got file start %v, want %v", test.name,
+                     rf.openTime, test.wantStart)
+        }
+    }
+}
+
+//SIGHUP reopens the log file, after it is moved away by logrotate. The age of
+// the file is kept on reopen.
+func TestReopenLogFile(t *testing.T) {
+    logger := getLoggerInstance()
+    savedFile := logger.logFile
+    defer func() { logger.logFile = savedFile }()
+    logger.logFile = nil
+    if err := ReopenLogFile(); err != nil {
+        t.Errorf("got error %s on reopen of stdout", err)
+    }
+    dir := t.TempDir()
+    path := filepath.Join(dir, "app.log")
+    rf, err := newRotatingFile(path, 0, time.Hour, 0, false)
+    if err != nil {
+        t.Fatalf("Cannot open log file, %s", err)
+    }
+    logger.logFile = rf
+    rf.Write(testLogLine(1))
+    openTime := rf.openTime
+    moved := filepath.Join(dir, "moved.log")
+    err = os.Rename(path, moved)
+    if err != nil {
+        t.Fatalf("Cannot move log file, %s", err)
+    }
+    //Logs go to the moved file until reopen.
+    rf.Write(testLogLine(2))
+    err = ReopenLogFile()
+    if err != nil {
+        t.Fatalf("Cannot reopen log file, %s", err)
+    }
+    if !rf.openTime.Equal(openTime) {
+        t.Errorf("got age %v after reopen, want %v", rf.openTime, openTime)
+    }
+    rf.Write(testLogLine(3))
+    if size := fileSize(t, moved); size != 80 {
+        t.Errorf("got moved log size %d, want 80", size)
+    }
+    if size := fileSize(t, path); size != 40 {
+        t.Errorf("got log size %d, want 40", size)
+    }
+    names, _ := readRotatedFiles(t, path)
+    if len(names) != 0 {
+        t.Errorf("got rotated files %v on reopen", names)
+    }
+}
@@ -20,7 +20,11 @@ import (
     "log"
     "DutyRoster/config"
     "sync"
+    "sync/atomic"
     "io"
+    "time"
+    "bytes"
+    "encoding/json"
 )
 
 const (
@@ -30,16 +34,51 @@ const (
     Error
 )
 
+//Format of the log lines.
+const (
+    //Printf style lines with level prefix, the default.
+    LOG_FORMAT_TEXT = iota
+    //One JSON object per line, with time, level, caller, msg and fields.
+    LOG_FORMAT_JSON
+)
+
+//Names of the log levels in JSON logs, same as in config file.
+var logLevelNames = []string{"trace", "info", "warning", "error"}
+
+//Keys of the JSON logs that fields cannot override.
+var reservedLogKeys = map[string]bool{"time" : true, "level" : true,
+                                      "caller" : true, "msg" : true}
+
+//A log to be written, 'caller' and 'fields' are optional.
+type logEntry struct {
+    level int
+    logTime time.Time
+    caller string
+    msg string
+    fields []Field
+}
+
 type Logging struct {
-    // loglevel can be Trace/Info/Warning/Error
-    currloglevel int
+    // loglevels can be Trace/Info/Warning/Error, holds the *logLevelSet in
+    // use. It is shared with the child loggers and changed at runtime.
+    levels *atomic.Value
+    // loglevels in config file, to revert the runtime changes.
+    configLevels *logLevelSet
     //format of the logs to be printed.
     logformatFlags int
     tracerLogger *log.Logger
     infoLogger *log.Logger
     warningLogger *log.Logger
     errorLogger *log.Logger
+    //format of the log lines, LOG_FORMAT_TEXT/LOG_FORMAT_JSON
+    logformat int
+    //Logger of the JSON lines, the lines carry their own timestamp.
+    jsonLogger *log.Logger
     fp io.Writer
+    //Log file when logs are written to a file, nil otherwise.
+    logFile *rotatingFile
+    //Fields added to all the logs, set on the child loggers by With.
+    fields []Field
 }
 
 var logconf = new(Logging)
@@ -58,15 +97,27 @@ func (logger *Logging)logInitSingleton() {
             fmt.Println("\nERROR: Cannot read configfile object\n")
             return
         }
-        logger.currloglevel = logger.getloglevelInt(conf.Logging.LogLevel)
+        pkgLevels := make(map[string]int)
+        for pkg, levelstr := range(conf.Logging.Packages) {
+            pkgLevels[pkg] = logger.getloglevelInt(levelstr)
+        }
+        logger.configLevels = newLogLevelSet(
+                        logger.getloglevelInt(conf.Logging.LogLevel), pkgLevels)
+        logger.levels = new(atomic.Value)
+        logger.levels.Store(logger.configLevels)
         logger.logformatFlags = log.Ldate | log.Ltime
+        logger.logformat = logger.getlogformatInt(conf.Logging.Format)
         if len(conf.Logging.FilePath) == 0 {
             logger.fp = stdoutHandler
         } else {
-            logger.fp, err = os.OpenFile(conf.Logging.FilePath,
-                os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+            logger.logFile, err = newRotatingFile(conf.Logging.FilePath,
+                int64(conf.Logging.MaxSize) * 1024 * 1024,
+                time.Duration(conf.Logging.RotateInterval) * time.Second,
+                int(conf.Logging.MaxFiles), conf.Logging.Compress)
             if err != nil {
                 logger.fp = stdoutHandler 
+            } else {
+                logger.fp = logger.logFile
             }
         }
         logger.initloggers()
@@ -78,6 +129,7 @@ func (logger *Logging)initloggers() {
     logger.infoLogger = log.New(logger.fp, "INFO: ", logger.logformatFlags)
     logger.warningLogger = log.New(logger.fp, "WARNING: ", logger.logformatFlags)
     logger.errorLogger = log.New(logger.fp, "ERROR: ", logger.logformatFlags) 
+    logger.jsonLogger = log.New(logger.fp, "", 0)
 }
 
 // Translate the loglevel string provided in the config file to
@@ -97,35 +149,135 @@ func (logger *Logging)getloglevelInt(loglevelstr string) int {
     return Info
 }
 
+// Translate the log format string provided in the config file to Integer.
+func (logger *Logging)getlogformatInt(logformatstr string) int {
+    switch(logformatstr) {
+        case "", "text":
+            return LOG_FORMAT_TEXT
+        case "json":
+            return LOG_FORMAT_JSON
+    }
+    fmt.Println("Invalid log format, starting with default format 'text'")
+    return LOG_FORMAT_TEXT
+}
+
 func getLoggerInstance() *Logging{
     logconf.logInitSingleton()
     return logconf
 }
 
-func (logger *Logging)Trace(msgfmt string, args ...interface{}) {
-    if logger.currloglevel > Trace {
-        return
+// Reopen the log file, used when the file is moved away by an external tool
+// like logrotate. Nothing to do when logs are written to stdout.
+func ReopenLogFile() error {
+    logger := getLoggerInstance()
+    if logger.logFile == nil {
+        return nil
     }
-    logger.tracerLogger.Printf(msgfmt, args...)
+    return logger.logFile.Reopen()
 }
 
-func (logger *Logging)Info(msgfmt string, args ...interface{}) {
-    if logger.currloglevel > Info {
-        return
+//Text line of the log entry, fields are appended as key=value.
+func (logger *Logging)formatText(entry *logEntry) string {
+    var buf bytes.Buffer
+    if len(entry.caller) != 0 {
+        buf.WriteString(":" + entry.caller + ":")
+    }
+    buf.WriteString(entry.msg)
+    for i := range(entry.fields) {
+        fmt.Fprintf(&buf, " %s=%v", entry.fields[i].Key,
+                    entry.fields[i].logValue())
     }
-    logger.infoLogger.Printf(msgfmt, args...)
+    return buf.String()
 }
 
-func (logger *Logging)Warning(msgfmt string, args ...interface{}) {
-    if logger.currloglevel > Warning {
+//Write the key and value of a JSON log object, values that cannot be
+// encoded are written as strings.
+func writeJSONPair(buf *bytes.Buffer, key string, value interface{}) {
+    keyStr, _ := json.Marshal(key)
+    valueStr, err := json.Marshal(value)
+    if err != nil {
+        valueStr, _ = json.Marshal(fmt.Sprintf("%v", value))
+    }
+    buf.WriteByte(',')
+    buf.Write(keyStr)
+    buf.WriteByte(':')
+    buf.Write(valueStr)
+}
+
+//JSON line of the log entry, the fixed keys come first followed by the fields
+// in order they are added. Fields that clash with a fixed key are written
+// with a 'field.' prefix.
+func (logger *Logging)formatJSON(entry *logEntry) string {
+    var buf bytes.Buffer
+    buf.WriteString("{\"time\":")
+    timeStr, _ := json.Marshal(entry.logTime.UTC().Format(time.RFC3339Nano))
+    buf.Write(timeStr)
+    writeJSONPair(&buf, "level", logLevelNames[entry.level])
+    if len(entry.caller) != 0 {
+        writeJSONPair(&buf, "caller", entry.caller)
+    }
+    writeJSONPair(&buf, "msg", entry.msg)
+    for i := range(entry.fields) {
+        key := entry.fields[i].Key
+        if reservedLogKeys[key] {
+            key = "field." + key
+        }
+        writeJSONPair(&buf, key, entry.fields[i].logValue())
+    }
+    buf.WriteByte('}')
+    return buf.String()
+}
+
+//Write the log entry in the configured format. The level is checked before
+// the entry is created, the queued entries are written even when the level
+// is changed meanwhile.
+func (logger *Logging)writeEntry(entry *logEntry) {
+    if logger.logformat == LOG_FORMAT_JSON {
+        logger.jsonLogger.Print(logger.formatJSON(entry))
         return
     }
-    logger.warningLogger.Printf(msgfmt, args...)
+    line := logger.formatText(entry)
+    switch(entry.level) {
+        case Trace:
+            logger.tracerLogger.Print(line)
+        case Info:
+            logger.infoLogger.Print(line)
+        case Warning:
+            logger.warningLogger.Print(line)
+        default:
+            logger.errorLogger.Print(line)
+    }
 }
 
-func (logger *Logging)Error(msgfmt string, args ...interface{}) {
-    if logger.currloglevel > Error {
+func (logger *Logging)log(level int, msgfmt string, args ...interface{}) {
+    if !logger.getLevels().isEnabled(level, "") {
         return
     }
-    logger.errorLogger.Printf(msgfmt, args...)
+    logger.writeEntry(&logEntry{level : level, logTime : time.Now(),
+                                msg : fmt.Sprintf(msgfmt, args...),
+                                fields : logger.fields})
+}
+
+func (logger *Logging)Trace(msgfmt string, args ...interface{}) {
+    logger.log(Trace, msgfmt, args...)
+}
+
+func (logger *Logging)Info(msgfmt string, args ...interface{}) {
+    logger.log(Info, msgfmt, args...)
+}
+
+func (logger *Logging)Warning(msgfmt string, args ...interface{}) {
+    logger.log(Warning, msgfmt, args...)
+}
+
+func (logger *Logging)Error(msgfmt string, args ...interface{}) {
+    logger.log(Error, msgfmt, args...)
+}
+
+//Child logger that adds 'fields' to all its logs, the child shares the
+// output of the logger.
+func (logger *Logging)With(fields ...Field) LoggingInterface {
+    child := *logger
+    child.fields = mergeFields(logger.fields, fields)
+    return &child
 }
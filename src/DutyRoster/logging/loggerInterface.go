@@ -9,4 +9,6 @@ type LoggingInterface interface {
     Info(string, ...interface{})
     Warning(string, ...interface{})
     Error(string, ...interface{})
+    //Child logger that adds the fields to all its logs, eg: request id.
+    With(...Field) LoggingInterface
 }
@@ -16,40 +16,88 @@ package logging
 
 import (
     "sync"
+    "sync/atomic"
     "DutyRoster/syncParam"
+    "DutyRoster/config"
     "fmt"
+    "time"
     "runtime"
 )
 
+//Action when the log channel is full.
+const (
+    //Wait for the listener to make room in channel.
+    LOG_OVERFLOW_BLOCK = iota
+    //Discard the oldest log in channel to make room for the new log.
+    LOG_OVERFLOW_DROP_OLDEST
+    //Discard the new log.
+    LOG_OVERFLOW_DROP
+)
+
 type loggerProxy struct {
     logObj *Logging
-    logChannel chan loggerProxyChannel
+    logChannel chan logEntry
     //size of logger channel, each channel will assign the 'channelSize'
     channelSize uint64
+    //Action when the logChannel is full, one of LOG_OVERFLOW_*
+    overflowPolicy int
+    //Number of logs dropped on overflow, use atomic ops to access.
+    droppedCnt uint64
+    //Dropped logs that are already reported, used only by the listener.
+    reportedCnt uint64
 }
 
-type loggerProxyChannel struct {
-    fnPtr func(string, ...interface{})
-    msg string
+//Logger returned by With, the logs carry the 'fields' and are sent to the
+// logger handler goroutine of 'logProxy'.
+type loggerProxyChild struct {
+    logProxy *loggerProxy
+    fields []Field
 }
 
 var gblLogProxy = new(loggerProxy)
 var logProxyOnce sync.Once
 var LOG_CHANNEL_SIZE uint64
 
+//Write the log and report the logs dropped since the last report.
+func (logProxy *loggerProxy)writeLog(entry logEntry) {
+    logProxy.logObj.writeEntry(&entry)
+    dropped := atomic.LoadUint64(&logProxy.droppedCnt)
+    if dropped != logProxy.reportedCnt {
+        logProxy.logObj.Warning("Log channel is full, dropped %d logs",
+                                dropped - logProxy.reportedCnt)
+        logProxy.reportedCnt = dropped
+    }
+}
+
+//Write all the logs that are still in channel, returns when channel is empty.
+func (logProxy *loggerProxy)drainLogChannel() {
+    for {
+        select {
+            case logMsg := <- logProxy.logChannel:
+                logProxy.writeLog(logMsg)
+            default:
+                return
+        }
+    }
+}
+
 func (logProxy *loggerProxy)executeLoggerRoutine() {
     syncObj := syncParam.GetAppSyncObj()
     // Exiting the logger, so mark done in waitgroup
-    defer syncObj. ExitRoutineInWaitGroup()
-    for syncObj.IsLoggerExitSignaled() == false {
-        //Exit the goroutine only when a exit signal triggered from main thread
+    defer syncObj.ExitLoggerRoutineInWaitGroup()
+    exitCh := syncObj.GetLoggerExitChannel()
+    for {
+        //Block until a log is queued or exit is signaled from main thread.
         select {
             //Read the channel message
             case logMsg := <- logProxy.logChannel:
                 //Invoke relevant logging.
-                logMsg.fnPtr(logMsg.msg)
-            default:
-                //Do nothing.
+                logProxy.writeLog(logMsg)
+            case <- exitCh:
+                //Service routines are done by now, write out the queued logs
+                //before exit so they are not lost.
+                logProxy.drainLogChannel()
+                return
         }
     }
 }
@@ -57,10 +105,25 @@ func (logProxy *loggerProxy)executeLoggerRoutine() {
 func (logProxy *loggerProxy)startLoggerListner() {
     syncObj := syncParam.GetAppSyncObj()
     // Adding logger goroutine into the waitgroup
-    syncObj.AddRoutineInWaitGroup()
+    syncObj.AddLoggerRoutineInWaitGroup()
     go logProxy.executeLoggerRoutine()
 }
 
+// Translate the overflow policy string provided in the config file to
+// Integer.
+func (logProxy *loggerProxy)getOverflowPolicyInt(policystr string) int {
+    switch(policystr) {
+        case "", "block":
+            return LOG_OVERFLOW_BLOCK
+        case "dropoldest":
+            return LOG_OVERFLOW_DROP_OLDEST
+        case "drop":
+            return LOG_OVERFLOW_DROP
+    }
+    fmt.Println("Invalid log overflow policy, starting with default 'block'")
+    return LOG_OVERFLOW_BLOCK
+}
+
 func (logProxy *loggerProxy)initloggerProxy() {
     LOG_CHANNEL_SIZE = 5000
     logProxyOnce.Do(func() {
@@ -68,59 +131,127 @@ func (logProxy *loggerProxy)initloggerProxy() {
                 logProxy.logObj = getLoggerInstance()
             }
             logProxy.channelSize = LOG_CHANNEL_SIZE
+            logProxy.overflowPolicy = LOG_OVERFLOW_BLOCK
+            conf := config.GetConfigInstance()
+            if conf != nil {
+                logProxy.overflowPolicy =
+                    logProxy.getOverflowPolicyInt(conf.Logging.Overflow)
+            }
             //create channel for sending message.
-            logProxy.logChannel = make(chan loggerProxyChannel, logProxy.channelSize)
+            logProxy.logChannel = make(chan logEntry, logProxy.channelSize)
             logProxy.startLoggerListner()
         })
 }
 
+// Queue the log message to the logger handler goroutine as per the overflow
+// policy.
+func (logProxy *loggerProxy)sendLog(ch logEntry) {
+    switch(logProxy.overflowPolicy) {
+        case LOG_OVERFLOW_DROP:
+            select {
+                case logProxy.logChannel <- ch:
+                default:
+                    atomic.AddUint64(&logProxy.droppedCnt, 1)
+            }
+        case LOG_OVERFLOW_DROP_OLDEST:
+            for {
+                select {
+                    case logProxy.logChannel <- ch:
+                        return
+                    default:
+                }
+                //Channel is full, remove the oldest log and retry. The room
+                //can be taken by other senders, hence the retry.
+                select {
+                    case <- logProxy.logChannel:
+                        atomic.AddUint64(&logProxy.droppedCnt, 1)
+                    default:
+                }
+            }
+        default:
+            logProxy.logChannel <- ch
+    }
+}
+
 // Function to read the caller function name from the function stack.
 func (logProxy *loggerProxy)getCallerName() string{
     pc := make([]uintptr, 1)
     //Skipping the functions that are part of loggerProxy to get right caller.	
-    runtime.Callers(4, pc)
-    f := runtime.FuncForPC(pc[0])
-    return f.Name()
+    n := runtime.Callers(4, pc)
+    //Frames account for the inlined functions, that FuncForPC cannot.
+    frame, _ := runtime.CallersFrames(pc[:n]).Next()
+    return frame.Function
 }
 
-func (logProxy *loggerProxy)appendlog(msgfmt string, args ...interface{}) string{
-    var str string
-    str = fmt.Sprintf(":" + logProxy.getCallerName() + ":" + msgfmt, args...)
-    return str
+// Create a channel message and send it to logger hander goroutine. Logs below
+// the log level of the caller package are dropped here to save the formatting.
+// MUST BE CALLED DIRECTLY FROM THE LOG FUNCTIONS FOR RIGHT CALLER NAME.
+func (logProxy *loggerProxy)sendEntry(level int, fields []Field,
+                                      msgfmt string, args ...interface{}) {
+    levels := logProxy.logObj.getLevels()
+    if level < levels.minLevel {
+        return
+    }
+    caller := logProxy.getCallerName()
+    if !levels.isEnabled(level, callerPackage(caller)) {
+        return
+    }
+    var ch logEntry
+    ch.level = level
+    ch.logTime = time.Now()
+    ch.caller = caller
+    ch.msg = fmt.Sprintf(msgfmt, args...)
+    ch.fields = fields
+    logProxy.sendLog(ch)
 }
 
 // Create a trace channel message and send it to logger hander goroutine.
 func (logProxy *loggerProxy)Trace(msgfmt string, args ...interface{}) {
-    var ch loggerProxyChannel
-    ch.fnPtr = logProxy.logObj.Trace
-    ch.msg = logProxy.appendlog(msgfmt, args...)
-    logProxy.logChannel <- ch
+    logProxy.sendEntry(Trace, nil, msgfmt, args...)
 }
 
 // Create a Info channel message and send it to logger hander goroutine.
 func (logProxy *loggerProxy)Info(msgfmt string, args ...interface{}) {
-    var ch loggerProxyChannel
-    ch.fnPtr = logProxy.logObj.Info
-    ch.msg = logProxy.appendlog(msgfmt, args...)
-    logProxy.logChannel <- ch
+    logProxy.sendEntry(Info, nil, msgfmt, args...)
 }
 
 // Create a Warning channel message and send it to logger hander goroutine.
 func (logProxy *loggerProxy)Warning(msgfmt string, args ...interface{}) {
-    var ch loggerProxyChannel
-    ch.fnPtr = logProxy.logObj.Warning
-    ch.msg = logProxy.appendlog(msgfmt, args...)
-    logProxy.logChannel <- ch
+    logProxy.sendEntry(Warning, nil, msgfmt, args...)
 }
 
 // Create a Error channel message and send it to logger hander goroutine.
 func (logProxy *loggerProxy)Error(msgfmt string, args ...interface{}) {
-    var ch loggerProxyChannel
-    ch.fnPtr = logProxy.logObj.Error
-    ch.msg = logProxy.appendlog(msgfmt, args...)
-    logProxy.logChannel <- ch
+    logProxy.sendEntry(Error, nil, msgfmt, args...)
+}
+
+// Child logger that adds 'fields' to all its logs.
+func (logProxy *loggerProxy)With(fields ...Field) LoggingInterface {
+    return &loggerProxyChild{logProxy : logProxy,
+                             fields : mergeFields(nil, fields)}
 }
 
+func (child *loggerProxyChild)Trace(msgfmt string, args ...interface{}) {
+    child.logProxy.sendEntry(Trace, child.fields, msgfmt, args...)
+}
+
+func (child *loggerProxyChild)Info(msgfmt string, args ...interface{}) {
+    child.logProxy.sendEntry(Info, child.fields, msgfmt, args...)
+}
+
+func (child *loggerProxyChild)Warning(msgfmt string, args ...interface{}) {
+    child.logProxy.sendEntry(Warning, child.fields, msgfmt, args...)
+}
+
+func (child *loggerProxyChild)Error(msgfmt string, args ...interface{}) {
+    child.logProxy.sendEntry(Error, child.fields, msgfmt, args...)
+}
+
+// Child of the child logger, carries fields of both.
+func (child *loggerProxyChild)With(fields ...Field) LoggingInterface {
+    return &loggerProxyChild{logProxy : child.logProxy,
+                             fields : mergeFields(child.fields, fields)}
+}
 
 func getLoggerProxyInstance() *loggerProxy{
     gblLogProxy.initloggerProxy()
@@ -0,0 +1,166 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package logging
+
+import (
+    "fmt"
+    "log"
+    "time"
+    "bytes"
+    "strings"
+    "testing"
+    "sync/atomic"
+    "DutyRoster/syncParam"
+)
+
+//Logger proxy that writes the text logs without timestamp to the buffer.
+// The logger goroutine is not started, tests drain the channel.
+func newTestProxy(policy int, size int) (*loggerProxy, *bytes.Buffer) {
+    buf := new(bytes.Buffer)
+    logger := &Logging{fp : buf, levels : new(atomic.Value)}
+    logger.configLevels = newLogLevelSet(Trace, nil)
+    logger.levels.Store(logger.configLevels)
+    logger.initloggers()
+    logger.tracerLogger = log.New(buf, "TRACE: ", 0)
+    logger.infoLogger = log.New(buf, "INFO: ", 0)
+    logger.warningLogger = log.New(buf, "WARNING: ", 0)
+    logger.errorLogger = log.New(buf, "ERROR: ", 0)
+    logProxy := &loggerProxy{logObj : logger, overflowPolicy : policy,
+                             channelSize : uint64(size),
+                             logChannel : make(chan logEntry, size)}
+    return logProxy, buf
+}
+
+//Messages of the text logs in the buffer, without the level and caller.
+func logMessages(buf *bytes.Buffer) []string {
+    msgs := []string{}
+    for _, line := range(strings.Split(buf.String(), "\n")) {
+        if len(line) == 0 {
+            continue
+        }
+        msg := line[strings.Index(line, ": ") + 2:]
+        if strings.HasPrefix(msg, ":") {
+            msg = msg[strings.Index(msg[1:], ":") + 2:]
+        }
+        msgs = append(msgs, msg)
+    }
+    return msgs
+}
+
+func TestOverflowPolicy(t *testing.T) {
+    dropped2 := "Log channel is full, dropped 2 logs"
+    tests := []struct {
+        name string
+        policy int
+        sent []string
+        dropped uint64
+        //Drops are reported after the next log written.
+        want []string
+    }{
+        {"drop", LOG_OVERFLOW_DROP, []string{"a", "b", "c", "d"}, 2,
+         []string{"a", dropped2, "b"}},
+        {"drop oldest", LOG_OVERFLOW_DROP_OLDEST,
+         []string{"a", "b", "c", "d"}, 2, []string{"c", dropped2, "d"}},
+        {"drop without overflow", LOG_OVERFLOW_DROP, []string{"a", "b"}, 0,
+         []string{"a", "b"}},
+        {"drop oldest without overflow", LOG_OVERFLOW_DROP_OLDEST,
+         []string{"a", "b"}, 0, []string{"a", "b"}},
+    }
+    for _, test := range(tests) {
+        logProxy, buf := newTestProxy(test.policy, 2)
+        for _, msg := range(test.sent) {
+            logProxy.Info(msg)
+        }
+        if atomic.LoadUint64(&logProxy.droppedCnt) != test.dropped {
+            t.Errorf("%s: got %d dropped, want %d", test.name,
+                     logProxy.droppedCnt, test.dropped)
+        }
+        logProxy.drainLogChannel()
+        got := logMessages(buf)
+        if fmt.Sprint(got) != fmt.Sprint(test.want) {
+            t.Errorf("%s: got logs %q, want %q", test.name, got, test.want)
+        }
+    }
+}
+
+//Only the logs dropped since the last report are reported.
+func TestDroppedLogReport(t *testing.T) {
+    logProxy, buf := newTestProxy(LOG_OVERFLOW_DROP, 1)
+    logProxy.Info("a")
+    logProxy.Info("b")
+    logProxy.drainLogChannel()
+    logProxy.Info("c")
+    logProxy.drainLogChannel()
+    logProxy.Info("d")
+    logProxy.Info("e")
+    logProxy.Info("f")
+    logProxy.drainLogChannel()
+    want := []string{"a", "Log channel is full, dropped 1 logs", "c", "d",
+                     "Log channel is full, dropped 2 logs"}
+    got := logMessages(buf)
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Errorf("got logs %q, want %q", got, want)
+    }
+    if logProxy.droppedCnt != 3 || logProxy.reportedCnt != 3 {
+        t.Errorf("got %d dropped and %d reported, want 3", logProxy.droppedCnt,
+                 logProxy.reportedCnt)
+    }
+}
+
+//Sender waits for the room in channel, no log is dropped.
+func TestOverflowBlock(t *testing.T) {
+    logProxy, buf := newTestProxy(LOG_OVERFLOW_BLOCK, 1)
+    logProxy.Info("a")
+    sent := make(chan bool)
+    go func() {
+        logProxy.Info("b")
+        close(sent)
+    }()
+    select {
+        case <- sent:
+            t.Fatalf("log is sent to the full channel")
+        case <- time.After(50 * time.Millisecond):
+    }
+    logProxy.writeLog(<- logProxy.logChannel)
+    <- sent
+    logProxy.drainLogChannel()
+    want := []string{"a", "b"}
+    got := logMessages(buf)
+    if fmt.Sprint(got) != fmt.Sprint(want) || logProxy.droppedCnt != 0 {
+        t.Errorf("got logs %q and %d dropped, want %q", got,
+                 logProxy.droppedCnt, want)
+    }
+}
+
+//Logger goroutine writes all the queued logs before it exits.
+func TestDrainOnExit(t *testing.T) {
+    const queued = 50
+    logProxy, buf := newTestProxy(LOG_OVERFLOW_BLOCK, queued)
+    want := []string{}
+    for i := 0; i < queued; i++ {
+        logProxy.Error("log %d", i)
+        want = append(want, fmt.Sprintf("log %d", i))
+    }
+    //Exit is signaled before the logger goroutine reads any log.
+    syncObj := syncParam.GetAppSyncObj()
+    syncObj.ExitloggerRoutine()
+    logProxy.startLoggerListner()
+    syncObj.DestroyAllRoutines()
+    got := logMessages(buf)
+    if fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Errorf("got logs %q, want %q", got, want)
+    }
+}
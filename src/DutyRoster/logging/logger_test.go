@@ -0,0 +1,116 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package logging
+
+import (
+    "time"
+    "errors"
+    "strings"
+    "testing"
+    "encoding/json"
+    "DutyRoster/syncParam"
+)
+
+//Decode the JSON log lines in the buffer.
+func decodeJSONLogs(t *testing.T, lines string) []map[string]interface{} {
+    logs := []map[string]interface{}{}
+    for _, line := range(strings.Split(strings.TrimSpace(lines), "\n")) {
+        var entry map[string]interface{}
+        err := json.Unmarshal([]byte(line), &entry)
+        if err != nil {
+            t.Fatalf("Cannot decode log line %q, %s", line, err)
+        }
+        logs = append(logs, entry)
+    }
+    return logs
+}
+
+func TestJSONFormat(t *testing.T) {
+    logProxy, buf := newTestProxy(LOG_OVERFLOW_BLOCK, 10)
+    logProxy.logObj.logformat = LOG_FORMAT_JSON
+    orgUUID := syncParam.UUID{1}
+    child := logProxy.With(NewField("requestid", "r1"), NewField("count", 3))
+    grandChild := child.With(NewField("org", orgUUID), NewField("count", 4),
+                             NewField("msg", "field"),
+                             NewField("err", errors.New("failed")))
+    start := time.Now().UTC()
+    grandChild.Warning("shift %d", 5)
+    child.Error("child")
+    logProxy.Trace("plain")
+    logProxy.drainLogChannel()
+    logs := decodeJSONLogs(t, buf.String())
+    caller := "DutyRoster/logging.TestJSONFormat"
+    tests := []struct {
+        name string
+        want map[string]interface{}
+    }{
+        {"fields of child and grand child", map[string]interface{}{
+            "level" : "warning", "caller" : caller, "msg" : "shift 5",
+            "requestid" : "r1", "count" : 4.0,
+            "org" : syncParam.UUIDtoString(orgUUID), "field.msg" : "field",
+            "err" : "failed"}},
+        {"fields of child", map[string]interface{}{
+            "level" : "error", "caller" : caller, "msg" : "child",
+            "requestid" : "r1", "count" : 3.0}},
+        {"no fields", map[string]interface{}{
+            "level" : "trace", "caller" : caller, "msg" : "plain"}},
+    }
+    if len(logs) != len(tests) {
+        t.Fatalf("got %d logs, want %d", len(logs), len(tests))
+    }
+    for i, test := range(tests) {
+        logTime, err := time.Parse(time.RFC3339Nano, logs[i]["time"].(string))
+        if err != nil || logTime.Before(start) ||
+            logTime.After(time.Now()) || logTime.Location() != time.UTC {
+            t.Errorf("%s: got time %v, %v", test.name, logs[i]["time"], err)
+        }
+        delete(logs[i], "time")
+        if len(logs[i]) != len(test.want) {
+            t.Errorf("%s: got %v, want %v", test.name, logs[i], test.want)
+        }
+        for key, value := range(test.want) {
+            if logs[i][key] != value {
+                t.Errorf("%s: got %s %v, want %v", test.name, key,
+                         logs[i][key], value)
+            }
+        }
+    }
+}
+
+//Fields of the parent are never modified by the child.
+func TestWithFields(t *testing.T) {
+    logProxy, buf := newTestProxy(LOG_OVERFLOW_BLOCK, 10)
+    parent := logProxy.With(NewField("a", 1), NewField("b", 2))
+    parent.With(NewField("a", 10), NewField("c", 3)).Info("child")
+    parent.Info("parent")
+    logProxy.drainLogChannel()
+    want := []string{"child a=10 b=2 c=3", "parent a=1 b=2"}
+    got := logMessages(buf)
+    if len(got) != len(want) {
+        t.Fatalf("got logs %q, want %q", got, want)
+    }
+    for i := range(want) {
+        if got[i] != want[i] {
+            t.Errorf("got log %q, want %q", got[i], want[i])
+        }
+    }
+    //Logs written directly by the logger carry the fields, without caller.
+    buf.Reset()
+    logProxy.logObj.With(NewField("k", "v")).Info("direct")
+    if buf.String() != "INFO: direct k=v\n" {
+        t.Errorf("got log %q, want %q", buf.String(), "INFO: direct k=v\n")
+    }
+}
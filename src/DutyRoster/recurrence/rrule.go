@@ -0,0 +1,431 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recurrence
+
+//******************************************************************************
+// Recurrence rules in the RRULE form of RFC 5545, eg:
+// 'FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10'. The supported parts are FREQ
+// (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL, BYDAY, BYMONTH, COUNT and
+// UNTIL. BYDAY can have an ordinal only for the monthly rules and the yearly
+// rules with BYMONTH, eg: '-1FR' for the last friday of the month. BYMONTH is
+// only for the yearly rules, eg: 'FREQ=YEARLY;BYMONTH=11;BYDAY=4TH' for the
+// fourth thursday of november. The weeks start on monday.
+// The occurrences are computed on the wall clock of the location of DTSTART,
+// so an occurrence keeps its time of day over the DST changes. A time of day
+// skipped by a DST change is moved forward same as the timezone package.
+//******************************************************************************
+import (
+    "fmt"
+    "sort"
+    "time"
+    "strconv"
+    "strings"
+    "DutyRoster/errorset"
+    "DutyRoster/timezone"
+)
+
+type Frequency uint64
+
+const (
+    FREQ_DAILY Frequency = 1 << iota
+    FREQ_WEEKLY Frequency = 1 << iota
+    FREQ_MONTHLY Frequency = 1 << iota
+    //Last entry in the frequency. Do not add anything below yearly.
+    FREQ_YEARLY Frequency = 1 << iota
+)
+
+//UNTIL format of the rule, a date-time in UTC or a date.
+const (
+    UNTIL_TIME_FORMAT = "20060102T150405Z"
+    UNTIL_DATE_FORMAT = "20060102"
+)
+
+//Number of periods scanned for the occurrences at most, stops the rules that
+// never match, eg: every 7th day on a weekday that DTSTART is not on.
+const MAX_PERIODS = 100000
+
+var freqNames = map[Frequency]string{
+    FREQ_DAILY : "DAILY",
+    FREQ_WEEKLY : "WEEKLY",
+    FREQ_MONTHLY : "MONTHLY",
+    FREQ_YEARLY : "YEARLY",
+}
+
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+//Weekday in BYDAY with an optional ordinal, 0 for all the weekdays in the
+// period, 1..5 for nth and -1..-5 for nth last weekday of the month.
+type weekdayNum struct {
+    ordinal int
+    weekday time.Weekday
+}
+
+//A recurrence rule, occurrences are numbered from DTSTART for COUNT.
+type Rule struct {
+    freq Frequency
+    interval int
+    byDay []weekdayNum
+    //Months of a yearly rule, the month of DTSTART when empty.
+    byMonth []time.Month
+    //0 for a rule without count.
+    count uint64
+    //Zero time for a rule without until, until is inclusive.
+    until time.Time
+}
+
+func invalidRule() error {
+    return fmt.Errorf("%s",
+                      errorset.ERROR_TYPES[errorset.RECURRENCE_RULE_INVALID])
+}
+
+//Parse a BYDAY entry, eg: 'MO', '2TU' or '-1FR'.
+func parseWeekdayNum(entry string) (weekdayNum, error) {
+    var wdn weekdayNum
+    if len(entry) < 2 {
+        return wdn, invalidRule()
+    }
+    name := entry[len(entry) - 2:]
+    found := false
+    for day, dayName := range(weekdayNames) {
+        if dayName == name {
+            wdn.weekday = time.Weekday(day)
+            found = true
+        }
+    }
+    if !found {
+        return wdn, invalidRule()
+    }
+    if len(entry) > 2 {
+        ordinal, err := strconv.Atoi(entry[:len(entry) - 2])
+        if err != nil || ordinal == 0 || ordinal > 5 || ordinal < -5 {
+            return wdn, invalidRule()
+        }
+        wdn.ordinal = ordinal
+    }
+    return wdn, nil
+}
+
+//Parse the rule in RRULE form, the 'RRULE:' prefix is optional.
+func ParseRule(ruleStr string) (*Rule, error) {
+    rule := new(Rule)
+    rule.interval = 1
+    ruleStr = strings.TrimPrefix(strings.TrimSpace(ruleStr), "RRULE:")
+    seen := make(map[string]bool)
+    for _, part := range(strings.Split(ruleStr, ";")) {
+        kv := strings.SplitN(part, "=", 2)
+        if len(kv) != 2 || len(kv[1]) == 0 {
+            return nil, invalidRule()
+        }
+        key := strings.ToUpper(kv[0])
+        value := strings.ToUpper(kv[1])
+        if seen[key] {
+            return nil, invalidRule()
+        }
+        seen[key] = true
+        switch(key) {
+        case "FREQ":
+            for freq, name := range(freqNames) {
+                if name == value {
+                    rule.freq = freq
+                }
+            }
+            if rule.freq == 0 {
+                return nil, invalidRule()
+            }
+        case "INTERVAL":
+            interval, err := strconv.Atoi(value)
+            if err != nil || interval < 1 || interval > 1000 {
+                return nil, invalidRule()
+            }
+            rule.interval = interval
+        case "BYDAY":
+            for _, entry := range(strings.Split(value, ",")) {
+                wdn, err := parseWeekdayNum(entry)
+                if err != nil {
+                    return nil, err
+                }
+                rule.byDay = append(rule.byDay, wdn)
+            }
+        case "BYMONTH":
+            for _, entry := range(strings.Split(value, ",")) {
+                month, err := strconv.Atoi(entry)
+                if err != nil || month < 1 || month > 12 {
+                    return nil, invalidRule()
+                }
+                rule.byMonth = append(rule.byMonth, time.Month(month))
+            }
+            sort.Slice(rule.byMonth, func(i, j int) bool {
+                return rule.byMonth[i] < rule.byMonth[j]
+            })
+        case "COUNT":
+            count, err := strconv.ParseUint(value, 10, 32)
+            if err != nil || count == 0 {
+                return nil, invalidRule()
+            }
+            rule.count = count
+        case "UNTIL":
+            until, err := time.Parse(UNTIL_TIME_FORMAT, value)
+            if err != nil {
+                //A date includes the whole day.
+                until, err = time.Parse(UNTIL_DATE_FORMAT, value)
+                if err != nil {
+                    return nil, invalidRule()
+                }
+                until = until.Add(24 * time.Hour - time.Second)
+            }
+            rule.until = until
+        default:
+            return nil, invalidRule()
+        }
+    }
+    if rule.IsRuleValid() == false {
+        return nil, invalidRule()
+    }
+    return rule, nil
+}
+
+//Validate the rule, FREQ is mandatory and COUNT cannot be used with UNTIL.
+//A yearly rule with BYDAY must have BYMONTH, the weekdays are taken in the
+// months.
+func (rule *Rule)IsRuleValid() bool {
+    if rule.freq == 0 || rule.freq > FREQ_YEARLY ||
+        rule.freq & (rule.freq - 1) != 0 || rule.interval < 1 ||
+        (rule.count != 0 && !rule.until.IsZero()) {
+        return false
+    }
+    if len(rule.byMonth) != 0 && rule.freq != FREQ_YEARLY {
+        return false
+    }
+    if len(rule.byDay) != 0 && rule.freq == FREQ_YEARLY &&
+        len(rule.byMonth) == 0 {
+        return false
+    }
+    for _, wdn := range(rule.byDay) {
+        if wdn.ordinal != 0 && rule.freq < FREQ_MONTHLY {
+            return false
+        }
+    }
+    return true
+}
+
+func (rule *Rule)Freq() Frequency {
+    return rule.freq
+}
+
+func (rule *Rule)Interval() int {
+    return rule.interval
+}
+
+func (rule *Rule)Count() uint64 {
+    return rule.count
+}
+
+func (rule *Rule)Until() time.Time {
+    return rule.until
+}
+
+//Return the rule with UNTIL set to 'until', COUNT is dropped. Used to end a
+// series at an occurrence.
+func (rule *Rule)WithUntil(until time.Time) *Rule {
+    ended := new(Rule)
+    *ended = *rule
+    ended.byDay = append([]weekdayNum{}, rule.byDay...)
+    ended.byMonth = append([]time.Month{}, rule.byMonth...)
+    ended.count = 0
+    ended.until = until.UTC().Truncate(time.Second)
+    return ended
+}
+
+//Rule in the RRULE form, the parts are in a fixed order.
+func (rule *Rule)String() string {
+    parts := []string{"FREQ=" + freqNames[rule.freq]}
+    if rule.interval > 1 {
+        parts = append(parts, fmt.Sprintf("INTERVAL=%d", rule.interval))
+    }
+    if len(rule.byDay) != 0 {
+        days := make([]string, 0, len(rule.byDay))
+        for _, wdn := range(rule.byDay) {
+            day := weekdayNames[wdn.weekday]
+            if wdn.ordinal != 0 {
+                day = strconv.Itoa(wdn.ordinal) + day
+            }
+            days = append(days, day)
+        }
+        parts = append(parts, "BYDAY=" + strings.Join(days, ","))
+    }
+    if len(rule.byMonth) != 0 {
+        months := make([]string, 0, len(rule.byMonth))
+        for _, month := range(rule.byMonth) {
+            months = append(months, strconv.Itoa(int(month)))
+        }
+        parts = append(parts, "BYMONTH=" + strings.Join(months, ","))
+    }
+    if rule.count != 0 {
+        parts = append(parts, fmt.Sprintf("COUNT=%d", rule.count))
+    }
+    if !rule.until.IsZero() {
+        parts = append(parts,
+                       "UNTIL=" + rule.until.UTC().Format(UNTIL_TIME_FORMAT))
+    }
+    return strings.Join(parts, ";")
+}
+
+//Return true if the weekday is in BYDAY, or BYDAY is not set.
+func (rule *Rule)isOnWeekday(day time.Weekday) bool {
+    if len(rule.byDay) == 0 {
+        return true
+    }
+    for _, wdn := range(rule.byDay) {
+        if wdn.weekday == day {
+            return true
+        }
+    }
+    return false
+}
+
+//Wall clock time of day of 't'.
+func clockOf(t time.Time) time.Duration {
+    return time.Duration(t.Hour()) * time.Hour +
+           time.Duration(t.Minute()) * time.Minute +
+           time.Duration(t.Second()) * time.Second
+}
+
+//Date 'days' after the date of 't' at the wall clock 'clock'. The clock is
+// passed along as the time of day of 't' is moved when it is in a DST gap.
+func addDays(t time.Time, days int, clock time.Duration) time.Time {
+    return timezone.Date(t.Year(), t.Month(), t.Day() + days, clock,
+                         t.Location())
+}
+
+//Days of the weekday 'day' in the month of 't', as day of month.
+func weekdaysInMonth(t time.Time, day time.Weekday) []int {
+    first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+    last := first.AddDate(0, 1, -1).Day()
+    days := []int{}
+    for mday := 1 + (int(day) - int(first.Weekday()) + 7) % 7; mday <= last;
+        mday += 7 {
+        days = append(days, mday)
+    }
+    return days
+}
+
+//Candidate occurrences of the period 'period' counted from DTSTART, in order.
+func (rule *Rule)periodCandidates(dtstart time.Time, period int) []time.Time {
+    candidates := []time.Time{}
+    clock := clockOf(dtstart)
+    switch(rule.freq) {
+    case FREQ_DAILY:
+        day := addDays(dtstart, period * rule.interval, clock)
+        if rule.isOnWeekday(day.Weekday()) {
+            candidates = append(candidates, day)
+        }
+    case FREQ_WEEKLY:
+        //Monday of the week of DTSTART.
+        weekStart := addDays(dtstart, -((int(dtstart.Weekday()) + 6) % 7),
+                             clock)
+        weekStart = addDays(weekStart, 7 * period * rule.interval, clock)
+        for offset := 0; offset < 7; offset++ {
+            day := addDays(weekStart, offset, clock)
+            if len(rule.byDay) == 0 {
+                if day.Weekday() == dtstart.Weekday() {
+                    candidates = append(candidates, day)
+                }
+            } else if rule.isOnWeekday(day.Weekday()) {
+                candidates = append(candidates, day)
+            }
+        }
+    case FREQ_MONTHLY:
+        month := timezone.Date(dtstart.Year(),
+                           dtstart.Month() + time.Month(period * rule.interval),
+                           1, clock, dtstart.Location())
+        candidates = rule.monthCandidates(dtstart, month, clock)
+    case FREQ_YEARLY:
+        months := rule.byMonth
+        if len(months) == 0 {
+            months = []time.Month{dtstart.Month()}
+        }
+        for _, mon := range(months) {
+            month := timezone.Date(dtstart.Year() + period * rule.interval,
+                                   mon, 1, clock, dtstart.Location())
+            candidates = append(candidates,
+                                rule.monthCandidates(dtstart, month, clock)...)
+        }
+    }
+    return candidates
+}
+
+//Candidate occurrences in the month that starts at 'month', on the BYDAY
+// weekdays or on the day of month of DTSTART, in order.
+func (rule *Rule)monthCandidates(dtstart time.Time, month time.Time,
+                                 clock time.Duration) []time.Time {
+    candidates := []time.Time{}
+    mdays := []int{}
+    if len(rule.byDay) == 0 {
+        //Months without the day of DTSTART are skipped.
+        if dtstart.Day() <= month.AddDate(0, 1, -1).Day() {
+            mdays = append(mdays, dtstart.Day())
+        }
+    }
+    for _, wdn := range(rule.byDay) {
+        days := weekdaysInMonth(month, wdn.weekday)
+        switch {
+        case wdn.ordinal == 0:
+            mdays = append(mdays, days...)
+        case wdn.ordinal > 0 && wdn.ordinal <= len(days):
+            mdays = append(mdays, days[wdn.ordinal - 1])
+        case wdn.ordinal < 0 && -wdn.ordinal <= len(days):
+            mdays = append(mdays, days[len(days) + wdn.ordinal])
+        }
+    }
+    sort.Ints(mdays)
+    for i, mday := range(mdays) {
+        if i > 0 && mdays[i - 1] == mday {
+            continue
+        }
+        candidates = append(candidates, addDays(month, mday - 1, clock))
+    }
+    return candidates
+}
+
+//Occurrences of the rule in the range [from, to), in order and at most 'max'
+// of them. The occurrences before DTSTART are not part of the rule, DTSTART is
+// an occurrence only when it matches the rule.
+func (rule *Rule)Between(dtstart time.Time, from time.Time, to time.Time,
+                         max int) []time.Time {
+    occurrences := []time.Time{}
+    dtstart = dtstart.Truncate(time.Second)
+    var numbered uint64
+    for period := 0; period < MAX_PERIODS; period++ {
+        for _, occ := range(rule.periodCandidates(dtstart, period)) {
+            if occ.Before(dtstart) {
+                continue
+            }
+            numbered++
+            if (rule.count != 0 && numbered > rule.count) ||
+                (!rule.until.IsZero() && occ.After(rule.until)) ||
+                !occ.Before(to) {
+                return occurrences
+            }
+            if occ.Before(from) {
+                continue
+            }
+            if len(occurrences) >= max {
+                return occurrences
+            }
+            occurrences = append(occurrences, occ)
+        }
+    }
+    return occurrences
+}
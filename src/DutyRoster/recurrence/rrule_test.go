@@ -0,0 +1,209 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package recurrence
+
+import (
+    "time"
+    "testing"
+)
+
+const testFormat = "2006-01-02 Mon 15:04"
+
+func formatAll(times []time.Time) []string {
+    result := []string{}
+    for _, at := range(times) {
+        result = append(result, at.Format(testFormat))
+    }
+    return result
+}
+
+func equalStrings(a []string, b []string) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range(a) {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func TestParseRuleInvalid(t *testing.T) {
+    tests := []struct {
+        name string
+        rule string
+    }{
+        {"empty", ""},
+        {"hourly", "FREQ=HOURLY"},
+        {"no freq", "INTERVAL=2"},
+        {"repeated part", "FREQ=DAILY;FREQ=DAILY"},
+        {"unknown part", "FREQ=DAILY;FOO=1"},
+        {"zero interval", "FREQ=DAILY;INTERVAL=0"},
+        {"count and until", "FREQ=DAILY;COUNT=2;UNTIL=20260101T000000Z"},
+        {"yearly byday", "FREQ=YEARLY;BYDAY=MO"},
+        {"monthly bymonth", "FREQ=MONTHLY;BYMONTH=2"},
+        {"bad month", "FREQ=YEARLY;BYMONTH=13"},
+        {"weekly ordinal", "FREQ=WEEKLY;BYDAY=1MO"},
+        {"bad ordinal", "FREQ=MONTHLY;BYDAY=6MO"},
+    }
+    for _, test := range(tests) {
+        if _, err := ParseRule(test.rule); err == nil {
+            t.Errorf("%s: rule %q accepted", test.name, test.rule)
+        }
+    }
+}
+
+func TestRuleString(t *testing.T) {
+    tests := []struct {
+        name string
+        rule string
+        want string
+    }{
+        {"weekly", "RRULE:freq=weekly;interval=2;byday=MO,WE;count=5",
+         "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5"},
+        {"yearly", "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+         "FREQ=YEARLY;BYDAY=4TH;BYMONTH=11"},
+        {"until", "FREQ=WEEKLY;UNTIL=20260121T090000Z",
+         "FREQ=WEEKLY;UNTIL=20260121T090000Z"},
+    }
+    for _, test := range(tests) {
+        rule, err := ParseRule(test.rule)
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        if got := rule.String(); got != test.want {
+            t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+        }
+    }
+}
+
+func TestBetween(t *testing.T) {
+    utc := func(year int, month time.Month, day int, hour int) time.Time {
+        return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+    }
+    wednesday := utc(2026, 1, 7, 9)
+    tests := []struct {
+        name string
+        rule string
+        dtstart time.Time
+        from time.Time
+        to time.Time
+        max int
+        want []string
+    }{
+        {"weekly count", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5",
+         wednesday, wednesday.AddDate(-1, 0, 0), wednesday.AddDate(1, 0, 0),
+         100,
+         []string{"2026-01-07 Wed 09:00", "2026-01-19 Mon 09:00",
+                  "2026-01-21 Wed 09:00", "2026-02-02 Mon 09:00",
+                  "2026-02-04 Wed 09:00"}},
+        //COUNT numbers the occurrences from DTSTART, not from 'from'.
+        {"weekly count window", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5",
+         wednesday, utc(2026, 1, 20, 0), wednesday.AddDate(1, 0, 0), 100,
+         []string{"2026-01-21 Wed 09:00", "2026-02-02 Mon 09:00",
+                  "2026-02-04 Wed 09:00"}},
+        {"max", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=5",
+         wednesday, time.Time{}, wednesday.AddDate(1, 0, 0), 2,
+         []string{"2026-01-07 Wed 09:00", "2026-01-19 Mon 09:00"}},
+        {"weekly until", "FREQ=WEEKLY;UNTIL=20260121T090000Z",
+         wednesday, time.Time{}, wednesday.AddDate(1, 0, 0), 10,
+         []string{"2026-01-07 Wed 09:00", "2026-01-14 Wed 09:00",
+                  "2026-01-21 Wed 09:00"}},
+        {"monthly ordinals", "FREQ=MONTHLY;BYDAY=-1FR,1MO;UNTIL=20260331",
+         utc(2026, 1, 1, 8), time.Time{}, utc(2027, 1, 1, 0), 100,
+         []string{"2026-01-05 Mon 08:00", "2026-01-30 Fri 08:00",
+                  "2026-02-02 Mon 08:00", "2026-02-27 Fri 08:00",
+                  "2026-03-02 Mon 08:00", "2026-03-27 Fri 08:00"}},
+        //Months without a 31st have no occurrence.
+        {"monthly 31st", "FREQ=MONTHLY",
+         utc(2026, 1, 31, 8), time.Time{}, utc(2026, 6, 1, 0), 100,
+         []string{"2026-01-31 Sat 08:00", "2026-03-31 Tue 08:00",
+                  "2026-05-31 Sun 08:00"}},
+        {"no match", "FREQ=DAILY;INTERVAL=7;BYDAY=MO",
+         wednesday, time.Time{}, utc(2100, 1, 1, 0), 10, []string{}},
+        {"yearly ordinal", "FREQ=YEARLY;BYMONTH=11;BYDAY=4TH",
+         utc(2020, 11, 26, 0), utc(2025, 1, 1, 0), utc(2028, 1, 1, 0), 10,
+         []string{"2025-11-27 Thu 00:00", "2026-11-26 Thu 00:00",
+                  "2027-11-25 Thu 00:00"}},
+        {"yearly leap day", "FREQ=YEARLY",
+         utc(2024, 2, 29, 0), utc(2024, 1, 1, 0), utc(2033, 1, 1, 0), 10,
+         []string{"2024-02-29 Thu 00:00", "2028-02-29 Tue 00:00",
+                  "2032-02-29 Sun 00:00"}},
+        {"yearly months", "FREQ=YEARLY;BYMONTH=1,7;COUNT=3",
+         utc(2026, 7, 4, 0), time.Time{}, utc(2033, 1, 1, 0), 10,
+         []string{"2026-07-04 Sat 00:00", "2027-01-04 Mon 00:00",
+                  "2027-07-04 Sun 00:00"}},
+    }
+    for _, test := range(tests) {
+        rule, err := ParseRule(test.rule)
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        got := formatAll(rule.Between(test.dtstart, test.from, test.to,
+                                      test.max))
+        if !equalStrings(got, test.want) {
+            t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+        }
+    }
+}
+
+//Occurrences keep the wall clock time of DTSTART across a DST change.
+func TestBetweenDST(t *testing.T) {
+    loc, err := time.LoadLocation("Europe/Berlin")
+    if err != nil {
+        t.Fatalf("Cannot load zone, %s", err)
+    }
+    rule, err := ParseRule("FREQ=DAILY")
+    if err != nil {
+        t.Fatal(err)
+    }
+    occs := rule.Between(time.Date(2026, 3, 28, 9, 0, 0, 0, loc), time.Time{},
+                         time.Date(2026, 3, 31, 0, 0, 0, 0, loc), 10)
+    if len(occs) != 3 {
+        t.Fatalf("got %v, want 3 occurrences", occs)
+    }
+    for _, occ := range(occs) {
+        if occ.In(loc).Hour() != 9 {
+            t.Errorf("got %v, want 09:00 wall clock", occ)
+        }
+    }
+    if gap := occs[1].Sub(occs[0]); gap != 23 * time.Hour {
+        t.Errorf("got gap %v, want 23h", gap)
+    }
+}
+
+func TestWithUntil(t *testing.T) {
+    dtstart := time.Date(2026, 1, 7, 9, 0, 0, 0, time.UTC)
+    rule, err := ParseRule("FREQ=WEEKLY;UNTIL=20260121T090000Z")
+    if err != nil {
+        t.Fatal(err)
+    }
+    ended := rule.WithUntil(dtstart)
+    if got, want := ended.String(),
+        "FREQ=WEEKLY;UNTIL=20260107T090000Z"; got != want {
+        t.Errorf("got %s, want %s", got, want)
+    }
+    if got := rule.String(); got != "FREQ=WEEKLY;UNTIL=20260121T090000Z" {
+        t.Errorf("WithUntil changed the rule, got %s", got)
+    }
+    occs := ended.Between(dtstart, time.Time{}, dtstart.AddDate(1, 0, 0), 10)
+    if len(occs) != 1 || !occs[0].Equal(dtstart) {
+        t.Errorf("got %v, want only %v", occs, dtstart)
+    }
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+//******************************************************************************
+// Admin endpoints to operate the running server. They are not tied to a user
+// account, the requests carry the admin secret of config file instead.
+//******************************************************************************
+import (
+    "fmt"
+    "net"
+    "time"
+    "bytes"
+    "net/http"
+    "encoding/json"
+    "crypto/subtle"
+    "DutyRoster/config"
+    "DutyRoster/logging"
+    "DutyRoster/errorset"
+)
+
+//Header of the admin secret in admin requests.
+const ADMIN_SECRET_HEADER = "X-Admin-Secret"
+
+//Time in seconds to wait for the server on admin requests of CLI.
+const ADMIN_CLIENT_TIMEOUT = 10
+
+//Log levels of the server, packages not in 'packages' log at the default
+// level.
+type logLevelsJSON struct {
+    Default string `json:"default"`
+    Packages map[string]string `json:"packages"`
+}
+
+var adminRoutes = []route{
+    newPublicRoute(http.MethodGet, "/admin/loglevels", getLogLevelsHandler),
+    newPublicRoute(http.MethodPut, "/admin/loglevels", setLogLevelsHandler),
+    newPublicRoute(http.MethodDelete, "/admin/loglevels",
+                   resetLogLevelsHandler),
+}
+
+//Authorize the admin request on the admin secret, all the requests are denied
+// when the secret is not configured.
+func authorizeAdminRequest(w http.ResponseWriter, req *http.Request) bool {
+    secret := config.GetConfigInstance().Admin.Secret
+    reqSecret := req.Header.Get(ADMIN_SECRET_HEADER)
+    if len(secret) != 0 &&
+        subtle.ConstantTimeCompare([]byte(secret), []byte(reqSecret)) == 1 {
+        return true
+    }
+    writeError(w, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+    return false
+}
+
+func currentLogLevelsJSON() logLevelsJSON {
+    defLevel, packages := logging.GetLogLevels()
+    return logLevelsJSON{Default : defLevel, Packages : packages}
+}
+
+func getLogLevelsHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    if !authorizeAdminRequest(w, req) {
+        return
+    }
+    writeJSON(w, http.StatusOK, currentLogLevelsJSON())
+}
+
+//Replace the log levels, the current default level is kept when it is not
+// in request.
+func setLogLevelsHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    if !authorizeAdminRequest(w, req) {
+        return
+    }
+    var body logLevelsJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = logging.SetLogLevels(body.Default, body.Packages)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    levels := currentLogLevelsJSON()
+    logging.GetAppLoggerObj().Info("Log levels are set to %s %v",
+                                   levels.Default, levels.Packages)
+    writeJSON(w, http.StatusOK, levels)
+}
+
+//Revert the log levels to the config file.
+func resetLogLevelsHandler(w http.ResponseWriter, req *http.Request,
+                           params []string) {
+    if !authorizeAdminRequest(w, req) {
+        return
+    }
+    logging.ResetLogLevels()
+    levels := currentLogLevelsJSON()
+    logging.GetAppLoggerObj().Info("Log levels are reset to %s %v",
+                                   levels.Default, levels.Packages)
+    writeJSON(w, http.StatusOK, levels)
+}
+
+//URL of the admin endpoint 'path' on the running server, the server is
+// reached on loopback when it listens on all the addresses.
+func adminURL(path string) (string, error) {
+    host, port, err := net.SplitHostPort(
+                                config.GetConfigInstance().HTTP.ListenAddr)
+    if err != nil {
+        return "", err
+    }
+    if len(host) == 0 || net.ParseIP(host).IsUnspecified() {
+        host = "127.0.0.1"
+    }
+    return "http://" + net.JoinHostPort(host, port) + API_PATH_PREFIX + path,
+           nil
+}
+
+//Error of the failed admin response. The error in response is returned when
+// it is a predefined error, else the error is chosen on the status code.
+func adminResponseError(resp *http.Response) error {
+    var errBody errorJSON
+    json.NewDecoder(resp.Body).Decode(&errBody)
+    for i := range(errorset.ERROR_TYPES) {
+        if errorset.ERROR_TYPES[i] == errBody.Error {
+            return fmt.Errorf("%s", errorset.ERROR_TYPES[i])
+        }
+    }
+    switch(resp.StatusCode) {
+        case http.StatusUnauthorized, http.StatusForbidden:
+            return fmt.Errorf("%s",
+                              errorset.ERROR_TYPES[errorset.ACCESS_DENIED])
+        case http.StatusBadRequest, http.StatusUnprocessableEntity:
+            return fmt.Errorf("%s",
+                              errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+}
+
+//Request the log levels endpoint of the running server with 'method', used
+// by the 'loglevel' command. The levels are sent on PUT, the levels in
+// response are returned.
+func RequestLogLevels(method string, defLevel string,
+                      packages map[string]string) (string, map[string]string,
+                                                   error) {
+    url, err := adminURL("/admin/loglevels")
+    if err != nil {
+        return "", nil, err
+    }
+    var body bytes.Buffer
+    if method == http.MethodPut {
+        json.NewEncoder(&body).Encode(logLevelsJSON{Default : defLevel,
+                                                    Packages : packages})
+    }
+    req, err := http.NewRequest(method, url, &body)
+    if err != nil {
+        return "", nil, err
+    }
+    req.Header.Set(ADMIN_SECRET_HEADER, config.GetConfigInstance().Admin.Secret)
+    client := &http.Client{Timeout : ADMIN_CLIENT_TIMEOUT * time.Second}
+    resp, err := client.Do(req)
+    if err != nil {
+        return "", nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return "", nil, adminResponseError(resp)
+    }
+    var levels logLevelsJSON
+    err = json.NewDecoder(resp.Body).Decode(&levels)
+    if err != nil {
+        return "", nil, err
+    }
+    return levels.Default, levels.Packages, nil
+}
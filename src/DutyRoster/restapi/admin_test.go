@@ -0,0 +1,79 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package restapi
+
+import (
+    "strings"
+    "testing"
+    "net/http"
+    "net/http/httptest"
+    "DutyRoster/config"
+    "DutyRoster/errorset"
+)
+
+//Errors of the failed admin requests are mapped to the predefined errors, the
+// CLI never shows an error that is not in errorset.
+func TestRequestLogLevelsError(t *testing.T) {
+    tests := []struct {
+        name string
+        status int
+        body string
+        wantErr int
+    }{
+        {"predefined error", http.StatusForbidden,
+         `{"error":"` + errorset.ERROR_TYPES[errorset.ACCESS_DENIED] + `"}`,
+         errorset.ACCESS_DENIED},
+        {"predefined error on other status", http.StatusBadRequest,
+         `{"error":"` + errorset.ERROR_TYPES[errorset.TRY_AGAIN] + `"}`,
+         errorset.TRY_AGAIN},
+        {"unknown error", http.StatusUnauthorized, `{"error":"denied"}`,
+         errorset.ACCESS_DENIED},
+        {"bad request", http.StatusBadRequest, "not json",
+         errorset.INVALID_PARAM},
+        {"server error", http.StatusInternalServerError, "",
+         errorset.TRY_AGAIN},
+        {"unknown endpoint", http.StatusNotFound,
+         `{"error":"Not Found"}`, errorset.TRY_AGAIN},
+    }
+    cfg := config.GetConfigInstance()
+    savedHTTP := cfg.HTTP
+    savedAdmin := cfg.Admin
+    defer func() {
+        cfg.HTTP = savedHTTP
+        cfg.Admin = savedAdmin
+    }()
+    cfg.Admin.Secret = "admin-secret"
+    for _, test := range(tests) {
+        server := httptest.NewServer(http.HandlerFunc(
+            func(w http.ResponseWriter, req *http.Request) {
+                if req.Header.Get(ADMIN_SECRET_HEADER) != "admin-secret" ||
+                    req.URL.Path != API_PATH_PREFIX + "/admin/loglevels" {
+                    t.Errorf("%s: got request %s without secret",
+                             test.name, req.URL.Path)
+                }
+                w.WriteHeader(test.status)
+                w.Write([]byte(test.body))
+            }))
+        cfg.HTTP.ListenAddr = strings.TrimPrefix(server.URL, "http://")
+        _, _, err := RequestLogLevels(http.MethodGet, "", nil)
+        server.Close()
+        if err == nil ||
+            err.Error() != errorset.ERROR_TYPES[test.wantErr] {
+            t.Errorf("%s: got error %v, want %s", test.name, err,
+                     errorset.ERROR_TYPES[test.wantErr])
+        }
+    }
+}
@@ -0,0 +1,181 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "context"
+    "strings"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/session"
+    "DutyRoster/syncParam"
+)
+
+//Type of the keys in request context, to avoid collision with other packages.
+type contextKey int
+
+const identityContextKey contextKey = iota
+
+//Login request, either the password or the refresh token is used.
+type loginJSON struct {
+    Userid string `json:"userid"`
+    Password string `json:"password"`
+    RefreshToken string `json:"refreshtoken"`
+}
+
+//Tokens issued on login/refresh. Access token must be sent in 'Authorization'
+// header as 'Bearer <token>' on all the API requests.
+type tokensJSON struct {
+    TokenType string `json:"tokentype"`
+    AccessToken string `json:"accesstoken"`
+    AccessExpiry time.Time `json:"accessexpiry"`
+    RefreshToken string `json:"refreshtoken"`
+    RefreshExpiry time.Time `json:"refreshexpiry"`
+}
+
+var authRoutes = []route{
+    newPublicRoute(http.MethodPost, "/auth/login", loginHandler),
+    newPublicRoute(http.MethodPost, "/auth/refresh", refreshHandler),
+    newRoute(http.MethodPost, "/auth/logout", logoutHandler),
+}
+
+func tokensToJSON(tok *session.Tokens) tokensJSON {
+    return tokensJSON{TokenType : "Bearer",
+                      AccessToken : tok.AccessToken(),
+                      AccessExpiry : tok.AccessExpiry(),
+                      RefreshToken : tok.RefreshToken(),
+                      RefreshExpiry : tok.RefreshExpiry()}
+}
+
+//Resolve the bearer token in request to the user identity and store it in
+// request context. Token is mandatory for the routes that are not public.
+func authenticateRequest(req *http.Request,
+                         public bool) (*http.Request, error) {
+    authHeader := req.Header.Get("Authorization")
+    if len(authHeader) == 0 {
+        if public {
+            return req, nil
+        }
+        return req, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    }
+    fields := strings.Fields(authHeader)
+    if len(fields) != 2 || !strings.EqualFold(fields[0], "Bearer") {
+        return req, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    }
+    id, err := session.Authenticate(fields[1])
+    if err != nil {
+        return req, err
+    }
+    return req.WithContext(context.WithValue(req.Context(),
+                                             identityContextKey, id)), nil
+}
+
+//Identity of the user who made the request, nil for an anonymous request on
+// a public route.
+func requestIdentity(req *http.Request) *session.Identity {
+    id, _ := req.Context().Value(identityContextKey).(*session.Identity)
+    return id
+}
+
+func loginHandler(w http.ResponseWriter, req *http.Request,
+                  params []string) {
+    var body loginJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    tok, err := session.Login(body.Userid, body.Password)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, tokensToJSON(tok))
+}
+
+//Issue new tokens on the refresh token, the refresh token in request is not
+// valid anymore.
+func refreshHandler(w http.ResponseWriter, req *http.Request,
+                    params []string) {
+    var body loginJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    tok, err := session.Refresh(body.RefreshToken)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, tokensToJSON(tok))
+}
+
+//Revoke the session of the access token, all the sessions of the user are
+// revoked on query param 'all=true'.
+func logoutHandler(w http.ResponseWriter, req *http.Request,
+                   params []string) {
+    all := req.URL.Query().Get("all") == "true"
+    err := session.Logout(requestIdentity(req), all)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Authorize the user of request for the action on org/unit, the error response
+// is written when the user is not allowed.
+func authorizeRequest(w http.ResponseWriter, req *http.Request,
+                      action authz.Action, orgUUID syncParam.UUID) bool {
+    err := authz.Authorize(requestIdentity(req).User(), action, orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return false
+    }
+    return true
+}
+
+//Authorize the user of request for the action on account 'userid'. Users are
+// always allowed on their own account, otherwise the action must be allowed
+// in an approved org/unit where 'userid' is a member. Users join an org/unit
+// only by accepting an invite, so no one gets rights on an account without
+// the consent of its user.
+func authorizeUserRequest(w http.ResponseWriter, req *http.Request,
+                          action authz.Action, userid string) bool {
+    user := requestIdentity(req).User()
+    if user.Userid() == userid || authz.CanOnUser(user, action, userid) {
+        return true
+    }
+    writeError(w, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+    return false
+}
+
+//Allow the request only on the own account of the user, for the operations
+// that need the consent of the user eg: change password, accept an invite.
+func authorizeSelfRequest(w http.ResponseWriter, req *http.Request,
+                          userid string) bool {
+    if requestIdentity(req).User().Userid() == userid {
+        return true
+    }
+    writeError(w, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+    return false
+}
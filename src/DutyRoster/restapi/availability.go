@@ -0,0 +1,221 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of an availability record. Only the fields of the kind
+// are used, offset and duration are in seconds.
+type availabilityJSON struct {
+    UUID string `json:"uuid"`
+    Userid string `json:"userid"`
+    Kind string `json:"kind"`
+    Weekdays uint64 `json:"weekdays"`
+    StartOffset int64 `json:"startoffset"`
+    Duration int64 `json:"duration"`
+    StartTime time.Time `json:"starttime"`
+    EndTime time.Time `json:"endtime"`
+    TemplateUUID string `json:"templateuuid"`
+    Weight int64 `json:"weight"`
+    Note string `json:"note"`
+}
+
+//Users available in an org/unit for a time range.
+type availableUsersJSON struct {
+    OrgUUID string `json:"orguuid"`
+    From time.Time `json:"from"`
+    To time.Time `json:"to"`
+    Users []string `json:"users"`
+}
+
+//Names of the availability kinds in JSON.
+var availabilityKindNames = map[datastore.AvailabilityKindBit]string{
+    datastore.AVAILABILITY_WEEKLY : "weekly",
+    datastore.AVAILABILITY_BLACKOUT : "blackout",
+    datastore.AVAILABILITY_PREFERENCE : "preference",
+}
+
+var availabilityRoutes = []route{
+    newRoute(http.MethodGet, "/users/*/availability",
+             listUserAvailabilityHandler),
+    newRoute(http.MethodPost, "/users/*/availability",
+             createAvailabilityHandler),
+    newRoute(http.MethodGet, "/availability/*", getAvailabilityHandler),
+    newRoute(http.MethodDelete, "/availability/*", deleteAvailabilityHandler),
+    newRoute(http.MethodGet, "/orgs/*/available", listAvailableUsersHandler),
+}
+
+func availabilityToJSON(avail *datastore.Availability) availabilityJSON {
+    resp := availabilityJSON{UUID : syncParam.UUIDtoString(avail.UUID()),
+                             Userid : avail.Userid(),
+                             Kind : availabilityKindNames[avail.Kind()],
+                             Weekdays : avail.Weekdays(),
+                             StartOffset : int64(avail.StartOffset() /
+                                                 time.Second),
+                             Duration : int64(avail.Duration() / time.Second),
+                             StartTime : avail.StartTime(),
+                             EndTime : avail.EndTime(),
+                             Weight : avail.Weight(),
+                             Note : avail.Note()}
+    if !syncParam.IsUUIDEmpty(avail.TemplateUUID()) {
+        resp.TemplateUUID = syncParam.UUIDtoString(avail.TemplateUUID())
+    }
+    return resp
+}
+
+//Build the availability record of user 'userid' from the request.
+func availabilityFromJSON(body *availabilityJSON,
+                          userid string) (*datastore.Availability, error) {
+    switch(body.Kind) {
+        case availabilityKindNames[datastore.AVAILABILITY_WEEKLY]:
+            return datastore.NewWeeklyAvailability(userid, body.Weekdays,
+                            time.Duration(body.StartOffset) * time.Second,
+                            time.Duration(body.Duration) * time.Second), nil
+        case availabilityKindNames[datastore.AVAILABILITY_BLACKOUT]:
+            return datastore.NewBlackout(userid, body.StartTime, body.EndTime,
+                                         body.Note), nil
+        case availabilityKindNames[datastore.AVAILABILITY_PREFERENCE]:
+            tmplUUID, err := parseUUID(body.TemplateUUID)
+            if err != nil {
+                return nil, err
+            }
+            return datastore.NewShiftPreference(userid, tmplUUID,
+                                                body.Weight), nil
+    }
+    return nil, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+func listUserAvailabilityHandler(w http.ResponseWriter, req *http.Request,
+                                 params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    availList, err := datastore.GetDataStoreObj().ListUserAvailability(
+                                                                params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]availabilityJSON, 0, len(availList))
+    for i := range(availList) {
+        resp = append(resp, availabilityToJSON(&availList[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Users manage their own availability, admins can manage it for others.
+func createAvailabilityHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    if !authorizeUserRequest(w, req, authz.MANAGE_USER, params[0]) {
+        return
+    }
+    var body availabilityJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    avail, err := availabilityFromJSON(&body, params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = datastore.GetDataStoreObj().CreateAvailability(avail)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, availabilityToJSON(avail))
+}
+
+func getAvailabilityHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    avail := datastore.NewAvailabilityRef(uuid)
+    err = datastore.GetDataStoreObj().GetAvailability(avail)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, avail.Userid()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, availabilityToJSON(avail))
+}
+
+func deleteAvailabilityHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    avail := datastore.NewAvailabilityRef(uuid)
+    err = dbObj.GetAvailability(avail)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeUserRequest(w, req, authz.MANAGE_USER, avail.Userid()) {
+        return
+    }
+    err = dbObj.DeleteAvailability(avail)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Users of the org/unit available for the whole range in query params 'from'
+// and 'to', used to build the roster.
+func listAvailableUsersHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    users, err := datastore.GetDataStoreObj().ListAvailableUsers(orgUUID,
+                                                                 from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK,
+              availableUsersJSON{OrgUUID : syncParam.UUIDtoString(orgUUID),
+                                 From : from, To : to, Users : users})
+}
@@ -0,0 +1,318 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "strings"
+    "net/http"
+    "DutyRoster/ical"
+    "DutyRoster/authz"
+    "DutyRoster/session"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Period of the shifts in a calendar feed, relative to the time of the read.
+const (
+    FEED_PAST_RANGE = 30 * 24 * time.Hour
+    FEED_FUTURE_RANGE = 180 * 24 * time.Hour
+)
+
+//Name of the calendar file in the feed url.
+const FEED_FILE_NAME = "roster.ics"
+
+//JSON representation of a calendar feed. Token and url are present only in
+// the response of feed creation, the token cannot be read back.
+type feedJSON struct {
+    UUID string `json:"uuid"`
+    Kind string `json:"kind"`
+    Userid string `json:"userid"`
+    OrgUUID string `json:"orguuid"`
+    CreateTime time.Time `json:"createtime"`
+    Token string `json:"token,omitempty"`
+    URL string `json:"url,omitempty"`
+}
+
+//Names of the feed kinds in JSON.
+var feedKindNames = map[datastore.FeedKindBit]string{
+    datastore.FEED_USER : "user",
+    datastore.FEED_ORG : "org",
+}
+
+var feedRoutes = []route{
+    newRoute(http.MethodGet, "/users/*/feeds", listUserFeedsHandler),
+    newRoute(http.MethodPost, "/feeds", createFeedHandler),
+    newRoute(http.MethodDelete, "/feeds/*", deleteFeedHandler),
+    newPublicRoute(http.MethodGet, "/feeds/*/" + FEED_FILE_NAME,
+                   readFeedHandler),
+}
+
+func feedToJSON(feed *datastore.CalendarFeed) feedJSON {
+    return feedJSON{UUID : syncParam.UUIDtoString(feed.UUID()),
+                    Kind : feedKindNames[feed.Kind()],
+                    Userid : feed.Userid(),
+                    OrgUUID : optionalUUIDtoString(feed.OrgUUID()),
+                    CreateTime : feed.CreateTime()}
+}
+
+//Find the feed kind with JSON name 'name'.
+func parseFeedKind(name string) (datastore.FeedKindBit, error) {
+    for kind, kindName := range(feedKindNames) {
+        if kindName == name {
+            return kind, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Time zone of the feed in query param 'tz', 'defaultLoc' when not given.
+func parseQueryZone(req *http.Request,
+                    defaultLoc *time.Location) (*time.Location, error) {
+    name := req.URL.Query().Get("tz")
+    if len(name) == 0 {
+        return defaultLoc, nil
+    }
+    return timezone.LoadLocation(name)
+}
+
+//Summary of the shift events, the names are cached across the shifts of a
+// feed.
+type shiftSummarizer struct {
+    orgNames map[syncParam.UUID]string
+    templateNames map[syncParam.UUID]string
+}
+
+func newShiftSummarizer() *shiftSummarizer {
+    return &shiftSummarizer{orgNames : make(map[syncParam.UUID]string),
+                        templateNames : make(map[syncParam.UUID]string)}
+}
+
+func (sum *shiftSummarizer)orgName(orgUUID syncParam.UUID) string {
+    name, ok := sum.orgNames[orgUUID]
+    if !ok {
+        or := datastore.NewOrgRef(orgUUID)
+        if datastore.GetDataStoreObj().GetOrg(or) == nil {
+            name = or.Name()
+        }
+        sum.orgNames[orgUUID] = name
+    }
+    return name
+}
+
+//Summary is the template name and org/unit of the shift, eg: 'Night shift -
+// Ward 7'.
+func (sum *shiftSummarizer)summary(sh *datastore.Shift) string {
+    tmplName := "Shift"
+    if !syncParam.IsUUIDEmpty(sh.TemplateUUID()) {
+        name, ok := sum.templateNames[sh.TemplateUUID()]
+        if !ok {
+            tmpl := datastore.NewShiftTemplateRef(sh.TemplateUUID())
+            if datastore.GetDataStoreObj().GetShiftTemplate(tmpl) == nil {
+                name = tmpl.Name()
+            }
+            sum.templateNames[sh.TemplateUUID()] = name
+        }
+        if len(name) != 0 {
+            tmplName = name
+        }
+    }
+    return tmplName + " - " + sum.orgName(sh.OrgUUID())
+}
+
+//Event of the shift, the uid is the shift uuid so that the event is stable
+// across the revisions of the shift.
+func shiftToEvent(sh *datastore.Shift, summary string) *ical.Event {
+    ev := ical.NewEvent(syncParam.UUIDtoString(sh.UUID()), summary,
+                        sh.StartTime(), sh.EndTime())
+    ev.SetRevision(sh.Sequence(), sh.ModifyTime())
+    ev.SetCancelled(sh.IsCancelled())
+    return ev
+}
+
+//Calendar of the shifts that user 'userid' is assigned to.
+func userFeedCalendar(userid string, loc *time.Location,
+                      from time.Time, to time.Time) (*ical.Calendar, error) {
+    shifts, err := datastore.GetDataStoreObj().ListUserShifts(userid, from, to)
+    if err != nil {
+        return nil, err
+    }
+    cal := ical.NewCalendar("Shifts of " + userid, loc)
+    sum := newShiftSummarizer()
+    for i := range(shifts) {
+        cal.AddEvent(shiftToEvent(&shifts[i], sum.summary(&shifts[i])))
+    }
+    return cal, nil
+}
+
+//Calendar of all the shifts of org/unit 'orgUUID', the users on duty are
+// listed in the event description.
+func orgFeedCalendar(orgUUID syncParam.UUID, loc *time.Location,
+                     from time.Time, to time.Time) (*ical.Calendar, error) {
+    dbObj := datastore.GetDataStoreObj()
+    shifts, err := dbObj.ListShifts(orgUUID, from, to)
+    if err != nil {
+        return nil, err
+    }
+    sum := newShiftSummarizer()
+    cal := ical.NewCalendar("Roster of " + sum.orgName(orgUUID), loc)
+    for i := range(shifts) {
+        asgns, err := dbObj.ListShiftRoster(shifts[i].UUID())
+        if err != nil {
+            return nil, err
+        }
+        users := make([]string, 0, len(asgns))
+        for j := range(asgns) {
+            users = append(users, asgns[j].Userid())
+        }
+        ev := shiftToEvent(&shifts[i], sum.summary(&shifts[i]))
+        ev.SetDescription(fmt.Sprintf("On duty: %s\nMinimum staff: %d",
+                                      strings.Join(users, ", "),
+                                      shifts[i].MinStaff()))
+        cal.AddEvent(ev)
+    }
+    return cal, nil
+}
+
+func listUserFeedsHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    feeds, err := datastore.GetDataStoreObj().ListUserCalendarFeeds(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]feedJSON, 0, len(feeds))
+    for i := range(feeds) {
+        resp = append(resp, feedToJSON(&feeds[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Users create the feeds only for themselves, an org feed needs the access to
+// the shifts of org/unit.
+func createFeedHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    var body feedJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    kind, err := parseFeedKind(body.Kind)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    userid := requestIdentity(req).User().Userid()
+    var feed *datastore.CalendarFeed
+    var token string
+    if kind == datastore.FEED_ORG {
+        orgUUID, err := parseUUID(body.OrgUUID)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+            return
+        }
+        feed, token, err = session.CreateOrgFeed(orgUUID, userid)
+    } else {
+        feed, token, err = session.CreateUserFeed(userid)
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := feedToJSON(feed)
+    resp.Token = token
+    resp.URL = API_PATH_PREFIX + "/feeds/" + token + "/" + FEED_FILE_NAME
+    writeJSON(w, http.StatusCreated, resp)
+}
+
+//Owners and the user admins can revoke a feed.
+func deleteFeedHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    feed := datastore.NewCalendarFeedRef(uuid)
+    err = dbObj.GetCalendarFeed(feed)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeUserRequest(w, req, authz.MANAGE_USER, feed.Userid()) {
+        return
+    }
+    err = dbObj.DeleteCalendarFeed(feed)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Serve the feed in iCalendar format on the token in url, no login is needed
+// as the calendar clients cannot login. Times are in the zone of query param
+// 'tz', an org feed is in the zone of the org and a user feed is in UTC when
+// not given.
+func readFeedHandler(w http.ResponseWriter, req *http.Request,
+                     params []string) {
+    feed, owner, err := session.ResolveFeed(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    defaultLoc := time.UTC
+    if feed.Kind() == datastore.FEED_ORG {
+        or := datastore.NewOrgRef(feed.OrgUUID())
+        if datastore.GetDataStoreObj().GetOrg(or) == nil {
+            defaultLoc = or.Location()
+        }
+    }
+    loc, err := parseQueryZone(req, defaultLoc)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    now := time.Now()
+    from, to := now.Add(-FEED_PAST_RANGE), now.Add(FEED_FUTURE_RANGE)
+    var cal *ical.Calendar
+    if feed.Kind() == datastore.FEED_ORG {
+        //Feed is read with the access of its owner.
+        err = authz.Authorize(owner, authz.VIEW_SHIFTS, feed.OrgUUID())
+        if err == nil {
+            cal, err = orgFeedCalendar(feed.OrgUUID(), loc, from, to)
+        }
+    } else {
+        cal, err = userFeedCalendar(owner.Userid(), loc, from, to)
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+    w.WriteHeader(http.StatusOK)
+    cal.Write(w)
+}
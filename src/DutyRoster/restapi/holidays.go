@@ -0,0 +1,436 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/ical"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Max size of the iCalendar file in a holiday import request.
+const MAX_HOLIDAY_FILE_SIZE = 4 * 1024 * 1024
+
+//JSON representation of a holiday calendar. Pay multiplier and staffpercent
+// are applied to the holidays imported into the calendar.
+type holidayCalendarJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    Name string `json:"name"`
+    PayMultiplier float64 `json:"paymultiplier"`
+    StaffPercent uint64 `json:"staffpercent"`
+    CreateTime time.Time `json:"createtime"`
+}
+
+//JSON representation of a holiday, the date is in the form 'YYYY-MM-DD'.
+// Staffpercent is the staff needed as percent of the minimum staff of the
+// shifts, 0 when the site is closed.
+type holidayJSON struct {
+    UUID string `json:"uuid"`
+    CalendarUUID string `json:"calendaruuid"`
+    Date string `json:"date"`
+    Name string `json:"name"`
+    PayMultiplier float64 `json:"paymultiplier"`
+    StaffPercent *uint64 `json:"staffpercent"`
+    Imported bool `json:"imported"`
+}
+
+//Holiday status of a local day of an org/unit, holiday is left out when the
+// day is not a holiday.
+type holidayStatusJSON struct {
+    OrgUUID string `json:"orguuid"`
+    Date string `json:"date"`
+    IsHoliday bool `json:"isholiday"`
+    Holiday *holidayJSON `json:"holiday,omitempty"`
+}
+
+var holidayRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/holidaycalendars",
+             listHolidayCalendarsHandler),
+    newRoute(http.MethodPost, "/orgs/*/holidaycalendars",
+             createHolidayCalendarHandler),
+    newRoute(http.MethodGet, "/holidaycalendars/*", getHolidayCalendarHandler),
+    newRoute(http.MethodDelete, "/holidaycalendars/*",
+             deleteHolidayCalendarHandler),
+    newRoute(http.MethodGet, "/holidaycalendars/*/holidays",
+             listHolidaysHandler),
+    newRoute(http.MethodPost, "/holidaycalendars/*/holidays",
+             createHolidayHandler),
+    newRoute(http.MethodPost, "/holidaycalendars/*/import",
+             importHolidaysHandler),
+    newRoute(http.MethodDelete, "/holidays/*", deleteHolidayHandler),
+    newRoute(http.MethodGet, "/orgs/*/holidays", listOrgHolidaysHandler),
+    newRoute(http.MethodGet, "/orgs/*/holiday", getOrgHolidayHandler),
+}
+
+func holidayCalendarToJSON(
+                cal *datastore.HolidayCalendar) holidayCalendarJSON {
+    return holidayCalendarJSON{UUID : syncParam.UUIDtoString(cal.UUID()),
+                    OrgUUID : syncParam.UUIDtoString(cal.OrgUUID()),
+                    Name : cal.Name(),
+                    PayMultiplier : cal.PayMultiplier(),
+                    StaffPercent : cal.StaffPercent(),
+                    CreateTime : cal.CreateTime()}
+}
+
+func holidayToJSON(hol *datastore.Holiday) holidayJSON {
+    staffPercent := hol.StaffPercent()
+    return holidayJSON{UUID : syncParam.UUIDtoString(hol.UUID()),
+                    CalendarUUID : syncParam.UUIDtoString(hol.CalendarUUID()),
+                    Date : hol.Date().Format(datastore.HOLIDAY_DATE_FORMAT),
+                    Name : hol.Name(),
+                    PayMultiplier : hol.PayMultiplier(),
+                    StaffPercent : &staffPercent,
+                    Imported : hol.IsImported()}
+}
+
+func holidaysToJSON(hols []datastore.Holiday) []holidayJSON {
+    resp := make([]holidayJSON, 0, len(hols))
+    for i := range(hols) {
+        resp = append(resp, holidayToJSON(&hols[i]))
+    }
+    return resp
+}
+
+//Parse the date in the form 'YYYY-MM-DD', the date is at midnight UTC.
+func parseDate(value string) (time.Time, error) {
+    date, err := time.Parse(datastore.HOLIDAY_DATE_FORMAT, value)
+    if err != nil {
+        return date, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return date, nil
+}
+
+//Parse the optional date in query param 'name', 'defDate' is returned when
+// the param is not present.
+func parseQueryDate(req *http.Request, name string,
+                    defDate time.Time) (time.Time, error) {
+    value := req.URL.Query().Get(name)
+    if len(value) == 0 {
+        return defDate, nil
+    }
+    return parseDate(value)
+}
+
+//Range of dates of the holiday list queries, defaults to a year from today.
+func parseQueryDateRange(req *http.Request) (time.Time, time.Time, error) {
+    now := time.Now().UTC()
+    from, err := parseQueryDate(req, "from",
+                        time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0,
+                                  0, time.UTC))
+    if err != nil {
+        return from, from, err
+    }
+    to, err := parseQueryDate(req, "to", from.AddDate(1, 0, 0))
+    if err != nil {
+        return from, to, err
+    }
+    if !to.After(from) {
+        return from, to, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return from, to, nil
+}
+
+func listHolidayCalendarsHandler(w http.ResponseWriter, req *http.Request,
+                                 params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    cals, err := datastore.GetDataStoreObj().ListHolidayCalendars(orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]holidayCalendarJSON, 0, len(cals))
+    for i := range(cals) {
+        resp = append(resp, holidayCalendarToJSON(&cals[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Pay multiplier defaults to 1 and staffpercent to 100 when not given.
+func createHolidayCalendarHandler(w http.ResponseWriter, req *http.Request,
+                                  params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_HOLIDAYS, orgUUID) {
+        return
+    }
+    body := holidayCalendarJSON{StaffPercent : datastore.DEFAULT_STAFF_PERCENT}
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    cal := datastore.NewHolidayCalendar(orgUUID, body.Name,
+                                        body.PayMultiplier, body.StaffPercent)
+    err = datastore.GetDataStoreObj().CreateHolidayCalendar(cal)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, holidayCalendarToJSON(cal))
+}
+
+//Get the holiday calendar in url param 'uuidStr' and authorize 'action' on
+// its org/unit, nil on failure with the error response written.
+func getAuthorizedHolidayCalendar(w http.ResponseWriter, req *http.Request,
+                        uuidStr string,
+                        action authz.Action) *datastore.HolidayCalendar {
+    uuid, err := parseUUID(uuidStr)
+    if err != nil {
+        writeError(w, err)
+        return nil
+    }
+    cal := datastore.NewHolidayCalendarRef(uuid)
+    err = datastore.GetDataStoreObj().GetHolidayCalendar(cal)
+    if err != nil {
+        writeError(w, err)
+        return nil
+    }
+    if !authorizeRequest(w, req, action, cal.OrgUUID()) {
+        return nil
+    }
+    return cal
+}
+
+func getHolidayCalendarHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    cal := getAuthorizedHolidayCalendar(w, req, params[0], authz.VIEW_ORG)
+    if cal == nil {
+        return
+    }
+    writeJSON(w, http.StatusOK, holidayCalendarToJSON(cal))
+}
+
+func deleteHolidayCalendarHandler(w http.ResponseWriter, req *http.Request,
+                                  params []string) {
+    cal := getAuthorizedHolidayCalendar(w, req, params[0],
+                                            authz.MANAGE_HOLIDAYS)
+    if cal == nil {
+        return
+    }
+    err := datastore.GetDataStoreObj().DeleteHolidayCalendar(cal)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Holidays of the calendar with the dates in query params 'from' and 'to'.
+func listHolidaysHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    cal := getAuthorizedHolidayCalendar(w, req, params[0], authz.VIEW_ORG)
+    if cal == nil {
+        return
+    }
+    from, to, err := parseQueryDateRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    hols, err := datastore.GetDataStoreObj().ListHolidays(cal.UUID(), from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, holidaysToJSON(hols))
+}
+
+//Add a holiday by hand, pay multiplier and staffpercent default to the ones
+// of the calendar when not given.
+func createHolidayHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    cal := getAuthorizedHolidayCalendar(w, req, params[0],
+                                            authz.MANAGE_HOLIDAYS)
+    if cal == nil {
+        return
+    }
+    var body holidayJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    date, err := parseDate(body.Date)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if body.PayMultiplier == 0 {
+        body.PayMultiplier = cal.PayMultiplier()
+    }
+    staffPercent := cal.StaffPercent()
+    if body.StaffPercent != nil {
+        staffPercent = *body.StaffPercent
+    }
+    hol := datastore.NewHoliday(cal.UUID(), date, body.Name,
+                                body.PayMultiplier, staffPercent)
+    err = datastore.GetDataStoreObj().CreateHoliday(hol)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, holidayToJSON(hol))
+}
+
+//Import the holidays of the iCalendar file in the request body into the
+// calendar, the holidays imported earlier are replaced.
+func importHolidaysHandler(w http.ResponseWriter, req *http.Request,
+                           params []string) {
+    cal := getAuthorizedHolidayCalendar(w, req, params[0],
+                                            authz.MANAGE_HOLIDAYS)
+    if cal == nil {
+        return
+    }
+    events, err := ical.ReadEvents(http.MaxBytesReader(w, req.Body,
+                                                MAX_HOLIDAY_FILE_SIZE))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    from, to := datastore.HolidayImportRange(time.Now())
+    hols, err := datastore.HolidaysFromEvents(cal, events, from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = datastore.GetDataStoreObj().ImportHolidays(cal.UUID(), hols)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, holidaysToJSON(hols))
+}
+
+func deleteHolidayHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    hol := datastore.NewHolidayRef(uuid)
+    err = dbObj.GetHoliday(hol)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    cal := getAuthorizedHolidayCalendar(w, req,
+                                syncParam.UUIDtoString(hol.CalendarUUID()),
+                                authz.MANAGE_HOLIDAYS)
+    if cal == nil {
+        return
+    }
+    err = dbObj.DeleteHoliday(hol)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Holidays in effect for the org/unit with the dates in query params 'from'
+// and 'to', the calendars are inherited from the parent chain.
+func listOrgHolidaysHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    from, to, err := parseQueryDateRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    hols, err := datastore.GetDataStoreObj().ListOrgHolidays(orgUUID, from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, holidaysToJSON(hols))
+}
+
+//Holiday status of the org/unit on the local day in query param 'date', or
+// the local day of instant 'at' in the time zone of the org/unit. Defaults to
+// today.
+func getOrgHolidayHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    or := datastore.NewOrgRef(orgUUID)
+    err = dbObj.GetOrg(or)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    at, err := parseQueryTime(req, "at", time.Now())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    date, err := parseQueryDate(req, "date", time.Time{})
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !date.IsZero() {
+        at = timezone.Date(date.Year(), date.Month(), date.Day(), 0,
+                           or.Location())
+    }
+    hol, err := dbObj.IsHoliday(orgUUID, at)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := holidayStatusJSON{OrgUUID : syncParam.UUIDtoString(orgUUID),
+                Date : at.In(or.Location()).Format(
+                                        datastore.HOLIDAY_DATE_FORMAT),
+                IsHoliday : hol != nil}
+    if hol != nil {
+        holJSON := holidayToJSON(hol)
+        resp.Holiday = &holJSON
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
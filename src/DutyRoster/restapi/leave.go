@@ -0,0 +1,508 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of a leave policy, durations are in seconds.
+type leavePolicyJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    Name string `json:"name"`
+    Kind string `json:"kind"`
+    Accrual int64 `json:"accrual"`
+    MaxBalance int64 `json:"maxbalance"`
+    Tracked bool `json:"tracked"`
+}
+
+//JSON representation of a leave balance, balance is in seconds.
+type leaveBalanceJSON struct {
+    Userid string `json:"userid"`
+    PolicyUUID string `json:"policyuuid"`
+    Balance int64 `json:"balance"`
+    LastAccrual time.Time `json:"lastaccrual"`
+}
+
+//Request body to adjust a leave balance, delta is in seconds.
+type leaveAdjustJSON struct {
+    Delta int64 `json:"delta"`
+}
+
+//JSON representation of a leave request, charge is in seconds.
+type leaveJSON struct {
+    UUID string `json:"uuid"`
+    Userid string `json:"userid"`
+    OrgUUID string `json:"orguuid"`
+    PolicyUUID string `json:"policyuuid"`
+    StartTime time.Time `json:"starttime"`
+    EndTime time.Time `json:"endtime"`
+    Charge int64 `json:"charge"`
+    Status string `json:"status"`
+    Note string `json:"note"`
+    CreateTime time.Time `json:"createtime"`
+    DecidedBy string `json:"decidedby"`
+    DecideTime *time.Time `json:"decidetime,omitempty"`
+}
+
+//Names of the leave kinds in JSON.
+var leaveKindNames = map[datastore.LeaveKindBit]string{
+    datastore.LEAVE_ANNUAL : "annual",
+    datastore.LEAVE_SICK : "sick",
+    datastore.LEAVE_UNPAID : "unpaid",
+    datastore.LEAVE_CUSTOM : "custom",
+}
+
+//Names of the leave status in JSON.
+var leaveStatusNames = map[datastore.LeaveStatusBit]string{
+    datastore.LEAVE_REQUESTED : "requested",
+    datastore.LEAVE_APPROVED : "approved",
+    datastore.LEAVE_REJECTED : "rejected",
+    datastore.LEAVE_CANCELLED : "cancelled",
+}
+
+var leaveRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/leavepolicies", listLeavePoliciesHandler),
+    newRoute(http.MethodPost, "/orgs/*/leavepolicies",
+             createLeavePolicyHandler),
+    newRoute(http.MethodGet, "/leavepolicies/*", getLeavePolicyHandler),
+    newRoute(http.MethodDelete, "/leavepolicies/*", deleteLeavePolicyHandler),
+    newRoute(http.MethodGet, "/users/*/leavebalances/*",
+             getLeaveBalanceHandler),
+    newRoute(http.MethodPost, "/users/*/leavebalances/*",
+             adjustLeaveBalanceHandler),
+    newRoute(http.MethodGet, "/users/*/leave", listUserLeaveHandler),
+    newRoute(http.MethodPost, "/users/*/leave", createLeaveHandler),
+    newRoute(http.MethodGet, "/users/*/busy", listUserBusyHandler),
+    newRoute(http.MethodGet, "/orgs/*/leave", listOrgLeaveHandler),
+    newRoute(http.MethodGet, "/leave/*", getLeaveHandler),
+    newRoute(http.MethodPost, "/leave/*/approve", approveLeaveHandler),
+    newRoute(http.MethodPost, "/leave/*/reject", rejectLeaveHandler),
+    newRoute(http.MethodPost, "/leave/*/cancel", cancelLeaveHandler),
+}
+
+func leavePolicyToJSON(policy *datastore.LeavePolicy) leavePolicyJSON {
+    return leavePolicyJSON{UUID : syncParam.UUIDtoString(policy.UUID()),
+                           OrgUUID : syncParam.UUIDtoString(policy.OrgUUID()),
+                           Name : policy.Name(),
+                           Kind : leaveKindNames[policy.Kind()],
+                           Accrual : int64(policy.Accrual() / time.Second),
+                           MaxBalance : int64(policy.MaxBalance() /
+                                              time.Second),
+                           Tracked : policy.IsTracked()}
+}
+
+func leaveBalanceToJSON(bal *datastore.LeaveBalance) leaveBalanceJSON {
+    return leaveBalanceJSON{Userid : bal.Userid(),
+                            PolicyUUID : syncParam.UUIDtoString(
+                                                        bal.PolicyUUID()),
+                            Balance : int64(bal.Balance() / time.Second),
+                            LastAccrual : bal.LastAccrual()}
+}
+
+func leaveToJSON(leave *datastore.LeaveRequest) leaveJSON {
+    resp := leaveJSON{UUID : syncParam.UUIDtoString(leave.UUID()),
+                      Userid : leave.Userid(),
+                      OrgUUID : syncParam.UUIDtoString(leave.OrgUUID()),
+                      PolicyUUID : syncParam.UUIDtoString(leave.PolicyUUID()),
+                      StartTime : leave.StartTime(),
+                      EndTime : leave.EndTime(),
+                      Charge : int64(leave.Charge() / time.Second),
+                      Status : leaveStatusNames[leave.Status()],
+                      Note : leave.Note(),
+                      CreateTime : leave.CreateTime(),
+                      DecidedBy : leave.DecidedBy()}
+    if !leave.DecideTime().IsZero() {
+        decideTime := leave.DecideTime()
+        resp.DecideTime = &decideTime
+    }
+    return resp
+}
+
+func leavesToJSON(leaves []datastore.LeaveRequest) []leaveJSON {
+    resp := make([]leaveJSON, 0, len(leaves))
+    for i := range(leaves) {
+        resp = append(resp, leaveToJSON(&leaves[i]))
+    }
+    return resp
+}
+
+//Find the leave kind with JSON name 'name'.
+func parseLeaveKind(name string) (datastore.LeaveKindBit, error) {
+    for kind, kindName := range(leaveKindNames) {
+        if kindName == name {
+            return kind, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Find the leave status with JSON name 'name'.
+func parseLeaveStatus(name string) (datastore.LeaveStatusBit, error) {
+    for status, statusName := range(leaveStatusNames) {
+        if statusName == name {
+            return status, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Get the leave policy in url param 'uuidStr', the error response is written
+// on failure.
+func getLeavePolicyParam(w http.ResponseWriter,
+                         uuidStr string) (*datastore.LeavePolicy, bool) {
+    uuid, err := parseUUID(uuidStr)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    policy := datastore.NewLeavePolicyRef(uuid)
+    err = datastore.GetDataStoreObj().GetLeavePolicy(policy)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    return policy, true
+}
+
+//Get the leave request in url param 'uuidStr', the error response is written
+// on failure.
+func getLeaveParam(w http.ResponseWriter,
+                   uuidStr string) (*datastore.LeaveRequest, bool) {
+    uuid, err := parseUUID(uuidStr)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    leave := datastore.NewLeaveRequestRef(uuid)
+    err = datastore.GetDataStoreObj().GetLeaveRequest(leave)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    return leave, true
+}
+
+//Policies of the org/unit and its ancestors, ie: the leave types a member of
+// the org/unit can request.
+func listLeavePoliciesHandler(w http.ResponseWriter, req *http.Request,
+                              params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    policies, err := datastore.GetDataStoreObj().ListLeavePolicies(orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]leavePolicyJSON, 0, len(policies))
+    for i := range(policies) {
+        resp = append(resp, leavePolicyToJSON(&policies[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func createLeavePolicyHandler(w http.ResponseWriter, req *http.Request,
+                              params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_LEAVE, orgUUID) {
+        return
+    }
+    var body leavePolicyJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    kind, err := parseLeaveKind(body.Kind)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    policy := datastore.NewLeavePolicy(orgUUID, body.Name, kind,
+                            time.Duration(body.Accrual) * time.Second,
+                            time.Duration(body.MaxBalance) * time.Second,
+                            body.Tracked)
+    err = datastore.GetDataStoreObj().CreateLeavePolicy(policy)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, leavePolicyToJSON(policy))
+}
+
+func getLeavePolicyHandler(w http.ResponseWriter, req *http.Request,
+                           params []string) {
+    policy, ok := getLeavePolicyParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, policy.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, leavePolicyToJSON(policy))
+}
+
+func deleteLeavePolicyHandler(w http.ResponseWriter, req *http.Request,
+                              params []string) {
+    policy, ok := getLeavePolicyParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_LEAVE, policy.OrgUUID()) {
+        return
+    }
+    err := datastore.GetDataStoreObj().DeleteLeavePolicy(policy)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+func getLeaveBalanceHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    policyUUID, err := parseUUID(params[1])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    bal := datastore.NewLeaveBalanceRef(params[0], policyUUID)
+    err = datastore.GetDataStoreObj().GetLeaveBalance(bal)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, leaveBalanceToJSON(bal))
+}
+
+//Adjust the balance by a signed delta, eg: for carry over or correction.
+// Users cannot adjust their own balance.
+func adjustLeaveBalanceHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    policy, ok := getLeavePolicyParam(w, params[1])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_LEAVE, policy.OrgUUID()) {
+        return
+    }
+    var body leaveAdjustJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    bal := datastore.NewLeaveBalanceRef(params[0], policy.UUID())
+    err = datastore.GetDataStoreObj().AdjustLeaveBalance(bal,
+                                    time.Duration(body.Delta) * time.Second)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, leaveBalanceToJSON(bal))
+}
+
+func listUserLeaveHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    leaves, err := datastore.GetDataStoreObj().ListUserLeave(params[0], from,
+                                                             to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, leavesToJSON(leaves))
+}
+
+//Users request their own leave, approvers of the org/unit can request it on
+// behalf of a member.
+func createLeaveHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    var body leaveJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    orgUUID, err := parseUUID(body.OrgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    policyUUID, err := parseUUID(body.PolicyUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if requestIdentity(req).User().Userid() != params[0] &&
+        !authorizeRequest(w, req, authz.APPROVE_LEAVE, orgUUID) {
+        return
+    }
+    leave := datastore.NewLeaveRequest(params[0], orgUUID, policyUUID,
+                                       body.StartTime, body.EndTime,
+                                       time.Duration(body.Charge) * time.Second,
+                                       body.Note)
+    err = datastore.GetDataStoreObj().CreateLeaveRequest(leave)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, leaveToJSON(leave))
+}
+
+//Approved leaves of the user in query params 'from' and 'to', ie: the time
+// the user cannot be rostered.
+func listUserBusyHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    leaves, err := datastore.GetDataStoreObj().ListUserBusy(params[0], from,
+                                                            to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, leavesToJSON(leaves))
+}
+
+//Leave requests of the org/unit in query param 'status', pending requests
+// when not given.
+func listOrgLeaveHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.APPROVE_LEAVE, orgUUID) {
+        return
+    }
+    status := datastore.LEAVE_REQUESTED
+    if statusStr := req.URL.Query().Get("status"); len(statusStr) != 0 {
+        status, err = parseLeaveStatus(statusStr)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+    }
+    leaves, err := datastore.GetDataStoreObj().ListOrgLeave(orgUUID, status)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, leavesToJSON(leaves))
+}
+
+func getLeaveHandler(w http.ResponseWriter, req *http.Request,
+                     params []string) {
+    leave, ok := getLeaveParam(w, params[0])
+    if !ok {
+        return
+    }
+    if requestIdentity(req).User().Userid() != leave.Userid() &&
+        !authorizeRequest(w, req, authz.APPROVE_LEAVE, leave.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, leaveToJSON(leave))
+}
+
+//Move the leave request in url param to 'status' on behalf of the user of
+// request.
+func updateLeaveStatus(w http.ResponseWriter, req *http.Request,
+                       leave *datastore.LeaveRequest,
+                       status datastore.LeaveStatusBit) {
+    err := datastore.GetDataStoreObj().UpdateLeaveStatus(leave, status,
+                                        requestIdentity(req).User().Userid())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, leaveToJSON(leave))
+}
+
+//Approvers decide on the requests of org/unit, never on their own request.
+func decideLeave(w http.ResponseWriter, req *http.Request, uuidStr string,
+                 status datastore.LeaveStatusBit) {
+    leave, ok := getLeaveParam(w, uuidStr)
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.APPROVE_LEAVE, leave.OrgUUID()) {
+        return
+    }
+    if requestIdentity(req).User().Userid() == leave.Userid() {
+        writeError(w, fmt.Errorf("%s",
+                                 errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+        return
+    }
+    updateLeaveStatus(w, req, leave, status)
+}
+
+func approveLeaveHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    decideLeave(w, req, params[0], datastore.LEAVE_APPROVED)
+}
+
+func rejectLeaveHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    decideLeave(w, req, params[0], datastore.LEAVE_REJECTED)
+}
+
+//Users cancel their own leave, approvers can cancel any leave of org/unit.
+func cancelLeaveHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    leave, ok := getLeaveParam(w, params[0])
+    if !ok {
+        return
+    }
+    if requestIdentity(req).User().Userid() != leave.Userid() &&
+        !authorizeRequest(w, req, authz.APPROVE_LEAVE, leave.OrgUUID()) {
+        return
+    }
+    updateLeaveStatus(w, req, leave, datastore.LEAVE_CANCELLED)
+}
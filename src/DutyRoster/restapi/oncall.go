@@ -0,0 +1,445 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of an on-call rotation. Turn length, offset and
+// duration are in seconds, duration 0 when the rotation is not restricted.
+type onCallRotationJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    Name string `json:"name"`
+    Level string `json:"level"`
+    Layer uint64 `json:"layer"`
+    HandoffTime time.Time `json:"handofftime"`
+    TurnLength int64 `json:"turnlength"`
+    Members []string `json:"members"`
+    Weekdays uint64 `json:"weekdays"`
+    StartOffset int64 `json:"startoffset"`
+    Duration int64 `json:"duration"`
+    CreateTime time.Time `json:"createtime"`
+}
+
+//JSON representation of an on-call override.
+type onCallOverrideJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    Level string `json:"level"`
+    Userid string `json:"userid"`
+    StartTime time.Time `json:"starttime"`
+    EndTime time.Time `json:"endtime"`
+    CreateTime time.Time `json:"createtime"`
+}
+
+//JSON representation of an escalation policy, steptimeout is in seconds.
+type escalationPolicyJSON struct {
+    OrgUUID string `json:"orguuid"`
+    Manager string `json:"manager"`
+    StepTimeout int64 `json:"steptimeout"`
+}
+
+//JSON representation of a user on call and the org/unit that covers it.
+type onCallUserJSON struct {
+    Userid string `json:"userid"`
+    OrgUUID string `json:"orguuid"`
+}
+
+//Users on call at an instant in the escalation order, the levels that are not
+// covered are left out. Steptimeout is in seconds.
+type onCallJSON struct {
+    OrgUUID string `json:"orguuid"`
+    At time.Time `json:"at"`
+    Primary *onCallUserJSON `json:"primary,omitempty"`
+    Backup *onCallUserJSON `json:"backup,omitempty"`
+    Manager *onCallUserJSON `json:"manager,omitempty"`
+    StepTimeout int64 `json:"steptimeout"`
+}
+
+//Names of the on-call levels in JSON.
+var onCallLevelNames = map[datastore.OnCallLevelBit]string{
+    datastore.ONCALL_PRIMARY : "primary",
+    datastore.ONCALL_BACKUP : "backup",
+}
+
+var onCallRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/rotations", listOnCallRotationsHandler),
+    newRoute(http.MethodPost, "/orgs/*/rotations",
+             createOnCallRotationHandler),
+    newRoute(http.MethodGet, "/rotations/*", getOnCallRotationHandler),
+    newRoute(http.MethodDelete, "/rotations/*", deleteOnCallRotationHandler),
+    newRoute(http.MethodGet, "/orgs/*/oncalloverrides",
+             listOnCallOverridesHandler),
+    newRoute(http.MethodPost, "/orgs/*/oncalloverrides",
+             createOnCallOverrideHandler),
+    newRoute(http.MethodDelete, "/oncalloverrides/*",
+             deleteOnCallOverrideHandler),
+    newRoute(http.MethodGet, "/orgs/*/escalation",
+             getEscalationPolicyHandler),
+    newRoute(http.MethodPut, "/orgs/*/escalation",
+             setEscalationPolicyHandler),
+    newRoute(http.MethodDelete, "/orgs/*/escalation",
+             deleteEscalationPolicyHandler),
+    newRoute(http.MethodGet, "/orgs/*/oncall", whoIsOnCallHandler),
+}
+
+func onCallRotationToJSON(rot *datastore.OnCallRotation) onCallRotationJSON {
+    return onCallRotationJSON{UUID : syncParam.UUIDtoString(rot.UUID()),
+                    OrgUUID : syncParam.UUIDtoString(rot.OrgUUID()),
+                    Name : rot.Name(),
+                    Level : onCallLevelNames[rot.Level()],
+                    Layer : rot.Layer(),
+                    HandoffTime : rot.HandoffTime(),
+                    TurnLength : int64(rot.TurnLength() / time.Second),
+                    Members : rot.Members(),
+                    Weekdays : rot.Weekdays(),
+                    StartOffset : int64(rot.StartOffset() / time.Second),
+                    Duration : int64(rot.Duration() / time.Second),
+                    CreateTime : rot.CreateTime()}
+}
+
+func onCallOverrideToJSON(ovr *datastore.OnCallOverride) onCallOverrideJSON {
+    return onCallOverrideJSON{UUID : syncParam.UUIDtoString(ovr.UUID()),
+                    OrgUUID : syncParam.UUIDtoString(ovr.OrgUUID()),
+                    Level : onCallLevelNames[ovr.Level()],
+                    Userid : ovr.Userid(),
+                    StartTime : ovr.StartTime(),
+                    EndTime : ovr.EndTime(),
+                    CreateTime : ovr.CreateTime()}
+}
+
+func escalationPolicyToJSON(
+                policy *datastore.EscalationPolicy) escalationPolicyJSON {
+    return escalationPolicyJSON{
+                OrgUUID : syncParam.UUIDtoString(policy.OrgUUID()),
+                Manager : policy.Manager(),
+                StepTimeout : int64(policy.StepTimeout() / time.Second)}
+}
+
+//Nil when the level is not covered, to leave it out of the response.
+func onCallUserToJSON(userid string,
+                      orgUUID syncParam.UUID) *onCallUserJSON {
+    if len(userid) == 0 {
+        return nil
+    }
+    return &onCallUserJSON{Userid : userid,
+                           OrgUUID : syncParam.UUIDtoString(orgUUID)}
+}
+
+func onCallToJSON(oc *datastore.OnCall) onCallJSON {
+    return onCallJSON{OrgUUID : syncParam.UUIDtoString(oc.OrgUUID()),
+                At : oc.At(),
+                Primary : onCallUserToJSON(oc.Primary(), oc.PrimaryOrgUUID()),
+                Backup : onCallUserToJSON(oc.Backup(), oc.BackupOrgUUID()),
+                Manager : onCallUserToJSON(oc.Manager(), oc.ManagerOrgUUID()),
+                StepTimeout : int64(oc.StepTimeout() / time.Second)}
+}
+
+//Find the on-call level with JSON name 'name'.
+func parseOnCallLevel(name string) (datastore.OnCallLevelBit, error) {
+    for level, levelName := range(onCallLevelNames) {
+        if levelName == name {
+            return level, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+func listOnCallRotationsHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    rotations, err := datastore.GetDataStoreObj().ListOnCallRotations(orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]onCallRotationJSON, 0, len(rotations))
+    for i := range(rotations) {
+        resp = append(resp, onCallRotationToJSON(&rotations[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func createOnCallRotationHandler(w http.ResponseWriter, req *http.Request,
+                                 params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body onCallRotationJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    level, err := parseOnCallLevel(body.Level)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    rot := datastore.NewOnCallRotation(orgUUID, body.Name, level, body.Layer,
+                            body.HandoffTime,
+                            time.Duration(body.TurnLength) * time.Second,
+                            body.Members)
+    rot.SetRestriction(body.Weekdays,
+                       time.Duration(body.StartOffset) * time.Second,
+                       time.Duration(body.Duration) * time.Second)
+    err = datastore.GetDataStoreObj().CreateOnCallRotation(rot)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, onCallRotationToJSON(rot))
+}
+
+//Get the rotation in url param 'uuidStr', the error response is written on
+// failure.
+func getOnCallRotationParam(w http.ResponseWriter,
+                        uuidStr string) (*datastore.OnCallRotation, bool) {
+    uuid, err := parseUUID(uuidStr)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    rot := datastore.NewOnCallRotationRef(uuid)
+    err = datastore.GetDataStoreObj().GetOnCallRotation(rot)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    return rot, true
+}
+
+func getOnCallRotationHandler(w http.ResponseWriter, req *http.Request,
+                              params []string) {
+    rot, ok := getOnCallRotationParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, rot.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, onCallRotationToJSON(rot))
+}
+
+func deleteOnCallRotationHandler(w http.ResponseWriter, req *http.Request,
+                                 params []string) {
+    rot, ok := getOnCallRotationParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, rot.OrgUUID()) {
+        return
+    }
+    err := datastore.GetDataStoreObj().DeleteOnCallRotation(rot)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Overrides of org/unit in query params 'from' and 'to'.
+func listOnCallOverridesHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    overrides, err := datastore.GetDataStoreObj().ListOnCallOverrides(orgUUID,
+                                                                from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]onCallOverrideJSON, 0, len(overrides))
+    for i := range(overrides) {
+        resp = append(resp, onCallOverrideToJSON(&overrides[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func createOnCallOverrideHandler(w http.ResponseWriter, req *http.Request,
+                                 params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body onCallOverrideJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    level, err := parseOnCallLevel(body.Level)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    ovr := datastore.NewOnCallOverride(orgUUID, level, body.Userid,
+                                       body.StartTime, body.EndTime)
+    err = datastore.GetDataStoreObj().CreateOnCallOverride(ovr)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, onCallOverrideToJSON(ovr))
+}
+
+func deleteOnCallOverrideHandler(w http.ResponseWriter, req *http.Request,
+                                 params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    ovr := datastore.NewOnCallOverrideRef(uuid)
+    err = dbObj.GetOnCallOverride(ovr)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, ovr.OrgUUID()) {
+        return
+    }
+    err = dbObj.DeleteOnCallOverride(ovr)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+func getEscalationPolicyHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    policy := datastore.NewEscalationPolicyRef(orgUUID)
+    err = datastore.GetDataStoreObj().GetEscalationPolicy(policy)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, escalationPolicyToJSON(policy))
+}
+
+func setEscalationPolicyHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body escalationPolicyJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    policy := datastore.NewEscalationPolicy(orgUUID, body.Manager,
+                            time.Duration(body.StepTimeout) * time.Second)
+    err = datastore.GetDataStoreObj().SetEscalationPolicy(policy)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, escalationPolicyToJSON(policy))
+}
+
+func deleteEscalationPolicyHandler(w http.ResponseWriter, req *http.Request,
+                                   params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    err = datastore.GetDataStoreObj().DeleteEscalationPolicy(
+                                datastore.NewEscalationPolicyRef(orgUUID))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Who is on call for org/unit at the instant in query param 'at', now when not
+// given. Levels not covered in the org/unit fall back to the ancestors.
+func whoIsOnCallHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    at, err := parseQueryTime(req, "at", time.Now())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    oc, err := datastore.GetDataStoreObj().WhoIsOnCall(orgUUID, at)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, onCallToJSON(oc))
+}
@@ -0,0 +1,418 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "strconv"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of an org/unit. Parent is the uuid of parent org, empty
+// for a top level organization.
+type orgJSON struct {
+    UUID string `json:"uuid"`
+    Name string `json:"name"`
+    Address string `json:"address"`
+    Parent string `json:"parent"`
+    Status uint64 `json:"status"`
+    StartTime time.Time `json:"starttime"`
+    //Validity in days, 0 for unlimited validity.
+    Validity uint64 `json:"validity"`
+    //IANA time zone name, eg: Europe/Berlin. Zone of the parent is used when
+    // not given.
+    TimeZone string `json:"timezone"`
+}
+
+//JSON representation of an org/unit with all its descendants.
+type orgTreeJSON struct {
+    Org orgJSON `json:"org"`
+    Children []orgTreeJSON `json:"children"`
+}
+
+var orgRoutes = []route{
+    newRoute(http.MethodPost, "/orgs", createOrgHandler),
+    newRoute(http.MethodGet, "/orgs/*", getOrgHandler),
+    newRoute(http.MethodPut, "/orgs/*", updateOrgHandler),
+    newRoute(http.MethodDelete, "/orgs/*", deleteOrgHandler),
+    newRoute(http.MethodGet, "/orgs/*/children", listChildOrgsHandler),
+    newRoute(http.MethodGet, "/orgs/*/tree", getOrgTreeHandler),
+    newRoute(http.MethodGet, "/orgs/*/members", listOrgMembershipsHandler),
+    newRoute(http.MethodPost, "/orgs/*/members", grantMembershipHandler),
+    newRoute(http.MethodDelete, "/orgs/*/members/*", revokeMembershipHandler),
+    newRoute(http.MethodGet, "/orgs/*/members/*/roles",
+             getEffectiveRolesHandler),
+}
+
+func orgToJSON(or *datastore.Org) orgJSON {
+    resp := orgJSON{UUID : syncParam.UUIDtoString(or.UUID()),
+                    Name : or.Name(),
+                    Address : or.Address(),
+                    Status : uint64(or.Status()),
+                    StartTime : or.StartTime(),
+                    Validity : or.Validity(),
+                    TimeZone : or.TimeZone()}
+    if or.Parent() != nil {
+        resp.Parent = syncParam.UUIDtoString(or.Parent().UUID())
+    }
+    return resp
+}
+
+func orgTreeToJSON(tree *datastore.OrgTree) orgTreeJSON {
+    resp := orgTreeJSON{Org : orgToJSON(tree.Org),
+                        Children : make([]orgTreeJSON, 0, len(tree.Children))}
+    for _, child := range(tree.Children) {
+        resp.Children = append(resp.Children, orgTreeToJSON(child))
+    }
+    return resp
+}
+
+//New orgs are always created in requested state, status in the request is
+// ignored. Any user can create a top level organization and becomes its root
+// admin, child org/units are created by the admins of the parent. The roles in
+// an org grant nothing until it is approved, by the admins of the parent for a
+// unit and offline with 'org approve' for a top level org.
+func createOrgHandler(w http.ResponseWriter, req *http.Request,
+                      params []string) {
+    var body orgJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var parent *datastore.Org
+    if len(body.Parent) != 0 {
+        parentUUID, err := parseUUID(body.Parent)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        if !authorizeRequest(w, req, authz.CREATE_ORG, parentUUID) {
+            return
+        }
+        parent = datastore.NewOrgRef(parentUUID)
+    }
+    or := datastore.NewOrg(body.Name, body.Address, parent,
+                           datastore.ORG_REQUESTED, body.Validity)
+    or.SetTimeZone(body.TimeZone)
+    dbObj := datastore.GetDataStoreObj()
+    if parent == nil {
+        err = dbObj.CreateOrgWithAdmin(or,
+                                requestIdentity(req).User().Userid())
+    } else {
+        err = dbObj.CreateOrg(or)
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, orgToJSON(or))
+}
+
+func getOrgHandler(w http.ResponseWriter, req *http.Request,
+                   params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    or := datastore.NewOrgRef(orgUUID)
+    err = datastore.GetDataStoreObj().GetOrg(or)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, orgToJSON(or))
+}
+
+//Only status, validity and time zone can be updated, status and validity
+// are applied to all the descendants as well. Zero fields in the request are
+// left as is. Status and validity of a unit are changed by the admins of its
+// parent, the admins of an org cannot approve or extend it. Top level orgs
+// are approved offline with 'org approve'.
+func updateOrgHandler(w http.ResponseWriter, req *http.Request,
+                      params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var body orgJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    or := datastore.NewOrgRef(orgUUID)
+    err = dbObj.GetOrg(or)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if body.Status != 0 || body.Validity != 0 {
+        if or.Parent() == nil {
+            writeError(w, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+            return
+        }
+        if !authorizeRequest(w, req, authz.UPDATE_ORG, or.Parent().UUID()) {
+            return
+        }
+    }
+    //Time zone is changed by the admins of the org itself.
+    if (len(body.TimeZone) != 0 || (body.Status == 0 && body.Validity == 0)) &&
+        !authorizeRequest(w, req, authz.UPDATE_ORG, orgUUID) {
+        return
+    }
+    if body.Status != 0 {
+        or.SetStatus(datastore.OrgStatusBit(body.Status))
+    }
+    if body.Validity != 0 {
+        or.SetValidity(body.Validity)
+    }
+    if len(body.TimeZone) != 0 {
+        or.SetTimeZone(body.TimeZone)
+    }
+    err = dbObj.UpdateOrg(or)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, orgToJSON(or))
+}
+
+func deleteOrgHandler(w http.ResponseWriter, req *http.Request,
+                      params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.DELETE_ORG, orgUUID) {
+        return
+    }
+    err = datastore.GetDataStoreObj().DeleteOrg(datastore.NewOrgRef(orgUUID))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+func listChildOrgsHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    children, err := datastore.GetDataStoreObj().ListChildOrgs(
+                                            datastore.NewOrgRef(orgUUID))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]orgJSON, 0, len(children))
+    for i := range(children) {
+        resp = append(resp, orgToJSON(&children[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func getOrgTreeHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_ORG, orgUUID) {
+        return
+    }
+    tree, err := datastore.GetDataStoreObj().GetOrgTree(
+                                            datastore.NewOrgRef(orgUUID))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, orgTreeToJSON(tree))
+}
+
+func listOrgMembershipsHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_MEMBERS, orgUUID) {
+        return
+    }
+    members, err := datastore.GetDataStoreObj().ListOrgMemberships(orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]membershipJSON, 0, len(members))
+    for i := range(members) {
+        resp = append(resp, membershipToJSON(&members[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Grant the role bits in request to the user. Joining an org/unit needs the
+// consent of the user, an invite is created and 202 is returned when the user
+// is not a member of the org/unit yet. Role bits are granted at once to the
+// existing members and to the user itself.
+func grantMembershipHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var body membershipJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = authz.AuthorizeGrant(requestIdentity(req).User(),
+                               datastore.RoleBit(body.Roles), orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    member := datastore.NewUserOrgRole(body.Userid,
+                                       datastore.RoleBit(body.Roles), orgUUID)
+    isMember := body.Userid == requestIdentity(req).User().Userid()
+    if !isMember {
+        members, err := dbObj.ListUserMemberships(body.Userid)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        for i := range(members) {
+            if members[i].UUID() == orgUUID {
+                isMember = true
+            }
+        }
+    }
+    if !isMember {
+        err = dbObj.CreateMembershipInvite(member)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        writeJSON(w, http.StatusAccepted, membershipToJSON(member))
+        return
+    }
+    err = dbObj.GrantUserOrgRole(member)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, membershipToJSON(member))
+}
+
+//Revoke the role bits in query param 'roles' from the user, all the roles are
+// revoked when no roles are given.
+func revokeMembershipHandler(w http.ResponseWriter, req *http.Request,
+                             params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    var roles uint64
+    rolesStr := req.URL.Query().Get("roles")
+    if len(rolesStr) != 0 {
+        roles, err = strconv.ParseUint(rolesStr, 10, 64)
+        if err != nil || roles == 0 {
+            writeError(w, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM]))
+            return
+        }
+    } else {
+        members, err := dbObj.ListUserMemberships(params[1])
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        for i := range(members) {
+            if members[i].UUID() == orgUUID {
+                roles = uint64(members[i].RoleType())
+            }
+        }
+        if roles == 0 {
+            writeError(w, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND]))
+            return
+        }
+    }
+    err = authz.AuthorizeGrant(requestIdentity(req).User(),
+                               datastore.RoleBit(roles), orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    member := datastore.NewUserOrgRole(params[1], datastore.RoleBit(roles),
+                                       orgUUID)
+    err = dbObj.RevokeUserOrgRole(member)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Roles of the user in org/unit, including the roles inherited from ancestors.
+//Users can see their own roles, members can see the roles of others.
+func getEffectiveRolesHandler(w http.ResponseWriter, req *http.Request,
+                              params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if requestIdentity(req).User().Userid() != params[1] &&
+        !authorizeRequest(w, req, authz.VIEW_MEMBERS, orgUUID) {
+        return
+    }
+    roles, err := datastore.GetDataStoreObj().GetEffectiveRoles(params[1],
+                                                                orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK,
+              membershipJSON{Userid : params[1],
+                             OrgUUID : syncParam.UUIDtoString(orgUUID),
+                             Roles : uint64(roles)})
+}
@@ -0,0 +1,352 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of a step in the cycle of a pattern, offset and duration
+// are in seconds.
+type patternStepJSON struct {
+    StartOffset int64 `json:"startoffset"`
+    Duration int64 `json:"duration"`
+}
+
+//JSON representation of a shift pattern, the rule is in RRULE form. validfrom
+// and validuntil are set on the patterns split by an edit.
+type shiftPatternJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    TemplateUUID string `json:"templateuuid"`
+    Name string `json:"name"`
+    Rule string `json:"rule"`
+    Dtstart time.Time `json:"dtstart"`
+    Steps []patternStepJSON `json:"steps"`
+    MinStaff uint64 `json:"minstaff"`
+    Exdates []time.Time `json:"exdates"`
+    ValidFrom *time.Time `json:"validfrom,omitempty"`
+    ValidUntil *time.Time `json:"validuntil,omitempty"`
+    Owner string `json:"owner"`
+    CreateTime time.Time `json:"createtime"`
+}
+
+//JSON representation of an expanded occurrence of a pattern.
+type patternOccurrenceJSON struct {
+    ShiftUUID string `json:"shiftuuid"`
+    PatternUUID string `json:"patternuuid"`
+    RecurrenceID time.Time `json:"recurrenceid"`
+    Detached bool `json:"detached"`
+}
+
+//Edit request of the occurrences of a pattern, move and duration are in
+// seconds. recurrenceid is not needed for scope all.
+type patternEditJSON struct {
+    RecurrenceID time.Time `json:"recurrenceid"`
+    Scope string `json:"scope"`
+    Move int64 `json:"move"`
+    Duration int64 `json:"duration"`
+    MinStaff uint64 `json:"minstaff"`
+    Cancel bool `json:"cancel"`
+}
+
+//Result of an edit, the pattern that has the edited occurrences and the
+// number of shifts changed.
+type patternEditResultJSON struct {
+    PatternUUID string `json:"patternuuid"`
+    Changed uint64 `json:"changed"`
+}
+
+//Names of the pattern edit scopes in JSON.
+var patternEditScopeNames = map[datastore.PatternEditScopeBit]string{
+    datastore.PATTERN_EDIT_THIS : "this",
+    datastore.PATTERN_EDIT_FOLLOWING : "following",
+    datastore.PATTERN_EDIT_ALL : "all",
+}
+
+var patternRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/patterns", listShiftPatternsHandler),
+    newRoute(http.MethodPost, "/orgs/*/patterns", createShiftPatternHandler),
+    newRoute(http.MethodGet, "/patterns/*", getShiftPatternHandler),
+    newRoute(http.MethodDelete, "/patterns/*", deleteShiftPatternHandler),
+    newRoute(http.MethodPost, "/patterns/*/expand", expandShiftPatternHandler),
+    newRoute(http.MethodGet, "/patterns/*/occurrences",
+             listPatternOccurrencesHandler),
+    newRoute(http.MethodPost, "/patterns/*/edit", editShiftPatternHandler),
+}
+
+//Nil for a zero time, to leave it out of the response.
+func optionalTime(t time.Time) *time.Time {
+    if t.IsZero() {
+        return nil
+    }
+    return &t
+}
+
+func shiftPatternToJSON(pat *datastore.ShiftPattern) shiftPatternJSON {
+    steps := []patternStepJSON{}
+    for _, step := range(pat.Steps()) {
+        steps = append(steps, patternStepJSON{
+                    StartOffset : int64(step.Offset() / time.Second),
+                    Duration : int64(step.Duration() / time.Second)})
+    }
+    return shiftPatternJSON{UUID : syncParam.UUIDtoString(pat.UUID()),
+                OrgUUID : syncParam.UUIDtoString(pat.OrgUUID()),
+                TemplateUUID : optionalUUIDtoString(pat.TemplateUUID()),
+                Name : pat.Name(),
+                Rule : pat.Rule(),
+                Dtstart : pat.Dtstart(),
+                Steps : steps,
+                MinStaff : pat.MinStaff(),
+                Exdates : pat.Exdates(),
+                ValidFrom : optionalTime(pat.ValidFrom()),
+                ValidUntil : optionalTime(pat.ValidUntil()),
+                Owner : pat.Owner(),
+                CreateTime : pat.CreateTime()}
+}
+
+func patternOccurrenceToJSON(
+                occ *datastore.PatternOccurrence) patternOccurrenceJSON {
+    return patternOccurrenceJSON{
+                ShiftUUID : syncParam.UUIDtoString(occ.ShiftUUID()),
+                PatternUUID : syncParam.UUIDtoString(occ.PatternUUID()),
+                RecurrenceID : occ.RecurrenceID(),
+                Detached : occ.IsDetached()}
+}
+
+//Find the edit scope with JSON name 'name'.
+func parsePatternEditScope(name string) (datastore.PatternEditScopeBit,
+                                         error) {
+    for scope, scopeName := range(patternEditScopeNames) {
+        if scopeName == name {
+            return scope, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+func listShiftPatternsHandler(w http.ResponseWriter, req *http.Request,
+                              params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    pats, err := datastore.GetDataStoreObj().ListShiftPatterns(orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]shiftPatternJSON, 0, len(pats))
+    for i := range(pats) {
+        resp = append(resp, shiftPatternToJSON(&pats[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func createShiftPatternHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body shiftPatternJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var tmplUUID syncParam.UUID
+    if len(body.TemplateUUID) != 0 {
+        tmplUUID, err = parseUUID(body.TemplateUUID)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+    }
+    steps := []datastore.PatternStep{}
+    for _, step := range(body.Steps) {
+        steps = append(steps, datastore.NewPatternStep(
+                        time.Duration(step.StartOffset) * time.Second,
+                        time.Duration(step.Duration) * time.Second))
+    }
+    pat := datastore.NewShiftPattern(orgUUID, tmplUUID, body.Name, body.Rule,
+                                     body.Dtstart, steps, body.MinStaff,
+                                     requestOwner(req, body.Owner))
+    pat.SetExdates(body.Exdates)
+    err = datastore.GetDataStoreObj().CreateShiftPattern(pat)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, shiftPatternToJSON(pat))
+}
+
+//Get the pattern in url param 'uuidStr', the error response is written on
+// failure.
+func getShiftPatternParam(w http.ResponseWriter,
+                          uuidStr string) (*datastore.ShiftPattern, bool) {
+    uuid, err := parseUUID(uuidStr)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    pat := datastore.NewShiftPatternRef(uuid)
+    err = datastore.GetDataStoreObj().GetShiftPattern(pat)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    return pat, true
+}
+
+func getShiftPatternHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    pat, ok := getShiftPatternParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, pat.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, shiftPatternToJSON(pat))
+}
+
+func deleteShiftPatternHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    pat, ok := getShiftPatternParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, pat.OrgUUID()) {
+        return
+    }
+    err := datastore.GetDataStoreObj().DeleteShiftPattern(pat)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Create the shifts of the pattern in the range of query params 'from' and
+// 'to', the occurrences already expanded are skipped.
+func expandShiftPatternHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    pat, ok := getShiftPatternParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, pat.OrgUUID()) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    shifts, err := datastore.GetDataStoreObj().ExpandShiftPattern(pat, from,
+                                    to, requestIdentity(req).User().Userid())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]shiftJSON, 0, len(shifts))
+    for i := range(shifts) {
+        resp = append(resp, shiftToJSON(&shifts[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Expanded occurrences of the pattern in the range of query params 'from' and
+// 'to'.
+func listPatternOccurrencesHandler(w http.ResponseWriter, req *http.Request,
+                                   params []string) {
+    pat, ok := getShiftPatternParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, pat.OrgUUID()) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    occs, err := datastore.GetDataStoreObj().ListPatternOccurrences(pat.UUID(),
+                                                                  from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]patternOccurrenceJSON, 0, len(occs))
+    for i := range(occs) {
+        resp = append(resp, patternOccurrenceToJSON(&occs[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func editShiftPatternHandler(w http.ResponseWriter, req *http.Request,
+                             params []string) {
+    pat, ok := getShiftPatternParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, pat.OrgUUID()) {
+        return
+    }
+    var body patternEditJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    scope, err := parsePatternEditScope(body.Scope)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var edit *datastore.PatternEdit
+    if body.Cancel {
+        edit = datastore.NewPatternCancel(pat.UUID(), body.RecurrenceID, scope)
+    } else {
+        edit = datastore.NewPatternEdit(pat.UUID(), body.RecurrenceID, scope,
+                                time.Duration(body.Move) * time.Second,
+                                time.Duration(body.Duration) * time.Second,
+                                body.MinStaff)
+    }
+    err = datastore.GetDataStoreObj().EditShiftPattern(edit)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, patternEditResultJSON{
+                PatternUUID : syncParam.UUIDtoString(edit.ResultUUID()),
+                Changed : edit.Changed()})
+}
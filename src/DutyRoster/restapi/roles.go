@@ -0,0 +1,231 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "strconv"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of a role. Orguuid is empty for a role that can be
+// granted in any org/unit.
+type roleJSON struct {
+    RoleType uint64 `json:"roletype"`
+    Name string `json:"name"`
+    Permissions []string `json:"permissions"`
+    OrgUUID string `json:"orguuid"`
+    System bool `json:"system"`
+}
+
+//Custom roles of an org/unit are managed by its admins, roles of all the
+// org/units are managed only from the command line.
+var roleRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/roles", listOrgRolesHandler),
+    newRoute(http.MethodPost, "/orgs/*/roles", createRoleHandler),
+    newRoute(http.MethodGet, "/roles/*", getRoleHandler),
+    newRoute(http.MethodPut, "/roles/*", updateRoleHandler),
+    newRoute(http.MethodDelete, "/roles/*", deleteRoleHandler),
+}
+
+func roleToJSON(rl *datastore.Role) roleJSON {
+    resp := roleJSON{RoleType : uint64(rl.RoleType()),
+                     Name : rl.Name(),
+                     Permissions : rl.Permissions(),
+                     System : rl.IsSystem()}
+    if resp.Permissions == nil {
+        resp.Permissions = []string{}
+    }
+    if !syncParam.IsUUIDEmpty(rl.OrgUUID()) {
+        resp.OrgUUID = syncParam.UUIDtoString(rl.OrgUUID())
+    }
+    return resp
+}
+
+//Permissions of a custom role must be the known actions.
+func validatePermissions(permissions []string) error {
+    for _, perm := range(permissions) {
+        if !authz.IsValidAction(perm) {
+            return fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+        }
+    }
+    return nil
+}
+
+//Parse the role bit in path, only a single role bit is allowed.
+func parseRoleType(roleStr string) (datastore.RoleBit, error) {
+    roleType, err := strconv.ParseUint(roleStr, 10, 64)
+    if err != nil || roleType == 0 || roleType & (roleType - 1) != 0 {
+        return 0, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return datastore.RoleBit(roleType), nil
+}
+
+//Get the role in path and authorize the action on the org/unit of role. The
+// roles without an org/unit can only be viewed over the API.
+func getAuthorizedRole(w http.ResponseWriter, req *http.Request,
+                       roleStr string, action authz.Action) *datastore.Role {
+    roleType, err := parseRoleType(roleStr)
+    if err != nil {
+        writeError(w, err)
+        return nil
+    }
+    rl := datastore.NewRoleRef(roleType)
+    err = datastore.GetDataStoreObj().GetRole(rl)
+    if err != nil {
+        writeError(w, err)
+        return nil
+    }
+    if syncParam.IsUUIDEmpty(rl.OrgUUID()) {
+        if action != authz.VIEW_MEMBERS {
+            writeError(w, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+            return nil
+        }
+        return rl
+    }
+    if !authorizeRequest(w, req, action, rl.OrgUUID()) {
+        return nil
+    }
+    return rl
+}
+
+//List the roles that can be granted in the org/unit, ie: the roles of all
+// org/units and the roles of org/unit and its ancestors.
+func listOrgRolesHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_MEMBERS, orgUUID) {
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    or := datastore.NewOrgRef(orgUUID)
+    err = dbObj.GetOrg(or)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    scopes := map[syncParam.UUID]bool{syncParam.UUID{} : true}
+    for entry := or; entry != nil; entry = entry.Parent() {
+        scopes[entry.UUID()] = true
+    }
+    roleList, err := dbObj.ListRoles()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]roleJSON, 0, len(roleList))
+    for i := range(roleList) {
+        if scopes[roleList[i].OrgUUID()] {
+            resp = append(resp, roleToJSON(&roleList[i]))
+        }
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Create a custom role that can be granted in the org/unit and its
+// descendants.
+func createRoleHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_ROLES, orgUUID) {
+        return
+    }
+    var body roleJSON
+    err = readJSON(req, &body)
+    if err == nil {
+        err = validatePermissions(body.Permissions)
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    rl := datastore.NewRole(body.Name, body.Permissions, orgUUID)
+    err = datastore.GetDataStoreObj().CreateRole(rl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, roleToJSON(rl))
+}
+
+func getRoleHandler(w http.ResponseWriter, req *http.Request,
+                    params []string) {
+    rl := getAuthorizedRole(w, req, params[0], authz.VIEW_MEMBERS)
+    if rl == nil {
+        return
+    }
+    writeJSON(w, http.StatusOK, roleToJSON(rl))
+}
+
+//Only name and permissions of a custom role can be updated, empty fields in
+// the request are left as is.
+func updateRoleHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    rl := getAuthorizedRole(w, req, params[0], authz.MANAGE_ROLES)
+    if rl == nil {
+        return
+    }
+    var body roleJSON
+    err := readJSON(req, &body)
+    if err == nil {
+        err = validatePermissions(body.Permissions)
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if len(body.Name) != 0 {
+        rl.SetName(body.Name)
+    }
+    if body.Permissions != nil {
+        rl.SetPermissions(body.Permissions)
+    }
+    err = datastore.GetDataStoreObj().UpdateRole(rl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, roleToJSON(rl))
+}
+
+//Delete a custom role, the role is revoked from all the users.
+func deleteRoleHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    rl := getAuthorizedRole(w, req, params[0], authz.MANAGE_ROLES)
+    if rl == nil {
+        return
+    }
+    err := datastore.GetDataStoreObj().DeleteRole(rl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
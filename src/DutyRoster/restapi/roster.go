@@ -0,0 +1,127 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package restapi
+
+import (
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/scheduler"
+)
+
+//Roster generation request, minrest is in seconds. The generated roster is
+// written to the datastore only when publish is set.
+type rosterRequestJSON struct {
+    From time.Time `json:"from"`
+    To time.Time `json:"to"`
+    Seed int64 `json:"seed"`
+    MaxConsecutiveShifts uint64 `json:"maxconsecutiveshifts"`
+    MinRest int64 `json:"minrest"`
+    PreferenceWeight int64 `json:"preferenceweight"`
+    FairnessWeight int64 `json:"fairnessweight"`
+    Publish bool `json:"publish"`
+}
+
+//JSON representation of a shift in the generated roster and its users.
+type rosterSlotJSON struct {
+    Shift shiftJSON `json:"shift"`
+    Users []string `json:"users"`
+}
+
+//JSON representation of a generated roster, fairnessspread is in seconds.
+type rosterJSON struct {
+    OrgUUID string `json:"orguuid"`
+    Seed int64 `json:"seed"`
+    Published bool `json:"published"`
+    Slots []rosterSlotJSON `json:"slots"`
+    PreferenceScore int64 `json:"preferencescore"`
+    FairnessSpread int64 `json:"fairnessspread"`
+}
+
+var rosterRoutes = []route{
+    newRoute(http.MethodPost, "/orgs/*/roster", generateRosterHandler),
+}
+
+func rosterToJSON(roster *scheduler.Roster, published bool) rosterJSON {
+    slots := make([]rosterSlotJSON, 0, len(roster.Slots))
+    for _, slot := range(roster.Slots) {
+        slots = append(slots, rosterSlotJSON{Shift : shiftToJSON(slot.Shift),
+                                             Users : slot.Users})
+    }
+    return rosterJSON{OrgUUID : optionalUUIDtoString(roster.OrgUUID),
+                      Seed : roster.Seed,
+                      Published : published,
+                      Slots : slots,
+                      PreferenceScore : roster.PreferenceScore,
+                      FairnessSpread : int64(roster.FairnessSpread /
+                                             time.Second)}
+}
+
+//Generate a roster for the members of org/unit from its shift templates,
+// the roster is published when requested.
+func generateRosterHandler(w http.ResponseWriter, req *http.Request,
+                           params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.PUBLISH_ROSTER, orgUUID) {
+        return
+    }
+    var body rosterRequestJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    //Reject the large ranges before loading the data of the range.
+    err = scheduler.CheckRange(body.From, body.To)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    schReq := &scheduler.Request{OrgUUID : orgUUID,
+                From : body.From,
+                To : body.To,
+                Seed : body.Seed,
+                Owner : requestIdentity(req).User().Userid(),
+                Constraints : scheduler.Constraints{
+                    MaxConsecutiveShifts : body.MaxConsecutiveShifts,
+                    MinRest : time.Duration(body.MinRest) * time.Second,
+                    PreferenceWeight : body.PreferenceWeight,
+                    FairnessWeight : body.FairnessWeight}}
+    err = scheduler.LoadRequest(schReq)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    roster, err := scheduler.Generate(schReq)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !body.Publish {
+        writeJSON(w, http.StatusOK, rosterToJSON(roster, false))
+        return
+    }
+    err = roster.Publish()
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, rosterToJSON(roster, true))
+}
@@ -0,0 +1,330 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+//******************************************************************************
+// HTTP server that exposes the datastore records as JSON endpoints. The
+// server runs as a service goroutine, on exit signal it stops accepting new
+// requests and waits for the in-flight requests to complete.
+//******************************************************************************
+import (
+    "fmt"
+    "net"
+    "time"
+    "context"
+    "strings"
+    "net/http"
+    "encoding/json"
+    "DutyRoster/config"
+    "DutyRoster/logging"
+    "DutyRoster/session"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Prefix of all the API endpoints.
+const API_PATH_PREFIX = "/api/v1"
+
+//Handler of an API endpoint, 'params' are the path segments matched by the
+// wildcards in the route pattern, in the order of appearance.
+type routeHandler func(w http.ResponseWriter, req *http.Request,
+                       params []string)
+
+type route struct {
+    method string
+    //Path segments of the route, '*' matches any single segment.
+    pattern []string
+    handler routeHandler
+    //Public routes are served without an access token.
+    public bool
+}
+
+type apiServer struct {
+    server *http.Server
+    routes []route
+    log logging.LoggingInterface
+}
+
+//Create a route for 'method' on 'path', path is relative to API_PATH_PREFIX.
+func newRoute(method string, path string, handler routeHandler) route {
+    return route{method : method,
+                 pattern : strings.Split(strings.Trim(API_PATH_PREFIX + path,
+                                                       "/"), "/"),
+                 handler : handler}
+}
+
+//Create a route that is served without an access token, the identity is
+// still resolved when a token is present in the request.
+func newPublicRoute(method string, path string, handler routeHandler) route {
+    rt := newRoute(method, path, handler)
+    rt.public = true
+    return rt
+}
+
+//Match the path segments against the route pattern, returns the segments
+// matched by the wildcards.
+func (rt *route)match(segments []string) ([]string, bool) {
+    if len(segments) != len(rt.pattern) {
+        return nil, false
+    }
+    params := []string{}
+    for i, seg := range(rt.pattern) {
+        if seg == "*" {
+            params = append(params, segments[i])
+        } else if seg != segments[i] {
+            return nil, false
+        }
+    }
+    return params, true
+}
+
+func (api *apiServer)ServeHTTP(w http.ResponseWriter, req *http.Request) {
+    //Request id is returned in response and added to the logs of request,
+    // to match the two.
+    reqID, _ := syncParam.NewUUIDString()
+    w.Header().Set("X-Request-Id", reqID)
+    log := api.log.With(logging.NewField("requestid", reqID))
+    log.Trace("%s %s from %s", req.Method, req.URL.Path, req.RemoteAddr)
+    segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+    pathFound := false
+    for i := range(api.routes) {
+        params, ok := api.routes[i].match(segments)
+        if !ok {
+            continue
+        }
+        pathFound = true
+        if api.routes[i].method == req.Method {
+            authReq, err := authenticateRequest(req, api.routes[i].public)
+            if err != nil {
+                log.Trace("Rejected %s %s, err : %s", req.Method,
+                          req.URL.Path, err)
+                w.Header().Set("WWW-Authenticate", "Bearer")
+                writeError(w, err)
+                return
+            }
+            api.routes[i].handler(w, authReq, params)
+            return
+        }
+    }
+    if pathFound {
+        writeJSON(w, http.StatusMethodNotAllowed,
+                  errorJSON{Error : http.StatusText(
+                                        http.StatusMethodNotAllowed)})
+        return
+    }
+    writeJSON(w, http.StatusNotFound,
+              errorJSON{Error : http.StatusText(http.StatusNotFound)})
+}
+
+//Error response of the API.
+type errorJSON struct {
+    Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    if body != nil {
+        json.NewEncoder(w).Encode(body)
+    }
+}
+
+//HTTP status for the application errors, errors not in the map are reported
+// as internal errors.
+var errorHTTPStatus = map[string]int{
+    errorset.ERROR_TYPES[errorset.INVALID_PARAM] : http.StatusBadRequest,
+    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_FOUND] : http.StatusNotFound,
+    errorset.ERROR_TYPES[errorset.DB_PARENT_RECORD_NOT_FOUND] :
+                                                http.StatusBadRequest,
+    errorset.ERROR_TYPES[errorset.DB_RECORD_NOT_UNIQUE] : http.StatusConflict,
+    errorset.ERROR_TYPES[errorset.DB_RECORD_RELATION_ERROR] :
+                                                http.StatusConflict,
+    errorset.ERROR_TYPES[errorset.SCHEDULE_INFEASIBLE] :
+                                                http.StatusUnprocessableEntity,
+    errorset.ERROR_TYPES[errorset.SCHEDULE_SEARCH_LIMIT] :
+                                                http.StatusUnprocessableEntity,
+    errorset.ERROR_TYPES[errorset.INVALID_CREDENTIALS] :
+                                                http.StatusUnauthorized,
+    errorset.ERROR_TYPES[errorset.INVALID_TOKEN] : http.StatusUnauthorized,
+    errorset.ERROR_TYPES[errorset.USER_ACCOUNT_INACTIVE] :
+                                                http.StatusForbidden,
+    errorset.ERROR_TYPES[errorset.USER_ACCOUNT_NOT_APPROVED] :
+                                                http.StatusForbidden,
+    errorset.ERROR_TYPES[errorset.ORG_NOT_ACTIVE] : http.StatusForbidden,
+    errorset.ERROR_TYPES[errorset.ACCESS_DENIED] : http.StatusForbidden,
+    errorset.ERROR_TYPES[errorset.ROLE_LIMIT_REACHED] : http.StatusConflict,
+    errorset.ERROR_TYPES[errorset.LEAVE_INVALID_TRANSITION] :
+                                                http.StatusConflict,
+    errorset.ERROR_TYPES[errorset.LEAVE_BALANCE_INSUFFICIENT] :
+                                                http.StatusUnprocessableEntity,
+    errorset.ERROR_TYPES[errorset.LEAVE_CONFLICT] : http.StatusConflict,
+    errorset.ERROR_TYPES[errorset.SWAP_INVALID_TRANSITION] :
+                                                http.StatusConflict,
+    errorset.ERROR_TYPES[errorset.SWAP_NOT_ELIGIBLE] : http.StatusForbidden,
+    errorset.ERROR_TYPES[errorset.SWAP_RULE_VIOLATION] :
+                                                http.StatusUnprocessableEntity,
+    errorset.ERROR_TYPES[errorset.RECURRENCE_RULE_INVALID] :
+                                                http.StatusBadRequest,
+    errorset.ERROR_TYPES[errorset.PATTERN_RANGE_TOO_LARGE] :
+                                                http.StatusUnprocessableEntity,
+    errorset.ERROR_TYPES[errorset.ROSTER_RANGE_TOO_LARGE] :
+                                                http.StatusUnprocessableEntity,
+    errorset.ERROR_TYPES[errorset.TIME_ZONE_INVALID] : http.StatusBadRequest,
+    errorset.ERROR_TYPES[errorset.CALENDAR_FILE_INVALID] :
+                                                http.StatusBadRequest,
+    errorset.ERROR_TYPES[errorset.SKILL_REQUIREMENT_NOT_MET] :
+                                                http.StatusUnprocessableEntity,
+}
+
+func writeError(w http.ResponseWriter, err error) {
+    status, ok := errorHTTPStatus[err.Error()]
+    if !ok {
+        status = http.StatusInternalServerError
+    }
+    writeJSON(w, status, errorJSON{Error : err.Error()})
+}
+
+//Decode the JSON request body into 'body'.
+func readJSON(req *http.Request, body interface{}) error {
+    decoder := json.NewDecoder(req.Body)
+    decoder.DisallowUnknownFields()
+    if decoder.Decode(body) != nil {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return nil
+}
+
+//Parse the uuid string in canonical form.
+func parseUUID(uuidStr string) (syncParam.UUID, error) {
+    uuid := syncParam.StringtoUUID(uuidStr)
+    if syncParam.IsUUIDEmpty(uuid) ||
+        syncParam.UUIDtoString(uuid) != strings.ToLower(uuidStr) {
+        return uuid, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return uuid, nil
+}
+
+//Parse the optional RFC3339 time in query param 'name', 'defTime' is returned
+// when the param is not present.
+func parseQueryTime(req *http.Request, name string,
+                    defTime time.Time) (time.Time, error) {
+    value := req.URL.Query().Get(name)
+    if len(value) == 0 {
+        return defTime, nil
+    }
+    tm, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        return tm, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return tm, nil
+}
+
+//Range of the list queries, defaults to a week from now.
+func parseQueryRange(req *http.Request) (time.Time, time.Time, error) {
+    from, err := parseQueryTime(req, "from", time.Now())
+    if err != nil {
+        return from, from, err
+    }
+    to, err := parseQueryTime(req, "to", from.AddDate(0, 0, 7))
+    if err != nil {
+        return from, to, err
+    }
+    if !to.After(from) {
+        return from, to, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    return from, to, nil
+}
+
+func (api *apiServer)addRoutes(routes []route) {
+    api.routes = append(api.routes, routes...)
+}
+
+//Start the HTTP server on the 'http' configuration. Nothing is started when
+// no listen address is configured.
+//The server is stopped on the service exit signal, in-flight requests are
+// given 'shutdowntimeout' seconds to complete.
+func StartServer() error {
+    log := logging.GetAppLoggerObj()
+    httpConfig := config.GetConfigInstance().HTTP
+    if len(httpConfig.ListenAddr) == 0 {
+        log.Info("HTTP listen address is not configured, API is disabled")
+        return nil
+    }
+    api := new(apiServer)
+    api.log = log
+    api.addRoutes(authRoutes)
+    api.addRoutes(userRoutes)
+    api.addRoutes(orgRoutes)
+    api.addRoutes(roleRoutes)
+    api.addRoutes(shiftRoutes)
+    api.addRoutes(patternRoutes)
+    api.addRoutes(rosterRoutes)
+    api.addRoutes(availabilityRoutes)
+    api.addRoutes(leaveRoutes)
+    api.addRoutes(swapRoutes)
+    api.addRoutes(onCallRoutes)
+    api.addRoutes(holidayRoutes)
+    api.addRoutes(skillRoutes)
+    api.addRoutes(feedRoutes)
+    api.addRoutes(adminRoutes)
+    api.server = &http.Server{
+        Handler : api,
+        ReadTimeout : time.Duration(httpConfig.ReadTimeout) * time.Second,
+        WriteTimeout : time.Duration(httpConfig.WriteTimeout) * time.Second,
+        IdleTimeout : time.Duration(httpConfig.IdleTimeout) * time.Second,
+    }
+    //Listen before starting the goroutine to report the bind failures.
+    listener, err := net.Listen("tcp", httpConfig.ListenAddr)
+    if err != nil {
+        log.Error("Failed to listen on %s, err : %s", httpConfig.ListenAddr,
+                  err)
+        return err
+    }
+    session.StartCleanupRoutine()
+    syncObj := syncParam.GetAppSyncObj()
+    syncObj.AddServiceRoutineInWaitGroup()
+    go func() {
+        defer syncObj.ExitServiceRoutineInWaitGroup()
+        serveErr := make(chan error, 1)
+        go func() {
+            serveErr <- api.server.Serve(listener)
+        }()
+        log.Info("HTTP server is listening on %s", httpConfig.ListenAddr)
+        select {
+            case <- syncObj.GetServiceExitChannel():
+                //No timeout waits for all the requests to complete.
+                ctx := context.Background()
+                if httpConfig.ShutdownTimeout > 0 {
+                    var cancel context.CancelFunc
+                    ctx, cancel = context.WithTimeout(ctx,
+                        time.Duration(httpConfig.ShutdownTimeout) * time.Second)
+                    defer cancel()
+                }
+                err := api.server.Shutdown(ctx)
+                if err != nil {
+                    log.Error("HTTP server is stopped before draining, %s",
+                              err)
+                }
+                <- serveErr
+                log.Info("HTTP server is stopped")
+            case err := <- serveErr:
+                log.Error("HTTP server is failed, err : %s", err)
+        }
+    }()
+    return nil
+}
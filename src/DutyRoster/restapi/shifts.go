@@ -0,0 +1,430 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of a shift template, offset and duration are in seconds.
+type shiftTemplateJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    Name string `json:"name"`
+    StartOffset int64 `json:"startoffset"`
+    Duration int64 `json:"duration"`
+    Weekdays uint64 `json:"weekdays"`
+    MinStaff uint64 `json:"minstaff"`
+    Owner string `json:"owner"`
+    //Skills a user must hold for the whole shift to work it.
+    Skills []string `json:"skills"`
+}
+
+//JSON representation of a shift, template is empty for an adhoc shift.
+type shiftJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    TemplateUUID string `json:"templateuuid"`
+    StartTime time.Time `json:"starttime"`
+    EndTime time.Time `json:"endtime"`
+    MinStaff uint64 `json:"minstaff"`
+    Status uint64 `json:"status"`
+    Owner string `json:"owner"`
+    CreateTime time.Time `json:"createtime"`
+    //Revision of the shift, bumped on every change to the shift or roster.
+    Sequence uint64 `json:"sequence"`
+    ModifyTime time.Time `json:"modifytime"`
+}
+
+//JSON representation of a roster assignment.
+type assignmentJSON struct {
+    UUID string `json:"uuid"`
+    ShiftUUID string `json:"shiftuuid"`
+    OrgUUID string `json:"orguuid"`
+    Userid string `json:"userid"`
+    AssignTime time.Time `json:"assigntime"`
+}
+
+var shiftRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/templates", listShiftTemplatesHandler),
+    newRoute(http.MethodPost, "/orgs/*/templates", createShiftTemplateHandler),
+    newRoute(http.MethodGet, "/templates/*", getShiftTemplateHandler),
+    newRoute(http.MethodDelete, "/templates/*", deleteShiftTemplateHandler),
+    newRoute(http.MethodGet, "/orgs/*/shifts", listShiftsHandler),
+    newRoute(http.MethodPost, "/orgs/*/shifts", createShiftHandler),
+    newRoute(http.MethodGet, "/shifts/*", getShiftHandler),
+    newRoute(http.MethodPost, "/shifts/*/cancel", cancelShiftHandler),
+    newRoute(http.MethodGet, "/shifts/*/roster", listShiftRosterHandler),
+    newRoute(http.MethodPost, "/shifts/*/roster", createAssignmentHandler),
+    newRoute(http.MethodDelete, "/roster/*", deleteAssignmentHandler),
+}
+
+//Uuid string of an optional uuid, empty string for an empty uuid.
+func optionalUUIDtoString(uuid syncParam.UUID) string {
+    if syncParam.IsUUIDEmpty(uuid) {
+        return ""
+    }
+    return syncParam.UUIDtoString(uuid)
+}
+
+//Owner of the record created in the request, defaults to the user of request.
+func requestOwner(req *http.Request, owner string) string {
+    if len(owner) == 0 {
+        return requestIdentity(req).User().Userid()
+    }
+    return owner
+}
+
+func shiftTemplateToJSON(tmpl *datastore.ShiftTemplate) shiftTemplateJSON {
+    return shiftTemplateJSON{
+                UUID : syncParam.UUIDtoString(tmpl.UUID()),
+                OrgUUID : syncParam.UUIDtoString(tmpl.OrgUUID()),
+                Name : tmpl.Name(),
+                StartOffset : int64(tmpl.StartOffset() / time.Second),
+                Duration : int64(tmpl.Duration() / time.Second),
+                Weekdays : tmpl.Weekdays(),
+                MinStaff : tmpl.MinStaff(),
+                Owner : tmpl.Owner(),
+                Skills : tmpl.Skills()}
+}
+
+func shiftToJSON(sh *datastore.Shift) shiftJSON {
+    return shiftJSON{UUID : syncParam.UUIDtoString(sh.UUID()),
+                     OrgUUID : syncParam.UUIDtoString(sh.OrgUUID()),
+                     TemplateUUID : optionalUUIDtoString(sh.TemplateUUID()),
+                     StartTime : sh.StartTime(),
+                     EndTime : sh.EndTime(),
+                     MinStaff : sh.MinStaff(),
+                     Status : uint64(sh.Status()),
+                     Owner : sh.Owner(),
+                     CreateTime : sh.CreateTime(),
+                     Sequence : sh.Sequence(),
+                     ModifyTime : sh.ModifyTime()}
+}
+
+func assignmentToJSON(asgn *datastore.RosterAssignment) assignmentJSON {
+    return assignmentJSON{UUID : syncParam.UUIDtoString(asgn.UUID()),
+                          ShiftUUID : syncParam.UUIDtoString(asgn.ShiftUUID()),
+                          OrgUUID : syncParam.UUIDtoString(asgn.OrgUUID()),
+                          Userid : asgn.Userid(),
+                          AssignTime : asgn.AssignTime()}
+}
+
+func listShiftTemplatesHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    tmpls, err := datastore.GetDataStoreObj().ListShiftTemplates(orgUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]shiftTemplateJSON, 0, len(tmpls))
+    for i := range(tmpls) {
+        resp = append(resp, shiftTemplateToJSON(&tmpls[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func createShiftTemplateHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body shiftTemplateJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    tmpl := datastore.NewShiftTemplate(orgUUID, body.Name,
+                            time.Duration(body.StartOffset) * time.Second,
+                            time.Duration(body.Duration) * time.Second,
+                            body.Weekdays, body.MinStaff,
+                            requestOwner(req, body.Owner))
+    tmpl.SetSkills(body.Skills)
+    err = datastore.GetDataStoreObj().CreateShiftTemplate(tmpl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, shiftTemplateToJSON(tmpl))
+}
+
+func getShiftTemplateHandler(w http.ResponseWriter, req *http.Request,
+                             params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    tmpl := datastore.NewShiftTemplateRef(uuid)
+    err = datastore.GetDataStoreObj().GetShiftTemplate(tmpl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, tmpl.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, shiftTemplateToJSON(tmpl))
+}
+
+func deleteShiftTemplateHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    tmpl := datastore.NewShiftTemplateRef(uuid)
+    err = dbObj.GetShiftTemplate(tmpl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, tmpl.OrgUUID()) {
+        return
+    }
+    err = dbObj.DeleteShiftTemplate(tmpl)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Shifts of org/unit in the range of query params 'from' and 'to'.
+func listShiftsHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    shifts, err := datastore.GetDataStoreObj().ListShifts(orgUUID, from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]shiftJSON, 0, len(shifts))
+    for i := range(shifts) {
+        resp = append(resp, shiftToJSON(&shifts[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+func createShiftHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body shiftJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var tmplUUID syncParam.UUID
+    if len(body.TemplateUUID) != 0 {
+        tmplUUID, err = parseUUID(body.TemplateUUID)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+    }
+    sh := datastore.NewShift(orgUUID, tmplUUID, body.StartTime, body.EndTime,
+                             body.MinStaff, requestOwner(req, body.Owner))
+    err = datastore.GetDataStoreObj().CreateShift(sh)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, shiftToJSON(sh))
+}
+
+func getShiftHandler(w http.ResponseWriter, req *http.Request,
+                     params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    sh := datastore.NewShiftRef(uuid)
+    err = datastore.GetDataStoreObj().GetShift(sh)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, sh.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, shiftToJSON(sh))
+}
+
+func cancelShiftHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    sh := datastore.NewShiftRef(uuid)
+    err = dbObj.GetShift(sh)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, sh.OrgUUID()) {
+        return
+    }
+    err = dbObj.CancelShift(sh)
+    if err == nil {
+        err = dbObj.GetShift(sh)
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, shiftToJSON(sh))
+}
+
+func listShiftRosterHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    sh := datastore.NewShiftRef(uuid)
+    err = dbObj.GetShift(sh)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, sh.OrgUUID()) {
+        return
+    }
+    asgns, err := dbObj.ListShiftRoster(uuid)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]assignmentJSON, 0, len(asgns))
+    for i := range(asgns) {
+        resp = append(resp, assignmentToJSON(&asgns[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Assign the user in request to the shift, org/unit of the assignment is
+// taken from the shift. The user must hold the skills of the shift template.
+func createAssignmentHandler(w http.ResponseWriter, req *http.Request,
+                             params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var body assignmentJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    sh := datastore.NewShiftRef(uuid)
+    err = dbObj.GetShift(sh)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.PUBLISH_ROSTER, sh.OrgUUID()) {
+        return
+    }
+    err = dbObj.CheckLeaveConflict(body.Userid, sh.StartTime(), sh.EndTime())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = dbObj.CheckSkillRequirement(body.Userid, sh)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    asgn := datastore.NewRosterAssignment(uuid, sh.OrgUUID(), body.Userid)
+    err = dbObj.CreateRosterAssignment(asgn)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, assignmentToJSON(asgn))
+}
+
+func deleteAssignmentHandler(w http.ResponseWriter, req *http.Request,
+                             params []string) {
+    uuid, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    asgn := datastore.NewRosterAssignmentRef(uuid)
+    err = dbObj.GetRosterAssignment(asgn)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.PUBLISH_ROSTER, asgn.OrgUUID()) {
+        return
+    }
+    err = dbObj.DeleteRosterAssignment(asgn)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
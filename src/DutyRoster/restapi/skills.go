@@ -0,0 +1,265 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "strconv"
+    "strings"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Days of the expiring skills report when not given in the query, and the
+// longest report allowed.
+const (
+    DEFAULT_EXPIRY_REPORT_DAYS = 30
+    MAX_EXPIRY_REPORT_DAYS = 366
+)
+
+//JSON representation of a skill of a user. Validfrom and expirytime are left
+// out when the skill is not bounded on that end.
+type userSkillJSON struct {
+    Userid string `json:"userid"`
+    Name string `json:"name"`
+    Kind string `json:"kind"`
+    ValidFrom *time.Time `json:"validfrom,omitempty"`
+    ExpiryTime *time.Time `json:"expirytime,omitempty"`
+    ModifyTime time.Time `json:"modifytime"`
+}
+
+//Users of an org/unit who hold the skills for the whole time range.
+type qualifiedUsersJSON struct {
+    OrgUUID string `json:"orguuid"`
+    Skills []string `json:"skills"`
+    From time.Time `json:"from"`
+    To time.Time `json:"to"`
+    Users []string `json:"users"`
+}
+
+//Names of the skill kinds in JSON.
+var skillKindNames = map[datastore.SkillKindBit]string{
+    datastore.SKILL_GENERAL : "skill",
+    datastore.SKILL_CERTIFICATION : "certification",
+}
+
+var skillRoutes = []route{
+    newRoute(http.MethodGet, "/users/*/skills", listUserSkillsHandler),
+    newRoute(http.MethodPut, "/users/*/skills", setUserSkillHandler),
+    newRoute(http.MethodDelete, "/users/*/skills/*", deleteUserSkillHandler),
+    newRoute(http.MethodGet, "/orgs/*/qualified", listQualifiedUsersHandler),
+    newRoute(http.MethodGet, "/orgs/*/expiringskills",
+             listExpiringSkillsHandler),
+}
+
+func userSkillToJSON(skill *datastore.UserSkill) userSkillJSON {
+    return userSkillJSON{Userid : skill.Userid(),
+                         Name : skill.Name(),
+                         Kind : skillKindNames[skill.Kind()],
+                         ValidFrom : optionalTime(skill.ValidFrom()),
+                         ExpiryTime : optionalTime(skill.ExpiryTime()),
+                         ModifyTime : skill.ModifyTime()}
+}
+
+func userSkillsToJSON(skills []datastore.UserSkill) []userSkillJSON {
+    resp := make([]userSkillJSON, 0, len(skills))
+    for i := range(skills) {
+        resp = append(resp, userSkillToJSON(&skills[i]))
+    }
+    return resp
+}
+
+//Find the skill kind with JSON name 'name', a skill when not given.
+func parseSkillKind(name string) (datastore.SkillKindBit, error) {
+    if len(name) == 0 {
+        return datastore.SKILL_GENERAL, nil
+    }
+    for kind, kindName := range(skillKindNames) {
+        if kindName == name {
+            return kind, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Authorize the user of request to set the skills of 'userid'. Unlike the
+// other actions on an account, users cannot set their own skills.
+func authorizeSkillRequest(w http.ResponseWriter, req *http.Request,
+                           userid string) bool {
+    if authz.CanOnUser(requestIdentity(req).User(), authz.MANAGE_SKILLS,
+                       userid) {
+        return true
+    }
+    writeError(w, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+    return false
+}
+
+func listUserSkillsHandler(w http.ResponseWriter, req *http.Request,
+                           params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    skills, err := datastore.GetDataStoreObj().ListUserSkills(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, userSkillsToJSON(skills))
+}
+
+//Create or replace the skill of the user with the name in request, eg: on
+// the renewal of a certification.
+func setUserSkillHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    if !authorizeSkillRequest(w, req, params[0]) {
+        return
+    }
+    var body userSkillJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    kind, err := parseSkillKind(body.Kind)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var validFrom, expiryTime time.Time
+    if body.ValidFrom != nil {
+        validFrom = *body.ValidFrom
+    }
+    if body.ExpiryTime != nil {
+        expiryTime = *body.ExpiryTime
+    }
+    skill := datastore.NewUserSkill(params[0], body.Name, kind, validFrom,
+                                    expiryTime)
+    err = datastore.GetDataStoreObj().SetUserSkill(skill)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, userSkillToJSON(skill))
+}
+
+func deleteUserSkillHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    if !authorizeSkillRequest(w, req, params[0]) {
+        return
+    }
+    err := datastore.GetDataStoreObj().DeleteUserSkill(
+                            datastore.NewUserSkillRef(params[0], params[1]))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+//Users of the org/unit who hold all the skills in query param 'skills', a
+// comma separated list. The skills must be valid for the whole local day in
+// query param 'date', defaults to today, or for the range in query params
+// 'from' and 'to' when given.
+func listQualifiedUsersHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    query := req.URL.Query()
+    skills := datastore.NormalizeSkillNames(strings.Split(query.Get("skills"),
+                                                          ","))
+    if len(skills) == 0 {
+        writeError(w, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.INVALID_PARAM]))
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    var from, to time.Time
+    if len(query.Get("from")) != 0 {
+        from, to, err = parseQueryRange(req)
+    } else {
+        or := datastore.NewOrgRef(orgUUID)
+        err = dbObj.GetOrg(or)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        var date time.Time
+        date, err = parseQueryDate(req, "date", time.Time{})
+        if err == nil {
+            at := time.Now()
+            if !date.IsZero() {
+                at = timezone.Date(date.Year(), date.Month(), date.Day(), 0,
+                                   or.Location())
+            }
+            from, to = timezone.DayBounds(at, or.Location())
+        }
+    }
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    users, err := dbObj.ListQualifiedUsers(orgUUID, skills, from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK,
+              qualifiedUsersJSON{OrgUUID : syncParam.UUIDtoString(orgUUID),
+                                 Skills : skills, From : from, To : to,
+                                 Users : users})
+}
+
+//Skills of the users of the org/unit and its units that expire within the
+// days in query param 'days' from now, soonest first.
+func listExpiringSkillsHandler(w http.ResponseWriter, req *http.Request,
+                               params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    days := int64(DEFAULT_EXPIRY_REPORT_DAYS)
+    if value := req.URL.Query().Get("days"); len(value) != 0 {
+        days, err = strconv.ParseInt(value, 10, 64)
+        if err != nil || days <= 0 || days > MAX_EXPIRY_REPORT_DAYS {
+            writeError(w, fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.INVALID_PARAM]))
+            return
+        }
+    }
+    now := time.Now()
+    skills, err := datastore.GetDataStoreObj().ListExpiringSkills(orgUUID,
+                                        now, now.AddDate(0, 0, int(days)))
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, userSkillsToJSON(skills))
+}
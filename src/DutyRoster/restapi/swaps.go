@@ -0,0 +1,443 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of swap rules, minrest is in seconds. Approverrole is 0
+// when trades need no approval.
+type swapSettingsJSON struct {
+    OrgUUID string `json:"orguuid"`
+    MinRest int64 `json:"minrest"`
+    ApproverRole uint64 `json:"approverrole"`
+}
+
+//JSON representation of a swap offer.
+type swapOfferJSON struct {
+    UUID string `json:"uuid"`
+    OrgUUID string `json:"orguuid"`
+    AssignmentUUID string `json:"assignmentuuid"`
+    OfferedBy string `json:"offeredby"`
+    Kind string `json:"kind"`
+    TargetAssignmentUUID string `json:"targetassignmentuuid,omitempty"`
+    TakenBy string `json:"takenby"`
+    Status string `json:"status"`
+    ApproverRole uint64 `json:"approverrole"`
+    CreateTime time.Time `json:"createtime"`
+    DecidedBy string `json:"decidedby"`
+    DecideTime *time.Time `json:"decidetime,omitempty"`
+}
+
+//Optional request body of the swap actions, note is kept in the audit.
+type swapActionJSON struct {
+    Note string `json:"note"`
+}
+
+//JSON representation of a swap audit record.
+type swapAuditJSON struct {
+    UUID string `json:"uuid"`
+    OfferUUID string `json:"offeruuid"`
+    OrgUUID string `json:"orguuid"`
+    Status string `json:"status"`
+    Actor string `json:"actor"`
+    AuditTime time.Time `json:"audittime"`
+    Note string `json:"note"`
+}
+
+//Names of the swap kinds in JSON.
+var swapKindNames = map[datastore.SwapKindBit]string{
+    datastore.SWAP_DIRECT : "direct",
+    datastore.SWAP_GIVEAWAY : "giveaway",
+    datastore.SWAP_PICKUP : "pickup",
+}
+
+//Names of the swap status in JSON.
+var swapStatusNames = map[datastore.SwapStatusBit]string{
+    datastore.SWAP_OPEN : "open",
+    datastore.SWAP_ACCEPTED : "accepted",
+    datastore.SWAP_COMPLETED : "completed",
+    datastore.SWAP_REJECTED : "rejected",
+    datastore.SWAP_CANCELLED : "cancelled",
+}
+
+var swapRoutes = []route{
+    newRoute(http.MethodGet, "/orgs/*/swapsettings", getSwapSettingsHandler),
+    newRoute(http.MethodPut, "/orgs/*/swapsettings", setSwapSettingsHandler),
+    newRoute(http.MethodGet, "/orgs/*/swaps", listOrgSwapsHandler),
+    newRoute(http.MethodGet, "/orgs/*/swapaudit", listOrgSwapAuditHandler),
+    newRoute(http.MethodPost, "/swaps", createSwapHandler),
+    newRoute(http.MethodGet, "/swaps/*", getSwapHandler),
+    newRoute(http.MethodGet, "/swaps/*/audit", listSwapAuditHandler),
+    newRoute(http.MethodPost, "/swaps/*/accept", acceptSwapHandler),
+    newRoute(http.MethodPost, "/swaps/*/approve", approveSwapHandler),
+    newRoute(http.MethodPost, "/swaps/*/reject", rejectSwapHandler),
+    newRoute(http.MethodPost, "/swaps/*/cancel", cancelSwapHandler),
+}
+
+func swapSettingsToJSON(settings *datastore.SwapSettings) swapSettingsJSON {
+    return swapSettingsJSON{
+                OrgUUID : syncParam.UUIDtoString(settings.OrgUUID()),
+                MinRest : int64(settings.MinRest() / time.Second),
+                ApproverRole : uint64(settings.ApproverRole())}
+}
+
+func swapOfferToJSON(offer *datastore.SwapOffer) swapOfferJSON {
+    resp := swapOfferJSON{UUID : syncParam.UUIDtoString(offer.UUID()),
+                          OrgUUID : syncParam.UUIDtoString(offer.OrgUUID()),
+                          AssignmentUUID : syncParam.UUIDtoString(
+                                                offer.AssignmentUUID()),
+                          OfferedBy : offer.OfferedBy(),
+                          Kind : swapKindNames[offer.Kind()],
+                          TakenBy : offer.TakenBy(),
+                          Status : swapStatusNames[offer.Status()],
+                          ApproverRole : uint64(offer.ApproverRole()),
+                          CreateTime : offer.CreateTime(),
+                          DecidedBy : offer.DecidedBy()}
+    if !syncParam.IsUUIDEmpty(offer.TargetAssignmentUUID()) {
+        resp.TargetAssignmentUUID =
+                    syncParam.UUIDtoString(offer.TargetAssignmentUUID())
+    }
+    if !offer.DecideTime().IsZero() {
+        decideTime := offer.DecideTime()
+        resp.DecideTime = &decideTime
+    }
+    return resp
+}
+
+func swapAuditsToJSON(audits []datastore.SwapAudit) []swapAuditJSON {
+    resp := make([]swapAuditJSON, 0, len(audits))
+    for i := range(audits) {
+        resp = append(resp, swapAuditJSON{
+                    UUID : syncParam.UUIDtoString(audits[i].UUID()),
+                    OfferUUID : syncParam.UUIDtoString(audits[i].OfferUUID()),
+                    OrgUUID : syncParam.UUIDtoString(audits[i].OrgUUID()),
+                    Status : swapStatusNames[audits[i].Status()],
+                    Actor : audits[i].Actor(),
+                    AuditTime : audits[i].AuditTime(),
+                    Note : audits[i].Note()})
+    }
+    return resp
+}
+
+//Find the swap kind with JSON name 'name'.
+func parseSwapKind(name string) (datastore.SwapKindBit, error) {
+    for kind, kindName := range(swapKindNames) {
+        if kindName == name {
+            return kind, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Find the swap status with JSON name 'name'.
+func parseSwapStatus(name string) (datastore.SwapStatusBit, error) {
+    for status, statusName := range(swapStatusNames) {
+        if statusName == name {
+            return status, nil
+        }
+    }
+    return 0, fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+}
+
+//Get the swap offer in url param 'uuidStr', the error response is written
+// on failure.
+func getSwapParam(w http.ResponseWriter,
+                  uuidStr string) (*datastore.SwapOffer, bool) {
+    uuid, err := parseUUID(uuidStr)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    offer := datastore.NewSwapOfferRef(uuid)
+    err = datastore.GetDataStoreObj().GetSwapOffer(offer)
+    if err != nil {
+        writeError(w, err)
+        return nil, false
+    }
+    return offer, true
+}
+
+//Swap rules in effect for the org/unit, inherited from the ancestors when
+// the org/unit has no rules of its own.
+func getSwapSettingsHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    settings := datastore.NewSwapSettingsRef(orgUUID)
+    err = datastore.GetDataStoreObj().GetSwapSettings(settings)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, swapSettingsToJSON(settings))
+}
+
+func setSwapSettingsHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    var body swapSettingsJSON
+    err = readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    settings := datastore.NewSwapSettings(orgUUID,
+                            time.Duration(body.MinRest) * time.Second,
+                            datastore.RoleBit(body.ApproverRole))
+    err = datastore.GetDataStoreObj().SetSwapSettings(settings)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, swapSettingsToJSON(settings))
+}
+
+//Swap offers of the org/unit in query param 'status', open offers when not
+// given, ie: the marketplace of the org/unit.
+func listOrgSwapsHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, orgUUID) {
+        return
+    }
+    status := datastore.SWAP_OPEN
+    if statusStr := req.URL.Query().Get("status"); len(statusStr) != 0 {
+        status, err = parseSwapStatus(statusStr)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+    }
+    offers, err := datastore.GetDataStoreObj().ListOrgSwapOffers(orgUUID,
+                                                                 status)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]swapOfferJSON, 0, len(offers))
+    for i := range(offers) {
+        resp = append(resp, swapOfferToJSON(&offers[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Audit of all the trades of org/unit in query params 'from' and 'to'.
+func listOrgSwapAuditHandler(w http.ResponseWriter, req *http.Request,
+                             params []string) {
+    orgUUID, err := parseUUID(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeRequest(w, req, authz.MANAGE_SHIFTS, orgUUID) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    audits, err := datastore.GetDataStoreObj().ListOrgSwapAudit(orgUUID, from,
+                                                                to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, swapAuditsToJSON(audits))
+}
+
+//Users offer only their own assignments.
+func createSwapHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    var body swapOfferJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    asgnUUID, err := parseUUID(body.AssignmentUUID)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    kind, err := parseSwapKind(body.Kind)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    var targetUUID syncParam.UUID
+    if kind == datastore.SWAP_DIRECT {
+        targetUUID, err = parseUUID(body.TargetAssignmentUUID)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+    }
+    offer := datastore.NewSwapOffer(asgnUUID,
+                                    requestIdentity(req).User().Userid(),
+                                    kind, targetUUID)
+    err = datastore.GetDataStoreObj().CreateSwapOffer(offer)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, swapOfferToJSON(offer))
+}
+
+func getSwapHandler(w http.ResponseWriter, req *http.Request,
+                    params []string) {
+    offer, ok := getSwapParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, offer.OrgUUID()) {
+        return
+    }
+    writeJSON(w, http.StatusOK, swapOfferToJSON(offer))
+}
+
+func listSwapAuditHandler(w http.ResponseWriter, req *http.Request,
+                          params []string) {
+    offer, ok := getSwapParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, offer.OrgUUID()) {
+        return
+    }
+    audits, err := datastore.GetDataStoreObj().ListSwapAudit(offer.UUID())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, swapAuditsToJSON(audits))
+}
+
+//Move the swap offer to 'status' on behalf of the user of request, the note
+// in request body is kept in the audit.
+func updateSwapStatus(w http.ResponseWriter, req *http.Request,
+                      offer *datastore.SwapOffer,
+                      status datastore.SwapStatusBit) {
+    var body swapActionJSON
+    if req.ContentLength != 0 {
+        err := readJSON(req, &body)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+    }
+    err := datastore.GetDataStoreObj().UpdateSwapStatus(offer, status,
+                                        requestIdentity(req).User().Userid(),
+                                        body.Note)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, swapOfferToJSON(offer))
+}
+
+//Members of the org/unit take the offer, the trade is completed at once when
+// the org/unit needs no approval.
+func acceptSwapHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    offer, ok := getSwapParam(w, params[0])
+    if !ok {
+        return
+    }
+    if !authorizeRequest(w, req, authz.VIEW_SHIFTS, offer.OrgUUID()) {
+        return
+    }
+    updateSwapStatus(w, req, offer, offer.TakeStatus())
+}
+
+//Only the users holding the approver role of the offer decide on it, never
+// on a trade they are part of.
+func decideSwap(w http.ResponseWriter, req *http.Request, uuidStr string,
+                status datastore.SwapStatusBit) {
+    offer, ok := getSwapParam(w, uuidStr)
+    if !ok {
+        return
+    }
+    err := authz.CheckOrgActive(offer.OrgUUID())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    userid := requestIdentity(req).User().Userid()
+    roles, err := datastore.GetDataStoreObj().GetEffectiveRoles(userid,
+                                                            offer.OrgUUID())
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if roles & offer.ApproverRole() == 0 || userid == offer.OfferedBy() ||
+        userid == offer.TakenBy() {
+        writeError(w, fmt.Errorf("%s",
+                                 errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+        return
+    }
+    updateSwapStatus(w, req, offer, status)
+}
+
+func approveSwapHandler(w http.ResponseWriter, req *http.Request,
+                        params []string) {
+    decideSwap(w, req, params[0], datastore.SWAP_COMPLETED)
+}
+
+func rejectSwapHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    decideSwap(w, req, params[0], datastore.SWAP_REJECTED)
+}
+
+//Users withdraw the trades they are part of, shift managers can cancel any
+// trade of org/unit.
+func cancelSwapHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    offer, ok := getSwapParam(w, params[0])
+    if !ok {
+        return
+    }
+    userid := requestIdentity(req).User().Userid()
+    if userid != offer.OfferedBy() && userid != offer.TakenBy() &&
+        !authorizeRequest(w, req, authz.MANAGE_SHIFTS, offer.OrgUUID()) {
+        return
+    }
+    updateSwapStatus(w, req, offer, datastore.SWAP_CANCELLED)
+}
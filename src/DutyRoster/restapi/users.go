@@ -0,0 +1,306 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restapi
+
+import (
+    "fmt"
+    "time"
+    "net/http"
+    "DutyRoster/authz"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/credentials"
+    "DutyRoster/syncParam"
+)
+
+//JSON representation of a user account. Password is only accepted in the
+// requests, it is never sent in a response.
+type userJSON struct {
+    Userid string `json:"userid"`
+    Emailid string `json:"emailid"`
+    Password string `json:"password,omitempty"`
+    Mobileno string `json:"mobileno"`
+    Dob time.Time `json:"dob"`
+    StartTime time.Time `json:"starttime"`
+    //Validity in days, 0 for unlimited validity.
+    Validity uint64 `json:"validity"`
+    Status uint64 `json:"status"`
+}
+
+//JSON representation of a user membership in an org/unit.
+type membershipJSON struct {
+    Userid string `json:"userid"`
+    OrgUUID string `json:"orguuid"`
+    Roles uint64 `json:"roles"`
+}
+
+var userRoutes = []route{
+    newPublicRoute(http.MethodPost, "/users", createUserHandler),
+    newRoute(http.MethodGet, "/users/*", getUserHandler),
+    newRoute(http.MethodPut, "/users/*", updateUserHandler),
+    newRoute(http.MethodDelete, "/users/*", deleteUserHandler),
+    newRoute(http.MethodGet, "/users/*/memberships", listUserMembershipsHandler),
+    newRoute(http.MethodGet, "/users/*/roster", listUserRosterHandler),
+    newRoute(http.MethodGet, "/users/*/invites", listUserInvitesHandler),
+    newRoute(http.MethodPost, "/users/*/invites/*/accept",
+             acceptInviteHandler),
+    newRoute(http.MethodDelete, "/users/*/invites/*", deleteInviteHandler),
+}
+
+func userToJSON(user *datastore.Users) userJSON {
+    return userJSON{Userid : user.Userid(),
+                    Emailid : user.Emailid(),
+                    Mobileno : user.Mobileno(),
+                    Dob : user.Dob(),
+                    StartTime : user.StartTime(),
+                    Validity : user.Validity(),
+                    Status : uint64(user.Status())}
+}
+
+func membershipToJSON(member *datastore.UserOrgRole) membershipJSON {
+    return membershipJSON{Userid : member.Userid(),
+                          OrgUUID : syncParam.UUIDtoString(member.UUID()),
+                          Roles : uint64(member.RoleType())}
+}
+
+//New users are always created in requested state, users can register
+// themselves without login. The account is approved offline with 'user
+// approve'.
+func createUserHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    var body userJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    body.Status = uint64(datastore.USER_REQUESTED)
+    hashpwd, err := credentials.HashPassword(body.Password)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    user := datastore.NewUser(body.Userid, body.Emailid, hashpwd,
+                              body.Mobileno, body.Dob,
+                              datastore.UserStatusBit(body.Status),
+                              body.Validity)
+    err = datastore.GetDataStoreObj().CreateUserAccount(user)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, userToJSON(user))
+}
+
+func getUserHandler(w http.ResponseWriter, req *http.Request,
+                    params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    user := datastore.NewUserRef(params[0])
+    err := datastore.GetDataStoreObj().GetUser(user)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, userToJSON(user))
+}
+
+//Only emailid, password, mobileno, status and validity can be updated, the
+// empty/zero fields in the request are left as is. Password is changed only
+// by the user itself, status and validity only by the admins.
+func updateUserHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    var body userJSON
+    err := readJSON(req, &body)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if len(body.Userid) != 0 && body.Userid != params[0] {
+        writeError(w, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM]))
+        return
+    }
+    //Users cannot approve/extend their own accounts.
+    if (body.Status != 0 || body.Validity != 0) &&
+        requestIdentity(req).User().Userid() == params[0] {
+        writeError(w, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.ACCESS_DENIED]))
+        return
+    }
+    if len(body.Password) != 0 && !authorizeSelfRequest(w, req, params[0]) {
+        return
+    }
+    if !authorizeUserRequest(w, req, authz.MANAGE_USER, params[0]) {
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    user := datastore.NewUserRef(params[0])
+    err = dbObj.GetUser(user)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if len(body.Emailid) != 0 {
+        user.SetEmailid(body.Emailid)
+    }
+    if len(body.Password) != 0 {
+        hashpwd, err := credentials.HashPassword(body.Password)
+        if err != nil {
+            writeError(w, err)
+            return
+        }
+        user.SetHashpwd(hashpwd)
+    }
+    if len(body.Mobileno) != 0 {
+        user.SetMobileno(body.Mobileno)
+    }
+    if body.Status != 0 {
+        user.SetStatus(datastore.UserStatusBit(body.Status))
+    }
+    if body.Validity != 0 {
+        user.SetValidity(body.Validity)
+    }
+    err = dbObj.UpdateUserAccount(user)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusOK, userToJSON(user))
+}
+
+func deleteUserHandler(w http.ResponseWriter, req *http.Request,
+                       params []string) {
+    if !authorizeUserRequest(w, req, authz.MANAGE_USER, params[0]) {
+        return
+    }
+    dbObj := datastore.GetDataStoreObj()
+    user := datastore.NewUserRef(params[0])
+    err := dbObj.GetUser(user)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    err = dbObj.DeleteUserAccount(user)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
+
+func listUserMembershipsHandler(w http.ResponseWriter, req *http.Request,
+                                params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    members, err := datastore.GetDataStoreObj().ListUserMemberships(params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]membershipJSON, 0, len(members))
+    for i := range(members) {
+        resp = append(resp, membershipToJSON(&members[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Roster of user in the range of query params 'from' and 'to'.
+func listUserRosterHandler(w http.ResponseWriter, req *http.Request,
+                           params []string) {
+    if !authorizeUserRequest(w, req, authz.VIEW_USER, params[0]) {
+        return
+    }
+    from, to, err := parseQueryRange(req)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    asgns, err := datastore.GetDataStoreObj().ListUserRoster(params[0],
+                                                             from, to)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]assignmentJSON, 0, len(asgns))
+    for i := range(asgns) {
+        resp = append(resp, assignmentToJSON(&asgns[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Pending invites of the user to join the org/units.
+func listUserInvitesHandler(w http.ResponseWriter, req *http.Request,
+                            params []string) {
+    if !authorizeSelfRequest(w, req, params[0]) {
+        return
+    }
+    invites, err := datastore.GetDataStoreObj().ListUserMembershipInvites(
+                                                                params[0])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    resp := make([]membershipJSON, 0, len(invites))
+    for i := range(invites) {
+        resp = append(resp, membershipToJSON(&invites[i]))
+    }
+    writeJSON(w, http.StatusOK, resp)
+}
+
+//Join the org/unit with the role bits of the invite, only the invited user can
+// accept the invite.
+func acceptInviteHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    orgUUID, err := parseUUID(params[1])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if !authorizeSelfRequest(w, req, params[0]) {
+        return
+    }
+    invite := datastore.NewUserOrgRole(params[0], 0, orgUUID)
+    err = datastore.GetDataStoreObj().AcceptMembershipInvite(invite)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusCreated, membershipToJSON(invite))
+}
+
+//Decline the invite, or withdraw it by a user who can manage the members of
+// the org/unit.
+func deleteInviteHandler(w http.ResponseWriter, req *http.Request,
+                         params []string) {
+    orgUUID, err := parseUUID(params[1])
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    if requestIdentity(req).User().Userid() != params[0] &&
+        !authorizeRequest(w, req, authz.MANAGE_MEMBERS, orgUUID) {
+        return
+    }
+    invite := datastore.NewUserOrgRole(params[0], 0, orgUUID)
+    err = datastore.GetDataStoreObj().DeleteMembershipInvite(invite)
+    if err != nil {
+        writeError(w, err)
+        return
+    }
+    writeJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+    "sort"
+    "time"
+    "DutyRoster/datastore"
+)
+
+//Gap between two shifts that breaks a consecutive run of shifts.
+const CONSECUTIVE_SHIFT_GAP = 24 * time.Hour
+
+//Time interval of a shift.
+type interval struct {
+    start time.Time
+    end time.Time
+}
+
+//Check the hard constraints for assigning user to the slot.
+//Return true if the user can work the slot and false otherwise.
+func (sch *scheduler)isAssignable(user *userState, slot *slotState) bool {
+    if !datastore.HoldsSkills(sch.skills[user.userid], slot.skills,
+                              slot.start, slot.end) {
+        return false
+    }
+    if !datastore.IsUserAvailable(sch.avail[user.userid], slot.start,
+                                  slot.end, sch.loc) {
+        return false
+    }
+    for i := range(sch.leaves[user.userid]) {
+        if sch.leaves[user.userid][i].IsBusy(slot.start, slot.end) {
+            return false
+        }
+    }
+    busy := sch.busy[user.userid]
+    shifts := make([]interval, 0, len(busy) + len(user.shifts) + 1)
+    shifts = append(shifts, busy...)
+    for _, assigned := range(user.shifts) {
+        shifts = append(shifts, interval{assigned.start, assigned.end})
+    }
+    return isRestValid(shifts, interval{slot.start, slot.end},
+                       sch.req.Constraints.MinRest) &&
+           isConsecutiveValid(shifts, interval{slot.start, slot.end},
+                       sch.req.Constraints.MaxConsecutiveShifts)
+}
+
+//Return true when the new shift doesnt overlap any of the shifts and leaves
+// at least 'minRest' before and after it.
+func isRestValid(shifts []interval, newshift interval,
+                 minRest time.Duration) bool {
+    for _, shift := range(shifts) {
+        if newshift.start.Before(shift.end.Add(minRest)) &&
+            shift.start.Before(newshift.end.Add(minRest)) {
+            return false
+        }
+    }
+    return true
+}
+
+//Return true when adding the new shift doesnt create a run of more than
+// 'maxRun' consecutive shifts.
+func isConsecutiveValid(shifts []interval, newshift interval,
+                        maxRun uint64) bool {
+    if maxRun == 0 {
+        return true
+    }
+    all := append(shifts, newshift)
+    sort.Slice(all, func(i, j int) bool {
+        return all[i].start.Before(all[j].start)
+    })
+    var run uint64 = 1
+    for i := 1; i < len(all); i++ {
+        if all[i].start.Sub(all[i - 1].end) < CONSECUTIVE_SHIFT_GAP {
+            run++
+        } else {
+            run = 1
+        }
+        if run > maxRun {
+            return false
+        }
+    }
+    return true
+}
+
+//Preference weight of the user for the shift template of slot.
+func (sch *scheduler)preference(user *userState, slot *slotState) int64 {
+    userprefs, ok := sch.prefs[user.userid]
+    if !ok {
+        return 0
+    }
+    return userprefs[slot.tmpl.UUID()]
+}
+
+//Score of assigning the user to slot from the soft constraints, higher score
+// is better. Preferences add to the score and hours already on duty reduce
+// it, so the work is spread across the users.
+func (sch *scheduler)score(user *userState, slot *slotState) int64 {
+    cons := sch.req.Constraints
+    return cons.PreferenceWeight * sch.preference(user, slot) -
+           cons.FairnessWeight * int64(user.onDuty / time.Hour)
+}
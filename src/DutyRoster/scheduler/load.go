@@ -0,0 +1,98 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package scheduler
+
+import (
+    "time"
+    "DutyRoster/datastore"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//Fill the request from the datastore for its org/unit and range. Templates,
+// time zone and members of the org/unit are loaded along with the skills,
+// availability, shift preferences, approved leaves and shifts of every
+// member. OrgUUID, From, To and Constraints must be set on the request.
+func LoadRequest(req *Request) error {
+    log := logging.GetAppLoggerObj()
+    dbObj := datastore.GetDataStoreObj()
+    org := datastore.NewOrgRef(req.OrgUUID)
+    err := dbObj.GetOrg(org)
+    if err != nil {
+        log.Error("Cannot load roster request, org %s not found",
+                  syncParam.UUIDtoString(req.OrgUUID))
+        return err
+    }
+    req.Location = org.Location()
+    req.Templates, err = dbObj.ListShiftTemplates(req.OrgUUID)
+    if err != nil {
+        return err
+    }
+    members, err := dbObj.ListOrgMemberships(req.OrgUUID)
+    if err != nil {
+        return err
+    }
+    //Shifts just outside the range count for the rest and consecutive shift
+    // constraints. A run of shifts shorter than a day with gaps under
+    // CONSECUTIVE_SHIFT_GAP covers at most two days for every shift.
+    margin := req.Constraints.MinRest + 2 * CONSECUTIVE_SHIFT_GAP *
+              time.Duration(req.Constraints.MaxConsecutiveShifts + 1)
+    req.Users = []string{}
+    req.Skills = []datastore.UserSkill{}
+    req.Availability = []datastore.Availability{}
+    req.Leaves = []datastore.LeaveRequest{}
+    req.Busy = make(map[string][]datastore.Shift)
+    req.Preferences = []Preference{}
+    seen := make(map[string]bool)
+    for i := range(members) {
+        userid := members[i].Userid()
+        if seen[userid] {
+            continue
+        }
+        seen[userid] = true
+        req.Users = append(req.Users, userid)
+        skills, err := dbObj.ListUserSkills(userid)
+        if err != nil {
+            return err
+        }
+        req.Skills = append(req.Skills, skills...)
+        avails, err := dbObj.ListUserAvailability(userid)
+        if err != nil {
+            return err
+        }
+        for _, avail := range(avails) {
+            if avail.Kind() == datastore.AVAILABILITY_PREFERENCE {
+                req.Preferences = append(req.Preferences, Preference{
+                            Userid : userid,
+                            TemplateUUID : avail.TemplateUUID(),
+                            Weight : avail.Weight()})
+                continue
+            }
+            req.Availability = append(req.Availability, avail)
+        }
+        leaves, err := dbObj.ListUserBusy(userid, req.From, req.To)
+        if err != nil {
+            return err
+        }
+        req.Leaves = append(req.Leaves, leaves...)
+        req.Busy[userid], err = dbObj.ListUserShifts(userid,
+                                req.From.Add(-margin), req.To.Add(margin))
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+    "DutyRoster/datastore"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+)
+
+//Write the roster to the datastore. Shifts are created and users are assigned
+// to them in one datastore transaction, a user on approved leave in the shift
+// or without the skills of the shift fails the whole roster. Nothing is
+// written when any of the writes fails.
+//Shift uuids in the roster are populated on success.
+func (roster *Roster)Publish() error {
+    log := logging.GetAppLoggerObj()
+    dbObj := datastore.GetDataStoreObj()
+    shifts := make([]*datastore.Shift, len(roster.Slots))
+    users := make([][]string, len(roster.Slots))
+    for i, slot := range(roster.Slots) {
+        shifts[i] = slot.Shift
+        users[i] = slot.Users
+    }
+    err := dbObj.CreateRoster(shifts, users)
+    if err != nil {
+        log.Error("Failed to publish roster for org %s, err : %s",
+                  syncParam.UUIDtoString(roster.OrgUUID), err)
+        return err
+    }
+    return nil
+}
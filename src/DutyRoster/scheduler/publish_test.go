@@ -0,0 +1,177 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package scheduler
+
+import (
+    "sort"
+    "time"
+    "testing"
+    "reflect"
+    "DutyRoster/datastore"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//A failed roster must leave no shift or assignment behind.
+func TestPublish(t *testing.T) {
+    setupDataStore(t)
+    orgUUID := newTestOrg(t, "publish", []string{"pub-a", "pub-b"})
+    icu := newTestTemplate(t, orgUUID, "icu", 1, []string{"icu"})
+    dbObj := datastore.GetDataStoreObj()
+    week := func(n int) time.Time {
+        return testDay.AddDate(0, 0, 7 * n)
+    }
+    tests := []struct {
+        name string
+        //Slots are on consecutive days of the week.
+        week int
+        tmpl syncParam.UUID
+        users [][]string
+        wantErr int
+    }{
+        {"roster", 0, syncParam.UUID{},
+         [][]string{{"pub-a", "pub-b"}, {"pub-b"}}, -1},
+        {"user on leave", 1, syncParam.UUID{},
+         [][]string{{"pub-a"}, {"pub-b"}}, errorset.LEAVE_CONFLICT},
+        {"missing skill", 2, icu.UUID(),
+         [][]string{{"pub-a"}}, errorset.SKILL_REQUIREMENT_NOT_MET},
+        {"unknown user", 3, syncParam.UUID{},
+         [][]string{{"pub-a"}, {"pub-x"}},
+         errorset.DB_PARENT_RECORD_NOT_FOUND},
+        {"duplicate user", 4, syncParam.UUID{},
+         [][]string{{"pub-a", "pub-a"}}, errorset.DB_RECORD_NOT_UNIQUE},
+    }
+    newTestLeave(t, orgUUID, "pub-b", week(1).AddDate(0, 0, 1),
+                 week(1).AddDate(0, 0, 2))
+    for _, test := range(tests) {
+        roster := &Roster{OrgUUID : orgUUID}
+        for i, users := range(test.users) {
+            start := week(test.week).AddDate(0, 0, i).Add(9 * time.Hour)
+            roster.Slots = append(roster.Slots, Slot{
+                    Shift : datastore.NewShift(orgUUID, test.tmpl, start,
+                                    start.Add(8 * time.Hour), 1, "owner"),
+                    Users : users})
+        }
+        err := roster.Publish()
+        shifts, _ := dbObj.ListShifts(orgUUID, week(test.week),
+                                      week(test.week + 1))
+        if test.wantErr >= 0 {
+            if err == nil || err.Error() != errorOf(test.wantErr) {
+                t.Errorf("%s: got error %v, want %q", test.name, err,
+                         errorOf(test.wantErr))
+            }
+            if len(shifts) != 0 {
+                t.Errorf("%s: %d shifts are left of failed roster",
+                         test.name, len(shifts))
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: cannot publish, %s", test.name, err)
+            continue
+        }
+        if len(shifts) != len(test.users) {
+            t.Errorf("%s: got %d shifts, want %d", test.name, len(shifts),
+                     len(test.users))
+        }
+        for i, slot := range(roster.Slots) {
+            asgns, _ := dbObj.ListShiftRoster(slot.Shift.UUID())
+            got := []string{}
+            for _, asgn := range(asgns) {
+                got = append(got, asgn.Userid())
+            }
+            if !reflect.DeepEqual(got, test.users[i]) {
+                t.Errorf("%s: slot %d got users %v, want %v", test.name, i,
+                         got, test.users[i])
+            }
+        }
+    }
+}
+
+func TestLoadRequest(t *testing.T) {
+    setupDataStore(t)
+    orgUUID := newTestOrg(t, "load", []string{"load-a", "load-b"})
+    dbObj := datastore.GetDataStoreObj()
+    //Second membership of a user must not add the user twice.
+    err := dbObj.GrantUserOrgRole(datastore.NewUserOrgRole("load-b",
+                                        datastore.MANAGER, orgUUID))
+    if err != nil {
+        t.Fatalf("Cannot grant manager role, %s", err)
+    }
+    tmpl := newTestTemplate(t, orgUUID, "day", 1, nil)
+    records := []*datastore.Availability{
+        datastore.NewBlackout("load-a", testDay, testDay.AddDate(0, 0, 1), ""),
+        datastore.NewShiftPreference("load-a", tmpl.UUID(), 3),
+    }
+    for _, avail := range(records) {
+        err = dbObj.CreateAvailability(avail)
+        if err != nil {
+            t.Fatalf("Cannot create availability, %s", err)
+        }
+    }
+    err = dbObj.SetUserSkill(datastore.NewUserSkill("load-a", "icu",
+                        datastore.SKILL_GENERAL, time.Time{}, time.Time{}))
+    if err != nil {
+        t.Fatalf("Cannot set skill, %s", err)
+    }
+    newTestLeave(t, orgUUID, "load-b", testDay.AddDate(0, 0, 1),
+                 testDay.AddDate(0, 0, 2))
+    newTestLeave(t, orgUUID, "load-b", testDay.AddDate(0, 0, 30),
+                 testDay.AddDate(0, 0, 31))
+    busy := newTestShift(t, orgUUID, -1, false)
+    err = dbObj.CreateRosterAssignment(datastore.NewRosterAssignment(
+                                        busy.UUID(), orgUUID, "load-a"))
+    if err != nil {
+        t.Fatalf("Cannot assign shift, %s", err)
+    }
+    req := &Request{OrgUUID : orgUUID, From : testDay,
+                    To : testDay.AddDate(0, 0, 7)}
+    err = LoadRequest(req)
+    if err != nil {
+        t.Fatalf("Cannot load request, %s", err)
+    }
+    sort.Strings(req.Users)
+    tests := []struct {
+        name string
+        got interface{}
+        want interface{}
+    }{
+        {"location", req.Location.String(), "UTC"},
+        {"templates", len(req.Templates), 1},
+        {"users", req.Users, []string{"load-a", "load-b"}},
+        {"skills", len(req.Skills), 1},
+        {"availability", len(req.Availability), 1},
+        {"preferences", req.Preferences,
+         []Preference{{"load-a", tmpl.UUID(), 3}}},
+        {"leaves in range", len(req.Leaves), 1},
+        {"busy shifts", len(req.Busy["load-a"]), 1},
+        {"no busy shifts", len(req.Busy["load-b"]), 0},
+    }
+    for _, test := range(tests) {
+        if !reflect.DeepEqual(test.got, test.want) {
+            t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+        }
+    }
+}
+
+func TestLoadRequestUnknownOrg(t *testing.T) {
+    setupDataStore(t)
+    err := LoadRequest(&Request{OrgUUID : syncParam.UUID{1}, From : testDay,
+                                To : testDay.AddDate(0, 0, 1)})
+    if err == nil {
+        t.Errorf("Loaded request of unknown org")
+    }
+}
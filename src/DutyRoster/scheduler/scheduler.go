@@ -0,0 +1,426 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+//******************************************************************************
+// Roster generation engine. Shifts are expanded from the shift templates for
+// every day in the requested range and users are assigned to them.
+// Coverage minimum, max consecutive shifts, minimum rest, the skills of the
+// templates, the availability and approved leave of the users and the shifts
+// the users already work are hard constraints, a roster is never produced
+// when any of them is violated.
+// User preferences and fairness are soft constraints, they are only used to
+// rank the users when more than required users are eligible for a shift.
+// The engine is deterministic for a given seed, same input and seed always
+// produce the same roster.
+//******************************************************************************
+import (
+    "fmt"
+    "math/rand"
+    "sort"
+    "time"
+    "DutyRoster/datastore"
+    "DutyRoster/errorset"
+    "DutyRoster/logging"
+    "DutyRoster/syncParam"
+    "DutyRoster/timezone"
+)
+
+//Maximum number of assignment attempts before giving up on a roster.
+//Backtracking is exponential in the worst case, the limit keeps the engine
+// responsive on infeasible inputs.
+const MAX_SEARCH_STEPS = 500000
+
+//Maximum number of days in the range of a roster. Shifts and the search steps
+// grow with the range, a roster is generated for a few weeks at a time.
+const MAX_ROSTER_DAYS = 92
+
+//Preference of a user for a shift template. Positive weight means the user
+// likes to work the shift, negative weight means user likes to avoid it.
+type Preference struct {
+    Userid string
+    TemplateUUID syncParam.UUID
+    Weight int64
+}
+
+//Hard and soft constraints to be applied on the roster.
+type Constraints struct {
+    //Maximum number of consecutive shifts a user can work. Shifts are
+    // consecutive when the gap between them is less than a day.
+    //Store 0 for no limit.
+    MaxConsecutiveShifts uint64
+    //Minimum rest between end of a shift and start of next shift of a user.
+    MinRest time.Duration
+    //Weight of user preferences in the score of an assignment.
+    PreferenceWeight int64
+    //Weight of fairness in the score of an assignment, Fairness penalize
+    // the users who already have more hours on duty than others.
+    FairnessWeight int64
+}
+
+//Input for roster generation.
+type Request struct {
+    OrgUUID syncParam.UUID
+    //Date range of the roster, Shifts are generated for every day in the
+    // range [From, To).
+    From time.Time
+    To time.Time
+    //Time zone of the org, days and template start offsets are on its wall
+    // clock. UTC is used when not set.
+    Location *time.Location
+    Templates []datastore.ShiftTemplate
+    //userids of users who are eligible to work in the roster.
+    Users []string
+    //Skills held by the users. A user works the shifts of a template only
+    // when holding all the skills of the template for the whole shift.
+    Skills []datastore.UserSkill
+    //Availability records of the users. A user works a shift only when
+    // available for the whole shift, see datastore.IsUserAvailable.
+    Availability []datastore.Availability
+    //Leaves of the users, a user never works a shift that overlaps an
+    // approved leave.
+    Leaves []datastore.LeaveRequest
+    //Shifts the users are already assigned to, in any org/unit. The roster
+    // never overlaps them and they count for the rest and consecutive shift
+    // constraints. Cancelled shifts are ignored.
+    Busy map[string][]datastore.Shift
+    Preferences []Preference
+    Constraints Constraints
+    //Seed for breaking the ties between equally scored users.
+    Seed int64
+    //userid of user who generates the roster.
+    Owner string
+}
+
+//A shift in the generated roster and the users assigned to it.
+type Slot struct {
+    Shift *datastore.Shift
+    Users []string
+}
+
+//Roster generated by the engine.
+type Roster struct {
+    OrgUUID syncParam.UUID
+    Seed int64
+    Slots []Slot
+    //Sum of preference weights of all assignments in the roster.
+    PreferenceScore int64
+    //Difference between maximum and minimum hours on duty among the users.
+    FairnessSpread time.Duration
+}
+
+//Book keeping of a user while generating roster.
+type userState struct {
+    userid string
+    //Shifts assigned to the user, in the order of assignment.
+    shifts []*slotState
+    onDuty time.Duration
+}
+
+type slotState struct {
+    tmpl *datastore.ShiftTemplate
+    start time.Time
+    end time.Time
+    minStaff uint64
+    //Skills required to work the slot.
+    skills []string
+    users []*userState
+    //Random rank of each user for the slot, drawn from the seed.
+    rank map[string]int64
+}
+
+type scheduler struct {
+    req *Request
+    loc *time.Location
+    slots []*slotState
+    users []*userState
+    prefs map[string]map[syncParam.UUID]int64
+    skills map[string][]datastore.UserSkill
+    avail map[string][]datastore.Availability
+    leaves map[string][]datastore.LeaveRequest
+    //Shifts of the users outside the roster.
+    busy map[string][]interval
+    steps uint64
+}
+
+//Check the roster range [from, to). Returns ROSTER_RANGE_TOO_LARGE error when
+// the range is longer than MAX_ROSTER_DAYS.
+func CheckRange(from time.Time, to time.Time) error {
+    if !to.After(from) {
+        return fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    if to.Sub(from) > MAX_ROSTER_DAYS * 24 * time.Hour {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.ROSTER_RANGE_TOO_LARGE])
+    }
+    return nil
+}
+
+//Generate a roster for the request. Returns SCHEDULE_INFEASIBLE error when
+// the hard constraints cannot be met and SCHEDULE_SEARCH_LIMIT error when the
+// search is stopped at MAX_SEARCH_STEPS before finding a roster.
+func Generate(req *Request) (*Roster, error) {
+    log := logging.GetAppLoggerObj()
+    if req == nil || syncParam.IsUUIDEmpty(req.OrgUUID) ||
+        len(req.Owner) == 0 {
+        log.Error("Cannot generate roster, invalid request")
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.INVALID_PARAM])
+    }
+    err := CheckRange(req.From, req.To)
+    if err != nil {
+        log.Error("Cannot generate roster, invalid range %s - %s",
+                  req.From, req.To)
+        return nil, err
+    }
+    sch := new(scheduler)
+    sch.req = req
+    sch.loc = req.Location
+    if sch.loc == nil {
+        sch.loc = time.UTC
+    }
+    sch.initUsers()
+    sch.initPreferences()
+    sch.initSkills()
+    sch.initAvailability()
+    sch.expandSlots()
+    log.Trace("Generating roster for org %s with %d shifts and %d users",
+              syncParam.UUIDtoString(req.OrgUUID), len(sch.slots),
+              len(sch.users))
+    if !sch.assignSlot(0) {
+        if sch.steps > MAX_SEARCH_STEPS {
+            log.Info("Roster search for org %s is stopped at %d steps",
+                     syncParam.UUIDtoString(req.OrgUUID), MAX_SEARCH_STEPS)
+            return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.SCHEDULE_SEARCH_LIMIT])
+        }
+        log.Info("Failed to generate roster for org %s after %d steps",
+                 syncParam.UUIDtoString(req.OrgUUID), sch.steps)
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.SCHEDULE_INFEASIBLE])
+    }
+    return sch.buildRoster(), nil
+}
+
+//Sort and remove duplicates in the user list, so the order of users in the
+// request doesnt change the roster.
+func (sch *scheduler)initUsers() {
+    userids := make([]string, 0, len(sch.req.Users))
+    seen := make(map[string]bool)
+    for _, userid := range(sch.req.Users) {
+        if len(userid) == 0 || seen[userid] {
+            continue
+        }
+        seen[userid] = true
+        userids = append(userids, userid)
+    }
+    sort.Strings(userids)
+    for _, userid := range(userids) {
+        user := new(userState)
+        user.userid = userid
+        sch.users = append(sch.users, user)
+    }
+}
+
+func (sch *scheduler)initPreferences() {
+    sch.prefs = make(map[string]map[syncParam.UUID]int64)
+    for _, pref := range(sch.req.Preferences) {
+        if _, ok := sch.prefs[pref.Userid]; !ok {
+            sch.prefs[pref.Userid] = make(map[syncParam.UUID]int64)
+        }
+        sch.prefs[pref.Userid][pref.TemplateUUID] += pref.Weight
+    }
+}
+
+//Group the skills on the user.
+func (sch *scheduler)initSkills() {
+    sch.skills = make(map[string][]datastore.UserSkill)
+    for _, skill := range(sch.req.Skills) {
+        sch.skills[skill.Userid()] = append(sch.skills[skill.Userid()], skill)
+    }
+}
+
+//Group the availability, leaves and shifts outside the roster on the user.
+func (sch *scheduler)initAvailability() {
+    sch.avail = make(map[string][]datastore.Availability)
+    for _, avail := range(sch.req.Availability) {
+        sch.avail[avail.Userid()] = append(sch.avail[avail.Userid()], avail)
+    }
+    sch.leaves = make(map[string][]datastore.LeaveRequest)
+    for _, leave := range(sch.req.Leaves) {
+        if leave.Status() != datastore.LEAVE_APPROVED {
+            continue
+        }
+        sch.leaves[leave.Userid()] = append(sch.leaves[leave.Userid()], leave)
+    }
+    sch.busy = make(map[string][]interval)
+    for userid, shifts := range(sch.req.Busy) {
+        for i := range(shifts) {
+            if shifts[i].IsCancelled() {
+                continue
+            }
+            sch.busy[userid] = append(sch.busy[userid],
+                            interval{shifts[i].StartTime(), shifts[i].EndTime()})
+        }
+    }
+}
+
+//Expand the templates into shifts for every day in the range. The shifts are
+// ordered on the start time and template uuid.
+func (sch *scheduler)expandSlots() {
+    tmpls := make([]*datastore.ShiftTemplate, 0, len(sch.req.Templates))
+    for i := range(sch.req.Templates) {
+        tmpls = append(tmpls, &sch.req.Templates[i])
+    }
+    sort.Slice(tmpls, func(i, j int) bool {
+        return syncParam.UUIDtoString(tmpls[i].UUID()) <
+               syncParam.UUIDtoString(tmpls[j].UUID())
+    })
+    loc := sch.loc
+    for _, day := range(timezone.DaysIn(sch.req.From, sch.req.To, loc)) {
+        for _, tmpl := range(tmpls) {
+            if !tmpl.IsOnWeekday(day.Weekday()) {
+                continue
+            }
+            slot := new(slotState)
+            slot.tmpl = tmpl
+            slot.start, slot.end = timezone.ClockSpan(day, tmpl.StartOffset(),
+                                                      tmpl.Duration(), loc)
+            slot.minStaff = tmpl.MinStaff()
+            slot.skills = tmpl.Skills()
+            sch.slots = append(sch.slots, slot)
+        }
+    }
+    sort.SliceStable(sch.slots, func(i, j int) bool {
+        return sch.slots[i].start.Before(sch.slots[j].start)
+    })
+    //Draw the random ranks only after ordering the slots, so that the ranks
+    // depend only on the seed and the input.
+    rng := rand.New(rand.NewSource(sch.req.Seed))
+    for _, slot := range(sch.slots) {
+        slot.rank = make(map[string]int64)
+        for _, user := range(sch.users) {
+            slot.rank[user.userid] = rng.Int63()
+        }
+    }
+}
+
+//Assign users to slot 'idx' and all the slots after it.
+//Return true when all the slots are staffed.
+func (sch *scheduler)assignSlot(idx int) bool {
+    if idx == len(sch.slots) {
+        return true
+    }
+    slot := sch.slots[idx]
+    cands := sch.candidates(slot)
+    if uint64(len(cands)) < slot.minStaff {
+        return false
+    }
+    return sch.chooseUsers(idx, cands, 0, slot.minStaff)
+}
+
+//Choose 'need' users from cands[from:] for slot 'idx'. Users are tried in the
+// order of their score and backtracked when the rest of roster cannot be
+// staffed.
+func (sch *scheduler)chooseUsers(idx int, cands []*userState, from int,
+                                 need uint64) bool {
+    if need == 0 {
+        return sch.assignSlot(idx + 1)
+    }
+    slot := sch.slots[idx]
+    for i := from; uint64(len(cands) - i) >= need; i++ {
+        sch.steps++
+        if sch.steps > MAX_SEARCH_STEPS {
+            //Search is cut short, Generate reports it apart from an
+            // infeasible roster.
+            return false
+        }
+        sch.assign(cands[i], slot)
+        if sch.chooseUsers(idx, cands, i + 1, need - 1) {
+            return true
+        }
+        sch.unassign(cands[i], slot)
+    }
+    return false
+}
+
+//List of users who can work the slot without violating hard constraints,
+// ordered on the score with best first.
+func (sch *scheduler)candidates(slot *slotState) []*userState {
+    cands := make([]*userState, 0, len(sch.users))
+    scores := make(map[string]int64)
+    for _, user := range(sch.users) {
+        if !sch.isAssignable(user, slot) {
+            continue
+        }
+        cands = append(cands, user)
+        scores[user.userid] = sch.score(user, slot)
+    }
+    sort.SliceStable(cands, func(i, j int) bool {
+        si := scores[cands[i].userid]
+        sj := scores[cands[j].userid]
+        if si != sj {
+            return si > sj
+        }
+        return slot.rank[cands[i].userid] < slot.rank[cands[j].userid]
+    })
+    return cands
+}
+
+func (sch *scheduler)assign(user *userState, slot *slotState) {
+    user.shifts = append(user.shifts, slot)
+    user.onDuty += slot.end.Sub(slot.start)
+    slot.users = append(slot.users, user)
+}
+
+//Undo the last assignment of user to the slot.
+func (sch *scheduler)unassign(user *userState, slot *slotState) {
+    user.shifts = user.shifts[:len(user.shifts) - 1]
+    user.onDuty -= slot.end.Sub(slot.start)
+    slot.users = slot.users[:len(slot.users) - 1]
+}
+
+//Create the roster from the assigned slots.
+func (sch *scheduler)buildRoster() *Roster {
+    roster := new(Roster)
+    roster.OrgUUID = sch.req.OrgUUID
+    roster.Seed = sch.req.Seed
+    for _, slot := range(sch.slots) {
+        var rslot Slot
+        rslot.Shift = datastore.NewShift(sch.req.OrgUUID, slot.tmpl.UUID(),
+                                         slot.start, slot.end, slot.minStaff,
+                                         sch.req.Owner)
+        for _, user := range(slot.users) {
+            rslot.Users = append(rslot.Users, user.userid)
+            roster.PreferenceScore += sch.preference(user, slot)
+        }
+        sort.Strings(rslot.Users)
+        roster.Slots = append(roster.Slots, rslot)
+    }
+    if len(sch.users) > 0 {
+        minDuty := sch.users[0].onDuty
+        maxDuty := sch.users[0].onDuty
+        for _, user := range(sch.users) {
+            if user.onDuty < minDuty {
+                minDuty = user.onDuty
+            }
+            if user.onDuty > maxDuty {
+                maxDuty = user.onDuty
+            }
+        }
+        roster.FairnessSpread = maxDuty - minDuty
+    }
+    return roster
+}
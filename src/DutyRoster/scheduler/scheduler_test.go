@@ -0,0 +1,388 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package scheduler
+
+import (
+    "time"
+    "testing"
+    "reflect"
+    "DutyRoster/config"
+    "DutyRoster/datastore"
+    "DutyRoster/errorset"
+    "DutyRoster/syncParam"
+)
+
+//Monday, the first day of the rosters in the tests.
+var testDay = time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+
+//Use the in-memory datastore, the records are shared by all the tests in the
+// package, hence every test creates its own org/unit and users.
+func setupDataStore(t *testing.T) {
+    config.GetConfigInstance().DB.Driver = datastore.MEMORY_DB_DRIVER
+    dbObj := datastore.GetDataStoreObj()
+    err := dbObj.CreateDBConnection()
+    if err != nil {
+        t.Fatalf("Cannot connect to in-memory datastore, %s", err)
+    }
+    dbObj.InitDataStore()
+}
+
+//Create an org/unit with 'users' as its members.
+func newTestOrg(t *testing.T, name string, users []string) syncParam.UUID {
+    dbObj := datastore.GetDataStoreObj()
+    org := datastore.NewOrg(name, "test", nil, datastore.ORG_APPROVED, 0)
+    err := dbObj.CreateOrg(org)
+    if err != nil {
+        t.Fatalf("Cannot create org %s, %s", name, err)
+    }
+    for _, userid := range(users) {
+        user := datastore.NewUser(userid, userid + "@test", "hash", "1",
+                                  time.Time{}, datastore.USER_APPROVED, 0)
+        err = dbObj.CreateUserAccount(user)
+        if err != nil {
+            t.Fatalf("Cannot create user %s, %s", userid, err)
+        }
+        err = dbObj.GrantUserOrgRole(datastore.NewUserOrgRole(userid,
+                                        datastore.ENDUSER, org.UUID()))
+        if err != nil {
+            t.Fatalf("Cannot add %s to org %s, %s", userid, name, err)
+        }
+    }
+    return org.UUID()
+}
+
+//Create a template of a shift from 09:00 to 17:00 on every day.
+func newTestTemplate(t *testing.T, orgUUID syncParam.UUID, name string,
+                     minStaff uint64,
+                     skills []string) datastore.ShiftTemplate {
+    tmpl := datastore.NewShiftTemplate(orgUUID, name, 9 * time.Hour,
+                                       8 * time.Hour, 0, minStaff, "owner")
+    tmpl.SetSkills(skills)
+    err := datastore.GetDataStoreObj().CreateShiftTemplate(tmpl)
+    if err != nil {
+        t.Fatalf("Cannot create template %s, %s", name, err)
+    }
+    return *tmpl
+}
+
+//Create an approved leave of user in [from, to).
+func newTestLeave(t *testing.T, orgUUID syncParam.UUID, userid string,
+                  from time.Time, to time.Time) datastore.LeaveRequest {
+    dbObj := datastore.GetDataStoreObj()
+    policy := datastore.NewLeavePolicy(orgUUID,
+                                userid + from.Format(" 2006-01-02"),
+                                datastore.LEAVE_UNPAID, 0, 0, false)
+    err := dbObj.CreateLeavePolicy(policy)
+    if err != nil {
+        t.Fatalf("Cannot create leave policy, %s", err)
+    }
+    leave := datastore.NewLeaveRequest(userid, orgUUID, policy.UUID(), from,
+                                       to, 0, "")
+    err = dbObj.CreateLeaveRequest(leave)
+    if err == nil {
+        err = dbObj.UpdateLeaveStatus(leave, datastore.LEAVE_APPROVED, "")
+    }
+    if err == nil {
+        err = dbObj.GetLeaveRequest(leave)
+    }
+    if err != nil {
+        t.Fatalf("Cannot create leave of %s, %s", userid, err)
+    }
+    return *leave
+}
+
+//Create a shift of 'day' between 09:00 and 17:00, cancelled when 'cancel'
+// is set.
+func newTestShift(t *testing.T, orgUUID syncParam.UUID, day int,
+                  cancel bool) datastore.Shift {
+    dbObj := datastore.GetDataStoreObj()
+    start := testDay.AddDate(0, 0, day).Add(9 * time.Hour)
+    sh := datastore.NewShift(orgUUID, syncParam.UUID{}, start,
+                             start.Add(8 * time.Hour), 1, "owner")
+    err := dbObj.CreateShift(sh)
+    if err == nil && cancel {
+        err = dbObj.CancelShift(sh)
+    }
+    if err != nil {
+        t.Fatalf("Cannot create shift, %s", err)
+    }
+    return *sh
+}
+
+//Users of every slot in the roster.
+func rosterUsers(roster *Roster) [][]string {
+    users := [][]string{}
+    for _, slot := range(roster.Slots) {
+        users = append(users, slot.Users)
+    }
+    return users
+}
+
+//Message of error 'errType', empty for -1.
+func errorOf(errType int) string {
+    if errType < 0 {
+        return ""
+    }
+    return errorset.ERROR_TYPES[errType]
+}
+
+//Constraints are set up so that only one roster is valid in each test.
+func TestGenerate(t *testing.T) {
+    setupDataStore(t)
+    orgUUID := newTestOrg(t, "generate", []string{"gen-a", "gen-b"})
+    plain := newTestTemplate(t, orgUUID, "plain", 1, nil)
+    pair := newTestTemplate(t, orgUUID, "pair", 2, nil)
+    icu := newTestTemplate(t, orgUUID, "icu", 1, []string{"icu"})
+    day := func(n int) time.Time {
+        return testDay.AddDate(0, 0, n)
+    }
+    fair := Constraints{FairnessWeight : 1}
+    preferA := []Preference{{"gen-a", plain.UUID(), 10}}
+    tests := []struct {
+        name string
+        tmpl datastore.ShiftTemplate
+        days int
+        skills []datastore.UserSkill
+        avail []datastore.Availability
+        leaves []datastore.LeaveRequest
+        busy map[string][]datastore.Shift
+        prefs []Preference
+        cons Constraints
+        want [][]string
+        wantErr int
+    }{
+        {name : "coverage", tmpl : pair, days : 2,
+         want : [][]string{{"gen-a", "gen-b"}, {"gen-a", "gen-b"}},
+         wantErr : -1},
+        {name : "not enough users", tmpl : pair, days : 1,
+         avail : []datastore.Availability{*datastore.NewBlackout("gen-b",
+                                            day(0), day(1), "")},
+         wantErr : errorset.SCHEDULE_INFEASIBLE},
+        {name : "skills", tmpl : icu, days : 2,
+         skills : []datastore.UserSkill{*datastore.NewUserSkill("gen-b", "icu",
+                        datastore.SKILL_GENERAL, time.Time{}, time.Time{})},
+         want : [][]string{{"gen-b"}, {"gen-b"}}, wantErr : -1},
+        {name : "skill validity", tmpl : icu, days : 2,
+         skills : []datastore.UserSkill{
+            *datastore.NewUserSkill("gen-a", "icu", datastore.SKILL_GENERAL,
+                                    time.Time{}, day(1)),
+            *datastore.NewUserSkill("gen-b", "icu", datastore.SKILL_GENERAL,
+                                    day(1), time.Time{})},
+         want : [][]string{{"gen-a"}, {"gen-b"}}, wantErr : -1},
+        {name : "no skill", tmpl : icu, days : 1,
+         wantErr : errorset.SCHEDULE_INFEASIBLE},
+        {name : "blackout", tmpl : plain, days : 2, cons : fair,
+         avail : []datastore.Availability{*datastore.NewBlackout("gen-a",
+                                            day(0), day(1), "")},
+         want : [][]string{{"gen-b"}, {"gen-a"}}, wantErr : -1},
+        {name : "weekly availability", tmpl : plain, days : 2, cons : fair,
+         avail : []datastore.Availability{*datastore.NewWeeklyAvailability(
+                    "gen-a", 1 << uint64(time.Tuesday), 8 * time.Hour,
+                    10 * time.Hour)},
+         want : [][]string{{"gen-b"}, {"gen-a"}}, wantErr : -1},
+        {name : "approved leave", tmpl : plain, days : 2, cons : fair,
+         leaves : []datastore.LeaveRequest{newTestLeave(t, orgUUID, "gen-a",
+                                            day(0), day(1))},
+         want : [][]string{{"gen-b"}, {"gen-a"}}, wantErr : -1},
+        {name : "busy shift", tmpl : plain, days : 2, cons : fair,
+         busy : map[string][]datastore.Shift{
+                    "gen-a" : {newTestShift(t, orgUUID, 0, false)}},
+         want : [][]string{{"gen-b"}, {"gen-a"}}, wantErr : -1},
+        {name : "cancelled busy shift", tmpl : plain, days : 1,
+         avail : []datastore.Availability{*datastore.NewBlackout("gen-b",
+                                            day(0), day(1), "")},
+         busy : map[string][]datastore.Shift{
+                    "gen-a" : {newTestShift(t, orgUUID, 0, true)}},
+         want : [][]string{{"gen-a"}}, wantErr : -1},
+        {name : "min rest", tmpl : plain, days : 3,
+         cons : Constraints{MinRest : 17 * time.Hour},
+         avail : []datastore.Availability{*datastore.NewBlackout("gen-b",
+                                            day(0), day(1), "")},
+         want : [][]string{{"gen-a"}, {"gen-b"}, {"gen-a"}}, wantErr : -1},
+        {name : "preference", tmpl : plain, days : 3, prefs : preferA,
+         cons : Constraints{PreferenceWeight : 1},
+         want : [][]string{{"gen-a"}, {"gen-a"}, {"gen-a"}}, wantErr : -1},
+        {name : "max consecutive", tmpl : plain, days : 3, prefs : preferA,
+         cons : Constraints{PreferenceWeight : 1, MaxConsecutiveShifts : 2},
+         want : [][]string{{"gen-a"}, {"gen-a"}, {"gen-b"}}, wantErr : -1},
+        {name : "busy shifts are consecutive", tmpl : plain, days : 1,
+         prefs : preferA,
+         cons : Constraints{PreferenceWeight : 1, MaxConsecutiveShifts : 2},
+         busy : map[string][]datastore.Shift{
+                    "gen-a" : {newTestShift(t, orgUUID, -2, false),
+                               newTestShift(t, orgUUID, -1, false)}},
+         want : [][]string{{"gen-b"}}, wantErr : -1},
+    }
+    for _, test := range(tests) {
+        req := &Request{OrgUUID : orgUUID, From : testDay,
+                        To : day(test.days),
+                        Templates : []datastore.ShiftTemplate{test.tmpl},
+                        Users : []string{"gen-a", "gen-b"},
+                        Skills : test.skills,
+                        Availability : test.avail,
+                        Leaves : test.leaves,
+                        Busy : test.busy,
+                        Preferences : test.prefs,
+                        Constraints : test.cons,
+                        Seed : 1,
+                        Owner : "owner"}
+        roster, err := Generate(req)
+        if err != nil || test.wantErr >= 0 {
+            if err == nil || err.Error() != errorOf(test.wantErr) {
+                t.Errorf("%s: got error %v, want %q", test.name, err,
+                         errorOf(test.wantErr))
+            }
+            continue
+        }
+        got := rosterUsers(roster)
+        if !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%s: got roster %v, want %v", test.name, got, test.want)
+        }
+    }
+}
+
+func TestGenerateInvalid(t *testing.T) {
+    maxTo := testDay.AddDate(0, 0, MAX_ROSTER_DAYS)
+    tests := []struct {
+        name string
+        req *Request
+        wantErr int
+    }{
+        {"nil request", nil, errorset.INVALID_PARAM},
+        {"no org", &Request{From : testDay, To : testDay.AddDate(0, 0, 1),
+                            Owner : "owner"}, errorset.INVALID_PARAM},
+        {"empty range", &Request{OrgUUID : syncParam.UUID{1}, From : testDay,
+                                 To : testDay, Owner : "owner"},
+         errorset.INVALID_PARAM},
+        {"no owner", &Request{OrgUUID : syncParam.UUID{1}, From : testDay,
+                              To : testDay.AddDate(0, 0, 1)},
+         errorset.INVALID_PARAM},
+        {"range too large", &Request{OrgUUID : syncParam.UUID{1},
+                                     From : testDay,
+                                     To : maxTo.Add(time.Second),
+                                     Owner : "owner"},
+         errorset.ROSTER_RANGE_TOO_LARGE},
+        {"range of years", &Request{OrgUUID : syncParam.UUID{1},
+                                    From : testDay,
+                                    To : testDay.AddDate(100, 0, 0),
+                                    Owner : "owner"},
+         errorset.ROSTER_RANGE_TOO_LARGE},
+    }
+    for _, test := range(tests) {
+        _, err := Generate(test.req)
+        if err == nil || err.Error() != errorOf(test.wantErr) {
+            t.Errorf("%s: got error %v, want %s", test.name, err,
+                     errorOf(test.wantErr))
+        }
+    }
+}
+
+//Largest range is accepted, the range is checked before the slots are
+// expanded.
+func TestCheckRange(t *testing.T) {
+    maxTo := testDay.AddDate(0, 0, MAX_ROSTER_DAYS)
+    tests := []struct {
+        name string
+        to time.Time
+        wantErr int
+    }{
+        {"one day", testDay.AddDate(0, 0, 1), -1},
+        {"max days", maxTo, -1},
+        {"over max days", maxTo.Add(time.Second),
+         errorset.ROSTER_RANGE_TOO_LARGE},
+        {"reversed", testDay.AddDate(0, 0, -1), errorset.INVALID_PARAM},
+    }
+    for _, test := range(tests) {
+        err := CheckRange(testDay, test.to)
+        got := ""
+        if err != nil {
+            got = err.Error()
+        }
+        if got != errorOf(test.wantErr) {
+            t.Errorf("%s: got error %v, want %s", test.name, err,
+                     errorOf(test.wantErr))
+        }
+    }
+}
+
+//Same input and seed must produce the same roster, whatever the order of
+// users in the request.
+func TestGenerateDeterministic(t *testing.T) {
+    setupDataStore(t)
+    users := []string{"det-a", "det-b", "det-c", "det-d"}
+    orgUUID := newTestOrg(t, "deterministic", users)
+    tmpl := newTestTemplate(t, orgUUID, "day", 2, nil)
+    reversed := []string{"det-d", "det-c", "det-b", "det-a"}
+    tests := []struct {
+        name string
+        users []string
+        seed int64
+    }{
+        {"same order", users, 7},
+        {"reversed order", reversed, 7},
+        {"other seed", users, 8},
+    }
+    var first [][]string
+    for i, test := range(tests) {
+        req := &Request{OrgUUID : orgUUID, From : testDay,
+                        To : testDay.AddDate(0, 0, 7),
+                        Templates : []datastore.ShiftTemplate{tmpl},
+                        Users : test.users, Seed : test.seed, Owner : "owner",
+                        Constraints : Constraints{FairnessWeight : 1}}
+        roster, err := Generate(req)
+        if err != nil {
+            t.Fatalf("%s: cannot generate roster, %s", test.name, err)
+        }
+        if i == 0 {
+            first = rosterUsers(roster)
+            continue
+        }
+        again, err := Generate(req)
+        if err != nil || !reflect.DeepEqual(rosterUsers(again),
+                                            rosterUsers(roster)) {
+            t.Errorf("%s: roster changed on the same seed", test.name)
+        }
+        if test.seed == tests[0].seed &&
+            !reflect.DeepEqual(rosterUsers(roster), first) {
+            t.Errorf("%s: got %v, want %v", test.name, rosterUsers(roster),
+                     first)
+        }
+    }
+}
+
+//The last shift cannot be staffed, the search backtracks through all the
+// choices of earlier shifts and is stopped at the step limit.
+func TestGenerateSearchLimit(t *testing.T) {
+    setupDataStore(t)
+    users := []string{"lim-a", "lim-b"}
+    orgUUID := newTestOrg(t, "search limit", users)
+    tmpl := newTestTemplate(t, orgUUID, "day", 1, nil)
+    days := 24
+    busy := map[string][]datastore.Shift{}
+    for _, userid := range(users) {
+        busy[userid] = []datastore.Shift{
+                        newTestShift(t, orgUUID, days - 1, false)}
+    }
+    req := &Request{OrgUUID : orgUUID, From : testDay,
+                    To : testDay.AddDate(0, 0, days),
+                    Templates : []datastore.ShiftTemplate{tmpl},
+                    Users : users, Busy : busy, Seed : 1, Owner : "owner"}
+    _, err := Generate(req)
+    if err == nil ||
+        err.Error() != errorset.ERROR_TYPES[errorset.SCHEDULE_SEARCH_LIMIT] {
+        t.Errorf("got error %v, want search limit", err)
+    }
+}
@@ -0,0 +1,92 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+    "fmt"
+    "time"
+    "crypto/subtle"
+    "DutyRoster/logging"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//Create a calendar feed on a new token with 'newFeed', that makes the feed
+// from the token hash. The token is in the same form as refresh token,
+// <feed uuid>.<secret>, it is returned only on creation.
+func createFeed(newFeed func(tokenHash string) *datastore.CalendarFeed) (
+                                    *datastore.CalendarFeed, string, error) {
+    secret, err := newRefreshSecret()
+    if err != nil {
+        return nil, "", err
+    }
+    feed := newFeed(hashRefreshSecret(secret))
+    err = datastore.GetDataStoreObj().CreateCalendarFeed(feed)
+    if err != nil {
+        return nil, "", err
+    }
+    return feed, syncParam.UUIDtoString(feed.UUID()) + "." + secret, nil
+}
+
+//Create a feed of the shifts of user 'userid', returns the feed and its token.
+func CreateUserFeed(userid string) (*datastore.CalendarFeed, string, error) {
+    return createFeed(func(tokenHash string) *datastore.CalendarFeed {
+        return datastore.NewUserFeed(userid, tokenHash)
+    })
+}
+
+//Create a feed of the shifts of org/unit 'orgUUID' owned by user 'userid',
+// returns the feed and its token.
+func CreateOrgFeed(orgUUID syncParam.UUID,
+                   userid string) (*datastore.CalendarFeed, string, error) {
+    return createFeed(func(tokenHash string) *datastore.CalendarFeed {
+        return datastore.NewOrgFeed(orgUUID, userid, tokenHash)
+    })
+}
+
+//Resolve the feed token to the feed and its owner. The token is rejected when
+// the feed is deleted, and when the account of owner is deleted/expired.
+func ResolveFeed(token string) (*datastore.CalendarFeed,
+                                *datastore.Users, error) {
+    log := logging.GetAppLoggerObj()
+    invalidErr := fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    dbObj := datastore.GetDataStoreObj()
+    feedUUID, secret, err := parseRefreshToken(token)
+    if err != nil {
+        return nil, nil, err
+    }
+    feed := datastore.NewCalendarFeedRef(feedUUID)
+    err = dbObj.GetCalendarFeed(feed)
+    if err != nil {
+        return nil, nil, invalidErr
+    }
+    if subtle.ConstantTimeCompare([]byte(hashRefreshSecret(secret)),
+                                  []byte(feed.TokenHash())) != 1 {
+        log.Info("Invalid token for feed %s",
+                 syncParam.UUIDtoString(feedUUID))
+        return nil, nil, invalidErr
+    }
+    user := datastore.NewUserRef(feed.Userid())
+    err = dbObj.GetUser(user)
+    if err != nil {
+        return nil, nil, invalidErr
+    }
+    if user.IsInactive(time.Now()) {
+        return nil, nil, fmt.Errorf("%s",
+                            errorset.ERROR_TYPES[errorset.USER_ACCOUNT_INACTIVE])
+    }
+    return feed, user, nil
+}
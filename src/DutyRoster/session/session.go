@@ -0,0 +1,364 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package session
+
+//******************************************************************************
+// Login sessions of the users. A login issues a short lived access token and a
+// long lived refresh token. Access token is a signed JWT of the user and its
+// roles, refresh token is an opaque token that is stored as hash in the
+// datastore and replaced on every use. A revoked session rejects all the
+// tokens issued on it.
+//******************************************************************************
+import (
+    "fmt"
+    "sync"
+    "time"
+    "strings"
+    "crypto/rand"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/hex"
+    "DutyRoster/config"
+    "DutyRoster/logging"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+)
+
+//Default token lifetimes, used when not set in the configuration.
+const (
+    DEFAULT_ACCESS_TOKEN_LIFETIME = 15 * time.Minute
+    DEFAULT_REFRESH_TOKEN_LIFETIME = 7 * 24 * time.Hour
+    //Length of random secret in refresh token and the signing key.
+    SECRET_LEN = 32
+    //Interval to remove the expired sessions from datastore.
+    SESSION_CLEANUP_INTERVAL = time.Hour
+)
+
+//Tokens issued on a login/refresh.
+type Tokens struct {
+    accessToken string
+    accessExpiry time.Time
+    refreshToken string
+    refreshExpiry time.Time
+}
+
+func (tok *Tokens)AccessToken() string {
+    return tok.accessToken
+}
+
+func (tok *Tokens)AccessExpiry() time.Time {
+    return tok.accessExpiry
+}
+
+func (tok *Tokens)RefreshToken() string {
+    return tok.refreshToken
+}
+
+func (tok *Tokens)RefreshExpiry() time.Time {
+    return tok.refreshExpiry
+}
+
+//User and its roles resolved from an access token.
+type Identity struct {
+    user *datastore.Users
+    sessionUUID syncParam.UUID
+    //Role bits of user in org/units at the time of token issue.
+    roles map[syncParam.UUID]datastore.RoleBit
+}
+
+func (id *Identity)User() *datastore.Users {
+    return id.user
+}
+
+func (id *Identity)SessionUUID() syncParam.UUID {
+    return id.sessionUUID
+}
+
+//Role bits held by the user directly in the org/units, keyed on org uuid.
+func (id *Identity)Roles() map[syncParam.UUID]datastore.RoleBit {
+    return id.roles
+}
+
+var signKeyOnce sync.Once
+var signKey []byte
+
+//Key to sign the access tokens, a random key is created when no secret is
+// configured.
+func getSignKey() []byte {
+    signKeyOnce.Do(func() {
+        secret := config.GetConfigInstance().Session.Secret
+        if len(secret) != 0 {
+            signKey = []byte(secret)
+            return
+        }
+        logging.GetAppLoggerObj().Warning("Session secret is not configured, " +
+                        "tokens will be invalid after restart")
+        signKey = make([]byte, SECRET_LEN)
+        rand.Read(signKey)
+    })
+    return signKey
+}
+
+func getTokenLifetimes() (time.Duration, time.Duration) {
+    sessConfig := config.GetConfigInstance().Session
+    access := DEFAULT_ACCESS_TOKEN_LIFETIME
+    refresh := DEFAULT_REFRESH_TOKEN_LIFETIME
+    if sessConfig.AccessTokenLifetime != 0 {
+        access = time.Duration(sessConfig.AccessTokenLifetime) * time.Second
+    }
+    if sessConfig.RefreshTokenLifetime != 0 {
+        refresh = time.Duration(sessConfig.RefreshTokenLifetime) * time.Second
+    }
+    return access, refresh
+}
+
+func hashRefreshSecret(secret string) string {
+    sum := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(sum[:])
+}
+
+//Create a random secret for refresh token.
+func newRefreshSecret() (string, error) {
+    secret := make([]byte, SECRET_LEN)
+    _, err := rand.Read(secret)
+    if err != nil {
+        return "", fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    return tokenEncoding.EncodeToString(secret), nil
+}
+
+//Refresh token is in the form <session uuid>.<secret>
+func parseRefreshToken(token string) (syncParam.UUID, string, error) {
+    fields := strings.Split(token, ".")
+    if len(fields) != 2 || len(fields[1]) == 0 {
+        return syncParam.UUID{}, "", fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    }
+    uuid := syncParam.StringtoUUID(fields[0])
+    if syncParam.IsUUIDEmpty(uuid) {
+        return uuid, "", fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    }
+    return uuid, fields[1], nil
+}
+
+//Issue an access token for the user on session 'sessUUID'.
+func issueAccessToken(user *datastore.Users, sessUUID syncParam.UUID,
+                      now time.Time) (string, time.Time, error) {
+    accessLifetime, _ := getTokenLifetimes()
+    members, err := datastore.GetDataStoreObj().ListUserMemberships(
+                                                            user.Userid())
+    if err != nil {
+        return "", now, err
+    }
+    claims := &tokenClaims{Subject : user.Userid(),
+                           SessionID : syncParam.UUIDtoString(sessUUID),
+                           IssuedAt : now.Unix(),
+                           ExpiresAt : now.Add(accessLifetime).Unix(),
+                           Roles : make(map[string]uint64)}
+    for i := range(members) {
+        claims.Roles[syncParam.UUIDtoString(members[i].UUID())] =
+                                            uint64(members[i].RoleType())
+    }
+    token, err := encodeToken(getSignKey(), claims)
+    if err != nil {
+        return "", now, fmt.Errorf("%s",
+                                errorset.ERROR_TYPES[errorset.TRY_AGAIN])
+    }
+    return token, time.Unix(claims.ExpiresAt, 0), nil
+}
+
+//Check the account is approved and not deleted/expired, tokens are never
+// issued/accepted for other accounts.
+func checkUserAccount(user *datastore.Users, now time.Time) error {
+    if user.IsInactive(now) {
+        return fmt.Errorf("%s",
+                          errorset.ERROR_TYPES[errorset.USER_ACCOUNT_INACTIVE])
+    }
+    if !user.IsApproved() {
+        return fmt.Errorf("%s",
+                    errorset.ERROR_TYPES[errorset.USER_ACCOUNT_NOT_APPROVED])
+    }
+    return nil
+}
+
+//Verify the user credentials and create a session. Deleted/expired and not
+// yet approved accounts are not allowed to login.
+func Login(userid string, password string) (*Tokens, error) {
+    log := logging.GetAppLoggerObj()
+    dbObj := datastore.GetDataStoreObj()
+    user := datastore.NewUserRef(userid)
+    err := dbObj.GetUserAccount(user, password)
+    if err != nil {
+        log.Info("Login failed for user %s, err : %s", userid, err)
+        return nil, err
+    }
+    now := time.Now()
+    err = checkUserAccount(user, now)
+    if err != nil {
+        log.Info("Login failed for user %s, err : %s", userid, err)
+        return nil, err
+    }
+    _, refreshLifetime := getTokenLifetimes()
+    secret, err := newRefreshSecret()
+    if err != nil {
+        return nil, err
+    }
+    sess := datastore.NewSession(userid, hashRefreshSecret(secret),
+                                 now.Add(refreshLifetime))
+    err = dbObj.CreateSession(sess)
+    if err != nil {
+        return nil, err
+    }
+    tok := &Tokens{refreshToken : syncParam.UUIDtoString(sess.UUID()) + "." +
+                                  secret,
+                   refreshExpiry : sess.ExpiryTime()}
+    tok.accessToken, tok.accessExpiry, err = issueAccessToken(user,
+                                                              sess.UUID(), now)
+    if err != nil {
+        return nil, err
+    }
+    log.Trace("User %s is logged in", userid)
+    return tok, nil
+}
+
+//Issue new tokens on a refresh token, the refresh token is replaced with a new
+// one. A reuse of replaced refresh token revokes the session, as the token
+// may be stolen.
+func Refresh(refreshToken string) (*Tokens, error) {
+    log := logging.GetAppLoggerObj()
+    invalidErr := fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    dbObj := datastore.GetDataStoreObj()
+    sessUUID, secret, err := parseRefreshToken(refreshToken)
+    if err != nil {
+        return nil, err
+    }
+    sess := datastore.NewSessionRef(sessUUID)
+    err = dbObj.GetSession(sess)
+    if err != nil {
+        return nil, invalidErr
+    }
+    now := time.Now()
+    if !sess.IsActive(now) {
+        return nil, invalidErr
+    }
+    oldHash := hashRefreshSecret(secret)
+    if subtle.ConstantTimeCompare([]byte(oldHash),
+                                  []byte(sess.RefreshHash())) != 1 {
+        log.Warning("Reuse of refresh token on session %s, revoking it",
+                    syncParam.UUIDtoString(sessUUID))
+        dbObj.RevokeSession(sess)
+        return nil, invalidErr
+    }
+    user := datastore.NewUserRef(sess.Userid())
+    err = dbObj.GetUser(user)
+    if err != nil {
+        return nil, invalidErr
+    }
+    err = checkUserAccount(user, now)
+    if err != nil {
+        return nil, err
+    }
+    _, refreshLifetime := getTokenLifetimes()
+    newSecret, err := newRefreshSecret()
+    if err != nil {
+        return nil, err
+    }
+    sess.SetRefreshHash(hashRefreshSecret(newSecret))
+    sess.SetExpiryTime(now.Add(refreshLifetime))
+    err = dbObj.RotateSession(sess, oldHash)
+    if err != nil {
+        //Refresh token is used concurrently.
+        return nil, invalidErr
+    }
+    tok := &Tokens{refreshToken : syncParam.UUIDtoString(sessUUID) + "." +
+                                  newSecret,
+                   refreshExpiry : sess.ExpiryTime()}
+    tok.accessToken, tok.accessExpiry, err = issueAccessToken(user, sessUUID,
+                                                              now)
+    if err != nil {
+        return nil, err
+    }
+    return tok, nil
+}
+
+//Resolve the access token to the user. The token is rejected when its session
+// is revoked/expired, and when the account is deleted/expired/not approved.
+func Authenticate(accessToken string) (*Identity, error) {
+    invalidErr := fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    now := time.Now()
+    claims, err := decodeToken(getSignKey(), accessToken, now)
+    if err != nil {
+        return nil, err
+    }
+    dbObj := datastore.GetDataStoreObj()
+    sess := datastore.NewSessionRef(syncParam.StringtoUUID(claims.SessionID))
+    err = dbObj.GetSession(sess)
+    if err != nil || !sess.IsActive(now) || sess.Userid() != claims.Subject {
+        return nil, invalidErr
+    }
+    user := datastore.NewUserRef(claims.Subject)
+    err = dbObj.GetUser(user)
+    if err != nil {
+        return nil, invalidErr
+    }
+    err = checkUserAccount(user, now)
+    if err != nil {
+        return nil, err
+    }
+    id := &Identity{user : user, sessionUUID : sess.UUID(),
+                    roles : make(map[syncParam.UUID]datastore.RoleBit)}
+    for orgStr, roles := range(claims.Roles) {
+        id.roles[syncParam.StringtoUUID(orgStr)] = datastore.RoleBit(roles)
+    }
+    return id, nil
+}
+
+//Revoke the session of the identity, all the sessions of the user are revoked
+// when 'all' is set.
+func Logout(id *Identity, all bool) error {
+    dbObj := datastore.GetDataStoreObj()
+    if all {
+        return dbObj.RevokeUserSessions(id.user.Userid())
+    }
+    return dbObj.RevokeSession(datastore.NewSessionRef(id.sessionUUID))
+}
+
+//Start a service routine to remove the expired sessions periodically.
+func StartCleanupRoutine() {
+    log := logging.GetAppLoggerObj()
+    syncObj := syncParam.GetAppSyncObj()
+    syncObj.AddServiceRoutineInWaitGroup()
+    go func() {
+        defer syncObj.ExitServiceRoutineInWaitGroup()
+        ticker := time.NewTicker(SESSION_CLEANUP_INTERVAL)
+        defer ticker.Stop()
+        for {
+            select {
+                case <- syncObj.GetServiceExitChannel():
+                    return
+                case now := <- ticker.C:
+                    err := datastore.GetDataStoreObj().DeleteExpiredSessions(
+                                                                        now)
+                    if err != nil {
+                        log.Error("Failed to remove expired sessions, %s",
+                                  err)
+                    }
+            }
+        }
+    }()
+}
@@ -0,0 +1,330 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package session
+
+import (
+    "time"
+    "testing"
+    "DutyRoster/config"
+    "DutyRoster/errorset"
+    "DutyRoster/datastore"
+    "DutyRoster/syncParam"
+    "DutyRoster/credentials"
+)
+
+const testPassword = "secret"
+
+//Use the in-memory datastore with a fixed signing key and cheap password
+// hashes. The records are shared by all the tests in the package, hence every
+// test creates its own users.
+func setupDataStore(t *testing.T) {
+    cfg := config.GetConfigInstance()
+    cfg.DB.Driver = datastore.MEMORY_DB_DRIVER
+    cfg.Session.Secret = "test-secret"
+    cfg.Credentials.Argon2Time = 1
+    cfg.Credentials.Argon2Memory = 1024
+    cfg.Credentials.Argon2Threads = 1
+    dbObj := datastore.GetDataStoreObj()
+    err := dbObj.CreateDBConnection()
+    if err != nil {
+        t.Fatalf("Cannot connect to in-memory datastore, %s", err)
+    }
+    dbObj.InitDataStore()
+}
+
+//Create the user with 'testPassword' as a member of a new org.
+func newTestUser(t *testing.T, userid string,
+                 status datastore.UserStatusBit) syncParam.UUID {
+    dbObj := datastore.GetDataStoreObj()
+    hash, err := credentials.HashPassword(testPassword)
+    if err != nil {
+        t.Fatalf("Cannot hash password, %s", err)
+    }
+    user := datastore.NewUser(userid, userid + "@test", hash, "1",
+                              time.Time{}, status, 0)
+    err = dbObj.CreateUserAccount(user)
+    if err != nil {
+        t.Fatalf("Cannot create user %s, %s", userid, err)
+    }
+    org := datastore.NewOrg(userid + " org", "test", nil,
+                            datastore.ORG_APPROVED, 0)
+    err = dbObj.CreateOrg(org)
+    if err != nil {
+        t.Fatalf("Cannot create org of %s, %s", userid, err)
+    }
+    err = dbObj.GrantUserOrgRole(datastore.NewUserOrgRole(userid,
+                                    datastore.MANAGER, org.UUID()))
+    if err != nil {
+        t.Fatalf("Cannot add %s to org, %s", userid, err)
+    }
+    return org.UUID()
+}
+
+func mustLogin(t *testing.T, userid string) *Tokens {
+    tok, err := Login(userid, testPassword)
+    if err != nil {
+        t.Fatalf("Cannot login %s, %s", userid, err)
+    }
+    return tok
+}
+
+//Return the error message of 'err', empty for no error.
+func errorOf(err error) string {
+    if err == nil {
+        return ""
+    }
+    return err.Error()
+}
+
+func setUserStatus(t *testing.T, userid string,
+                   status datastore.UserStatusBit) {
+    dbObj := datastore.GetDataStoreObj()
+    user := datastore.NewUserRef(userid)
+    err := dbObj.GetUser(user)
+    if err != nil {
+        t.Fatalf("Cannot get user %s, %s", userid, err)
+    }
+    user.SetStatus(status)
+    err = dbObj.UpdateUserAccount(user)
+    if err != nil {
+        t.Fatalf("Cannot update user %s, %s", userid, err)
+    }
+}
+
+func TestLogin(t *testing.T) {
+    setupDataStore(t)
+    tests := []struct {
+        name string
+        userid string
+        status datastore.UserStatusBit
+        password string
+        err int
+    }{
+        {"approved", "login-approved", datastore.USER_APPROVED, testPassword,
+         -1},
+        {"wrong password", "login-wrong", datastore.USER_APPROVED, "Secret",
+         errorset.INVALID_CREDENTIALS},
+        {"unknown user", "", 0, testPassword, errorset.INVALID_CREDENTIALS},
+        {"requested", "login-requested", datastore.USER_REQUESTED,
+         testPassword, errorset.USER_ACCOUNT_NOT_APPROVED},
+        {"deleted", "login-deleted",
+         datastore.USER_APPROVED | datastore.USER_DELETED, testPassword,
+         errorset.USER_ACCOUNT_INACTIVE},
+    }
+    for _, test := range(tests) {
+        userid := test.userid
+        var orgUUID syncParam.UUID
+        if len(userid) == 0 {
+            userid = "login-unknown"
+        } else {
+            orgUUID = newTestUser(t, userid, test.status)
+        }
+        tok, err := Login(userid, test.password)
+        if test.err >= 0 {
+            want := errorset.ERROR_TYPES[test.err]
+            if errorOf(err) != want {
+                t.Errorf("%s: got %v, want %s", test.name, err, want)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: %s", test.name, err)
+            continue
+        }
+        if tok.AccessExpiry().After(time.Now().Add(
+                                    DEFAULT_ACCESS_TOKEN_LIFETIME)) ||
+            !tok.RefreshExpiry().After(tok.AccessExpiry()) {
+            t.Errorf("%s: got expiry %v/%v", test.name, tok.AccessExpiry(),
+                     tok.RefreshExpiry())
+        }
+        id, err := Authenticate(tok.AccessToken())
+        if err != nil {
+            t.Errorf("%s: authenticate, %s", test.name, err)
+            continue
+        }
+        if id.User().Userid() != userid ||
+            id.Roles()[orgUUID] != datastore.MANAGER {
+            t.Errorf("%s: got identity %s/%v", test.name, id.User().Userid(),
+                     id.Roles())
+        }
+    }
+}
+
+func TestAuthenticate(t *testing.T) {
+    setupDataStore(t)
+    newTestUser(t, "auth-user", datastore.USER_APPROVED)
+    now := time.Now()
+    sign := func(key string, subject string, sid string,
+                 expiry time.Time) string {
+        token, err := encodeToken([]byte(key), &tokenClaims{
+                                        Subject : subject,
+                                        SessionID : sid,
+                                        IssuedAt : now.Unix(),
+                                        ExpiresAt : expiry.Unix()})
+        if err != nil {
+            t.Fatalf("Cannot encode token, %s", err)
+        }
+        return token
+    }
+    tok := mustLogin(t, "auth-user")
+    sessUUID, _, err := parseRefreshToken(tok.RefreshToken())
+    if err != nil {
+        t.Fatalf("Cannot parse refresh token, %s", err)
+    }
+    sid := syncParam.UUIDtoString(sessUUID)
+    unknownSID, _ := syncParam.NewUUIDString()
+    newTestUser(t, "auth-other", datastore.USER_APPROVED)
+    invalid := errorset.ERROR_TYPES[errorset.INVALID_TOKEN]
+    tests := []struct {
+        name string
+        token string
+        err string
+    }{
+        {"login token", tok.AccessToken(), ""},
+        {"signed token", sign("test-secret", "auth-user", sid,
+                              now.Add(time.Minute)), ""},
+        {"other key", sign("other-secret", "auth-user", sid,
+                           now.Add(time.Minute)), invalid},
+        {"expired", sign("test-secret", "auth-user", sid,
+                         now.Add(-time.Second)), invalid},
+        {"other user", sign("test-secret", "auth-other", sid,
+                            now.Add(time.Minute)), invalid},
+        {"unknown session", sign("test-secret", "auth-user", unknownSID,
+                                 now.Add(time.Minute)), invalid},
+        {"tampered", tok.AccessToken() + "x", invalid},
+        {"not a token", "token", invalid},
+        {"empty", "", invalid},
+    }
+    for _, test := range(tests) {
+        _, err := Authenticate(test.token)
+        if errorOf(err) != test.err {
+            t.Errorf("%s: got %v, want %q", test.name, err, test.err)
+        }
+    }
+}
+
+//Tokens of a session are rejected once the account or session is inactive.
+func TestAuthenticateInactive(t *testing.T) {
+    setupDataStore(t)
+    tests := []struct {
+        name string
+        userid string
+        revoke func(userid string, tok *Tokens)
+        err int
+    }{
+        {"logout", "inactive-logout", func(userid string, tok *Tokens) {
+            id, err := Authenticate(tok.AccessToken())
+            if err != nil {
+                t.Fatalf("Cannot authenticate %s, %s", userid, err)
+            }
+            err = Logout(id, false)
+            if err != nil {
+                t.Fatalf("Cannot logout %s, %s", userid, err)
+            }
+         }, errorset.INVALID_TOKEN},
+        {"logout all", "inactive-logout-all", func(userid string, tok *Tokens) {
+            id, err := Authenticate(mustLogin(t, userid).AccessToken())
+            if err != nil {
+                t.Fatalf("Cannot authenticate %s, %s", userid, err)
+            }
+            err = Logout(id, true)
+            if err != nil {
+                t.Fatalf("Cannot logout %s, %s", userid, err)
+            }
+         }, errorset.INVALID_TOKEN},
+        {"deleted user", "inactive-deleted", func(userid string, tok *Tokens) {
+            setUserStatus(t, userid,
+                          datastore.USER_APPROVED | datastore.USER_DELETED)
+         }, errorset.USER_ACCOUNT_INACTIVE},
+        {"approval withdrawn", "inactive-requested",
+         func(userid string, tok *Tokens) {
+            setUserStatus(t, userid, datastore.USER_REQUESTED)
+         }, errorset.USER_ACCOUNT_NOT_APPROVED},
+    }
+    for _, test := range(tests) {
+        userid := test.userid
+        newTestUser(t, userid, datastore.USER_APPROVED)
+        tok := mustLogin(t, userid)
+        test.revoke(userid, tok)
+        want := errorset.ERROR_TYPES[test.err]
+        _, err := Authenticate(tok.AccessToken())
+        if errorOf(err) != want {
+            t.Errorf("%s: authenticate got %v, want %s", test.name, err,
+                     want)
+        }
+        _, err = Refresh(tok.RefreshToken())
+        if errorOf(err) != want {
+            t.Errorf("%s: refresh got %v, want %s", test.name, err, want)
+        }
+    }
+}
+
+func TestRefresh(t *testing.T) {
+    setupDataStore(t)
+    newTestUser(t, "refresh-user", datastore.USER_APPROVED)
+    invalid := errorset.ERROR_TYPES[errorset.INVALID_TOKEN]
+    first := mustLogin(t, "refresh-user")
+    second, err := Refresh(first.RefreshToken())
+    if err != nil {
+        t.Fatalf("Cannot refresh, %s", err)
+    }
+    if second.RefreshToken() == first.RefreshToken() {
+        t.Errorf("refresh token is not rotated")
+    }
+    id, err := Authenticate(second.AccessToken())
+    if err != nil || id.User().Userid() != "refresh-user" {
+        t.Errorf("got identity %v, %v after refresh", id, err)
+    }
+    sessUUID, secret, err := parseRefreshToken(first.RefreshToken())
+    if err != nil {
+        t.Fatalf("Cannot parse refresh token, %s", err)
+    }
+    sid := syncParam.UUIDtoString(sessUUID)
+    unknownSID, _ := syncParam.NewUUIDString()
+    tests := []struct {
+        name string
+        token string
+    }{
+        {"no secret", sid + "."},
+        {"no session", "x." + secret},
+        {"unknown session", unknownSID + "." + secret},
+        {"access token", second.AccessToken()},
+    }
+    for _, test := range(tests) {
+        _, err = Refresh(test.token)
+        if errorOf(err) != invalid {
+            t.Errorf("%s: got %v, want %s", test.name, err, invalid)
+        }
+    }
+    //The tests above never matched the session, it is still active.
+    third, err := Refresh(second.RefreshToken())
+    if err != nil {
+        t.Fatalf("Cannot refresh again, %s", err)
+    }
+    //Reuse of a replaced refresh token revokes the session.
+    _, err = Refresh(first.RefreshToken())
+    if errorOf(err) != invalid {
+        t.Errorf("reuse: got %v, want %s", err, invalid)
+    }
+    _, err = Refresh(third.RefreshToken())
+    if errorOf(err) != invalid {
+        t.Errorf("refresh after reuse: got %v, want %s", err, invalid)
+    }
+    _, err = Authenticate(third.AccessToken())
+    if errorOf(err) != invalid {
+        t.Errorf("authenticate after reuse: got %v, want %s", err, invalid)
+    }
+}
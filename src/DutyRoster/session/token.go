@@ -0,0 +1,99 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package session
+
+import (
+    "fmt"
+    "time"
+    "strings"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/json"
+    "encoding/base64"
+    "DutyRoster/errorset"
+)
+
+//Only HMAC-SHA256 signed tokens are issued and accepted.
+const TOKEN_ALGORITHM = "HS256"
+
+type tokenHeader struct {
+    Alg string `json:"alg"`
+    Typ string `json:"typ"`
+}
+
+//Claims carried in the access token. Roles are the role bits of user in each
+// org/unit it is a member of, at the time of issue. The roles in the
+// descendants of the org/units are inherited from these.
+type tokenClaims struct {
+    Subject string `json:"sub"`
+    SessionID string `json:"sid"`
+    IssuedAt int64 `json:"iat"`
+    ExpiresAt int64 `json:"exp"`
+    Roles map[string]uint64 `json:"roles"`
+}
+
+var tokenEncoding = base64.RawURLEncoding
+
+func signToken(key []byte, data string) string {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return tokenEncoding.EncodeToString(mac.Sum(nil))
+}
+
+//Encode and sign the claims as JWT.
+func encodeToken(key []byte, claims *tokenClaims) (string, error) {
+    header, err := json.Marshal(tokenHeader{Alg : TOKEN_ALGORITHM,
+                                            Typ : "JWT"})
+    if err != nil {
+        return "", err
+    }
+    payload, err := json.Marshal(claims)
+    if err != nil {
+        return "", err
+    }
+    data := tokenEncoding.EncodeToString(header) + "." +
+            tokenEncoding.EncodeToString(payload)
+    return data + "." + signToken(key, data), nil
+}
+
+//Verify the signature and expiry of the JWT and decode its claims.
+func decodeToken(key []byte, token string,
+                 now time.Time) (*tokenClaims, error) {
+    invalidErr := fmt.Errorf("%s", errorset.ERROR_TYPES[errorset.INVALID_TOKEN])
+    fields := strings.Split(token, ".")
+    if len(fields) != 3 {
+        return nil, invalidErr
+    }
+    var header tokenHeader
+    headerBytes, err := tokenEncoding.DecodeString(fields[0])
+    if err != nil || json.Unmarshal(headerBytes, &header) != nil ||
+        header.Alg != TOKEN_ALGORITHM {
+        return nil, invalidErr
+    }
+    sign := signToken(key, fields[0] + "." + fields[1])
+    if !hmac.Equal([]byte(sign), []byte(fields[2])) {
+        return nil, invalidErr
+    }
+    claims := new(tokenClaims)
+    payload, err := tokenEncoding.DecodeString(fields[1])
+    if err != nil || json.Unmarshal(payload, claims) != nil {
+        return nil, invalidErr
+    }
+    if len(claims.Subject) == 0 || now.Unix() >= claims.ExpiresAt {
+        return nil, invalidErr
+    }
+    return claims, nil
+}
@@ -28,8 +28,20 @@ import (
 type syncparams struct {
     // WaitGroup to keep track of threads that are currently running.
     appWaitGroups sync.WaitGroup
-    // sync param for logproxy goroutine.
+    // sync param for logproxy goroutine. The channel is closed to signal
+    // exit, the logger drains the pending logs before it exits.
     do_log_exit chan bool
+    logExitOnce sync.Once
+    // WaitGroup to keep track of logger goroutine, to wait for the logs to
+    // drain before exit.
+    loggerWaitGroups sync.WaitGroup
+    // sync param for service goroutines, eg: http server. The channel is
+    // closed to signal exit, so all the service goroutines see it.
+    do_service_exit chan bool
+    serviceExitOnce sync.Once
+    // WaitGroup to keep track of service goroutines, logger must exit only
+    // after all the service goroutines are done.
+    serviceWaitGroups sync.WaitGroup
     // atomic counter to keep track of active goroutines.
     // Use Atomic ops to make sure synchronization.
     goroutineCnt int64
@@ -44,6 +56,7 @@ func (syncObj *syncparams)InitSyncParams() {
     once.Do(func() {
         // Create the channel for logging thread handling.
         syncObj.do_log_exit = make(chan bool)
+        syncObj.do_service_exit = make(chan bool)
     })
 }
 
@@ -52,23 +65,59 @@ func GetAppSyncObj() *syncparams {
     return appSync
 }
 
-// Exit the logger routine by sending the exit channel message to logger
-// goroutine.
-// Return true when message is sent successfully/ false otherwise.
+// Exit the logger routine by closing the exit channel of logger goroutine.
+// Safe to call more than once.
 func (syncObj *syncparams)ExitloggerRoutine() {
-    syncObj.do_log_exit <- true
+    syncObj.logExitOnce.Do(func() {
+        close(syncObj.do_log_exit)
+    })
 }
 
-// Read the exit-log signal to see if kill signal is issues for logger routine
-// Its a noblocking call, return true if exit is signaled, false otherwise.
-// DO NOT INVOKE THIS FUNCTION FROM ANY FUNCTION OTHER THAN LOGGERPROXY LISTENER
-func (syncObj *syncparams)IsLoggerExitSignaled() bool{
-    select {
-        case <- syncObj.do_log_exit:
-            return true
-        default:
-            return false
-    }
+// Exit channel of the logger routine, the channel is closed on exit.
+// DO NOT WAIT ON THIS CHANNEL FROM ANY FUNCTION OTHER THAN LOGGERPROXY LISTENER
+func (syncObj *syncparams)GetLoggerExitChannel() <-chan bool {
+    return syncObj.do_log_exit
+}
+
+// Signal exit to all the service goroutines. Safe to call more than once.
+func (syncObj *syncparams)ExitServiceRoutines() {
+    syncObj.serviceExitOnce.Do(func() {
+        close(syncObj.do_service_exit)
+    })
+}
+
+// Channel that is closed when service goroutines are signaled to exit.
+// Service goroutines block on it to wait for the exit signal.
+func (syncObj *syncparams)GetServiceExitChannel() <-chan bool {
+    return syncObj.do_service_exit
+}
+
+// Service goroutine invocation must precede with this function instead of
+// AddRoutineInWaitGroup.
+func (syncObj *syncparams)AddServiceRoutineInWaitGroup() {
+    syncObj.serviceWaitGroups.Add(1)
+    syncObj.AddRoutineInWaitGroup()
+}
+
+// Call when exiting the service goroutine after its executing.
+// NEVER INVOKE without AddServiceRoutineInWaitGroup
+func (syncObj *syncparams)ExitServiceRoutineInWaitGroup() {
+    syncObj.ExitRoutineInWaitGroup()
+    syncObj.serviceWaitGroups.Done()
+}
+
+// Logger goroutine invocation must precede with this function instead of
+// AddRoutineInWaitGroup.
+func (syncObj *syncparams)AddLoggerRoutineInWaitGroup() {
+    syncObj.loggerWaitGroups.Add(1)
+    syncObj.AddRoutineInWaitGroup()
+}
+
+// Call when exiting the logger goroutine after its executing.
+// NEVER INVOKE without AddLoggerRoutineInWaitGroup
+func (syncObj *syncparams)ExitLoggerRoutineInWaitGroup() {
+    syncObj.ExitRoutineInWaitGroup()
+    syncObj.loggerWaitGroups.Done()
 }
 
 // Any goroutine invocation must precede with with this function.
@@ -101,8 +150,13 @@ func (syncObj *syncparams)DestroyAllRoutines() {
     if cnt <= 0 {
         return
     }
-    //Exit logger routine
+    //Exit service routines first and let them finish, so their logs are
+    //not lost.
+    syncObj.ExitServiceRoutines()
+    syncObj.serviceWaitGroups.Wait()
+    //Exit logger routine and wait for it to drain the logs.
     syncObj.ExitloggerRoutine()
+    syncObj.loggerWaitGroups.Wait()
 }
 
 // Application panic.
@@ -111,7 +165,8 @@ func (syncObj *syncparams)PanicApp(msgfmt string, args ...interface{}) {
     syncObj.DestroyAllRoutines()
     panicErr := fmt.Sprintf(msgfmt, args...)
     // System is panicked, hence mark all goroutine as done unconditionally, to
-    // exit the application.
+    // exit the application. Logger and service routines are already done
+    // at this point and are not in the count.
     // No lock for these operation as we assume there are no threads are now
     // operating at waitgroup. It is very unlikely a new thread is created/
     // deleted at this stage.
@@ -0,0 +1,187 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timezone
+
+//******************************************************************************
+// Local time of the org/units. Every org has an IANA time zone, the days,
+// weekdays and wall clock times of its roster are in that zone while the
+// instants are stored in UTC. A local day is 23 or 25 hours long on the days
+// of DST change, so a day must never be computed by adding 24 hours to an
+// instant, and the end of a shift must be found on the wall clock, ie: a night
+// shift from 22:00 to 06:00 lasts 7 or 9 hours on the nights of DST change.
+// A wall clock time that is skipped by a DST change is moved forward by the
+// length of the gap, eg: 02:30 is 03:30 on the day the clocks go from 02:00
+// to 03:00. A repeated wall clock time is the first of the two instants.
+//******************************************************************************
+import (
+    "fmt"
+    "sync"
+    "time"
+    "DutyRoster/errorset"
+)
+
+const (
+    //Zone of the orgs created without a zone.
+    DEFAULT_TIME_ZONE = "UTC"
+    TIME_ZONE_STR_LEN = 64
+)
+
+//Locations loaded from the zone database, a location is read only once.
+var locations sync.Map
+
+//Return true for a known IANA zone name. 'Local' is not allowed as it is the
+// zone of the server.
+func IsTimeZoneValid(name string) bool {
+    if len(name) == 0 || len(name) >= TIME_ZONE_STR_LEN || name == "Local" {
+        return false
+    }
+    _, err := LoadLocation(name)
+    return err == nil
+}
+
+//Load the location of zone 'name', empty name is UTC. Returns
+// TIME_ZONE_INVALID for an unknown zone.
+func LoadLocation(name string) (*time.Location, error) {
+    if len(name) == 0 {
+        return time.UTC, nil
+    }
+    if loc, ok := locations.Load(name); ok {
+        return loc.(*time.Location), nil
+    }
+    loc, err := time.LoadLocation(name)
+    if err != nil || name == "Local" {
+        return nil, fmt.Errorf("%s",
+                        errorset.ERROR_TYPES[errorset.TIME_ZONE_INVALID])
+    }
+    locations.Store(name, loc)
+    return loc, nil
+}
+
+//Location of the stored zone 'name', UTC when the zone is not known to the
+// zone database of the server.
+func Location(name string) *time.Location {
+    loc, err := LoadLocation(name)
+    if err != nil {
+        return time.UTC
+    }
+    return loc
+}
+
+//Wall clock of 't' in 'loc' as an instant in UTC, to compare wall clocks.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+    t = t.In(loc)
+    return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+                     t.Second(), t.Nanosecond(), time.UTC)
+}
+
+//Instant at 'offset' on the wall clock from the midnight of the date, the
+// date is normalized same as time.Date. A wall clock time in a DST gap is
+// moved forward by the length of the gap and a repeated wall clock time is
+// the first of the two instants.
+func Date(year int, month time.Month, day int, offset time.Duration,
+               loc *time.Location) time.Time {
+    want := time.Date(year, month, day, 0, 0, 0, int(offset), time.UTC)
+    //The instant is one of the wall clock less the UTC offset before or
+    // after a change of offset around it. The go time package picks either of
+    // them depending on the zone, hence they are computed here.
+    _, before := want.Add(-24 * time.Hour).In(loc).Zone()
+    _, after := want.Add(24 * time.Hour).In(loc).Zone()
+    early := want.Add(-time.Duration(before) * time.Second).In(loc)
+    late := want.Add(-time.Duration(after) * time.Second).In(loc)
+    if late.Before(early) {
+        early, late = late, early
+    }
+    if wallClock(early, loc).Equal(want) {
+        //A repeated wall clock time is the earlier instant.
+        return early
+    }
+    //In a gap neither is on the wall clock, the later instant is the wall
+    // clock time moved forward by the length of the gap.
+    return late
+}
+
+//Start of the local day of 't' in 'loc'. The day starts after midnight when
+// the midnight is skipped by a DST change.
+func DayStart(t time.Time, loc *time.Location) time.Time {
+    t = t.In(loc)
+    return Date(t.Year(), t.Month(), t.Day(), 0, loc)
+}
+
+//Start of the local day after the day of 't' in 'loc'.
+func NextDayStart(t time.Time, loc *time.Location) time.Time {
+    t = t.In(loc)
+    return Date(t.Year(), t.Month(), t.Day() + 1, 0, loc)
+}
+
+//Start and end of the local day of 't' in 'loc', the day is the range
+// [start, end).
+func DayBounds(t time.Time, loc *time.Location) (time.Time, time.Time) {
+    return DayStart(t, loc), NextDayStart(t, loc)
+}
+
+//Length of the local day of 't', 23 or 25 hours on the days of DST change.
+func DayLength(t time.Time, loc *time.Location) time.Duration {
+    start, end := DayBounds(t, loc)
+    return end.Sub(start)
+}
+
+//Start of the local days that overlap the range [from, to), in the order of
+// time.
+func DaysIn(from time.Time, to time.Time, loc *time.Location) []time.Time {
+    days := []time.Time{}
+    for day := DayStart(from, loc); day.Before(to);
+        day = NextDayStart(day, loc) {
+        days = append(days, day)
+    }
+    return days
+}
+
+//Instant at 'offset' on the wall clock of the local day of 'day', eg: 30h
+// is 06:00 of the next day. The offset is not the elapsed time from the
+// start of the day on a day of DST change.
+func AtClock(day time.Time, offset time.Duration,
+             loc *time.Location) time.Time {
+    day = day.In(loc)
+    return Date(day.Year(), day.Month(), day.Day(), offset, loc)
+}
+
+//Window of 'length' on the wall clock from 'offset' of the local day of
+// 'day'. The elapsed time of the window differs from 'length' when a DST
+// change is in the window.
+func ClockSpan(day time.Time, offset time.Duration, length time.Duration,
+               loc *time.Location) (time.Time, time.Time) {
+    return AtClock(day, offset, loc), AtClock(day, offset + length, loc)
+}
+
+//Move 't' by 'd' on the wall clock of 'loc', eg: 22:00 moved by 8 hours is
+// 06:00 of the next day whether or not the clocks change in the night.
+func AddClock(t time.Time, d time.Duration, loc *time.Location) time.Time {
+    if d == 0 {
+        return t
+    }
+    t = t.In(loc)
+    offset := time.Duration(t.Hour()) * time.Hour +
+              time.Duration(t.Minute()) * time.Minute +
+              time.Duration(t.Second()) * time.Second +
+              time.Duration(t.Nanosecond()) + d
+    return Date(t.Year(), t.Month(), t.Day(), offset, loc)
+}
+
+//Length of the window [start, end) on the wall clock of 'loc', the inverse
+// of AddClock.
+func ClockDuration(start time.Time, end time.Time,
+                   loc *time.Location) time.Duration {
+    return wallClock(end, loc).Sub(wallClock(start, loc))
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 Sugesh Chandran
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timezone
+
+import (
+    "time"
+    "testing"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+    loc, err := LoadLocation(name)
+    if err != nil {
+        t.Fatalf("Cannot load zone %s, %s", name, err)
+    }
+    return loc
+}
+
+func mustParse(t *testing.T, value string) time.Time {
+    at, err := time.Parse(time.RFC3339, value)
+    if err != nil {
+        t.Fatalf("Cannot parse %s, %s", value, err)
+    }
+    return at
+}
+
+//Zones east and west of UTC, in both hemispheres, with 1 hour and 30 minute
+// DST changes.
+func TestDate(t *testing.T) {
+    tests := []struct {
+        name string
+        zone string
+        year int
+        month time.Month
+        day int
+        offset time.Duration
+        want string
+    }{
+        {"berlin normal", "Europe/Berlin", 2024, 3, 30, 150 * time.Minute,
+         "2024-03-30T02:30:00+01:00"},
+        {"berlin gap", "Europe/Berlin", 2024, 3, 31, 150 * time.Minute,
+         "2024-03-31T03:30:00+02:00"},
+        {"berlin repeated", "Europe/Berlin", 2024, 10, 27, 150 * time.Minute,
+         "2024-10-27T02:30:00+02:00"},
+        {"london gap", "Europe/London", 2024, 3, 31, 90 * time.Minute,
+         "2024-03-31T02:30:00+01:00"},
+        {"london repeated", "Europe/London", 2024, 10, 27, 90 * time.Minute,
+         "2024-10-27T01:30:00+01:00"},
+        {"new york gap", "America/New_York", 2024, 3, 10, 150 * time.Minute,
+         "2024-03-10T03:30:00-04:00"},
+        {"new york repeated", "America/New_York", 2024, 11, 3,
+         90 * time.Minute, "2024-11-03T01:30:00-04:00"},
+        {"sydney gap", "Australia/Sydney", 2024, 10, 6, 150 * time.Minute,
+         "2024-10-06T03:30:00+11:00"},
+        {"sydney repeated", "Australia/Sydney", 2024, 4, 7, 150 * time.Minute,
+         "2024-04-07T02:30:00+11:00"},
+        {"lord howe gap", "Australia/Lord_Howe", 2024, 10, 6, 135 * time.Minute,
+         "2024-10-06T02:45:00+11:00"},
+        {"kolkata no dst", "Asia/Kolkata", 2024, 3, 31, 150 * time.Minute,
+         "2024-03-31T02:30:00+05:30"},
+        {"santiago midnight gap", "America/Santiago", 2024, 9, 8, 0,
+         "2024-09-08T01:00:00-03:00"},
+        {"normalized date", "Europe/Berlin", 2024, 12, 31, 30 * time.Hour,
+         "2025-01-01T06:00:00+01:00"},
+    }
+    for _, test := range(tests) {
+        loc := mustLocation(t, test.zone)
+        got := Date(test.year, test.month, test.day, test.offset, loc)
+        want := mustParse(t, test.want)
+        if !got.Equal(want) || got.Location() != loc {
+            t.Errorf("%s: got %s, want %s", test.name, got, want)
+        }
+    }
+}
+
+func TestAddClock(t *testing.T) {
+    tests := []struct {
+        name string
+        zone string
+        start string
+        d time.Duration
+        want string
+    }{
+        {"berlin into gap", "Europe/Berlin", "2024-03-30T22:00:00+01:00",
+         270 * time.Minute, "2024-03-31T03:30:00+02:00"},
+        {"berlin night spring", "Europe/Berlin", "2024-03-30T22:00:00+01:00",
+         8 * time.Hour, "2024-03-31T06:00:00+02:00"},
+        {"berlin night autumn", "Europe/Berlin", "2024-10-26T22:00:00+02:00",
+         8 * time.Hour, "2024-10-27T06:00:00+01:00"},
+        {"new york night spring", "America/New_York",
+         "2024-03-09T22:00:00-05:00", 8 * time.Hour,
+         "2024-03-10T06:00:00-04:00"},
+        {"tokyo", "Asia/Tokyo", "2024-03-31T22:00:00+09:00", 8 * time.Hour,
+         "2024-04-01T06:00:00+09:00"},
+        {"zero", "Europe/Berlin", "2024-03-31T01:00:00+01:00", 0,
+         "2024-03-31T01:00:00+01:00"},
+    }
+    for _, test := range(tests) {
+        loc := mustLocation(t, test.zone)
+        got := AddClock(mustParse(t, test.start), test.d, loc)
+        want := mustParse(t, test.want)
+        if !got.Equal(want) {
+            t.Errorf("%s: got %s, want %s", test.name, got.In(loc), want)
+        }
+    }
+}
+
+func TestDayLength(t *testing.T) {
+    tests := []struct {
+        zone string
+        day string
+        want time.Duration
+    }{
+        {"Europe/Berlin", "2024-03-31T12:00:00Z", 23 * time.Hour},
+        {"Europe/Berlin", "2024-10-27T12:00:00Z", 25 * time.Hour},
+        {"Europe/London", "2024-03-31T12:00:00Z", 23 * time.Hour},
+        {"America/New_York", "2024-11-03T12:00:00Z", 25 * time.Hour},
+        {"Australia/Sydney", "2024-10-06T00:00:00Z", 23 * time.Hour},
+        {"Australia/Lord_Howe", "2024-10-06T00:00:00Z",
+         23 * time.Hour + 30 * time.Minute},
+        {"Asia/Kolkata", "2024-03-31T12:00:00Z", 24 * time.Hour},
+    }
+    for _, test := range(tests) {
+        loc := mustLocation(t, test.zone)
+        got := DayLength(mustParse(t, test.day), loc)
+        if got != test.want {
+            t.Errorf("%s %s: got %s, want %s", test.zone, test.day, got,
+                     test.want)
+        }
+    }
+}
+
+func TestClockSpan(t *testing.T) {
+    tests := []struct {
+        zone string
+        day string
+        elapsed time.Duration
+    }{
+        {"Europe/Berlin", "2024-03-30T12:00:00Z", 7 * time.Hour},
+        {"Europe/Berlin", "2024-10-26T12:00:00Z", 9 * time.Hour},
+        {"America/New_York", "2024-03-09T17:00:00Z", 7 * time.Hour},
+        {"America/New_York", "2024-11-02T17:00:00Z", 9 * time.Hour},
+        {"Asia/Tokyo", "2024-03-30T03:00:00Z", 8 * time.Hour},
+    }
+    for _, test := range(tests) {
+        loc := mustLocation(t, test.zone)
+        start, end := ClockSpan(mustParse(t, test.day), 22 * time.Hour,
+                                8 * time.Hour, loc)
+        if end.Sub(start) != test.elapsed {
+            t.Errorf("%s %s: elapsed %s, want %s", test.zone, test.day,
+                     end.Sub(start), test.elapsed)
+        }
+        if ClockDuration(start, end, loc) != 8 * time.Hour {
+            t.Errorf("%s %s: clock duration %s", test.zone, test.day,
+                     ClockDuration(start, end, loc))
+        }
+        if start.In(loc).Hour() != 22 || end.In(loc).Hour() != 6 {
+            t.Errorf("%s %s: span %s - %s", test.zone, test.day,
+                     start.In(loc), end.In(loc))
+        }
+    }
+}
+
+func TestLoadLocation(t *testing.T) {
+    if !IsTimeZoneValid("Europe/Berlin") || IsTimeZoneValid("Local") ||
+        IsTimeZoneValid("Mars/Olympus") || IsTimeZoneValid("") {
+        t.Errorf("Zone validation is wrong")
+    }
+    if Location("Mars/Olympus") != time.UTC {
+        t.Errorf("Unknown zone must fall back to UTC")
+    }
+}